@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/zeozeozeo/gopsx/emulator"
+)
+
+// How long an unlocked achievement stays on screen
+const achievementMessageTime = 5 * time.Second
+
+var (
+	raUser     *string // RetroAchievements account, achievements are off without one
+	raPassword *string
+	// Unlocked achievements shown on screen, the oldest first. Written on
+	// the emulator goroutine
+	achievementMessages   []achievementMessage
+	achievementMessagesMu sync.Mutex
+)
+
+// An unlocked achievement shown on screen until `end`
+type achievementMessage struct {
+	text string
+	end  time.Time
+}
+
+// Logs in to RetroAchievements and loads the achievements of `disc` in the
+// background, they're tested as soon as they're downloaded
+func startAchievements(inter *emulator.Interconnect, disc *emulator.Disc) {
+	password := *raPassword
+	if password == "" {
+		password = os.Getenv("GOPSX_RA_PASSWORD")
+	}
+	client := emulator.NewAchievementClient(*raUser)
+	engine := emulator.NewAchievementEngine()
+	engine.OnUnlock = func(achievement *emulator.Achievement) {
+		showAchievement(achievement)
+		go func() {
+			if err := client.Award(achievement.ID); err != nil {
+				fmt.Printf("main: couldn't send the achievement %d: %s\n", achievement.ID, err)
+			}
+		}()
+	}
+	inter.Achievements = engine
+
+	go func() {
+		game, err := loadAchievements(client, password, disc)
+		if err != nil {
+			fmt.Printf("main: achievements: %s\n", err)
+			return
+		}
+		unlocked := 0
+		for _, achievement := range game.Achievements {
+			if achievement.Unlocked {
+				unlocked++
+			}
+			engine.Add(achievement)
+		}
+		fmt.Printf(
+			"main: %s: %d achievements, %d unlocked\n",
+			game.Title, len(game.Achievements), unlocked,
+		)
+	}()
+}
+
+// Logs in and downloads the achievements of the game on `disc`
+func loadAchievements(client *emulator.AchievementClient, password string, disc *emulator.Disc) (*emulator.AchievementGame, error) {
+	hash, err := disc.AchievementHash()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't hash the disc: %w", err)
+	}
+	if err := client.Login(password); err != nil {
+		return nil, err
+	}
+	id, err := client.GameID(hash)
+	if err != nil {
+		return nil, err
+	}
+	if id == 0 {
+		return nil, fmt.Errorf("unknown game (hash %s)", hash)
+	}
+	return client.Game(id)
+}
+
+// Shows an unlocked achievement on screen
+func showAchievement(achievement *emulator.Achievement) {
+	fmt.Printf("main: achievement unlocked: %s (%s)\n", achievement.Title, achievement.Description)
+	achievementMessagesMu.Lock()
+	defer achievementMessagesMu.Unlock()
+	achievementMessages = append(achievementMessages, achievementMessage{
+		text: fmt.Sprintf("Achievement unlocked: %s (%d points)\n%s", achievement.Title, achievement.Points, achievement.Description),
+		end:  time.Now().Add(achievementMessageTime),
+	})
+}
+
+// Draws the achievements unlocked in the last seconds at the bottom of
+// the screen, above the savestate messages
+func drawAchievementMessages(screen *ebiten.Image) {
+	achievementMessagesMu.Lock()
+	defer achievementMessagesMu.Unlock()
+	now := time.Now()
+	for len(achievementMessages) > 0 && now.After(achievementMessages[0].end) {
+		achievementMessages = achievementMessages[1:]
+	}
+	if len(achievementMessages) == 0 {
+		return
+	}
+
+	var sb strings.Builder
+	for _, msg := range achievementMessages {
+		sb.WriteString(msg.text)
+		sb.WriteByte('\n')
+	}
+	ebitenutil.DebugPrintAt(screen, sb.String(), 8, height-48-len(achievementMessages)*2*16)
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/zeozeozeo/gopsx/emulator"
+)
+
+// A command line tool that runs without the emulator window, e.g.
+// `gopsx disasm bios.bin`
+type command struct {
+	usage string // Arguments, shown in the help
+	help  string
+	run   func(args []string) error
+}
+
+var commands = map[string]*command{
+	"disasm": {
+		"[-base address] [-symbols file] file",
+		"disassemble a BIOS image or a raw MIPS binary",
+		runDisasm,
+	},
+	"cdinfo": {
+		"disc.cue|disc.bin",
+		"print the region, the game ID, the tracks and SYSTEM.CNF of a disc image",
+		runCdInfo,
+	},
+	"memcard": {
+		"ls card.mcd",
+		"list the saves on a memory card image",
+		runMemcard,
+	},
+	"testrom": {
+		"[-seconds n] [-v] rom.exe ...",
+		"run test ROMs without a BIOS and report the tests they print as passed or failed",
+		runTestRom,
+	},
+}
+
+// Arguments of `run`, it's not in `commands` since its help lists them
+const runUsage = "[flags] [disc.cue|disc.bin ...]"
+
+// Names of the commands in the order they're listed in the help
+var commandNames = []string{"run", "disasm", "cdinfo", "memcard", "testrom"}
+
+var errUsage = errors.New("invalid arguments")
+
+// Prints the help of the subcommands and the flags of `run`
+func usage(runFlags *flag.FlagSet) {
+	out := runFlags.Output()
+	fmt.Fprintf(out, "usage:\n")
+	for _, name := range commandNames {
+		if name == "run" {
+			fmt.Fprintf(out, "  gopsx [run] %s\n\trun the emulator (the default)\n", runUsage)
+			continue
+		}
+		cmd := commands[name]
+		fmt.Fprintf(out, "  gopsx %s %s\n\t%s\n", name, cmd.usage, cmd.help)
+	}
+	fmt.Fprintf(out, "\nflags of run:\n")
+	runFlags.PrintDefaults()
+}
+
+// Runs the subcommand named in the first argument, or the emulator if
+// there's no subcommand
+func runCommand(args []string) {
+	name := "run"
+	if len(args) > 0 && (args[0] == "run" || commands[args[0]] != nil) {
+		name, args = args[0], args[1:]
+	}
+	cmdUsage, run := runUsage, runEmulator
+	if cmd, ok := commands[name]; ok {
+		cmdUsage, run = cmd.usage, cmd.run
+	}
+
+	err := run(args)
+	if errors.Is(err, errUsage) {
+		fmt.Fprintf(os.Stderr, "usage: gopsx %s %s\n", name, cmdUsage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "main: %s: %s\n", name, err)
+		os.Exit(1)
+	}
+}
+
+// gopsx disasm [-base address] [-symbols file] file
+func runDisasm(args []string) error {
+	flags := flag.NewFlagSet("disasm", flag.ContinueOnError)
+	base := flags.String("base", "0xbfc00000", "address of the first instruction")
+	symbolsPath := flags.String("symbols", "", "symbol file (.sym, .map or ELF) naming the functions")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return errUsage
+	}
+	addr, err := strconv.ParseUint(*base, 0, 32)
+	if err != nil {
+		return fmt.Errorf("invalid base address \"%s\"", *base)
+	}
+	var symbols *emulator.Symbols
+	if *symbolsPath != "" {
+		file, err := os.Open(*symbolsPath)
+		if err != nil {
+			return err
+		}
+		symbols, err = emulator.LoadSymbols(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", *symbolsPath, err)
+		}
+	}
+
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	for i := 0; i+4 <= len(data); i += 4 {
+		pc := uint32(addr) + uint32(i)
+		op := emulator.Instruction(binary.LittleEndian.Uint32(data[i:]))
+		if symbol, offset, ok := symbols.Lookup(pc); ok && offset == 0 {
+			fmt.Printf("\n%s:\n", symbol.Name)
+		}
+		fmt.Printf("%08x: %08x  %s\n", pc, uint32(op), op.DisassembleSymbols(pc, symbols))
+	}
+	return nil
+}
+
+// gopsx cdinfo disc
+func runCdInfo(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	disc, err := loadDisc(args[0])
+	var regionErr *emulator.ErrUnknownRegion
+	if errors.As(err, &regionErr) {
+		return fmt.Errorf("not a PlayStation disc (license string: \"%s\")", regionErr.License)
+	}
+	if err != nil {
+		return err
+	}
+	defer disc.Close()
+
+	fmt.Printf("region: %s\n", disc.RegionString())
+	fmt.Printf("length: %s (%d sectors)\n", sectorTime(disc.End()), disc.End())
+	fmt.Printf("tracks: %d\n", len(disc.Tracks))
+	for _, track := range disc.Tracks {
+		kind := "data "
+		if track.IsAudio() {
+			kind = "audio"
+		}
+		fmt.Printf(
+			"  %02d %s start %s length %s pregap %d\n",
+			track.Number, kind, sectorTime(track.Start), sectorTime(track.Length), track.Pregap,
+		)
+	}
+
+	if id := disc.GameID(); id != "" {
+		fmt.Printf("game ID: %s\n", id)
+	}
+	if boot := disc.BootPath(); boot != "" {
+		fmt.Printf("boot: %s\n", boot)
+	}
+	cnf, err := disc.ReadFile("SYSTEM.CNF")
+	if errors.Is(err, emulator.ErrFileNotFound) {
+		fmt.Println("no SYSTEM.CNF")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("SYSTEM.CNF:\n%s\n", strings.TrimRight(string(cnf), "\r\n\x00"))
+	return nil
+}
+
+// Returns a sector count as minutes, seconds and frames (mm:ss:ff)
+func sectorTime(sectors uint32) string {
+	return fmt.Sprintf("%02d:%02d:%02d", sectors/75/60, sectors/75%60, sectors%75)
+}
+
+// gopsx memcard ls card.mcd
+func runMemcard(args []string) error {
+	if len(args) != 2 || args[0] != "ls" {
+		return errUsage
+	}
+	file, err := os.Open(args[1])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	card, err := emulator.LoadMemoryCardImage(file)
+	if err != nil {
+		return err
+	}
+	for _, save := range card.Saves() {
+		fmt.Printf("%2d  %2d blocks  %-20s  %s\n", save.Block, len(save.Blocks), save.Name, save.Title)
+	}
+	fmt.Printf("%d free blocks\n", card.FreeBlocks())
+	return nil
+}
+
+// gopsx testrom [-seconds n] [-v] rom.exe ...
+func runTestRom(args []string) error {
+	flags := flag.NewFlagSet("testrom", flag.ContinueOnError)
+	seconds := flags.Float64("seconds", 60, "emulated time a ROM can run for if it doesn't exit")
+	verbose := flags.Bool("v", false, "print the output of the ROMs")
+	if err := flags.Parse(args); err != nil || flags.NArg() == 0 || *seconds <= 0 {
+		return errUsage
+	}
+	cycles := uint64(*seconds * float64(emulator.CPU_FREQ_HZ))
+
+	failed := 0
+	for _, path := range flags.Args() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		result, err := emulator.RunTestRom(data, cycles)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		verdict := "PASS"
+		if !result.Ok() {
+			verdict = "FAIL"
+			failed++
+		}
+		fmt.Printf("%s %s: %d passed, %d failed", verdict, path, result.Passed, len(result.Failures))
+		if result.Exited {
+			fmt.Printf(", exit code %d\n", result.ExitCode)
+		} else {
+			fmt.Printf(", timed out\n")
+		}
+		if *verbose {
+			fmt.Print(result.Output)
+		} else {
+			for _, line := range result.Failures {
+				fmt.Printf("  %s\n", line)
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d test ROMs failed", failed, flags.NArg())
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+//go:build !js
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/zeozeozeo/gopsx/emulator"
+)
+
+// Opcodes of the Discord IPC frames
+const (
+	discordOpHandshake = 0
+	discordOpFrame     = 1
+)
+
+// Shows the game and the play time in the Discord status of the user
+// (Rich Presence), through the IPC socket of the Discord client
+type discordPresence struct {
+	appID   string
+	conn    io.ReadWriteCloser // Nil when not connected
+	updates chan emulator.Event
+	nonce   int
+}
+
+// Connects to Discord in the background and updates the status with the
+// events of the console. `appID` is the ID of a Discord application, its
+// name is shown as the game being played
+func startDiscord(appID string, events *emulator.EventBus) {
+	presence := &discordPresence{appID: appID, updates: make(chan emulator.Event, 16)}
+	events.Subscribe(func(ev emulator.Event) {
+		if ev.Type == emulator.EVENT_PLAY_TIME {
+			return // Discord counts the time itself
+		}
+		select {
+		case presence.updates <- ev:
+		default: // Discord is slow, drop the update
+		}
+	})
+	go presence.run()
+}
+
+// Sends the updates to Discord, reconnecting if the client was restarted
+func (presence *discordPresence) run() {
+	var start time.Time
+	for ev := range presence.updates {
+		if ev.Type == emulator.EVENT_GAME_LOADED {
+			start = time.Now()
+		}
+		if presence.conn == nil {
+			if err := presence.connect(); err != nil {
+				fmt.Printf("main: discord: %s\n", err)
+				continue
+			}
+		}
+		if err := presence.setActivity(ev, start); err != nil {
+			fmt.Printf("main: discord: %s\n", err)
+			presence.conn.Close()
+			presence.conn = nil
+		}
+	}
+}
+
+// Opens the IPC socket (a named pipe on Windows) and says hello
+func (presence *discordPresence) connect() error {
+	var err error
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("discord-ipc-%d", i)
+		if runtime.GOOS == "windows" {
+			presence.conn, err = os.OpenFile(`\\.\pipe\`+name, os.O_RDWR, 0)
+		} else {
+			presence.conn, err = net.Dial("unix", filepath.Join(discordDir(), name))
+		}
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("the Discord client isn't running (%w)", err)
+	}
+
+	handshake := map[string]interface{}{"v": 1, "client_id": presence.appID}
+	if err := presence.send(discordOpHandshake, handshake); err != nil {
+		presence.conn.Close()
+		presence.conn = nil
+		return err
+	}
+	return nil
+}
+
+// Returns the directory of the IPC socket
+func discordDir() string {
+	for _, env := range []string{"XDG_RUNTIME_DIR", "TMPDIR", "TMP", "TEMP"} {
+		if dir := os.Getenv(env); dir != "" {
+			return dir
+		}
+	}
+	return "/tmp"
+}
+
+// Shows the title of the game, with the time since it started
+func (presence *discordPresence) setActivity(ev emulator.Event, start time.Time) error {
+	activity := map[string]interface{}{"details": ev.Title}
+	switch {
+	case ev.Title == "":
+		activity["details"] = "In the BIOS"
+	case ev.Type != emulator.EVENT_GAME_LOADED:
+		activity["state"] = "Booting"
+	default:
+		activity["timestamps"] = map[string]int64{"start": start.Unix()}
+		if ev.GameID != "" && ev.GameID != ev.Title {
+			activity["state"] = ev.GameID
+		}
+	}
+
+	presence.nonce++
+	return presence.send(discordOpFrame, map[string]interface{}{
+		"cmd":   "SET_ACTIVITY",
+		"args":  map[string]interface{}{"pid": os.Getpid(), "activity": activity},
+		"nonce": fmt.Sprint(presence.nonce),
+	})
+}
+
+// Sends a frame and reads the reply, which is ignored
+func (presence *discordPresence) send(op uint32, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	frame := make([]byte, 8, 8+len(data))
+	binary.LittleEndian.PutUint32(frame, op)
+	binary.LittleEndian.PutUint32(frame[4:], uint32(len(data)))
+	if _, err := presence.conn.Write(append(frame, data...)); err != nil {
+		return err
+	}
+
+	var header [8]byte
+	if _, err := io.ReadFull(presence.conn, header[:]); err != nil {
+		return err
+	}
+	_, err = io.CopyN(io.Discard, presence.conn, int64(binary.LittleEndian.Uint32(header[4:])))
+	return err
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/zeozeozeo/gopsx/emulator"
+)
+
+// Special values of aspectRatio
+const (
+	aspectPixel   = -1 // Square pixels, the shape of the display resolution
+	aspectStretch = 0  // Fill the window
+)
+
+var (
+	aspectRatio  float64 = 4.0 / 3 // Width/height of the picture, see parseAspect
+	integerScale *bool             // Scale the picture by whole numbers
+	// Area of currentFrame shown on the TV, from the last presented frame
+	displayArea image.Rectangle
+)
+
+// Parses the value of -aspect: a width:height ratio (4:3, 16:9...),
+// "pixel" or "stretch"
+func parseAspect(s string) (float64, error) {
+	switch s {
+	case "pixel":
+		return aspectPixel, nil
+	case "stretch":
+		return aspectStretch, nil
+	}
+	w, h, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, fmt.Errorf("invalid aspect ratio \"%s\"", s)
+	}
+	width, err := strconv.ParseFloat(w, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid aspect ratio \"%s\"", s)
+	}
+	height, err := strconv.ParseFloat(h, 64)
+	if err != nil || width <= 0 || height <= 0 {
+		return 0, fmt.Errorf("invalid aspect ratio \"%s\"", s)
+	}
+	return width / height, nil
+}
+
+// Returns the part of currentFrame that is shown: the display area of the
+// GPU, or the whole frame if the display isn't set up
+func visibleArea() image.Rectangle {
+	area := displayArea.Intersect(currentFrame.Bounds())
+	if area.Empty() {
+		return currentFrame.Bounds()
+	}
+	return area
+}
+
+// Returns where a picture of `size` goes on the screen, centered and scaled
+// with the aspect ratio and integer scaling settings
+func displayRect(size image.Point) image.Rectangle {
+	srcW, srcH := float64(size.X), float64(size.Y)
+	screenW, screenH := float64(width), float64(height)
+
+	var w, h float64
+	switch {
+	case aspectRatio == aspectStretch:
+		w, h = screenW, screenH
+		if *integerScale && screenW >= srcW && screenH >= srcH {
+			w = math.Floor(screenW/srcW) * srcW
+			h = math.Floor(screenH/srcH) * srcH
+		}
+	default:
+		ratio := aspectRatio
+		if ratio == aspectPixel {
+			ratio = srcW / srcH
+		}
+		// fit the height, or the width if the screen is narrower
+		h = math.Min(screenH, screenW/ratio)
+		if *integerScale && h >= srcH {
+			h = math.Floor(h/srcH) * srcH
+		}
+		w = h * ratio
+	}
+
+	x, y := (screenW-w)/2, (screenH-h)/2
+	return image.Rect(int(x), int(y), int(x+w), int(y+h))
+}
+
+// Draws the visible part of currentFrame
+func drawFrame(screen *ebiten.Image) {
+	src := visibleArea()
+	dst := displayRect(src.Size())
+	if dst.Empty() {
+		return
+	}
+	if postShader != nil {
+		drawPostProcessed(screen, src, dst)
+		return
+	}
+
+	op := &ebiten.DrawImageOptions{}
+	op.Filter = frameFilter
+	op.GeoM.Scale(float64(dst.Dx())/float64(src.Dx()), float64(dst.Dy())/float64(src.Dy()))
+	op.GeoM.Translate(float64(dst.Min.X), float64(dst.Min.Y))
+	screen.DrawImage(currentFrame.SubImage(src).(*ebiten.Image), op)
+}
+
+// Returns the VRAM position under a point of the screen
+func screenToVram(x, y int) (int, int) {
+	src := visibleArea()
+	dst := displayRect(src.Size())
+	if dst.Empty() {
+		return src.Min.X, src.Min.Y
+	}
+	vramX := src.Min.X + (x-dst.Min.X)*src.Dx()/dst.Dx()
+	vramY := src.Min.Y + (y-dst.Min.Y)*src.Dy()/dst.Dy()
+	return vramX, vramY
+}
+
+// Shows the title of the game and the play time in the window title
+func updateWindowTitle(ev emulator.Event) {
+	title := "gopsx"
+	if ev.Title != "" {
+		title += " - " + ev.Title
+	}
+	if ev.PlayTime >= time.Minute {
+		minutes := int(ev.PlayTime / time.Minute)
+		title += fmt.Sprintf(" (%d:%02d)", minutes/60, minutes%60)
+	}
+	ebiten.SetWindowTitle(title)
+}
+
+// F toggles fullscreen
+func handleDisplayKeys() {
+	if inpututil.IsKeyJustPressed(ebiten.KeyF) {
+		ebiten.SetFullscreen(!ebiten.IsFullscreen())
+	}
+}
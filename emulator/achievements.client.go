@@ -0,0 +1,187 @@
+package emulator
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Address of the RetroAchievements API
+const RETROACHIEVEMENTS_API_URL = "https://retroachievements.org/dorequest.php"
+
+// Flags of the official achievements, the others are unofficial
+const ACHIEVEMENT_FLAGS_CORE = 3
+
+// Talks to the RetroAchievements server: logs in, identifies the game,
+// downloads its achievements and reports the unlocks. Unlocks are sent in
+// softcore mode, hardcore isn't supported
+type AchievementClient struct {
+	URL       string // RETROACHIEVEMENTS_API_URL by default
+	UserAgent string
+	User      string
+	Token     string // Set by Login
+	Http      *http.Client
+}
+
+// A game of the RetroAchievements database and its official achievements
+type AchievementGame struct {
+	ID           uint32
+	Title        string
+	Achievements []*Achievement
+}
+
+// Returns a client for the account `user`
+func NewAchievementClient(user string) *AchievementClient {
+	return &AchievementClient{
+		URL:       RETROACHIEVEMENTS_API_URL,
+		UserAgent: "gopsx",
+		User:      user,
+		Http:      &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Sends the request `r` and decodes the response into `response`, which
+// must embed achievementResponse
+func (client *AchievementClient) request(r string, params url.Values, response interface{ result() error }) error {
+	params.Set("r", r)
+	// the parameters go in the body, they contain the password or the token
+	req, err := http.NewRequest(http.MethodPost, client.URL, strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", client.UserAgent)
+	resp, err := client.Http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("retroachievements: %s", resp.Status)
+		}
+		return fmt.Errorf("retroachievements: %w", err)
+	}
+	return response.result()
+}
+
+// Fields of every response
+type achievementResponse struct {
+	Success bool
+	Error   string
+}
+
+func (resp *achievementResponse) result() error {
+	if !resp.Success {
+		if resp.Error == "" {
+			return errors.New("retroachievements: request failed")
+		}
+		return fmt.Errorf("retroachievements: %s", resp.Error)
+	}
+	return nil
+}
+
+// Logs in with the password of the account and sets Token
+func (client *AchievementClient) Login(password string) error {
+	var resp struct {
+		achievementResponse
+		Token string
+	}
+	err := client.request("login", url.Values{"u": {client.User}, "p": {password}}, &resp)
+	if err != nil {
+		return err
+	}
+	client.Token = resp.Token
+	return nil
+}
+
+// Returns the ID of the game with the disc hash `hash` (see
+// Disc.AchievementHash), 0 if the game isn't known
+func (client *AchievementClient) GameID(hash string) (uint32, error) {
+	var resp struct {
+		achievementResponse
+		GameID uint32
+	}
+	err := client.request("gameid", url.Values{"m": {hash}}, &resp)
+	return resp.GameID, err
+}
+
+// Downloads the official achievements of the game `id` and marks the ones
+// the user already unlocked
+func (client *AchievementClient) Game(id uint32) (*AchievementGame, error) {
+	var patch struct {
+		achievementResponse
+		PatchData struct {
+			ID           uint32
+			Title        string
+			Achievements []struct {
+				ID          uint32
+				MemAddr     string
+				Title       string
+				Description string
+				Points      int
+				Flags       int
+			}
+		}
+	}
+	params := url.Values{"u": {client.User}, "t": {client.Token}, "g": {fmt.Sprint(id)}}
+	if err := client.request("patch", params, &patch); err != nil {
+		return nil, err
+	}
+
+	var unlocks struct {
+		achievementResponse
+		UserUnlocks []uint32
+	}
+	params = url.Values{"u": {client.User}, "t": {client.Token}, "g": {fmt.Sprint(id)}, "h": {"0"}}
+	if err := client.request("unlocks", params, &unlocks); err != nil {
+		return nil, err
+	}
+	unlocked := map[uint32]bool{}
+	for _, id := range unlocks.UserUnlocks {
+		unlocked[id] = true
+	}
+
+	game := &AchievementGame{ID: patch.PatchData.ID, Title: patch.PatchData.Title}
+	for _, data := range patch.PatchData.Achievements {
+		if data.Flags != ACHIEVEMENT_FLAGS_CORE {
+			continue
+		}
+		trigger, err := ParseAchievementTrigger(data.MemAddr)
+		if err != nil {
+			return nil, fmt.Errorf("achievement %d (%s): %w", data.ID, data.Title, err)
+		}
+		game.Achievements = append(game.Achievements, &Achievement{
+			ID:          data.ID,
+			Title:       data.Title,
+			Description: data.Description,
+			Points:      data.Points,
+			Trigger:     trigger,
+			Unlocked:    unlocked[data.ID],
+		})
+	}
+	return game, nil
+}
+
+// Reports that the achievement `id` was unlocked
+func (client *AchievementClient) Award(id uint32) error {
+	// the server checks the signature of the request
+	sum := md5.Sum([]byte(strconv.FormatUint(uint64(id), 10) + client.User + "0"))
+	params := url.Values{
+		"u": {client.User},
+		"t": {client.Token},
+		"a": {fmt.Sprint(id)},
+		"h": {"0"},
+		"v": {hex.EncodeToString(sum[:])},
+	}
+	var resp achievementResponse
+	return client.request("awardachievement", params, &resp)
+}
@@ -0,0 +1,141 @@
+package emulator
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"sync"
+)
+
+// A RetroAchievements achievement
+type Achievement struct {
+	ID          uint32
+	Title       string
+	Description string
+	Points      int
+	Trigger     *AchievementTrigger
+	Unlocked    bool
+	// The trigger was false once, achievements can't unlock as soon as
+	// they're loaded
+	primed bool
+}
+
+// Tests the triggers of the achievements at the start of every VBlank,
+// like the RetroAchievements clients do once per frame. See
+// Interconnect.Achievements
+type AchievementEngine struct {
+	Achievements []*Achievement
+	// Called on the emulator goroutine when achievements unlock, nil if
+	// unused
+	OnUnlock func(achievement *Achievement)
+	mu       sync.Mutex // Achievements can be loaded by the frontend at any time
+}
+
+// Returns an engine without achievements
+func NewAchievementEngine() *AchievementEngine {
+	return &AchievementEngine{}
+}
+
+// Adds an achievement. Achievements that are already unlocked are never
+// tested
+func (engine *AchievementEngine) Add(achievement *Achievement) {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+	engine.Achievements = append(engine.Achievements, achievement)
+}
+
+// Removes every achievement, e.g. when another disc is inserted
+func (engine *AchievementEngine) Clear() {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+	engine.Achievements = nil
+}
+
+// Makes the achievements wait for their trigger to be false again before
+// they can unlock, and clears the hit counts. Call it when the console is
+// reset or a savestate is loaded
+func (engine *AchievementEngine) Reset() {
+	if engine == nil {
+		return
+	}
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+	for _, achievement := range engine.Achievements {
+		achievement.primed = false
+		achievement.Trigger.Reset()
+	}
+}
+
+// Returns the byte at the RetroAchievements address `addr`
+func achievementMemoryOf(ram *RAM, scratchPad *ScratchPad) achievementMemory {
+	return func(addr uint32) byte {
+		switch {
+		case addr < RAM_ALLOC_SIZE:
+			return ram.Data[addr]
+		case addr-ACHIEVEMENT_SCRATCHPAD_ADDR < SCRATCH_PAD_SIZE:
+			return scratchPad.Data[addr-ACHIEVEMENT_SCRATCHPAD_ADDR]
+		}
+		return 0
+	}
+}
+
+// Tests the triggers of the locked achievements. Does nothing on a nil
+// engine
+func (engine *AchievementEngine) Frame(ram *RAM, scratchPad *ScratchPad) {
+	if engine == nil {
+		return
+	}
+	engine.mu.Lock()
+	mem := achievementMemoryOf(ram, scratchPad)
+	var unlocked []*Achievement
+	for _, achievement := range engine.Achievements {
+		if achievement.Unlocked {
+			continue
+		}
+		ok := achievement.Trigger.test(mem)
+		if !achievement.primed {
+			// the hits only count once the trigger was false
+			achievement.Trigger.Reset()
+			achievement.primed = !ok
+			continue
+		}
+		if ok {
+			achievement.Unlocked = true
+			unlocked = append(unlocked, achievement)
+		}
+	}
+	onUnlock := engine.OnUnlock
+	engine.mu.Unlock()
+
+	if onUnlock != nil {
+		for _, achievement := range unlocked {
+			onUnlock(achievement)
+		}
+	}
+}
+
+// Returns the RetroAchievements hash of the disc, which identifies the
+// game on the server: the MD5 of the name of the boot executable followed
+// by the executable
+func (disc *Disc) AchievementHash() (string, error) {
+	name := trimBootPath(disc.BootPath())
+	if name == "" {
+		return "", ErrFileNotFound
+	}
+	exe, err := disc.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+
+	// only the header and the text of an executable, discs pad them
+	if len(exe) >= 0x800 && string(exe[:8]) == "PS-X EXE" {
+		if size := binary.LittleEndian.Uint32(exe[0x1c:]) + 0x800; size < uint32(len(exe)) {
+			exe = exe[:size]
+		}
+	}
+
+	hash := md5.New()
+	hash.Write([]byte(name))
+	hash.Write(exe)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,504 @@
+package emulator
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// Size of a memory operand of a trigger, the letter after "0x"
+type achievementSize byte
+
+const (
+	ACHIEVEMENT_8BIT     achievementSize = 'H'
+	ACHIEVEMENT_16BIT    achievementSize = ' '
+	ACHIEVEMENT_24BIT    achievementSize = 'W'
+	ACHIEVEMENT_32BIT    achievementSize = 'X'
+	ACHIEVEMENT_16BIT_BE achievementSize = 'I'
+	ACHIEVEMENT_24BIT_BE achievementSize = 'J'
+	ACHIEVEMENT_32BIT_BE achievementSize = 'G'
+	ACHIEVEMENT_LOWER4   achievementSize = 'L'
+	ACHIEVEMENT_UPPER4   achievementSize = 'U'
+	ACHIEVEMENT_BITCOUNT achievementSize = 'K'
+	// 'M' to 'T' are the bits 0 to 7 of a byte
+)
+
+// Where RetroAchievements maps the scratchpad, after the 2MB of RAM
+const ACHIEVEMENT_SCRATCHPAD_ADDR = 0x200000
+
+// A value of a condition: a constant or a memory read
+type achievementOperand struct {
+	memory bool
+	// Which value of the memory is used: 0 for the current one, 'd' for the
+	// previous frame (delta), 'p' for the last different one (prior), 'b'
+	// decodes BCD and '~' inverts the bits
+	prefix byte
+	size   achievementSize
+	addr   uint32
+	value  uint32 // Constant value
+
+	// values of the memory, updated once per frame
+	current, previous, prior uint32
+	read                     bool // Set after the first read
+}
+
+// A condition of a trigger, "flag:left op right.hits."
+type achievementCondition struct {
+	flag        byte // 0 or a letter (R for ResetIf, P for PauseIf...)
+	left, right achievementOperand
+	op          string // Empty if the condition is only the left operand
+	target      uint32 // Required hits, 0 if there's no target
+	hits        uint32
+
+	left32, right32 uint32 // Values of the operands in this frame
+}
+
+// Returns true for the flags that combine a condition with the next one
+func (cond *achievementCondition) modifier() bool {
+	switch cond.flag {
+	case 'A', 'B', 'C', 'D', 'I', 'N', 'O', 'Z':
+		return true
+	}
+	return false
+}
+
+// A trigger of a RetroAchievements achievement, parsed from its MemAddr
+// string. The conditions are separated with '_', the core group is
+// followed by alternative groups separated with 'S'. The trigger is true
+// when the core group and one of the alternatives are
+type AchievementTrigger struct {
+	groups [][]*achievementCondition // The core group, then the alternatives
+}
+
+// Parses a trigger, e.g. "0xH0010a4=5_d0xH0010a4=4" (the 8 bit value at
+// 0x10a4 is 5 and was 4 in the previous frame)
+func ParseAchievementTrigger(s string) (*AchievementTrigger, error) {
+	trigger := &AchievementTrigger{}
+	for _, group := range strings.Split(s, "S") {
+		var conds []*achievementCondition
+		if group != "" {
+			for _, text := range strings.Split(group, "_") {
+				cond, err := parseAchievementCondition(text)
+				if err != nil {
+					return nil, fmt.Errorf("trigger: %w in \"%s\"", err, text)
+				}
+				conds = append(conds, cond)
+			}
+		}
+		trigger.groups = append(trigger.groups, conds)
+	}
+	return trigger, nil
+}
+
+// Operators of the conditions, the longest ones first
+var achievementOperators = []string{"!=", "<=", ">=", "==", "=", "<", ">", "*", "/", "&", "^", "%", "+", "-"}
+
+func parseAchievementCondition(s string) (*achievementCondition, error) {
+	cond := &achievementCondition{}
+	if len(s) > 2 && s[1] == ':' {
+		cond.flag = s[0] &^ 0x20 // upper case
+		switch cond.flag {
+		case 'R', 'P', 'A', 'B', 'C', 'D', 'I', 'N', 'O', 'Z', 'M', 'Q', 'T':
+		default:
+			return nil, fmt.Errorf("unknown flag '%c'", s[0])
+		}
+		s = s[2:]
+	}
+
+	var err error
+	if cond.left, s, err = parseAchievementOperand(s); err != nil {
+		return nil, err
+	}
+	for _, op := range achievementOperators {
+		if strings.HasPrefix(s, op) {
+			cond.op = op
+			if cond.right, s, err = parseAchievementOperand(s[len(op):]); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	// hit target, ".10." or the old "(10)"
+	if len(s) > 2 && (s[0] == '.' && s[len(s)-1] == '.' || s[0] == '(' && s[len(s)-1] == ')') {
+		target, err := strconv.ParseUint(s[1:len(s)-1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hit target \"%s\"", s)
+		}
+		cond.target = uint32(target)
+		s = ""
+	}
+	if s != "" {
+		return nil, fmt.Errorf("unexpected \"%s\"", s)
+	}
+	return cond, nil
+}
+
+// Parses the operand at the start of `s`, returns the rest of `s`
+func parseAchievementOperand(s string) (achievementOperand, string, error) {
+	var operand achievementOperand
+	if s == "" {
+		return operand, s, fmt.Errorf("missing operand")
+	}
+	switch s[0] {
+	case 'd', 'D', 'p', 'P', 'b', 'B':
+		operand.prefix = s[0] | 0x20 // lower case
+		s = s[1:]
+	case '~':
+		operand.prefix = '~'
+		s = s[1:]
+	}
+
+	switch {
+	case len(s) > 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X'):
+		operand.memory = true
+		operand.size = ACHIEVEMENT_16BIT
+		s = s[2:]
+		if s[0] == ' ' {
+			s = s[1:]
+		} else if size := achievementSize(s[0] &^ 0x20); strings.IndexByte("HWXIJGLUK", byte(size)) >= 0 ||
+			size >= 'M' && size <= 'T' {
+			operand.size = size
+			s = s[1:]
+		}
+		digits := hexPrefixLen(s)
+		addr, err := strconv.ParseUint(s[:digits], 16, 32)
+		if err != nil {
+			return operand, s, fmt.Errorf("invalid address \"%s\"", s)
+		}
+		operand.addr = uint32(addr)
+		return operand, s[digits:], nil
+	case operand.prefix != 0:
+		return operand, s, fmt.Errorf("'%c' needs a memory operand", operand.prefix)
+	case s[0] == 'h' || s[0] == 'H':
+		digits := hexPrefixLen(s[1:])
+		value, err := strconv.ParseUint(s[1:1+digits], 16, 32)
+		if err != nil {
+			return operand, s, fmt.Errorf("invalid hex value \"%s\"", s)
+		}
+		operand.value = uint32(value)
+		return operand, s[1+digits:], nil
+	case s[0] == 'f' || s[0] == 'F':
+		return operand, s, fmt.Errorf("float values aren't supported")
+	}
+
+	if s[0] == 'v' || s[0] == 'V' {
+		s = s[1:]
+	}
+	digits := 0
+	if digits < len(s) && (s[0] == '-' || s[0] == '+') {
+		digits++
+	}
+	for digits < len(s) && s[digits] >= '0' && s[digits] <= '9' {
+		digits++
+	}
+	value, err := strconv.ParseInt(s[:digits], 10, 64)
+	if err != nil {
+		return operand, s, fmt.Errorf("invalid value \"%s\"", s)
+	}
+	operand.value = uint32(value)
+	return operand, s[digits:], nil
+}
+
+// Returns the amount of hex digits at the start of `s`
+func hexPrefixLen(s string) int {
+	n := 0
+	for n < len(s) && strings.IndexByte("0123456789abcdefABCDEF", s[n]) >= 0 {
+		n++
+	}
+	return n
+}
+
+// Reads a byte of the RetroAchievements address space: RAM, then the
+// scratchpad. Other addresses read 0
+type achievementMemory func(addr uint32) byte
+
+// Reads the value of the operand at `offset` (from AddAddress) and updates
+// the previous and prior values
+func (operand *achievementOperand) fetch(mem achievementMemory, offset uint32) uint32 {
+	if !operand.memory {
+		return operand.value
+	}
+	raw := operand.load(mem, operand.addr+offset)
+	if !operand.read {
+		operand.current, operand.previous, operand.prior = raw, raw, raw
+		operand.read = true
+	} else {
+		operand.previous = operand.current
+		if raw != operand.current {
+			operand.prior = operand.current
+		}
+		operand.current = raw
+	}
+
+	switch operand.prefix {
+	case 'd':
+		return operand.previous
+	case 'p':
+		return operand.prior
+	case 'b':
+		var value, scale uint32 = 0, 1
+		for v := raw; v != 0; v >>= 4 {
+			value += (v & 0xf) * scale
+			scale *= 10
+		}
+		return value
+	case '~':
+		return ^raw & operand.mask()
+	}
+	return raw
+}
+
+// Returns the largest value of the operand
+func (operand *achievementOperand) mask() uint32 {
+	switch operand.size {
+	case ACHIEVEMENT_8BIT:
+		return 0xff
+	case ACHIEVEMENT_16BIT, ACHIEVEMENT_16BIT_BE:
+		return 0xffff
+	case ACHIEVEMENT_24BIT, ACHIEVEMENT_24BIT_BE:
+		return 0xffffff
+	case ACHIEVEMENT_32BIT, ACHIEVEMENT_32BIT_BE:
+		return 0xffffffff
+	case ACHIEVEMENT_LOWER4, ACHIEVEMENT_UPPER4:
+		return 0xf
+	case ACHIEVEMENT_BITCOUNT:
+		return 8
+	}
+	return 1
+}
+
+// Reads a value of the size of the operand
+func (operand *achievementOperand) load(mem achievementMemory, addr uint32) uint32 {
+	le := func(n uint32) uint32 {
+		var value uint32
+		for i := uint32(0); i < n; i++ {
+			value |= uint32(mem(addr+i)) << (8 * i)
+		}
+		return value
+	}
+	be := func(n uint32) uint32 {
+		var value uint32
+		for i := uint32(0); i < n; i++ {
+			value = value<<8 | uint32(mem(addr+i))
+		}
+		return value
+	}
+
+	switch size := operand.size; size {
+	case ACHIEVEMENT_8BIT:
+		return le(1)
+	case ACHIEVEMENT_16BIT:
+		return le(2)
+	case ACHIEVEMENT_24BIT:
+		return le(3)
+	case ACHIEVEMENT_32BIT:
+		return le(4)
+	case ACHIEVEMENT_16BIT_BE:
+		return be(2)
+	case ACHIEVEMENT_24BIT_BE:
+		return be(3)
+	case ACHIEVEMENT_32BIT_BE:
+		return be(4)
+	case ACHIEVEMENT_LOWER4:
+		return le(1) & 0xf
+	case ACHIEVEMENT_UPPER4:
+		return le(1) >> 4
+	case ACHIEVEMENT_BITCOUNT:
+		return uint32(bits.OnesCount8(mem(addr)))
+	default: // bits
+		return le(1) >> (size - 'M') & 1
+	}
+}
+
+// Applies the operator of an AddSource, SubSource or AddAddress condition
+func (cond *achievementCondition) modified() uint32 {
+	left, right := cond.left32, cond.right32
+	switch cond.op {
+	case "*":
+		return left * right
+	case "/":
+		if right == 0 {
+			return 0
+		}
+		return left / right
+	case "%":
+		if right == 0 {
+			return 0
+		}
+		return left % right
+	case "&":
+		return left & right
+	case "^":
+		return left ^ right
+	case "+":
+		return left + right
+	case "-":
+		return left - right
+	}
+	return left
+}
+
+// Compares `left` with the right operand
+func (cond *achievementCondition) compare(left uint32) bool {
+	right := cond.right32
+	switch cond.op {
+	case "=", "==":
+		return left == right
+	case "!=":
+		return left != right
+	case "<":
+		return left < right
+	case "<=":
+		return left <= right
+	case ">":
+		return left > right
+	case ">=":
+		return left >= right
+	}
+	return left != 0
+}
+
+// Reads the operands of every condition for this frame. Doing it before
+// the conditions are tested keeps the delta values right in the groups
+// that are paused
+func (trigger *AchievementTrigger) update(mem achievementMemory) {
+	for _, group := range trigger.groups {
+		var offset uint32
+		for _, cond := range group {
+			cond.left32 = cond.left.fetch(mem, offset)
+			cond.right32 = cond.right.fetch(mem, offset)
+			if cond.flag == 'I' {
+				offset = cond.modified()
+			} else {
+				offset = 0
+			}
+		}
+	}
+}
+
+// Tests a chain of conditions: the modifiers (AddSource, AndNext...) and
+// the condition they apply to, which is last. Returns its result
+func testAchievementChain(chain []*achievementCondition) bool {
+	var source, extraHits uint32
+	var combine byte // 'N' or 'O' if the previous condition was AndNext or OrNext
+	var previous, resetNext bool
+	for _, cond := range chain {
+		switch cond.flag {
+		case 'A':
+			source += cond.modified()
+			continue
+		case 'B':
+			source -= cond.modified()
+			continue
+		case 'I':
+			continue
+		}
+
+		result := cond.compare(source + cond.left32)
+		source = 0
+		switch combine {
+		case 'N':
+			result = result && previous
+		case 'O':
+			result = result || previous
+		}
+		combine = 0
+		if resetNext {
+			cond.hits = 0
+			resetNext = false
+		}
+		if result && (cond.target == 0 || cond.hits < cond.target) {
+			cond.hits++
+		}
+
+		switch cond.flag {
+		case 'C':
+			extraHits += cond.hits
+			continue
+		case 'D':
+			extraHits -= cond.hits
+			continue
+		case 'Z':
+			resetNext = result
+			continue
+		}
+		if cond.target != 0 {
+			result = cond.hits+extraHits >= cond.target
+		}
+		if cond.flag == 'N' || cond.flag == 'O' {
+			combine, previous = cond.flag, result
+			continue
+		}
+		return result
+	}
+	return false
+}
+
+// Splits a group into chains, see testAchievementChain
+func achievementChains(group []*achievementCondition) [][]*achievementCondition {
+	var chains [][]*achievementCondition
+	start := 0
+	for i, cond := range group {
+		if !cond.modifier() || i == len(group)-1 {
+			chains = append(chains, group[start:i+1])
+			start = i + 1
+		}
+	}
+	return chains
+}
+
+// Tests a group of conditions. Returns true if it's true, and if one of
+// its ResetIf conditions is
+func testAchievementGroup(group []*achievementCondition) (bool, bool) {
+	chains := achievementChains(group)
+	// a PauseIf stops the other conditions, even the ResetIfs
+	for _, chain := range chains {
+		if chain[len(chain)-1].flag == 'P' && testAchievementChain(chain) {
+			return false, false
+		}
+	}
+
+	ok, reset := true, false
+	for _, chain := range chains {
+		switch chain[len(chain)-1].flag {
+		case 'P':
+		case 'R':
+			if testAchievementChain(chain) {
+				reset = true
+			}
+		default:
+			if !testAchievementChain(chain) {
+				ok = false
+			}
+		}
+	}
+	return ok && !reset, reset
+}
+
+// Tests the trigger against the memory of this frame
+func (trigger *AchievementTrigger) test(mem achievementMemory) bool {
+	trigger.update(mem)
+	core, reset := testAchievementGroup(trigger.groups[0])
+	alt := len(trigger.groups) == 1
+	for _, group := range trigger.groups[1:] {
+		ok, groupReset := testAchievementGroup(group)
+		alt = alt || ok
+		reset = reset || groupReset
+	}
+	if reset {
+		trigger.Reset()
+		return false
+	}
+	return core && alt
+}
+
+// Clears the hit counts of the conditions
+func (trigger *AchievementTrigger) Reset() {
+	for _, group := range trigger.groups {
+		for _, cond := range group {
+			cond.hits = 0
+		}
+	}
+}
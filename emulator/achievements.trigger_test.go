@@ -0,0 +1,131 @@
+package emulator
+
+import "testing"
+
+// Tests a trigger against a sequence of frames. Each frame writes bytes to
+// memory, then tests the trigger and compares the result
+type triggerFrame struct {
+	writes map[uint32]byte
+	want   bool
+}
+
+func testTrigger(t *testing.T, s string, frames []triggerFrame) {
+	t.Helper()
+	trigger, err := ParseAchievementTrigger(s)
+	if err != nil {
+		t.Fatalf("%s: %v", s, err)
+	}
+	memory := make([]byte, 0x100)
+	mem := func(addr uint32) byte {
+		if addr < uint32(len(memory)) {
+			return memory[addr]
+		}
+		return 0
+	}
+	for i, frame := range frames {
+		for addr, value := range frame.writes {
+			memory[addr] = value
+		}
+		if got := trigger.test(mem); got != frame.want {
+			t.Errorf("%s: frame %d: expected %v, got %v", s, i, frame.want, got)
+		}
+	}
+}
+
+func TestAchievementTrigger(t *testing.T) {
+	// 8 bit compare and delta: the value went from 4 to 5
+	testTrigger(t, "0xH0010=5_d0xH0010=4", []triggerFrame{
+		{map[uint32]byte{0x10: 4}, false},
+		{map[uint32]byte{0x10: 5}, true},
+		{nil, false},
+	})
+	// 16 bit, 32 bit and big endian values
+	testTrigger(t, "0x 0010=h1234_0xX0010=305419896_0xI0010=h3412", []triggerFrame{
+		{map[uint32]byte{0x10: 0x34, 0x11: 0x12, 0x12: 0, 0x13: 0}, false},
+		{map[uint32]byte{0x12: 0x56, 0x13: 0x34}, false},
+		{map[uint32]byte{0x12: 0x34, 0x13: 0x12}, false},
+	})
+	testTrigger(t, "0x0010=h1234_0xX0010=h56781234_0xI0010=h3412", []triggerFrame{
+		{map[uint32]byte{0x10: 0x34, 0x11: 0x12, 0x12: 0x78, 0x13: 0x56}, true},
+	})
+	// bits, nibbles, bit count, BCD and inverted values
+	testTrigger(t, "0xP0010=1_0xL0010=h9_0xU0010=h2_0xK0010=3_b0xH0011=42_~0xH0012=h0f", []triggerFrame{
+		{map[uint32]byte{0x10: 0x29, 0x11: 0x42, 0x12: 0xf0}, true},
+		{map[uint32]byte{0x10: 0x2b}, false},
+	})
+	// hit target: true for 3 frames, then stays true
+	testTrigger(t, "0xH0010=1.3.", []triggerFrame{
+		{map[uint32]byte{0x10: 1}, false},
+		{nil, false},
+		{nil, true},
+		{map[uint32]byte{0x10: 0}, true},
+	})
+	// ResetIf clears the hits
+	testTrigger(t, "0xH0010=1.2._R:0xH0011=1", []triggerFrame{
+		{map[uint32]byte{0x10: 1}, false},
+		{map[uint32]byte{0x11: 1}, false},
+		{map[uint32]byte{0x11: 0}, false},
+		{nil, true},
+	})
+	// PauseIf stops the group and its ResetIf
+	testTrigger(t, "0xH0010=1.2._R:0xH0011=1_P:0xH0012=1", []triggerFrame{
+		{map[uint32]byte{0x10: 1}, false},
+		{map[uint32]byte{0x11: 1, 0x12: 1}, false},
+		{map[uint32]byte{0x11: 0, 0x12: 0}, true},
+	})
+	// AddSource and SubSource
+	testTrigger(t, "A:0xH0010_B:0xH0011_0xH0012=5", []triggerFrame{
+		{map[uint32]byte{0x10: 7, 0x11: 3, 0x12: 1}, true},
+		{map[uint32]byte{0x12: 2}, false},
+	})
+	// AddSource with a modifier
+	testTrigger(t, "A:0xH0010*2_0xH0011=10", []triggerFrame{
+		{map[uint32]byte{0x10: 4, 0x11: 2}, true},
+	})
+	// AddAddress: a pointer at 0x10
+	testTrigger(t, "I:0xH0010_0xH0002=7", []triggerFrame{
+		{map[uint32]byte{0x10: 0x20, 0x22: 7}, true},
+		{map[uint32]byte{0x10: 0x30}, false},
+		{map[uint32]byte{0x32: 7}, true},
+	})
+	// AndNext and OrNext
+	testTrigger(t, "N:0xH0010=1_0xH0011=1", []triggerFrame{
+		{map[uint32]byte{0x10: 1}, false},
+		{map[uint32]byte{0x11: 1}, true},
+	})
+	testTrigger(t, "O:0xH0010=1_0xH0011=1", []triggerFrame{
+		{map[uint32]byte{0x10: 1}, true},
+		{map[uint32]byte{0x10: 0}, false},
+	})
+	// AddHits: 2 hits from either condition
+	testTrigger(t, "C:0xH0010=1_0xH0011=1.2.", []triggerFrame{
+		{map[uint32]byte{0x10: 1}, false},
+		{map[uint32]byte{0x10: 0, 0x11: 1}, true},
+	})
+	// alternative groups
+	testTrigger(t, "0xH0010=1S0xH0011=1S0xH0012=1", []triggerFrame{
+		{map[uint32]byte{0x10: 1}, false},
+		{map[uint32]byte{0x12: 1}, true},
+		{map[uint32]byte{0x10: 0}, false},
+	})
+	// a ResetIf of an alternative resets the core group too
+	testTrigger(t, "0xH0010=1.2.SR:0xH0011=1", []triggerFrame{
+		{map[uint32]byte{0x10: 1}, false},
+		{map[uint32]byte{0x11: 1}, false},
+		{map[uint32]byte{0x11: 0}, false},
+		{nil, true},
+	})
+}
+
+func TestParseAchievementTrigger(t *testing.T) {
+	for _, s := range []string{"", "0xH0010=v-1", "p0xH10>=d0xH10", "0xH0010=1(5)"} {
+		if _, err := ParseAchievementTrigger(s); err != nil {
+			t.Errorf("%s: %v", s, err)
+		}
+	}
+	for _, s := range []string{"X:0xH0010=1", "0xH0010=f1.5", "d5=1", "0xH0010=1.x.", "0xH0010=1_", "0xHzz=1"} {
+		if _, err := ParseAchievementTrigger(s); err == nil {
+			t.Errorf("%s: expected an error", s)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package emulator
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAchievementEngine(t *testing.T) {
+	ram, scratchPad := NewRAM(), NewScratchPad()
+	trigger, err := ParseAchievementTrigger("0xH0010=1_0xH200004=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := NewAchievementEngine()
+	achievement := &Achievement{ID: 1, Title: "test", Trigger: trigger}
+	engine.Add(achievement)
+	var unlocked []*Achievement
+	engine.OnUnlock = func(a *Achievement) {
+		unlocked = append(unlocked, a)
+	}
+
+	// true as soon as it's loaded, it has to be false first
+	ram.Data[0x10] = 1
+	scratchPad.Data[4] = 2
+	engine.Frame(ram, scratchPad)
+	if len(unlocked) != 0 {
+		t.Fatal("the achievement unlocked before its trigger was false")
+	}
+	ram.Data[0x10] = 0
+	engine.Frame(ram, scratchPad)
+	ram.Data[0x10] = 1
+	engine.Frame(ram, scratchPad)
+	if len(unlocked) != 1 || unlocked[0] != achievement || !achievement.Unlocked {
+		t.Fatalf("expected the achievement to unlock, got %v", unlocked)
+	}
+	engine.Frame(ram, scratchPad)
+	if len(unlocked) != 1 {
+		t.Error("the achievement unlocked twice")
+	}
+
+	var off *AchievementEngine
+	off.Frame(ram, scratchPad)
+	off.Reset()
+}
+
+func TestDiscAchievementHash(t *testing.T) {
+	// the text size is past the end of the file, the whole file is hashed
+	exe := make([]byte, ISO_BLOCK_SIZE)
+	copy(exe, "PS-X EXE")
+	binary.LittleEndian.PutUint32(exe[0x1c:], 0x100)
+	exe[0x7ff] = 0xaa
+	cnf := "BOOT = cdrom:\\SLUS_005.94;1\r\n"
+	image := newTestIsoImage(map[string]string{"SYSTEM.CNF": cnf})
+	disc, err := NewDisc(bytes.NewReader(image))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disc.Close()
+	if _, err := disc.AchievementHash(); err == nil {
+		t.Error("expected an error without the boot executable")
+	}
+
+	image = newTestIsoImage(map[string]string{"SYSTEM.CNF": cnf, "SLUS_005.94": string(exe)})
+	disc, err = NewDisc(bytes.NewReader(image))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disc.Close()
+	hash, err := disc.AchievementHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := md5.Sum(append([]byte("SLUS_005.94"), exe...))
+	if want := hex.EncodeToString(sum[:]); hash != want {
+		t.Errorf("expected hash %s, got %s", want, hash)
+	}
+}
+
+func TestAchievementClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("expected a POST request, got %s", r.Method)
+		}
+		switch r.FormValue("r") {
+		case "login":
+			if r.FormValue("p") != "secret" {
+				fmt.Fprint(w, `{"Success":false,"Error":"Invalid password"}`)
+				return
+			}
+			fmt.Fprint(w, `{"Success":true,"Token":"token"}`)
+		case "gameid":
+			fmt.Fprint(w, `{"Success":true,"GameID":42}`)
+		case "patch":
+			fmt.Fprint(w, `{"Success":true,"PatchData":{"ID":42,"Title":"Game","Achievements":[
+				{"ID":1,"MemAddr":"0xH0010=1","Title":"First","Points":5,"Flags":3},
+				{"ID":2,"MemAddr":"0xH0011=1","Title":"Second","Points":10,"Flags":3},
+				{"ID":3,"MemAddr":"0xH0012=1","Title":"Unofficial","Points":1,"Flags":5}]}}`)
+		case "unlocks":
+			fmt.Fprint(w, `{"Success":true,"UserUnlocks":[2]}`)
+		case "awardachievement":
+			sum := md5.Sum([]byte("1user0"))
+			if r.FormValue("t") != "token" || r.FormValue("v") != hex.EncodeToString(sum[:]) {
+				t.Errorf("invalid award request %v", r.Form)
+			}
+			fmt.Fprint(w, `{"Success":true}`)
+		default:
+			t.Errorf("unexpected request %s", r.FormValue("r"))
+		}
+	}))
+	defer server.Close()
+
+	client := NewAchievementClient("user")
+	client.URL = server.URL
+	if err := client.Login("wrong"); err == nil {
+		t.Error("expected an error with a wrong password")
+	}
+	if err := client.Login("secret"); err != nil || client.Token != "token" {
+		t.Fatalf("login failed: %v", err)
+	}
+	id, err := client.GameID("hash")
+	if err != nil || id != 42 {
+		t.Fatalf("expected game 42, got %d (%v)", id, err)
+	}
+	game, err := client.Game(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game.Title != "Game" || len(game.Achievements) != 2 {
+		t.Fatalf("expected 2 official achievements, got %+v", game)
+	}
+	if game.Achievements[0].Unlocked || !game.Achievements[1].Unlocked {
+		t.Error("expected only the second achievement to be unlocked")
+	}
+	if err := client.Award(1); err != nil {
+		t.Error(err)
+	}
+}
+
+// The run-ahead frames are rolled back, so they don't test the triggers
+// and restoring them keeps the hit counts
+func TestAchievementsRunAhead(t *testing.T) {
+	inter := newBenchInterconnect()
+	console := NewConsole(NewCPU(inter))
+	// nothing was scheduled yet, sync every peripheral at the first step
+	console.Cpu.Th.UpdatePendingSync()
+	trigger, err := ParseAchievementTrigger("0xH0010=1.3.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	achievement := &Achievement{ID: 1, Title: "three frames", Trigger: trigger}
+	inter.Achievements = NewAchievementEngine()
+	inter.Achievements.Add(achievement)
+	var unlocks int
+	inter.Achievements.OnUnlock = func(*Achievement) {
+		unlocks++
+	}
+
+	// primed by a frame where the trigger is false
+	console.runFrame(false)
+	inter.Ram.Data[0x10] = 1
+
+	console.runAhead = RUNAHEAD_MAX_FRAMES
+	for frame := 1; frame <= 3; frame++ {
+		console.runFramesAhead()
+		if console.runAhead == 0 {
+			t.Fatal("run-ahead turned itself off")
+		}
+		if frame < 3 && achievement.Unlocked {
+			t.Fatalf("the achievement unlocked after %d frames, the frames ahead counted", frame)
+		}
+	}
+	if !achievement.Unlocked || unlocks != 1 {
+		t.Errorf("expected the achievement to unlock once after 3 frames, got %d unlocks", unlocks)
+	}
+
+	// loading a savestate starts the triggers over
+	var buf bytes.Buffer
+	if err := WriteSaveState(&buf, console.Cpu); err != nil {
+		t.Fatal(err)
+	}
+	achievement.Unlocked = false
+	if _, err := ReadSaveState(&buf, console.Cpu); err != nil {
+		t.Fatal(err)
+	}
+	console.runFrame(false)
+	if achievement.Unlocked {
+		t.Error("expected the achievement to be primed again after loading a savestate")
+	}
+}
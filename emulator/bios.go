@@ -16,12 +16,25 @@ type BIOS struct {
 // bytes in size
 func LoadBIOS(r io.Reader) (*BIOS, error) {
 	data := make([]byte, BIOS_SIZE)
-	n, err := r.Read(data)
+	n, err := io.ReadFull(r, data)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf(
+			"%w (expected %d, got %d (bytes))",
+			ErrInvalidBIOSSize, BIOS_SIZE, n,
+		)
+	}
 	if err != nil {
 		return nil, err
 	}
-	if n != int(BIOS_SIZE) {
-		return nil, fmt.Errorf("invalid BIOS size (expected %d, got %d (bytes))", BIOS_SIZE, n)
+	// the image must end here
+	var extra [1]byte
+	if n, err := io.ReadFull(r, extra[:]); n != 0 {
+		return nil, fmt.Errorf(
+			"%w (expected %d, got more (bytes))",
+			ErrInvalidBIOSSize, BIOS_SIZE,
+		)
+	} else if err != nil && err != io.EOF {
+		return nil, err
 	}
 	// success
 	return &BIOS{Data: data}, nil
@@ -31,8 +44,8 @@ func LoadBIOS(r io.Reader) (*BIOS, error) {
 func LoadBIOSFromData(data []byte) (*BIOS, error) {
 	if len(data) != int(BIOS_SIZE) {
 		return nil, fmt.Errorf(
-			"invalid BIOS size (expected %d, got %d (bytes))",
-			BIOS_SIZE, len(data),
+			"%w (expected %d, got %d (bytes))",
+			ErrInvalidBIOSSize, BIOS_SIZE, len(data),
 		)
 	}
 	// success
@@ -50,18 +63,24 @@ func (bios *BIOS) Load32(offset uint32) uint32 {
 	return b0 | (b1 << 8) | (b2 << 16) | (b3 << 24)
 }
 
+// Returns a 16 bit little endian value at `offset`
+func (bios *BIOS) Load16(offset uint32) uint16 {
+	return uint16(bios.Data[offset]) | uint16(bios.Data[offset+1])<<8
+}
+
 // Fetch byte at `offset`
 func (bios *BIOS) Load8(offset uint32) byte {
 	return bios.Data[offset]
 }
 
 // Loads a value at `offset`
-func (bios *BIOS) Load(offset uint32, size AccessSize) interface{} {
-	var v uint32 = 0
-	sizeI := uint32(size)
-
-	for i := uint32(0); i < sizeI; i++ {
-		v |= uint32(bios.Data[offset+i]) << (i * 8)
+func (bios *BIOS) Load(offset uint32, size AccessSize) uint32 {
+	switch size {
+	case ACCESS_BYTE:
+		return uint32(bios.Load8(offset))
+	case ACCESS_HALFWORD:
+		return uint32(bios.Load16(offset))
+	default:
+		return bios.Load32(offset)
 	}
-	return accessSizeU32(size, v)
 }
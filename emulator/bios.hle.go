@@ -0,0 +1,227 @@
+package emulator
+
+import (
+	"fmt"
+	"hash/crc32"
+	"strings"
+)
+
+// Offset of the shell (logo animation, memory card manager and CD player)
+// in the BIOS image. The bootstrap copies it to 0x80030000 and calls it
+// before booting the disc
+const BIOS_SHELL_OFFSET uint32 = 0x18000
+
+// Makes the shell entry point return to the bootstrap right away, so the
+// BIOS skips the intro and boots the disc. Without a disc, the BIOS will
+// just show a black screen
+var biosSkipShell = []BiosPatch{{Offset: BIOS_SHELL_OFFSET, Words: []uint32{
+	0x3c011f80, // lui at, 0x1f80
+	0x3c0a0300, // lui t2, 0x0300
+	0xac2a1814, // sw t2, 0x1814(at) (GP1(0x03): enable the display)
+	0x03e00008, // jr ra
+	0x00000000, // nop
+}}}
+
+// Patches that skip the intro, by the CRC32 of the BIOS (see KNOWN_BIOSES).
+// Only these images are known to have the shell at BIOS_SHELL_OFFSET
+var BIOS_FAST_BOOT_PATCHES = map[uint32][]BiosPatch{
+	0x37157331: biosSkipShell, // SCPH-1001
+	0xff3eeb8c: biosSkipShell, // SCPH-5500
+	0x8d8cb7e4: biosSkipShell, // SCPH-5501
+	0xd786f0b9: biosSkipShell, // SCPH-5502
+	0x502224b6: biosSkipShell, // SCPH-7001
+	0x318178bf: biosSkipShell, // SCPH-7502
+	0x171bdcec: biosSkipShell, // SCPH-101
+}
+
+// Skips the intro, see BIOS_FAST_BOOT_PATCHES. Returns
+// ErrUnsupportedBiosPatch if the image isn't known, it's left unchanged
+func (bios *BIOS) PatchFastBoot() error {
+	checksum := crc32.ChecksumIEEE(bios.Data)
+	patches, ok := BIOS_FAST_BOOT_PATCHES[checksum]
+	if !ok {
+		return fmt.Errorf("%w: fast boot (checksum 0x%08x)", ErrUnsupportedBiosPatch, checksum)
+	}
+	for _, patch := range patches {
+		bios.Patch(patch)
+	}
+	return nil
+}
+
+// BIOS function tables
+const (
+	BIOS_TABLE_A uint32 = 0xa0
+	BIOS_TABLE_B uint32 = 0xb0
+	BIOS_TABLE_C uint32 = 0xc0
+)
+
+// High-level emulation of common BIOS functions. Calls to them return
+// right away instead of running the BIOS code
+type BiosHle struct {
+	// Set to run programs without a BIOS (see RunTestRom): printf and puts
+	// print to CPU.Tty, exit stops the program and the functions that
+	// aren't emulated return 0
+	Standalone bool
+	Exited     bool   // Set when the program calls exit in standalone mode
+	ExitCode   uint32 // Argument of exit
+}
+
+// Returns a new BIOS HLE instance. Characters printed with putchar are
+// discarded, use CPU.Tty to capture them
+func NewBiosHle() *BiosHle {
+	return &BiosHle{}
+}
+
+// Runs the BIOS function if the CPU is about to enter a function table and
+// the function is emulated. Returns false if the BIOS code should run
+func (hle *BiosHle) Call(cpu *CPU) bool {
+	table := cpu.PC & 0x1fffffff
+	if table != BIOS_TABLE_A && table != BIOS_TABLE_B && !(hle.Standalone && table == BIOS_TABLE_C) {
+		return false
+	}
+
+	// the pending load has to land before the arguments are read
+	cpu.commitLoad()
+	copy(cpu.Regs[:], cpu.OutRegs[:])
+
+	function := cpu.Reg(9) // t1
+	a0, a1, a2 := cpu.Reg(4), cpu.Reg(5), cpu.Reg(6)
+
+	var v0 uint32
+	switch {
+	case table == BIOS_TABLE_A && function == 0x2a: // memcpy(dst, src, len)
+		v0 = hle.memcpy(cpu, a0, a1, a2)
+	case table == BIOS_TABLE_A && function == 0x2b: // memset(dst, fillbyte, len)
+		v0 = hle.memset(cpu, a0, uint8(a1), a2)
+	case table == BIOS_TABLE_A && function == 0x3c, // putchar(char)
+		table == BIOS_TABLE_B && function == 0x3d:
+		v0 = a0
+	case !hle.Standalone:
+		return false
+	case table == BIOS_TABLE_A && function == 0x06, // exit(code)
+		table == BIOS_TABLE_B && function == 0x38:
+		hle.Exited = true
+		hle.ExitCode = a0
+	case table == BIOS_TABLE_A && function == 0x3e, // puts(s)
+		table == BIOS_TABLE_B && function == 0x3f:
+		hle.print(cpu, hle.readString(cpu, a0))
+	case table == BIOS_TABLE_A && function == 0x3f: // printf(format, ...)
+		s := hle.printf(cpu, hle.readString(cpu, a0))
+		hle.print(cpu, s)
+		v0 = uint32(len(s))
+	}
+
+	cpu.SetReg(2, v0)
+	copy(cpu.Regs[:], cpu.OutRegs[:])
+
+	// return to the caller
+	cpu.PC = cpu.Reg(31)
+	cpu.NextPC = cpu.PC + 4
+	cpu.BranchOccured = false
+	cpu.BranchTaken = false
+	cpu.Th.Tick(1)
+	return true
+}
+
+// Longest string read by readString
+const BIOS_HLE_MAX_STRING = 4096
+
+// Returns the null-terminated string at `addr`
+func (hle *BiosHle) readString(cpu *CPU, addr uint32) string {
+	var buf []byte
+	for len(buf) < BIOS_HLE_MAX_STRING {
+		c := cpu.Inter.Load8(addr+uint32(len(buf)), cpu.Th)
+		if c == 0 {
+			break
+		}
+		buf = append(buf, c)
+	}
+	return string(buf)
+}
+
+// Sends `s` to CPU.Tty
+func (hle *BiosHle) print(cpu *CPU, s string) {
+	if cpu.Tty == nil {
+		return
+	}
+	for i := 0; i < len(s); i++ {
+		cpu.Tty(s[i])
+	}
+}
+
+// Formats the arguments of a printf call like the BIOS does: %d %i %u %x
+// %X %o %p %c %s and %%, with the 0 and - flags and a width. The arguments
+// after `format` are in a1-a3, then on the stack
+func (hle *BiosHle) printf(cpu *CPU, format string) string {
+	arg := 0
+	next := func() uint32 {
+		arg++
+		if arg <= 3 {
+			return cpu.Reg(4 + uint32(arg))
+		}
+		// the caller reserves the home of a0-a3 below the other arguments
+		return cpu.Inter.Load32(cpu.Reg(29)+uint32(arg)*4, cpu.Th)
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			sb.WriteByte(format[i])
+			continue
+		}
+		start := i
+		i++
+		for i < len(format) && strings.IndexByte("0-123456789lh", format[i]) >= 0 {
+			i++
+		}
+		if i == len(format) {
+			sb.WriteString(format[start:])
+			break
+		}
+		// Go has the same flags and width, without the size modifiers
+		spec := strings.NewReplacer("l", "", "h", "").Replace(format[start:i])
+		switch format[i] {
+		case 'd', 'i':
+			fmt.Fprintf(&sb, spec+"d", int32(next()))
+		case 'u':
+			fmt.Fprintf(&sb, spec+"d", next())
+		case 'x', 'X', 'o':
+			fmt.Fprintf(&sb, spec+string(format[i]), next())
+		case 'p':
+			fmt.Fprintf(&sb, spec+"x", next())
+		case 'c':
+			fmt.Fprintf(&sb, spec+"c", rune(uint8(next())))
+		case 's':
+			fmt.Fprintf(&sb, spec+"s", hle.readString(cpu, next()))
+		case '%':
+			sb.WriteByte('%')
+		default:
+			sb.WriteString(format[start : i+1])
+		}
+	}
+	return sb.String()
+}
+
+// Copies `length` bytes from `src` to `dst`. Returns `dst`, or 0 if one of
+// the pointers is null
+func (hle *BiosHle) memcpy(cpu *CPU, dst, src, length uint32) uint32 {
+	if dst == 0 || src == 0 {
+		return 0
+	}
+	for i := uint32(0); int32(i) < int32(length); i++ {
+		cpu.Inter.Store8(dst+i, cpu.Inter.Load8(src+i, cpu.Th), cpu.Th)
+	}
+	return dst
+}
+
+// Fills `length` bytes at `dst` with `fill`. Returns `dst`, or 0 if it's
+// null
+func (hle *BiosHle) memset(cpu *CPU, dst uint32, fill uint8, length uint32) uint32 {
+	if dst == 0 {
+		return 0
+	}
+	for i := uint32(0); int32(i) < int32(length); i++ {
+		cpu.Inter.Store8(dst+i, fill, cpu.Th)
+	}
+	return dst
+}
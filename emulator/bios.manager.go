@@ -0,0 +1,175 @@
+package emulator
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Offset of the "System ROM Version" string in BIOS images since v2.0
+const BIOS_VERSION_OFFSET uint32 = 0x7ff32
+
+// Known BIOS images, by the CRC32 of their data
+var KNOWN_BIOSES = map[uint32]BiosInfo{
+	0x3b601fc8: {Model: "SCPH-1000", Version: "1.0 09/22/94 J", Region: REGION_JAPAN},
+	0x37157331: {Model: "SCPH-1001", Version: "2.2 12/04/95 A", Region: REGION_NORTH_AMERICA},
+	0xff3eeb8c: {Model: "SCPH-5500", Version: "3.0 09/09/96 J", Region: REGION_JAPAN},
+	0x8d8cb7e4: {Model: "SCPH-5501", Version: "3.0 11/18/96 A", Region: REGION_NORTH_AMERICA},
+	0xd786f0b9: {Model: "SCPH-5502", Version: "3.0 01/06/97 E", Region: REGION_EUROPE},
+	0x502224b6: {Model: "SCPH-7001", Version: "4.1 12/16/97 A", Region: REGION_NORTH_AMERICA},
+	0x318178bf: {Model: "SCPH-7502", Version: "4.1 12/16/97 E", Region: REGION_EUROPE},
+	0x171bdcec: {Model: "SCPH-101", Version: "4.5 05/25/00 A", Region: REGION_NORTH_AMERICA},
+}
+
+// Description of a BIOS image
+type BiosInfo struct {
+	Model     string // Console model, empty if the image is unknown
+	Version   string // Version, date and region letter, e.g. "4.1 12/16/97 E"
+	Region    Region // Region the BIOS is made for, only valid if HasRegion is true
+	HasRegion bool
+	Checksum  uint32 // CRC32 of the image
+	Known     bool   // True if the checksum matches a known good dump
+}
+
+// Returns the model and version of the BIOS, e.g. "SCPH-7502 (4.1 12/16/97 E)"
+func (info *BiosInfo) String() string {
+	name := info.Model
+	if name == "" {
+		name = "unknown BIOS"
+	}
+	if info.Version == "" {
+		return name
+	}
+	return name + " (" + info.Version + ")"
+}
+
+// Returns the version string stored in the image, e.g. "4.1 12/16/97 E".
+// Returns an empty string if the image doesn't have one (v1.0)
+func (bios *BIOS) Version() string {
+	data := bios.Data[BIOS_VERSION_OFFSET:]
+	const prefix = "System ROM Version "
+	if !bytes.HasPrefix(data, []byte(prefix)) {
+		return ""
+	}
+	data = data[len(prefix):]
+	if end := bytes.IndexByte(data, 0); end >= 0 {
+		data = data[:end]
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// Returns the description of the BIOS. Unknown images are identified from
+// their version string
+func (bios *BIOS) Info() BiosInfo {
+	checksum := crc32.ChecksumIEEE(bios.Data)
+	if info, ok := KNOWN_BIOSES[checksum]; ok {
+		info.HasRegion = true
+		info.Checksum = checksum
+		info.Known = true
+		return info
+	}
+
+	info := BiosInfo{Version: bios.Version(), Checksum: checksum}
+	// the last letter of the version is the region
+	if n := len(info.Version); n > 0 {
+		switch info.Version[n-1] {
+		case 'J':
+			info.Region, info.HasRegion = REGION_JAPAN, true
+		case 'A':
+			info.Region, info.HasRegion = REGION_NORTH_AMERICA, true
+		case 'E':
+			info.Region, info.HasRegion = REGION_EUROPE, true
+		}
+	}
+	return info
+}
+
+// A BIOS image held by the BIOS manager
+type BiosEntry struct {
+	Bios *BIOS
+	Info BiosInfo
+	Path string // Where the image was loaded from
+}
+
+// Holds multiple BIOS images and picks the right one for a disc
+type BiosManager struct {
+	Entries []*BiosEntry
+}
+
+// Returns a new empty BIOS manager
+func NewBiosManager() *BiosManager {
+	return &BiosManager{}
+}
+
+// Adds a BIOS image, `path` is only used for display
+func (manager *BiosManager) Add(bios *BIOS, path string) *BiosEntry {
+	entry := &BiosEntry{Bios: bios, Info: bios.Info(), Path: path}
+	manager.Entries = append(manager.Entries, entry)
+	return entry
+}
+
+// Adds every BIOS image in the root directory of `fsys`. Files that aren't
+// BIOS_SIZE bytes long are skipped
+func (manager *BiosManager) LoadFS(fsys fs.FS) error {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return err
+	}
+
+	for _, dirEntry := range entries {
+		if dirEntry.IsDir() {
+			continue
+		}
+		info, err := dirEntry.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() != int64(BIOS_SIZE) {
+			continue
+		}
+
+		data, err := fs.ReadFile(fsys, dirEntry.Name())
+		if err != nil {
+			return err
+		}
+		bios, err := LoadBIOSFromData(data)
+		if err != nil {
+			return err
+		}
+		manager.Add(bios, path.Clean(dirEntry.Name()))
+	}
+	return nil
+}
+
+// Returns the best BIOS for a disc from `region`: known dumps for the region
+// come first, then unknown images for the region, newer versions first.
+// Falls back to any image if none matches. Returns nil if the manager is
+// empty
+func (manager *BiosManager) Select(region Region) *BiosEntry {
+	if len(manager.Entries) == 0 {
+		return nil
+	}
+
+	entries := append([]*BiosEntry(nil), manager.Entries...)
+	score := func(entry *BiosEntry) int {
+		s := 0
+		if entry.Info.HasRegion && entry.Info.Region == region {
+			s += 2
+		}
+		if entry.Info.Known {
+			s++
+		}
+		return s
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		si, sj := score(entries[i]), score(entries[j])
+		if si != sj {
+			return si > sj
+		}
+		return entries[i].Info.Version > entries[j].Info.Version
+	})
+	return entries[0]
+}
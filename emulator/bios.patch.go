@@ -0,0 +1,82 @@
+package emulator
+
+import (
+	"fmt"
+	"hash/crc32"
+	"strings"
+)
+
+// A list of instructions written over the BIOS image
+type BiosPatch struct {
+	Offset uint32   // Offset in the BIOS image
+	Words  []uint32 // Little endian words written at `Offset`
+}
+
+// Sets the kernel TTY flag at boot, the kernel is the same in the images
+// that use it
+var biosEnableTty = []BiosPatch{
+	{Offset: 0x6f0c, Words: []uint32{0x24010001}}, // li at, 1
+	{Offset: 0x6f14, Words: []uint32{0xaf81a9c0}}, // sw at, -0x5640(gp)
+}
+
+// Patches that make the kernel print its debug messages with putchar, by
+// the CRC32 of the BIOS (see KNOWN_BIOSES)
+var BIOS_DEBUG_PATCHES = map[uint32][]BiosPatch{
+	0x37157331: biosEnableTty, // SCPH-1001
+	0xff3eeb8c: biosEnableTty, // SCPH-5500
+	0x8d8cb7e4: biosEnableTty, // SCPH-5501
+	0xd786f0b9: biosEnableTty, // SCPH-5502
+	0x502224b6: biosEnableTty, // SCPH-7001
+	0x318178bf: biosEnableTty, // SCPH-7502
+	0x171bdcec: biosEnableTty, // SCPH-101
+}
+
+// Patches to apply with BIOS.ApplyPatches
+type BiosPatchOptions struct {
+	SkipIntro   bool // Skip the logo animation and boot the disc right away, only for known images
+	DebugOutput bool // Enable the kernel debug output, only for known images
+}
+
+// Writes the words of `patch` into the image
+func (bios *BIOS) Patch(patch BiosPatch) {
+	for i, word := range patch.Words {
+		offset := patch.Offset + uint32(i)*4
+		bios.Data[offset+0] = byte(word)
+		bios.Data[offset+1] = byte(word >> 8)
+		bios.Data[offset+2] = byte(word >> 16)
+		bios.Data[offset+3] = byte(word >> 24)
+	}
+}
+
+// Applies the patches enabled in `options`. The patch tables are looked up
+// with the checksum of the unpatched image, so this should only be called
+// once. Returns ErrUnsupportedBiosPatch if a patch is not available for this
+// image, the other patches are still applied
+func (bios *BIOS) ApplyPatches(options BiosPatchOptions) error {
+	checksum := crc32.ChecksumIEEE(bios.Data)
+	var unsupported []string
+
+	apply := func(name string, table map[uint32][]BiosPatch) {
+		patches, ok := table[checksum]
+		if !ok {
+			unsupported = append(unsupported, name)
+			return
+		}
+		for _, patch := range patches {
+			bios.Patch(patch)
+		}
+	}
+	if options.SkipIntro {
+		apply("fast boot", BIOS_FAST_BOOT_PATCHES)
+	}
+	if options.DebugOutput {
+		apply("debug output", BIOS_DEBUG_PATCHES)
+	}
+
+	if len(unsupported) > 0 {
+		return fmt.Errorf(
+			"%w: %s (checksum 0x%08x)", ErrUnsupportedBiosPatch, strings.Join(unsupported, ", "), checksum,
+		)
+	}
+	return nil
+}
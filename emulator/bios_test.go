@@ -0,0 +1,102 @@
+package emulator
+
+import (
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"testing"
+	"testing/fstest"
+)
+
+// Returns a BIOS image with `version` as its version string
+func newVersionedBios(version string) []byte {
+	data := make([]byte, BIOS_SIZE)
+	copy(data[BIOS_VERSION_OFFSET:], "System ROM Version "+version)
+	return data
+}
+
+func TestBiosManagerSelect(t *testing.T) {
+	fsys := fstest.MapFS{
+		"japan.bin":  {Data: newVersionedBios("3.0 09/09/96 J")},
+		"europe.bin": {Data: newVersionedBios("4.1 12/16/97 E")},
+		"old-us.bin": {Data: newVersionedBios("2.2 12/04/95 A")},
+		"new-us.bin": {Data: newVersionedBios("4.1 12/16/97 A")},
+		"notes.txt":  {Data: []byte("not a BIOS")},
+	}
+
+	manager := NewBiosManager()
+	if err := manager.LoadFS(fsys); err != nil {
+		t.Fatal(err)
+	}
+	if len(manager.Entries) != 4 {
+		t.Fatalf("expected 4 BIOS images, got %d", len(manager.Entries))
+	}
+
+	expected := map[Region]string{
+		REGION_JAPAN:         "japan.bin",
+		REGION_NORTH_AMERICA: "new-us.bin",
+		REGION_EUROPE:        "europe.bin",
+	}
+	for region, path := range expected {
+		if entry := manager.Select(region); entry.Path != path {
+			t.Errorf("%s: expected %s, got %s", region, path, entry.Path)
+		}
+	}
+}
+
+func TestLoadBios(t *testing.T) {
+	if _, err := LoadBIOS(bytes.NewReader(make([]byte, BIOS_SIZE))); err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []uint32{0, BIOS_SIZE - 1, BIOS_SIZE + 1, BIOS_SIZE * 2} {
+		if _, err := LoadBIOS(bytes.NewReader(make([]byte, size))); !errors.Is(err, ErrInvalidBIOSSize) {
+			t.Errorf("%d bytes: expected ErrInvalidBIOSSize, got %v", size, err)
+		}
+	}
+}
+
+func TestBiosInfo(t *testing.T) {
+	bios, _ := LoadBIOSFromData(newVersionedBios("4.1 12/16/97 E"))
+	info := bios.Info()
+	if info.Version != "4.1 12/16/97 E" || !info.HasRegion || info.Region != REGION_EUROPE || info.Known {
+		t.Errorf("unexpected info %+v", info)
+	}
+
+	bios, _ = LoadBIOSFromData(make([]byte, BIOS_SIZE))
+	if info := bios.Info(); info.HasRegion || info.Version != "" {
+		t.Errorf("unexpected info for an empty image %+v", info)
+	}
+}
+
+func TestBiosPatches(t *testing.T) {
+	bios, _ := LoadBIOSFromData(make([]byte, BIOS_SIZE))
+
+	// an unknown image isn't patched, its shell may be somewhere else
+	err := bios.ApplyPatches(BiosPatchOptions{SkipIntro: true, DebugOutput: true})
+	if !errors.Is(err, ErrUnsupportedBiosPatch) {
+		t.Errorf("expected ErrUnsupportedBiosPatch, got %v", err)
+	}
+	if bios.Load32(BIOS_SHELL_OFFSET) != 0 {
+		t.Error("the intro was skipped on an unknown image")
+	}
+	if bios.Load32(biosEnableTty[0].Offset) != 0 {
+		t.Error("the debug output patch was applied to an unknown image")
+	}
+
+	// both patches are looked up with the checksum of the unpatched image
+	checksum := crc32.ChecksumIEEE(bios.Data)
+	BIOS_FAST_BOOT_PATCHES[checksum] = biosSkipShell
+	BIOS_DEBUG_PATCHES[checksum] = biosEnableTty
+	defer delete(BIOS_FAST_BOOT_PATCHES, checksum)
+	defer delete(BIOS_DEBUG_PATCHES, checksum)
+
+	if err := bios.ApplyPatches(BiosPatchOptions{SkipIntro: true, DebugOutput: true}); err != nil {
+		t.Fatal(err)
+	}
+	if bios.Load32(BIOS_SHELL_OFFSET) != biosSkipShell[0].Words[0] {
+		t.Error("the intro wasn't skipped")
+	}
+	if bios.Load32(biosEnableTty[0].Offset) != biosEnableTty[0].Words[0] {
+		t.Error("the debug output patch wasn't applied")
+	}
+}
@@ -0,0 +1,11 @@
+package bus
+
+// Size of a memory access
+type AccessSize uint32
+
+// Types of accesses supported by the PlayStation architecture
+const (
+	ACCESS_BYTE     AccessSize = 1 // 8 bit
+	ACCESS_HALFWORD AccessSize = 2 // 16 bit
+	ACCESS_WORD     AccessSize = 4 // 32 bit
+)
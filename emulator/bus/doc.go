@@ -0,0 +1,5 @@
+// Package bus has what the peripherals of the PlayStation share: the
+// memory access sizes, the interrupt controller and the emulation time.
+// It doesn't depend on the rest of the emulator, so a peripheral that only
+// needs these (like the spu package) can be used on its own.
+package bus
@@ -0,0 +1,7 @@
+package bus
+
+import "errors"
+
+// Returned by TimeHandler.SetOverclock if the multiplier is out of range.
+// Use errors.Is to check for it
+var ErrInvalidOverclock = errors.New("invalid CPU overclock")
@@ -0,0 +1,137 @@
+package bus
+
+import "fmt"
+
+// State of the interrupt register
+type IrqState struct {
+	Status uint16 // Interrupt status
+	Mask   uint16 // Interrupt mask
+	// Amount of times each interrupt was raised, for the debug overlay
+	Counts [IRQ_COUNT]uint32
+}
+
+// Represents an interrupt state
+type Interrupt uint16
+
+const (
+	INTERRUPT_VBLANK     Interrupt = 0  // GPU is in vertical blanking
+	INTERRUPT_GPU        Interrupt = 1  // GPU interrupt request (GP0(0x1f))
+	INTERRUPT_CDROM      Interrupt = 2  // CD-ROM controller
+	INTERRUPT_DMA        Interrupt = 3  // DMA transfer complete
+	INTERRUPT_TIMER0     Interrupt = 4  // Timer 0 interrupt
+	INTERRUPT_TIMER1     Interrupt = 5  // Timer 1 interrupt
+	INTERRUPT_TIMER2     Interrupt = 6  // Timer 2 interrupt
+	INTERRUPT_PADMEMCARD Interrupt = 7  // Gamepad and memory card controllers
+	INTERRUPT_SIO        Interrupt = 8  // Second serial port (SIO1)
+	INTERRUPT_SPU        Interrupt = 9  // SPU
+	INTERRUPT_LIGHTPEN   Interrupt = 10 // Lightpen, shared with the PIO port
+)
+
+const (
+	IRQ_COUNT = 11               // Amount of interrupt lines
+	IRQ_MASK  = 1<<IRQ_COUNT - 1 // Implemented bits of I_STAT and I_MASK
+)
+
+var interruptNames = [IRQ_COUNT]string{
+	"VBLANK", "GPU", "CDROM", "DMA", "TIMER0", "TIMER1", "TIMER2",
+	"PADMEMCARD", "SIO", "SPU", "LIGHTPEN",
+}
+
+// Returns the name of the interrupt
+func (interrupt Interrupt) String() string {
+	if interrupt < IRQ_COUNT {
+		return interruptNames[interrupt]
+	}
+	return fmt.Sprintf("IRQ%d", uint16(interrupt))
+}
+
+// Latch state of an interrupt line
+type IrqLine struct {
+	Interrupt Interrupt
+	Latched   bool // True if the interrupt is set in I_STAT
+	Enabled   bool // True if the interrupt is set in I_MASK
+}
+
+// Returns true if the line would interrupt the CPU
+func (line IrqLine) Pending() bool {
+	return line.Latched && line.Enabled
+}
+
+// Returns a new interrupt instance
+func NewIrqState() *IrqState {
+	return &IrqState{}
+}
+
+// Returns true if any interrupt is active
+func (state *IrqState) Active() bool {
+	return (state.Status & state.Mask) != 0
+}
+
+// Acknowledges interrupts. The bits that are 0 in `ack` are cleared, the
+// ones that are 1 are left unchanged
+func (state *IrqState) Acknowledge(ack uint16) {
+	state.Status &= ack
+}
+
+// Sets the interrupt mask, only the implemented bits are kept
+func (state *IrqState) SetMask(mask uint16) {
+	state.Mask = mask & IRQ_MASK
+}
+
+// Latches an interrupt. Peripherals call this on the rising edge of their
+// interrupt signal, the latch stays set until it's acknowledged even if the
+// signal goes low
+func (state *IrqState) SetHigh(interrupt Interrupt) {
+	state.Status |= 1 << interrupt
+	state.Counts[interrupt]++
+}
+
+// Returns true if `interrupt` is latched in I_STAT
+func (state *IrqState) Latched(interrupt Interrupt) bool {
+	return state.Status&(1<<interrupt) != 0
+}
+
+// Returns true if `interrupt` is enabled in I_MASK
+func (state *IrqState) Enabled(interrupt Interrupt) bool {
+	return state.Mask&(1<<interrupt) != 0
+}
+
+// Returns the latch state of every interrupt line
+func (state *IrqState) Lines() []IrqLine {
+	lines := make([]IrqLine, IRQ_COUNT)
+	for i := range lines {
+		interrupt := Interrupt(i)
+		lines[i] = IrqLine{
+			Interrupt: interrupt,
+			Latched:   state.Latched(interrupt),
+			Enabled:   state.Enabled(interrupt),
+		}
+	}
+	return lines
+}
+
+// Loads I_STAT (offsets 0-3) or I_MASK (offsets 4-7)
+func (state *IrqState) Load(offset uint32, size AccessSize) uint32 {
+	reg := uint32(state.Status)
+	if offset >= 4 {
+		reg = uint32(state.Mask)
+	}
+	return reg >> ((offset & 3) * 8)
+}
+
+// Stores `val` into I_STAT (offsets 0-3) or I_MASK (offsets 4-7). Bits that
+// aren't covered by a byte or halfword store keep their value
+func (state *IrqState) Store(offset uint32, size AccessSize, val uint32) {
+	shift := (offset & 3) * 8
+	bits := uint32(0xffffffff)
+	if size != ACCESS_WORD {
+		bits = (1<<(size*8) - 1) << shift
+	}
+	val = (val << shift) & bits
+
+	if offset < 4 {
+		state.Acknowledge(uint16(val | ^bits))
+	} else {
+		state.SetMask(uint16(uint32(state.Mask)&^bits | val))
+	}
+}
@@ -0,0 +1,64 @@
+package bus
+
+import "testing"
+
+func TestIrqAcknowledge(t *testing.T) {
+	state := NewIrqState()
+	state.SetHigh(INTERRUPT_VBLANK)
+	state.SetHigh(INTERRUPT_DMA)
+	state.SetHigh(INTERRUPT_TIMER2)
+
+	// writing 0 clears a latch, writing 1 leaves it alone
+	state.Store(0, ACCESS_WORD, ^uint32(1<<INTERRUPT_DMA))
+	if !state.Latched(INTERRUPT_VBLANK) || state.Latched(INTERRUPT_DMA) || !state.Latched(INTERRUPT_TIMER2) {
+		t.Errorf("unexpected I_STAT after acknowledge: 0x%x", state.Status)
+	}
+
+	// a byte store to the high byte doesn't touch the low bits
+	state.SetHigh(INTERRUPT_SIO)
+	state.Store(1, ACCESS_BYTE, 0)
+	if state.Latched(INTERRUPT_SIO) || !state.Latched(INTERRUPT_VBLANK) {
+		t.Errorf("unexpected I_STAT after byte acknowledge: 0x%x", state.Status)
+	}
+
+	// a latch stays set until it's acknowledged
+	state.Store(0, ACCESS_WORD, 0)
+	state.SetHigh(INTERRUPT_CDROM)
+	state.Store(0, ACCESS_WORD, 0xffffffff)
+	if !state.Latched(INTERRUPT_CDROM) {
+		t.Error("acknowledging with 1 cleared the latch")
+	}
+}
+
+func TestIrqMask(t *testing.T) {
+	state := NewIrqState()
+	state.Store(4, ACCESS_WORD, 0xffffffff)
+	if state.Mask != IRQ_MASK {
+		t.Errorf("expected only the implemented bits in I_MASK, got 0x%x", state.Mask)
+	}
+
+	state.Store(4, ACCESS_HALFWORD, 1<<INTERRUPT_CDROM)
+	if state.Load(4, ACCESS_WORD) != 1<<INTERRUPT_CDROM {
+		t.Errorf("unexpected I_MASK 0x%x", state.Mask)
+	}
+	if state.Active() {
+		t.Error("no interrupt is latched")
+	}
+
+	state.SetHigh(INTERRUPT_VBLANK)
+	if state.Active() {
+		t.Error("a masked interrupt shouldn't be active")
+	}
+	state.SetHigh(INTERRUPT_CDROM)
+	if !state.Active() {
+		t.Error("an enabled interrupt should be active")
+	}
+
+	lines := state.Lines()
+	if len(lines) != IRQ_COUNT {
+		t.Fatalf("expected %d lines, got %d", IRQ_COUNT, len(lines))
+	}
+	if !lines[INTERRUPT_CDROM].Pending() || lines[INTERRUPT_VBLANK].Pending() || !lines[INTERRUPT_VBLANK].Latched {
+		t.Errorf("unexpected line states %+v", lines)
+	}
+}
@@ -0,0 +1,218 @@
+package bus
+
+import (
+	"fmt"
+	"math"
+)
+
+// Range of the CPU clock multiplier, see TimeHandler.SetOverclock
+const (
+	OVERCLOCK_MIN = 1
+	OVERCLOCK_MAX = 4
+)
+
+// Keeps track of the emulation time
+type TimeHandler struct {
+	// Keeps track of the current execution time. It is measured in
+	// the CPU clock at 33.8685MHz (~29.525960700946ns)
+	Cycles     uint64
+	NextSync   uint64 // Next time a peripheral needs to be synchronized
+	TimeSheets [7]*TimeSheet
+	// Time sheet of the SPU. It isn't in TimeSheets so the savestates made
+	// before it was added still load
+	SpuSheet *TimeSheet
+	// Cycles charged by the CPU with Tick. Same as Cycles unless the CPU is
+	// overclocked, the GTE timings are measured with it
+	CpuCycles uint64
+	// CPU clock multiplier. The peripherals keep running at the original
+	// clock, so the CPU runs Overclock instructions in the time of one
+	Overclock    uint64
+	OverclockRem uint64 // CPU cycles that didn't add up to a whole cycle yet
+}
+
+// Represents a TimeSheet index
+type Peripheral uint32
+
+const (
+	PERIPHERAL_GPU        Peripheral = iota // Graphics Processing Unit
+	PERIPHERAL_TIMER0     Peripheral = iota // Timer 0
+	PERIPHERAL_TIMER1     Peripheral = iota // Timer 1
+	PERIPHERAL_TIMER2     Peripheral = iota // Timer 2
+	PERIPHERAL_PADMEMCARD Peripheral = iota // Gamepad and memory card controller
+	PERIPHERAL_CDROM      Peripheral = iota // CD-ROM controller
+	PERIPHERAL_DMA        Peripheral = iota // Chopped DMA transfers
+	PERIPHERAL_SPU        Peripheral = iota // Sound Processing Unit, see TimeHandler.SpuSheet
+)
+
+// Returns a new instance of TimeHandler
+func NewTimeHandler() *TimeHandler {
+	th := &TimeHandler{
+		NextSync:  math.MaxUint64,
+		Overclock: OVERCLOCK_MIN,
+		SpuSheet:  NewTimeSheet(),
+	}
+	for i := 0; i < len(th.TimeSheets); i++ {
+		th.TimeSheets[i] = NewTimeSheet()
+	}
+	return th
+}
+
+// Returns the time sheet of a peripheral
+func (th *TimeHandler) sheet(from Peripheral) *TimeSheet {
+	if from == PERIPHERAL_SPU {
+		return th.SpuSheet
+	}
+	return th.TimeSheets[from]
+}
+
+// Advance the current time by `cycles` of the CPU clock. If the CPU is
+// overclocked, the time only advances by `cycles`/Overclock
+func (th *TimeHandler) Tick(cycles uint64) {
+	th.CpuCycles += cycles
+	if th.Overclock <= OVERCLOCK_MIN {
+		th.Cycles += cycles
+		return
+	}
+
+	cycles += th.OverclockRem
+	th.Cycles += cycles / th.Overclock
+	th.OverclockRem = cycles % th.Overclock
+}
+
+// Sets the CPU clock multiplier, between OVERCLOCK_MIN (the original clock)
+// and OVERCLOCK_MAX. Games with slowdown run faster, but the timers, the
+// GPU and the CD-ROM still run at the original speed, so games don't run
+// faster than on the real console
+func (th *TimeHandler) SetOverclock(multiplier uint64) error {
+	if multiplier < OVERCLOCK_MIN || multiplier > OVERCLOCK_MAX {
+		return fmt.Errorf(
+			"%w: %dx (must be %dx to %dx)",
+			ErrInvalidOverclock, multiplier, OVERCLOCK_MIN, OVERCLOCK_MAX,
+		)
+	}
+	th.Overclock = multiplier
+	th.OverclockRem = 0
+	return nil
+}
+
+// Synchronizes a peripheral
+func (th *TimeHandler) Sync(from Peripheral) uint64 {
+	return th.sheet(from).Sync(th.Cycles)
+}
+
+func (th *TimeHandler) SetNextSyncDelta(from Peripheral, delta uint64) {
+	at := th.Cycles + delta
+	th.sheet(from).NextSync = at
+
+	if at < th.NextSync {
+		th.NextSync = at
+	}
+}
+
+func (th *TimeHandler) MaybeSetNextSync(from Peripheral, at uint64) {
+	sheet := th.sheet(from)
+
+	if sheet.NextSync > at {
+		sheet.NextSync = at
+	}
+}
+
+func (th *TimeHandler) MaybeSetNextSyncDelta(from Peripheral, delta uint64) {
+	at := th.Cycles + delta
+	th.MaybeSetNextSync(from, at)
+}
+
+// Called when there's no event scheduled
+func (th *TimeHandler) RemoveNextSync(from Peripheral) {
+	th.sheet(from).NextSync = math.MaxUint64
+}
+
+// Returns true if a peripheral needs to be synchronized
+func (th *TimeHandler) ShouldSync() bool {
+	return th.NextSync <= th.Cycles
+}
+
+func (th *TimeHandler) UpdatePendingSync() {
+	// find minimum next sync value
+	var min uint64 = th.SpuSheet.NextSync
+	for _, sheet := range th.TimeSheets {
+		if sheet.NextSync < min {
+			min = sheet.NextSync
+		}
+	}
+
+	th.NextSync = min
+}
+
+// Returns true if the peripheral reached the time of the next forced
+// synchronization
+func (th *TimeHandler) NeedsSync(from Peripheral) bool {
+	return th.sheet(from).NeedsSync(th.Cycles)
+}
+
+// Keeps track of synchronization of different peripherals
+type TimeSheet struct {
+	LastSync uint64 // Time of the last synchronization
+	NextSync uint64 // Date of the next synchronization
+}
+
+// Returns a new TimeSheet instance
+func NewTimeSheet() *TimeSheet {
+	return &TimeSheet{}
+}
+
+// Set the time sheet to the current time and return the time
+// since the last synchronization
+func (sheet *TimeSheet) Sync(cycles uint64) uint64 {
+	delta := cycles - sheet.LastSync
+	sheet.LastSync = cycles
+	return delta
+}
+
+// Returns true if the peripheral reached `NextSync`
+func (sheet *TimeSheet) NeedsSync(cycles uint64) bool {
+	return sheet.NextSync <= cycles
+}
+
+type FracCycles uint64
+
+// The amount of fixed point fractional bits
+const FRAC_CYCLES_FRAC_BITS uint64 = 16
+
+func FracCyclesFromFixed(fixed uint64) FracCycles {
+	return FracCycles(fixed)
+}
+
+func FracCyclesFromCycles(cycles uint64) FracCycles {
+	return FracCycles(cycles << FRAC_CYCLES_FRAC_BITS)
+}
+
+func FracCyclesFromF32(val float32) FracCycles {
+	precision := float32(1 << FRAC_CYCLES_FRAC_BITS)
+	return FracCycles(uint64(val * precision))
+}
+
+func (fc FracCycles) GetFixed() uint64 {
+	return uint64(fc)
+}
+
+func (fc FracCycles) Add(val FracCycles) FracCycles {
+	return FracCycles(fc.GetFixed() + val.GetFixed())
+}
+
+func (fc FracCycles) Multiply(val FracCycles) FracCycles {
+	v := fc.GetFixed() * val.GetFixed()
+	// the shift amount is doubled after multiplication
+	return FracCycles(v >> FRAC_CYCLES_FRAC_BITS)
+}
+
+func (fc FracCycles) Divide(denominator FracCycles) FracCycles {
+	numerator := fc.GetFixed() << FRAC_CYCLES_FRAC_BITS
+	return FracCycles(numerator / denominator.GetFixed())
+}
+
+func (fc FracCycles) Ceil() uint64 {
+	shift := FRAC_CYCLES_FRAC_BITS
+	var align uint64 = (1 << shift) - 1
+	return (uint64(fc) + align) >> shift
+}
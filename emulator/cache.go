@@ -1,5 +1,6 @@
 package emulator
 
+// Value of the cache control register (0xfffe0130)
 type CacheControl uint32
 
 // Returns whether the instruction cache is enabled
@@ -7,10 +8,43 @@ func (cache CacheControl) ICacheEnabled() bool {
 	return uint32(cache)&0x800 != 0
 }
 
+// Returns true if writes while the cache is isolated go to the cache tags
+// instead of the cached instructions
 func (cache CacheControl) TagTestMode() bool {
 	return uint32(cache)&4 != 0
 }
 
+// Returns true if the data cache is used as the scratchpad. The
+// PlayStation only uses it that way, it needs both enable bits
+func (cache CacheControl) ScratchpadEnabled() bool {
+	return uint32(cache)&0x88 == 0x88
+}
+
+// Returns true if the data cache is enabled as a real data cache, which
+// isn't wired on the PlayStation
+func (cache CacheControl) DataCacheMode() bool {
+	return uint32(cache)&0x88 == 0x08
+}
+
+// Instruction cache counters, see Debugger.ICache. Only the interpreter
+// counts hits and misses, compiled blocks assume that the cache hits
+type ICacheStats struct {
+	Hits          uint64 // Fetches found in the cache
+	Misses        uint64 // Fetches that refilled a cache line
+	Invalidations uint64 // Lines invalidated by isolated writes in tag test mode
+	DataWrites    uint64 // Instructions written by isolated writes
+}
+
+// Returns the fraction of the fetches that hit the cache, or 0 if there
+// was no fetch
+func (stats *ICacheStats) HitRate() float64 {
+	total := stats.Hits + stats.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(stats.Hits) / float64(total)
+}
+
 type ICacheLine struct {
 	// Tag: high 22 bits of the address associated with the cache line
 	// Valid bits: 3 bit index of the first word in this line
@@ -41,9 +75,11 @@ func (cline *ICacheLine) SetTagValid(pc uint32) {
 	cline.TagValid = pc & 0x7ffff00c
 }
 
-// Invalidates the entire cache line
-func (cline *ICacheLine) Invalidate() {
-	cline.TagValid |= 0x10 // set bit 4 to be outside of the valid cache line range
+// Invalidates the entire cache line. Like a tag write on the hardware, the
+// tag becomes the one of `addr`
+func (cline *ICacheLine) Invalidate(addr uint32) {
+	// set bit 4 to be outside of the valid cache line range
+	cline.TagValid = addr&0x7ffff000 | 0x10
 }
 
 // Returns the instruction at `index`
@@ -0,0 +1,61 @@
+package emulator
+
+import "testing"
+
+func TestCacheIsolatedWrites(t *testing.T) {
+	cpu := NewCPU(newBenchInterconnect())
+	inter := cpu.Inter
+	const pc = 0x80010020
+
+	// fill the cache line and hit it
+	inter.Ram.Store(0x10020, ACCESS_WORD, 0x24010001) // addiu $1, $0, 1
+	inter.CacheCtrl = 0x800
+	cpu.CurrentPC = pc
+	cpu.FetchInstruction()
+	if got := cpu.FetchInstruction(); got != 0x24010001 {
+		t.Fatalf("expected 0x24010001, got 0x%x", got)
+	}
+
+	// writes in data mode replace the whole word, smaller writes are
+	// shifted like on the bus
+	cpu.CacheMaintenance(pc, ACCESS_WORD, 0x24020002)
+	cpu.CacheMaintenance(pc+2, ACCESS_HALFWORD, 0x1234)
+	if got := cpu.FetchInstruction(); got != 0x12340000 {
+		t.Errorf("expected 0x12340000 after data writes, got 0x%x", got)
+	}
+
+	// a tag write with any value invalidates the line
+	inter.CacheCtrl = 0x804
+	cpu.CacheMaintenance(pc, ACCESS_WORD, 0xffffffff)
+	inter.CacheCtrl = 0x800
+	if got := cpu.FetchInstruction(); got != 0x24010001 {
+		t.Errorf("expected a refill from RAM after a tag write, got 0x%x", got)
+	}
+
+	// writes with the cache disabled are dropped
+	inter.CacheCtrl = 0
+	cpu.CacheMaintenance(pc, ACCESS_WORD, 0)
+	inter.CacheCtrl = 0x800
+	if got := cpu.FetchInstruction(); got != 0x24010001 {
+		t.Errorf("write with the cache disabled changed the line: 0x%x", got)
+	}
+
+	stats := cpu.Debugger.ICache
+	expected := ICacheStats{Hits: 3, Misses: 2, Invalidations: 1, DataWrites: 2}
+	if stats != expected {
+		t.Errorf("expected %+v, got %+v", expected, stats)
+	}
+	if rate := stats.HitRate(); rate != 0.6 {
+		t.Errorf("expected a hit rate of 0.6, got %v", rate)
+	}
+}
+
+func TestCacheControlScratchpad(t *testing.T) {
+	// value written by the BIOS
+	if cc := CacheControl(0x1e988); !cc.ScratchpadEnabled() || cc.DataCacheMode() {
+		t.Error("BIOS cache control should enable the scratchpad")
+	}
+	if cc := CacheControl(0x008); cc.ScratchpadEnabled() || !cc.DataCacheMode() {
+		t.Error("0x8 should enable the data cache mode")
+	}
+}
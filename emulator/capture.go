@@ -0,0 +1,193 @@
+package emulator
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+)
+
+// Receives the picture of every frame output by the GPU, see GPU.Capture.
+// The image is reused after the call returns
+type FrameCapture func(img *image.RGBA)
+
+// Returns the width and height of the picture sent to the TV, computed from
+// the display range and the resolution
+func (gpu *GPU) DisplaySize() (int, int) {
+	width := 0
+	if gpu.DisplayHorizEnd > gpu.DisplayHorizStart {
+		cycles := int(gpu.DisplayHorizEnd - gpu.DisplayHorizStart)
+		width = (cycles/int(gpu.HRes.DotclockDivider()) + 2) &^ 3
+	}
+	height := 0
+	if gpu.DisplayLineEnd > gpu.DisplayLineStart {
+		height = int(gpu.DisplayLineEnd - gpu.DisplayLineStart)
+	}
+	if gpu.Interlaced480() {
+		height *= 2
+	}
+	return width, height
+}
+
+// Returns the area of VRAM that is shown on the TV
+func (gpu *GPU) DisplayArea() image.Rectangle {
+	width, height := gpu.DisplaySize()
+	x, y := int(gpu.DisplayVRamXStart), int(gpu.DisplayVRamYStart)
+	return image.Rect(x, y, x+width, y+height)
+}
+
+// Draws the frame that was just finished into the capture image and sends
+// it to Capture. If the frame is empty, the previous picture is sent again
+func (gpu *GPU) captureFrame() {
+	if len(gpu.DrawData.VtxBuffer) > 0 || gpu.captureImage == nil {
+		// the host renderer draws the polygons, so draw them on top of
+		// the image uploads
+		vram := gpu.VRam.Image()
+		offset := NewVec2(gpu.DrawingXOffset, gpu.DrawingYOffset)
+		RasterizeMasked(vram, gpu.VRam.MaskPlane(), gpu.DrawData.VtxBuffer, offset)
+
+		area := gpu.DisplayArea().Intersect(vram.Bounds())
+		if area.Empty() {
+			area = vram.Bounds()
+		}
+		gpu.captureImage = vram.SubImage(area).(*image.RGBA)
+	}
+	gpu.Capture(gpu.captureImage)
+}
+
+// Draws Gouraud shaded triangles into `dst` in software. The triangles are
+// moved by `offset`, like the drawing offset of the GPU, and clipped to
+// their drawing area. The colors are truncated to 15 bits like in VRAM
+func RasterizeTriangles(dst *image.RGBA, vertices []Vertex, offset Vec2) {
+	RasterizeMasked(dst, nil, vertices, offset)
+}
+
+// Same as RasterizeTriangles, with the mask bit settings of the triangles.
+// `mask` holds the mask bit of every pixel of `dst` (see VRam.MaskPlane)
+// and is updated as the triangles are drawn
+func RasterizeMasked(dst *image.RGBA, mask []bool, vertices []Vertex, offset Vec2) {
+	for i := 0; i+2 < len(vertices); i += 3 {
+		rasterizeTriangle(dst, mask, vertices[i:i+3], offset)
+	}
+}
+
+func rasterizeTriangle(dst *image.RGBA, mask []bool, tri []Vertex, offset Vec2) {
+	var xs, ys [3]int
+	for i, vtx := range tri {
+		xs[i] = int(vtx.Position.X) + int(offset.X)
+		ys[i] = int(vtx.Position.Y) + int(offset.Y)
+	}
+
+	// twice the signed area, the edge functions are divided by it
+	area := (xs[1]-xs[0])*(ys[2]-ys[0]) - (xs[2]-xs[0])*(ys[1]-ys[0])
+	if area == 0 {
+		return
+	}
+
+	bounds := dst.Bounds()
+	box := image.Rect(
+		minInt(xs[0], minInt(xs[1], xs[2])), minInt(ys[0], minInt(ys[1], ys[2])),
+		maxInt(xs[0], maxInt(xs[1], xs[2]))+1, maxInt(ys[0], maxInt(ys[1], ys[2]))+1,
+	).Intersect(bounds)
+	if tri[0].Clipped() {
+		box = box.Intersect(tri[0].DrawingArea)
+	}
+
+	for y := box.Min.Y; y < box.Max.Y; y++ {
+		for x := box.Min.X; x < box.Max.X; x++ {
+			// barycentric weights of the pixel
+			w0 := (xs[2]-xs[1])*(y-ys[1]) - (ys[2]-ys[1])*(x-xs[1])
+			w1 := (xs[0]-xs[2])*(y-ys[2]) - (ys[0]-ys[2])*(x-xs[2])
+			w2 := area - w0 - w1
+			if area < 0 {
+				w0, w1, w2 = -w0, -w1, -w2
+			}
+			if w0 < 0 || w1 < 0 || w2 < 0 {
+				continue
+			}
+			if mask != nil {
+				i := (y-bounds.Min.Y)*bounds.Dx() + x - bounds.Min.X
+				if tri[0].CheckMask && mask[i] {
+					continue
+				}
+				mask[i] = tri[0].SetMask
+			}
+
+			total := w0 + w1 + w2
+			shade := func(c0, c1, c2 uint8) uint8 {
+				return uint8((int(c0)*w0 + int(c1)*w1 + int(c2)*w2) / total)
+			}
+			clr := color.RGBA{
+				R: shade(tri[0].Color.R, tri[1].Color.R, tri[2].Color.R),
+				G: shade(tri[0].Color.G, tri[1].Color.G, tri[2].Color.G),
+				B: shade(tri[0].Color.B, tri[1].Color.B, tri[2].Color.B),
+				A: 255,
+			}
+			if tri[0].Dither {
+				dst.SetRGBA(x, y, Color15ToRGBA(Color24To15Dithered(clr, x, y)))
+			} else {
+				dst.SetRGBA(x, y, Color15ToRGBA(Color24To15(clr)))
+			}
+		}
+	}
+}
+
+// Writes captured frames and audio as raw streams, for example to the
+// standard input of ffmpeg. The frames are scaled to Width*Height RGBA
+// pixels since the resolution of the console can change, the audio is the
+// 16 bit little endian stereo output of the mixer at CD_SAMPLE_RATE
+type FrameDumper struct {
+	Video  io.Writer // Raw RGBA frames, can be nil
+	Audio  io.Writer // Raw audio samples, can be nil
+	Width  int
+	Height int
+	Err    error // First write error, nothing is written after an error
+	frame  []byte
+	audio  []byte
+}
+
+// Returns a new frame dumper with frames of `width`*`height` pixels
+func NewFrameDumper(video, audio io.Writer, width, height int) *FrameDumper {
+	return &FrameDumper{
+		Video:  video,
+		Audio:  audio,
+		Width:  width,
+		Height: height,
+		frame:  make([]byte, width*height*4),
+	}
+}
+
+// Scales `img` and writes it to the video stream. Can be used as a
+// FrameCapture
+func (dumper *FrameDumper) WriteFrame(img *image.RGBA) {
+	if dumper.Video == nil || dumper.Err != nil {
+		return
+	}
+
+	// nearest neighbor scaling
+	bounds := img.Bounds()
+	for y := 0; y < dumper.Height; y++ {
+		srcY := bounds.Min.Y + y*bounds.Dy()/dumper.Height
+		for x := 0; x < dumper.Width; x++ {
+			srcX := bounds.Min.X + x*bounds.Dx()/dumper.Width
+			src := img.PixOffset(srcX, srcY)
+			dst := (y*dumper.Width + x) * 4
+			copy(dumper.frame[dst:dst+4], img.Pix[src:src+4])
+		}
+	}
+	_, dumper.Err = dumper.Video.Write(dumper.frame)
+}
+
+// Writes interleaved stereo samples to the audio stream. Can be used as an
+// AudioOutput
+func (dumper *FrameDumper) WriteAudio(samples []int16) {
+	if dumper.Audio == nil || dumper.Err != nil {
+		return
+	}
+
+	dumper.audio = dumper.audio[:0]
+	for _, sample := range samples {
+		dumper.audio = binary.LittleEndian.AppendUint16(dumper.audio, uint16(sample))
+	}
+	_, dumper.Err = dumper.Audio.Write(dumper.audio)
+}
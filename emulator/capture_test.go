@@ -0,0 +1,147 @@
+package emulator
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestRasterizeTriangles(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	red := color.RGBA{255, 0, 0, 255}
+	vertices := []Vertex{
+		NewVertex(NewVec2(0, 0), red),
+		NewVertex(NewVec2(40, 0), red),
+		NewVertex(NewVec2(0, 40), red),
+	}
+	RasterizeTriangles(img, vertices, NewVec2(10, 10))
+
+	if clr := img.RGBAAt(15, 15); clr != red {
+		t.Errorf("expected a red pixel inside the triangle, got %v", clr)
+	}
+	if clr := img.RGBAAt(5, 5); clr.A != 0 {
+		t.Errorf("expected the drawing offset to move the triangle, got %v", clr)
+	}
+	if clr := img.RGBAAt(45, 45); clr.A != 0 {
+		t.Errorf("expected an empty pixel outside the triangle, got %v", clr)
+	}
+}
+
+func TestGpuCapture(t *testing.T) {
+	gpu := NewGPU(HARDWARE_NTSC)
+	if width, height := gpu.DisplaySize(); width != 256 || height != 240 {
+		t.Fatalf("expected a 256x240 display, got %dx%d", width, height)
+	}
+
+	var buf bytes.Buffer
+	dumper := NewFrameDumper(&buf, nil, 4, 2)
+	gpu.Capture = dumper.WriteFrame
+	gpu.DrawData.PushVertices(
+		NewVertex(NewVec2(0, 0), color.RGBA{0, 255, 0, 255}),
+		NewVertex(NewVec2(400, 0), color.RGBA{0, 255, 0, 255}),
+		NewVertex(NewVec2(0, 400), color.RGBA{0, 255, 0, 255}),
+	)
+	gpu.captureFrame()
+
+	// the frame is scaled to 4x2 pixels, the top left pixel is green
+	if buf.Len() != 4*2*4 || dumper.Err != nil {
+		t.Fatalf("expected a 32 byte frame, got %d bytes (%v)", buf.Len(), dumper.Err)
+	}
+	if !bytes.Equal(buf.Bytes()[:4], []byte{0, 255, 0, 255}) {
+		t.Errorf("expected a green pixel, got %v", buf.Bytes()[:4])
+	}
+}
+
+// Primitives only draw inside the drawing area, the pixels around it keep
+// their color
+func TestGpuDrawingAreaClipping(t *testing.T) {
+	gpu := NewGPU(HARDWARE_NTSC)
+	gpu.GP0(0xe3000000 | 16<<10 | 16) // top left (16, 16)
+	gpu.GP0(0xe4000000 | 47<<10 | 47) // bottom right (47, 47)
+
+	// a white quad over the whole image
+	gpu.GP0(0x28ffffff)
+	gpu.GP0(0x00000000)
+	gpu.GP0(0x00000040)
+	gpu.GP0(0x00400000)
+	gpu.GP0(0x00400040)
+
+	blue := color.RGBA{0, 0, 255, 255}
+	white := color.RGBA{255, 255, 255, 255}
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	draw.Draw(img, img.Bounds(), image.NewUniform(blue), image.Point{}, draw.Src)
+	RasterizeTriangles(img, gpu.DrawData.VtxBuffer, NewVec2(0, 0))
+
+	area := image.Rect(16, 16, 48, 48)
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			expected := blue
+			if image.Pt(x, y).In(area) {
+				expected = white
+			}
+			if clr := img.RGBAAt(x, y); clr != expected {
+				t.Fatalf("expected %v at (%d, %d), got %v", expected, x, y, clr)
+			}
+		}
+	}
+
+	// an inverted drawing area doesn't draw anything
+	gpu.DrawData.VtxBuffer = nil
+	gpu.GP0(0xe3000000 | 40<<10 | 40)
+	gpu.GP0(0xe4000000 | 20<<10 | 20)
+	gpu.GP0(0x20ff0000)
+	gpu.GP0(0x00000000)
+	gpu.GP0(0x00000040)
+	gpu.GP0(0x00400000)
+	RasterizeTriangles(img, gpu.DrawData.VtxBuffer, NewVec2(0, 0))
+	if clr := img.RGBAAt(30, 30); clr != white {
+		t.Errorf("expected the inverted area to be left alone, got %v", clr)
+	}
+}
+
+// Shaded triangles get the 4x4 dither pattern when GP0(0xE1) enables it
+func TestRasterizeDithering(t *testing.T) {
+	gpu := NewGPU(HARDWARE_NTSC)
+	gpu.GP0(0xe1000200) // dithering on
+	gpu.GP0(0xe3000000)
+	gpu.GP0(0xe4000000 | 63<<10 | 63)
+
+	// shaded triangle with the same gray at every vertex, on a 5 bit step
+	// so the negative dither offsets round it down
+	triangle := func(opcode uint32) {
+		gpu.DrawData.VtxBuffer = nil
+		gpu.GP0(opcode<<24 | 0x808080)
+		gpu.GP0(0x00000000)
+		gpu.GP0(0x00848484)
+		gpu.GP0(0x00000040)
+		gpu.GP0(0x00848484)
+		gpu.GP0(0x00400000)
+	}
+	levels := func() map[uint8]bool {
+		img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+		RasterizeTriangles(img, gpu.DrawData.VtxBuffer, NewVec2(0, 0))
+		found := map[uint8]bool{}
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				found[img.RGBAAt(x, y).R] = true
+			}
+		}
+		return found
+	}
+
+	triangle(0x30)
+	if found := levels(); len(found) != 2 {
+		t.Errorf("expected 2 dithered levels, got %v", found)
+	}
+	if val := Color24To15Dithered(color.RGBA{0x80, 0, 0, 255}, 0, 0); val != 0x80>>3-1 {
+		t.Errorf("expected the top-left offset to round down, got %d", val)
+	}
+
+	gpu.NoDither = true
+	triangle(0x30)
+	if found := levels(); len(found) != 1 {
+		t.Errorf("expected a flat color without dithering, got %v", found)
+	}
+}
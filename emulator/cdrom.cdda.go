@@ -0,0 +1,128 @@
+package emulator
+
+// Amount of sectors skipped per sector period by the Forward and
+// Backward commands
+const CDDA_SCAN_SECTORS = 8
+
+// Plays the current CD-DA sector and moves to the next one
+func (cdrom *CdRom) PlaySector() {
+	disc := cdrom.GetDiscOrPanic()
+	index := cdrom.Position.SectorIndex()
+	track := disc.TrackAt(index)
+	if track == nil && cdrom.Seeking {
+		// the seek target is not on the disc
+		cdrom.FailSeek()
+		return
+	}
+	if track == nil {
+		// reached the end of the disc
+		cdrom.EndPlayback()
+		return
+	}
+
+	// data tracks are not played
+	if track.IsAudio() {
+		sector, err := disc.ReadSector(cdrom.Position)
+		if err != nil {
+			// the image is shorter than the track
+			Log.Warnf(LOG_MODULE_CDROM, "couldn't read sector: %s", err)
+			cdrom.FailSeek()
+			return
+		}
+
+		if cdrom.CddaMode {
+			cdrom.Mixer.MixCdda(sector.DataBytes())
+		}
+		if cdrom.ReportInterrupts {
+			cdrom.MaybeReport(track, sector)
+		}
+	}
+
+	// go to the next position
+	next := int64(index) + 1
+	if cdrom.Scan != 0 {
+		next = int64(index) + int64(cdrom.Scan*CDDA_SCAN_SECTORS)
+	}
+
+	if next < int64(LEAD_IN_SECTORS) {
+		// rewound to the start of the disc, continue playing normally
+		next = int64(LEAD_IN_SECTORS)
+		cdrom.Scan = 0
+	}
+	if cdrom.Autopause && cdrom.Scan == 0 && uint32(next) >= track.End() {
+		cdrom.EndPlayback()
+		return
+	}
+
+	pos, err := MsfFromIndex(uint32(next))
+	if err != nil {
+		cdrom.EndPlayback()
+		return
+	}
+	cdrom.Position = pos
+}
+
+// Stops CD-DA playback and responds with a DataEnd interrupt
+func (cdrom *CdRom) EndPlayback() {
+	cdrom.ReadState.MakeIdle()
+	cdrom.Scan = 0
+
+	if !cdrom.SubCpu.IsAsyncCommandPending() {
+		cdrom.SubCpu.ScheduleAsyncResponse(ASYNC_RESPONSE_DATA_END, 0)
+	}
+}
+
+// DataEnd response
+func (cdrom *CdRom) AsyncDataEnd() uint32 {
+	cdrom.SubCpu.SetIrqCode(IRQ_CODE_DATA_END)
+	cdrom.PushStatus()
+	return TIMING_DATA_END_RX_PUSH
+}
+
+// Queues a CD-DA position report every 10 sectors. Reports alternate
+// between the absolute position and the position relative to the track
+func (cdrom *CdRom) MaybeReport(track *Track, sector *XaSector) {
+	index := cdrom.Position.SectorIndex()
+	frame := index % 75
+	if frame%10 != 0 {
+		return
+	}
+
+	// peak of the left or right channel, bit 15 is the channel
+	channel := (frame / 10) & 1
+	var peak uint16
+	data := sector.DataBytes()
+	for i := int(channel) * 2; i+1 < len(data); i += 4 {
+		sample := int16(uint16(data[i]) | uint16(data[i+1])<<8)
+		if sample < 0 {
+			sample = -(sample + 1)
+		}
+		if uint16(sample) > peak {
+			peak = uint16(sample)
+		}
+	}
+	peak |= uint16(channel) << 15
+
+	m, s, f := cdrom.Position.Values()
+	if channel != 0 {
+		var relative uint32
+		if index > track.Start {
+			relative = index - track.Start
+		}
+		rel, err := MsfFromIndex(relative)
+		if err != nil {
+			panicFmt("cdrom: msf: %s", err)
+		}
+		m, s, f = rel.Values()
+		s |= 0x80 // relative position
+	}
+
+	cdrom.PendingReport = []byte{
+		cdrom.DriveStatus(),
+		toBcd(track.Number),
+		0x01, // index
+		m, s, f,
+		uint8(peak),
+		uint8(peak >> 8),
+	}
+}
@@ -0,0 +1,158 @@
+package emulator
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// Length of the audio track of newTestCddaDisc in sectors
+const CDDA_TEST_SECTORS = 100
+
+// Returns a disc with the test ISO image as track 1 and an audio track 2
+// at 00:02:32. Every stereo frame of the audio is (0x1000, -0x2000)
+func newTestCddaDisc(t *testing.T) *Disc {
+	audio := make([]byte, CDDA_TEST_SECTORS*int(SECTOR_SIZE))
+	for i := 0; i+3 < len(audio); i += 4 {
+		audio[i], audio[i+1] = 0x00, 0x10
+		audio[i+2], audio[i+3] = 0x00, 0xe0
+	}
+	files := map[string][]byte{"data.bin": newTestIsoImage(nil), "audio.bin": audio}
+
+	cue := `FILE "data.bin" BINARY
+  TRACK 01 MODE2/2352
+    INDEX 01 00:00:00
+FILE "audio.bin" BINARY
+  TRACK 02 AUDIO
+    INDEX 01 00:00:00`
+	disc, err := NewDiscFromCue(strings.NewReader(cue), func(name string) (io.ReadSeeker, error) {
+		if data, ok := files[name]; ok {
+			return bytes.NewReader(data), nil
+		}
+		return nil, fmt.Errorf("%s not found", name)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(disc.Close)
+	return disc
+}
+
+// Runs the CD-ROM controller for `sectors` sector periods, acknowledging
+// every interrupt
+func runCdRomSectors(cdrom *CdRom, th *TimeHandler, irqState *IrqState, sectors int) {
+	end := th.Cycles + uint64(sectors)*uint64(cdrom.CyclesPerSector())
+	for th.Cycles < end {
+		th.Tick(1000)
+		cdrom.Sync(th, irqState)
+		if cdrom.IrqFlags != 0 {
+			cdrom.HostResponse.Clear()
+			cdrom.IrqAck(0x1f, th)
+		}
+	}
+}
+
+// Starts playing track 2 with the mode `mode`
+func playTestCdda(t *testing.T, mode uint8) (*CdRom, *TimeHandler, *IrqState) {
+	cdrom := NewCdRom(newTestCddaDisc(t))
+	th, irqState := NewTimeHandler(), NewIrqState()
+
+	sendCdRomCommand(cdrom, th, 0x0e, mode)
+	waitCdRomIrq(t, cdrom, th, irqState)
+	sendCdRomCommand(cdrom, th, 0x03, 0x02)
+	if code, response := waitCdRomIrq(t, cdrom, th, irqState); code != IRQ_CODE_OK {
+		t.Fatalf("expected Play to be accepted, got INT%d %x", code, response)
+	}
+	return cdrom, th, irqState
+}
+
+// Playback reports alternate between the absolute and the relative
+// position with the peak of the left and the right channel, and autopause
+// ends the playback at the end of the track
+func TestCddaPlayReports(t *testing.T) {
+	cdrom, th, irqState := playTestCdda(t, 0x07) // CD-DA, autopause, report
+
+	var reports [][]byte
+	for {
+		code, response := waitCdRomIrq(t, cdrom, th, irqState)
+		if code == IRQ_CODE_DATA_END {
+			break
+		}
+		if code != IRQ_CODE_SECTOR_READY || len(response) != 8 {
+			t.Fatalf("expected a report, got INT%d %x", code, response)
+		}
+		reports = append(reports, response)
+	}
+
+	// the track starts at sector 182 (frame 32) and ends at sector 282
+	if len(reports) != 10 {
+		t.Fatalf("expected 10 reports, got %d", len(reports))
+	}
+	status := reports[0][0]
+	expected := [][]byte{
+		{status, 0x02, 0x01, 0x00, 0x02, 0x40, 0x00, 0x10},        // 00:02:40, left
+		{status, 0x02, 0x01, 0x00, 0x80 | 0x00, 0x18, 0xff, 0x9f}, // 00:00:18 in the track, right
+	}
+	for i := range expected {
+		if !bytes.Equal(reports[i], expected[i]) {
+			t.Errorf("report %d: expected %x, got %x", i, expected[i], reports[i])
+		}
+	}
+	if status&(1<<7) == 0 {
+		t.Errorf("expected the playing bit in the status, got 0x%02x", status)
+	}
+	if cdrom.ReadState.IsPlaying() {
+		t.Error("expected the playback to stop at the end of the track")
+	}
+}
+
+func TestCddaForward(t *testing.T) {
+	cdrom, th, irqState := playTestCdda(t, 0x01)
+	runCdRomSectors(cdrom, th, irqState, 2)
+
+	sendCdRomCommand(cdrom, th, 0x04)
+	if code, _ := waitCdRomIrq(t, cdrom, th, irqState); code != IRQ_CODE_OK {
+		t.Fatalf("expected Forward to be accepted, got INT%d", code)
+	}
+	start := cdrom.Position.SectorIndex()
+	runCdRomSectors(cdrom, th, irqState, 4)
+
+	moved := cdrom.Position.SectorIndex() - start
+	if moved < 3*CDDA_SCAN_SECTORS || moved%CDDA_SCAN_SECTORS != 0 {
+		t.Errorf("expected to skip %d sectors at a time, moved %d sectors", CDDA_SCAN_SECTORS, moved)
+	}
+}
+
+// Rewinding past the start of the disc continues playing from there
+func TestCddaBackward(t *testing.T) {
+	cdrom, th, irqState := playTestCdda(t, 0x01)
+	runCdRomSectors(cdrom, th, irqState, 2)
+
+	sendCdRomCommand(cdrom, th, 0x05)
+	if code, _ := waitCdRomIrq(t, cdrom, th, irqState); code != IRQ_CODE_OK {
+		t.Fatalf("expected Backward to be accepted, got INT%d", code)
+	}
+	runCdRomSectors(cdrom, th, irqState, 10)
+
+	if index := cdrom.Position.SectorIndex(); cdrom.Scan != 0 || index <= LEAD_IN_SECTORS || index > LEAD_IN_SECTORS+10 {
+		t.Errorf("expected to play normally from the start, at sector %d with scan %d", index, cdrom.Scan)
+	}
+	if !cdrom.ReadState.IsPlaying() {
+		t.Error("expected to keep playing")
+	}
+}
+
+// Forward and Backward are rejected unless the drive is playing
+func TestCddaScanNotPlaying(t *testing.T) {
+	cdrom := NewCdRom(newTestCddaDisc(t))
+	th, irqState := NewTimeHandler(), NewIrqState()
+
+	for _, cmd := range []uint8{0x04, 0x05} {
+		sendCdRomCommand(cdrom, th, cmd)
+		if code, response := waitCdRomIrq(t, cdrom, th, irqState); code != IRQ_CODE_ERROR || response[1] != 0x80 {
+			t.Errorf("0x%02x: expected a not ready error, got INT%d %x", cmd, code, response)
+		}
+	}
+}
@@ -1,39 +1,51 @@
 package emulator
 
-import "fmt"
-
 // CD-ROM controller
 type CdRom struct {
-	Index              uint8      // Some registers can change depending on the index
-	HostParams         *FIFO      // FIFO storing the command arguments
-	HostResponse       *FIFO      // FIFO storing command responses
-	Command            *uint8     // Pending command number, can be nil
-	IrqFlags           uint8      // 5 bit interrupt flags, low 3 bits are a sub-CPU interrupt
-	IrqMask            uint8      // 5 bit interrupt mask
-	RxBuffer           [2352]byte // RX data buffer
-	Sector             *XaSector  // Disc image sector
-	RxActive           bool       // True when want to read sector data
-	SubCpu             *SubCpu    // The controllers' sub-CPU
-	RxIndex            uint16     // Index of the next RX sector byte
-	RxLen              uint16     // RX sector last byte index
-	ReadState          *ReadState // CD read state
-	ReadPending        bool       // True if a sector read needs to be notified
-	Disc               *Disc      // Currently loaded disc, can be nil
-	SeekTargetPending  bool       // True if a seek is waiting to be executed
-	SeekTarget         *Msf       // Next seek command target
-	Position           *Msf       // Current read position
-	DoubleSpeed        bool       // If true, 150 sectors per second, else 75 sectorss
-	XaAdpcmToSpu       bool       // If true, ADPCM samples are sent to the SPU
-	ReadWholeSector    bool       // Reads 0x924 bytes of the sector if true, 0x800 if false
-	SectorSizeOverride bool       // If true, overrides the regular sector size
-	CddaMode           bool       // Whether the CD-DA mode is enabled
-	Autopause          bool       // Whether to pause at the end of the track
-	ReportInterrupts   bool       // Whether to generate interrupts for each CD-DA sector
-	FilterEnabled      bool       // Whether the ADPCM filter is enabled
-	FilterFile         uint8      // Which file numbers should be processed (filter)
-	FilterChannel      uint8      // Which channel numbers should be processed (filter)
-	Mixer              *Mixer     // CD-DA audio mixer (connected to the SPU)
-	Rand               *CdRomRng  // Pseudo-random CD timings RNG
+	Index              uint8           // Some registers can change depending on the index
+	HostParams         *FIFO           // FIFO storing the command arguments
+	HostResponse       *FIFO           // FIFO storing command responses
+	Command            *uint8          // Pending command number, can be nil
+	LastCommand        uint8           // Last command written by the CPU
+	IrqFlags           uint8           // 5 bit interrupt flags, low 3 bits are a sub-CPU interrupt
+	IrqMask            uint8           // 5 bit interrupt mask
+	RxBuffer           [2352]byte      // RX data buffer
+	Sector             *XaSector       // Last read data sector, can be nil
+	RxActive           bool            // True when want to read sector data
+	SubCpu             *SubCpu         // The controllers' sub-CPU
+	RxIndex            uint16          // Index of the next RX sector byte
+	RxLen              uint16          // RX sector last byte index
+	ReadState          *ReadState      // CD read state
+	ReadPending        bool            // True if a sector read needs to be notified
+	Disc               *Disc           // Currently loaded disc, can be nil
+	SeekTargetPending  bool            // True if a seek is waiting to be executed
+	SeekTarget         *Msf            // Next seek command target
+	Position           *Msf            // Current read position
+	DoubleSpeed        bool            // If true, 150 sectors per second, else 75 sectorss
+	XaAdpcmToSpu       bool            // If true, ADPCM samples are sent to the SPU
+	ReadWholeSector    bool            // Reads 0x924 bytes of the sector if true, 0x800 if false
+	SectorSizeOverride bool            // If true, overrides the regular sector size
+	CddaMode           bool            // Whether the CD-DA mode is enabled
+	Autopause          bool            // Whether to pause at the end of the track
+	ReportInterrupts   bool            // Whether to generate interrupts for each CD-DA sector
+	FilterEnabled      bool            // Whether the ADPCM filter is enabled
+	FilterFile         uint8           // Which file numbers should be processed (filter)
+	FilterChannel      uint8           // Which channel numbers should be processed (filter)
+	Mixer              *Mixer          // CD-DA audio mixer (connected to the SPU)
+	Rand               *CdRomRng       // Pseudo-random CD timings RNG
+	MotorOn            bool            // Whether the spindle motor is on
+	SpinUpTimer        uint32          // Cycles until the motor is at speed, see MotorState
+	Seeking            bool            // True while the head moves to a new position
+	Timings            CdRomTimings    // Timings of the drive mechanics, see ParseCdRomTimings
+	Scan               int             // CD-DA scan direction (1: Forward, -1: Backward, 0: normal playback)
+	PendingReport      []byte          // CD-DA position report that needs to be notified, can be nil
+	XaDecoder          *XaAdpcmDecoder // XA-ADPCM decoder
+	Lid                LidState        // Whether the lid is open
+	LidTimer           uint32          // Cycles until the lid closes, 0 if it stays open
+	NextDisc           *Disc           // Disc inserted when the lid closes, can be nil
+	ShellOpened        bool            // Set when the lid opens, cleared by GetStat after it closes
+	SeekError          bool            // Set by a seek or read outside of the disc, see FailSeek
+	Deterministic      bool            // See SetDeterministic
 }
 
 // Returns a new CdRom instance
@@ -41,7 +53,6 @@ func NewCdRom(disc *Disc) *CdRom {
 	return &CdRom{
 		HostParams:      NewFIFO(),
 		HostResponse:    NewFIFO(),
-		Sector:          NewXaSector(),
 		Disc:            disc,
 		SubCpu:          NewSubCpu(),
 		ReadState:       NewReadState(),
@@ -50,6 +61,9 @@ func NewCdRom(disc *Disc) *CdRom {
 		ReadWholeSector: true,
 		Mixer:           NewMixer(),
 		Rand:            NewCdRomRng(),
+		MotorOn:         true,
+		Timings:         DefaultCdRomTimings(),
+		XaDecoder:       NewXaAdpcmDecoder(),
 	}
 }
 
@@ -71,9 +85,9 @@ func (cdrom *CdRom) Load(offset uint32,
 		return uint32(cdrom.HostStatus())
 	case 1: // RESULT register
 		if cdrom.HostResponse.IsEmpty() {
-			fmt.Println("cdrom: RESULT register read with empty response FIFO")
+			Log.Warnf(LOG_MODULE_CDROM, "RESULT register read with empty response FIFO")
 		}
-		fmt.Println("RESULT read")
+		Log.Debugf(LOG_MODULE_CDROM, "RESULT read")
 		return uint32(cdrom.HostResponse.Pop())
 	case 3:
 		switch index {
@@ -111,7 +125,7 @@ func (cdrom *CdRom) Store(
 		case 0:
 			cdrom.SetCommand(val, th)
 		case 3: // ATV2 register
-			cdrom.Mixer.CdRightToSpuRight = val
+			cdrom.Mixer.Pending[2] = val
 		default:
 			panic("cdrom: not implemented")
 		}
@@ -122,9 +136,9 @@ func (cdrom *CdRom) Store(
 		case 1:
 			cdrom.SetHostInterruptMask(val)
 		case 2: // ATV0 register
-			cdrom.Mixer.CdLeftToSpuLeft = val
+			cdrom.Mixer.Pending[0] = val
 		case 3: // ATV3 register
-			cdrom.Mixer.CdRightToSpuLeft = val
+			cdrom.Mixer.Pending[3] = val
 		default:
 			panic("cdrom: not implemented")
 		}
@@ -135,9 +149,9 @@ func (cdrom *CdRom) Store(
 		case 1:
 			cdrom.HostClipClearControl(val, th)
 		case 2: // ATV1 register
-			cdrom.Mixer.CdLeftToSpuRight = val
-		case 3:
-			fmt.Printf("cdrom: mixer apply 0x%x\n", val)
+			cdrom.Mixer.Pending[1] = val
+		case 3: // ADPCTL register
+			cdrom.Mixer.Apply(val)
 		default:
 			panic("cdrom: not implemented")
 		}
@@ -180,8 +194,8 @@ func (cdrom *CdRom) Sync(th *TimeHandler, irqState *IrqState) {
 			}
 		}
 
-		// handle sector reads
-		if cdrom.ReadState.IsReading() {
+		// handle sector reads and CD-DA playback
+		if !cdrom.ReadState.IsIdle() {
 			delay := cdrom.ReadState.Delay
 
 			if delay > elapsed {
@@ -189,15 +203,27 @@ func (cdrom *CdRom) Sync(th *TimeHandler, irqState *IrqState) {
 			} else {
 				leftover := elapsed - delay
 
-				// read sector
-				cdrom.ReadSector()
+				// read or play sector, the seek is over
+				if cdrom.ReadState.IsReading() {
+					cdrom.ReadSector()
+				} else {
+					cdrom.PlaySector()
+				}
+				cdrom.Seeking = false
 				cdrom.MaybeNotifyRead(th)
 
-				// set next sector read delay
-				cdrom.ReadState.Delay = cdrom.CyclesPerSector() - leftover
+				// set next sector read delay, CD-DA has to play at a
+				// steady rate
+				if cdrom.ReadState.IsReading() {
+					cdrom.ReadState.Delay = cdrom.SectorDelay() - leftover
+				} else if cdrom.ReadState.IsPlaying() {
+					cdrom.ReadState.Delay = cdrom.CyclesPerSector() - leftover
+				}
 			}
 		}
 
+		cdrom.TickMotor(elapsed)
+		cdrom.TickLid(elapsed)
 		remainingCycles -= elapsed
 	}
 
@@ -220,9 +246,12 @@ func (cdrom *CdRom) PredictNextSync(th *TimeHandler) {
 		}
 	}
 
-	if cdrom.ReadState.IsReading() {
+	if !cdrom.ReadState.IsIdle() {
 		th.MaybeSetNextSyncDelta(PERIPHERAL_CDROM, uint64(cdrom.ReadState.Delay))
 	}
+	if cdrom.IsLidOpen() && cdrom.LidTimer != 0 {
+		th.MaybeSetNextSyncDelta(PERIPHERAL_CDROM, uint64(cdrom.LidTimer))
+	}
 }
 
 // Read a word from the RX buffer
@@ -248,25 +277,43 @@ func (cdrom *CdRom) HostStatus() uint8 {
 	return r
 }
 
-// COMMAND register write
+// COMMAND register write. A command written while another one is pending
+// replaces it if the sub-CPU didn't execute it yet, and is ignored if it did
 func (cdrom *CdRom) SetCommand(val uint8, th *TimeHandler) {
 	if cdrom.Command != nil {
-		panic("cdrom: nested command")
+		pending := *cdrom.Command
+		if cdrom.IsCommandExecuted() {
+			Log.Warnf(LOG_MODULE_CDROM, "%s (0x%02x) ignored while %s (0x%02x) is busy",
+				CDROM_COMMAND_NAMES[val], val, CDROM_COMMAND_NAMES[pending], pending)
+			return
+		}
+		Log.Warnf(LOG_MODULE_CDROM, "%s (0x%02x) replaces the pending %s (0x%02x)",
+			CDROM_COMMAND_NAMES[val], val, CDROM_COMMAND_NAMES[pending], pending)
 	}
 
 	v := val
 	cdrom.Command = &v
+	cdrom.LastCommand = val
 	cdrom.MaybeStartCommand(th)
 }
 
-// PARAMETER register write
-func (cdrom *CdRom) SetParameter(val uint8) {
-	if cdrom.Command != nil {
-		panic("cdrom: attempted to push parameter while in command")
+// Returns true if the sub-CPU already ran the pending command and is
+// sending its response
+func (cdrom *CdRom) IsCommandExecuted() bool {
+	switch cdrom.SubCpu.Sequence {
+	case SUBCPU_IDLE, SUBCPU_COMMANDPENDING, SUBCPU_PARAMPUSH:
+		return false
 	}
+	return true
+}
+
+// PARAMETER register write. The FIFO holds 16 bytes, more parameters wrap
+// around and overwrite the first ones, the command then fails with a wrong
+// number of parameters. Parameters written during a command are sent to
+// the sub-CPU if it's still receiving them
+func (cdrom *CdRom) SetParameter(val uint8) {
 	if cdrom.HostParams.IsFull() {
-		// FIXME: this should wrap around the parameter FIFO
-		panic("cdrom: parameter FIFO overflow")
+		Log.Warnf(LOG_MODULE_CDROM, "parameter FIFO overflow")
 	}
 
 	cdrom.HostParams.Push(val)
@@ -275,7 +322,7 @@ func (cdrom *CdRom) SetParameter(val uint8) {
 // HINTMSK register write
 func (cdrom *CdRom) SetHostInterruptMask(val uint8) {
 	if val&0x18 != 0 {
-		fmt.Printf("cdrom: unhandled HINTMSK mask 0x%x\n", val)
+		Log.Warnf(LOG_MODULE_CDROM, "unhandled HINTMSK mask 0x%x", val)
 	}
 
 	cdrom.IrqMask = val & 0x1f
@@ -315,6 +362,10 @@ func (cdrom *CdRom) SetHostChipControl(val uint8) {
 }
 
 func (cdrom *CdRom) IrqAck(v uint8, th *TimeHandler) {
+	// the drive leaves the error state when the error is acknowledged
+	if IrqCode(cdrom.IrqFlags&7) == IRQ_CODE_ERROR && cdrom.IrqFlags&^v&7 == 0 {
+		cdrom.SeekError = false
+	}
 	cdrom.IrqFlags &= ^v
 
 	cdrom.MaybeStartCommand(th)
@@ -338,7 +389,7 @@ func (cdrom *CdRom) MaybeProcessAsyncResponse(th *TimeHandler) {
 	subcpu := cdrom.SubCpu
 	if subcpu.AsyncResponse.IsReady() && cdrom.IrqFlags == 0 && !subcpu.IsInCommand() {
 		// run response sequcne
-		handler := subcpu.AsyncResponse.Handler
+		handler := cdrom.asyncResponseHandler(subcpu.AsyncResponse.Type)
 		subcpu.AsyncResponse.Reset()
 		subcpu.Response.Clear()
 
@@ -352,17 +403,51 @@ func (cdrom *CdRom) MaybeProcessAsyncResponse(th *TimeHandler) {
 	}
 }
 
+// Returns the method that sends an async response
+func (cdrom *CdRom) asyncResponseHandler(response AsyncResponseType) AsyncResponseHandler {
+	switch response {
+	case ASYNC_RESPONSE_DATA_END:
+		return cdrom.AsyncDataEnd
+	case ASYNC_RESPONSE_STOP:
+		return cdrom.AsyncStop
+	case ASYNC_RESPONSE_PAUSE:
+		return cdrom.AsyncPause
+	case ASYNC_RESPONSE_INIT:
+		return cdrom.AsyncInit
+	case ASYNC_RESPONSE_MOTOR_ON:
+		return cdrom.AsyncMotorOn
+	case ASYNC_RESPONSE_SET_SESSION:
+		return cdrom.AsyncSetSession
+	case ASYNC_RESPONSE_SEEKL:
+		return cdrom.AsyncSeekL
+	case ASYNC_RESPONSE_READ_TOC:
+		return cdrom.AsyncReadToc
+	case ASYNC_RESPONSE_GET_ID:
+		return cdrom.AsyncGetId
+	case ASYNC_RESPONSE_SEEK_ERROR:
+		return cdrom.AsyncSeekError
+	}
+	panicFmt("cdrom: unknown async response %d", response)
+	return nil
+}
+
 func (cdrom *CdRom) MaybeNotifyRead(th *TimeHandler) {
 	subcpu := cdrom.SubCpu
-	if cdrom.ReadPending && cdrom.IrqFlags == 0 && !subcpu.IsInCommand() {
+	pending := cdrom.ReadPending || cdrom.PendingReport != nil
+	if pending && cdrom.IrqFlags == 0 && !subcpu.IsInCommand() {
 		subcpu.Response.Clear()
 		subcpu.IrqCode = IRQ_CODE_SECTOR_READY
 
-		cdrom.PushStatus()
+		if cdrom.ReadPending {
+			cdrom.PushStatus()
+		} else {
+			subcpu.Response.PushSlice(cdrom.PendingReport)
+		}
 		subcpu.Sequence = SUBCPU_ASYNCRXPUSH
 		subcpu.Timer = TIMING_READ_RX_PUSH
 
 		cdrom.ReadPending = false
+		cdrom.PendingReport = nil
 		cdrom.PredictNextSync(th)
 	}
 }
@@ -393,7 +478,7 @@ func (cdrom *CdRom) NextSubCpuStep(irqState *IrqState) {
 func (cdrom *CdRom) HandleSubCpuAsyncRxPush(subcpu *SubCpu) {
 	b := subcpu.Response.Pop()
 	cdrom.HostResponse.Push(b)
-	fmt.Println("push")
+	Log.Debugf(LOG_MODULE_CDROM, "response byte 0x%02x pushed", b)
 
 	if subcpu.Response.IsEmpty() {
 		subcpu.Timer = TIMING_IRQ_DELAY
@@ -421,7 +506,7 @@ func (cdrom *CdRom) HandleSubCpuBusyDelay(subcpu *SubCpu) {
 func (cdrom *CdRom) HandleSubCpuRx(subcpu *SubCpu) {
 	b := subcpu.Response.Pop()
 	cdrom.HostResponse.Push(b)
-	fmt.Println("push")
+	Log.Debugf(LOG_MODULE_CDROM, "response byte 0x%02x pushed", b)
 
 	if subcpu.Response.IsEmpty() {
 		subcpu.Timer = TIMING_BUSY_DELAY
@@ -506,9 +591,21 @@ func (cdrom *CdRom) ReadSector() {
 		panic("cdrom: attempted to read sector without a disc")
 	}
 
-	sector, err := disc.ReadSector(position)
+	sector, err := disc.ReadDataSector(position)
 	if err != nil {
-		panicFmt("cdrom: couldn't read sector: %s", err)
+		// past the end of the disc or of the image
+		Log.Warnf(LOG_MODULE_CDROM, "couldn't read sector: %s", err)
+		cdrom.FailSeek()
+		return
+	}
+
+	cdrom.Sector = sector
+
+	// XA-ADPCM sectors are sent to the mixer instead of the CPU
+	if cdrom.XaAdpcmToSpu && sector.IsAudio() {
+		cdrom.PlayXaSector(sector)
+		cdrom.NextPosition()
+		return
 	}
 
 	var data []byte
@@ -522,7 +619,7 @@ func (cdrom *CdRom) ReadSector() {
 		}
 		if len(data) > 2048 {
 			// mode 2 form 2 sector, should only be read with ReadWholeSector?
-			fmt.Println("cdrom: partial mode 2 form 2 sector read")
+			Log.Warnf(LOG_MODULE_CDROM, "partial mode 2 form 2 sector read")
 			data = data[0:2048]
 		}
 	}
@@ -530,13 +627,31 @@ func (cdrom *CdRom) ReadSector() {
 	// copy data into the RX buffer
 	copy(cdrom.RxBuffer[:], data)
 
-	// go to the next position
+	cdrom.NextPosition()
+	cdrom.ReadPending = true
+}
+
+// Moves the read position to the next sector
+func (cdrom *CdRom) NextPosition() {
 	next, err := cdrom.Position.Next()
 	if err != nil {
-		panicFmt("cdrom: msf: %s", err)
+		Log.Warnf(LOG_MODULE_CDROM, "msf: %s", err)
+		cdrom.FailSeek()
+		return
 	}
 	cdrom.Position = next
-	cdrom.ReadPending = true
+}
+
+// Decodes an XA-ADPCM sector and sends it to the mixer. If the filter is
+// enabled, only sectors with a matching file and channel number are played
+func (cdrom *CdRom) PlayXaSector(sector *XaSector) {
+	if cdrom.FilterEnabled &&
+		(sector.File() != cdrom.FilterFile || sector.Channel() != cdrom.FilterChannel) {
+		return
+	}
+
+	samples := cdrom.XaDecoder.DecodeSector(sector)
+	cdrom.Mixer.MixXa(samples)
 }
 
 // Runs the command in `cdrom.Command`
@@ -554,8 +669,18 @@ func (cdrom *CdRom) ExecuteCommand() {
 		minParam, maxParam, handler = 0, 0, cdrom.CommandGetStat
 	case 0x02:
 		minParam, maxParam, handler = 3, 3, cdrom.CommandSetLoc
+	case 0x03:
+		minParam, maxParam, handler = 0, 1, cdrom.CommandPlay
+	case 0x04:
+		minParam, maxParam, handler = 0, 0, cdrom.CommandForward
+	case 0x05:
+		minParam, maxParam, handler = 0, 0, cdrom.CommandBackward
 	case 0x06:
 		minParam, maxParam, handler = 0, 0, cdrom.CommandRead
+	case 0x07:
+		minParam, maxParam, handler = 0, 0, cdrom.CommandMotorOn
+	case 0x08:
+		minParam, maxParam, handler = 0, 0, cdrom.CommandStop
 	case 0x09:
 		minParam, maxParam, handler = 0, 0, cdrom.CommandPause
 	case 0x0a:
@@ -570,8 +695,16 @@ func (cdrom *CdRom) ExecuteCommand() {
 		minParam, maxParam, handler = 1, 1, cdrom.CommandSetMode
 	case 0x0f:
 		minParam, maxParam, handler = 0, 0, cdrom.CommandGetParam
+	case 0x10:
+		minParam, maxParam, handler = 0, 0, cdrom.CommandGetLocL
 	case 0x11:
 		minParam, maxParam, handler = 0, 0, cdrom.CommandGetLocP
+	case 0x12:
+		minParam, maxParam, handler = 1, 1, cdrom.CommandSetSession
+	case 0x13:
+		minParam, maxParam, handler = 0, 0, cdrom.CommandGetTN
+	case 0x14:
+		minParam, maxParam, handler = 1, 1, cdrom.CommandGetTD
 	case 0x15:
 		minParam, maxParam, handler = 0, 0, cdrom.CommandSeekL
 	case 0x19:
@@ -588,10 +721,25 @@ func (cdrom *CdRom) ExecuteCommand() {
 
 	paramsLen := cdrom.SubCpu.Params.Length()
 	if paramsLen < minParam || paramsLen > maxParam {
-		panicFmt(
-			"cdrom: unexpected amount of params for 0x%x (expected %d-%d params, got %d)",
+		Log.Warnf(
+			LOG_MODULE_CDROM,
+			"unexpected amount of params for 0x%x (expected %d-%d params, got %d)",
 			cmd, minParam, maxParam, paramsLen,
 		)
+		// wrong number of parameters
+		cdrom.PushError(0x20)
+		return
+	}
+
+	if cdrom.IsLidOpen() && !CommandWorksWithLidOpen(cmd) {
+		// drive door opened
+		cdrom.PushError(0x08)
+		return
+	}
+	if cdrom.Disc == nil && CommandNeedsDisc(cmd) {
+		// no disc (stat 0x11)
+		cdrom.PushError(0x80)
+		return
 	}
 
 	handler()
@@ -600,6 +748,11 @@ func (cdrom *CdRom) ExecuteCommand() {
 // Get status byte
 func (cdrom *CdRom) CommandGetStat() {
 	cdrom.PushStatus()
+
+	// the shell open bit is only cleared after the lid is closed
+	if !cdrom.IsLidOpen() {
+		cdrom.ShellOpened = false
+	}
 }
 
 func (cdrom *CdRom) CommandSetLoc() {
@@ -607,7 +760,14 @@ func (cdrom *CdRom) CommandSetLoc() {
 	s := cdrom.SubCpu.Params.Pop()
 	f := cdrom.SubCpu.Params.Pop()
 
-	cdrom.SeekTarget = MsfFromBcd(m, s, f)
+	target := &Msf{m, s, f}
+	if !target.IsValid() {
+		// invalid parameter
+		cdrom.PushError(0x10)
+		return
+	}
+
+	cdrom.SeekTarget = target
 	cdrom.SeekTargetPending = true
 	cdrom.PushStatus()
 }
@@ -615,29 +775,119 @@ func (cdrom *CdRom) CommandSetLoc() {
 // Start read sequence
 func (cdrom *CdRom) CommandRead() {
 	if cdrom.ReadState.IsReading() {
-		fmt.Println("cdrom: read while already reading")
+		Log.Warnf(LOG_MODULE_CDROM, "read while already reading")
 	}
+	// the first sector comes after the seek and the spin-up
+	readDelay := cdrom.CyclesPerSector()
 	if cdrom.SeekTargetPending {
+		readDelay += cdrom.SeekTime(cdrom.SeekTarget)
+		cdrom.Seeking = true
 		cdrom.DoSeek()
+	} else {
+		readDelay += cdrom.SpinUpDelay()
 	}
 
-	readDelay := cdrom.CyclesPerSector()
+	cdrom.StartMotor()
 	cdrom.ReadState.MakeReading(readDelay)
 	cdrom.PushStatus()
 }
 
+// Start CD-DA playback. The optional parameter is the track number (BCD),
+// if it's missing or 0, playback starts at the SetLoc position
+func (cdrom *CdRom) CommandPlay() {
+	disc := cdrom.GetDiscOrPanic()
+
+	var number uint8
+	if !cdrom.SubCpu.Params.IsEmpty() {
+		number = fromBcd(cdrom.SubCpu.Params.Pop())
+	}
+
+	playDelay := cdrom.CyclesPerSector()
+	if number != 0 {
+		track := disc.TrackByNumber(number)
+		if track == nil {
+			// invalid parameter
+			cdrom.PushError(0x10)
+			return
+		}
+
+		pos, err := MsfFromIndex(track.Start)
+		if err != nil {
+			panicFmt("cdrom: msf: %s", err)
+		}
+		playDelay += cdrom.SeekTime(pos)
+		cdrom.Seeking = true
+		cdrom.Position = pos
+		cdrom.SeekTargetPending = false
+	} else if cdrom.SeekTargetPending {
+		playDelay += cdrom.SeekTime(cdrom.SeekTarget)
+		cdrom.Seeking = true
+		cdrom.DoSeek()
+	} else {
+		playDelay += cdrom.SpinUpDelay()
+	}
+
+	cdrom.StartMotor()
+	cdrom.Scan = 0
+	cdrom.ReadState.MakePlaying(playDelay)
+	cdrom.PushStatus()
+}
+
+// Fast forward while playing
+func (cdrom *CdRom) CommandForward() {
+	cdrom.StartScan(1)
+}
+
+// Rewind while playing
+func (cdrom *CdRom) CommandBackward() {
+	cdrom.StartScan(-1)
+}
+
+// Starts scanning in `direction`, only works while playing
+func (cdrom *CdRom) StartScan(direction int) {
+	if !cdrom.ReadState.IsPlaying() {
+		// cannot respond yet
+		cdrom.PushError(0x80)
+		return
+	}
+
+	cdrom.Scan = direction
+	cdrom.PushStatus()
+}
+
+// Stops reading or playing and stops the motor
+func (cdrom *CdRom) CommandStop() {
+	cdrom.PushStatus()
+
+	cdrom.ReadState.MakeIdle()
+	cdrom.ReadPending = false
+	cdrom.PendingReport = nil
+	cdrom.Scan = 0
+	cdrom.Seeking = false
+	cdrom.StopMotor()
+
+	cdrom.SubCpu.ScheduleAsyncResponse(ASYNC_RESPONSE_STOP, TIMING_STOP)
+}
+
+// CommandStop response
+func (cdrom *CdRom) AsyncStop() uint32 {
+	cdrom.PushStatus()
+	return TIMING_STOP_RX_PUSH
+}
+
 // Stop reading sectors
 func (cdrom *CdRom) CommandPause() {
 	var asyncDelay uint32
 	if cdrom.ReadState.IsIdle() {
-		fmt.Println("cdrom: pause when not reading")
+		Log.Warnf(LOG_MODULE_CDROM, "pause when not reading")
 		asyncDelay = 9000
 	} else {
 		asyncDelay = 1000000
 	}
 
 	cdrom.ReadState.MakeIdle() // TODO: is this right?
-	cdrom.SubCpu.ScheduleAsyncResponse(cdrom.AsyncPause, asyncDelay)
+	cdrom.Seeking = false
+	cdrom.SubCpu.ScheduleAsyncResponse(ASYNC_RESPONSE_PAUSE, asyncDelay)
 	cdrom.PushStatus()
 }
 
@@ -651,7 +901,7 @@ func (cdrom *CdRom) CommandInit() {
 	cdrom.ReadState.MakeIdle()
 	cdrom.ReadPending = false
 
-	cdrom.SubCpu.ScheduleAsyncResponse(cdrom.AsyncInit, TIMING_INIT)
+	cdrom.SubCpu.ScheduleAsyncResponse(ASYNC_RESPONSE_INIT, TIMING_INIT)
 	cdrom.PushStatus()
 }
 
@@ -668,6 +918,14 @@ func (cdrom *CdRom) AsyncInit() uint32 {
 	cdrom.ReportInterrupts = false
 	cdrom.Autopause = false
 	cdrom.CddaMode = false
+	cdrom.Seeking = false
+	cdrom.SeekError = false
+	if cdrom.Disc != nil {
+		cdrom.StartMotor()
+	} else {
+		cdrom.StopMotor()
+	}
+	cdrom.Scan = 0
 
 	cdrom.PushStatus()
 	return TIMING_INIT_RX_PUSH
@@ -675,11 +933,13 @@ func (cdrom *CdRom) AsyncInit() uint32 {
 
 // Mute audio playback
 func (cdrom *CdRom) CommandMute() {
+	cdrom.Mixer.Muted = true
 	cdrom.PushStatus()
 }
 
 // Demute audio playback
 func (cdrom *CdRom) CommandDemute() {
+	cdrom.Mixer.Muted = false
 	cdrom.PushStatus()
 }
 
@@ -687,6 +947,7 @@ func (cdrom *CdRom) CommandDemute() {
 func (cdrom *CdRom) CommandSetFilter() {
 	cdrom.FilterFile = cdrom.SubCpu.Params.Pop()
 	cdrom.FilterChannel = cdrom.SubCpu.Params.Pop()
+	cdrom.XaDecoder.Reset()
 	cdrom.PushStatus()
 }
 
@@ -703,10 +964,7 @@ func (cdrom *CdRom) CommandSetMode() {
 	cdrom.XaAdpcmToSpu = (mode>>6)&1 != 0
 	cdrom.DoubleSpeed = (mode>>7)&1 != 0
 
-	if cdrom.CddaMode ||
-		cdrom.Autopause ||
-		cdrom.ReportInterrupts ||
-		cdrom.SectorSizeOverride {
+	if cdrom.SectorSizeOverride {
 		panicFmt("cdrom: unhandled mode 0x%x", mode)
 	}
 
@@ -736,44 +994,185 @@ func (cdrom *CdRom) CommandGetParam() {
 
 // Get current drive head position
 func (cdrom *CdRom) CommandGetLocP() {
-	if cdrom.Position.ToU32() < MsfFromBcd(0x00, 0x02, 0x00).ToU32() {
-		panic("cdrom: GetLocP in track 1's pregap")
+	disc := cdrom.GetDiscOrPanic()
+	index := cdrom.Position.SectorIndex()
+
+	var trackNumber, trackIndex uint8
+	var relative uint32
+	if track := disc.TrackAt(index); track != nil {
+		trackNumber = track.Number
+		if index < track.Start {
+			// pregap, the relative position counts down to the track start
+			relative = track.Start - index
+		} else {
+			trackIndex = 1
+			relative = index - track.Start
+		}
+	} else {
+		// lead-out area
+		trackNumber = 0xaa
 	}
-	panic("cdrom: GetLocP is not implemented") // TODO
+
+	rel, err := MsfFromIndex(relative)
+	if err != nil {
+		panicFmt("cdrom: msf: %s", err)
+	}
+
+	if trackNumber != 0xaa {
+		trackNumber = toBcd(trackNumber)
+	}
+	cdrom.SubCpu.Response.PushSlice([]byte{trackNumber, toBcd(trackIndex)})
+	cdrom.SubCpu.Response.PushSlice(rel.Slice())
+	cdrom.SubCpu.Response.PushSlice(cdrom.Position.Slice())
+}
+
+// Responds with the header and subheader of the last read data sector
+func (cdrom *CdRom) CommandGetLocL() {
+	if cdrom.Sector == nil || cdrom.ReadState.IsPlaying() {
+		// no data sector was read yet
+		cdrom.PushError(0x80)
+		return
+	}
+
+	// amm, ass, asect, mode, file, channel, submode, coding info
+	cdrom.SubCpu.Response.PushSlice(cdrom.Sector.Data[12:20])
+}
+
+// Spins up the motor
+func (cdrom *CdRom) CommandMotorOn() {
+	if cdrom.MotorOn {
+		// motor is already on
+		cdrom.PushError(0x20)
+		return
+	}
+
+	cdrom.PushStatus()
+	cdrom.StartMotor()
+	cdrom.SubCpu.ScheduleAsyncResponse(ASYNC_RESPONSE_MOTOR_ON, cdrom.SpinUpTimer+TIMING_MOTOR_ON)
+}
+
+// CommandMotorOn response
+func (cdrom *CdRom) AsyncMotorOn() uint32 {
+	cdrom.PushStatus()
+	return TIMING_MOTOR_ON_RX_PUSH
+}
+
+// Seeks to the start of a session. Multi-session discs aren't supported,
+// so only session 1 exists
+func (cdrom *CdRom) CommandSetSession() {
+	session := cdrom.SubCpu.Params.Pop()
+	if session != 1 {
+		// invalid parameter (0) or the session doesn't exist
+		cdrom.PushError(0x10)
+		return
+	}
+
+	cdrom.ReadState.MakeIdle()
+	cdrom.PushStatus()
+	cdrom.SubCpu.ScheduleAsyncResponse(ASYNC_RESPONSE_SET_SESSION, TIMING_SET_SESSION)
+}
+
+// CommandSetSession response
+func (cdrom *CdRom) AsyncSetSession() uint32 {
+	cdrom.Position = MsfFromBcd(0x00, 0x02, 0x00)
+	cdrom.PushStatus()
+	return TIMING_SET_SESSION_RX_PUSH
+}
+
+// Responds with the first and last track number
+func (cdrom *CdRom) CommandGetTN() {
+	disc := cdrom.GetDiscOrPanic()
+	first := disc.Tracks[0].Number
+	last := disc.Tracks[len(disc.Tracks)-1].Number
+
+	cdrom.PushStatus()
+	cdrom.SubCpu.Response.PushSlice([]byte{toBcd(first), toBcd(last)})
+}
+
+// Responds with the start of a track (minute and second). Track 0 is the
+// start of the lead-out area
+func (cdrom *CdRom) CommandGetTD() {
+	disc := cdrom.GetDiscOrPanic()
+	number := fromBcd(cdrom.SubCpu.Params.Pop())
+
+	var start uint32
+	if number == 0 {
+		start = disc.End()
+	} else {
+		track := disc.TrackByNumber(number)
+		if track == nil {
+			// invalid parameter
+			cdrom.PushError(0x10)
+			return
+		}
+		start = track.Start
+	}
+
+	msf, err := MsfFromIndex(start)
+	if err != nil {
+		panicFmt("cdrom: msf: %s", err)
+	}
+
+	cdrom.PushStatus()
+	cdrom.SubCpu.Response.PushSlice([]byte{msf.M, msf.S})
 }
 
 // Seek command, the target position is set by the previous SetLoc command
 func (cdrom *CdRom) CommandSeekL() {
-	// initial := cdrom.Position.ToU32()
-	// target := cdrom.SeekTarget.ToU32()
-
+	delay := cdrom.SeekTime(cdrom.SeekTarget)
 	cdrom.DoSeek()
+	cdrom.StartMotor()
+	cdrom.Seeking = true
 	cdrom.PushStatus()
 
-	cdrom.SubCpu.ScheduleAsyncResponse(cdrom.AsyncSeekL, 1000000)
-	/*
-		cdrom.SubCpu.ScheduleAsyncResponse(
-			cdrom.AsyncSeekL,
-			cdrom.CalcSeekTime(initial, target, true, false),
-		)
-	*/
+	cdrom.SubCpu.ScheduleAsyncResponse(ASYNC_RESPONSE_SEEKL, delay)
 }
 
 // SeekL async response
 func (cdrom *CdRom) AsyncSeekL() uint32 {
+	cdrom.Seeking = false
+	if !cdrom.IsOnDisc(cdrom.Position) {
+		cdrom.SeekError = true
+		return cdrom.AsyncSeekError()
+	}
+
 	cdrom.PushStatus()
 	return TIMING_SEEKL_RX_PUSH
 }
 
-// Execute a pending seek command
+// Execute a pending seek command. A target outside of the disc fails when
+// the head gets there: the next read or the SeekL response
 func (cdrom *CdRom) DoSeek() {
-	// don't seek to track 1's pregap
-	if cdrom.SeekTarget.ToU32() < MsfFromBcd(0x00, 0x02, 0x00).ToU32() {
-		panicFmt("cdrom: attempted to seek to track 1's pregap (%s)", cdrom.SeekTarget)
-	}
-
 	cdrom.Position = cdrom.SeekTarget
 	cdrom.SeekTargetPending = false
+	cdrom.SeekError = false
+}
+
+// Returns true if the sector at `msf` is on a track of the disc, not in the
+// lead-in or past the end of the last track
+func (cdrom *CdRom) IsOnDisc(msf *Msf) bool {
+	return cdrom.Disc != nil && cdrom.Disc.TrackAt(msf.SectorIndex()) != nil
+}
+
+// Stops reading or playing after a seek or a read outside of the disc. The
+// drive responds with a seek error (INT5) and keeps the seek error bit in
+// its status until the interrupt is acknowledged
+func (cdrom *CdRom) FailSeek() {
+	cdrom.ReadState.MakeIdle()
+	cdrom.Scan = 0
+	cdrom.Seeking = false
+	cdrom.SeekError = true
+
+	if !cdrom.SubCpu.IsAsyncCommandPending() {
+		cdrom.SubCpu.ScheduleAsyncResponse(ASYNC_RESPONSE_SEEK_ERROR, 0)
+	}
+}
+
+// FailSeek response
+func (cdrom *CdRom) AsyncSeekError() uint32 {
+	cdrom.SubCpu.Response.PushSlice([]byte{cdrom.DriveStatus(), 0x04})
+	cdrom.SubCpu.SetIrqCode(IRQ_CODE_ERROR)
+	return TIMING_SEEK_ERROR_RX_PUSH
 }
 
 // Test command, has a lot of subcommands
@@ -800,7 +1199,7 @@ func (cdrom *CdRom) CommandTest() {
 func (cdrom *CdRom) CommandReadToc() {
 	cdrom.PushStatus()
 	// TODO: should this stop ReadN/ReadS?
-	cdrom.SubCpu.ScheduleAsyncResponse(cdrom.AsyncReadToc, TIMING_READTOC_ASYNC)
+	cdrom.SubCpu.ScheduleAsyncResponse(ASYNC_RESPONSE_READ_TOC, TIMING_READTOC_ASYNC)
 }
 
 // Read table of contents
@@ -813,7 +1212,7 @@ func (cdrom *CdRom) AsyncReadToc() uint32 {
 func (cdrom *CdRom) CommandGetId() {
 	if cdrom.Disc != nil {
 		cdrom.PushStatus()
-		cdrom.SubCpu.ScheduleAsyncResponse(cdrom.AsyncGetId, TIMING_GET_ID_ASYNC)
+		cdrom.SubCpu.ScheduleAsyncResponse(ASYNC_RESPONSE_GET_ID, TIMING_GET_ID_ASYNC)
 	} else {
 		// no disc, pretend that the CD tray is open
 		cdrom.SubCpu.Response.Push(0x11)
@@ -824,7 +1223,12 @@ func (cdrom *CdRom) CommandGetId() {
 
 // Asynchronous GetId response
 func (cdrom *CdRom) AsyncGetId() uint32 {
-	disc := cdrom.GetDiscOrPanic()
+	if cdrom.Disc == nil {
+		// the lid was opened after the command
+		cdrom.PushError(0x08)
+		return TIMING_GET_ID_RX_PUSH
+	}
+	disc := cdrom.Disc
 
 	var regionByte byte
 	switch disc.Region {
@@ -867,9 +1271,15 @@ func (cdrom *CdRom) DriveStatus() byte {
 		// disc inserted
 		var r byte
 
-		isReading := cdrom.ReadState.IsReading()
-		r |= 1 << 1 // motor on
+		// only one of the reading, seeking and playing bits is set
+		isReading := cdrom.ReadState.IsReading() && !cdrom.Seeking
+		isPlaying := cdrom.ReadState.IsPlaying() && !cdrom.Seeking
+		r |= byte(oneIfTrue(cdrom.MotorState() == MOTOR_ON)) << 1
+		r |= byte(oneIfTrue(cdrom.SeekError)) << 2
+		r |= byte(oneIfTrue(cdrom.ShellOpened)) << 4
 		r |= byte(oneIfTrue(isReading)) << 5
+		r |= byte(oneIfTrue(cdrom.Seeking)) << 6
+		r |= byte(oneIfTrue(isPlaying)) << 7
 		return r
 	}
 
@@ -882,6 +1292,12 @@ func (cdrom *CdRom) PushStatus() {
 	cdrom.SubCpu.Response.Push(cdrom.DriveStatus())
 }
 
+// Responds with an error status and the error `code`
+func (cdrom *CdRom) PushError(code uint8) {
+	cdrom.SubCpu.Response.PushSlice([]byte{cdrom.DriveStatus() | 1, code})
+	cdrom.SubCpu.SetIrqCode(IRQ_CODE_ERROR)
+}
+
 func (cdrom *CdRom) CyclesPerSector() uint32 {
 	return (CPU_FREQ_HZ / 75) >> oneIfTrue(cdrom.DoubleSpeed)
 }
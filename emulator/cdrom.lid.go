@@ -0,0 +1,112 @@
+package emulator
+
+// CD-ROM lid (shell) state
+type LidState int
+
+const (
+	LID_CLOSED LidState = iota // Lid is closed
+	LID_OPEN   LidState = iota // Lid is open, there's no disc in the drive
+)
+
+// How long the lid stays open when swapping discs (~1 second)
+const LID_SWAP_CYCLES uint32 = CPU_FREQ_HZ
+
+// Opens the lid and removes the disc. Reading and playback are stopped
+func (cdrom *CdRom) OpenLid() {
+	cdrom.Lid = LID_OPEN
+	cdrom.LidTimer = 0
+	cdrom.ShellOpened = true
+
+	cdrom.ReadState.MakeIdle()
+	cdrom.ReadPending = false
+	cdrom.PendingReport = nil
+	cdrom.Scan = 0
+	cdrom.Seeking = false
+	cdrom.StopMotor()
+	cdrom.SeekTargetPending = false
+	cdrom.Disc = nil
+
+	// a response that wasn't sent yet is lost
+	subcpu := cdrom.SubCpu
+	subcpu.AsyncResponse.Reset()
+	if subcpu.Sequence == SUBCPU_ASYNCRXPUSH {
+		subcpu.Response.Clear()
+		subcpu.Sequence = SUBCPU_IDLE
+	}
+}
+
+// Inserts `disc` (can be nil) and closes the lid
+func (cdrom *CdRom) CloseLid(disc *Disc) {
+	cdrom.Lid = LID_CLOSED
+	cdrom.LidTimer = 0
+	cdrom.NextDisc = nil
+	cdrom.Disc = disc
+	if disc != nil {
+		disc.Deterministic = cdrom.Deterministic
+		// the drive spins up to read the new disc
+		cdrom.StartMotor()
+	}
+	cdrom.Position = MsfFromBcd(0x00, 0x02, 0x00)
+	cdrom.XaDecoder.Reset()
+}
+
+// Opens the lid, and inserts `disc` and closes the lid after
+// LID_SWAP_CYCLES, so the game can see that the lid was opened. The old
+// disc isn't closed
+func (cdrom *CdRom) SwapDisc(disc *Disc) {
+	cdrom.OpenLid()
+	cdrom.NextDisc = disc
+	cdrom.LidTimer = LID_SWAP_CYCLES
+}
+
+// Returns true if the lid is open
+func (cdrom *CdRom) IsLidOpen() bool {
+	return cdrom.Lid == LID_OPEN
+}
+
+// Counts down the lid timer, closes the lid when it expires
+func (cdrom *CdRom) TickLid(elapsed uint32) {
+	if cdrom.Lid != LID_OPEN || cdrom.LidTimer == 0 {
+		return
+	}
+
+	if cdrom.LidTimer > elapsed {
+		cdrom.LidTimer -= elapsed
+	} else {
+		cdrom.CloseLid(cdrom.NextDisc)
+	}
+}
+
+// Returns true if the command can run while the lid is open
+func CommandWorksWithLidOpen(cmd uint8) bool {
+	switch cmd {
+	case 0x01, // GetStat
+		0x0a, // Init
+		0x0b, // Mute
+		0x0c, // Demute
+		0x0d, // SetFilter
+		0x0e, // SetMode
+		0x0f, // GetParam
+		0x19, // Test
+		0x1a: // GetId
+		return true
+	}
+	return false
+}
+
+// Returns true if the command reads the disc, it fails if the lid was
+// closed without a disc
+func CommandNeedsDisc(cmd uint8) bool {
+	switch cmd {
+	case 0x03, // Play
+		0x06, // ReadN
+		0x11, // GetLocP
+		0x13, // GetTN
+		0x14, // GetTD
+		0x15, // SeekL
+		0x1b, // ReadS
+		0x1e: // ReadToc
+		return true
+	}
+	return false
+}
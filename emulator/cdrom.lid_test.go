@@ -0,0 +1,113 @@
+package emulator
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Swapping discs opens the lid for LID_SWAP_CYCLES. Commands that need the
+// disc fail while it's open and the shell open bit stays set until the
+// first GetStat after the lid is closed
+func TestCdRomSwapDisc(t *testing.T) {
+	cdrom := NewCdRom(newTestCddaDisc(t))
+	th, irqState := NewTimeHandler(), NewIrqState()
+	next, err := NewDisc(bytes.NewReader(newTestIsoImage(nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer next.Close()
+
+	sendCdRomCommand(cdrom, th, 0x03, 0x02)
+	expectCdRomIrq(t, cdrom, th, irqState, "Play", IRQ_CODE_OK)
+	runCdRomSectors(cdrom, th, irqState, 2)
+
+	cdrom.SwapDisc(next)
+	if !cdrom.IsLidOpen() || cdrom.Disc != nil || !cdrom.ReadState.IsIdle() || cdrom.MotorOn {
+		t.Fatal("expected opening the lid to remove the disc and stop the drive")
+	}
+
+	sendCdRomCommand(cdrom, th, 0x01)
+	if response := expectCdRomIrq(t, cdrom, th, irqState, "GetStat", IRQ_CODE_OK); response[0] != 0x10 {
+		t.Errorf("GetStat: expected the shell open bit, got %x", response)
+	}
+	for _, cmd := range []uint8{0x06, 0x03, 0x13, 0x15} {
+		sendCdRomCommand(cdrom, th, cmd)
+		if response := expectCdRomIrq(t, cdrom, th, irqState, "lid open", IRQ_CODE_ERROR); !bytes.Equal(response, []byte{0x11, 0x08}) {
+			t.Errorf("0x%02x: expected a door opened error, got %x", cmd, response)
+		}
+	}
+	sendCdRomCommand(cdrom, th, 0x1a)
+	if response := expectCdRomIrq(t, cdrom, th, irqState, "GetId", IRQ_CODE_ERROR); !bytes.Equal(response, []byte{0x11, 0x80}) {
+		t.Errorf("GetId: expected a no disc error, got %x", response)
+	}
+
+	// the lid closes by itself
+	runCdRomSectors(cdrom, th, irqState, int(LID_SWAP_CYCLES/cdrom.CyclesPerSector())+1)
+	if cdrom.IsLidOpen() || cdrom.Disc != next || !cdrom.MotorOn {
+		t.Fatal("expected the lid to close with the new disc and spin it up")
+	}
+	if !cdrom.Position.IsEqual(MsfFromBcd(0x00, 0x02, 0x00)) {
+		t.Errorf("expected the position to be reset, got %s", cdrom.Position)
+	}
+
+	sendCdRomCommand(cdrom, th, 0x01)
+	if response := expectCdRomIrq(t, cdrom, th, irqState, "GetStat", IRQ_CODE_OK); response[0]&0x10 == 0 {
+		t.Errorf("GetStat: expected the shell open bit after the lid closed, got %x", response)
+	}
+	sendCdRomCommand(cdrom, th, 0x01)
+	if response := expectCdRomIrq(t, cdrom, th, irqState, "GetStat", IRQ_CODE_OK); response[0]&0x10 != 0 {
+		t.Errorf("GetStat: expected the shell open bit to be cleared, got %x", response)
+	}
+
+	sendCdRomCommand(cdrom, th, 0x13)
+	if response := expectCdRomIrq(t, cdrom, th, irqState, "GetTN", IRQ_CODE_OK); !bytes.Equal(response[1:], []byte{0x01, 0x01}) {
+		t.Errorf("GetTN: expected the single track of the new disc, got %x", response)
+	}
+}
+
+// An open lid without a swap stays open until it's closed
+func TestCdRomOpenLid(t *testing.T) {
+	cdrom := NewCdRom(newTestCddaDisc(t))
+	th, irqState := NewTimeHandler(), NewIrqState()
+
+	cdrom.OpenLid()
+	runCdRomSectors(cdrom, th, irqState, int(LID_SWAP_CYCLES/cdrom.CyclesPerSector())*2)
+	if !cdrom.IsLidOpen() {
+		t.Fatal("expected the lid to stay open")
+	}
+
+	cdrom.CloseLid(nil)
+	for i := 0; i < 2; i++ {
+		sendCdRomCommand(cdrom, th, 0x01)
+		if response := expectCdRomIrq(t, cdrom, th, irqState, "GetStat", IRQ_CODE_OK); response[0] != 0x10 {
+			t.Errorf("GetStat: expected an empty drive to look open, got %x", response)
+		}
+	}
+
+	// commands that need a disc fail instead of stopping the emulator
+	for _, cmd := range [][]uint8{{0x03}, {0x06}, {0x11}, {0x13}, {0x14, 0x01}, {0x15}, {0x1e}} {
+		sendCdRomCommand(cdrom, th, cmd[0], cmd[1:]...)
+		if response := expectCdRomIrq(t, cdrom, th, irqState, "no disc", IRQ_CODE_ERROR); !bytes.Equal(response, []byte{0x11, 0x80}) {
+			t.Errorf("0x%02x: expected a no disc error, got %x", cmd[0], response)
+		}
+	}
+}
+
+// Opening the lid drops the second response of a command
+func TestCdRomOpenLidAsyncResponse(t *testing.T) {
+	cdrom := NewCdRom(newTestCddaDisc(t))
+	th, irqState := NewTimeHandler(), NewIrqState()
+
+	sendCdRomCommand(cdrom, th, 0x08)
+	expectCdRomIrq(t, cdrom, th, irqState, "Stop", IRQ_CODE_OK)
+	cdrom.OpenLid()
+
+	end := th.Cycles + uint64(TIMING_STOP)*2
+	for th.Cycles < end {
+		th.Tick(1000)
+		cdrom.Sync(th, irqState)
+		if cdrom.IrqFlags != 0 {
+			t.Fatalf("expected no response after the lid opened, got INT%d", cdrom.IrqFlags&7)
+		}
+	}
+}
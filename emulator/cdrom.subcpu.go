@@ -18,10 +18,29 @@ const (
 // Sub-CPU asynchronous command handler
 type AsyncResponseHandler func() uint32
 
-// Sub-CPU asynchronous command response
+// Second response of the commands that take a while, see
+// CdRom.asyncResponseHandler
+type AsyncResponseType uint8
+
+const (
+	ASYNC_RESPONSE_NONE        AsyncResponseType = iota // No response is pending
+	ASYNC_RESPONSE_DATA_END    AsyncResponseType = iota // End of the CD-DA playback
+	ASYNC_RESPONSE_STOP        AsyncResponseType = iota // Stop
+	ASYNC_RESPONSE_PAUSE       AsyncResponseType = iota // Pause
+	ASYNC_RESPONSE_INIT        AsyncResponseType = iota // Init
+	ASYNC_RESPONSE_MOTOR_ON    AsyncResponseType = iota // MotorOn
+	ASYNC_RESPONSE_SET_SESSION AsyncResponseType = iota // SetSession
+	ASYNC_RESPONSE_SEEKL       AsyncResponseType = iota // SeekL
+	ASYNC_RESPONSE_READ_TOC    AsyncResponseType = iota // ReadTOC
+	ASYNC_RESPONSE_GET_ID      AsyncResponseType = iota // GetID
+	ASYNC_RESPONSE_SEEK_ERROR  AsyncResponseType = iota // Seek or read outside of the disc
+)
+
+// Sub-CPU asynchronous command response. The handler is stored as a type
+// rather than a function so it can be saved in savestates
 type SubCpuResponse struct {
-	Delay   uint32               // Amount of CPU cycles before the handler should be ran
-	Handler AsyncResponseHandler // Command handler
+	Delay uint32            // Amount of CPU cycles before the handler should be ran
+	Type  AsyncResponseType // Pending response
 }
 
 func NewSubCpuResponse() *SubCpuResponse {
@@ -30,11 +49,11 @@ func NewSubCpuResponse() *SubCpuResponse {
 
 func (r *SubCpuResponse) Reset() {
 	r.Delay = 0
-	r.Handler = nil
+	r.Type = ASYNC_RESPONSE_NONE
 }
 
 func (r *SubCpuResponse) IsReady() bool {
-	return r.Handler != nil
+	return r.Type != ASYNC_RESPONSE_NONE
 }
 
 // The CD-ROM controllers' sub-CPU
@@ -67,9 +86,9 @@ func (scpu *SubCpu) IsInCommand() bool {
 	return scpu.Sequence != SUBCPU_IDLE
 }
 
-// Returns true if the async response handler is not nil
+// Returns true if an async response is pending
 func (scpu *SubCpu) IsAsyncCommandPending() bool {
-	return scpu.AsyncResponse.Handler != nil
+	return scpu.AsyncResponse.IsReady()
 }
 
 // Returns the busy flag state
@@ -100,9 +119,9 @@ func (scpu *SubCpu) StartCommand(delay uint32) {
 	scpu.IrqCode = IRQ_CODE_OK
 }
 
-func (scpu *SubCpu) ScheduleAsyncResponse(handler AsyncResponseHandler, delay uint32) {
-	if scpu.AsyncResponse.Handler != nil {
+func (scpu *SubCpu) ScheduleAsyncResponse(response AsyncResponseType, delay uint32) {
+	if scpu.AsyncResponse.IsReady() {
 		panic("subcpu: tried to schedule async response with another response pending")
 	}
-	scpu.AsyncResponse.Handler = handler
+	scpu.AsyncResponse.Type = response
 }
@@ -1,5 +1,11 @@
 package emulator
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 // TODO: test the timings
 
 const (
@@ -20,4 +26,187 @@ const (
 	TIMING_PAUSE_RX_PUSH             uint32 = 1700     // RX clear -> Pause response
 	TIMING_INIT_RX_PUSH              uint32 = 1700     // RX clear -> Init param push
 	TIMING_INIT                      uint32 = 900000   // CD-ROM init
+	TIMING_STOP                      uint32 = 13863626 // Stop -> motor stopped
+	TIMING_STOP_RX_PUSH              uint32 = 1700     // RX clear -> Stop response
+	TIMING_DATA_END_RX_PUSH          uint32 = 1700     // RX clear -> DataEnd response
+	TIMING_MOTOR_ON                  uint32 = 1000000  // Motor spun up -> MotorOn response
+	TIMING_MOTOR_ON_RX_PUSH          uint32 = 1700     // RX clear -> MotorOn response
+	TIMING_SET_SESSION               uint32 = 4000000  // SetSession -> seek to session done
+	TIMING_SET_SESSION_RX_PUSH       uint32 = 1700     // RX clear -> SetSession response
+	TIMING_SEEK_ERROR_RX_PUSH        uint32 = 1700     // RX clear -> seek error response
+	TIMING_SPIN_UP                   uint32 = 33868500 // Motor stopped -> full speed (1 second)
+	TIMING_FLAT_SEEK                 uint32 = 1000000  // Seek time without the seek model
+	TIMING_SECTOR_JITTER_SINGLE      uint32 = 3000     // Sector delivery jitter at single speed (+/-)
+	TIMING_SECTOR_JITTER_DOUBLE      uint32 = 1500     // Sector delivery jitter at double speed (+/-)
+)
+
+// Timings of the drive mechanics. The defaults follow the real drive, the
+// knobs help finding out if a game is sensitive to them
+type CdRomTimings struct {
+	// Cycles of every seek, or 0 to compute them from the distance with
+	// the seek model (see CalcSeekTime)
+	Seek   uint32
+	SpinUp uint32 // Cycles the motor takes to reach its speed from a stop
+	// Maximum cycles the delivery of a data sector is moved by, at single
+	// and double speed. The sectors still come at the same rate on average
+	JitterSingle uint32
+	JitterDouble uint32
+}
+
+// Returns the timings of the real drive
+func DefaultCdRomTimings() CdRomTimings {
+	return CdRomTimings{
+		SpinUp:       TIMING_SPIN_UP,
+		JitterSingle: TIMING_SECTOR_JITTER_SINGLE,
+		JitterDouble: TIMING_SECTOR_JITTER_DOUBLE,
+	}
+}
+
+// Parses CD-ROM timings: "default", "flat" (every seek takes
+// TIMING_FLAT_SEEK cycles, the motor doesn't spin up and the sectors come
+// at a fixed rate) or the default timings with changes, like
+// "seek=500000,spinup=0". The keys are seek, spinup, jitter (both speeds),
+// jitter1 and jitter2, the values are CPU cycles
+func ParseCdRomTimings(s string) (CdRomTimings, error) {
+	timings := DefaultCdRomTimings()
+	switch s {
+	case "", "default":
+		return timings, nil
+	case "flat":
+		return CdRomTimings{Seek: TIMING_FLAT_SEEK}, nil
+	}
+
+	for _, field := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return timings, fmt.Errorf("invalid CD-ROM timing \"%s\"", field)
+		}
+		cycles, err := strconv.ParseUint(value, 0, 32)
+		if err != nil {
+			return timings, fmt.Errorf("invalid cycles for CD-ROM timing %s: \"%s\"", key, value)
+		}
+		switch key {
+		case "seek":
+			timings.Seek = uint32(cycles)
+		case "spinup":
+			timings.SpinUp = uint32(cycles)
+		case "jitter":
+			timings.JitterSingle = uint32(cycles)
+			timings.JitterDouble = uint32(cycles)
+		case "jitter1":
+			timings.JitterSingle = uint32(cycles)
+		case "jitter2":
+			timings.JitterDouble = uint32(cycles)
+		default:
+			return timings, fmt.Errorf("unknown CD-ROM timing \"%s\"", key)
+		}
+	}
+	return timings, nil
+}
+
+// State of the spindle motor
+type MotorState int
+
+const (
+	MOTOR_STOPPED     MotorState = iota
+	MOTOR_SPINNING_UP MotorState = iota // Reads wait until it's at speed
+	MOTOR_ON          MotorState = iota
 )
+
+// Returns the name of the motor state
+func (state MotorState) String() string {
+	switch state {
+	case MOTOR_SPINNING_UP:
+		return "spinning up"
+	case MOTOR_ON:
+		return "on"
+	}
+	return "stopped"
+}
+
+// Returns the state of the spindle motor
+func (cdrom *CdRom) MotorState() MotorState {
+	switch {
+	case !cdrom.MotorOn:
+		return MOTOR_STOPPED
+	case cdrom.SpinUpTimer > 0:
+		return MOTOR_SPINNING_UP
+	}
+	return MOTOR_ON
+}
+
+// Starts the motor if it's stopped, it then takes Timings.SpinUp cycles to
+// reach its speed
+func (cdrom *CdRom) StartMotor() {
+	if !cdrom.MotorOn {
+		cdrom.MotorOn = true
+		cdrom.SpinUpTimer = cdrom.Timings.SpinUp
+	}
+}
+
+// Stops the motor right away
+func (cdrom *CdRom) StopMotor() {
+	cdrom.MotorOn = false
+	cdrom.SpinUpTimer = 0
+}
+
+// Counts down the spin-up of the motor
+func (cdrom *CdRom) TickMotor(elapsed uint32) {
+	if cdrom.SpinUpTimer > elapsed {
+		cdrom.SpinUpTimer -= elapsed
+	} else {
+		cdrom.SpinUpTimer = 0
+	}
+}
+
+// Returns the cycles it takes to seek from the current position to
+// `target`, including the spin-up of the motor if it isn't at speed
+func (cdrom *CdRom) SeekTime(target *Msf) uint32 {
+	if cdrom.Timings.Seek != 0 {
+		return cdrom.Timings.Seek + cdrom.SpinUpDelay()
+	}
+
+	paused := cdrom.MotorOn && cdrom.ReadState.IsIdle()
+	cycles := cdrom.CalcSeekTime(cdrom.Position.SectorIndex(), target.SectorIndex(), cdrom.MotorOn, paused)
+	if cdrom.MotorOn {
+		// CalcSeekTime only adds the spin-up of a stopped motor
+		cycles += cdrom.SpinUpTimer
+	}
+	return cycles
+}
+
+// Returns the cycles until the motor is at speed if it's started now
+func (cdrom *CdRom) SpinUpDelay() uint32 {
+	if !cdrom.MotorOn {
+		return cdrom.Timings.SpinUp
+	}
+	return cdrom.SpinUpTimer
+}
+
+// Returns the cycles until the next data sector, CyclesPerSector moved by
+// a random amount within the jitter of the speed (not in the deterministic
+// mode, see SetDeterministic)
+func (cdrom *CdRom) SectorDelay() uint32 {
+	cycles := cdrom.CyclesPerSector()
+	jitter := cdrom.Timings.JitterSingle
+	if cdrom.DoubleSpeed {
+		jitter = cdrom.Timings.JitterDouble
+	}
+	if jitter == 0 || jitter >= cycles || cdrom.Deterministic {
+		return cycles
+	}
+	return cycles - jitter + cdrom.Rand.Next()%(2*jitter+1)
+}
+
+// Turns the deterministic mode on or off. It drops the sector jitter, and
+// the inserted discs aren't read ahead or validated in the background, so
+// the emulation only depends on its state and the input. Used by movies,
+// see Console.SetDeterministic
+func (cdrom *CdRom) SetDeterministic(on bool) {
+	cdrom.Deterministic = on
+	for _, disc := range []*Disc{cdrom.Disc, cdrom.NextDisc} {
+		if disc != nil {
+			disc.Deterministic = on
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package emulator
+
+import "testing"
+
+func TestParseCdRomTimings(t *testing.T) {
+	timings, err := ParseCdRomTimings("seek=500000,spinup=0,jitter2=10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := DefaultCdRomTimings()
+	expected.Seek, expected.SpinUp, expected.JitterDouble = 500000, 0, 10
+	if timings != expected {
+		t.Errorf("expected %+v, got %+v", expected, timings)
+	}
+
+	if timings, _ := ParseCdRomTimings("flat"); timings != (CdRomTimings{Seek: TIMING_FLAT_SEEK}) {
+		t.Errorf("unexpected flat timings %+v", timings)
+	}
+	for _, s := range []string{"seek", "seek=fast", "speed=2"} {
+		if _, err := ParseCdRomTimings(s); err == nil {
+			t.Errorf("%s: expected an error", s)
+		}
+	}
+}
+
+// Seeks take longer with the distance and when the motor has to spin up
+func TestCdRomSeekTime(t *testing.T) {
+	cdrom := NewCdRom(nil)
+	cdrom.Position = MsfFromBcd(0x00, 0x02, 0x00)
+	near := cdrom.SeekTime(MsfFromBcd(0x00, 0x02, 0x05))
+	far := cdrom.SeekTime(MsfFromBcd(0x60, 0x00, 0x00))
+	if near >= far {
+		t.Errorf("expected a short seek to be faster, got %d and %d cycles", near, far)
+	}
+
+	cdrom.StopMotor()
+	if stopped := cdrom.SeekTime(MsfFromBcd(0x00, 0x02, 0x05)); stopped < TIMING_SPIN_UP {
+		t.Errorf("expected the seek to wait for the spin-up, got %d cycles", stopped)
+	}
+	cdrom.StartMotor()
+	if state := cdrom.MotorState(); state != MOTOR_SPINNING_UP {
+		t.Errorf("expected the motor to spin up, got %s", state)
+	}
+	cdrom.TickMotor(TIMING_SPIN_UP / 2)
+	if state := cdrom.MotorState(); state != MOTOR_SPINNING_UP {
+		t.Errorf("expected the motor to still spin up, got %s", state)
+	}
+	cdrom.TickMotor(TIMING_SPIN_UP)
+	if state := cdrom.MotorState(); state != MOTOR_ON {
+		t.Errorf("expected the motor to be on, got %s", state)
+	}
+
+	cdrom.Timings, _ = ParseCdRomTimings("flat")
+	if cycles := cdrom.SeekTime(MsfFromBcd(0x60, 0x00, 0x00)); cycles != TIMING_FLAT_SEEK {
+		t.Errorf("expected a flat seek time, got %d cycles", cycles)
+	}
+}
+
+// The sectors are moved by the jitter, but keep the same average rate
+func TestCdRomSectorDelay(t *testing.T) {
+	cdrom := NewCdRom(nil)
+	cdrom.DoubleSpeed = true
+	base := cdrom.CyclesPerSector()
+	jitter := cdrom.Timings.JitterDouble
+
+	var total uint64
+	seen := map[uint32]bool{}
+	const count = 10000
+	for i := 0; i < count; i++ {
+		delay := cdrom.SectorDelay()
+		if delay < base-jitter || delay > base+jitter {
+			t.Fatalf("expected %d +/- %d cycles, got %d", base, jitter, delay)
+		}
+		seen[delay] = true
+		total += uint64(delay)
+	}
+	if len(seen) < 100 {
+		t.Errorf("expected random delays, got %d different values", len(seen))
+	}
+	if average := total / count; average < uint64(base-jitter/10) || average > uint64(base+jitter/10) {
+		t.Errorf("expected an average of %d cycles, got %d", base, average)
+	}
+
+	cdrom.Timings.JitterDouble = 0
+	if delay := cdrom.SectorDelay(); delay != base {
+		t.Errorf("expected %d cycles without jitter, got %d", base, delay)
+	}
+}
+
+// The deterministic mode drops the jitter and the background disc work,
+// the discs inserted later get it too
+func TestCdRomDeterministic(t *testing.T) {
+	disc, next := newTestCddaDisc(t), newTestCddaDisc(t)
+	cdrom := NewCdRom(disc)
+	cdrom.SetDeterministic(true)
+	if !disc.Deterministic {
+		t.Error("expected the inserted disc to be deterministic")
+	}
+	for i := 0; i < 100; i++ {
+		if delay := cdrom.SectorDelay(); delay != cdrom.CyclesPerSector() {
+			t.Fatalf("expected %d cycles without jitter, got %d", cdrom.CyclesPerSector(), delay)
+		}
+	}
+
+	cdrom.SwapDisc(next)
+	cdrom.CloseLid(cdrom.NextDisc)
+	if !next.Deterministic {
+		t.Error("expected the swapped disc to be deterministic")
+	}
+	cdrom.SetDeterministic(false)
+	if next.Deterministic || cdrom.Deterministic {
+		t.Error("expected the deterministic mode to be off")
+	}
+}
@@ -1,9 +1,6 @@
 package emulator
 
-import (
-	"fmt"
-	"math"
-)
+import "math"
 
 // IRQ code used by the CD-ROM controller
 type IrqCode uint8
@@ -12,6 +9,7 @@ const (
 	IRQ_CODE_SECTOR_READY IrqCode = 1 // CD sector is ready
 	IRQ_CODE_DONE         IrqCode = 2 // Command successful (2nd response)
 	IRQ_CODE_OK           IrqCode = 3 // Command successful (1st response)
+	IRQ_CODE_DATA_END     IrqCode = 4 // End of track or disc reached while playing
 	IRQ_CODE_ERROR        IrqCode = 5 // Invalid command, etc.
 )
 
@@ -20,12 +18,35 @@ type CdRomReadState int
 const (
 	READ_STATE_IDLE    CdRomReadState = iota
 	READ_STATE_READING CdRomReadState = iota
+	READ_STATE_PLAYING CdRomReadState = iota // CD-DA playback
 )
 
+// Returns the name of the read state
+func (state CdRomReadState) String() string {
+	switch state {
+	case READ_STATE_READING:
+		return "reading"
+	case READ_STATE_PLAYING:
+		return "playing"
+	}
+	return "idle"
+}
+
+// Names of the CD-ROM controller commands
+var CDROM_COMMAND_NAMES = map[uint8]string{
+	0x01: "GetStat", 0x02: "SetLoc", 0x03: "Play", 0x04: "Forward",
+	0x05: "Backward", 0x06: "ReadN", 0x07: "MotorOn", 0x08: "Stop",
+	0x09: "Pause", 0x0a: "Init", 0x0b: "Mute", 0x0c: "Demute",
+	0x0d: "SetFilter", 0x0e: "SetMode", 0x0f: "GetParam", 0x10: "GetLocL",
+	0x11: "GetLocP", 0x12: "SetSession", 0x13: "GetTN", 0x14: "GetTD",
+	0x15: "SeekL", 0x16: "SeekP", 0x19: "Test", 0x1a: "GetID",
+	0x1b: "ReadS", 0x1c: "Reset", 0x1d: "GetQ", 0x1e: "ReadTOC",
+}
+
 // CD-ROM data read state
 type ReadState struct {
 	State CdRomReadState
-	Delay uint32 // For READ_STATE_READING
+	Delay uint32 // For READ_STATE_READING and READ_STATE_PLAYING
 }
 
 func NewReadState() *ReadState {
@@ -44,6 +65,11 @@ func (rstate *ReadState) MakeReading(delay uint32) {
 	rstate.Delay = delay
 }
 
+func (rstate *ReadState) MakePlaying(delay uint32) {
+	rstate.State = READ_STATE_PLAYING
+	rstate.Delay = delay
+}
+
 func (rstate *ReadState) IsIdle() bool {
 	return rstate.State == READ_STATE_IDLE
 }
@@ -52,12 +78,19 @@ func (rstate *ReadState) IsReading() bool {
 	return rstate.State == READ_STATE_READING
 }
 
+func (rstate *ReadState) IsPlaying() bool {
+	return rstate.State == READ_STATE_PLAYING
+}
+
+// Returns the cycles a seek from sector `initial` to sector `target` takes.
+// A stopped motor spins up first (Timings.SpinUp), with the head at the
+// start of the disc
 func (cdrom *CdRom) CalcSeekTime(initial, target uint32, motorOn, paused bool) uint32 {
 	var ret int64
 
 	if !motorOn {
 		initial = 0
-		ret += 33868800
+		ret += int64(cdrom.Timings.SpinUp)
 	}
 
 	diff := absInt64(int64(initial) - int64(target))
@@ -84,6 +117,6 @@ func (cdrom *CdRom) CalcSeekTime(initial, target uint32, motorOn, paused bool) u
 		ret = math.MaxUint32
 	}
 
-	fmt.Printf("cdrom: CalcSeekTime(): %d\n", ret)
+	Log.Debugf(LOG_MODULE_CDROM, "CalcSeekTime(): %d", ret)
 	return uint32(ret)
 }
@@ -0,0 +1,278 @@
+package emulator
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Sends a command and its parameters to the CD-ROM controller
+func sendCdRomCommand(cdrom *CdRom, th *TimeHandler, cmd uint8, params ...uint8) {
+	for _, param := range params {
+		cdrom.SetParameter(param)
+	}
+	cdrom.SetCommand(cmd, th)
+}
+
+// Runs the CD-ROM controller until it raises an interrupt, acknowledges it
+// and returns its code and the response
+func waitCdRomIrq(t *testing.T, cdrom *CdRom, th *TimeHandler, irqState *IrqState) (IrqCode, []byte) {
+	t.Helper()
+	for i := 0; cdrom.IrqFlags == 0; i++ {
+		if i == 100_000 {
+			t.Fatal("no CD-ROM interrupt")
+		}
+		th.Tick(1000)
+		cdrom.Sync(th, irqState)
+	}
+
+	code := IrqCode(cdrom.IrqFlags & 7)
+	var response []byte
+	for !cdrom.HostResponse.IsEmpty() {
+		response = append(response, cdrom.HostResponse.Pop())
+	}
+	cdrom.IrqAck(0x1f, th)
+	return code, response
+}
+
+// Seeks and reads outside of the disc respond with errors instead of
+// stopping the emulator
+func TestCdRomSeekError(t *testing.T) {
+	disc, err := NewDisc(bytes.NewReader(newTestIsoImage(nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disc.Close()
+	cdrom := NewCdRom(disc)
+	th, irqState := NewTimeHandler(), NewIrqState()
+
+	// the seconds aren't BCD
+	sendCdRomCommand(cdrom, th, 0x02, 0x00, 0x6a, 0x00)
+	if code, response := waitCdRomIrq(t, cdrom, th, irqState); code != IRQ_CODE_ERROR || response[1] != 0x10 {
+		t.Fatalf("expected an invalid parameter error, got INT%d %x", code, response)
+	}
+
+	// the image ends at 00:02:32, the drive reads two sectors and stops
+	sendCdRomCommand(cdrom, th, 0x02, 0x00, 0x02, 0x30)
+	waitCdRomIrq(t, cdrom, th, irqState)
+	sendCdRomCommand(cdrom, th, 0x06)
+	var codes []IrqCode
+	var response []byte
+	for len(codes) < 4 {
+		var code IrqCode
+		code, response = waitCdRomIrq(t, cdrom, th, irqState)
+		codes = append(codes, code)
+	}
+	expected := []IrqCode{IRQ_CODE_OK, IRQ_CODE_SECTOR_READY, IRQ_CODE_SECTOR_READY, IRQ_CODE_ERROR}
+	for i := range expected {
+		if codes[i] != expected[i] {
+			t.Fatalf("expected the interrupts %v, got %v", expected, codes)
+		}
+	}
+	if response[0]&0x04 == 0 || response[1] != 0x04 {
+		t.Errorf("expected a seek error response, got %x", response)
+	}
+	if !cdrom.ReadState.IsIdle() {
+		t.Errorf("expected the drive to stop reading, got %s", cdrom.ReadState.State)
+	}
+
+	// the error is acknowledged
+	sendCdRomCommand(cdrom, th, 0x01)
+	if _, response := waitCdRomIrq(t, cdrom, th, irqState); response[0]&0x05 != 0 {
+		t.Errorf("expected the error bits to be cleared, got status 0x%02x", response[0])
+	}
+
+	// seek past the end of the disc
+	sendCdRomCommand(cdrom, th, 0x02, 0x10, 0x00, 0x00)
+	waitCdRomIrq(t, cdrom, th, irqState)
+	sendCdRomCommand(cdrom, th, 0x15)
+	if code, _ := waitCdRomIrq(t, cdrom, th, irqState); code != IRQ_CODE_OK {
+		t.Fatalf("expected SeekL to be accepted, got INT%d", code)
+	}
+	if !cdrom.IsOnDisc(MsfFromBcd(0x00, 0x02, 0x00)) || cdrom.IsOnDisc(cdrom.Position) {
+		t.Errorf("unexpected disc bounds")
+	}
+	code, response := waitCdRomIrq(t, cdrom, th, irqState)
+	if code != IRQ_CODE_ERROR || response[0]&0x04 == 0 || response[1] != 0x04 {
+		t.Errorf("expected a seek error, got INT%d %x", code, response)
+	}
+}
+
+// Badly behaved command and parameter writes don't stop the emulator
+func TestCdRomCommandOverflow(t *testing.T) {
+	cdrom := NewCdRom(nil)
+	th, irqState := NewTimeHandler(), NewIrqState()
+
+	// the 17th parameter wraps around the FIFO
+	params := make([]uint8, 17)
+	sendCdRomCommand(cdrom, th, 0x01, params...)
+	if code, response := waitCdRomIrq(t, cdrom, th, irqState); code != IRQ_CODE_ERROR || response[1] != 0x20 {
+		t.Errorf("expected a wrong number of parameters error, got INT%d %x", code, response)
+	}
+
+	// Test replaces GetStat before the sub-CPU runs it
+	sendCdRomCommand(cdrom, th, 0x01)
+	sendCdRomCommand(cdrom, th, 0x19, 0x20)
+	if _, response := waitCdRomIrq(t, cdrom, th, irqState); len(response) != 4 || response[3] != 0xc2 {
+		t.Errorf("expected the Test response, got %x", response)
+	}
+
+	// Test is ignored once GetStat is executed
+	sendCdRomCommand(cdrom, th, 0x01)
+	for !cdrom.IsCommandExecuted() {
+		th.Tick(100)
+		cdrom.Sync(th, irqState)
+	}
+	sendCdRomCommand(cdrom, th, 0x19)
+	if _, response := waitCdRomIrq(t, cdrom, th, irqState); len(response) != 1 || cdrom.Command != nil {
+		t.Errorf("expected the GetStat response, got %x", response)
+	}
+}
+
+// Waits for the next interrupt and fails unless it has the code `code`
+func expectCdRomIrq(t *testing.T, cdrom *CdRom, th *TimeHandler, irqState *IrqState, desc string, code IrqCode) []byte {
+	t.Helper()
+	got, response := waitCdRomIrq(t, cdrom, th, irqState)
+	if got != code {
+		t.Fatalf("%s: expected INT%d, got INT%d %x", desc, code, got, response)
+	}
+	return response
+}
+
+func TestCdRomTrackInfo(t *testing.T) {
+	cdrom := NewCdRom(newTestCddaDisc(t))
+	th, irqState := NewTimeHandler(), NewIrqState()
+
+	sendCdRomCommand(cdrom, th, 0x13)
+	if response := expectCdRomIrq(t, cdrom, th, irqState, "GetTN", IRQ_CODE_OK); !bytes.Equal(response[1:], []byte{0x01, 0x02}) {
+		t.Errorf("GetTN: expected tracks 1 to 2, got %x", response)
+	}
+
+	// track 2 starts at 00:02:32 and the lead-out at 00:03:57
+	for _, c := range []struct {
+		track    uint8
+		expected []byte
+	}{{0x01, []byte{0x00, 0x02}}, {0x02, []byte{0x00, 0x02}}, {0x00, []byte{0x00, 0x03}}} {
+		sendCdRomCommand(cdrom, th, 0x14, c.track)
+		if response := expectCdRomIrq(t, cdrom, th, irqState, "GetTD", IRQ_CODE_OK); !bytes.Equal(response[1:], c.expected) {
+			t.Errorf("GetTD %d: expected %x, got %x", c.track, c.expected, response[1:])
+		}
+	}
+
+	sendCdRomCommand(cdrom, th, 0x14, 0x03)
+	if response := expectCdRomIrq(t, cdrom, th, irqState, "GetTD 3", IRQ_CODE_ERROR); response[1] != 0x10 {
+		t.Errorf("GetTD 3: expected an invalid parameter error, got %x", response)
+	}
+}
+
+// Play answers right away, Stop answers twice: when it's received and when
+// the motor has stopped
+func TestCdRomPlayStop(t *testing.T) {
+	cdrom := NewCdRom(newTestCddaDisc(t))
+	th, irqState := NewTimeHandler(), NewIrqState()
+
+	sendCdRomCommand(cdrom, th, 0x03, 0x05)
+	if response := expectCdRomIrq(t, cdrom, th, irqState, "Play 5", IRQ_CODE_ERROR); response[1] != 0x10 {
+		t.Errorf("Play 5: expected an invalid parameter error, got %x", response)
+	}
+
+	sendCdRomCommand(cdrom, th, 0x03, 0x02)
+	expectCdRomIrq(t, cdrom, th, irqState, "Play", IRQ_CODE_OK)
+	runCdRomSectors(cdrom, th, irqState, 4)
+	if !cdrom.ReadState.IsPlaying() || cdrom.Position.SectorIndex() < 182 {
+		t.Fatalf("expected to play track 2, at sector %d", cdrom.Position.SectorIndex())
+	}
+	if status := cdrom.DriveStatus(); status != 0x82 {
+		t.Errorf("expected the playing and motor bits, got status 0x%02x", status)
+	}
+
+	// there is no data sector while playing
+	sendCdRomCommand(cdrom, th, 0x10)
+	if response := expectCdRomIrq(t, cdrom, th, irqState, "GetLocL", IRQ_CODE_ERROR); response[1] != 0x80 {
+		t.Errorf("GetLocL: expected a not ready error, got %x", response)
+	}
+
+	sendCdRomCommand(cdrom, th, 0x08)
+	if response := expectCdRomIrq(t, cdrom, th, irqState, "Stop", IRQ_CODE_OK); response[0] != 0x82 {
+		t.Errorf("Stop: expected the status before stopping, got %x", response)
+	}
+	if cdrom.ReadState.IsPlaying() {
+		t.Error("expected Stop to stop playing at once")
+	}
+	if response := expectCdRomIrq(t, cdrom, th, irqState, "Stop", IRQ_CODE_DONE); response[0] != 0x00 {
+		t.Errorf("Stop: expected the motor to be off, got %x", response)
+	}
+}
+
+func TestCdRomMotorOn(t *testing.T) {
+	cdrom := NewCdRom(newTestCddaDisc(t))
+	th, irqState := NewTimeHandler(), NewIrqState()
+
+	sendCdRomCommand(cdrom, th, 0x07)
+	if response := expectCdRomIrq(t, cdrom, th, irqState, "MotorOn", IRQ_CODE_ERROR); response[1] != 0x20 {
+		t.Errorf("MotorOn: expected an error while the motor is on, got %x", response)
+	}
+
+	sendCdRomCommand(cdrom, th, 0x08)
+	expectCdRomIrq(t, cdrom, th, irqState, "Stop", IRQ_CODE_OK)
+	expectCdRomIrq(t, cdrom, th, irqState, "Stop", IRQ_CODE_DONE)
+
+	// the status doesn't have the motor bit until the motor has spun up
+	sendCdRomCommand(cdrom, th, 0x07)
+	if response := expectCdRomIrq(t, cdrom, th, irqState, "MotorOn", IRQ_CODE_OK); response[0]&0x02 != 0 {
+		t.Errorf("MotorOn: expected the motor to be off, got %x", response)
+	}
+	expectCdRomIrq(t, cdrom, th, irqState, "MotorOn", IRQ_CODE_DONE)
+	if !cdrom.MotorOn || cdrom.SpinUpTimer == 0 {
+		t.Errorf("expected the motor to spin up, %d cycles left", cdrom.SpinUpTimer)
+	}
+	runCdRomSectors(cdrom, th, irqState, 80)
+	if status := cdrom.DriveStatus(); status != 0x02 {
+		t.Errorf("expected the motor bit after the spin-up, got status 0x%02x", status)
+	}
+}
+
+func TestCdRomSetSession(t *testing.T) {
+	cdrom := NewCdRom(newTestCddaDisc(t))
+	th, irqState := NewTimeHandler(), NewIrqState()
+
+	for _, session := range []uint8{0, 2} {
+		sendCdRomCommand(cdrom, th, 0x12, session)
+		if response := expectCdRomIrq(t, cdrom, th, irqState, "SetSession", IRQ_CODE_ERROR); response[1] != 0x10 {
+			t.Errorf("SetSession %d: expected an invalid parameter error, got %x", session, response)
+		}
+	}
+
+	cdrom.Position = MsfFromBcd(0x00, 0x03, 0x00)
+	sendCdRomCommand(cdrom, th, 0x12, 0x01)
+	expectCdRomIrq(t, cdrom, th, irqState, "SetSession", IRQ_CODE_OK)
+	expectCdRomIrq(t, cdrom, th, irqState, "SetSession", IRQ_CODE_DONE)
+	if !cdrom.Position.IsEqual(MsfFromBcd(0x00, 0x02, 0x00)) {
+		t.Errorf("expected to seek to the start of the session, at %s", cdrom.Position)
+	}
+}
+
+// GetLocL responds with the header and subheader of the last data sector
+func TestCdRomGetLocL(t *testing.T) {
+	cdrom := NewCdRom(newTestCddaDisc(t))
+	th, irqState := NewTimeHandler(), NewIrqState()
+
+	sendCdRomCommand(cdrom, th, 0x10)
+	if response := expectCdRomIrq(t, cdrom, th, irqState, "GetLocL", IRQ_CODE_ERROR); response[1] != 0x80 {
+		t.Errorf("GetLocL: expected an error before a sector was read, got %x", response)
+	}
+
+	sendCdRomCommand(cdrom, th, 0x02, 0x00, 0x02, 0x10)
+	expectCdRomIrq(t, cdrom, th, irqState, "SetLoc", IRQ_CODE_OK)
+	sendCdRomCommand(cdrom, th, 0x06)
+	expectCdRomIrq(t, cdrom, th, irqState, "ReadN", IRQ_CODE_OK)
+	expectCdRomIrq(t, cdrom, th, irqState, "ReadN", IRQ_CODE_SECTOR_READY)
+	sendCdRomCommand(cdrom, th, 0x09)
+	expectCdRomIrq(t, cdrom, th, irqState, "Pause", IRQ_CODE_OK)
+	expectCdRomIrq(t, cdrom, th, irqState, "Pause", IRQ_CODE_DONE)
+
+	sendCdRomCommand(cdrom, th, 0x10)
+	expected := []byte{0x00, 0x02, 0x10, 0x02, 0x00, 0x00, 0x00, 0x00}
+	if response := expectCdRomIrq(t, cdrom, th, irqState, "GetLocL", IRQ_CODE_OK); !bytes.Equal(response, expected) {
+		t.Errorf("GetLocL: expected %x, got %x", expected, response)
+	}
+}
@@ -42,6 +42,14 @@ type Channel struct {
 	Base       uint32 // DMA start address
 	BlockSize  uint16 // Size of a block in words
 	BlockCount uint16 // Block count, only used when `Sync` is `SYNC_REQUEST`
+	// State of a chopped transfer
+	Started   bool   // The transfer has started, `Addr` and `Remaining` are valid
+	Addr      uint32 // Address of the next word
+	Remaining uint32 // Words left to transfer
+	NextChunk uint64 // Time at which the next chunk can be transferred
+	// The last word was sent, the channel stays busy until `DoneAt`
+	Finishing bool
+	DoneAt    uint64 // Time at which the transfer completes
 }
 
 // Create a new channel instance
@@ -101,6 +109,12 @@ func (ch *Channel) SetControl(val uint32) {
 	ch.Enable = (val>>24)&1 != 0
 	ch.Trigger = (val>>28)&1 != 0
 	ch.Dummy = uint8((val >> 29) & 3)
+
+	if !ch.Enable {
+		// the transfer was stopped
+		ch.Started = false
+		ch.Finishing = false
+	}
 }
 
 // Set the channel base address. Only bits [0:23] are significant, so
@@ -155,8 +169,41 @@ func (ch *Channel) TransferSize() (valid bool, size uint32) {
 	return false, 0
 }
 
+// Returns true if the transfer is split into chunks with CPU windows in
+// between. Only works in manual sync mode
+func (ch *Channel) Chopped() bool {
+	return ch.Chop && ch.Sync == SYNC_MANUAL
+}
+
+// Returns the amount of words transferred between two CPU windows
+func (ch *Channel) ChopWords() uint32 {
+	return 1 << ch.ChopDmaSz
+}
+
+// Returns the length of the CPU window between two chunks in cycles
+func (ch *Channel) ChopCycles() uint64 {
+	return 1 << ch.ChopCpuSz
+}
+
+// Initializes the transfer state from the Base and Block Control registers
+func (ch *Channel) Start() {
+	ch.Started = true
+	ch.Addr = ch.Base
+	_, ch.Remaining = ch.TransferSize()
+	ch.NextChunk = 0
+	ch.Finishing = false
+}
+
+// Marks the transfer as sent, it completes at `doneAt`
+func (ch *Channel) Finish(doneAt uint64) {
+	ch.Finishing = true
+	ch.DoneAt = doneAt
+}
+
 // Set the channel status to `completed` state
 func (ch *Channel) Done() {
 	ch.Enable = false
 	ch.Trigger = false
+	ch.Started = false
+	ch.Finishing = false
 }
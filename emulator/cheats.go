@@ -0,0 +1,311 @@
+package emulator
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Type of a cheat code
+type CheatCodeType int
+
+const (
+	CHEAT_WRITE8   CheatCodeType = iota // 30XXXXXX 00YY: constant 8 bit write
+	CHEAT_WRITE16  CheatCodeType = iota // 80XXXXXX YYYY: constant 16 bit write
+	CHEAT_WRITE32  CheatCodeType = iota // raw XXXXXXXX=YYYYYYYY: constant 32 bit write
+	CHEAT_INC8     CheatCodeType = iota // 20XXXXXX 00YY: 8 bit increment
+	CHEAT_DEC8     CheatCodeType = iota // 21XXXXXX 00YY: 8 bit decrement
+	CHEAT_INC16    CheatCodeType = iota // 10XXXXXX YYYY: 16 bit increment
+	CHEAT_DEC16    CheatCodeType = iota // 11XXXXXX YYYY: 16 bit decrement
+	CHEAT_IF_EQ16  CheatCodeType = iota // D0XXXXXX YYYY: run the next code if equal
+	CHEAT_IF_NE16  CheatCodeType = iota // D1XXXXXX YYYY: run the next code if not equal
+	CHEAT_IF_LT16  CheatCodeType = iota // D2XXXXXX YYYY: run the next code if less than
+	CHEAT_IF_GT16  CheatCodeType = iota // D3XXXXXX YYYY: run the next code if greater than
+	CHEAT_IF_EQ8   CheatCodeType = iota // E0XXXXXX 00YY: run the next code if equal
+	CHEAT_IF_NE8   CheatCodeType = iota // E1XXXXXX 00YY: run the next code if not equal
+	CHEAT_IF_LT8   CheatCodeType = iota // E2XXXXXX 00YY: run the next code if less than
+	CHEAT_IF_GT8   CheatCodeType = iota // E3XXXXXX 00YY: run the next code if greater than
+	CHEAT_MASTER16 CheatCodeType = iota // C0XXXXXX YYYY: run the rest of the cheat if equal
+	CHEAT_SLIDE    CheatCodeType = iota // 5000XXYY ZZZZ: repeat the next write XX times
+)
+
+// A single cheat code
+type CheatCode struct {
+	Type    CheatCodeType
+	Address uint32 // RAM address
+	Value   uint32
+}
+
+// A named list of codes that are applied together
+type Cheat struct {
+	Name    string
+	Codes   []CheatCode
+	Enabled bool
+}
+
+// Applies enabled cheats to RAM on every VBlank
+type CheatEngine struct {
+	Cheats []*Cheat
+	mu     sync.Mutex // Cheats can be changed by the frontend at any time
+}
+
+// Returns a new cheat engine without any cheats
+func NewCheatEngine() *CheatEngine {
+	return &CheatEngine{}
+}
+
+// Adds a cheat. If a cheat with the same name exists, it is replaced
+func (engine *CheatEngine) Add(cheat *Cheat) {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	for idx, c := range engine.Cheats {
+		if c.Name == cheat.Name {
+			engine.Cheats[idx] = cheat
+			return
+		}
+	}
+	engine.Cheats = append(engine.Cheats, cheat)
+}
+
+// Removes the cheat with the name `name`. Returns false if it doesn't exist
+func (engine *CheatEngine) Remove(name string) bool {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	for idx, c := range engine.Cheats {
+		if c.Name == name {
+			engine.Cheats = append(engine.Cheats[:idx], engine.Cheats[idx+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Enables or disables the cheat with the name `name`. Returns false if it
+// doesn't exist
+func (engine *CheatEngine) SetEnabled(name string, enabled bool) bool {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	for _, c := range engine.Cheats {
+		if c.Name == name {
+			c.Enabled = enabled
+			return true
+		}
+	}
+	return false
+}
+
+// Applies all enabled cheats
+func (engine *CheatEngine) Apply(ram *RAM) {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	for _, cheat := range engine.Cheats {
+		if cheat.Enabled {
+			cheat.Apply(ram)
+		}
+	}
+}
+
+// Applies the codes of the cheat
+func (cheat *Cheat) Apply(ram *RAM) {
+	codes := cheat.Codes
+
+	for i := 0; i < len(codes); i++ {
+		code := codes[i]
+
+		switch code.Type {
+		case CHEAT_IF_EQ16, CHEAT_IF_NE16, CHEAT_IF_LT16, CHEAT_IF_GT16,
+			CHEAT_IF_EQ8, CHEAT_IF_NE8, CHEAT_IF_LT8, CHEAT_IF_GT8:
+			if !code.Condition(ram) {
+				i++ // skip the next code
+			}
+		case CHEAT_MASTER16:
+			if !code.Condition(ram) {
+				return
+			}
+		case CHEAT_SLIDE:
+			if i+1 >= len(codes) {
+				return
+			}
+			next := codes[i+1]
+			count := (code.Address >> 8) & 0xff
+			step := code.Address & 0xff
+			for n := uint32(0); n < count; n++ {
+				next.Apply(ram)
+				next.Address += step
+				next.Value += code.Value
+			}
+			i++
+		default:
+			code.Apply(ram)
+		}
+	}
+}
+
+// Applies a write, increment or decrement code
+func (code CheatCode) Apply(ram *RAM) {
+	addr := code.Address & 0x1fffff
+
+	switch code.Type {
+	case CHEAT_WRITE8:
+		ram.Store8(addr, uint8(code.Value))
+	case CHEAT_WRITE16:
+		ram.Store16(addr, uint16(code.Value))
+	case CHEAT_WRITE32:
+		ram.Store32(addr, code.Value)
+	case CHEAT_INC8:
+		ram.Store8(addr, ram.Load8(addr)+uint8(code.Value))
+	case CHEAT_DEC8:
+		ram.Store8(addr, ram.Load8(addr)-uint8(code.Value))
+	case CHEAT_INC16:
+		ram.Store16(addr, ram.Load16(addr)+uint16(code.Value))
+	case CHEAT_DEC16:
+		ram.Store16(addr, ram.Load16(addr)-uint16(code.Value))
+	}
+}
+
+// Returns the result of a conditional code
+func (code CheatCode) Condition(ram *RAM) bool {
+	addr := code.Address & 0x1fffff
+
+	var v uint32
+	switch code.Type {
+	case CHEAT_IF_EQ8, CHEAT_IF_NE8, CHEAT_IF_LT8, CHEAT_IF_GT8:
+		v = uint32(ram.Load8(addr))
+	default:
+		v = uint32(ram.Load16(addr))
+	}
+
+	switch code.Type {
+	case CHEAT_IF_EQ16, CHEAT_IF_EQ8, CHEAT_MASTER16:
+		return v == code.Value
+	case CHEAT_IF_NE16, CHEAT_IF_NE8:
+		return v != code.Value
+	case CHEAT_IF_LT16, CHEAT_IF_LT8:
+		return v < code.Value
+	case CHEAT_IF_GT16, CHEAT_IF_GT8:
+		return v > code.Value
+	}
+	return false
+}
+
+// GameShark code prefixes
+var gameSharkTypes = map[uint32]CheatCodeType{
+	0x30: CHEAT_WRITE8,
+	0x80: CHEAT_WRITE16,
+	0x20: CHEAT_INC8,
+	0x21: CHEAT_DEC8,
+	0x10: CHEAT_INC16,
+	0x11: CHEAT_DEC16,
+	0xd0: CHEAT_IF_EQ16,
+	0xd1: CHEAT_IF_NE16,
+	0xd2: CHEAT_IF_LT16,
+	0xd3: CHEAT_IF_GT16,
+	0xe0: CHEAT_IF_EQ8,
+	0xe1: CHEAT_IF_NE8,
+	0xe2: CHEAT_IF_LT8,
+	0xe3: CHEAT_IF_GT8,
+	0xc0: CHEAT_MASTER16,
+	0x50: CHEAT_SLIDE,
+}
+
+// Parses a single code. GameShark codes look like "800XXXXX YYYY", raw
+// writes look like "ADDRESS=VALUE", where the amount of value digits (2, 4
+// or 8) is the write size
+func ParseCheatCode(line string) (CheatCode, error) {
+	line = strings.TrimSpace(line)
+
+	if addrStr, valueStr, ok := strings.Cut(line, "="); ok {
+		addrStr = strings.TrimSpace(addrStr)
+		valueStr = strings.TrimSpace(valueStr)
+
+		addr, err := strconv.ParseUint(addrStr, 16, 32)
+		if err != nil {
+			return CheatCode{}, fmt.Errorf("invalid address \"%s\"", addrStr)
+		}
+		value, err := strconv.ParseUint(valueStr, 16, 32)
+		if err != nil {
+			return CheatCode{}, fmt.Errorf("invalid value \"%s\"", valueStr)
+		}
+
+		code := CheatCode{Address: uint32(addr), Value: uint32(value)}
+		switch len(valueStr) {
+		case 2:
+			code.Type = CHEAT_WRITE8
+		case 4:
+			code.Type = CHEAT_WRITE16
+		case 8:
+			code.Type = CHEAT_WRITE32
+		default:
+			return CheatCode{}, fmt.Errorf("invalid value size \"%s\"", valueStr)
+		}
+		return code, nil
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) != 2 || len(fields[0]) != 8 || len(fields[1]) != 4 {
+		return CheatCode{}, fmt.Errorf("invalid code \"%s\"", line)
+	}
+	addr, err := strconv.ParseUint(fields[0], 16, 32)
+	if err != nil {
+		return CheatCode{}, fmt.Errorf("invalid code \"%s\"", line)
+	}
+	value, err := strconv.ParseUint(fields[1], 16, 16)
+	if err != nil {
+		return CheatCode{}, fmt.Errorf("invalid code \"%s\"", line)
+	}
+
+	codeType, ok := gameSharkTypes[uint32(addr>>24)]
+	if !ok {
+		return CheatCode{}, fmt.Errorf("unsupported code type 0x%02x", addr>>24)
+	}
+
+	return CheatCode{
+		Type:    codeType,
+		Address: uint32(addr) & 0xffffff,
+		Value:   uint32(value),
+	}, nil
+}
+
+// Parses a cheat list. A cheat starts with "[name]" and is followed by its
+// codes, lines starting with # are comments. Codes before the first name
+// are put into a cheat called "default". All parsed cheats are enabled
+func ParseCheats(r io.Reader) ([]*Cheat, error) {
+	var cheats []*Cheat
+	var cheat *Cheat
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]") {
+			cheat = &Cheat{Name: text[1 : len(text)-1], Enabled: true}
+			cheats = append(cheats, cheat)
+			continue
+		}
+
+		code, err := ParseCheatCode(text)
+		if err != nil {
+			return nil, fmt.Errorf("cheats: line %d: %s", line, err)
+		}
+		if cheat == nil {
+			cheat = &Cheat{Name: "default", Enabled: true}
+			cheats = append(cheats, cheat)
+		}
+		cheat.Codes = append(cheat.Codes, code)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return cheats, nil
+}
@@ -0,0 +1,197 @@
+package emulator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCheatCode(t *testing.T) {
+	for _, c := range []struct {
+		line     string
+		expected CheatCode
+	}{
+		{"30012345 00ff", CheatCode{CHEAT_WRITE8, 0x012345, 0xff}},
+		{" 80012344 BEEF ", CheatCode{CHEAT_WRITE16, 0x012344, 0xbeef}},
+		{"d0010000 1234", CheatCode{CHEAT_IF_EQ16, 0x010000, 0x1234}},
+		{"E1010000 0042", CheatCode{CHEAT_IF_NE8, 0x010000, 0x42}},
+		{"C0010000 0001", CheatCode{CHEAT_MASTER16, 0x010000, 0x0001}},
+		{"50000502 0001", CheatCode{CHEAT_SLIDE, 0x000502, 0x0001}},
+		{"80010000=12", CheatCode{CHEAT_WRITE8, 0x80010000, 0x12}},
+		{"80010000 = 1234", CheatCode{CHEAT_WRITE16, 0x80010000, 0x1234}},
+		{"80010000=deadbeef", CheatCode{CHEAT_WRITE32, 0x80010000, 0xdeadbeef}},
+	} {
+		code, err := ParseCheatCode(c.line)
+		if err != nil {
+			t.Errorf("%q: %s", c.line, err)
+		} else if code != c.expected {
+			t.Errorf("%q: expected %+v, got %+v", c.line, c.expected, code)
+		}
+	}
+}
+
+func TestParseCheatCodeErrors(t *testing.T) {
+	for _, line := range []string{
+		"",
+		"80012344",
+		"80012344 BEEF 0000",
+		"8001234 BEEF",    // short address
+		"80012344 BEE",    // short value
+		"8001234G BEEF",   // not hex
+		"80012344 BEEG",   // not hex
+		"F0012344 BEEF",   // unknown type
+		"80010000=",       // no value
+		"8001000G=12",     // not hex
+		"80010000=123",    // odd size
+		"80010000=123456", // 24 bit write
+	} {
+		if code, err := ParseCheatCode(line); err == nil {
+			t.Errorf("%q: expected an error, got %+v", line, code)
+		}
+	}
+}
+
+func TestParseCheats(t *testing.T) {
+	cheats, err := ParseCheats(strings.NewReader(`80010000 0001
+# comment
+
+[Infinite health]
+800a0000 03e7
+[Max money]
+80010000=0001869f`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{"default", "Infinite health", "Max money"}
+	if len(cheats) != len(names) {
+		t.Fatalf("expected %d cheats, got %d", len(names), len(cheats))
+	}
+	for i, cheat := range cheats {
+		if cheat.Name != names[i] || len(cheat.Codes) != 1 || !cheat.Enabled {
+			t.Errorf("cheat %d: expected an enabled %q with one code, got %+v", i, names[i], cheat)
+		}
+	}
+
+	if _, err := ParseCheats(strings.NewReader("[a]\n80010000 0001\n80010000 zz")); err == nil ||
+		!strings.Contains(err.Error(), "line 3") {
+		t.Errorf("expected an error on line 3, got %v", err)
+	}
+}
+
+// Parses `lines` into an enabled cheat and applies it to `ram`
+func applyTestCheat(t *testing.T, ram *RAM, lines ...string) {
+	t.Helper()
+	cheat := &Cheat{Name: "test", Enabled: true}
+	for _, line := range lines {
+		code, err := ParseCheatCode(line)
+		if err != nil {
+			t.Fatalf("%q: %s", line, err)
+		}
+		cheat.Codes = append(cheat.Codes, code)
+	}
+	cheat.Apply(ram)
+}
+
+func TestCheatWrites(t *testing.T) {
+	ram := &RAM{} // zeroed, unlike NewRAM
+	ram.Store16(0x100, 10)
+	ram.Store8(0x102, 10)
+
+	applyTestCheat(t, ram,
+		"30000000 00ab",
+		"80000010 1234",
+		"80000020=cafebabe",
+		"10000100 0005", // 16 bit increment
+		"21000102 0003", // 8 bit decrement
+	)
+	if got := ram.Load8(0); got != 0xab {
+		t.Errorf("8 bit write: expected 0xab, got 0x%x", got)
+	}
+	if got := ram.Load16(0x10); got != 0x1234 {
+		t.Errorf("16 bit write: expected 0x1234, got 0x%x", got)
+	}
+	if got := ram.Load32(0x20); got != 0xcafebabe {
+		t.Errorf("32 bit write: expected 0xcafebabe, got 0x%x", got)
+	}
+	if got := ram.Load16(0x100); got != 15 {
+		t.Errorf("16 bit increment: expected 15, got %d", got)
+	}
+	if got := ram.Load8(0x102); got != 7 {
+		t.Errorf("8 bit decrement: expected 7, got %d", got)
+	}
+}
+
+// D0 and E0 codes only run the code that follows them if the 16 or 8 bit
+// value at their address matches
+func TestCheatConditions(t *testing.T) {
+	for _, c := range []struct {
+		cond string
+		runs bool
+	}{
+		{"d0000000 1234", true},
+		{"d0000000 1235", false},
+		{"d1000000 1234", false},
+		{"d2000000 1235", true},
+		{"d3000000 1233", true},
+		{"e0000000 0034", true},
+		{"e0000000 0012", false}, // only the low byte is compared
+		{"e1000000 0034", false},
+		{"e2000000 0034", false},
+		{"e3000000 0033", true},
+	} {
+		ram := &RAM{}
+		ram.Store16(0, 0x1234)
+		applyTestCheat(t, ram, c.cond, "80000010 0001", "80000020 0001")
+
+		if ran := ram.Load16(0x10) == 1; ran != c.runs {
+			t.Errorf("%q: expected the next code to run: %v", c.cond, c.runs)
+		}
+		if ram.Load16(0x20) != 1 {
+			t.Errorf("%q: expected the code after the next one to run", c.cond)
+		}
+	}
+}
+
+func TestCheatMaster(t *testing.T) {
+	ram := &RAM{}
+	applyTestCheat(t, ram, "80000010 0001", "c0000000 0001", "80000020 0001", "80000030 0001")
+	if ram.Load16(0x10) != 1 || ram.Load16(0x20) != 0 || ram.Load16(0x30) != 0 {
+		t.Error("expected a failed C0 code to stop the rest of the cheat")
+	}
+
+	ram.Store16(0, 1)
+	applyTestCheat(t, ram, "c0000000 0001", "80000020 0001", "80000030 0001")
+	if ram.Load16(0x20) != 1 || ram.Load16(0x30) != 1 {
+		t.Error("expected a matching C0 code to run the rest of the cheat")
+	}
+}
+
+// A 50 code repeats the next write, moving its address and value each time
+func TestCheatSlide(t *testing.T) {
+	ram := &RAM{}
+	applyTestCheat(t, ram, "50000504 0002", "80001000 0010", "30002000 0077")
+
+	for i := uint32(0); i < 5; i++ {
+		if got := ram.Load16(0x1000 + i*4); got != uint16(0x10+i*2) {
+			t.Errorf("write %d: expected 0x%x, got 0x%x", i, 0x10+i*2, got)
+		}
+	}
+	if got := ram.Load16(0x1000 + 5*4); got != 0 {
+		t.Errorf("expected 5 writes, got a 6th one of 0x%x", got)
+	}
+	if got := ram.Load8(0x2000); got != 0x77 {
+		t.Error("expected the code after the slide to run once")
+	}
+
+	// the parsed codes aren't changed, so the slide is the same next time
+	ram = &RAM{}
+	code, _ := ParseCheatCode("80001000 0010")
+	cheat := &Cheat{Codes: []CheatCode{{CHEAT_SLIDE, 0x0204, 1}, code}}
+	cheat.Apply(ram)
+	cheat.Apply(ram)
+	if cheat.Codes[1] != code || ram.Load16(0x1004) != 0x11 {
+		t.Errorf("expected the slide to repeat, got %+v", cheat.Codes[1])
+	}
+
+	// a slide at the end of a cheat does nothing
+	applyTestCheat(t, ram, "50000504 0002")
+}
@@ -1,5 +1,8 @@
 package emulator
 
+// Amount of words the GP0 FIFO can hold
+const GP0_FIFO_DEPTH = 16
+
 // Buffer holding multi-word fixed-length GP0 command parameters
 type CommandBuffer struct {
 	// Command buffer: the longest possible command is GP0(0x3E)
@@ -0,0 +1,88 @@
+package emulator
+
+// Draws the frames finished by the GPU, see Console.PresentFrame
+type Renderer interface {
+	// Draws `frame`. The frame is only valid during the call
+	DrawFrame(frame *Frame)
+}
+
+// Plays the audio output of the console: interleaved 16 bit stereo samples
+// at CD_SAMPLE_RATE
+type AudioSink interface {
+	// Called on the emulation goroutine, so it shouldn't block for long.
+	// `samples` is reused after the call returns
+	PlaySamples(samples []int16)
+}
+
+// Gives the state of the controllers. Polled on the emulation goroutine at
+// the start of every frame, see Console.SetInput
+type InputSource interface {
+	// Returns the pressed buttons and the analog values of the controller
+	// plugged into `port`
+	PollInput(port SerialTarget) (ButtonsState, [AXIS_COUNT]uint8)
+}
+
+// Settings of a console created with New
+type Config struct {
+	BIOS *BIOS // Required, see LoadBIOS
+	Disc *Disc // Inserted disc, nil to boot the BIOS menu
+	// Devices plugged into the ports, nothing is plugged in by default
+	Controllers [2]GamepadType
+	Audio       AudioSink   // nil to mute the console
+	Input       InputSource // nil to only use Console.SetInput
+}
+
+// Returns a console ready to Run with the hardware matching the region of
+// the disc. The frames are drawn with PresentFrame
+func New(config Config) (*Console, error) {
+	if config.BIOS == nil {
+		return nil, ErrNoBIOS
+	}
+
+	hardware := HARDWARE_NTSC
+	if config.Disc != nil {
+		hardware = GetHardwareFromRegion(config.Disc.Region)
+	}
+	gpu := NewGPU(hardware)
+	gpu.FrameQueue = NewFrameQueue()
+
+	inter := NewInterconnect(config.BIOS, NewRAM(), gpu, config.Disc)
+	inter.PadMemCard.Pad1 = NewGamepad(config.Controllers[0])
+	inter.PadMemCard.Pad2 = NewGamepad(config.Controllers[1])
+	if config.Audio != nil {
+		inter.CdRom.Mixer.SetOutput(config.Audio.PlaySamples)
+	}
+
+	console := NewConsole(NewCPU(inter))
+	console.frames = gpu.FrameQueue
+	console.input = config.Input
+	return console, nil
+}
+
+// Draws the newest finished frame with `renderer` on the calling goroutine.
+// Returns false if no frame was finished since the last call, or if the
+// console wasn't created with New
+func (console *Console) PresentFrame(renderer Renderer) bool {
+	if console.frames == nil {
+		return false
+	}
+	frame := console.frames.Pop()
+	if frame == nil {
+		return false
+	}
+	defer console.frames.Release(frame)
+	renderer.DrawFrame(frame)
+	return true
+}
+
+// Sends the state of the controllers from the InputSource to SetInput.
+// Called on the emulation goroutine at the start of every frame
+func (console *Console) pollInput() {
+	if console.input == nil {
+		return
+	}
+	for _, port := range []SerialTarget{TARGET_PADMEMCARD1, TARGET_PADMEMCARD2} {
+		buttons, axes := console.input.PollInput(port)
+		console.SetInput(port, 0, buttons, axes)
+	}
+}
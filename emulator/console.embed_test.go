@@ -0,0 +1,58 @@
+package emulator
+
+import (
+	"errors"
+	"testing"
+)
+
+type countingRenderer struct{ frames, vertices int }
+
+func (renderer *countingRenderer) DrawFrame(frame *Frame) {
+	renderer.frames++
+	renderer.vertices += len(frame.Vertices)
+}
+
+type crossInput struct{}
+
+func (crossInput) PollInput(port SerialTarget) (ButtonsState, [AXIS_COUNT]uint8) {
+	var buttons ButtonsState
+	if port == TARGET_PADMEMCARD1 {
+		buttons.Set(BUTTON_CROSS, BUTTON_STATE_PRESSED)
+	}
+	return buttons, CenteredAxes()
+}
+
+func TestConsoleNew(t *testing.T) {
+	if _, err := New(Config{}); !errors.Is(err, ErrNoBIOS) {
+		t.Fatalf("expected ErrNoBIOS, got %v", err)
+	}
+
+	bios, _ := LoadBIOSFromData(make([]byte, BIOS_SIZE))
+	console, err := New(Config{
+		BIOS:        bios,
+		Controllers: [2]GamepadType{GAMEPAD_TYPE_DIGITAL},
+		Input:       crossInput{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the input source is polled at the start of the frames
+	console.pollInput()
+	console.applyInput()
+	pad := console.Cpu.Inter.PadMemCard.Pad1.Profile.(*DigitalPadProfile)
+	if pad.State != DIGITAL_PAD_RELEASED&^(1<<BUTTON_CROSS) {
+		t.Errorf("expected cross to be pressed, got 0x%04x", pad.State)
+	}
+
+	var renderer countingRenderer
+	if console.PresentFrame(&renderer) {
+		t.Error("expected no frame before the GPU finished one")
+	}
+	gpu := console.Cpu.Inter.Gpu
+	gpu.DrawData.PushVertices(Vertex{}, Vertex{}, Vertex{})
+	gpu.FrameQueue.Push(gpu)
+	if !console.PresentFrame(&renderer) || renderer.frames != 1 || renderer.vertices != 3 {
+		t.Errorf("expected a frame with 3 vertices, got %+v", renderer)
+	}
+}
@@ -0,0 +1,171 @@
+package emulator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kind of an Event
+type EventType int
+
+const (
+	EVENT_DISC_CHANGED EventType = iota // A disc was inserted or removed
+	EVENT_GAME_LOADED                   // The BIOS loaded the boot executable of the disc
+	EVENT_PLAY_TIME                     // Sent every CONSOLE_PLAY_TIME_INTERVAL of play
+)
+
+// Interval between the EVENT_PLAY_TIME events, in emulated time
+const CONSOLE_PLAY_TIME_INTERVAL = time.Minute
+
+// Bytes of the executable compared with RAM to find out that it's loaded
+const EVENT_EXE_SIGNATURE_SIZE = 64
+
+func (ev EventType) String() string {
+	switch ev {
+	case EVENT_DISC_CHANGED:
+		return "disc changed"
+	case EVENT_GAME_LOADED:
+		return "game loaded"
+	case EVENT_PLAY_TIME:
+		return "play time"
+	}
+	return "unknown"
+}
+
+// Something that happened to the game, for the frontend (window title,
+// Discord Rich Presence...). See Console.Events
+type Event struct {
+	Type   EventType
+	GameID string // Game ID of the disc (see Disc.GameID), can be empty
+	// Title of the game from the game database, or the game ID, or the
+	// name of the boot executable. Empty without a disc
+	Title string
+	// Emulated time since the game was loaded, 0 before EVENT_GAME_LOADED
+	PlayTime time.Duration
+}
+
+// Sends the events of a console to the functions that subscribed to them
+type EventBus struct {
+	mu          sync.Mutex
+	subscribers []func(ev Event)
+}
+
+// Returns an event bus without subscribers
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// Calls `fn` with every event. It runs on the emulation goroutine and must
+// not block, or the emulation stalls
+func (bus *EventBus) Subscribe(fn func(ev Event)) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	bus.subscribers = append(bus.subscribers, fn)
+}
+
+func (bus *EventBus) publish(ev Event) {
+	bus.mu.Lock()
+	subscribers := bus.subscribers
+	bus.mu.Unlock()
+	for _, fn := range subscribers {
+		fn(ev)
+	}
+}
+
+// Follows the inserted disc and finds out when its game starts
+type gameTracker struct {
+	disc  *Disc
+	id    string
+	title string
+	// First bytes of the text of the boot executable and where they're
+	// loaded, nil if the executable couldn't be read
+	signature []byte
+	textAddr  uint32
+	loaded    bool
+	// CPU cycle when the game was loaded and of the next EVENT_PLAY_TIME
+	loadedCycle, nextPlayTime uint64
+}
+
+// Returns the tracker of a new disc, `disc` can be nil
+func newGameTracker(disc *Disc) gameTracker {
+	tracker := gameTracker{disc: disc}
+	if disc == nil {
+		return tracker
+	}
+	tracker.id = disc.GameID()
+	tracker.title = gameTitle(disc)
+
+	// the executable is found in RAM once the BIOS loaded it, this is
+	// cheaper than watching the PC
+	exe, err := disc.ReadFile(trimBootPath(disc.BootPath()))
+	if err != nil || len(exe) < 0x800+EVENT_EXE_SIGNATURE_SIZE || string(exe[:8]) != "PS-X EXE" {
+		return tracker
+	}
+	tracker.textAddr = binary.LittleEndian.Uint32(exe[0x18:]) & (RAM_ALLOC_SIZE - 1)
+	tracker.signature = exe[0x800 : 0x800+EVENT_EXE_SIGNATURE_SIZE]
+	if tracker.textAddr+EVENT_EXE_SIGNATURE_SIZE > RAM_ALLOC_SIZE {
+		tracker.signature = nil
+	}
+	return tracker
+}
+
+// Returns the path of a boot executable without "cdrom:\" and ";1", e.g.
+// SLUS_005.94
+func trimBootPath(path string) string {
+	if i := strings.IndexByte(path, ':'); i >= 0 {
+		path = path[i+1:]
+	}
+	path = strings.TrimLeft(path, "\\/")
+	if i := strings.IndexByte(path, ';'); i >= 0 {
+		path = path[:i]
+	}
+	return path
+}
+
+// Returns the name of the game in the game database, or its game ID, or
+// the name of its boot executable
+func gameTitle(disc *Disc) string {
+	if game := DefaultGameDatabase().Lookup(disc.GameID()); game != nil && game.Name != "" {
+		return game.Name
+	}
+	if id := disc.GameID(); id != "" {
+		return id
+	}
+	return trimBootPath(disc.BootPath())
+}
+
+func (tracker *gameTracker) event(ev EventType, cycles uint64) Event {
+	event := Event{Type: ev, GameID: tracker.id, Title: tracker.title}
+	if tracker.loaded {
+		event.PlayTime = time.Duration(cycles-tracker.loadedCycle) * time.Second / time.Duration(CPU_FREQ_HZ)
+	}
+	return event
+}
+
+// Publishes the events of the frame that just finished. Called on the
+// emulation goroutine at the start of every frame
+func (console *Console) trackGame() {
+	inter := console.Cpu.Inter
+	cycles := console.Cpu.Th.Cycles
+	tracker := &console.game
+	if inter.CdRom.Disc != tracker.disc {
+		*tracker = newGameTracker(inter.CdRom.Disc)
+		console.Events.publish(tracker.event(EVENT_DISC_CHANGED, cycles))
+	}
+
+	if !tracker.loaded && tracker.signature != nil {
+		ram := inter.Ram.Data[tracker.textAddr : tracker.textAddr+EVENT_EXE_SIGNATURE_SIZE]
+		if bytes.Equal(ram, tracker.signature) {
+			tracker.loaded = true
+			tracker.loadedCycle = cycles
+			tracker.nextPlayTime = cycles + uint64(CONSOLE_PLAY_TIME_INTERVAL/time.Second)*uint64(CPU_FREQ_HZ)
+			console.Events.publish(tracker.event(EVENT_GAME_LOADED, cycles))
+		}
+	} else if tracker.loaded && cycles >= tracker.nextPlayTime {
+		tracker.nextPlayTime += uint64(CONSOLE_PLAY_TIME_INTERVAL/time.Second) * uint64(CPU_FREQ_HZ)
+		console.Events.publish(tracker.event(EVENT_PLAY_TIME, cycles))
+	}
+}
@@ -0,0 +1,62 @@
+package emulator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestConsoleEvents(t *testing.T) {
+	exe := make([]byte, 0x800+0x100)
+	copy(exe, "PS-X EXE")
+	binary.LittleEndian.PutUint32(exe[0x18:], 0x80010000) // text address
+	for i := 0x800; i < len(exe); i++ {
+		exe[i] = byte(i)
+	}
+	image := newTestIsoImage(map[string]string{
+		"SYSTEM.CNF":  "BOOT = cdrom:\\SLUS_005.94;1\r\n",
+		"SLUS_005.94": string(exe),
+	})
+	disc, err := NewDisc(bytes.NewReader(image))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disc.Close()
+
+	inter := newBenchInterconnect()
+	inter.CdRom.Disc = disc
+	console := NewConsole(NewCPU(inter))
+	var events []Event
+	console.Events.Subscribe(func(ev Event) {
+		events = append(events, ev)
+	})
+
+	console.trackGame()
+	if len(events) != 1 || events[0].Type != EVENT_DISC_CHANGED || events[0].GameID != "SLUS-00594" {
+		t.Fatalf("expected a disc changed event, got %+v", events)
+	}
+	console.trackGame()
+	if len(events) != 1 {
+		t.Fatalf("unexpected events before the game is loaded: %+v", events[1:])
+	}
+
+	// the BIOS copies the executable to RAM
+	copy(inter.Ram.Data[0x10000:], exe[0x800:])
+	console.trackGame()
+	if len(events) != 2 || events[1].Type != EVENT_GAME_LOADED || events[1].Title != "SLUS-00594" {
+		t.Fatalf("expected a game loaded event, got %+v", events)
+	}
+
+	console.Cpu.Th.Cycles += uint64(CPU_FREQ_HZ) * 61
+	console.trackGame()
+	if len(events) != 3 || events[2].Type != EVENT_PLAY_TIME || events[2].PlayTime != 61*time.Second {
+		t.Fatalf("expected a play time event after 61 seconds, got %+v", events)
+	}
+
+	inter.CdRom.Disc = nil
+	console.trackGame()
+	if len(events) != 4 || events[3].Type != EVENT_DISC_CHANGED || events[3].Title != "" {
+		t.Fatalf("expected a disc changed event without a disc, got %+v", events)
+	}
+}
@@ -0,0 +1,427 @@
+package emulator
+
+import (
+	"image"
+	"image/draw"
+	"sync"
+	"time"
+)
+
+const (
+	CONSOLE_POLL_INTERVAL = 1024 // Instructions between checks for messages
+	CONSOLE_QUEUE_SIZE    = 256  // Maximum amount of pending messages
+)
+
+// Emulation speeds for Console.SetSpeed, as a fraction of the real console
+const (
+	SPEED_UNLIMITED = 0    // Run as fast as possible
+	SPEED_SLOW_25   = 0.25 // Slow motion at 25%
+	SPEED_SLOW_50   = 0.5  // Slow motion at 50%
+	SPEED_NORMAL    = 1    // Same speed as the real console
+)
+
+// Sleep only if the emulator is at least this far ahead of the wall clock
+const CONSOLE_MIN_SLEEP = time.Millisecond
+
+// Snapshot of the emulator state that other goroutines can read
+type ConsoleStatus struct {
+	Cycles uint64  // CPU cycles since power-on
+	PC     uint32  // Program counter
+	Frames uint64  // Amount of frames output by the GPU
+	Paused bool    // True if the emulation is paused
+	Speed  float64 // Emulation speed, see Console.SetSpeed
+	// Frames the console runs ahead, see Console.SetRunAhead. Goes back to
+	// 0 if the host can't keep up
+	RunAhead int
+	// Frames per second output by the GPU in the current video mode (50Hz
+	// or 60Hz), see GPU.RefreshRate
+	RefreshRate float64
+}
+
+// Runs the emulator on its own goroutine. Other goroutines (like the
+// frontend) must not touch the CPU or the peripherals directly, they send
+// messages that run on the emulation goroutine between instructions
+type Console struct {
+	Cpu   *CPU
+	Frame uint64 // Last frame that OnFrame was called for
+	// If not nil, called on the emulation goroutine at the start of every
+	// frame
+	OnFrame func(console *Console)
+	// Game loaded, play time... Subscribers are called on the emulation
+	// goroutine
+	Events *EventBus
+	game   gameTracker // State of the game for Events
+	// If not nil, button events are applied to this pad instead of the
+	// ports. OnFrame can then apply it at a frame boundary, which keeps the
+	// emulation deterministic (netplay, movies)
+	Latched  *Gamepad
+	messages chan func()
+	done     chan struct{}
+	mu       sync.Mutex
+	status   ConsoleStatus
+	stats    FrameStats // Stats of the last finished frame
+	stopped  bool
+	paused   bool
+	// If true, the emulation pauses at the start of the next frame
+	advancing bool
+	speed     float64
+	// Wall clock time and CPU cycles when the speed was last changed or the
+	// emulation was resumed, used to throttle the emulation
+	speedStart  time.Time
+	speedCycles uint64
+	// Frames to run ahead, see SetRunAhead, and the state they roll back to
+	runAhead int
+	snapshot Snapshot
+	// Set by SetDeterministic, turns run-ahead off
+	deterministic bool
+	// Input set with SetInput that wasn't applied yet, and the input that
+	// was applied last, per controller slot
+	inputMu      sync.Mutex
+	pendingInput map[inputSlot]inputSnapshot
+	appliedInput map[inputSlot]inputSnapshot
+	// Set by New: the finished frames and the polled controllers
+	frames *FrameQueue
+	input  InputSource
+}
+
+// Returns a new console that runs `cpu`
+func NewConsole(cpu *CPU) *Console {
+	return &Console{
+		Cpu:      cpu,
+		Events:   NewEventBus(),
+		messages: make(chan func(), CONSOLE_QUEUE_SIZE),
+		done:     make(chan struct{}),
+	}
+}
+
+// Runs the emulator until Stop is called or the emulator panics. The panic
+// is passed on to the caller. Messages sent before Run are handled before
+// the first instruction
+func (console *Console) Run() {
+	defer close(console.done)
+
+	console.handleMessages()
+	for !console.stopped {
+		if console.paused {
+			// sleep until the next message
+			console.publishStatus()
+			msg := <-console.messages
+			msg()
+			continue
+		}
+
+		gpu := console.Cpu.Inter.Gpu
+		for i := 0; i < CONSOLE_POLL_INTERVAL; i++ {
+			console.Cpu.Step()
+
+			if gpu.Frames != console.Frame {
+				console.Frame = gpu.Frames
+				console.Cpu.Inter.Profiler.EndFrame(console.Cpu.Th.Cycles)
+				console.collectStats()
+				console.trackGame()
+				console.pollInput()
+				console.applyInput()
+				if console.OnFrame != nil {
+					console.OnFrame(console)
+				}
+				if console.advancing {
+					// stop right after the VBlank
+					console.advancing = false
+					console.paused = true
+					break
+				}
+				if console.runAhead > 0 {
+					console.runFramesAhead()
+				}
+			}
+		}
+
+		prof := console.Cpu.Inter.Profiler
+		start := prof.Start()
+		console.publishStatus()
+		console.handleMessages()
+		console.throttle()
+		prof.Stop(PROFILE_IDLE, start)
+	}
+}
+
+// Sleeps if the emulation is ahead of the wall clock at the current speed
+func (console *Console) throttle() {
+	if console.speed == SPEED_UNLIMITED || console.paused {
+		return
+	}
+
+	cycles := console.Cpu.Th.Cycles - console.speedCycles
+	target := time.Duration(float64(cycles) / float64(CPU_FREQ_HZ) / console.speed * float64(time.Second))
+	if ahead := target - time.Since(console.speedStart); ahead >= CONSOLE_MIN_SLEEP {
+		time.Sleep(ahead)
+	}
+}
+
+// Starts measuring the emulation speed from the current point
+func (console *Console) resetThrottle() {
+	console.speedStart = time.Now()
+	console.speedCycles = console.Cpu.Th.Cycles
+}
+
+// Runs all pending messages
+func (console *Console) handleMessages() {
+	for {
+		select {
+		case msg := <-console.messages:
+			msg()
+		default:
+			return
+		}
+	}
+}
+
+func (console *Console) publishStatus() {
+	console.mu.Lock()
+	console.status = ConsoleStatus{
+		Cycles:      console.Cpu.Th.Cycles,
+		PC:          console.Cpu.PC,
+		Frames:      console.Cpu.Inter.Gpu.Frames,
+		Paused:      console.paused,
+		Speed:       console.speed,
+		RunAhead:    console.runAhead,
+		RefreshRate: console.Cpu.Inter.Gpu.RefreshRate(),
+	}
+	console.mu.Unlock()
+}
+
+// Returns the emulator state at the last message check. Doesn't block
+func (console *Console) Status() ConsoleStatus {
+	console.mu.Lock()
+	defer console.mu.Unlock()
+	return console.status
+}
+
+// Queues `fn` to run on the emulation goroutine and returns right away.
+// Does nothing if the console isn't running anymore
+func (console *Console) Send(fn func()) {
+	select {
+	case console.messages <- fn:
+	case <-console.done:
+	}
+}
+
+// Runs `fn` on the emulation goroutine and waits for it to finish. Returns
+// false if the console isn't running anymore
+func (console *Console) Call(fn func()) bool {
+	finished := make(chan struct{})
+	console.Send(func() {
+		fn()
+		close(finished)
+	})
+
+	select {
+	case <-finished:
+		return true
+	case <-console.done:
+		return false
+	}
+}
+
+// Stops the emulation loop
+func (console *Console) Stop() {
+	console.Send(func() {
+		console.stopped = true
+	})
+}
+
+// Returns a channel that's closed when Run returns
+func (console *Console) Done() <-chan struct{} {
+	return console.done
+}
+
+// Pauses the emulation. Messages are still handled while paused
+func (console *Console) Pause() {
+	console.Send(func() {
+		console.paused = true
+	})
+}
+
+// Resumes the emulation after Pause
+func (console *Console) Resume() {
+	console.Send(func() {
+		console.paused = false
+		console.advancing = false
+		console.resetThrottle()
+	})
+}
+
+// Runs the emulation until the next frame starts and pauses it again, the
+// CPU stops right after the VBlank. If the emulation is running, it pauses
+// at the start of the next frame
+func (console *Console) FrameAdvance() {
+	console.Send(func() {
+		console.paused = false
+		console.advancing = true
+		console.resetThrottle()
+	})
+}
+
+// Sets the emulation speed as a fraction of the speed of the real console,
+// e.g. SPEED_SLOW_50 for half speed. SPEED_UNLIMITED (0) turns the throttle
+// off
+func (console *Console) SetSpeed(speed float64) {
+	console.Send(func() {
+		console.speed = speed
+		console.resetThrottle()
+	})
+}
+
+// Returns a copy of the picture of the next frame output by the GPU, or nil
+// if the console stopped first. Blocks while the emulation is paused. The
+// polygons are drawn in software, see GPU.Capture
+func (console *Console) Screenshot() image.Image {
+	result := make(chan image.Image, 1)
+	console.Send(func() {
+		gpu := console.Cpu.Inter.Gpu
+		prev := gpu.Capture
+		gpu.Capture = func(img *image.RGBA) {
+			if prev != nil {
+				prev(img)
+			}
+			gpu.Capture = prev
+
+			screenshot := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+			draw.Draw(screenshot, screenshot.Bounds(), img, img.Bounds().Min, draw.Src)
+			result <- screenshot
+		}
+	})
+
+	select {
+	case img := <-result:
+		return img
+	case <-console.done:
+		return nil
+	}
+}
+
+// Sets the function that receives the picture of every frame, see
+// GPU.Capture. `capture` can be nil to stop capturing
+func (console *Console) SetCapture(capture FrameCapture) {
+	console.Send(func() {
+		console.Cpu.Inter.Gpu.Capture = capture
+	})
+}
+
+// Sets the output of the CD audio mixer, see Mixer.SetOutput. `output`
+// can be nil
+func (console *Console) SetAudioOutput(output AudioOutput) {
+	console.Send(func() {
+		console.Cpu.Inter.CdRom.Mixer.SetOutput(output)
+	})
+}
+
+// Sets the volume controls of the host, see Mixer.SetHost. `host` can be
+// nil to play everything at the emulated volume
+func (console *Console) SetHostMixer(host *HostMixer) {
+	console.Send(func() {
+		console.Cpu.Inter.CdRom.Mixer.SetHost(host)
+	})
+}
+
+// Restarts the console from the BIOS reset vector. A soft reset only
+// resets the CPU, like the reset button, and lets the BIOS reinitialize the
+// hardware. A hard reset also clears RAM and puts every peripheral back to
+// its power-on state, like turning the console off and on
+func (console *Console) Reset(hard bool) {
+	console.Send(func() {
+		if hard {
+			console.Cpu.Inter.Reset()
+		}
+		console.Cpu.Reset()
+		// the BIOS loads the game again
+		console.game = newGameTracker(console.game.disc)
+	})
+}
+
+// Presses or releases a button of the controller in `slot` of the port
+// specified by `target`. Empty multitap slots get a digital pad plugged in.
+// The button changes between two instructions, use SetInput to only change
+// the input at frame boundaries
+func (console *Console) SetButtonState(target SerialTarget, slot int, button Button, state ButtonState) {
+	console.Send(func() {
+		if console.Latched != nil {
+			console.Latched.SetButtonState(button, state)
+			return
+		}
+
+		pad := console.Cpu.Inter.PadMemCard.Gamepad(target, slot)
+		if pad == nil {
+			return
+		}
+		if _, ok := pad.Profile.(*DummyPadProfile); ok && slot > 0 {
+			pad.Profile = NewDigitalPad()
+		}
+		pad.SetButtonState(button, state)
+	})
+}
+
+// Sets an analog value of the controller in `slot` of the port specified by
+// `target`, see AnalogProfile. Does nothing if the controller isn't analog
+func (console *Console) SetAxis(target SerialTarget, slot int, axis Axis, value uint8) {
+	console.Send(func() {
+		pad := console.Cpu.Inter.PadMemCard.Gamepad(target, slot)
+		if pad == nil {
+			return
+		}
+		if analog, ok := pad.Profile.(AnalogProfile); ok {
+			analog.SetAxis(axis, value)
+		}
+	})
+}
+
+// Presses the Analog button of the DualShock in `slot` of the port
+// specified by `target`, see DualShockProfile.PressAnalog. Does nothing if
+// there's no DualShock in the slot
+func (console *Console) PressAnalog(target SerialTarget, slot int) {
+	console.Send(func() {
+		pad := console.Cpu.Inter.PadMemCard.Gamepad(target, slot)
+		if pad == nil {
+			return
+		}
+		if dualShock, ok := pad.Profile.(*DualShockProfile); ok {
+			dualShock.PressAnalog()
+		}
+	})
+}
+
+// Points the lightgun in `slot` of the port specified by `target` at the
+// VRAM position `x`, `y`, see GunconProfile.Aim. Does nothing if there's no
+// lightgun in the slot
+func (console *Console) AimLightgun(target SerialTarget, slot int, x, y int) {
+	console.Send(func() {
+		pad := console.Cpu.Inter.PadMemCard.Gamepad(target, slot)
+		if pad == nil {
+			return
+		}
+		if gun, ok := pad.Profile.(*GunconProfile); ok {
+			gun.Aim(console.Cpu.Inter.Gpu, x, y)
+		}
+	})
+}
+
+// Moves the mouse in `slot` of the port specified by `target`, see
+// MouseProfile.Move. Does nothing if there's no mouse in the slot
+func (console *Console) MoveMouse(target SerialTarget, slot int, dx, dy int) {
+	console.Send(func() {
+		pad := console.Cpu.Inter.PadMemCard.Gamepad(target, slot)
+		if pad == nil {
+			return
+		}
+		if mouse, ok := pad.Profile.(*MouseProfile); ok {
+			mouse.Move(dx, dy)
+		}
+	})
+}
+
+// Swaps the disc, see CdRom.SwapDisc
+func (console *Console) SwapDisc(disc *Disc) {
+	console.Send(func() {
+		console.Cpu.Inter.CdRom.SwapDisc(disc)
+	})
+}
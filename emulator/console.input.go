@@ -0,0 +1,113 @@
+package emulator
+
+// Pressed buttons of a controller, one bit per Button. Unlike
+// DigitalPadProfile.State, a set bit means that the button is pressed
+type ButtonsState uint16
+
+// Presses or releases `button`
+func (buttons *ButtonsState) Set(button Button, state ButtonState) {
+	mask := ButtonsState(1) << uint(button)
+	if state == BUTTON_STATE_PRESSED {
+		*buttons |= mask
+	} else {
+		*buttons &^= mask
+	}
+}
+
+// Returns true if `button` is pressed
+func (buttons ButtonsState) Pressed(button Button) bool {
+	return buttons&(1<<uint(button)) != 0
+}
+
+// Returns the analog values of a controller at rest: the sticks and the
+// twist are centered and the analog buttons are released
+func CenteredAxes() [AXIS_COUNT]uint8 {
+	var axes [AXIS_COUNT]uint8
+	axes[AXIS_TWIST] = NEGCON_TWIST_CENTER
+	for _, axis := range []Axis{AXIS_LEFT_X, AXIS_LEFT_Y, AXIS_RIGHT_X, AXIS_RIGHT_Y} {
+		axes[axis] = DUALSHOCK_STICK_CENTER
+	}
+	return axes
+}
+
+// Controller slot that input is sent to
+type inputSlot struct {
+	target SerialTarget
+	slot   int
+}
+
+// Input of a controller for the next frame
+type inputSnapshot struct {
+	buttons ButtonsState
+	axes    [AXIS_COUNT]uint8
+}
+
+// Sets the input of the controller in `slot` of the port specified by
+// `target`. The newest input is applied at the start of the next frame, so
+// the controller state never changes in the middle of a frame, see
+// Console.Latched. Only the buttons and axes that changed since the last
+// applied input are sent to the controller. Empty multitap slots get a
+// digital pad plugged in. Doesn't block
+func (console *Console) SetInput(target SerialTarget, slot int, buttons ButtonsState, axes [AXIS_COUNT]uint8) {
+	console.inputMu.Lock()
+	defer console.inputMu.Unlock()
+
+	if console.pendingInput == nil {
+		console.pendingInput = map[inputSlot]inputSnapshot{}
+	}
+	console.pendingInput[inputSlot{target, slot}] = inputSnapshot{buttons, axes}
+}
+
+// Applies the input set with SetInput. Called on the emulation goroutine at
+// the start of every frame. When the input is latched, only slot 0 of port
+// 1 is used and it goes to the latched pad
+func (console *Console) applyInput() {
+	console.inputMu.Lock()
+	pending := console.pendingInput
+	console.pendingInput = nil
+	console.inputMu.Unlock()
+
+	if console.appliedInput == nil {
+		console.appliedInput = map[inputSlot]inputSnapshot{}
+	}
+
+	for key, input := range pending {
+		var pad *Gamepad
+		if console.Latched != nil {
+			if key != (inputSlot{TARGET_PADMEMCARD1, 0}) {
+				continue
+			}
+			pad = console.Latched
+		} else {
+			pad = console.Cpu.Inter.PadMemCard.Gamepad(key.target, key.slot)
+			if pad == nil {
+				continue
+			}
+			if _, ok := pad.Profile.(*DummyPadProfile); ok && key.slot > 0 {
+				pad.Profile = NewDigitalPad()
+			}
+		}
+
+		prev, seen := console.appliedInput[key]
+		for _, button := range GamepadButtons {
+			pressed := input.buttons.Pressed(button)
+			if seen && pressed == prev.buttons.Pressed(button) {
+				continue
+			}
+			if pressed {
+				pad.SetButtonState(button, BUTTON_STATE_PRESSED)
+			} else {
+				pad.SetButtonState(button, BUTTON_STATE_RELEASED)
+			}
+		}
+
+		if analog, ok := pad.Profile.(AnalogProfile); ok {
+			for axis, value := range input.axes {
+				if !seen || value != prev.axes[axis] {
+					analog.SetAxis(Axis(axis), value)
+				}
+			}
+		}
+		console.appliedInput[key] = input
+	}
+}
@@ -0,0 +1,44 @@
+package emulator
+
+import "testing"
+
+func TestConsoleSetInput(t *testing.T) {
+	inter := newBenchInterconnect()
+	inter.PadMemCard.Pad2 = NewGamepad(GAMEPAD_TYPE_NEGCON)
+	console := NewConsole(NewCPU(inter))
+
+	var buttons ButtonsState
+	buttons.Set(BUTTON_CROSS, BUTTON_STATE_PRESSED)
+	console.SetInput(TARGET_PADMEMCARD1, 0, buttons, CenteredAxes())
+
+	pad := inter.PadMemCard.Pad1.Profile.(*DigitalPadProfile)
+	if pad.State != DIGITAL_PAD_RELEASED {
+		t.Fatalf("expected the input to wait for the next frame")
+	}
+	console.applyInput()
+	if pad.State != DIGITAL_PAD_RELEASED&^(1<<BUTTON_CROSS) {
+		t.Errorf("expected cross to be pressed, got 0x%04x", pad.State)
+	}
+
+	// only the newest input of a frame is applied
+	buttons.Set(BUTTON_CROSS, BUTTON_STATE_RELEASED)
+	console.SetInput(TARGET_PADMEMCARD1, 0, buttons|1<<BUTTON_START, CenteredAxes())
+	console.SetInput(TARGET_PADMEMCARD1, 0, buttons, CenteredAxes())
+	console.applyInput()
+	if pad.State != DIGITAL_PAD_RELEASED {
+		t.Errorf("expected no buttons to be pressed, got 0x%04x", pad.State)
+	}
+
+	// axes that didn't change don't overwrite the digital buttons
+	negcon := inter.PadMemCard.Pad2.Profile.(*NegconProfile)
+	console.SetInput(TARGET_PADMEMCARD2, 0, 0, CenteredAxes())
+	console.applyInput()
+	negcon.SetButtonState(BUTTON_CROSS, BUTTON_STATE_PRESSED)
+	axes := CenteredAxes()
+	axes[AXIS_TWIST] = 0x10
+	console.SetInput(TARGET_PADMEMCARD2, 0, 0, axes)
+	console.applyInput()
+	if negcon.Axes[AXIS_TWIST] != 0x10 || negcon.Axes[AXIS_I] != 0xff {
+		t.Errorf("unexpected neGcon axes %v", negcon.Axes)
+	}
+}
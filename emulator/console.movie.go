@@ -0,0 +1,36 @@
+package emulator
+
+// Turns the deterministic mode on or off, for movies. The emulation then
+// only depends on the state it starts from and the input: run-ahead is
+// off, and the CD-ROM has no sector jitter and doesn't read ahead or
+// validate the sectors in the background (see CdRom.SetDeterministic)
+func (console *Console) SetDeterministic(on bool) {
+	console.Send(func() {
+		console.deterministic = on
+		console.Cpu.Inter.CdRom.SetDeterministic(on)
+	})
+}
+
+// Rewinds `movie` to the last checkpoint at or before `frame` on the
+// emulation goroutine (see Movie.Rewind), then starts the frame again:
+// OnFrame runs, it should apply the input with Movie.RunFrame. Returns the
+// frame the movie went back to
+func (console *Console) RewindMovie(movie *Movie, frame uint64) (uint64, error) {
+	var start uint64
+	var err error
+	ok := console.Call(func() {
+		start, err = movie.Rewind(console.Cpu, frame)
+		if err != nil {
+			return
+		}
+		console.Frame = console.Cpu.Inter.Gpu.Frames
+		console.resetThrottle()
+		if console.OnFrame != nil {
+			console.OnFrame(console)
+		}
+	})
+	if !ok {
+		return 0, ErrConsoleStopped
+	}
+	return start, err
+}
@@ -0,0 +1,99 @@
+package emulator
+
+import "time"
+
+// Maximum amount of frames the console can run ahead, see SetRunAhead
+const RUNAHEAD_MAX_FRAMES = 2
+
+// Run-ahead turns itself off when the emulation falls this far behind the
+// wall clock
+const RUNAHEAD_MAX_LAG = 500 * time.Millisecond
+
+// Sets how many frames the console runs ahead to hide the input lag of the
+// games, from 0 (off) to RUNAHEAD_MAX_FRAMES. At the start of every frame,
+// the state is saved, the next `frames` frames run with the current input
+// and the last one is shown, then the state is loaded back and the frame
+// runs again without being shown. The audio comes from the frames that
+// aren't thrown away. Every frame costs `frames` extra frames of
+// emulation, run-ahead turns itself off if the host can't keep up. It's
+// also off while the input is latched (netplay, movies) and in the
+// deterministic mode, see SetDeterministic
+func (console *Console) SetRunAhead(frames int) {
+	if frames < 0 {
+		frames = 0
+	}
+	if frames > RUNAHEAD_MAX_FRAMES {
+		frames = RUNAHEAD_MAX_FRAMES
+	}
+	console.Send(func() {
+		console.runAhead = frames
+		console.resetThrottle()
+	})
+}
+
+// Runs the frames ahead and then the current frame without showing it.
+// Called at the start of a frame, after the input is applied
+func (console *Console) runFramesAhead() {
+	if console.Latched != nil || console.deterministic {
+		return
+	}
+	if console.lagging() {
+		Log.Warnf(LOG_MODULE_INTER, "run-ahead: the emulation is too slow, turning run-ahead off")
+		console.runAhead = 0
+		console.resetThrottle()
+		return
+	}
+
+	cpu := console.Cpu
+	if err := console.snapshot.Save(cpu); err != nil {
+		Log.Warnf(LOG_MODULE_INTER, "run-ahead: %s", err)
+		console.runAhead = 0
+		return
+	}
+
+	// only the last frame ahead is shown, the audio is thrown away. The
+	// achievements aren't tested, these frames are rolled back
+	inter := cpu.Inter
+	mixer := inter.CdRom.Mixer
+	audio, achievements := mixer.Output, inter.Achievements
+	mixer.Output, inter.Achievements = nil, nil
+	for i := 0; i < console.runAhead; i++ {
+		console.runFrame(i == console.runAhead-1)
+	}
+	mixer.Output, inter.Achievements = audio, achievements
+
+	if err := console.snapshot.Restore(cpu); err != nil {
+		Log.Warnf(LOG_MODULE_INTER, "run-ahead: %s", err)
+		console.runAhead = 0
+		return
+	}
+	// the frame that counts, with audio but without the picture
+	console.runFrame(false)
+}
+
+// Runs the CPU until the GPU finishes the current frame. If `show` is
+// false, the frame isn't queued, captured or passed to FrameEnd
+func (console *Console) runFrame(show bool) {
+	gpu := console.Cpu.Inter.Gpu
+	queue, end, capture := gpu.FrameQueue, gpu.FrameEnd, gpu.Capture
+	if !show {
+		gpu.FrameQueue, gpu.FrameEnd, gpu.Capture = nil, nil, nil
+	}
+
+	frame := gpu.Frames
+	for gpu.Frames == frame {
+		console.Cpu.Step()
+	}
+	gpu.FrameQueue, gpu.FrameEnd, gpu.Capture = queue, end, capture
+}
+
+// Returns true if the emulation is more than RUNAHEAD_MAX_LAG behind the
+// wall clock at the current speed
+func (console *Console) lagging() bool {
+	if console.speed == SPEED_UNLIMITED {
+		return false
+	}
+	cycles := console.Cpu.Th.Cycles - console.speedCycles
+	target := time.Duration(float64(cycles) / float64(CPU_FREQ_HZ) / console.speed * float64(time.Second))
+	return time.Since(console.speedStart)-target > RUNAHEAD_MAX_LAG
+}
@@ -0,0 +1,73 @@
+package emulator
+
+// Hardware activity during the last frame and the hardware state at its
+// end, for the frontend debug overlay. See Console.FrameStats
+type FrameStats struct {
+	Frame uint64 // Value of GPU.Frames at the end of the frame
+
+	// GPU
+	Width, Height int          // Size of the picture sent to the TV
+	VMode         VMode        // NTSC or PAL
+	Interlaced    bool         // True if the output is 480 line interlaced
+	DisplayDepth  DisplayDepth // 15 or 24 bits per pixel
+	DrawCalls     uint32       // Polygons, rectangles and lines drawn
+
+	// CD-ROM
+	CdPosition  Msf            // Current read position
+	CdState     CdRomReadState // Idle, reading or playing
+	CdCommand   uint8          // Last command written by the CPU
+	CdCommandOn bool           // True if the command is still running
+
+	DmaWords [7]uint32         // Words transferred through each DMA port
+	Irqs     [IRQ_COUNT]uint32 // Amount of times each interrupt was raised
+	// Accesses to every page of RAM, nil if Interconnect.HeatMap is off
+	HeatMap *HeatMap
+}
+
+// Takes the stats of the frame that just finished and resets the counters.
+// Called on the emulation goroutine at the start of every frame
+func (console *Console) collectStats() {
+	inter := console.Cpu.Inter
+	gpu := inter.Gpu
+	cdrom := inter.CdRom
+
+	stats := FrameStats{
+		Frame:        gpu.Frames,
+		VMode:        gpu.VMode,
+		Interlaced:   gpu.Interlaced480(),
+		DisplayDepth: gpu.DisplayDepth,
+		DrawCalls:    gpu.DrawCalls,
+		CdCommand:    cdrom.LastCommand,
+		CdCommandOn:  cdrom.Command != nil,
+		DmaWords:     inter.Dma.Words,
+		Irqs:         inter.IrqState.Counts,
+	}
+	stats.Width, stats.Height = gpu.DisplaySize()
+	if cdrom.Position != nil {
+		stats.CdPosition = *cdrom.Position
+	}
+	if cdrom.ReadState != nil {
+		stats.CdState = cdrom.ReadState.State
+	}
+
+	if inter.HeatMap != nil {
+		heat := *inter.HeatMap
+		stats.HeatMap = &heat
+		inter.HeatMap.Reset()
+	}
+
+	gpu.DrawCalls = 0
+	inter.Dma.Words = [7]uint32{}
+	inter.IrqState.Counts = [IRQ_COUNT]uint32{}
+
+	console.mu.Lock()
+	console.stats = stats
+	console.mu.Unlock()
+}
+
+// Returns the stats of the last finished frame. Doesn't block
+func (console *Console) FrameStats() FrameStats {
+	console.mu.Lock()
+	defer console.mu.Unlock()
+	return console.stats
+}
@@ -0,0 +1,35 @@
+package emulator
+
+import "testing"
+
+func TestConsoleFrameStats(t *testing.T) {
+	inter := newBenchInterconnect()
+	console := NewConsole(NewCPU(inter))
+
+	// a monochrome triangle
+	for _, word := range []uint32{0x20ff0000, 0, 10, 10 << 16} {
+		inter.Gpu.Store(0, word, console.Cpu.Th, inter.IrqState, inter.Timers)
+	}
+	inter.IrqState.SetHigh(INTERRUPT_SPU)
+	inter.IrqState.SetHigh(INTERRUPT_SPU)
+	inter.Dma.Words[PORT_GPU] = 16
+
+	console.collectStats()
+	stats := console.FrameStats()
+	if stats.DrawCalls != 1 {
+		t.Errorf("expected 1 draw call, got %d", stats.DrawCalls)
+	}
+	if stats.Irqs[INTERRUPT_SPU] != 2 {
+		t.Errorf("expected 2 SPU interrupts, got %d", stats.Irqs[INTERRUPT_SPU])
+	}
+	if stats.DmaWords[PORT_GPU] != 16 {
+		t.Errorf("expected 16 GPU DMA words, got %d", stats.DmaWords[PORT_GPU])
+	}
+
+	// the counters start over every frame
+	console.collectStats()
+	stats = console.FrameStats()
+	if stats.DrawCalls != 0 || stats.Irqs[INTERRUPT_SPU] != 0 || stats.DmaWords[PORT_GPU] != 0 {
+		t.Errorf("counters weren't reset: %+v", stats)
+	}
+}
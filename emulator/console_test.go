@@ -0,0 +1,150 @@
+package emulator
+
+import (
+	"testing"
+	"time"
+)
+
+// Returns a paused console with a zero BIOS that runs on its own goroutine
+// until the test ends
+func startTestConsole(t *testing.T) *Console {
+	console := NewConsole(NewCPU(newBenchInterconnect()))
+	// nothing was scheduled yet, sync every peripheral at the first step
+	console.Cpu.Th.UpdatePendingSync()
+	console.paused = true
+
+	go console.Run()
+	t.Cleanup(func() {
+		console.Stop()
+		<-console.Done()
+	})
+	return console
+}
+
+// Waits until the console publishes a status that satisfies `cond`
+func waitConsoleStatus(t *testing.T, console *Console, desc string, cond func(ConsoleStatus) bool) ConsoleStatus {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		if status := console.Status(); cond(status) {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s, status %+v", desc, console.Status())
+		}
+	}
+}
+
+func TestConsoleCall(t *testing.T) {
+	console := startTestConsole(t)
+
+	var pc uint32
+	if !console.Call(func() { pc = console.Cpu.PC }) || pc != 0xbfc00000 {
+		t.Fatalf("expected Call to run while paused, got PC 0x%08x", pc)
+	}
+
+	console.Stop()
+	select {
+	case <-console.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the console didn't stop")
+	}
+
+	// messages sent after Stop are dropped without blocking
+	ran := false
+	if console.Call(func() { ran = true }) || ran {
+		t.Error("expected Call to fail after Stop")
+	}
+	for i := 0; i < CONSOLE_QUEUE_SIZE*2; i++ {
+		console.Send(func() { ran = true })
+	}
+	if ran {
+		t.Error("expected messages to be dropped after Stop")
+	}
+}
+
+// Frame advance runs exactly one frame and pauses right after the VBlank
+func TestConsoleFrameAdvance(t *testing.T) {
+	console := startTestConsole(t)
+	var frames int
+	console.Call(func() {
+		console.OnFrame = func(*Console) { frames++ }
+	})
+
+	for advance := 1; advance <= 3; advance++ {
+		console.FrameAdvance()
+		status := waitConsoleStatus(t, console, "the frame advance", func(status ConsoleStatus) bool {
+			return status.Paused && status.Frames == uint64(advance)
+		})
+
+		// the emulation stays paused
+		time.Sleep(10 * time.Millisecond)
+		var cycles uint64
+		console.Call(func() { cycles = console.Cpu.Th.Cycles })
+		if frames != advance || cycles != status.Cycles || console.Status().Frames != uint64(advance) {
+			t.Fatalf("advance %d: expected to stop after the frame, %d frames and %d cycles since %d",
+				advance, frames, cycles, status.Cycles)
+		}
+	}
+
+	console.Resume()
+	waitConsoleStatus(t, console, "the emulation to resume", func(status ConsoleStatus) bool {
+		return !status.Paused && status.Frames > 4
+	})
+}
+
+func TestConsoleReset(t *testing.T) {
+	console := startTestConsole(t)
+	ram := console.Cpu.Inter.Ram
+
+	for _, hard := range []bool{false, true} {
+		console.Call(func() {
+			ram.Data[0x100] = 0x42
+			console.Cpu.PC = 0x80010000
+		})
+		console.Reset(hard)
+
+		var pc uint32
+		var data byte
+		console.Call(func() { pc, data = console.Cpu.PC, ram.Data[0x100] })
+		if pc != 0xbfc00000 {
+			t.Errorf("hard %v: expected to restart from the reset vector, got PC 0x%08x", hard, pc)
+		}
+		if expected := map[bool]byte{false: 0x42, true: 0xcd}[hard]; data != expected {
+			t.Errorf("hard %v: expected RAM to contain 0x%02x, got 0x%02x", hard, expected, data)
+		}
+	}
+}
+
+// Rewinding a movie loads the checkpoint and runs the start of the frame
+// again, which records its input
+func TestConsoleRewindMovie(t *testing.T) {
+	console := startTestConsole(t)
+	bios, _ := LoadBIOSFromData(make([]byte, BIOS_SIZE))
+	movie := NewMovie(bios)
+	console.SetDeterministic(true)
+	console.Call(func() {
+		console.OnFrame = func(c *Console) {
+			if err := movie.Checkpoint(c.Cpu); err != nil {
+				t.Error(err)
+			}
+			movie.RunFrame(c.Cpu.Inter, MovieFrame{DIGITAL_PAD_RELEASED, DIGITAL_PAD_RELEASED})
+		}
+	})
+
+	for advance := 1; advance <= 3; advance++ {
+		console.FrameAdvance()
+		waitConsoleStatus(t, console, "the frame advance", func(status ConsoleStatus) bool {
+			return status.Paused && status.Frames == uint64(advance)
+		})
+	}
+
+	frame, err := console.RewindMovie(movie, 2)
+	if err != nil || frame != 0 {
+		t.Fatalf("expected to go back to frame 0, got %d: %v", frame, err)
+	}
+	var frames, gpuFrames uint64
+	console.Call(func() { frames, gpuFrames = movie.Frame, console.Cpu.Inter.Gpu.Frames })
+	if frames != 1 || gpuFrames != 1 || movie.Rerecords != 1 {
+		t.Errorf("expected the first frame to run again, got movie frame %d and GPU frame %d", frames, gpuFrames)
+	}
+}
@@ -1,10 +1,69 @@
 package emulator
 
+// Coprocessor 0 register indices
+const (
+	COP0_BPC      uint32 = 3  // Breakpoint on execute address
+	COP0_BDA      uint32 = 5  // Breakpoint on data access address
+	COP0_JUMPDEST uint32 = 6  // Last jump destination
+	COP0_DCIC     uint32 = 7  // Breakpoint control
+	COP0_BADVADDR uint32 = 8  // Bad virtual address
+	COP0_BDAM     uint32 = 9  // Data access breakpoint mask
+	COP0_BPCM     uint32 = 11 // Execute breakpoint mask
+	COP0_SR       uint32 = 12 // Status register
+	COP0_CAUSE    uint32 = 13 // Cause register
+	COP0_EPC      uint32 = 14 // Exception PC
+	COP0_PRID     uint32 = 15 // Processor ID
+)
+
+// Bits [9:8] of CAUSE are two software interrupts. They're the only
+// writable bits, and they're masked by bits [9:8] of SR like the hardware
+// interrupt
+const CAUSE_SOFTWARE_IRQ_MASK uint32 = 0x300
+
+// CAUSE bits set when the exception happened in a branch delay slot
+const (
+	CAUSE_BD uint32 = 1 << 31 // Branch Delay: EPC points to the branch
+	CAUSE_BT uint32 = 1 << 30 // Branch Taken: JUMPDEST is the branch target
+)
+
+// Value of the processor ID register (R3000A, revision 2)
+const COP0_PRID_VALUE uint32 = 0x00000002
+
+// Writable bits of the DCIC register. Bits [5:0] are status flags, bits
+// [31:23] enable the breakpoints
+const COP0_DCIC_MASK uint32 = 0xff80003f
+
+// DCIC bits
+const (
+	DCIC_HIT_ANY        uint32 = 1 << 0  // Set on any breakpoint hit
+	DCIC_HIT_CODE       uint32 = 1 << 1  // Execute breakpoint hit
+	DCIC_HIT_DATA       uint32 = 1 << 2  // Data access breakpoint hit
+	DCIC_HIT_DATA_READ  uint32 = 1 << 3  // Data read breakpoint hit
+	DCIC_HIT_DATA_WRITE uint32 = 1 << 4  // Data write breakpoint hit
+	DCIC_SUPER_MASTER_1 uint32 = 1 << 23 // Must be set for any breakpoint
+	DCIC_CODE_ENABLE    uint32 = 1 << 24 // Enables the execute breakpoint (BPC, BPCM)
+	DCIC_DATA_ENABLE    uint32 = 1 << 25 // Enables the data access breakpoint (BDA, BDAM)
+	DCIC_BREAK_READ     uint32 = 1 << 26 // Data access breakpoint triggers on reads
+	DCIC_BREAK_WRITE    uint32 = 1 << 27 // Data access breakpoint triggers on writes
+	DCIC_MASTER         uint32 = 1 << 30 // Must be set for the execute and data breakpoints
+	DCIC_SUPER_MASTER_2 uint32 = 1 << 31 // Must be set for any breakpoint
+)
+
+// DCIC bits that have to be set for the execute and data breakpoints
+const DCIC_MASTER_MASK = DCIC_SUPER_MASTER_1 | DCIC_MASTER | DCIC_SUPER_MASTER_2
+
 // Coprocessor 0: System Control
 type Cop0 struct {
-	SR    uint32 // Register 12: status register
-	Cause uint32 // Register 13: cause register
-	Epc   uint32 // Register 14: exception PC
+	Bpc      uint32 // Register 3: breakpoint on execute address
+	Bda      uint32 // Register 5: breakpoint on data access address
+	JumpDest uint32 // Register 6: last jump destination, read only
+	Dcic     uint32 // Register 7: breakpoint control
+	BadVaddr uint32 // Register 8: bad virtual address, read only
+	Bdam     uint32 // Register 9: data access breakpoint mask
+	Bpcm     uint32 // Register 11: execute breakpoint mask
+	SR       uint32 // Register 12: status register
+	Cause    uint32 // Register 13: cause register
+	Epc      uint32 // Register 14: exception PC
 }
 
 // Creates a new Cop0 instance
@@ -12,14 +71,66 @@ func NewCop0() *Cop0 {
 	return &Cop0{}
 }
 
+// Returns the value of register `reg`. Registers that don't exist read as 0
+func (cop *Cop0) Read(reg uint32, irqState *IrqState) uint32 {
+	switch reg {
+	case COP0_BPC:
+		return cop.Bpc
+	case COP0_BDA:
+		return cop.Bda
+	case COP0_JUMPDEST:
+		return cop.JumpDest
+	case COP0_DCIC:
+		return cop.Dcic
+	case COP0_BADVADDR:
+		return cop.BadVaddr
+	case COP0_BDAM:
+		return cop.Bdam
+	case COP0_BPCM:
+		return cop.Bpcm
+	case COP0_SR:
+		return cop.SR
+	case COP0_CAUSE:
+		return cop.GetCause(irqState)
+	case COP0_EPC:
+		return cop.Epc
+	case COP0_PRID:
+		return COP0_PRID_VALUE
+	}
+	return 0
+}
+
+// Writes `val` to register `reg`. Writes to read only registers and
+// registers that don't exist are ignored
+func (cop *Cop0) Write(reg, val uint32) {
+	switch reg {
+	case COP0_BPC:
+		cop.Bpc = val
+	case COP0_BDA:
+		cop.Bda = val
+	case COP0_DCIC:
+		cop.Dcic = val & COP0_DCIC_MASK
+	case COP0_BDAM:
+		cop.Bdam = val
+	case COP0_BPCM:
+		cop.Bpcm = val
+	case COP0_SR:
+		cop.SetSR(val)
+	case COP0_CAUSE:
+		cop.SetCause(val)
+	}
+}
+
 func (cop *Cop0) SetSR(sr uint32) {
 	cop.SR = sr
 }
 
+// Writes the software interrupt bits of the CAUSE register, the other bits
+// are read only. A software interrupt is raised like the hardware
+// interrupt when it's enabled in SR, see IrqActive
 func (cop *Cop0) SetCause(val uint32) {
-	// triggers an interrupt
-	cop.Cause = uint32(int64(cop.Cause) & ^0x300)
-	cop.Cause |= val & 0x300
+	cop.Cause &^= CAUSE_SOFTWARE_IRQ_MASK
+	cop.Cause |= val & CAUSE_SOFTWARE_IRQ_MASK
 }
 
 // Returns value of the cause register
@@ -33,8 +144,21 @@ func (cop *Cop0) CacheIsolated() bool {
 	return cop.SR&0x10000 != 0
 }
 
-// Returns the address of the exception handler
-func (cop *Cop0) EnterException(cause Exception, pc uint32, inDelaySlot bool) uint32 {
+// Returns true if coprocessor 2 (the GTE) is enabled in the SR
+func (cop *Cop0) Cop2Enabled() bool {
+	return cop.SR&(1<<30) != 0
+}
+
+// Sets the number of the coprocessor that caused a coprocessor unusable
+// exception in the CAUSE register
+func (cop *Cop0) SetCoprocessorError(n uint32) {
+	cop.Cause = cop.Cause&^(3<<28) | (n&3)<<28
+}
+
+// Returns the address of the exception handler. `inDelaySlot` is true if the instruction at `pc` is in a branch delay slot
+// and `branchTaken` if the branch was taken. The handler finds the branch
+// from the BD (bit 31) and BT (bit 30) bits of CAUSE
+func (cop *Cop0) EnterException(cause Exception, pc uint32, inDelaySlot, branchTaken bool) uint32 {
 	// Shift bits [5:0] of the SR two places to the left.
 	// those bits are three pairs of Interrupt Enable/User Mode
 	// bits behaving like a stack of 3 entries deep. Entering an
@@ -50,12 +174,17 @@ func (cop *Cop0) EnterException(cause Exception, pc uint32, inDelaySlot bool) ui
 	cop.Cause = uint32(int64(cop.Cause) & ^0x7c)
 	cop.Cause |= uint32(cause) << 2
 
+	// keep the exception code and the software interrupts
+	cop.Cause &^= CAUSE_BD | CAUSE_BT
 	if inDelaySlot {
+		// EPC points to the branch, which runs again when the handler returns
 		cop.Epc = pc - 4
-		cop.Cause = 1 << 31
+		cop.Cause |= CAUSE_BD
+		if branchTaken {
+			cop.Cause |= CAUSE_BT
+		}
 	} else {
 		cop.Epc = pc
-		cop.Cause = uint32(int64(cop.Cause) & ^(1 << 31))
 	}
 
 	// return exception handler
@@ -65,6 +194,50 @@ func (cop *Cop0) EnterException(cause Exception, pc uint32, inDelaySlot bool) ui
 	return 0x80000080
 }
 
+// Like EnterException, but for hardware breakpoints. They use the debug
+// exception vector, which is 0x40 bytes before the general one
+func (cop *Cop0) EnterDebugException(pc uint32, inDelaySlot, branchTaken bool) uint32 {
+	return cop.EnterException(EXCEPTION_BREAK, pc, inDelaySlot, branchTaken) - 0x40
+}
+
+// Returns true if the execute or the data access breakpoint is enabled
+func (cop *Cop0) BreakpointsEnabled() bool {
+	return cop.Dcic&DCIC_MASTER_MASK == DCIC_MASTER_MASK &&
+		cop.Dcic&(DCIC_CODE_ENABLE|DCIC_DATA_ENABLE) != 0
+}
+
+// Returns true if executing the instruction at `pc` hits the execute
+// breakpoint. Sets the hit flags in DCIC
+func (cop *Cop0) CheckCodeBreakpoint(pc uint32) bool {
+	enable := DCIC_MASTER_MASK | DCIC_CODE_ENABLE
+	if cop.Dcic&enable != enable || (pc^cop.Bpc)&cop.Bpcm != 0 {
+		return false
+	}
+
+	cop.Dcic |= DCIC_HIT_ANY | DCIC_HIT_CODE
+	return true
+}
+
+// Returns true if a read (or a write if `write` is true) at `addr` hits the
+// data access breakpoint. Sets the hit flags in DCIC
+func (cop *Cop0) CheckDataBreakpoint(addr uint32, write bool) bool {
+	enable := DCIC_MASTER_MASK | DCIC_DATA_ENABLE
+	if cop.Dcic&enable != enable || (addr^cop.Bda)&cop.Bdam != 0 {
+		return false
+	}
+
+	kind, hit := DCIC_BREAK_READ, DCIC_HIT_DATA_READ
+	if write {
+		kind, hit = DCIC_BREAK_WRITE, DCIC_HIT_DATA_WRITE
+	}
+	if cop.Dcic&kind == 0 {
+		return false
+	}
+
+	cop.Dcic |= DCIC_HIT_ANY | DCIC_HIT_DATA | hit
+	return true
+}
+
 // Discard the current state of the status register
 func (cop *Cop0) ReturnFromException() {
 	mode := cop.SR & 0x3f
@@ -79,8 +252,9 @@ func (cop *Cop0) IrqEnabled() bool {
 func (cop *Cop0) IrqActive(irqState *IrqState) bool {
 	cause := cop.GetCause(irqState)
 
-	// bits [8:9] contain two software interrupts
-	pending := (cause & cop.SR) & 0x700
+	// bits [9:8] contain two software interrupts and bit 10 the hardware
+	// interrupt
+	pending := (cause & cop.SR) & (CAUSE_SOFTWARE_IRQ_MASK | 1<<10)
 
 	return cop.IrqEnabled() && pending != 0
 }
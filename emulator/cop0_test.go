@@ -0,0 +1,274 @@
+package emulator
+
+import "testing"
+
+func TestCop0ReadBack(t *testing.T) {
+	cop := NewCop0()
+	irqState := NewIrqState()
+
+	for _, reg := range []uint32{COP0_BPC, COP0_BDA, COP0_BDAM, COP0_BPCM} {
+		cop.Write(reg, 0x80012345)
+		if got := cop.Read(reg, irqState); got != 0x80012345 {
+			t.Errorf("cop0r%d: expected 0x80012345, got 0x%x", reg, got)
+		}
+	}
+
+	cop.Write(COP0_DCIC, 0xffffffff)
+	if got := cop.Read(COP0_DCIC, irqState); got != COP0_DCIC_MASK {
+		t.Errorf("DCIC: expected 0x%x, got 0x%x", COP0_DCIC_MASK, got)
+	}
+
+	// read only registers
+	cop.Write(COP0_PRID, 0x1234)
+	if got := cop.Read(COP0_PRID, irqState); got != COP0_PRID_VALUE {
+		t.Errorf("PRID: expected 0x%x, got 0x%x", COP0_PRID_VALUE, got)
+	}
+	cop.Write(COP0_JUMPDEST, 0x1234)
+	if got := cop.Read(COP0_JUMPDEST, irqState); got != 0 {
+		t.Errorf("JUMPDEST: expected 0, got 0x%x", got)
+	}
+}
+
+func TestCop0Breakpoints(t *testing.T) {
+	cop := NewCop0()
+	cop.Bpc = 0x80010000
+	cop.Bpcm = 0xfffffff0
+	cop.Bda = 0x80020000
+	cop.Bdam = 0xffffffff
+
+	if cop.CheckCodeBreakpoint(0x80010004) {
+		t.Error("execute breakpoint hit while disabled")
+	}
+
+	cop.Write(COP0_DCIC, DCIC_MASTER_MASK|DCIC_CODE_ENABLE|DCIC_DATA_ENABLE|DCIC_BREAK_WRITE)
+	if !cop.CheckCodeBreakpoint(0x80010004) {
+		t.Error("execute breakpoint not hit")
+	}
+	if cop.CheckCodeBreakpoint(0x80010010) {
+		t.Error("execute breakpoint hit outside of BPCM")
+	}
+	if cop.CheckDataBreakpoint(0x80020000, false) {
+		t.Error("data breakpoint hit on a read")
+	}
+	if !cop.CheckDataBreakpoint(0x80020000, true) {
+		t.Error("data breakpoint not hit on a write")
+	}
+
+	hits := DCIC_HIT_ANY | DCIC_HIT_CODE | DCIC_HIT_DATA | DCIC_HIT_DATA_WRITE
+	if cop.Dcic&0x3f != hits {
+		t.Errorf("DCIC hit flags: expected 0x%x, got 0x%x", hits, cop.Dcic&0x3f)
+	}
+	if handler := cop.EnterDebugException(0x80010004, false, false); handler != 0x80000040 {
+		t.Errorf("debug exception vector: expected 0x80000040, got 0x%x", handler)
+	}
+}
+
+func TestCop0BadVaddr(t *testing.T) {
+	for _, mode := range []CpuMode{CPU_MODE_INTERPRETER, CPU_MODE_JIT, CPU_MODE_CACHED} {
+		test := cpuTest{
+			Initial: cpuState{Regs: []cpuRegister{{1, 0x80020001}}},
+			Program: []uint32{
+				asmI(0x2b, 2, 1, 2), // sw r2, 2(r1)
+			},
+		}
+		cpu := test.makeCpu(mode)
+		for steps := 0; cpu.PC != 0x80000080; steps++ {
+			if steps > 10 {
+				t.Fatalf("mode %d: expected an address error", mode)
+			}
+			cpu.Step()
+		}
+
+		if cause := Exception((cpu.Cop0.Cause >> 2) & 0x1f); cause != EXCEPTION_STORE_ADDRESS_ERROR {
+			t.Errorf("mode %d: expected a store address error, got 0x%x", mode, cause)
+		}
+		if got := cpu.Cop0.Read(COP0_BADVADDR, cpu.Inter.IrqState); got != 0x80020003 {
+			t.Errorf("mode %d: BadVaddr: expected 0x80020003, got 0x%08x", mode, got)
+		}
+	}
+}
+
+func TestCop0SoftwareInterrupt(t *testing.T) {
+	test := cpuTest{
+		Initial: cpuState{Regs: []cpuRegister{{1, 0x201}, {2, 0x300}}},
+		Program: []uint32{
+			0x10<<26 | 4<<21 | 1<<16 | COP0_SR<<11,    // mtc0 r1, SR
+			0x10<<26 | 4<<21 | 2<<16 | COP0_CAUSE<<11, // mtc0 r2, CAUSE
+			0,
+		},
+	}
+	cpu := test.makeCpu(CPU_MODE_INTERPRETER)
+	for steps := 0; cpu.PC != 0x80000080; steps++ {
+		if steps > 10 {
+			t.Fatal("expected the software interrupt to be raised")
+		}
+		cpu.Step()
+	}
+
+	cause := cpu.Cop0.Read(COP0_CAUSE, cpu.Inter.IrqState)
+	if Exception((cause>>2)&0x1f) != EXCEPTION_INTERRUPT || cause&CAUSE_SOFTWARE_IRQ_MASK != 0x300 {
+		t.Errorf("expected an interrupt with both software interrupts pending, got CAUSE 0x%08x", cause)
+	}
+	if cpu.Cop0.Epc != CPU_TEST_BASE+8 {
+		t.Errorf("expected EPC 0x%08x, got 0x%08x", CPU_TEST_BASE+8, cpu.Cop0.Epc)
+	}
+
+	// the interrupt stays pending until the handler clears it
+	cpu.Cop0.Write(COP0_CAUSE, 0)
+	cpu.Cop0.ReturnFromException()
+	if cpu.Cop0.IrqActive(cpu.Inter.IrqState) {
+		t.Error("expected the interrupt to be cleared")
+	}
+}
+
+func TestCop0BusError(t *testing.T) {
+	for _, mode := range []CpuMode{CPU_MODE_INTERPRETER, CPU_MODE_JIT, CPU_MODE_CACHED} {
+		test := cpuTest{
+			Initial: cpuState{Regs: []cpuRegister{{1, 0x80400000}, {2, 0x1234}}},
+			Program: []uint32{
+				asmI(0x23, 2, 1, 0), // lw r2, 0(r1)
+			},
+		}
+		cpu := test.makeCpu(mode)
+		cpu.Inter.Store32(0x1f801060, 4<<9, cpu.Th) // 2MB memory, 6MB locked
+		for steps := 0; cpu.PC != 0x80000080; steps++ {
+			if steps > 10 {
+				t.Fatalf("mode %d: expected a bus error", mode)
+			}
+			cpu.Step()
+		}
+
+		if cause := Exception((cpu.Cop0.Cause >> 2) & 0x1f); cause != EXCEPTION_DATA_BUS {
+			t.Errorf("mode %d: expected a data bus error, got 0x%x", mode, cause)
+		}
+		if cpu.Reg(2) != 0x1234 || cpu.Load.Pending(2) {
+			t.Errorf("mode %d: the load wasn't cancelled", mode)
+		}
+	}
+}
+
+// Exception raised by a test program, checked like the BIOS handler does
+type exceptionTest struct {
+	Desc     string
+	Initial  cpuState
+	Program  []uint32
+	Cause    Exception
+	Epc      uint32
+	Bd, Bt   bool   // Expected BD and BT bits of CAUSE
+	JumpDest uint32 // Expected JUMPDEST if BT is set
+	Ce       uint32 // Expected coprocessor number (CE) of a coprocessor unusable exception
+	BadVaddr uint32 // Expected BadVaddr of a misaligned data access
+}
+
+var exceptionTests = []exceptionTest{
+	{
+		Desc: "SYSCALL in the delay slot of a taken branch",
+		Program: []uint32{
+			asmI(0x04, 0, 0, 2), // beq r0, r0, +2
+			0xc,                 // syscall
+		},
+		Cause: EXCEPTION_SYSCALL, Epc: CPU_TEST_BASE,
+		Bd: true, Bt: true, JumpDest: CPU_TEST_BASE + 12,
+	},
+	{
+		Desc: "SYSCALL in the delay slot of a branch that isn't taken",
+		Program: []uint32{
+			asmI(0x05, 0, 0, 2), // bne r0, r0, +2
+			0xc,                 // syscall
+		},
+		Cause: EXCEPTION_SYSCALL, Epc: CPU_TEST_BASE, Bd: true,
+	},
+	{
+		Desc: "SYSCALL in the delay slot of a jump",
+		Program: []uint32{
+			asmJ(0x02, CPU_TEST_BASE+0x20), // j +0x20
+			0xc,                            // syscall
+		},
+		Cause: EXCEPTION_SYSCALL, Epc: CPU_TEST_BASE,
+		Bd: true, Bt: true, JumpDest: CPU_TEST_BASE + 0x20,
+	},
+	{
+		Desc:    "fetch from a misaligned jump target isn't in the delay slot",
+		Initial: cpuState{Regs: []cpuRegister{{1, CPU_TEST_BASE + 0x102}}},
+		Program: []uint32{
+			asmR(0x08, 0, 1, 0), // jr r1
+			0,
+		},
+		Cause: EXCEPTION_LOAD_ADDRESS_ERROR, Epc: CPU_TEST_BASE + 0x102,
+	},
+	{
+		Desc:    "an interrupt is taken before the address error of the instruction",
+		Initial: cpuState{Regs: []cpuRegister{{1, 0x101}, {2, 0x100}, {4, 0x80020000}}},
+		Program: []uint32{
+			0x10<<26 | 4<<21 | 1<<16 | COP0_SR<<11,    // mtc0 r1, SR
+			0x10<<26 | 4<<21 | 2<<16 | COP0_CAUSE<<11, // mtc0 r2, CAUSE
+			asmI(0x23, 3, 4, 1),                       // lw r3, 1(r4)
+		},
+		Cause: EXCEPTION_INTERRUPT, Epc: CPU_TEST_BASE + 8,
+	},
+	{
+		Desc:    "COP2 with CU2 cleared",
+		Initial: cpuState{Regs: []cpuRegister{{1, 0}}},
+		Program: []uint32{
+			0x10<<26 | 4<<21 | 1<<16 | COP0_SR<<11, // mtc0 r1, SR
+			0x12<<26 | 2<<16,                       // mfc2 r2, 0
+		},
+		Cause: EXCEPTION_COPROCESSOR_ERROR, Epc: CPU_TEST_BASE + 4, Ce: 2,
+	},
+	{
+		Desc:    "LWC2 with CU2 cleared doesn't check the address",
+		Initial: cpuState{Regs: []cpuRegister{{1, 0}, {4, 0x80020000}}},
+		Program: []uint32{
+			0x10<<26 | 4<<21 | 1<<16 | COP0_SR<<11, // mtc0 r1, SR
+			asmI(0x32, 0, 4, 1),                    // lwc2 0, 1(r4)
+		},
+		Cause: EXCEPTION_COPROCESSOR_ERROR, Epc: CPU_TEST_BASE + 4, Ce: 2,
+	},
+	{
+		Desc:    "misaligned SWC2",
+		Initial: cpuState{Regs: []cpuRegister{{1, 1 << 30}, {4, 0x80020000}}},
+		Program: []uint32{
+			0x10<<26 | 4<<21 | 1<<16 | COP0_SR<<11, // mtc0 r1, SR (CU2)
+			asmI(0x3a, 0, 4, 2),                    // swc2 0, 2(r4)
+		},
+		Cause: EXCEPTION_STORE_ADDRESS_ERROR, Epc: CPU_TEST_BASE + 4, BadVaddr: 0x80020002,
+	},
+}
+
+func TestCop0ExceptionPriority(t *testing.T) {
+	for _, mode := range []CpuMode{CPU_MODE_INTERPRETER, CPU_MODE_JIT, CPU_MODE_CACHED} {
+		for _, test := range exceptionTests {
+			program := cpuTest{Initial: test.Initial, Program: test.Program}
+			cpu := program.makeCpu(mode)
+			for steps := 0; cpu.PC != 0x80000080; steps++ {
+				if steps > 10 {
+					t.Fatalf("mode %d: %s: expected an exception", mode, test.Desc)
+				}
+				cpu.Step()
+			}
+
+			cause := cpu.Cop0.Cause
+			if got := Exception((cause >> 2) & 0x1f); got != test.Cause {
+				t.Errorf("mode %d: %s: expected exception 0x%x, got 0x%x", mode, test.Desc, test.Cause, got)
+			}
+			if cpu.Cop0.Epc != test.Epc {
+				t.Errorf("mode %d: %s: expected EPC 0x%08x, got 0x%08x", mode, test.Desc, test.Epc, cpu.Cop0.Epc)
+			}
+			if bd, bt := cause&CAUSE_BD != 0, cause&CAUSE_BT != 0; bd != test.Bd || bt != test.Bt {
+				t.Errorf("mode %d: %s: expected BD %t and BT %t, got %t and %t", mode, test.Desc, test.Bd, test.Bt, bd, bt)
+			}
+			if test.Bt && cpu.Cop0.JumpDest != test.JumpDest {
+				t.Errorf("mode %d: %s: expected JUMPDEST 0x%08x, got 0x%08x", mode, test.Desc, test.JumpDest, cpu.Cop0.JumpDest)
+			}
+			if test.Cause == EXCEPTION_LOAD_ADDRESS_ERROR && test.BadVaddr == 0 && cpu.Cop0.BadVaddr != test.Epc {
+				t.Errorf("mode %d: %s: expected BadVaddr 0x%08x, got 0x%08x", mode, test.Desc, test.Epc, cpu.Cop0.BadVaddr)
+			}
+			if test.BadVaddr != 0 && cpu.Cop0.BadVaddr != test.BadVaddr {
+				t.Errorf("mode %d: %s: expected BadVaddr 0x%08x, got 0x%08x", mode, test.Desc, test.BadVaddr, cpu.Cop0.BadVaddr)
+			}
+			if ce := (cause >> 28) & 3; ce != test.Ce {
+				t.Errorf("mode %d: %s: expected CE %d, got %d", mode, test.Desc, test.Ce, ce)
+			}
+		}
+	}
+}
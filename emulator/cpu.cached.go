@@ -0,0 +1,156 @@
+package emulator
+
+// Returns a handler that uses the pre-decoded operands for the most common
+// instructions, or nil if the instruction should go through its Op* method
+func decodedOp(instruction Instruction) JitOp {
+	switch instruction.Function() {
+	case 0b000000:
+		switch instruction.Subfunction() {
+		case 0b000000: // Shift Left Logical
+			return decodedSLL
+		case 0b000010: // Shift Right Logical
+			return decodedSRL
+		case 0b100101: // Bitwise OR
+			return decodedOR
+		case 0b100100: // Bitwise AND
+			return decodedAND
+		case 0b101011: // Set on Less Than Unsigned
+			return decodedSLTU
+		case 0b100001: // Add Unsigned
+			return decodedADDU
+		case 0b100011: // Subtract Unsigned
+			return decodedSUBU
+		case 0b001000: // Jump Register
+			return decodedJR
+		}
+	case 0b001111: // Load Upper Immediate
+		return decodedLUI
+	case 0b001101: // Bitwise Or Immediate
+		return decodedORI
+	case 0b001100: // Bitwise And Immediate
+		return decodedANDI
+	case 0b001001: // Add Immediate Unsigned
+		return decodedADDIU
+	case 0b100011: // Load Word
+		return decodedLW
+	case 0b100100: // Load Byte Unsigned
+		return decodedLBU
+	case 0b101011: // Store Word
+		return decodedSW
+	case 0b101000: // Store Byte
+		return decodedSB
+	case 0b000100: // Branch if Equal
+		return decodedBEQ
+	case 0b000101: // Branch if Not Equal
+		return decodedBNE
+	}
+	return nil
+}
+
+// Shift Left Logical
+func decodedSLL(cpu *CPU, in *JitInstruction) {
+	cpu.SetReg(in.D, cpu.Reg(in.T)<<in.Shift)
+}
+
+// Shift Right Logical
+func decodedSRL(cpu *CPU, in *JitInstruction) {
+	cpu.SetReg(in.D, cpu.Reg(in.T)>>in.Shift)
+}
+
+// Bitwise OR
+func decodedOR(cpu *CPU, in *JitInstruction) {
+	cpu.SetReg(in.D, cpu.Reg(in.S)|cpu.Reg(in.T))
+}
+
+// Bitwise AND
+func decodedAND(cpu *CPU, in *JitInstruction) {
+	cpu.SetReg(in.D, cpu.Reg(in.S)&cpu.Reg(in.T))
+}
+
+// Set on Less Than Unsigned
+func decodedSLTU(cpu *CPU, in *JitInstruction) {
+	var v uint32
+	if cpu.Reg(in.S) < cpu.Reg(in.T) {
+		v = 1
+	}
+	cpu.SetReg(in.D, v)
+}
+
+// Add Unsigned
+func decodedADDU(cpu *CPU, in *JitInstruction) {
+	cpu.SetReg(in.D, cpu.Reg(in.S)+cpu.Reg(in.T))
+}
+
+// Subtract Unsigned
+func decodedSUBU(cpu *CPU, in *JitInstruction) {
+	cpu.SetReg(in.D, cpu.Reg(in.S)-cpu.Reg(in.T))
+}
+
+// Jump Register
+func decodedJR(cpu *CPU, in *JitInstruction) {
+	cpu.jump(cpu.Reg(in.S))
+	cpu.Debugger.jumpRegister(cpu.NextPC)
+}
+
+// Load Upper Immediate
+func decodedLUI(cpu *CPU, in *JitInstruction) {
+	cpu.SetReg(in.T, in.Imm<<16)
+}
+
+// Bitwise Or Immediate
+func decodedORI(cpu *CPU, in *JitInstruction) {
+	cpu.SetReg(in.T, cpu.Reg(in.S)|in.Imm)
+}
+
+// Bitwise And Immediate
+func decodedANDI(cpu *CPU, in *JitInstruction) {
+	cpu.SetReg(in.T, cpu.Reg(in.S)&in.Imm)
+}
+
+// Add Immediate Unsigned
+func decodedADDIU(cpu *CPU, in *JitInstruction) {
+	cpu.SetReg(in.T, cpu.Reg(in.S)+in.ImmSE)
+}
+
+// Load Word
+func decodedLW(cpu *CPU, in *JitInstruction) {
+	addr := cpu.Reg(in.S) + in.ImmSE
+	if addr%4 != 0 {
+		cpu.AddressError(EXCEPTION_LOAD_ADDRESS_ERROR, addr)
+		return
+	}
+
+	// put the load in the delay slot
+	cpu.delayedLoad(in.T, cpu.Load32(addr))
+}
+
+// Load Byte Unsigned
+func decodedLBU(cpu *CPU, in *JitInstruction) {
+	addr := cpu.Reg(in.S) + in.ImmSE
+	cpu.delayedLoad(in.T, uint32(cpu.Load8(addr)))
+}
+
+// Store Word
+func decodedSW(cpu *CPU, in *JitInstruction) {
+	addr := cpu.Reg(in.S) + in.ImmSE
+	if addr%4 != 0 {
+		cpu.AddressError(EXCEPTION_STORE_ADDRESS_ERROR, addr)
+		return
+	}
+	cpu.Store32(addr, cpu.Reg(in.T))
+}
+
+// Store Byte
+func decodedSB(cpu *CPU, in *JitInstruction) {
+	cpu.Store8(cpu.Reg(in.S)+in.ImmSE, uint8(cpu.Reg(in.T)))
+}
+
+// Branch if Equal
+func decodedBEQ(cpu *CPU, in *JitInstruction) {
+	cpu.BranchIf(cpu.Reg(in.S) == cpu.Reg(in.T), in.ImmSE)
+}
+
+// Branch if Not Equal
+func decodedBNE(cpu *CPU, in *JitInstruction) {
+	cpu.BranchIf(cpu.Reg(in.S) != cpu.Reg(in.T), in.ImmSE)
+}
@@ -1,7 +1,5 @@
 package emulator
 
-import "fmt"
-
 const CPU_FREQ_HZ uint32 = 33_868_500
 
 // CPU state
@@ -18,28 +16,40 @@ type CPU struct {
 	// 2nd set of registers to emulate the load delay slot correctly. They
 	// contain the output of the current instruction
 	OutRegs [32]uint32
-	// Load initiated by the current instruction. The first value is the register
-	// index, the second value is the value
-	Load [2]uint32
+	// Load initiated by the current instruction, see LoadDelay
+	Load LoadDelay
 	// Memory interface
 	Inter *Interconnect
-	// Set by the current instruction if a branch occurred and the next instruction
-	// will be in the delay slot
+	// Set by the current instruction if it's a branch or a jump, the next
+	// instruction will be in the delay slot
 	BranchOccured bool
+	// Set by the current instruction if it's a taken branch or a jump
+	BranchTaken bool
 	// Set if the current instruction executes in the delay slot
 	DelaySlot bool
+	// Set if the current instruction executes in the delay slot of a taken
+	// branch
+	DelaySlotTaken bool
+	// Set if the current instruction hit the data access breakpoint
+	DataBreak bool
 
 	Cop0 *Cop0 // Coprocessor 0: System Control
 	// HI register for division remainder and multiplication high result
 	Hi uint32
 	// LO register for division quotient and multiplication low result
 	Lo uint32
+	// CPU cycle at which the last multiplication or division finishes
+	MultDivBusyUntil uint64
 	// Cop0 register 13: Cause Register
 	Debugger *Debugger
 	// Instruction Cache (256 cache lines)
 	ICache [0x100]*ICacheLine
 	Th     *TimeHandler // Keeps track of the emulation time
 	Gte    *GTE         // Geometry Transformation Engine (coprocessor 2)
+	Mode   CpuMode      // Execution mode, changed with SetMode
+	Jit    *Jit         // Compiled blocks, nil in interpreter mode
+	Hle    *BiosHle     // High-level emulation of BIOS functions, can be nil
+	Tty    TtyOutput    // Receives the characters printed by the BIOS, can be nil
 }
 
 // Creates a new CPU state
@@ -73,6 +83,32 @@ func NewCPU(inter *Interconnect) *CPU {
 	return cpu
 }
 
+// Jumps to the reset vector at the beginning of the BIOS, like when the
+// reset button is pressed. The BIOS reinitializes the rest of the hardware
+func (cpu *CPU) Reset() {
+	cpu.PC = 0xbfc00000
+	cpu.NextPC = cpu.PC + 4
+	cpu.CurrentPC = 0
+	cpu.Load.Reset()
+	cpu.BranchOccured = false
+	cpu.BranchTaken = false
+	cpu.DelaySlot = false
+	cpu.DelaySlotTaken = false
+	cpu.DataBreak = false
+	cpu.Debugger.CallStack.Reset()
+	cpu.Inter.Achievements.Reset()
+	cpu.Cop0 = NewCop0()
+	cpu.Gte = cpu.Inter.Gte
+	copy(cpu.OutRegs[:], cpu.Regs[:])
+
+	for i := 0; i < len(cpu.ICache); i++ {
+		cpu.ICache[i] = NewCacheLine()
+	}
+	if cpu.Jit != nil {
+		cpu.Jit.Flush()
+	}
+}
+
 // Runs the instruction at the program counter and increments it
 func (cpu *CPU) RunNextInstruction() {
 	// synchronize peripherals
@@ -86,20 +122,36 @@ func (cpu *CPU) RunNextInstruction() {
 	cpu.CurrentPC = pc
 
 	// debugger entrypoint
-	cpu.Debugger.changedPc(pc)
+	cpu.Debugger.changedPc(pc, cpu.Th.CpuCycles)
+
+	// if the last instruction was a branch then we're in the delay slot. This
+	// is set before the fetch, which can raise an exception too
+	cpu.enterDelaySlot()
 
 	// FIXME: there's no need to check if PC is incorrectly aligned for each instruction,
 	//        instead we could make jump and branch instructions not capable of setting
 	//        unaligned PC addresses
 	if cpu.CurrentPC%4 != 0 {
 		// PC is not correctly aligned
-		fmt.Println("cpu: PC is not correctly aligned!")
-		cpu.Exception(EXCEPTION_LOAD_ADDRESS_ERROR)
+		Log.Warnf(LOG_MODULE_CPU, "PC 0x%x is not correctly aligned", pc)
+		cpu.AddressError(EXCEPTION_LOAD_ADDRESS_ERROR, pc)
+		return
+	}
+
+	// hardware breakpoint on the instruction, it doesn't run
+	if cpu.Cop0.CheckCodeBreakpoint(pc) {
+		cpu.PC = cpu.Cop0.EnterDebugException(pc, cpu.DelaySlot, cpu.DelaySlotTaken)
+		cpu.NextPC = cpu.PC + 4
 		return
 	}
 
 	// fetch instruction at PC
 	instruction := cpu.FetchInstruction()
+	if cpu.Inter.BusError {
+		cpu.Inter.BusError = false
+		cpu.Exception(EXCEPTION_INSTRUCTION_BUS)
+		return
+	}
 
 	// increment PC to point to the next instruction (all instructions are 32 bit long)
 	cpu.PC = cpu.NextPC
@@ -108,16 +160,7 @@ func (cpu *CPU) RunNextInstruction() {
 	// execute the pending load (if any, otherwise it will load $zero, which is a NOP)
 	// `cpu.SetReg` only works on `cpu.OutRegs`, so this operation won't be visible by
 	// the next instruction
-	reg, val := cpu.Load[0], cpu.Load[1]
-	cpu.SetReg(reg, val)
-
-	// reset the load to target register 0 for the next instruction
-	cpu.Load[0] = 0
-	cpu.Load[1] = 0
-
-	// if the last instruction was a branch then we're in the delay slot
-	cpu.DelaySlot = cpu.BranchOccured
-	cpu.BranchOccured = false
+	cpu.commitLoad()
 
 	if cpu.Cop0.IrqActive(cpu.Inter.IrqState) {
 		cpu.Exception(EXCEPTION_INTERRUPT)
@@ -125,9 +168,29 @@ func (cpu *CPU) RunNextInstruction() {
 		// no interrupts pending
 		cpu.DecodeAndExecute(instruction)
 	}
+	cpu.checkBusError()
 
 	// copy the output registers as input for the next instruction
 	copy(cpu.Regs[:], cpu.OutRegs[:])
+
+	// the data access breakpoint triggers after the access is done, the
+	// handler returns to the next instruction
+	if cpu.DataBreak {
+		cpu.DataBreak = false
+		cpu.PC = cpu.Cop0.EnterDebugException(cpu.PC, cpu.BranchOccured, cpu.BranchTaken)
+		cpu.NextPC = cpu.PC + 4
+		cpu.BranchOccured = false
+		cpu.BranchTaken = false
+	}
+}
+
+// Moves the branch flags of the last instruction to the delay slot flags of
+// the current one
+func (cpu *CPU) enterDelaySlot() {
+	cpu.DelaySlot = cpu.BranchOccured
+	cpu.DelaySlotTaken = cpu.BranchTaken
+	cpu.BranchOccured = false
+	cpu.BranchTaken = false
 }
 
 func (cpu *CPU) FetchInstruction() Instruction {
@@ -145,6 +208,7 @@ func (cpu *CPU) FetchInstruction() Instruction {
 		// check line tag and validity
 		if line.Tag() != tag || line.ValidIndex() > index {
 			// cache miss, get the cacheline at the current index
+			cpu.Debugger.ICache.Misses++
 			cpc := pc
 
 			// fetching takes 3 cycles + 1 instruction on average
@@ -158,70 +222,97 @@ func (cpu *CPU) FetchInstruction() Instruction {
 			}
 
 			line.SetTagValid(pc) // set tag and valid bits
+		} else {
+			cpu.Debugger.ICache.Hits++
 		}
 
 		return line.Get(index)
 	}
 
-	// cache is disabled, get instruction from memory
-	// this takes 4 cycles on average
-	cpu.Th.Tick(4)
+	// cache is disabled, get instruction from memory. BIOS fetches depend
+	// on the BIOS delay register
+	cpu.Th.Tick(cpu.Inter.FetchCycles(pc))
 	return Instruction(cpu.Inter.LoadInstruction(pc))
 }
 
 // Returns a 32bit little endian value at `addr`
 func (cpu *CPU) Load32(addr uint32) uint32 {
 	cpu.Debugger.memoryRead(addr)
+	cpu.Inter.HeatMap.read(addr)
+	cpu.DataBreak = cpu.DataBreak || cpu.Cop0.CheckDataBreakpoint(addr, false)
 	return cpu.Inter.Load32(addr, cpu.Th)
 }
 
 // Returns a 16bit little endian value at `addr`
 func (cpu *CPU) Load16(addr uint32) uint16 {
 	cpu.Debugger.memoryRead(addr)
+	cpu.Inter.HeatMap.read(addr)
+	cpu.DataBreak = cpu.DataBreak || cpu.Cop0.CheckDataBreakpoint(addr, false)
 	return cpu.Inter.Load16(addr, cpu.Th)
 }
 
 // Returns the byte at `addr`
 func (cpu *CPU) Load8(addr uint32) byte {
 	cpu.Debugger.memoryRead(addr)
+	cpu.Inter.HeatMap.read(addr)
+	cpu.DataBreak = cpu.DataBreak || cpu.Cop0.CheckDataBreakpoint(addr, false)
 	return cpu.Inter.Load8(addr, cpu.Th)
 }
 
-func (cpu *CPU) Store(addr uint32, size AccessSize, val interface{}) {
+func (cpu *CPU) Store(addr uint32, size AccessSize, val uint32) {
 	if cpu.Cop0.CacheIsolated() {
 		cpu.CacheMaintenance(addr, size, val)
 	} else {
 		cpu.Debugger.memoryWrite(addr)
-		cpu.Inter.Store(addr, size, val, cpu.Th)
+		cpu.Inter.HeatMap.write(addr)
+		cpu.DataBreak = cpu.DataBreak || cpu.Cop0.CheckDataBreakpoint(addr, true)
+
+		switch size {
+		case ACCESS_BYTE:
+			cpu.Inter.Store8(addr, uint8(val), cpu.Th)
+		case ACCESS_HALFWORD:
+			cpu.Inter.Store16(addr, uint16(val), cpu.Th)
+		default:
+			cpu.Inter.Store32(addr, val, cpu.Th)
+		}
 	}
 }
 
-// Handles writes when the cache is isolated
-func (cpu *CPU) CacheMaintenance(addr uint32, size AccessSize, val interface{}) {
-	// FIXME: this is not the full cache implementation, just cache invalidation
-	//        for now
+// Handles writes when the cache is isolated. They never reach memory
+func (cpu *CPU) CacheMaintenance(addr uint32, size AccessSize, val uint32) {
 	cc := cpu.Inter.CacheCtrl
-	valU32 := accessSizeToU32(size, val)
-
 	if !cc.ICacheEnabled() {
-		panicFmt("cpu: cache maintenance while instruction cache is disabled 0x%x", valU32)
-	}
-	if size != ACCESS_WORD || valU32 != 0 {
-		panicFmt("cpu: unsupported write while cache is isolated 0x%x", valU32)
+		// the write goes nowhere
+		return
 	}
 
 	// get the cache line for this address
 	line := cpu.ICache[(addr>>4)&0xff]
 
 	if cc.TagTestMode() {
-		// in tag test mode, the write will invalidate the entire targeted
-		// cache line
-		line.Invalidate()
+		// in tag test mode, the write replaces the tag of the targeted
+		// cache line and clears its valid bits, whatever the value is
+		line.Invalidate(addr)
+		cpu.Debugger.ICache.Invalidations++
 	} else {
-		// the write ends up directly in the cache
+		// the write ends up directly in the cache, smaller writes are
+		// shifted into place like on the bus. The tag is left as is, so
+		// the line only becomes valid again after a tag write or a refill
 		index := (addr >> 2) & 3
-		instruction := Instruction(valU32)
-		line.Set(index, instruction)
+		shift := (addr & 3) * 8
+		switch size {
+		case ACCESS_BYTE:
+			val = (val & 0xff) << shift
+		case ACCESS_HALFWORD:
+			val = (val & 0xffff) << shift
+		}
+		line.Set(index, Instruction(val))
+		cpu.Debugger.ICache.DataWrites++
+	}
+
+	// compiled blocks may not match the cache anymore
+	if cpu.Jit != nil {
+		cpu.Jit.Flush()
 	}
 }
 
@@ -232,12 +323,12 @@ func (cpu *CPU) Store32(addr, val uint32) {
 
 // Store 16 bit value into memory
 func (cpu *CPU) Store16(addr uint32, val uint16) {
-	cpu.Store(addr, ACCESS_HALFWORD, val)
+	cpu.Store(addr, ACCESS_HALFWORD, uint32(val))
 }
 
 // Store 8 bit value into memory
 func (cpu *CPU) Store8(addr uint32, val uint8) {
-	cpu.Store(addr, ACCESS_BYTE, val)
+	cpu.Store(addr, ACCESS_BYTE, uint32(val))
 }
 
 // Decodes and executes an instruction. Panics if the instruction is unhandled
@@ -431,7 +522,7 @@ func (cpu *CPU) OpSW(instruction Instruction) {
 	if addr%4 == 0 {
 		cpu.Store32(addr, v)
 	} else {
-		cpu.Exception(EXCEPTION_STORE_ADDRESS_ERROR)
+		cpu.AddressError(EXCEPTION_STORE_ADDRESS_ERROR, addr)
 	}
 }
 
@@ -440,8 +531,26 @@ func (cpu *CPU) Branch(offset uint32) {
 	// offset immediates are always shifted two places to the right since `PC`
 	// addresses have to be aligned on 32 bits at all times
 	offset <<= 2
-	cpu.NextPC = cpu.PC + offset
+	cpu.jump(cpu.PC + offset)
+}
+
+// Branch to immediate value `offset` if `taken` is true. The next
+// instruction is in the delay slot even if the branch isn't taken
+func (cpu *CPU) BranchIf(taken bool, offset uint32) {
+	if taken {
+		cpu.Branch(offset)
+	} else {
+		cpu.BranchOccured = true
+	}
+}
+
+// Jumps to `target` after the delay slot. The target is saved in the
+// JUMPDEST register
+func (cpu *CPU) jump(target uint32) {
+	cpu.NextPC = target
 	cpu.BranchOccured = true
+	cpu.BranchTaken = true
+	cpu.Cop0.JumpDest = target
 }
 
 // Branch if Not Equal
@@ -450,9 +559,7 @@ func (cpu *CPU) OpBNE(instruction Instruction) {
 	s := instruction.S()
 	t := instruction.T()
 
-	if cpu.Reg(s) != cpu.Reg(t) {
-		cpu.Branch(i)
-	}
+	cpu.BranchIf(cpu.Reg(s) != cpu.Reg(t), i)
 }
 
 // Shift Left Logical
@@ -480,8 +587,7 @@ func (cpu *CPU) OpJ(instruction Instruction) {
 	i := instruction.ImmJump()
 	// the instructions must be aligned to a 32 bit boundary, so really
 	// J encodes 28 bits of the target address (shifted by 2)
-	cpu.NextPC = (cpu.NextPC & 0xf0000000) | (i << 2)
-	cpu.BranchOccured = true
+	cpu.jump((cpu.NextPC & 0xf0000000) | (i << 2))
 }
 
 // Bitwise OR
@@ -522,20 +628,7 @@ func (cpu *CPU) OpMTC0(instruction Instruction) {
 	cpuR := instruction.T()
 	copR := instruction.D()
 
-	val := cpu.Reg(cpuR)
-
-	switch copR {
-	case 3, 5, 6, 7, 9, 11: // breakpoints registers
-		if val != 0 {
-			panicFmt("cpu: unhandled write of 0x%x to cop0r%d", val, copR)
-		}
-	case 12: // status register
-		cpu.Cop0.SetSR(val)
-	case 13: // cause register
-		cpu.Cop0.SetCause(val)
-	default:
-		panicFmt("cpu: unhandled cop0 register 0x%x", copR)
-	}
+	cpu.Cop0.Write(copR, cpu.Reg(cpuR))
 }
 
 // Add Immediate Unsigned and check for overflow
@@ -566,10 +659,9 @@ func (cpu *CPU) OpLW(instruction Instruction) {
 	if addr%4 == 0 {
 		v := cpu.Load32(addr)
 		// put the load in the delay slot
-		cpu.Load[0] = t
-		cpu.Load[1] = v
+		cpu.delayedLoad(t, v)
 	} else {
-		cpu.Exception(EXCEPTION_LOAD_ADDRESS_ERROR)
+		cpu.AddressError(EXCEPTION_LOAD_ADDRESS_ERROR, addr)
 	}
 }
 
@@ -611,7 +703,7 @@ func (cpu *CPU) OpSH(instruction Instruction) {
 		v := cpu.Reg(t)
 		cpu.Store16(addr, uint16(v))
 	} else {
-		cpu.Exception(EXCEPTION_STORE_ADDRESS_ERROR)
+		cpu.AddressError(EXCEPTION_STORE_ADDRESS_ERROR, addr)
 	}
 }
 
@@ -622,6 +714,7 @@ func (cpu *CPU) OpJAL(instruction Instruction) {
 	cpu.OpJ(instruction)
 	cpu.SetReg(31, ra)
 	// `cpu.BranchOccured = true` is set by `cpu.OpJ` above
+	cpu.Debugger.call(cpu.CurrentPC, cpu.NextPC, ra)
 }
 
 // Store Byte
@@ -637,8 +730,8 @@ func (cpu *CPU) OpSB(instruction Instruction) {
 // Jump Register
 func (cpu *CPU) OpJR(instruction Instruction) {
 	s := instruction.S()
-	cpu.NextPC = cpu.Reg(s)
-	cpu.BranchOccured = true
+	cpu.jump(cpu.Reg(s))
+	cpu.Debugger.jumpRegister(cpu.NextPC)
 }
 
 // Jump And Link Register
@@ -647,11 +740,11 @@ func (cpu *CPU) OpJALR(instruction Instruction) {
 	s := instruction.S()
 
 	ra := cpu.NextPC
-	cpu.NextPC = cpu.Reg(s)
+	cpu.jump(cpu.Reg(s))
+	cpu.Debugger.call(cpu.CurrentPC, cpu.NextPC, ra)
 
 	// store return address in `d`
 	cpu.SetReg(d, ra)
-	cpu.BranchOccured = true
 }
 
 // Load Byte
@@ -666,8 +759,7 @@ func (cpu *CPU) OpLB(instruction Instruction) {
 	v := int8(cpu.Load8(addr))
 
 	// put the load in the delay slot
-	cpu.Load[0] = t
-	cpu.Load[1] = uint32(v)
+	cpu.delayedLoad(t, uint32(v))
 }
 
 // Branch if Equal
@@ -676,9 +768,7 @@ func (cpu *CPU) OpBEQ(instruction Instruction) {
 	s := instruction.S()
 	t := instruction.T()
 
-	if cpu.Reg(s) == cpu.Reg(t) {
-		cpu.Branch(i)
-	}
+	cpu.BranchIf(cpu.Reg(s) == cpu.Reg(t), i)
 }
 
 // Move From Coprocessor 0
@@ -686,20 +776,7 @@ func (cpu *CPU) OpMFC0(instruction Instruction) {
 	cpuR := instruction.T()
 	copR := instruction.D()
 
-	var v uint32
-	switch copR {
-	case 12:
-		v = cpu.Cop0.SR
-	case 13: // cause register
-		v = cpu.Cop0.Cause
-	case 14: // exception PC
-		v = cpu.Cop0.Epc
-	default:
-		panicFmt("cpu: unhandled read from cop0r%d", copR)
-	}
-
-	cpu.Load[0] = cpuR
-	cpu.Load[1] = v
+	cpu.delayedLoad(cpuR, cpu.Cop0.Read(copR, cpu.Inter.IrqState))
 }
 
 // Add and generate an exception on overflow
@@ -727,9 +804,7 @@ func (cpu *CPU) OpBGTZ(instruction Instruction) {
 
 	// the comparison is done in signed integers
 	v := int32(cpu.Reg(s))
-	if v > 0 {
-		cpu.Branch(i)
-	}
+	cpu.BranchIf(v > 0, i)
 }
 
 // Branch if Less than or Equal to Zero
@@ -739,9 +814,7 @@ func (cpu *CPU) OpBLEZ(instruction Instruction) {
 
 	// the comparison is done in signed integers
 	v := int32(cpu.Reg(s))
-	if v <= 0 {
-		cpu.Branch(i)
-	}
+	cpu.BranchIf(v <= 0, i)
 }
 
 // Load Byte Unsigned
@@ -754,8 +827,7 @@ func (cpu *CPU) OpLBU(instruction Instruction) {
 	v := cpu.Load8(addr)
 
 	// put the load in the delay slot
-	cpu.Load[0] = t
-	cpu.Load[1] = uint32(v)
+	cpu.delayedLoad(t, uint32(v))
 }
 
 // BGEZ, BLTZ, BGEZAL, BLTZAL. Bits 16 and 20 are used to figure out which
@@ -785,8 +857,9 @@ func (cpu *CPU) OpBXX(instruction Instruction) {
 		// store return address in R31
 		cpu.SetReg(31, ra)
 	}
-	if test != 0 {
-		cpu.Branch(i)
+	cpu.BranchIf(test != 0, i)
+	if isLink && test != 0 {
+		cpu.Debugger.call(cpu.CurrentPC, cpu.NextPC, cpu.PC+4)
 	}
 }
 
@@ -843,6 +916,7 @@ func (cpu *CPU) OpDIV(instruction Instruction) {
 
 	n := int32(cpu.Reg(s))
 	d := int32(cpu.Reg(t))
+	cpu.startMultDiv(DIV_CYCLES)
 
 	if d == 0 {
 		// division by zero, results are bogus
@@ -870,6 +944,7 @@ func (cpu *CPU) OpDIVU(instruction Instruction) {
 
 	n := cpu.Reg(s)
 	d := cpu.Reg(t)
+	cpu.startMultDiv(DIV_CYCLES)
 
 	if d == 0 {
 		// division by zero, results are bogus
@@ -884,12 +959,14 @@ func (cpu *CPU) OpDIVU(instruction Instruction) {
 // Move From LO
 func (cpu *CPU) OpMFLO(instruction Instruction) {
 	d := instruction.D()
+	cpu.multDivStall()
 	cpu.SetReg(d, cpu.Lo)
 }
 
 // Move From HI
 func (cpu *CPU) OpMFHI(instruction Instruction) {
 	d := instruction.D()
+	cpu.multDivStall()
 	cpu.SetReg(d, cpu.Hi)
 }
 
@@ -931,12 +1008,36 @@ func (cpu *CPU) SetReg(index, val uint32) {
 
 // Trigger an exception
 func (cpu *CPU) Exception(cause Exception) {
-	handlerAddr := cpu.Cop0.EnterException(cause, cpu.CurrentPC, cpu.DelaySlot)
+	handlerAddr := cpu.Cop0.EnterException(cause, cpu.CurrentPC, cpu.DelaySlot, cpu.DelaySlotTaken)
 
 	// exceptions don't have a branch delay, jump directly into
 	// the handler
 	cpu.PC = handlerAddr
 	cpu.NextPC = cpu.PC + 4
+	cpu.BranchOccured = false
+	cpu.BranchTaken = false
+	// the exception takes priority over a data access breakpoint hit by the
+	// same instruction, like a load from a locked address
+	cpu.DataBreak = false
+}
+
+// Trigger an address error exception (EXCEPTION_LOAD_ADDRESS_ERROR or
+// EXCEPTION_STORE_ADDRESS_ERROR). The misaligned address is saved in the
+// BadVaddr register
+func (cpu *CPU) AddressError(cause Exception, addr uint32) {
+	cpu.Cop0.BadVaddr = addr
+	cpu.Exception(cause)
+}
+
+// Triggers a data bus error exception if the current instruction accessed a
+// locked address. A load from that address never completes
+func (cpu *CPU) checkBusError() {
+	if !cpu.Inter.BusError {
+		return
+	}
+	cpu.Inter.BusError = false
+	cpu.Load.Set(0, 0)
+	cpu.Exception(EXCEPTION_DATA_BUS)
 }
 
 // System Call
@@ -980,10 +1081,9 @@ func (cpu *CPU) OpLHU(instruction Instruction) {
 		v := cpu.Load16(addr)
 
 		// put the load in the delay slot
-		cpu.Load[0] = t
-		cpu.Load[1] = uint32(v)
+		cpu.delayedLoad(t, uint32(v))
 	} else {
-		cpu.Exception(EXCEPTION_LOAD_ADDRESS_ERROR)
+		cpu.AddressError(EXCEPTION_LOAD_ADDRESS_ERROR, addr)
 	}
 }
 
@@ -1010,8 +1110,7 @@ func (cpu *CPU) OpLH(instruction Instruction) {
 	v := int16(cpu.Load16(addr))
 
 	// put the load in the delay slot
-	cpu.Load[0] = t
-	cpu.Load[1] = uint32(v)
+	cpu.delayedLoad(t, uint32(v))
 }
 
 // Bitwise Not Or
@@ -1054,6 +1153,7 @@ func (cpu *CPU) OpMULTU(instruction Instruction) {
 	a := uint64(cpu.Reg(s))
 	b := uint64(cpu.Reg(t))
 	v := a * b
+	cpu.startMultDiv(multCycles(uint32(a)))
 
 	cpu.Hi = uint32(v >> 32)
 	cpu.Lo = uint32(v)
@@ -1081,6 +1181,7 @@ func (cpu *CPU) OpMULT(instruction Instruction) {
 
 	a := int64(int32(cpu.Reg(s)))
 	b := int64(int32(cpu.Reg(t)))
+	cpu.startMultDiv(multSignedCycles(int32(a)))
 
 	v := uint64(a * b)
 	cpu.Hi = uint32(v >> 32)
@@ -1119,13 +1220,34 @@ func (cpu *CPU) OpCOP1() {
 	cpu.Exception(EXCEPTION_COPROCESSOR_ERROR)
 }
 
+// Raises a coprocessor unusable exception for coprocessor 2 if the GTE is
+// disabled. Returns true if the GTE can be used
+func (cpu *CPU) checkCop2() bool {
+	if cpu.Cop0.Cop2Enabled() {
+		return true
+	}
+	cpu.Exception(EXCEPTION_COPROCESSOR_ERROR)
+	cpu.Cop0.SetCoprocessorError(2)
+	return false
+}
+
+// Stalls the CPU until the GTE finished its last command
+func (cpu *CPU) gteStall() {
+	cpu.Th.Tick(cpu.Gte.StallCycles(cpu.Th.CpuCycles))
+}
+
 // Coprocessor 2 opcode (GTE)
 func (cpu *CPU) OpCOP2(instruction Instruction) {
+	if !cpu.checkCop2() {
+		return
+	}
+	cpu.gteStall()
 	copOpcode := instruction.CopOpcode()
 
 	if copOpcode&0x10 != 0 {
 		// GTE command
 		cpu.Gte.Command(uint32(instruction))
+		cpu.Gte.StartCommand(uint32(instruction), cpu.Th.CpuCycles)
 	} else {
 		switch instruction.CopOpcode() {
 		case 0b00000:
@@ -1137,7 +1259,7 @@ func (cpu *CPU) OpCOP2(instruction Instruction) {
 		case 0b00110:
 			cpu.OpCTC2(instruction)
 		default:
-			panicFmt("cpu: unhandled GTE instruction 0x%x", instruction)
+			cpu.Exception(EXCEPTION_ILLEGAL_INSTRUCTION)
 		}
 	}
 }
@@ -1148,8 +1270,7 @@ func (cpu *CPU) OpMFC2(instruction Instruction) {
 	copR := instruction.D()
 
 	v := cpu.Gte.Data(copR)
-	cpu.Load[0] = cpuR
-	cpu.Load[1] = v
+	cpu.delayedLoad(cpuR, v)
 }
 
 // Move From Coprocessor 2 Control register
@@ -1158,8 +1279,7 @@ func (cpu *CPU) OpCFC2(instruction Instruction) {
 	copR := instruction.D()
 
 	v := cpu.Gte.Control(copR)
-	cpu.Load[0] = cpuR
-	cpu.Load[1] = v
+	cpu.delayedLoad(cpuR, v)
 }
 
 // Move To Coprocessor 2 Data register
@@ -1221,8 +1341,7 @@ func (cpu *CPU) OpLWL(instruction Instruction) {
 	}
 
 	// put the load in the delay slot
-	cpu.Load[0] = t
-	cpu.Load[1] = v
+	cpu.delayedLoad(t, v)
 }
 
 // Load Word Right (little-endian only implementation)
@@ -1260,8 +1379,7 @@ func (cpu *CPU) OpLWR(instruction Instruction) {
 	}
 
 	// put the load in the delay slot
-	cpu.Load[0] = t
-	cpu.Load[1] = v
+	cpu.delayedLoad(t, v)
 }
 
 // Store Word Left (little-endian only implementation)
@@ -1332,8 +1450,13 @@ func (cpu *CPU) OpLWC1() {
 	cpu.Exception(EXCEPTION_COPROCESSOR_ERROR)
 }
 
-// Load Word in Coprocessor 2
+// Load Word in Coprocessor 2. The GTE register is written right away, the
+// GTE has no load delay slot
 func (cpu *CPU) OpLWC2(instruction Instruction) {
+	if !cpu.checkCop2() {
+		return
+	}
+	cpu.gteStall()
 	i := instruction.ImmSE()
 	copR := instruction.T()
 	s := instruction.S()
@@ -1343,7 +1466,7 @@ func (cpu *CPU) OpLWC2(instruction Instruction) {
 		val := cpu.Load32(addr)
 		cpu.Gte.SetData(copR, val)
 	} else {
-		cpu.Exception(EXCEPTION_LOAD_ADDRESS_ERROR)
+		cpu.AddressError(EXCEPTION_LOAD_ADDRESS_ERROR, addr)
 	}
 }
 
@@ -1364,6 +1487,10 @@ func (cpu *CPU) OpSWC1() {
 
 // Store Word in Coprocessor 2
 func (cpu *CPU) OpSWC2(instruction Instruction) {
+	if !cpu.checkCop2() {
+		return
+	}
+	cpu.gteStall()
 	i := instruction.ImmSE()
 	copR := instruction.T()
 	s := instruction.S()
@@ -1374,7 +1501,7 @@ func (cpu *CPU) OpSWC2(instruction Instruction) {
 	if addr%4 == 0 {
 		cpu.Store32(addr, v)
 	} else {
-		cpu.Exception(EXCEPTION_LOAD_ADDRESS_ERROR)
+		cpu.AddressError(EXCEPTION_STORE_ADDRESS_ERROR, addr)
 	}
 }
 
@@ -1384,6 +1511,6 @@ func (cpu *CPU) OpSWC3() {
 }
 
 func (cpu *CPU) OpIllegal(instruction Instruction) {
-	fmt.Printf("cpu: illegal instruction 0x%x\n", instruction)
+	Log.Warnf(LOG_MODULE_CPU, "illegal instruction 0x%x", instruction)
 	cpu.Exception(EXCEPTION_ILLEGAL_INSTRUCTION)
 }
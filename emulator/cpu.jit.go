@@ -0,0 +1,440 @@
+package emulator
+
+// CPU execution mode
+type CpuMode int
+
+const (
+	CPU_MODE_INTERPRETER CpuMode = iota // Decodes every instruction when it is executed
+	CPU_MODE_JIT         CpuMode = iota // Runs hot blocks as threaded code
+	CPU_MODE_CACHED      CpuMode = iota // Runs pre-decoded blocks with the exact interpreter semantics
+)
+
+const (
+	JIT_MAX_BLOCK_SIZE  = 64 // Maximum amount of instructions in a block
+	JIT_HOT_THRESHOLD   = 4  // How many times a block is reached before it's compiled
+	CODE_PAGE_SIZE      = 4096
+	CODE_PAGES          = RAM_ALLOC_SIZE / CODE_PAGE_SIZE
+	JIT_NO_REGISTER     = 0 // Instruction doesn't write to a register with SetReg
+	JIT_RETURN_REGISTER = 31
+)
+
+// Handler of a single instruction
+type InstructionHandler func(cpu *CPU, instruction Instruction)
+
+// Handler of a single compiled instruction
+type JitOp func(cpu *CPU, compiled *JitInstruction)
+
+// A pre-decoded instruction
+type JitInstruction struct {
+	Op          JitOp
+	Instruction Instruction
+	S           uint32 // Register index in bits [25:21]
+	T           uint32 // Register index in bits [20:16]
+	D           uint32 // Register index in bits [15:11]
+	Shift       uint32 // Shift amount in bits [10:6]
+	Imm         uint32 // Zero-extended immediate value
+	ImmSE       uint32 // Sign-extended immediate value
+	// Register written by the instruction with SetReg. Only this register
+	// and the pending load are copied from OutRegs after it runs, instead
+	// of the whole register file
+	Dest uint32
+}
+
+// Compiled basic block
+type JitBlock struct {
+	Address uint32 // Physical address of the first instruction
+	Code    []JitInstruction
+}
+
+// Keeps track of the RAM pages that contain compiled code, so writes to them
+// (by the CPU, DMA or cheats) can invalidate it
+type CodePages struct {
+	HasCode [CODE_PAGES]bool
+	Dirty   []uint32 // Pages with code that were written to since the last flush
+}
+
+// Returns a new page tracker without any code
+func NewCodePages() *CodePages {
+	return &CodePages{}
+}
+
+// Marks the page containing the RAM offset `offset` as containing code
+func (pages *CodePages) Mark(offset uint32) {
+	pages.HasCode[(offset&0x1fffff)/CODE_PAGE_SIZE] = true
+}
+
+// Called on every RAM write
+func (pages *CodePages) Write(offset uint32) {
+	page := (offset & 0x1fffff) / CODE_PAGE_SIZE
+	if pages.HasCode[page] {
+		pages.HasCode[page] = false
+		pages.Dirty = append(pages.Dirty, page)
+	}
+}
+
+// Threaded-code block cache. Blocks are keyed by their physical address
+type Jit struct {
+	Blocks     map[uint32]*JitBlock
+	Hits       map[uint32]uint32    // How many times uncompiled addresses were reached
+	Threshold  uint32               // How many times a block is reached before it's compiled
+	PageBlocks [CODE_PAGES][]uint32 // Addresses of the compiled blocks in each RAM page
+	Pages      *CodePages
+	flush      bool
+}
+
+// Returns an empty block cache that compiles blocks after they're reached
+// `threshold` times
+func NewJit(threshold uint32) *Jit {
+	return &Jit{
+		Blocks:    make(map[uint32]*JitBlock),
+		Hits:      make(map[uint32]uint32),
+		Threshold: threshold,
+		Pages:     NewCodePages(),
+	}
+}
+
+// Invalidates all blocks before the next one is looked up. Called when the
+// instruction cache is changed while it's isolated
+func (jit *Jit) Flush() {
+	jit.flush = true
+}
+
+// Removes invalidated blocks
+func (jit *Jit) invalidate() {
+	if jit.flush {
+		jit.flush = false
+		jit.Blocks = make(map[uint32]*JitBlock)
+		jit.Hits = make(map[uint32]uint32)
+		jit.PageBlocks = [CODE_PAGES][]uint32{}
+		jit.Pages.HasCode = [CODE_PAGES]bool{}
+		jit.Pages.Dirty = jit.Pages.Dirty[:0]
+		return
+	}
+
+	for _, page := range jit.Pages.Dirty {
+		for _, addr := range jit.PageBlocks[page] {
+			delete(jit.Blocks, addr)
+			delete(jit.Hits, addr)
+		}
+		jit.PageBlocks[page] = jit.PageBlocks[page][:0]
+	}
+	jit.Pages.Dirty = jit.Pages.Dirty[:0]
+}
+
+// Returns the physical address used as the block key for `pc` and whether
+// code at `pc` can be compiled
+func jitBlockAddress(pc uint32) (uint32, bool) {
+	absAddr := MaskRegion(pc)
+	if ok, offset := RAM_RANGE.ContainsAndOffset(absAddr); ok {
+		return offset & 0x1fffff, true
+	}
+	if BIOS_RANGE.Contains(absAddr) {
+		return absAddr, true
+	}
+	return 0, false
+}
+
+// Returns the compiled block at `pc`. Returns nil if the code at `pc` isn't
+// hot yet or can't be compiled
+func (jit *Jit) Lookup(cpu *CPU, pc uint32) *JitBlock {
+	if jit.flush || len(jit.Pages.Dirty) > 0 {
+		jit.invalidate()
+	}
+
+	addr, ok := jitBlockAddress(pc)
+	if !ok {
+		return nil
+	}
+	if addr < RAM_ALLOC_SIZE && cpu.Inter.RamAccess(MaskRegion(pc)) != RAM_ACCESS_MAPPED {
+		// the interpreter raises the bus error
+		return nil
+	}
+	if block, ok := jit.Blocks[addr]; ok {
+		return block
+	}
+
+	if jit.Threshold > 1 {
+		jit.Hits[addr]++
+		if jit.Hits[addr] < jit.Threshold {
+			return nil
+		}
+	}
+
+	block := jit.Compile(cpu, pc, addr)
+	jit.Blocks[addr] = block
+	if addr < RAM_ALLOC_SIZE {
+		page := addr / CODE_PAGE_SIZE
+		jit.PageBlocks[page] = append(jit.PageBlocks[page], addr)
+		jit.Pages.Mark(addr)
+	}
+	return block
+}
+
+// Compiles the block starting at `pc`. A block ends after the delay slot of
+// the first branch, at the end of a code page or after JIT_MAX_BLOCK_SIZE
+// instructions
+func (jit *Jit) Compile(cpu *CPU, pc, addr uint32) *JitBlock {
+	block := &JitBlock{Address: addr}
+	pageEnd := (pc | (CODE_PAGE_SIZE - 1)) + 1
+	branch := false
+
+	for ; pc != pageEnd && len(block.Code) < JIT_MAX_BLOCK_SIZE; pc += 4 {
+		instruction := Instruction(cpu.Inter.LoadInstruction(pc))
+		block.Code = append(block.Code, compileInstruction(instruction))
+
+		if branch {
+			break // this was the delay slot
+		}
+		branch = isBranchInstruction(instruction)
+	}
+	return block
+}
+
+// Returns true if `instruction` is a jump or a branch
+func isBranchInstruction(instruction Instruction) bool {
+	switch instruction.Function() {
+	case 0b000000:
+		switch instruction.Subfunction() {
+		case 0b001000, 0b001001: // JR, JALR
+			return true
+		}
+	case 0b000001, 0b000010, 0b000011, 0b000100, 0b000101, 0b000110, 0b000111:
+		return true // BXX, J, JAL, BEQ, BNE, BLEZ, BGTZ
+	}
+	return false
+}
+
+// Instruction handlers indexed by the primary opcode
+var jitPrimaryOps = [64]InstructionHandler{
+	0b001111: (*CPU).OpLUI,
+	0b001101: (*CPU).OpORI,
+	0b101011: (*CPU).OpSW,
+	0b001001: (*CPU).OpADDIU,
+	0b000010: (*CPU).OpJ,
+	0b010000: (*CPU).OpCOP0,
+	0b000101: (*CPU).OpBNE,
+	0b001000: (*CPU).OpADDI,
+	0b100011: (*CPU).OpLW,
+	0b101001: (*CPU).OpSH,
+	0b000011: (*CPU).OpJAL,
+	0b001100: (*CPU).OpANDI,
+	0b101000: (*CPU).OpSB,
+	0b100000: (*CPU).OpLB,
+	0b000100: (*CPU).OpBEQ,
+	0b000111: (*CPU).OpBGTZ,
+	0b000110: (*CPU).OpBLEZ,
+	0b100100: (*CPU).OpLBU,
+	0b000001: (*CPU).OpBXX,
+	0b001010: (*CPU).OpSLTI,
+	0b001011: (*CPU).OpSLTIU,
+	0b100101: (*CPU).OpLHU,
+	0b100001: (*CPU).OpLH,
+	0b001110: (*CPU).OpXORI,
+	0b010001: func(cpu *CPU, _ Instruction) { cpu.OpCOP1() },
+	0b010011: func(cpu *CPU, _ Instruction) { cpu.OpCOP3() },
+	0b010010: (*CPU).OpCOP2,
+	0b100010: (*CPU).OpLWL,
+	0b100110: (*CPU).OpLWR,
+	0b101010: (*CPU).OpSWL,
+	0b101110: (*CPU).OpSWR,
+	0b110000: func(cpu *CPU, _ Instruction) { cpu.OpLWC0() },
+	0b110001: func(cpu *CPU, _ Instruction) { cpu.OpLWC1() },
+	0b110010: (*CPU).OpLWC2,
+	0b110011: func(cpu *CPU, _ Instruction) { cpu.OpLWC3() },
+	0b111000: func(cpu *CPU, _ Instruction) { cpu.OpSWC0() },
+	0b111001: func(cpu *CPU, _ Instruction) { cpu.OpSWC1() },
+	0b111010: (*CPU).OpSWC2,
+	0b111011: func(cpu *CPU, _ Instruction) { cpu.OpSWC3() },
+}
+
+// Instruction handlers indexed by the subfunction of primary opcode 0
+var jitSpecialOps = [64]InstructionHandler{
+	0b000000: (*CPU).OpSLL,
+	0b000010: (*CPU).OpSRL,
+	0b100101: (*CPU).OpOR,
+	0b100100: (*CPU).OpAND,
+	0b101011: (*CPU).OpSLTU,
+	0b100001: (*CPU).OpADDU,
+	0b001000: (*CPU).OpJR,
+	0b100000: (*CPU).OpADD,
+	0b001001: (*CPU).OpJALR,
+	0b100011: (*CPU).OpSUBU,
+	0b000011: (*CPU).OpSRA,
+	0b011010: (*CPU).OpDIV,
+	0b010010: (*CPU).OpMFLO,
+	0b010000: (*CPU).OpMFHI,
+	0b011011: (*CPU).OpDIVU,
+	0b101010: (*CPU).OpSLT,
+	0b001100: func(cpu *CPU, _ Instruction) { cpu.OpSyscall() },
+	0b010011: (*CPU).OpMTLO,
+	0b010001: (*CPU).OpMTHI,
+	0b000100: (*CPU).OpSLLV,
+	0b100111: (*CPU).OpNOR,
+	0b000111: (*CPU).OpSRAV,
+	0b000110: (*CPU).OpSRLV,
+	0b011001: (*CPU).OpMULTU,
+	0b100110: (*CPU).OpXOR,
+	0b001101: func(cpu *CPU, _ Instruction) { cpu.OpBreak() },
+	0b011000: (*CPU).OpMULT,
+	0b100010: (*CPU).OpSUB,
+}
+
+// Pre-decodes an instruction
+func compileInstruction(instruction Instruction) JitInstruction {
+	compiled := JitInstruction{
+		Op:          decodedOp(instruction),
+		Instruction: instruction,
+		S:           instruction.S(),
+		T:           instruction.T(),
+		D:           instruction.D(),
+		Shift:       instruction.Shift(),
+		Imm:         instruction.Imm(),
+		ImmSE:       instruction.ImmSE(),
+		Dest:        JIT_NO_REGISTER,
+	}
+
+	var handler InstructionHandler
+	switch instruction.Function() {
+	case 0b000000:
+		handler = jitSpecialOps[instruction.Subfunction()]
+		if handler == nil {
+			handler = func(cpu *CPU, instruction Instruction) {
+				panicFmt("cpu: unhandled instruction 0x%x", instruction)
+			}
+		}
+
+		switch instruction.Subfunction() {
+		case 0b001000, 0b001100, 0b001101, 0b010001, 0b010011,
+			0b011000, 0b011001, 0b011010, 0b011011:
+			// JR, SYSCALL, BREAK, MTHI, MTLO, MULT, MULTU, DIV, DIVU
+		default:
+			compiled.Dest = instruction.D()
+		}
+	case 0b001111, 0b001101, 0b001001, 0b001000, 0b001100,
+		0b001010, 0b001011, 0b001110:
+		// LUI, ORI, ADDIU, ADDI, ANDI, SLTI, SLTIU, XORI
+		compiled.Dest = instruction.T()
+	case 0b000011, 0b000001: // JAL, BGEZAL and BLTZAL
+		compiled.Dest = JIT_RETURN_REGISTER
+	}
+
+	if compiled.Op != nil {
+		return compiled
+	}
+
+	if instruction.Function() != 0b000000 {
+		handler = jitPrimaryOps[instruction.Function()]
+		if handler == nil {
+			handler = (*CPU).OpIllegal
+		}
+	}
+	compiled.Op = func(cpu *CPU, compiled *JitInstruction) {
+		handler(cpu, compiled.Instruction)
+	}
+	return compiled
+}
+
+// Sets the execution mode
+func (cpu *CPU) SetMode(mode CpuMode) {
+	cpu.Mode = mode
+
+	switch mode {
+	case CPU_MODE_JIT:
+		cpu.Jit = NewJit(JIT_HOT_THRESHOLD)
+		cpu.Inter.Ram.CodePages = cpu.Jit.Pages
+	case CPU_MODE_CACHED:
+		cpu.Jit = NewJit(1)
+		cpu.Inter.Ram.CodePages = cpu.Jit.Pages
+	default:
+		cpu.Jit = nil
+		cpu.Inter.Ram.CodePages = nil
+	}
+}
+
+// Runs the next instruction, or the next block when the block cache is enabled
+func (cpu *CPU) Step() {
+	if cpu.Tty != nil {
+		cpu.CapturePutchar()
+	}
+	if cpu.Hle != nil && cpu.Hle.Call(cpu) {
+		return
+	}
+
+	switch cpu.Mode {
+	case CPU_MODE_JIT, CPU_MODE_CACHED:
+		cpu.RunNextBlock()
+	default:
+		cpu.RunNextInstruction()
+	}
+}
+
+// Runs the compiled block at the program counter. Falls back to the
+// interpreter if the block isn't compiled
+func (cpu *CPU) RunNextBlock() {
+	pc := cpu.PC
+	if pc%4 != 0 || cpu.Cop0.BreakpointsEnabled() {
+		// hardware breakpoints are only checked by the interpreter
+		cpu.RunNextInstruction()
+		return
+	}
+
+	block := cpu.Jit.Lookup(cpu, pc)
+	if block == nil {
+		cpu.RunNextInstruction()
+		return
+	}
+
+	// assume cache hits, KSEG1 is not cached
+	fetchCycles := cpu.Inter.FetchCycles(pc)
+	if pc < 0xa0000000 && cpu.Inter.CacheCtrl.ICacheEnabled() {
+		fetchCycles = 0
+	}
+
+	for i := range block.Code {
+		// leave the block if a branch was taken or an exception occurred
+		if cpu.PC != pc {
+			return
+		}
+
+		// synchronize peripherals
+		if cpu.Th.ShouldSync() {
+			cpu.Inter.Sync(cpu.Th)
+			cpu.Th.UpdatePendingSync()
+		}
+
+		cpu.CurrentPC = pc
+		cpu.Debugger.changedPc(pc, cpu.Th.CpuCycles)
+		cpu.Th.Tick(fetchCycles)
+		cpu.runCompiledInstruction(&block.Code[i])
+		pc += 4
+	}
+}
+
+// Executes a pre-decoded instruction
+func (cpu *CPU) runCompiledInstruction(compiled *JitInstruction) {
+	cpu.PC = cpu.NextPC
+	cpu.NextPC += 4
+
+	// execute the pending load
+	cpu.commitLoad()
+
+	cpu.enterDelaySlot()
+
+	if cpu.Cop0.IrqActive(cpu.Inter.IrqState) {
+		cpu.Exception(EXCEPTION_INTERRUPT)
+	} else {
+		cpu.Th.Tick(1)
+		compiled.Op(cpu, compiled)
+	}
+	cpu.checkBusError()
+
+	if cpu.Mode == CPU_MODE_CACHED {
+		copy(cpu.Regs[:], cpu.OutRegs[:])
+		return
+	}
+
+	// only the pending load and the destination register can differ
+	committed := cpu.Load.Committed
+	cpu.Regs[committed] = cpu.OutRegs[committed]
+	cpu.Regs[compiled.Dest] = cpu.OutRegs[compiled.Dest]
+}
@@ -0,0 +1,78 @@
+package emulator
+
+import "testing"
+
+// Returns a CPU running threaded code that compiles every block the first
+// time it's reached, with a block at CPU_TEST_BASE that sets r1 to `val`
+// and jumps back to itself
+func newJitTestCpu(t *testing.T, val uint16) *CPU {
+	test := cpuTest{Program: []uint32{
+		asmI(0x0d, 1, 0, val),     // ori r1, r0, val
+		asmJ(0x02, CPU_TEST_BASE), // j CPU_TEST_BASE
+		0,                         // nop
+	}}
+	cpu := test.makeCpu(CPU_MODE_JIT)
+	cpu.Jit.Threshold = 1
+	stepJitTestCpu(t, cpu, uint32(val))
+	if _, ok := cpu.Jit.Blocks[CPU_TEST_BASE&0x1fffff]; !ok {
+		t.Fatal("expected the block to be compiled")
+	}
+	return cpu
+}
+
+// Runs the block at CPU_TEST_BASE once and checks the value it sets
+func stepJitTestCpu(t *testing.T, cpu *CPU, expected uint32) {
+	t.Helper()
+	cpu.Step()
+	if cpu.PC != CPU_TEST_BASE {
+		t.Fatalf("expected the block to run at once, PC is 0x%08x", cpu.PC)
+	}
+	if cpu.Regs[1] != expected {
+		t.Errorf("expected r1 to be 0x%x, got 0x%x", expected, cpu.Regs[1])
+	}
+}
+
+// A store by the CPU into a compiled block invalidates it
+func TestJitStoreInvalidates(t *testing.T) {
+	cpu := newJitTestCpu(t, 1)
+
+	cpu.Inter.Store32(CPU_TEST_BASE, asmI(0x0d, 1, 0, 2), cpu.Th)
+	if len(cpu.Jit.Pages.Dirty) != 1 {
+		t.Fatalf("expected the page to be dirty, got %v", cpu.Jit.Pages.Dirty)
+	}
+	stepJitTestCpu(t, cpu, 2)
+
+	// a store to another page keeps the block
+	block := cpu.Jit.Blocks[CPU_TEST_BASE&0x1fffff]
+	cpu.Inter.Store32(CPU_TEST_BASE+CODE_PAGE_SIZE, 0, cpu.Th)
+	stepJitTestCpu(t, cpu, 2)
+	if cpu.Jit.Blocks[CPU_TEST_BASE&0x1fffff] != block {
+		t.Error("expected the block to be kept")
+	}
+}
+
+// A DMA transfer into a compiled block invalidates it
+func TestJitDmaInvalidates(t *testing.T) {
+	cpu := newJitTestCpu(t, 1)
+	inter, th := cpu.Inter, cpu.Th
+
+	// the new instruction goes into the sound RAM, then it's copied over
+	// the block by the SPU DMA channel
+	instruction := asmI(0x0d, 1, 0, 3)
+	inter.Store16(0x1f801da6, 0x1000/8, th)
+	inter.Store16(0x1f801da8, uint16(instruction), th)
+	inter.Store16(0x1f801da8, uint16(instruction>>16), th)
+	inter.Store16(0x1f801daa, 0x0010, th)
+
+	inter.Store16(0x1f801daa, 0x0030, th)
+	inter.Store16(0x1f801da6, 0x1000/8, th)
+	inter.Store32(0x1f8010f0, 0x00080000, th) // enable the SPU channel
+	inter.Store32(0x1f8010c0, CPU_TEST_BASE&0x1fffff, th)
+	inter.Store32(0x1f8010c4, 0x00010001, th)
+	inter.Store32(0x1f8010c8, 0x01000200, th) // request sync, to RAM
+
+	if got := inter.Ram.Load32(CPU_TEST_BASE & 0x1fffff); got != instruction {
+		t.Fatalf("expected the DMA to write 0x%08x, got 0x%08x", instruction, got)
+	}
+	stepJitTestCpu(t, cpu, 3)
+}
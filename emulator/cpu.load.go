@@ -0,0 +1,54 @@
+package emulator
+
+// Load waiting in the load delay slot. The loaded value only becomes visible
+// to the instruction after the next one
+type LoadDelay struct {
+	Reg uint32 // Target register, 0 if there's no pending load
+	Val uint32 // Loaded value
+	// Register of the load that completed at the start of the current
+	// instruction, 0 if there wasn't any
+	Committed uint32
+}
+
+// Queues a load of `val` into `reg`
+func (load *LoadDelay) Set(reg, val uint32) {
+	load.Reg = reg
+	load.Val = val
+}
+
+// Returns the pending load and clears it. Called at the start of every
+// instruction
+func (load *LoadDelay) Take() (reg, val uint32) {
+	reg, val = load.Reg, load.Val
+	load.Committed = reg
+	load.Reg = 0
+	load.Val = 0
+	return reg, val
+}
+
+// Returns true if a load into `reg` is pending
+func (load *LoadDelay) Pending(reg uint32) bool {
+	return reg != 0 && load.Reg == reg
+}
+
+// Clears the pending load
+func (load *LoadDelay) Reset() {
+	*load = LoadDelay{}
+}
+
+// Writes the pending load to the output registers. The current instruction
+// still sees the old value
+func (cpu *CPU) commitLoad() {
+	reg, val := cpu.Load.Take()
+	cpu.SetReg(reg, val)
+}
+
+// Puts a load into the delay slot. If the load that just completed targets
+// the same register, it's cancelled and the register keeps its old value
+// until this load completes
+func (cpu *CPU) delayedLoad(reg, val uint32) {
+	if reg != 0 && reg == cpu.Load.Committed {
+		cpu.OutRegs[reg] = cpu.Regs[reg]
+	}
+	cpu.Load.Set(reg, val)
+}
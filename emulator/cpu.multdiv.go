@@ -0,0 +1,47 @@
+package emulator
+
+// CPU cycles before the result of a multiplication or a division is in HI
+// and LO. Multiplications are faster with small operands, see
+// https://problemkaputt.de/psx-spx.htm#cpuspecifications
+const (
+	MULT_CYCLES_SMALL  = 6  // rs fits in 11 bits
+	MULT_CYCLES_MEDIUM = 9  // rs fits in 20 bits
+	MULT_CYCLES_LARGE  = 13 // Any other rs
+	DIV_CYCLES         = 36
+)
+
+// Returns the amount of CPU cycles taken by a multiplication by `rs`. For
+// MULT, `rs` is the absolute value of the signed operand
+func multCycles(rs uint32) uint64 {
+	switch {
+	case rs < 1<<11:
+		return MULT_CYCLES_SMALL
+	case rs < 1<<20:
+		return MULT_CYCLES_MEDIUM
+	default:
+		return MULT_CYCLES_LARGE
+	}
+}
+
+// Returns the amount of CPU cycles taken by MULT with the signed `rs`
+func multSignedCycles(rs int32) uint64 {
+	if rs < 0 {
+		// negative values are measured by their complement
+		return multCycles(uint32(^rs))
+	}
+	return multCycles(uint32(rs))
+}
+
+// Marks HI and LO busy for `cycles` from now. The CPU keeps running until it
+// reads them
+func (cpu *CPU) startMultDiv(cycles uint64) {
+	cpu.MultDivBusyUntil = cpu.Th.CpuCycles + cycles
+}
+
+// Stalls the CPU until the result of the last multiplication or division is
+// in HI and LO
+func (cpu *CPU) multDivStall() {
+	if now := cpu.Th.CpuCycles; now < cpu.MultDivBusyUntil {
+		cpu.Th.Tick(cpu.MultDivBusyUntil - now)
+	}
+}
@@ -0,0 +1,487 @@
+package emulator
+
+import (
+	"os"
+	"testing"
+)
+
+// Address the test programs are loaded at
+const CPU_TEST_BASE = 0x80010000
+
+type cpuRegister struct {
+	Index uint32 // Register index
+	Value uint32 // Register value
+}
+
+type cpuMemory struct {
+	Addr  uint32 // Word address
+	Value uint32 // Word value
+}
+
+type cpuState struct {
+	Regs   []cpuRegister // General purpose registers
+	Memory []cpuMemory   // RAM words, the bytes that aren't written keep the 0xcd power-on garbage
+}
+
+type cpuTest struct {
+	Desc    string   // Test description
+	Initial cpuState // State before the program runs, registers are 0 otherwise
+	Program []uint32 // Machine code loaded at CPU_TEST_BASE
+	Result  cpuState // Expected state after the program
+}
+
+// Encodes a SPECIAL (R-type) instruction
+func asmR(funct, rd, rs, rt uint32) uint32 {
+	return rs<<21 | rt<<16 | rd<<11 | funct
+}
+
+// Encodes a shift by an immediate amount
+func asmShift(funct, rd, rt, shamt uint32) uint32 {
+	return rt<<16 | rd<<11 | shamt<<6 | funct
+}
+
+// Encodes an I-type instruction
+func asmI(opcode, rt, rs uint32, imm uint16) uint32 {
+	return opcode<<26 | rs<<21 | rt<<16 | uint32(imm)
+}
+
+// Encodes a jump to `target`
+func asmJ(opcode, target uint32) uint32 {
+	return opcode<<26 | (target>>2)&0x3ffffff
+}
+
+var cpuTests = []cpuTest{
+	{
+		Desc:    "ADDU, SUBU, AND, OR, XOR, NOR",
+		Initial: cpuState{Regs: []cpuRegister{{1, 0x12345678}, {2, 0xf0f0f0f0}}},
+		Program: []uint32{
+			asmR(0x21, 3, 1, 2),
+			asmR(0x23, 4, 1, 2),
+			asmR(0x24, 5, 1, 2),
+			asmR(0x25, 6, 1, 2),
+			asmR(0x26, 7, 1, 2),
+			asmR(0x27, 8, 1, 2),
+		},
+		Result: cpuState{Regs: []cpuRegister{
+			{3, 0x03254768}, {4, 0x21436588}, {5, 0x10305070},
+			{6, 0xf2f4f6f8}, {7, 0xe2c4a688}, {8, 0x0d0b0907},
+		}},
+	},
+	{
+		Desc:    "SLT, SLTU, SLTI, SLTIU",
+		Initial: cpuState{Regs: []cpuRegister{{1, 0xffffffff}, {2, 1}}},
+		Program: []uint32{
+			asmR(0x2a, 3, 1, 2),
+			asmR(0x2b, 4, 1, 2),
+			asmI(0x0a, 5, 1, 0),
+			asmI(0x0b, 6, 2, 0xffff), // the immediate is sign extended
+		},
+		Result: cpuState{Regs: []cpuRegister{{3, 1}, {4, 0}, {5, 1}, {6, 1}}},
+	},
+	{
+		Desc:    "SLL, SRL, SRA, SLLV, SRAV",
+		Initial: cpuState{Regs: []cpuRegister{{1, 0x80000010}, {2, 0x24}}},
+		Program: []uint32{
+			asmShift(0x00, 3, 1, 4),
+			asmShift(0x02, 4, 1, 4),
+			asmShift(0x03, 5, 1, 4),
+			asmR(0x04, 6, 2, 1), // only the low 5 bits of the amount are used
+			asmR(0x07, 7, 2, 1),
+		},
+		Result: cpuState{Regs: []cpuRegister{
+			{3, 0x00000100}, {4, 0x08000001}, {5, 0xf8000001}, {6, 0x00000100}, {7, 0xf8000001},
+		}},
+	},
+	{
+		Desc: "LUI, ORI, ADDIU, ANDI, XORI",
+		Program: []uint32{
+			asmI(0x0f, 1, 0, 0x1234),
+			asmI(0x0d, 1, 1, 0x8765),
+			asmI(0x09, 2, 0, 0x8000),
+			asmI(0x0c, 3, 2, 0xff00),
+			asmI(0x0e, 4, 1, 0xffff),
+		},
+		Result: cpuState{Regs: []cpuRegister{
+			{1, 0x12348765}, {2, 0xffff8000}, {3, 0x00008000}, {4, 0x1234789a},
+		}},
+	},
+	{
+		Desc:    "MULT, MULTU, DIV, DIVU and division by zero",
+		Initial: cpuState{Regs: []cpuRegister{{1, 0xfffffffe}, {2, 3}}},
+		Program: []uint32{
+			asmR(0x18, 0, 1, 2),
+			asmR(0x12, 3, 0, 0),
+			asmR(0x10, 4, 0, 0),
+			asmR(0x19, 0, 1, 2),
+			asmR(0x12, 5, 0, 0),
+			asmR(0x10, 6, 0, 0),
+			asmR(0x1a, 0, 1, 2),
+			asmR(0x12, 7, 0, 0),
+			asmR(0x10, 8, 0, 0),
+			asmR(0x1a, 0, 2, 0),
+			asmR(0x12, 9, 0, 0),
+			asmR(0x10, 10, 0, 0),
+			asmR(0x1b, 0, 1, 0),
+			asmR(0x12, 11, 0, 0),
+			asmR(0x10, 12, 0, 0),
+		},
+		Result: cpuState{Regs: []cpuRegister{
+			{3, 0xfffffffa}, {4, 0xffffffff},
+			{5, 0xfffffffa}, {6, 0x00000002},
+			{7, 0x00000000}, {8, 0xfffffffe},
+			{9, 0xffffffff}, {10, 0x00000003},
+			{11, 0xffffffff}, {12, 0xfffffffe},
+		}},
+	},
+	{
+		Desc: "LB, LBU, LH, LHU, LW, SB, SH, SW",
+		Initial: cpuState{
+			Regs:   []cpuRegister{{29, 0x80020000}},
+			Memory: []cpuMemory{{0x80020000, 0x8081fe7f}},
+		},
+		Program: []uint32{
+			asmI(0x20, 2, 29, 0),
+			asmI(0x20, 3, 29, 1),
+			asmI(0x24, 4, 29, 1),
+			asmI(0x21, 5, 29, 2),
+			asmI(0x25, 6, 29, 2),
+			asmI(0x23, 7, 29, 0),
+			0, // load delay slot
+			asmI(0x28, 7, 29, 4),
+			asmI(0x29, 7, 29, 8),
+			asmI(0x2b, 7, 29, 12),
+		},
+		Result: cpuState{
+			Regs: []cpuRegister{
+				{2, 0x0000007f}, {3, 0xfffffffe}, {4, 0x000000fe},
+				{5, 0xffff8081}, {6, 0x00008081}, {7, 0x8081fe7f},
+			},
+			Memory: []cpuMemory{
+				{0x80020004, 0xcdcdcd7f}, {0x80020008, 0xcdcdfe7f}, {0x8002000c, 0x8081fe7f},
+			},
+		},
+	},
+	{
+		Desc: "LWL, LWR, SWL, SWR",
+		Initial: cpuState{
+			Regs: []cpuRegister{{1, 0x80020001}, {2, 0xaabbccdd}, {3, 0x80020011}},
+			Memory: []cpuMemory{
+				{0x80020000, 0x33221100}, {0x80020004, 0x77665544},
+			},
+		},
+		Program: []uint32{
+			asmI(0x26, 2, 1, 0),
+			asmI(0x22, 2, 1, 3), // merges with the pending LWR load
+			0,
+			asmI(0x2e, 2, 3, 0),
+			asmI(0x2a, 2, 3, 3),
+		},
+		Result: cpuState{
+			Regs: []cpuRegister{{2, 0x44332211}},
+			Memory: []cpuMemory{
+				{0x80020010, 0x332211cd}, {0x80020014, 0xcdcdcd44},
+			},
+		},
+	},
+	{
+		Desc:    "BEQ, BNE, JAL and branch delay slots",
+		Initial: cpuState{Regs: []cpuRegister{{1, 5}, {2, 5}}},
+		Program: []uint32{
+			asmI(0x04, 2, 1, 2),          // beq r1, r2, +2
+			asmI(0x09, 3, 0, 1),          // delay slot
+			asmI(0x09, 4, 0, 1),          // skipped
+			asmI(0x05, 2, 1, 1),          // bne r1, r2, +1 (not taken)
+			asmI(0x09, 5, 0, 1),          // delay slot
+			asmJ(0x03, CPU_TEST_BASE+32), // jal
+			asmI(0x09, 6, 0, 1),          // delay slot
+			asmI(0x09, 7, 0, 1),          // skipped
+		},
+		Result: cpuState{Regs: []cpuRegister{
+			{3, 1}, {4, 0}, {5, 1}, {6, 1}, {7, 0}, {31, CPU_TEST_BASE + 28},
+		}},
+	},
+}
+
+// Edge cases of the load delay slot
+var loadDelayTests = []cpuTest{
+	{
+		Desc: "the instruction after a load sees the old value",
+		Initial: cpuState{
+			Regs:   []cpuRegister{{1, 5}, {29, 0x80020000}},
+			Memory: []cpuMemory{{0x80020000, 0x11111111}},
+		},
+		Program: []uint32{
+			asmI(0x23, 1, 29, 0),
+			asmR(0x21, 2, 1, 0),
+			asmR(0x21, 3, 1, 0),
+		},
+		Result: cpuState{Regs: []cpuRegister{{1, 0x11111111}, {2, 5}, {3, 0x11111111}}},
+	},
+	{
+		Desc: "a write in the load delay slot wins over the load",
+		Initial: cpuState{
+			Regs:   []cpuRegister{{1, 5}, {29, 0x80020000}},
+			Memory: []cpuMemory{{0x80020000, 0x11111111}},
+		},
+		Program: []uint32{
+			asmI(0x23, 1, 29, 0),
+			asmI(0x09, 1, 0, 7),
+			asmR(0x21, 2, 1, 0),
+		},
+		Result: cpuState{Regs: []cpuRegister{{1, 7}, {2, 7}}},
+	},
+	{
+		Desc: "a second load into the same register cancels the first one",
+		Initial: cpuState{
+			Regs:   []cpuRegister{{1, 5}, {29, 0x80020000}},
+			Memory: []cpuMemory{{0x80020000, 0x11111111}, {0x80020004, 0x22222222}},
+		},
+		Program: []uint32{
+			asmI(0x23, 1, 29, 0),
+			asmI(0x23, 1, 29, 4),
+			asmR(0x21, 2, 1, 0),
+			asmR(0x21, 3, 1, 0),
+		},
+		Result: cpuState{Regs: []cpuRegister{{1, 0x22222222}, {2, 5}, {3, 0x22222222}}},
+	},
+	{
+		Desc: "loads into different registers complete one after the other",
+		Initial: cpuState{
+			Regs:   []cpuRegister{{29, 0x80020000}},
+			Memory: []cpuMemory{{0x80020000, 0x11111111}, {0x80020004, 0x22222222}},
+		},
+		Program: []uint32{
+			asmI(0x23, 1, 29, 0),
+			asmI(0x23, 2, 29, 4),
+			asmR(0x21, 3, 1, 2),
+			asmR(0x21, 4, 1, 2),
+		},
+		Result: cpuState{Regs: []cpuRegister{{3, 0x11111111}, {4, 0x33333333}}},
+	},
+	{
+		Desc: "LWL merges with the pending LWR without exposing the partial value",
+		Initial: cpuState{
+			Regs:   []cpuRegister{{1, 0x80020001}, {2, 0xaabbccdd}},
+			Memory: []cpuMemory{{0x80020000, 0x33221100}, {0x80020004, 0x77665544}},
+		},
+		Program: []uint32{
+			asmI(0x26, 2, 1, 0),
+			asmI(0x22, 2, 1, 3),
+			asmR(0x21, 3, 2, 0),
+			asmR(0x21, 4, 2, 0),
+		},
+		Result: cpuState{Regs: []cpuRegister{{3, 0xaabbccdd}, {4, 0x44332211}}},
+	},
+	{
+		Desc:    "MFC0 goes through the load delay slot",
+		Initial: cpuState{Regs: []cpuRegister{{1, 0x1234}, {2, 5}}},
+		Program: []uint32{
+			0x10<<26 | 4<<21 | 1<<16 | COP0_BPC<<11, // mtc0 r1, BPC
+			0x10<<26 | 2<<16 | COP0_BPC<<11,         // mfc0 r2, BPC
+			asmR(0x21, 3, 2, 0),
+			asmR(0x21, 4, 2, 0),
+		},
+		Result: cpuState{Regs: []cpuRegister{{3, 5}, {4, 0x1234}}},
+	},
+}
+
+// Returns a CPU with the test program and initial state loaded
+func (test *cpuTest) makeCpu(mode CpuMode) *CPU {
+	cpu := NewCPU(newBenchInterconnect())
+	cpu.SetMode(mode)
+	cpu.Regs = [32]uint32{}
+	for _, reg := range test.Initial.Regs {
+		cpu.Regs[reg.Index] = reg.Value
+	}
+	cpu.OutRegs = cpu.Regs
+
+	for _, mem := range test.Initial.Memory {
+		cpu.Inter.Store32(mem.Addr, mem.Value, cpu.Th)
+	}
+	// the program ends with a NOP and an infinite loop
+	end := CPU_TEST_BASE + uint32(len(test.Program)+1)*4
+	program := append(test.Program, 0, asmJ(0x02, end), 0)
+	for i, instruction := range program {
+		cpu.Inter.Store32(CPU_TEST_BASE+uint32(i)*4, instruction, cpu.Th)
+	}
+
+	cpu.PC = CPU_TEST_BASE
+	cpu.NextPC = CPU_TEST_BASE + 4
+	return cpu
+}
+
+// Runs the program in `mode` until the CPU reaches the loop at its end. The
+// NOP after the program lets the last load delay finish
+func (test *cpuTest) run(t *testing.T, mode CpuMode) *CPU {
+	return test.runCpu(t, test.makeCpu(mode))
+}
+
+// Runs the program on `cpu`, made by makeCpu, until it reaches the loop at
+// its end
+func (test *cpuTest) runCpu(t *testing.T, cpu *CPU) *CPU {
+	t.Helper()
+	end := CPU_TEST_BASE + uint32(len(test.Program)+1)*4
+
+	for steps := 0; cpu.PC != end; steps++ {
+		if steps > 1000 {
+			t.Fatalf("the program didn't finish, PC is 0x%08x", cpu.PC)
+		}
+		cpu.Step()
+
+		if cpu.PC == 0x80000080 {
+			t.Fatalf("exception at 0x%08x (CAUSE 0x%08x)", cpu.Cop0.Epc, cpu.Cop0.Cause)
+		}
+	}
+	return cpu
+}
+
+func (state *cpuState) Validate(cpu *CPU, t *testing.T) {
+	for _, reg := range state.Regs {
+		if got := cpu.Regs[reg.Index]; got != reg.Value {
+			t.Errorf("register %d: expected 0x%08x, got 0x%08x", reg.Index, reg.Value, got)
+		}
+	}
+	for _, mem := range state.Memory {
+		if got := cpu.Inter.Load32(mem.Addr, cpu.Th); got != mem.Value {
+			t.Errorf("memory 0x%08x: expected 0x%08x, got 0x%08x", mem.Addr, mem.Value, got)
+		}
+	}
+}
+
+func TestCPU(t *testing.T) {
+	for idx, test := range cpuTests {
+		t.Logf("running test %d: %s", idx+1, test.Desc)
+
+		cpu := test.run(t, CPU_MODE_INTERPRETER)
+		test.Result.Validate(cpu, t)
+	}
+}
+
+func TestCPULoadDelay(t *testing.T) {
+	for _, mode := range []CpuMode{CPU_MODE_INTERPRETER, CPU_MODE_JIT, CPU_MODE_CACHED} {
+		for idx, test := range loadDelayTests {
+			t.Logf("running test %d (mode %d): %s", idx+1, mode, test.Desc)
+
+			cpu := test.run(t, mode)
+			test.Result.Validate(cpu, t)
+		}
+	}
+}
+
+// Returns the CPU cycles taken by a program that starts with `op` and reads
+// LO after `nops` NOPs
+func multDivCycles(t *testing.T, op uint32, nops int, regs []cpuRegister) uint64 {
+	program := []uint32{op}
+	for i := 0; i < nops; i++ {
+		program = append(program, 0)
+	}
+	program = append(program, asmR(0b010010, 3, 0, 0)) // mflo r3
+	test := cpuTest{Initial: cpuState{Regs: regs}, Program: program}
+	return test.run(t, CPU_MODE_INTERPRETER).Th.CpuCycles
+}
+
+func TestCPUMultDivStall(t *testing.T) {
+	div := asmR(0b011010, 0, 1, 2)  // div r1, r2
+	mult := asmR(0b011000, 0, 1, 2) // mult r1, r2
+	small := []cpuRegister{{1, 3}, {2, 0x12345678}}
+	large := []cpuRegister{{1, 0xfff00000}, {2, 7}}  // -2^20 fits in 20 bits
+	larger := []cpuRegister{{1, 0x7fffffff}, {2, 7}} // doesn't
+
+	// MFLO waits for the division, the NOPs run while it's busy
+	if a, b := multDivCycles(t, div, 0, small), multDivCycles(t, div, 2, small); a != b {
+		t.Errorf("DIV: MFLO right after took %d cycles, after 2 NOPs %d", a, b)
+	}
+	// the stall depends on the size of rs
+	smallCycles := multDivCycles(t, mult, 0, small)
+	largeCycles := multDivCycles(t, mult, 0, large)
+	largerCycles := multDivCycles(t, mult, 0, larger)
+	if largeCycles-smallCycles != MULT_CYCLES_MEDIUM-MULT_CYCLES_SMALL {
+		t.Errorf("MULT: expected %d more cycles with a 20 bit rs, got %d",
+			MULT_CYCLES_MEDIUM-MULT_CYCLES_SMALL, largeCycles-smallCycles)
+	}
+	if largerCycles-smallCycles != MULT_CYCLES_LARGE-MULT_CYCLES_SMALL {
+		t.Errorf("MULT: expected %d more cycles with a 32 bit rs, got %d",
+			MULT_CYCLES_LARGE-MULT_CYCLES_SMALL, largerCycles-smallCycles)
+	}
+	if divCycles := multDivCycles(t, div, 0, small); divCycles-smallCycles != DIV_CYCLES-MULT_CYCLES_SMALL {
+		t.Errorf("DIV: expected %d more cycles than a small MULT, got %d",
+			DIV_CYCLES-MULT_CYCLES_SMALL, divCycles-smallCycles)
+	}
+}
+
+func TestLoadDelay(t *testing.T) {
+	var load LoadDelay
+	load.Set(3, 0x1234)
+	if !load.Pending(3) || load.Pending(4) {
+		t.Error("expected a pending load into register 3 only")
+	}
+
+	if reg, val := load.Take(); reg != 3 || val != 0x1234 {
+		t.Errorf("expected a load of 0x1234 into register 3, got 0x%x into %d", val, reg)
+	}
+	if load.Pending(3) || load.Committed != 3 {
+		t.Errorf("expected the load to be committed, got %+v", load)
+	}
+
+	// loads into $zero are never pending
+	load.Set(0, 1)
+	if load.Pending(0) {
+		t.Error("a load into register 0 is pending")
+	}
+}
+
+// Runs the same programs with pre-decoded blocks, which must match the
+// interpreter
+func TestCPUCached(t *testing.T) {
+	for idx, test := range cpuTests {
+		t.Logf("running test %d: %s", idx+1, test.Desc)
+
+		cpu := test.run(t, CPU_MODE_CACHED)
+		test.Result.Validate(cpu, t)
+	}
+}
+
+// Same with threaded code. Every block is compiled the first time it's
+// reached, the programs only run once
+func TestCPUJit(t *testing.T) {
+	for idx, test := range cpuTests {
+		t.Logf("running test %d: %s", idx+1, test.Desc)
+
+		cpu := test.makeCpu(CPU_MODE_JIT)
+		cpu.Jit.Threshold = 1
+		test.Result.Validate(test.runCpu(t, cpu), t)
+	}
+}
+
+// Emulated time the BIOS takes to reach the shell without a disc
+const BIOS_BOOT_CYCLES = 6 * uint64(CPU_FREQ_HZ)
+
+// Runs the BIOS from power-on until it reaches the shell. Set GOPSX_BIOS to
+// the path of a BIOS image to run it, it's skipped otherwise
+func BenchmarkBiosBoot(b *testing.B) {
+	path := os.Getenv("GOPSX_BIOS")
+	if path == "" {
+		b.Skip("GOPSX_BIOS is not set")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	bios, err := LoadBIOS(file)
+	file.Close()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var cycles uint64
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		inter := NewInterconnect(bios, NewRAM(), NewGPU(HARDWARE_NTSC), nil)
+		cpu := NewCPU(inter)
+		for cpu.Th.Cycles < BIOS_BOOT_CYCLES {
+			cpu.Step()
+		}
+		cycles += cpu.Th.Cycles
+	}
+	b.ReportMetric(float64(cycles)/b.Elapsed().Seconds(), "cycles/s")
+}
@@ -0,0 +1,170 @@
+package emulator
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Amount of instructions disassembled before and after the crashing one
+const CRASH_DISASM_WINDOW = 16
+
+// Reads a word of RAM or BIOS without side effects. Returns false for the
+// other regions
+func (inter *Interconnect) peek32(addr uint32) (uint32, bool) {
+	absAddr := MaskRegion(addr &^ 3)
+	if ok, offset := RAM_RANGE.ContainsAndOffset(absAddr); ok {
+		return inter.Ram.Load32(offset), true
+	}
+	if ok, offset := BIOS_RANGE.ContainsAndOffset(absAddr); ok {
+		return inter.Bios.Load32(offset), true
+	}
+	return 0, false
+}
+
+// Writes the instructions around `pc`, the instruction at `pc` is marked
+// with an arrow. The functions of `symbols` start with a label
+func writeDisassembly(w io.Writer, inter *Interconnect, pc uint32, symbols *Symbols) {
+	start := pc - CRASH_DISASM_WINDOW*4
+	for i := uint32(0); i <= 2*CRASH_DISASM_WINDOW; i++ {
+		addr := start + i*4
+		if symbol, offset, ok := symbols.Lookup(addr); ok && offset == 0 {
+			fmt.Fprintf(w, "%s:\n", symbol.Name)
+		}
+		marker := "  "
+		if addr == pc {
+			marker = "->"
+		}
+		word, ok := inter.peek32(addr)
+		if !ok {
+			fmt.Fprintf(w, "%s %08x: ????????\n", marker, addr)
+			continue
+		}
+		op := Instruction(word)
+		fmt.Fprintf(w, "%s %08x: %08x  %s\n", marker, addr, word, op.DisassembleSymbols(addr, symbols))
+	}
+}
+
+// Writes a text report of the state of the console: the CPU registers,
+// the GPU and CD-ROM state, the last traced instructions (see
+// Debugger.Trace), the call stack (see Debugger.CallStack) and the code
+// around the current instruction. `reason`
+// is the recovered panic value and `stack` the Go stack, they can be nil
+func WriteCrashReport(w io.Writer, cpu *CPU, reason interface{}, stack []byte) {
+	inter := cpu.Inter
+	symbols := cpu.Debugger.Symbols
+	fmt.Fprintf(w, "panic: %v\n\n", reason)
+
+	fmt.Fprintf(w, "CPU (%d cycles):\n", cpu.Th.Cycles)
+	fmt.Fprintf(w, "  pc: %08x  next: %08x  current: %08x", cpu.PC, cpu.NextPC, cpu.CurrentPC)
+	if name := symbols.Format(cpu.CurrentPC); name != "" {
+		fmt.Fprintf(w, " <%s>", name)
+	}
+	fmt.Fprintln(w)
+	for i := uint32(0); i < 32; i++ {
+		fmt.Fprintf(w, "  %-4s %08x", GetRegisterName(i)+":", cpu.Regs[i])
+		if i%4 == 3 {
+			fmt.Fprintln(w)
+		}
+	}
+	fmt.Fprintf(w, "  hi: %08x  lo: %08x\n", cpu.Hi, cpu.Lo)
+	cop0 := cpu.Cop0
+	fmt.Fprintf(
+		w, "  sr: %08x  cause: %08x  epc: %08x  badvaddr: %08x\n\n",
+		cop0.SR, cop0.Cause, cop0.Epc, cop0.BadVaddr,
+	)
+
+	gpu := inter.Gpu
+	fmt.Fprintf(w, "GPU (frame %d, %d draw calls):\n", gpu.Frames, gpu.DrawCalls)
+	fmt.Fprintf(w, "  status: %08x  display: %v\n", gpu.Status(), gpu.DisplayArea())
+	fmt.Fprintf(w, "  gp0 mode: %d  words remaining: %d", gpu.GP0Mode, gpu.GP0WordsRemaining)
+	if gpu.GP0Command.Len > 0 {
+		fmt.Fprintf(w, "  command: %08x", gpu.GP0Command.Buffer[:gpu.GP0Command.Len])
+	}
+	fmt.Fprint(w, "\n\n")
+
+	cdrom := inter.CdRom
+	fmt.Fprintln(w, "CD-ROM:")
+	fmt.Fprintf(
+		w, "  state: %s  position: %02d:%02d:%02d\n",
+		cdrom.ReadState.State, cdrom.Position.M, cdrom.Position.S, cdrom.Position.F,
+	)
+	fmt.Fprintf(
+		w, "  last command: 0x%02x %s  running: %t\n",
+		cdrom.LastCommand, CDROM_COMMAND_NAMES[cdrom.LastCommand], cdrom.Command != nil,
+	)
+	if cdrom.Disc != nil {
+		fmt.Fprintf(w, "  disc: %s %s\n", cdrom.Disc.GameID(), cdrom.Disc.RegionString())
+	}
+	fmt.Fprintln(w)
+
+	if trace := cpu.Debugger.Trace; trace != nil {
+		fmt.Fprintln(w, "last instructions:")
+		for _, pc := range trace.Entries() {
+			location := fmt.Sprintf("%08x", pc)
+			if name := symbols.Format(pc); name != "" {
+				location += " <" + name + ">"
+			}
+			if word, ok := inter.peek32(pc); ok {
+				fmt.Fprintf(w, "  %s: %s\n", location, Instruction(word).DisassembleSymbols(pc, symbols))
+			} else {
+				fmt.Fprintf(w, "  %s\n", location)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+
+	if stack := cpu.Debugger.CallStack; stack != nil {
+		fmt.Fprintln(w, "call stack:")
+		stack.Dump(w, symbols)
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintln(w, "code:")
+	writeDisassembly(w, inter, cpu.CurrentPC, symbols)
+
+	if len(stack) > 0 {
+		fmt.Fprintf(w, "\ngo stack:\n%s", strings.TrimRight(string(stack), "\n"))
+		fmt.Fprintln(w)
+	}
+}
+
+// Writes a zip archive with the crash report (crash.txt, see
+// WriteCrashReport) and a savestate of the console (crash.state, see
+// WriteSaveState). The savestate is left out if the state is too broken to
+// be saved
+func WriteCrashDump(w io.Writer, cpu *CPU, reason interface{}, stack []byte) error {
+	archive := zip.NewWriter(w)
+	report, err := archive.Create("crash.txt")
+	if err != nil {
+		return err
+	}
+	WriteCrashReport(report, cpu, reason, stack)
+
+	var state bytes.Buffer
+	if err := writeCrashState(&state, cpu); err != nil {
+		// the report is still useful without the savestate
+		Log.Warnf(LOG_MODULE_CPU, "crash dump: couldn't save the state: %s", err)
+		return archive.Close()
+	}
+	file, err := archive.Create("crash.state")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(state.Bytes()); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// Saves the state of a crashed console, recovering from a second panic
+func writeCrashState(w io.Writer, cpu *CPU) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return WriteSaveState(w, cpu)
+}
@@ -0,0 +1,67 @@
+package emulator
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestTraceEntries(t *testing.T) {
+	trace := NewTrace(4)
+	for pc := uint32(0); pc < 3; pc++ {
+		trace.Add(pc * 4)
+	}
+	if entries := trace.Entries(); len(entries) != 3 || entries[0] != 0 || entries[2] != 8 {
+		t.Errorf("unexpected entries %v", entries)
+	}
+	for pc := uint32(3); pc < 6; pc++ {
+		trace.Add(pc * 4)
+	}
+	// only the last 4 are kept, oldest first
+	want := []uint32{8, 12, 16, 20}
+	entries := trace.Entries()
+	for i := range want {
+		if i >= len(entries) || entries[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, entries)
+		}
+	}
+}
+
+func TestWriteCrashDump(t *testing.T) {
+	cpu := saveStateTest.makeCpu(CPU_MODE_INTERPRETER)
+	cpu.Debugger.Trace = NewTrace(8)
+	for i := 0; i < 100; i++ {
+		cpu.Step()
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCrashDump(&buf, cpu, "test panic", []byte("goroutine 1 [running]:")); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{}
+	for _, file := range archive.File {
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[file.Name], _ = io.ReadAll(r)
+		r.Close()
+	}
+
+	report := string(files["crash.txt"])
+	for _, want := range []string{"panic: test panic", "last instructions:", "ADDIU at, at, 0x1", "-> ", "goroutine 1"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("the report doesn't contain \"%s\":\n%s", want, report)
+		}
+	}
+	if _, err := ReadSaveStateHeader(bytes.NewReader(files["crash.state"])); err != nil {
+		t.Errorf("invalid savestate in the crash dump: %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package emulator
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Maximum depth of a CallStack, the oldest calls are dropped past it
+const CALLSTACK_MAX_DEPTH = 256
+
+// A function call of the guest program
+type CallFrame struct {
+	Caller uint32 // Address of the JAL or JALR
+	Func   uint32 // Address of the called function
+	Return uint32 // Where the function returns to
+}
+
+// Call stack of the guest program, rebuilt from the jumps: JAL and JALR
+// push a call, a jump register to the return address of a call (usually
+// JR ra) pops it and the calls above it. See Debugger.CallStack
+type CallStack struct {
+	Frames []CallFrame // Calls from the outermost to the innermost
+}
+
+// Returns an empty call stack
+func NewCallStack() *CallStack {
+	return &CallStack{}
+}
+
+// Records a call from `caller` to `target`, returning to `ret`
+func (stack *CallStack) call(caller, target, ret uint32) {
+	if len(stack.Frames) == CALLSTACK_MAX_DEPTH {
+		// deep recursion, keep the innermost calls
+		copy(stack.Frames, stack.Frames[1:])
+		stack.Frames = stack.Frames[:len(stack.Frames)-1]
+	}
+	stack.Frames = append(stack.Frames, CallFrame{caller, target, ret})
+}
+
+// Records a jump register to `target`. Returns from the innermost call
+// that returns to `target`, or does nothing if it isn't a return (a jump
+// table, a call through the BIOS tables...)
+func (stack *CallStack) jump(target uint32) {
+	for i := len(stack.Frames) - 1; i >= 0; i-- {
+		if stack.Frames[i].Return == target {
+			stack.Frames = stack.Frames[:i]
+			return
+		}
+	}
+}
+
+// Empties the stack, e.g. when the console is reset. Does nothing on a nil
+// stack
+func (stack *CallStack) Reset() {
+	if stack != nil {
+		stack.Frames = stack.Frames[:0]
+	}
+}
+
+// Returns the function the innermost call went to, or false if the stack is
+// empty
+func (stack *CallStack) Current() (uint32, bool) {
+	if stack == nil || len(stack.Frames) == 0 {
+		return 0, false
+	}
+	return stack.Frames[len(stack.Frames)-1].Func, true
+}
+
+// Writes the calls from the innermost to the outermost, with the function
+// names of `symbols` (can be nil)
+func (stack *CallStack) Dump(w io.Writer, symbols *Symbols) {
+	for i := len(stack.Frames) - 1; i >= 0; i-- {
+		frame := stack.Frames[i]
+		fmt.Fprintf(w, "  #%-3d %s called from %s\n", len(stack.Frames)-1-i,
+			formatAddr(frame.Func, symbols), formatAddr(frame.Caller, symbols))
+	}
+}
+
+// Returns "0x80010000 <main>", or only the address if there's no symbol
+func formatAddr(addr uint32, symbols *Symbols) string {
+	if name := symbols.Format(addr); name != "" {
+		return fmt.Sprintf("%08x <%s>", addr, name)
+	}
+	return fmt.Sprintf("%08x", addr)
+}
+
+// Guest cycles spent in a function, see FunctionProfiler
+type FunctionProfile struct {
+	Func   uint32
+	Name   string // Symbol of the function, empty if unknown
+	Cycles uint64
+}
+
+// Attributes the guest cycles to the functions of the program. At every
+// instruction, the cycles since the previous one go to the function that
+// contains it: the symbol before it, or the innermost call of the call
+// stack without symbols, or the address of the instruction without either
+type FunctionProfiler struct {
+	cycles    map[uint32]uint64 // Cycles by function address
+	lastCycle uint64
+	started   bool
+}
+
+// Returns a new function profiler, see Debugger.Functions
+func NewFunctionProfiler() *FunctionProfiler {
+	return &FunctionProfiler{cycles: map[uint32]uint64{}}
+}
+
+// Attributes the cycles up to CPU cycle `now` to the function `fn`
+func (prof *FunctionProfiler) add(fn uint32, now uint64) {
+	if prof.started && now > prof.lastCycle {
+		prof.cycles[fn] += now - prof.lastCycle
+	}
+	prof.started = true
+	prof.lastCycle = now
+}
+
+// Forgets the measurements
+func (prof *FunctionProfiler) Reset() {
+	prof.cycles = map[uint32]uint64{}
+	prof.started = false
+}
+
+// Returns the functions from the most to the least expensive, named with
+// `symbols` (can be nil)
+func (prof *FunctionProfiler) Functions(symbols *Symbols) []FunctionProfile {
+	functions := make([]FunctionProfile, 0, len(prof.cycles))
+	for fn, cycles := range prof.cycles {
+		functions = append(functions, FunctionProfile{fn, symbols.Format(fn), cycles})
+	}
+	sort.Slice(functions, func(i, j int) bool {
+		if functions[i].Cycles != functions[j].Cycles {
+			return functions[i].Cycles > functions[j].Cycles
+		}
+		return functions[i].Func < functions[j].Func
+	})
+	return functions
+}
+
+// Writes the `count` most expensive functions with their share of the
+// cycles
+func (prof *FunctionProfiler) Dump(w io.Writer, symbols *Symbols, count int) {
+	functions := prof.Functions(symbols)
+	var total uint64
+	for _, fn := range functions {
+		total += fn.Cycles
+	}
+	if len(functions) > count {
+		functions = functions[:count]
+	}
+	for _, fn := range functions {
+		name := fn.Name
+		if name == "" {
+			name = "?"
+		}
+		percent := float64(fn.Cycles) / float64(total) * 100
+		fmt.Fprintf(w, "%5.1f%% %12d cycles  %08x %s\n", percent, fn.Cycles, fn.Func, name)
+	}
+}
@@ -0,0 +1,74 @@
+package emulator
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCallStack(t *testing.T) {
+	base := uint32(CPU_TEST_BASE)
+	test := cpuTest{
+		Program: []uint32{
+			asmJ(0x03, base+0x20), // jal outer
+			0,
+			0,
+			0,
+			// inner:
+			asmR(0x08, 0, 31, 0), // jr ra
+			0,
+			0,
+			0,
+			// outer:
+			asmR(0x21, 16, 31, 0), // addu s0, ra, r0
+			asmJ(0x03, base+0x10), // jal inner
+			0,
+			asmR(0x08, 0, 16, 0), // jr s0
+			0,
+		},
+	}
+	cpu := test.makeCpu(CPU_MODE_INTERPRETER)
+	cpu.Debugger.CallStack = NewCallStack()
+	cpu.Debugger.Functions = NewFunctionProfiler()
+	cpu.Debugger.Symbols = NewSymbols()
+	cpu.Debugger.Symbols.Add(base+0x20, "outer")
+
+	depths := map[uint32]int{}
+	for steps := 0; steps < 20 && cpu.PC != base+0x0c; steps++ {
+		depths[cpu.PC] = len(cpu.Debugger.CallStack.Frames)
+		if cpu.PC == base+0x10 {
+			var dump bytes.Buffer
+			cpu.Debugger.CallStack.Dump(&dump, cpu.Debugger.Symbols)
+			if !strings.Contains(dump.String(), "called from") || !strings.Contains(dump.String(), "<outer+0x4>") {
+				t.Errorf("unexpected call stack dump:\n%s", dump.String())
+			}
+		}
+		cpu.Step()
+	}
+
+	for _, check := range []struct {
+		pc    uint32
+		depth int
+	}{
+		{base + 0x20, 1}, // in outer
+		{base + 0x10, 2}, // in inner
+		{base + 0x2c, 1}, // back in outer
+		{base + 0x08, 0}, // back in the caller
+	} {
+		if depth, ok := depths[check.pc]; !ok || depth != check.depth {
+			t.Errorf("0x%08x: expected %d calls, got %d (reached: %t)", check.pc, check.depth, depth, ok)
+		}
+	}
+
+	// outer has a symbol, inner is found through the call stack
+	functions := map[uint32]FunctionProfile{}
+	for _, fn := range cpu.Debugger.Functions.Functions(cpu.Debugger.Symbols) {
+		functions[fn.Func] = fn
+	}
+	if fn := functions[base+0x20]; fn.Name != "outer" || fn.Cycles == 0 {
+		t.Errorf("expected cycles in outer, got %+v", fn)
+	}
+	if fn := functions[base+0x10]; fn.Cycles == 0 {
+		t.Errorf("expected cycles in inner, got %+v", fn)
+	}
+}
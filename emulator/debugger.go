@@ -1,11 +1,18 @@
 package emulator
 
-import "fmt"
-
 type Debugger struct {
-	Breakpoints      []uint32 // All breakpoint addresses
-	ReadWatchpoints  []uint32 // All read watchpoints
-	WriteWatchpoints []uint32 // All write watchpoints
+	Breakpoints      []uint32    // All breakpoint addresses
+	ReadWatchpoints  []uint32    // All read watchpoints
+	WriteWatchpoints []uint32    // All write watchpoints
+	ICache           ICacheStats // Instruction cache counters
+	// Last executed instructions, nil if tracing is off
+	Trace *Trace
+	// Names of the functions of the program, nil if none are loaded
+	Symbols *Symbols
+	// Calls of the guest program, nil if they aren't tracked
+	CallStack *CallStack
+	// Guest cycles spent in every function, nil if they aren't measured
+	Functions *FunctionProfiler
 }
 
 func NewDebugger() *Debugger {
@@ -23,6 +30,17 @@ func (debugger *Debugger) AddBreakpoint(addr uint32) {
 	debugger.Breakpoints = append(debugger.Breakpoints, addr)
 }
 
+// Adds a breakpoint on a symbol of Symbols, or on an address written as a
+// number
+func (debugger *Debugger) AddBreakpointSymbol(name string) error {
+	addr, err := debugger.Symbols.Resolve(name)
+	if err != nil {
+		return err
+	}
+	debugger.AddBreakpoint(addr)
+	return nil
+}
+
 // Deletes a breakpoint at `addr`. Does nothing if it doesn't exist
 func (debugger *Debugger) DeleteBreakpoint(addr uint32) {
 	for idx, breakpoint := range debugger.Breakpoints {
@@ -82,23 +100,61 @@ func (debugger *Debugger) DeleteWriteWatchpoint(addr uint32) {
 	}
 }
 
-// Debugger entrypoint
-func (debugger *Debugger) changedPc(pc uint32) {
+// Debugger entrypoint, called before the instruction at `pc` runs at CPU
+// cycle `cycles`
+func (debugger *Debugger) changedPc(pc uint32, cycles uint64) {
+	if debugger.Trace != nil {
+		debugger.Trace.Add(pc)
+	}
+	if debugger.Functions != nil {
+		debugger.Functions.add(debugger.functionAt(pc), cycles)
+	}
 	// check if a breakpoint exists for this address
 	for _, breakpoint := range debugger.Breakpoints {
 		if breakpoint == pc {
-			fmt.Printf("debugger: reached breakpoint 0x%x\n", pc)
+			if name := debugger.Symbols.Format(pc); name != "" {
+				Log.Infof(LOG_MODULE_CPU, "reached breakpoint 0x%x (%s)", pc, name)
+			} else {
+				Log.Infof(LOG_MODULE_CPU, "reached breakpoint 0x%x", pc)
+			}
 			debugger.Debug()
 			return
 		}
 	}
 }
 
+// Returns the address of the function that contains `pc`, see
+// FunctionProfiler
+func (debugger *Debugger) functionAt(pc uint32) uint32 {
+	if symbol, _, ok := debugger.Symbols.Lookup(pc); ok {
+		return symbol.Addr
+	}
+	if fn, ok := debugger.CallStack.Current(); ok {
+		return fn
+	}
+	return pc
+}
+
+// Called by the CPU when the instruction at `caller` calls `target` (JAL,
+// JALR, BLTZAL and BGEZAL), the call returns to `ret`
+func (debugger *Debugger) call(caller, target, ret uint32) {
+	if debugger.CallStack != nil {
+		debugger.CallStack.call(caller, target, ret)
+	}
+}
+
+// Called by the CPU on a JR to `target`
+func (debugger *Debugger) jumpRegister(target uint32) {
+	if debugger.CallStack != nil {
+		debugger.CallStack.jump(target)
+	}
+}
+
 // Called by the CPU when it's about to read a value from memory
 func (debugger *Debugger) memoryRead(addr uint32) {
 	for _, watchpoint := range debugger.ReadWatchpoints {
 		if watchpoint == addr {
-			fmt.Printf("debugger: triggered read watchpoint 0x%x\n", addr)
+			Log.Infof(LOG_MODULE_CPU, "triggered read watchpoint 0x%x", addr)
 			debugger.Debug()
 			return
 		}
@@ -109,13 +165,16 @@ func (debugger *Debugger) memoryRead(addr uint32) {
 func (debugger *Debugger) memoryWrite(addr uint32) {
 	for _, watchpoint := range debugger.WriteWatchpoints {
 		if watchpoint == addr {
-			fmt.Printf("debugger: triggered write watchpoint 0x%x\n", addr)
+			Log.Infof(LOG_MODULE_CPU, "triggered write watchpoint 0x%x", addr)
 			debugger.Debug()
 			return
 		}
 	}
 }
 
+// Stops the emulation at a breakpoint or a watchpoint. There's no
+// interactive debugger yet, the frontend recovers from the panic and writes
+// a crash dump
 func (debugger *Debugger) Debug() {
-	panic("TODO: not implemented")
+	panic("debugger: stopped at a breakpoint")
 }
@@ -0,0 +1,290 @@
+package emulator
+
+import (
+	"bufio"
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Magic of the SN Systems (Psy-Q) .sym files
+var SN_SYM_MAGIC = []byte("MND\x01")
+
+// A named address
+type Symbol struct {
+	Addr uint32
+	Name string
+}
+
+// Function and variable names of the running program, see LoadSymbols. A
+// nil table has no symbols
+type Symbols struct {
+	list   []Symbol          // Sorted by address
+	byName map[string]uint32 // Addresses by name
+}
+
+// Returns an empty symbol table
+func NewSymbols() *Symbols {
+	return &Symbols{byName: map[string]uint32{}}
+}
+
+// Adds a symbol, replacing the address of a symbol with the same name
+func (symbols *Symbols) Add(addr uint32, name string) {
+	if old, ok := symbols.byName[name]; ok {
+		i := symbols.index(old)
+		for ; i < len(symbols.list) && symbols.list[i].Addr == old; i++ {
+			if symbols.list[i].Name == name {
+				symbols.list = append(symbols.list[:i], symbols.list[i+1:]...)
+				break
+			}
+		}
+	}
+	symbols.byName[name] = addr
+
+	// keep the list sorted, symbols usually come in order
+	i := symbols.after(addr)
+	symbols.list = append(symbols.list, Symbol{})
+	copy(symbols.list[i+1:], symbols.list[i:])
+	symbols.list[i] = Symbol{addr, name}
+}
+
+// Returns the index of the first symbol at or after `addr`
+func (symbols *Symbols) index(addr uint32) int {
+	return sort.Search(len(symbols.list), func(i int) bool {
+		return symbols.list[i].Addr >= addr
+	})
+}
+
+// Returns the index of the first symbol after `addr`
+func (symbols *Symbols) after(addr uint32) int {
+	return sort.Search(len(symbols.list), func(i int) bool {
+		return symbols.list[i].Addr > addr
+	})
+}
+
+// Returns the amount of symbols
+func (symbols *Symbols) Len() int {
+	if symbols == nil {
+		return 0
+	}
+	return len(symbols.list)
+}
+
+// Returns the address of the symbol `name`
+func (symbols *Symbols) Address(name string) (uint32, bool) {
+	if symbols == nil {
+		return 0, false
+	}
+	addr, ok := symbols.byName[name]
+	return addr, ok
+}
+
+// Returns the closest symbol at or before `addr` and the offset of `addr`
+// from it
+func (symbols *Symbols) Lookup(addr uint32) (Symbol, uint32, bool) {
+	if symbols == nil {
+		return Symbol{}, 0, false
+	}
+	i := symbols.after(addr)
+	if i == 0 {
+		return Symbol{}, 0, false
+	}
+	symbol := symbols.list[i-1]
+	return symbol, addr - symbol.Addr, true
+}
+
+// Returns `addr` as "name" or "name+0x10", or an empty string if there's
+// no symbol before it
+func (symbols *Symbols) Format(addr uint32) string {
+	symbol, offset, ok := symbols.Lookup(addr)
+	if !ok {
+		return ""
+	}
+	if offset == 0 {
+		return symbol.Name
+	}
+	return fmt.Sprintf("%s+0x%x", symbol.Name, offset)
+}
+
+// Returns the address of a symbol name or of a number (0x80010000),
+// e.g. for breakpoints
+func (symbols *Symbols) Resolve(s string) (uint32, error) {
+	if addr, ok := symbols.Address(s); ok {
+		return addr, nil
+	}
+	addr, err := strconv.ParseUint(s, 0, 32)
+	if err != nil {
+		return 0, fmt.Errorf("unknown symbol \"%s\"", s)
+	}
+	return uint32(addr), nil
+}
+
+// Loads a symbol file: an ELF executable with a symbol table, an SN
+// Systems .sym file or a text .map file. Map files have an address and a
+// name on each line, like the symbol list of psylink maps or the output of
+// nm
+func LoadSymbols(r io.Reader) (*Symbols, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(data, []byte(elf.ELFMAG)):
+		return loadElfSymbols(data)
+	case bytes.HasPrefix(data, SN_SYM_MAGIC):
+		return loadSnSymbols(data)
+	}
+	return loadMapSymbols(data)
+}
+
+// Loads the function and object symbols of an ELF file
+func loadElfSymbols(data []byte) (*Symbols, error) {
+	file, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	list, err := file.Symbols()
+	if err != nil {
+		return nil, err
+	}
+	symbols := NewSymbols()
+	for _, symbol := range list {
+		switch elf.ST_TYPE(symbol.Info) {
+		case elf.STT_FUNC, elf.STT_OBJECT, elf.STT_NOTYPE:
+			if symbol.Name != "" && symbol.Section != elf.SHN_UNDEF {
+				symbols.Add(uint32(symbol.Value), symbol.Name)
+			}
+		}
+	}
+	return symbols, nil
+}
+
+// Loads the symbols and labels of an SN Systems .sym file. The debug
+// information (source lines, types...) is skipped
+func loadSnSymbols(data []byte) (*Symbols, error) {
+	symbols := NewSymbols()
+	r := &snReader{data: data, pos: 8} // magic, version and unit
+	for r.pos < len(r.data) {
+		addr := r.u32()
+		kind := r.u8()
+		switch kind {
+		case 0x01, 0x02: // symbol, label
+			symbols.Add(addr, r.name())
+		case 0x80, 0x8a, 0x9a: // next line, end of file, set overlay
+		case 0x82: // add to line
+			r.skip(1)
+		case 0x84: // add to line
+			r.skip(2)
+		case 0x86, 0x8e, 0x90, 0x92: // set line, function end, block start and end
+			r.skip(4)
+		case 0x88: // set line and file
+			r.skip(4)
+			r.name()
+		case 0x8c: // function start
+			r.skip(2 + 4 + 2 + 4 + 4 + 4)
+			r.name()
+		case 0x94: // definition
+			r.skip(2 + 2 + 4)
+			r.name()
+		case 0x96: // array or struct definition
+			r.skip(2 + 2 + 4)
+			dims := int(r.u16())
+			r.skip(4 * dims)
+			r.name()
+			r.name()
+		case 0x98: // overlay
+			r.skip(4 + 4)
+		default:
+			return nil, fmt.Errorf("sym: unknown record 0x%02x at 0x%x", kind, r.pos-5)
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+	}
+	return symbols, nil
+}
+
+// Reads the little endian fields of a .sym file
+type snReader struct {
+	data []byte
+	pos  int
+	err  error // Set if a field goes past the end
+}
+
+func (r *snReader) skip(n int) []byte {
+	if r.err != nil || r.pos+n > len(r.data) {
+		r.err = errors.New("sym: unexpected end of file")
+		r.pos = len(r.data)
+		return make([]byte, n)
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *snReader) u8() uint8 {
+	return r.skip(1)[0]
+}
+
+func (r *snReader) u16() uint16 {
+	return binary.LittleEndian.Uint16(r.skip(2))
+}
+
+func (r *snReader) u32() uint32 {
+	return binary.LittleEndian.Uint32(r.skip(4))
+}
+
+// Reads a name prefixed with its length
+func (r *snReader) name() string {
+	return string(r.skip(int(r.u8())))
+}
+
+// Loads the lines of a map file that are an address and a name, with an
+// optional symbol type in between ("80010000 T main"). Other lines are
+// ignored
+func loadMapSymbols(data []byte) (*Symbols, error) {
+	symbols := NewSymbols()
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 3 && len(fields[1]) == 1 {
+			fields = []string{fields[0], fields[2]}
+		}
+		if len(fields) != 2 || !isSymbolName(fields[1]) {
+			continue
+		}
+		// addresses are padded, this skips the numbers of the other lines
+		hex := strings.TrimPrefix(strings.ToLower(fields[0]), "0x")
+		addr, err := strconv.ParseUint(hex, 16, 64)
+		if err != nil || len(hex) < 8 || addr > 0xffffffff {
+			continue
+		}
+		symbols.Add(uint32(addr), fields[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if symbols.Len() == 0 {
+		return nil, errors.New("map: no symbols found")
+	}
+	return symbols, nil
+}
+
+// Returns true if `s` looks like a C or assembler identifier
+func isSymbolName(s string) bool {
+	for i, c := range s {
+		switch {
+		case c == '_' || c == '.' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
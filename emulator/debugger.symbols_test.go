@@ -0,0 +1,94 @@
+package emulator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestSymbolsMap(t *testing.T) {
+	mapFile := `
+  Address  Names alphabetically
+
+  80010100  func
+  0x80010000  main
+  80020000 D _data
+  12 symbols
+`
+	symbols, err := LoadSymbols(strings.NewReader(mapFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if symbols.Len() != 3 {
+		t.Fatalf("expected 3 symbols, got %d", symbols.Len())
+	}
+	tests := []struct {
+		addr uint32
+		want string
+	}{
+		{0x80000000, ""},
+		{0x80010000, "main"},
+		{0x80010008, "main+0x8"},
+		{0x80010100, "func"},
+		{0x80030000, "_data+0x10000"},
+	}
+	for _, test := range tests {
+		if got := symbols.Format(test.addr); got != test.want {
+			t.Errorf("0x%08x: expected \"%s\", got \"%s\"", test.addr, test.want, got)
+		}
+	}
+	if addr, err := symbols.Resolve("func"); err != nil || addr != 0x80010100 {
+		t.Errorf("expected func at 0x80010100, got 0x%08x (%v)", addr, err)
+	}
+	if addr, err := symbols.Resolve("0x80010004"); err != nil || addr != 0x80010004 {
+		t.Errorf("expected the address 0x80010004, got 0x%08x (%v)", addr, err)
+	}
+	if _, err := symbols.Resolve("missing"); err == nil {
+		t.Error("expected an error for an unknown symbol")
+	}
+}
+
+func TestSymbolsSn(t *testing.T) {
+	var sym bytes.Buffer
+	sym.Write(SN_SYM_MAGIC)
+	sym.Write([]byte{0, 0, 0, 0})
+	record := func(addr uint32, kind byte, data ...byte) {
+		binary.Write(&sym, binary.LittleEndian, addr)
+		sym.WriteByte(kind)
+		sym.Write(data)
+	}
+	name := func(s string) []byte {
+		return append([]byte{byte(len(s))}, s...)
+	}
+	record(0x80010000, 0x01, name("main")...)
+	record(0x80010000, 0x88, append([]byte{1, 0, 0, 0}, name("main.c")...)...)
+	record(0x80010004, 0x82, 2)
+	record(0x80010040, 0x02, name("loop")...)
+	record(0x80010080, 0x8e, 9, 0, 0, 0)
+
+	data := sym.Bytes()
+	symbols, err := LoadSymbols(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if symbols.Len() != 2 || symbols.Format(0x80010044) != "loop+0x4" {
+		t.Errorf("expected main and loop, got %d symbols", symbols.Len())
+	}
+
+	// a truncated file is an error
+	if _, err := LoadSymbols(bytes.NewReader(data[:len(data)-2])); err == nil {
+		t.Error("expected an error for a truncated file")
+	}
+}
+
+func TestDisassembleSymbols(t *testing.T) {
+	symbols := NewSymbols()
+	symbols.Add(0xbfc00150, "start")
+	if got := Instruction(0x0ff00054).DisassembleSymbols(0xbfc00000, symbols); got != "JAL 0xbfc00150 <start>" {
+		t.Errorf("expected the jump target to be named, got \"%s\"", got)
+	}
+	if got := Instruction(0x1509fffe).DisassembleSymbols(0xbfc00010, nil); got != "BNE t0, t1, 0xbfc0000c" {
+		t.Errorf("expected no symbol without a table, got \"%s\"", got)
+	}
+}
@@ -0,0 +1,39 @@
+package emulator
+
+// Default amount of instructions kept by a Trace
+const TRACE_DEFAULT_SIZE = 64
+
+// Ring buffer of the addresses of the last executed instructions, see
+// Debugger.Trace
+type Trace struct {
+	PCs  []uint32 // Addresses, PCs[Next] is the oldest one once the buffer is full
+	Next int      // Where the next address is written
+	Full bool     // True once the buffer wrapped around
+}
+
+// Returns a trace that keeps the last `size` instructions
+func NewTrace(size int) *Trace {
+	if size <= 0 {
+		size = TRACE_DEFAULT_SIZE
+	}
+	return &Trace{PCs: make([]uint32, size)}
+}
+
+// Records the address of an instruction
+func (trace *Trace) Add(pc uint32) {
+	trace.PCs[trace.Next] = pc
+	trace.Next++
+	if trace.Next == len(trace.PCs) {
+		trace.Next = 0
+		trace.Full = true
+	}
+}
+
+// Returns the recorded addresses, from the oldest to the newest
+func (trace *Trace) Entries() []uint32 {
+	if !trace.Full {
+		return append([]uint32(nil), trace.PCs[:trace.Next]...)
+	}
+	entries := append([]uint32(nil), trace.PCs[trace.Next:]...)
+	return append(entries, trace.PCs[:trace.Next]...)
+}
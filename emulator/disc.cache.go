@@ -0,0 +1,158 @@
+package emulator
+
+import (
+	"container/list"
+	"sync"
+)
+
+const (
+	DISC_CACHE_SECTORS      = 256 // Sectors kept in the cache, about 600 KB
+	DISC_READ_AHEAD_SECTORS = 32  // Sectors read ahead of the last read sector
+)
+
+// Least recently used cache of raw sectors, keyed by their position. It's
+// shared by the emulation thread and the read-ahead goroutine
+type SectorCache struct {
+	Capacity int // Maximum amount of sectors
+	mu       sync.Mutex
+	hits     uint64                // Reads that were served from the cache
+	misses   uint64                // Reads that had to wait for the file
+	order    *list.List            // Most recently used first, the values are *cachedSector
+	sectors  map[Msf]*list.Element // Elements of `order` by position
+}
+
+type cachedSector struct {
+	msf  Msf
+	data [SECTOR_SIZE]byte
+}
+
+// Returns an empty cache of `capacity` sectors
+func NewSectorCache(capacity int) *SectorCache {
+	return &SectorCache{
+		Capacity: capacity,
+		order:    list.New(),
+		sectors:  make(map[Msf]*list.Element),
+	}
+}
+
+// Copies the sector at `msf` to `data`. Returns false if it isn't cached
+func (cache *SectorCache) Get(msf Msf, data *[SECTOR_SIZE]byte) bool {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	elem, ok := cache.sectors[msf]
+	if !ok {
+		cache.misses++
+		return false
+	}
+	cache.hits++
+	cache.order.MoveToFront(elem)
+	*data = elem.Value.(*cachedSector).data
+	return true
+}
+
+// Caches the sector at `msf`, the least recently used one is evicted if the
+// cache is full
+func (cache *SectorCache) Put(msf Msf, data *[SECTOR_SIZE]byte) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if elem, ok := cache.sectors[msf]; ok {
+		elem.Value.(*cachedSector).data = *data
+		cache.order.MoveToFront(elem)
+		return
+	}
+	if cache.order.Len() >= cache.Capacity {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.sectors, oldest.Value.(*cachedSector).msf)
+	}
+	cache.sectors[msf] = cache.order.PushFront(&cachedSector{msf, *data})
+}
+
+// Returns true if the sector at `msf` is cached, without counting as a use
+func (cache *SectorCache) Contains(msf Msf) bool {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	_, ok := cache.sectors[msf]
+	return ok
+}
+
+// Returns the amount of cached sectors
+func (cache *SectorCache) Len() int {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return cache.order.Len()
+}
+
+// Returns the hit and miss counters
+func (cache *SectorCache) Stats() (hits, misses uint64) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return cache.hits, cache.misses
+}
+
+// Asks the read-ahead goroutine to cache the sectors from `index`. A
+// position that wasn't picked up yet is replaced, this never blocks
+func (disc *Disc) ReadAhead(index uint32) {
+	if disc.isClosed() {
+		return
+	}
+	select {
+	case disc.readAhead <- index:
+		return
+	default:
+	}
+	select {
+	case <-disc.readAhead:
+	default:
+	}
+	select {
+	case disc.readAhead <- index:
+	default:
+	}
+}
+
+// Reads DISC_READ_AHEAD_SECTORS sectors from each requested position into
+// the cache, until the disc is closed. A new position (after a seek)
+// interrupts the current one
+func (disc *Disc) runReadAhead() {
+	for {
+		var index uint32
+		select {
+		case index = <-disc.readAhead:
+		case <-disc.closed:
+			return
+		}
+
+		for i := uint32(0); i < DISC_READ_AHEAD_SECTORS; i++ {
+			select {
+			case next := <-disc.readAhead:
+				index, i = next, 0
+			case <-disc.closed:
+				return
+			default:
+			}
+			disc.prefetch(index + i)
+		}
+	}
+}
+
+// Caches the sector at `index` if it's stored in a file and not cached yet
+func (disc *Disc) prefetch(index uint32) {
+	track := disc.TrackAt(index)
+	if track == nil || (index < track.Start && !track.PregapInFile) {
+		return
+	}
+	msf, err := MsfFromIndex(index)
+	if err != nil || disc.Cache.Contains(*msf) {
+		return
+	}
+
+	var data [SECTOR_SIZE]byte
+	if err := disc.readSectorData(track, index, &data); err != nil {
+		// the emulation thread gets the error when it reads the sector
+		return
+	}
+	disc.Cache.Put(*msf, &data)
+}
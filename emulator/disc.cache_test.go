@@ -0,0 +1,87 @@
+package emulator
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestSectorCache(t *testing.T) {
+	cache := NewSectorCache(2)
+	var data [SECTOR_SIZE]byte
+	for i := uint8(0); i < 3; i++ {
+		data[0] = i
+		cache.Put(Msf{0, 2, i}, &data)
+		// 00:02:00 is used again before 00:02:02 comes in
+		cache.Get(Msf{0, 2, 0}, &data)
+	}
+
+	if cache.Len() != 2 || cache.Contains(Msf{0, 2, 1}) {
+		t.Errorf("expected 00:02:01 to be evicted")
+	}
+	if !cache.Get(Msf{0, 2, 2}, &data) || data[0] != 2 {
+		t.Errorf("expected 00:02:02 to be cached, got %d", data[0])
+	}
+	if hits, misses := cache.Stats(); hits != 4 || misses != 0 {
+		t.Errorf("expected 4 hits, got %d hits and %d misses", hits, misses)
+	}
+}
+
+// Reading a sector caches the ones after it in the background
+func TestDiscReadAhead(t *testing.T) {
+	image := newTestIsoImage(nil)
+	disc, err := NewDisc(bytes.NewReader(image))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disc.Close()
+
+	msf := MsfFromBcd(0x00, 0x02, 0x10)
+	if _, err := disc.ReadSector(msf); err != nil {
+		t.Fatal(err)
+	}
+
+	// the image ends at 00:02:32
+	last := MsfFromBcd(0x00, 0x02, 0x31)
+	deadline := time.Now().Add(5 * time.Second)
+	for !disc.Cache.Contains(*last) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %s to be read ahead", last)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	_, misses := disc.Cache.Stats()
+	sector, err := disc.ReadSector(last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, after := disc.Cache.Stats(); after != misses {
+		t.Errorf("expected %s to be read from the cache", last)
+	}
+	offset := (last.SectorIndex() - LEAD_IN_SECTORS) * uint32(SECTOR_SIZE)
+	if !bytes.Equal(sector.Data[:], image[offset:offset+uint32(SECTOR_SIZE)]) {
+		t.Errorf("the cached sector differs from the image")
+	}
+}
+
+// Closing again or reading after Close doesn't panic
+func TestDiscClose(t *testing.T) {
+	image := newTestIsoImage(nil)
+	disc, err := NewDisc(bytes.NewReader(image))
+	if err != nil {
+		t.Fatal(err)
+	}
+	disc.Close()
+	disc.Close()
+
+	msf := MsfFromBcd(0x00, 0x02, 0x10)
+	sector, err := disc.ReadSector(msf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset := (msf.SectorIndex() - LEAD_IN_SECTORS) * uint32(SECTOR_SIZE)
+	if !bytes.Equal(sector.Data[:], image[offset:offset+uint32(SECTOR_SIZE)]) {
+		t.Errorf("the sector differs from the image")
+	}
+}
@@ -0,0 +1,192 @@
+package emulator
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Opens a file referenced by a cue sheet
+type CueFileOpener func(name string) (io.ReadSeeker, error)
+
+// Creates a new disc instance from a cue sheet. `open` is called for
+// every FILE entry in the sheet
+func NewDiscFromCue(cue io.Reader, open CueFileOpener) (*Disc, error) {
+	tracks, err := ParseCue(cue, open)
+	if err != nil {
+		return nil, err
+	}
+	if len(tracks) == 0 {
+		return nil, fmt.Errorf("cue: no tracks")
+	}
+	return newDiscFromTracks(tracks)
+}
+
+// Parses a cue sheet into a list of tracks
+func ParseCue(cue io.Reader, open CueFileOpener) ([]*Track, error) {
+	var tracks []*Track
+	var reader io.ReadSeeker
+	var fileSectors uint32 // Length of the current file
+	var fileStart uint32   // Sector index of the first sector of the current file
+	var silence uint32     // Length of all PREGAP (not in file) areas so far
+	var track *Track
+	var index0 int64 = -1 // INDEX 00 of the current track (relative to the file)
+
+	// length of each file in sectors, used to calculate the track lengths
+	fileLengths := map[io.ReadSeeker]uint32{}
+
+	scanner := bufio.NewScanner(cue)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "FILE":
+			name, err := parseCueFileName(scanner.Text())
+			if err != nil {
+				return nil, fmt.Errorf("cue: line %d: %s", line, err)
+			}
+
+			fileStart += fileSectors
+			reader, err = open(name)
+			if err != nil {
+				return nil, err
+			}
+			size, err := reader.Seek(0, io.SeekEnd)
+			if err != nil {
+				return nil, err
+			}
+			fileSectors = uint32(size / int64(SECTOR_SIZE))
+			fileLengths[reader] = fileSectors
+		case "TRACK":
+			if reader == nil {
+				return nil, fmt.Errorf("cue: line %d: TRACK before FILE", line)
+			}
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("cue: line %d: invalid TRACK", line)
+			}
+			number, err := strconv.ParseUint(fields[1], 10, 8)
+			if err != nil || number < 1 || number > 99 {
+				return nil, fmt.Errorf("cue: line %d: invalid track number", line)
+			}
+
+			var trackType TrackType
+			switch strings.ToUpper(fields[2]) {
+			case "MODE1/2352", "MODE2/2352":
+				trackType = TRACK_DATA
+			case "AUDIO":
+				trackType = TRACK_AUDIO
+			default:
+				return nil, fmt.Errorf(
+					"%w: cue: line %d: unsupported track type %s",
+					ErrUnsupportedImageFormat, line, fields[2],
+				)
+			}
+
+			track = &Track{
+				Number: uint8(number),
+				Type:   trackType,
+				Reader: reader,
+			}
+			tracks = append(tracks, track)
+			index0 = -1
+		case "PREGAP":
+			if track == nil || len(fields) < 2 {
+				return nil, fmt.Errorf("cue: line %d: invalid PREGAP", line)
+			}
+			length, err := parseCueMsf(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("cue: line %d: %s", line, err)
+			}
+			track.Pregap = length
+			silence += length
+		case "INDEX":
+			if track == nil || len(fields) < 3 {
+				return nil, fmt.Errorf("cue: line %d: invalid INDEX", line)
+			}
+			pos, err := parseCueMsf(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("cue: line %d: %s", line, err)
+			}
+
+			switch fields[1] {
+			case "00", "0":
+				index0 = int64(pos)
+			case "01", "1":
+				track.Offset = int64(pos) * int64(SECTOR_SIZE)
+				track.Start = LEAD_IN_SECTORS + silence + fileStart + pos
+				if index0 >= 0 {
+					track.Pregap = pos - uint32(index0)
+					track.PregapInFile = true
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// a track ends where the next track in the same file starts, or at
+	// the end of the file
+	for idx, track := range tracks {
+		first := uint32(track.Offset / int64(SECTOR_SIZE))
+		end := fileLengths[track.Reader]
+
+		if idx+1 < len(tracks) && tracks[idx+1].Reader == track.Reader {
+			next := tracks[idx+1]
+			end = uint32(next.Offset / int64(SECTOR_SIZE))
+			if next.PregapInFile {
+				end -= next.Pregap
+			}
+		}
+		if end < first {
+			return nil, fmt.Errorf("cue: track %d has a negative length", track.Number)
+		}
+		track.Length = end - first
+	}
+
+	return tracks, nil
+}
+
+// Returns the file name of a FILE line
+func parseCueFileName(line string) (string, error) {
+	if start := strings.IndexByte(line, '"'); start >= 0 {
+		end := strings.LastIndexByte(line, '"')
+		if end <= start {
+			return "", fmt.Errorf("unterminated file name")
+		}
+		return line[start+1 : end], nil
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return "", fmt.Errorf("invalid FILE")
+	}
+	return fields[1], nil
+}
+
+// Parses an mm:ss:ff (decimal) cue sheet position into a sector count
+func parseCueMsf(s string) (uint32, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid position %s", s)
+	}
+
+	var values [3]uint32
+	for idx, part := range parts {
+		v, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid position %s", s)
+		}
+		values[idx] = uint32(v)
+	}
+	if values[1] >= 60 || values[2] >= 75 {
+		return 0, fmt.Errorf("invalid position %s", s)
+	}
+
+	return values[0]*60*75 + values[1]*75 + values[2], nil
+}
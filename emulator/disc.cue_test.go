@@ -0,0 +1,154 @@
+package emulator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// Returns an opener for in-memory files of the given lengths in sectors
+func newTestCueFiles(sectors map[string]int) CueFileOpener {
+	return func(name string) (io.ReadSeeker, error) {
+		length, ok := sectors[name]
+		if !ok {
+			return nil, fmt.Errorf("%s not found", name)
+		}
+		return bytes.NewReader(make([]byte, length*int(SECTOR_SIZE))), nil
+	}
+}
+
+// Track fields checked by TestParseCue
+type cueTrack struct {
+	Number       uint8
+	Type         TrackType
+	Start        uint32
+	Length       uint32
+	Offset       int64
+	Pregap       uint32
+	PregapInFile bool
+}
+
+var cueTests = []struct {
+	Desc   string
+	Files  map[string]int
+	Sheet  string
+	Tracks []cueTrack
+}{
+	{
+		Desc:  "single file with an INDEX 00 pregap",
+		Files: map[string]int{"game.bin": 30},
+		Sheet: `FILE "game.bin" BINARY
+  TRACK 01 MODE2/2352
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    INDEX 00 00:00:20
+    INDEX 01 00:00:22`,
+		Tracks: []cueTrack{
+			{Number: 1, Type: TRACK_DATA, Start: 150, Length: 20},
+			{
+				Number: 2, Type: TRACK_AUDIO, Start: 172, Length: 8,
+				Offset: 22 * int64(SECTOR_SIZE), Pregap: 2, PregapInFile: true,
+			},
+		},
+	},
+	{
+		Desc:  "one file per track with PREGAP and INDEX 00",
+		Files: map[string]int{"t1.bin": 20, "t2 (audio).bin": 10, "t3.bin": 15},
+		Sheet: `FILE "t1.bin" BINARY
+  TRACK 01 MODE1/2352
+    INDEX 01 00:00:00
+FILE "t2 (audio).bin" BINARY
+  TRACK 02 AUDIO
+    PREGAP 00:02:00
+    INDEX 01 00:00:00
+FILE t3.bin BINARY
+  TRACK 03 AUDIO
+    INDEX 00 00:00:00
+    INDEX 01 00:00:05`,
+		Tracks: []cueTrack{
+			{Number: 1, Type: TRACK_DATA, Start: 150, Length: 20},
+			// the 2 second pregap isn't in the file, it shifts every
+			// following track
+			{Number: 2, Type: TRACK_AUDIO, Start: 150 + 20 + 150, Length: 10, Pregap: 150},
+			{
+				Number: 3, Type: TRACK_AUDIO, Start: 150 + 30 + 150 + 5, Length: 10,
+				Offset: 5 * int64(SECTOR_SIZE), Pregap: 5, PregapInFile: true,
+			},
+		},
+	},
+}
+
+func TestParseCue(t *testing.T) {
+	for _, test := range cueTests {
+		tracks, err := ParseCue(strings.NewReader(test.Sheet), newTestCueFiles(test.Files))
+		if err != nil {
+			t.Errorf("%s: %s", test.Desc, err)
+			continue
+		}
+		if len(tracks) != len(test.Tracks) {
+			t.Errorf("%s: expected %d tracks, got %d", test.Desc, len(test.Tracks), len(tracks))
+			continue
+		}
+		for i, track := range tracks {
+			got := cueTrack{
+				track.Number, track.Type, track.Start, track.Length,
+				track.Offset, track.Pregap, track.PregapInFile,
+			}
+			if got != test.Tracks[i] {
+				t.Errorf("%s: track %d: expected %+v, got %+v", test.Desc, i+1, test.Tracks[i], got)
+			}
+		}
+	}
+}
+
+// Pregap sectors belong to the track that follows them
+func TestCueTrackAt(t *testing.T) {
+	test := cueTests[1]
+	tracks, err := ParseCue(strings.NewReader(test.Sheet), newTestCueFiles(test.Files))
+	if err != nil {
+		t.Fatal(err)
+	}
+	disc := &Disc{Tracks: tracks}
+
+	for _, c := range []struct {
+		index  uint32
+		number uint8
+	}{{150, 1}, {169, 1}, {170, 2}, {320, 2}, {330, 3}, {334, 3}, {344, 3}} {
+		track := disc.TrackAt(c.index)
+		if track == nil || track.Number != c.number {
+			t.Errorf("sector %d: expected track %d, got %+v", c.index, c.number, track)
+		}
+	}
+	if track := disc.TrackAt(disc.End()); track != nil {
+		t.Errorf("expected the lead-out to have no track, got %d", track.Number)
+	}
+}
+
+func TestParseCueErrors(t *testing.T) {
+	files := newTestCueFiles(map[string]int{"a.bin": 10})
+	for _, c := range []struct {
+		sheet       string
+		unsupported bool
+	}{
+		{sheet: "TRACK 01 AUDIO"},
+		{sheet: "FILE \"a.bin BINARY"},
+		{sheet: "FILE \"missing.bin\" BINARY"},
+		{sheet: "FILE a.bin BINARY\nTRACK 100 AUDIO"},
+		{sheet: "FILE a.bin BINARY\nTRACK 01"},
+		{sheet: "FILE a.bin BINARY\nTRACK 01 MODE1/2048", unsupported: true},
+		{sheet: "FILE a.bin BINARY\nTRACK 01 AUDIO\nINDEX 01 00:60:00"},
+		{sheet: "FILE a.bin BINARY\nTRACK 01 AUDIO\nINDEX 01 00:00"},
+		{sheet: "FILE a.bin BINARY\nPREGAP 00:02:00"},
+		{sheet: "FILE a.bin BINARY\nTRACK 01 AUDIO\nINDEX 01 00:00:05\nTRACK 02 AUDIO\nINDEX 01 00:00:02"},
+	} {
+		_, err := ParseCue(strings.NewReader(c.sheet), files)
+		if err == nil {
+			t.Errorf("%q: expected an error", c.sheet)
+		} else if errors.Is(err, ErrUnsupportedImageFormat) != c.unsupported {
+			t.Errorf("%q: unexpected error %s", c.sheet, err)
+		}
+	}
+}
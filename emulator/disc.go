@@ -3,6 +3,7 @@ package emulator
 import (
 	"fmt"
 	"io"
+	"sync"
 )
 
 // CD sector size in bytes
@@ -29,24 +30,95 @@ func GetHardwareFromRegion(region Region) HardwareType {
 
 // A PlayStation disc
 type Disc struct {
-	Reader io.ReadSeeker // BIN reader
-	Region Region        // Disc region
+	Reader     io.ReadSeeker    // BIN reader of the first track
+	Tracks     []*Track         // Tracks, sorted by their start
+	Region     Region           // Disc region
+	Validation SectorValidation // How sector checksums are validated
+	// If true, sectors aren't read ahead or validated in the background,
+	// see CdRom.SetDeterministic
+	Deterministic bool
+	Worker        *DiscWorker   // Background worker for validation and hashing
+	Cache         *SectorCache  // Recently read and read-ahead sectors
+	readAhead     chan uint32   // Next position of the read-ahead goroutine, see ReadAhead
+	closed        chan struct{} // Closed by Close
+	closeOnce     sync.Once
+	readerMu      sync.Mutex // Guards the track readers, shared with the worker
+	gameId        string     // See GameID
+	bootPath      string     // See BootPath
 }
 
-// Creates a new disc instance
+// Creates a new disc instance from a single BIN file with one data track
 func NewDisc(r io.ReadSeeker) (*Disc, error) {
-	disc := &Disc{
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 || size%int64(SECTOR_SIZE) != 0 {
+		return nil, fmt.Errorf(
+			"%w: image size %d is not a multiple of %d",
+			ErrUnsupportedImageFormat, size, SECTOR_SIZE,
+		)
+	}
+
+	return newDiscFromTracks([]*Track{{
+		Number: 1,
+		Type:   TRACK_DATA,
 		Reader: r,
+		Start:  LEAD_IN_SECTORS,
+		Length: uint32(size / int64(SECTOR_SIZE)),
+	}})
+}
+
+func newDiscFromTracks(tracks []*Track) (*Disc, error) {
+	disc := &Disc{
+		Reader:     tracks[0].Reader,
+		Tracks:     tracks,
+		Validation: SECTOR_VALIDATION_ASYNC,
+		Worker:     NewDiscWorker(),
+		Cache:      NewSectorCache(DISC_CACHE_SECTORS),
+		readAhead:  make(chan uint32, 1),
+		closed:     make(chan struct{}),
 	}
+	go disc.runReadAhead()
 	err := disc.IdentifyRegion()
 	if err != nil {
+		disc.Close()
 		return nil, err
 	}
+	if err := disc.identifyGame(); err != nil {
+		// homebrew discs may not have a filesystem, they can still boot
+		Log.Warnf(LOG_MODULE_CDROM, "disc: couldn't identify the game: %s", err)
+	}
 	return disc, nil
 }
 
+// Stops the disc worker and the read-ahead goroutine. Doesn't close the
+// reader. Sectors can still be read afterwards, they aren't read ahead
+// anymore. Closing twice does nothing
+func (disc *Disc) Close() {
+	disc.closeOnce.Do(func() {
+		disc.Worker.Stop()
+		close(disc.closed)
+	})
+}
+
+// Returns true if the disc was closed
+func (disc *Disc) isClosed() bool {
+	select {
+	case <-disc.closed:
+		return true
+	default:
+		return false
+	}
+}
+
 func (disc *Disc) RegionString() string {
-	switch disc.Region {
+	return disc.Region.String()
+}
+
+// Returns the name of the region
+func (region Region) String() string {
+	switch region {
 	case REGION_JAPAN:
 		return "Japan"
 	case REGION_NORTH_AMERICA:
@@ -61,9 +133,13 @@ func (disc *Disc) RegionString() string {
 func (disc *Disc) IdentifyRegion() error {
 	// sector 00:02:04 should contain the "Licensed by"... string
 	msf := MsfFromBcd(0x00, 0x02, 0x04)
-	sector, err := disc.ReadDataSector(msf)
+	sector, err := disc.ReadSector(msf)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	if err := sector.ParseHeader(msf); err != nil {
+		// not a raw mode 2 image
+		return fmt.Errorf("%w: %s", ErrUnsupportedImageFormat, err)
 	}
 
 	licenseData := sector.DataBytes()[24:100]
@@ -85,7 +161,7 @@ func (disc *Disc) IdentifyRegion() error {
 	case "LicensedbySonyComputerEntertainmentEurope": // Europe
 		disc.Region = REGION_EUROPE
 	default:
-		return fmt.Errorf("invalid disc region string \"%s\"", license)
+		return &ErrUnknownRegion{License: license}
 	}
 	return nil
 }
@@ -95,31 +171,93 @@ func (disc *Disc) ReadDataSector(msf *Msf) (*XaSector, error) {
 	if err != nil {
 		return nil, err
 	}
-	sector.ValidateMode1Or2(msf)
+	if err := sector.ParseHeader(msf); err != nil {
+		return nil, err
+	}
+
+	// the CRC is the expensive part, keep it off the emulation thread
+	switch disc.Validation {
+	case SECTOR_VALIDATION_ASYNC:
+		if !disc.Deterministic {
+			disc.Worker.Validate(sector)
+		}
+	case SECTOR_VALIDATION_SYNC:
+		if err := sector.ValidateChecksum(); err != nil {
+			Log.Errorf(LOG_MODULE_CDROM, "disc: %s", err)
+		}
+	}
 	return sector, nil
 }
 
 func (disc *Disc) ReadSector(msf *Msf) (*XaSector, error) {
-	index := msf.SectorIndex() - 150 // TODO: parse cuesheet
-	pos := uint64(index) * SECTOR_SIZE
-	_, err := disc.Reader.Seek(int64(pos), io.SeekStart)
-	if err != nil {
-		return nil, err
+	index := msf.SectorIndex()
+	track := disc.TrackAt(index)
+	if track == nil {
+		return nil, fmt.Errorf("sector %s is outside of the disc", msf)
 	}
 
 	sector := NewXaSector()
-	nread := 0
+	if index < track.Start && !track.PregapInFile {
+		// silent pregap
+		return sector, nil
+	}
+
+	// the next sectors are usually read next, keep the file reads off the
+	// emulation thread
+	hit := disc.Cache.Get(*msf, &sector.Data)
+	if !disc.Deterministic {
+		disc.ReadAhead(index + 1)
+	}
+	if hit {
+		return sector, nil
+	}
+
+	if err := disc.readSectorData(track, index, &sector.Data); err != nil {
+		return nil, err
+	}
+	disc.Cache.Put(*msf, &sector.Data)
+	return sector, nil
+}
+
+// Reads the sector at `index` of `track` from its file
+func (disc *Disc) readSectorData(track *Track, index uint32, data *[SECTOR_SIZE]byte) error {
+	pos := track.Offset + (int64(index)-int64(track.Start))*int64(SECTOR_SIZE)
+	n, err := disc.readAt(track.Reader, data[:], pos)
+	if err != nil {
+		return err
+	}
+	if uint64(n) < SECTOR_SIZE {
+		return fmt.Errorf("short sector read at 0x%x", pos)
+	}
+	return nil
+}
+
+// Reads up to len(buf) bytes at `pos` of the first track's file. The
+// returned error is io.EOF if the end of the file was reached before `buf`
+// was filled
+func (disc *Disc) ReadAt(buf []byte, pos int64) (int, error) {
+	return disc.readAt(disc.Reader, buf, pos)
+}
+
+func (disc *Disc) readAt(reader io.ReadSeeker, buf []byte, pos int64) (int, error) {
+	disc.readerMu.Lock()
+	defer disc.readerMu.Unlock()
+
+	_, err := reader.Seek(pos, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
 
-	for uint64(nread) < SECTOR_SIZE {
-		n, err := disc.Reader.Read(sector.Data[nread:])
+	nread := 0
+	for nread < len(buf) {
+		n, err := reader.Read(buf[nread:])
+		nread += n
 		if err != nil {
-			return nil, err
+			return nread, err
 		}
 		if n == 0 {
-			return nil, fmt.Errorf("0 length sector read at 0x%x", nread)
+			return nread, io.EOF
 		}
-		nread += n
 	}
-
-	return sector, nil
+	return nread, nil
 }
@@ -0,0 +1,256 @@
+package emulator
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Size of the user data of a mode 2 form 1 sector, the ISO9660 block size
+const ISO_BLOCK_SIZE = 2048
+
+// Block of the ISO9660 primary volume descriptor
+const ISO_PVD_BLOCK = 16
+
+// A file or a directory in an ISO9660 directory
+type isoRecord struct {
+	Block uint32 // First block of the extent
+	Size  uint32 // Size in bytes
+	Dir   bool
+	Name  string // Without the ";1" version
+}
+
+// Reads the user data of an ISO9660 block (sector index relative to the
+// start of the data track)
+func (disc *Disc) readIsoBlock(block uint32) ([]byte, error) {
+	if disc.Tracks[0].IsAudio() {
+		return nil, fmt.Errorf("iso: the first track is not a data track")
+	}
+	msf, err := MsfFromIndex(disc.Tracks[0].Start + block)
+	if err != nil {
+		return nil, err
+	}
+	sector, err := disc.ReadDataSector(msf)
+	if err != nil {
+		return nil, err
+	}
+	if sector.Mode != SECTOR_M2_FORM1 {
+		return nil, fmt.Errorf("iso: block %d is not a mode 2 form 1 sector", block)
+	}
+	return sector.Data[24 : 24+ISO_BLOCK_SIZE], nil
+}
+
+// Reads `size` bytes starting at `block`
+func (disc *Disc) readIsoExtent(block, size uint32) ([]byte, error) {
+	data := make([]byte, 0, size)
+	for uint32(len(data)) < size {
+		buf, err := disc.readIsoBlock(block)
+		if err != nil {
+			return nil, err
+		}
+		n := size - uint32(len(data))
+		if n > ISO_BLOCK_SIZE {
+			n = ISO_BLOCK_SIZE
+		}
+		data = append(data, buf[:n]...)
+		block++
+	}
+	return data, nil
+}
+
+// Parses the records of a directory extent. Records never cross a block
+// boundary, the end of a block is padded with zeroes
+func parseIsoDirectory(data []byte) []isoRecord {
+	var records []isoRecord
+	for pos := 0; pos < len(data); {
+		length := int(data[pos])
+		if length == 0 {
+			// skip to the next block
+			pos = (pos/ISO_BLOCK_SIZE + 1) * ISO_BLOCK_SIZE
+			continue
+		}
+		if length < 34 || pos+length > len(data) {
+			break
+		}
+		rec := data[pos : pos+length]
+		nameLen := int(rec[32])
+		if 33+nameLen > length {
+			break
+		}
+		name := string(rec[33 : 33+nameLen])
+		if i := strings.IndexByte(name, ';'); i >= 0 {
+			name = name[:i]
+		}
+		records = append(records, isoRecord{
+			Block: binary.LittleEndian.Uint32(rec[2:]),
+			Size:  binary.LittleEndian.Uint32(rec[10:]),
+			Dir:   rec[25]&2 != 0,
+			Name:  name,
+		})
+		pos += length
+	}
+	return records
+}
+
+// Reads a file from the ISO9660 filesystem of the data track. Directories
+// are separated with '\' or '/' and the names aren't case sensitive, e.g.
+// "SYSTEM.CNF" or "\DATA\MOVIE.STR;1". Returns ErrFileNotFound if the file
+// doesn't exist
+func (disc *Disc) ReadFile(path string) ([]byte, error) {
+	pvd, err := disc.readIsoBlock(ISO_PVD_BLOCK)
+	if err != nil {
+		return nil, err
+	}
+	if pvd[0] != 1 || string(pvd[1:6]) != "CD001" {
+		return nil, fmt.Errorf("iso: no primary volume descriptor")
+	}
+
+	// the root directory record is stored in the volume descriptor
+	root := pvd[156:]
+	current := isoRecord{
+		Block: binary.LittleEndian.Uint32(root[2:]),
+		Size:  binary.LittleEndian.Uint32(root[10:]),
+		Dir:   true,
+	}
+
+	path = strings.ReplaceAll(path, "/", "\\")
+	if i := strings.IndexByte(path, ';'); i >= 0 {
+		path = path[:i]
+	}
+	for _, name := range strings.Split(strings.Trim(path, "\\"), "\\") {
+		if !current.Dir {
+			return nil, fmt.Errorf("%w: %s", ErrFileNotFound, path)
+		}
+		data, err := disc.readIsoExtent(current.Block, current.Size)
+		if err != nil {
+			return nil, err
+		}
+
+		found := false
+		for _, rec := range parseIsoDirectory(data) {
+			if strings.EqualFold(rec.Name, name) {
+				current, found = rec, true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %s", ErrFileNotFound, path)
+		}
+	}
+	if current.Dir {
+		return nil, fmt.Errorf("iso: %s is a directory", path)
+	}
+	return disc.readIsoExtent(current.Block, current.Size)
+}
+
+// Boot settings read from SYSTEM.CNF
+type SystemCnf struct {
+	Boot  string // Path of the boot executable, e.g. cdrom:\SLUS_005.94;1
+	Tcb   uint32 // Amount of thread control blocks
+	Event uint32 // Amount of event control blocks
+	Stack uint32 // Initial stack pointer
+}
+
+// Parses the "KEY = VALUE" lines of SYSTEM.CNF. Unknown keys are ignored
+func ParseSystemCnf(data []byte) (*SystemCnf, error) {
+	cnf := &SystemCnf{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		key = strings.ToUpper(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		var field *uint32
+		switch key {
+		case "BOOT":
+			cnf.Boot = value
+			continue
+		case "TCB":
+			field = &cnf.Tcb
+		case "EVENT":
+			field = &cnf.Event
+		case "STACK":
+			field = &cnf.Stack
+		default:
+			continue
+		}
+		if _, err := fmt.Sscanf(value, "%x", field); err != nil {
+			return nil, fmt.Errorf("system.cnf: invalid %s value \"%s\"", key, value)
+		}
+	}
+	if cnf.Boot == "" {
+		return nil, fmt.Errorf("system.cnf: no BOOT line")
+	}
+	return cnf, nil
+}
+
+// Returns the game ID in the name of a boot executable, e.g. SLUS-00594
+// for cdrom:\SLUS_005.94;1. Returns an empty string if the name isn't a
+// game ID
+func gameIdFromBootPath(path string) string {
+	if i := strings.LastIndexAny(path, "\\/:"); i >= 0 {
+		path = path[i+1:]
+	}
+	if i := strings.IndexByte(path, ';'); i >= 0 {
+		path = path[:i]
+	}
+	path = strings.ToUpper(path)
+
+	// 4 letters, a separator and 5 digits (with a dot somewhere)
+	if len(path) < 10 || (path[4] != '_' && path[4] != '-') {
+		return ""
+	}
+	prefix := path[:4]
+	for _, char := range prefix {
+		if char < 'A' || char > 'Z' {
+			return ""
+		}
+	}
+	number := strings.ReplaceAll(path[5:], ".", "")
+	if len(number) != 5 {
+		return ""
+	}
+	for _, char := range number {
+		if char < '0' || char > '9' {
+			return ""
+		}
+	}
+	return prefix + "-" + number
+}
+
+// Reads SYSTEM.CNF and sets the boot path and the game ID. Discs without
+// SYSTEM.CNF boot PSX.EXE
+func (disc *Disc) identifyGame() error {
+	data, err := disc.ReadFile("SYSTEM.CNF")
+	if err != nil {
+		if _, exeErr := disc.ReadFile("PSX.EXE"); exeErr == nil {
+			disc.bootPath = "cdrom:\\PSX.EXE;1"
+			return nil
+		}
+		return err
+	}
+	cnf, err := ParseSystemCnf(data)
+	if err != nil {
+		return err
+	}
+	disc.bootPath = cnf.Boot
+	disc.gameId = gameIdFromBootPath(cnf.Boot)
+	return nil
+}
+
+// Returns the game ID from the name of the boot executable (e.g.
+// SLUS-00594), or an empty string if the disc doesn't have one
+func (disc *Disc) GameID() string {
+	return disc.gameId
+}
+
+// Returns the path of the boot executable (e.g. cdrom:\SLUS_005.94;1), or
+// an empty string if it couldn't be found
+func (disc *Disc) BootPath() string {
+	return disc.bootPath
+}
@@ -0,0 +1,123 @@
+package emulator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// Builds a raw mode 2 disc image with an ISO9660 filesystem holding
+// `files` in its root directory and one file in the DATA directory. The
+// files of the root directory must fit in 10 blocks
+func newTestIsoImage(files map[string]string) []byte {
+	const sectors = 32
+	const size = int(SECTOR_SIZE)
+	image := make([]byte, sectors*size)
+	sector := func(block int) []byte {
+		data := image[block*size : (block+1)*size]
+		return data[24 : 24+ISO_BLOCK_SIZE]
+	}
+	for block := 0; block < sectors; block++ {
+		data := image[block*size:]
+		copy(data, XA_SECTOR_SYNC_PATTERN)
+		msf, _ := MsfFromIndex(LEAD_IN_SECTORS + uint32(block))
+		copy(data[12:], []byte{msf.M, msf.S, msf.F, 2})
+	}
+	copy(sector(4), "          Licensed  by          Sony Computer Entertainment Amer  ica ")
+
+	record := func(dir []byte, pos int, name string, block, size int, isDir bool) int {
+		length := 33 + len(name)
+		length += length & 1
+		dir[pos] = byte(length)
+		binary.LittleEndian.PutUint32(dir[pos+2:], uint32(block))
+		binary.LittleEndian.PutUint32(dir[pos+10:], uint32(size))
+		if isDir {
+			dir[pos+25] = 2
+		}
+		dir[pos+32] = byte(len(name))
+		copy(dir[pos+33:], name)
+		return pos + length
+	}
+
+	pvd := sector(ISO_PVD_BLOCK)
+	pvd[0] = 1
+	copy(pvd[1:], "CD001")
+	record(pvd, 156, "\x00", 18, ISO_BLOCK_SIZE, true)
+
+	root := sector(18)
+	pos := record(root, 0, "\x00", 18, ISO_BLOCK_SIZE, true)
+	pos = record(root, pos, "\x01", 18, ISO_BLOCK_SIZE, true)
+	pos = record(root, pos, "DATA", 19, ISO_BLOCK_SIZE, true)
+	block := 20
+	for name, contents := range files {
+		pos = record(root, pos, name+";1", block, len(contents), false)
+		for {
+			n := copy(sector(block), contents)
+			contents = contents[n:]
+			block++
+			if contents == "" {
+				break
+			}
+		}
+	}
+
+	record(sector(19), 0, "LEVEL1.BIN;1", 30, ISO_BLOCK_SIZE+4, false)
+	copy(sector(30), bytes.Repeat([]byte{0xaa}, ISO_BLOCK_SIZE))
+	copy(sector(31), "tail")
+	return image
+}
+
+func TestDiscReadFile(t *testing.T) {
+	cnf := "BOOT = cdrom:\\SLUS_005.94;1\r\nTCB = 4\r\nEVENT = 10\r\nSTACK = 801FFF00\r\n"
+	disc, err := NewDisc(bytes.NewReader(newTestIsoImage(map[string]string{"SYSTEM.CNF": cnf})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disc.Close()
+
+	if id := disc.GameID(); id != "SLUS-00594" {
+		t.Errorf("expected game ID SLUS-00594, got \"%s\"", id)
+	}
+	if boot := disc.BootPath(); boot != "cdrom:\\SLUS_005.94;1" {
+		t.Errorf("unexpected boot path \"%s\"", boot)
+	}
+
+	data, err := disc.ReadFile("system.cnf")
+	if err != nil || string(data) != cnf {
+		t.Errorf("unexpected SYSTEM.CNF %q (%v)", data, err)
+	}
+	data, err = disc.ReadFile("/DATA/LEVEL1.BIN;1")
+	if err != nil || len(data) != ISO_BLOCK_SIZE+4 || string(data[ISO_BLOCK_SIZE:]) != "tail" {
+		t.Errorf("unexpected file of %d bytes (%v)", len(data), err)
+	}
+	if _, err := disc.ReadFile("MISSING.EXE"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("expected ErrFileNotFound, got %v", err)
+	}
+}
+
+func TestParseSystemCnf(t *testing.T) {
+	cnf, err := ParseSystemCnf([]byte("BOOT=cdrom:\\SCES_000.01;1\nTCB=4\nEVENT=10\nSTACK=801FFFF0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cnf.Boot != "cdrom:\\SCES_000.01;1" || cnf.Tcb != 4 || cnf.Event != 0x10 || cnf.Stack != 0x801ffff0 {
+		t.Errorf("unexpected SYSTEM.CNF %+v", cnf)
+	}
+	if _, err := ParseSystemCnf([]byte("TCB=4\n")); err == nil {
+		t.Error("expected an error without a BOOT line")
+	}
+
+	ids := map[string]string{
+		"cdrom:\\SLUS_005.94;1":       "SLUS-00594",
+		"cdrom:SCPS_100.01":           "SCPS-10001",
+		"cdrom:\\GAME\\slps_012.34;1": "SLPS-01234",
+		"cdrom:\\MAIN.EXE;1":          "",
+		"cdrom:\\PSX.EXE;1":           "",
+	}
+	for path, want := range ids {
+		if got := gameIdFromBootPath(path); got != want {
+			t.Errorf("%s: expected \"%s\", got \"%s\"", path, want, got)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package emulator
+
+import "io"
+
+// Sector index of the first track (2 second lead-in)
+const LEAD_IN_SECTORS uint32 = 150
+
+type TrackType int
+
+const (
+	TRACK_DATA  TrackType = iota // MODE1/2352 or MODE2/2352 data track
+	TRACK_AUDIO TrackType = iota // CD-DA audio track
+)
+
+// A track on the disc
+type Track struct {
+	Number       uint8         // Track number (1-99)
+	Type         TrackType     // Data or audio
+	Reader       io.ReadSeeker // File that stores the track
+	Offset       int64         // Byte offset of the track start (INDEX 01) in `Reader`
+	Start        uint32        // Sector index of the track start (INDEX 01), includes the lead-in
+	Length       uint32        // Length of the track in sectors, starting from `Start`
+	Pregap       uint32        // Length of the pregap before `Start` in sectors
+	PregapInFile bool          // If false, the pregap is not stored in `Reader` and reads as silence
+}
+
+// Returns true if the sector at `index` belongs to the track (including
+// the pregap)
+func (track *Track) Contains(index uint32) bool {
+	return index+track.Pregap >= track.Start && index < track.End()
+}
+
+// Returns the sector index after the last sector of the track
+func (track *Track) End() uint32 {
+	return track.Start + track.Length
+}
+
+// Returns true if this is an audio track
+func (track *Track) IsAudio() bool {
+	return track.Type == TRACK_AUDIO
+}
+
+// Returns the track that contains the sector at `index`, or nil if the
+// sector is outside of the disc
+func (disc *Disc) TrackAt(index uint32) *Track {
+	for _, track := range disc.Tracks {
+		if track.Contains(index) {
+			return track
+		}
+	}
+	return nil
+}
+
+// Returns the track with the number `number` (1-99), or nil if it doesn't exist
+func (disc *Disc) TrackByNumber(number uint8) *Track {
+	for _, track := range disc.Tracks {
+		if track.Number == number {
+			return track
+		}
+	}
+	return nil
+}
+
+// Returns the sector index after the last sector of the disc (start of
+// the lead-out area)
+func (disc *Disc) End() uint32 {
+	if len(disc.Tracks) == 0 {
+		return LEAD_IN_SECTORS
+	}
+	return disc.Tracks[len(disc.Tracks)-1].End()
+}
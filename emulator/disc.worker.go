@@ -0,0 +1,268 @@
+package emulator
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// Specifies how sector checksums are validated
+type SectorValidation int
+
+const (
+	SECTOR_VALIDATION_OFF   SectorValidation = iota // Checksums are not validated
+	SECTOR_VALIDATION_ASYNC SectorValidation = iota // Validated by the disc worker
+	SECTOR_VALIDATION_SYNC  SectorValidation = iota // Validated on the emulation thread
+)
+
+// Maximum amount of pending disc worker jobs (per priority)
+const DISC_WORKER_QUEUE_SIZE = 64
+
+// Amount of sectors hashed by a single disc worker job
+const DISC_HASH_JOB_SECTORS = 16
+
+// Runs sector validation and hashing jobs off the emulation thread
+type DiscWorker struct {
+	Jobs           chan func() // Pending jobs
+	Background     chan func() // Pending low priority jobs, run when Jobs is empty
+	InvalidSectors uint64      // Amount of sectors that failed validation (atomic)
+	SkippedSectors uint64      // Sectors that weren't validated because the queue was full (atomic)
+	stop           chan struct{}
+	stopOnce       sync.Once
+}
+
+// Creates a new disc worker and starts its goroutine
+func NewDiscWorker() *DiscWorker {
+	worker := &DiscWorker{
+		Jobs:       make(chan func(), DISC_WORKER_QUEUE_SIZE),
+		Background: make(chan func(), DISC_WORKER_QUEUE_SIZE),
+		stop:       make(chan struct{}),
+	}
+	go worker.Run()
+	return worker
+}
+
+// Runs jobs until the worker is stopped. Low priority jobs only run when
+// there are no other jobs
+func (worker *DiscWorker) Run() {
+	for {
+		select {
+		case job := <-worker.Jobs:
+			job()
+			continue
+		case <-worker.stop:
+			worker.drainBackground()
+			return
+		default:
+		}
+
+		select {
+		case job := <-worker.Jobs:
+			job()
+		case job := <-worker.Background:
+			job()
+		case <-worker.stop:
+			worker.drainBackground()
+			return
+		}
+	}
+}
+
+// Runs the low priority jobs that are still queued after the worker was
+// stopped, so they can report that they didn't finish
+func (worker *DiscWorker) drainBackground() {
+	for {
+		select {
+		case job := <-worker.Background:
+			job()
+		default:
+			return
+		}
+	}
+}
+
+// Stops the worker goroutine, pending jobs are dropped and pending low
+// priority jobs are run one last time. Jobs can still be scheduled
+// afterwards, they are never run. Stopping twice does nothing
+func (worker *DiscWorker) Stop() {
+	worker.stopOnce.Do(func() {
+		close(worker.stop)
+	})
+}
+
+// Returns true if the worker was stopped
+func (worker *DiscWorker) Stopped() bool {
+	select {
+	case <-worker.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Queues `job`. Returns false if the queue is full or the worker is
+// stopped, the emulation thread should never wait for the worker
+func (worker *DiscWorker) TrySchedule(job func()) bool {
+	if worker.Stopped() {
+		return false
+	}
+	select {
+	case worker.Jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// Queues `job` as a low priority job. Returns false if the queue is full or
+// the worker is stopped
+func (worker *DiscWorker) TryScheduleBackground(job func()) bool {
+	if worker.Stopped() {
+		return false
+	}
+	select {
+	case worker.Background <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// Validates the checksum of `sector` in the background
+func (worker *DiscWorker) Validate(sector *XaSector) {
+	ok := worker.TrySchedule(func() {
+		if err := sector.ValidateChecksum(); err != nil {
+			atomic.AddUint64(&worker.InvalidSectors, 1)
+			Log.Errorf(LOG_MODULE_CDROM, "disc: %s", err)
+		}
+	})
+	if !ok {
+		atomic.AddUint64(&worker.SkippedSectors, 1)
+	}
+}
+
+// Full disc hash
+type DiscHash [sha1.Size]byte
+
+func (hash DiscHash) String() string {
+	return fmt.Sprintf("%x", hash[:])
+}
+
+// Calculates the SHA-1 hash of the whole disc image on the disc worker and
+// calls `done` from the worker goroutine when it's finished. The hash is
+// split into low priority jobs of DISC_HASH_JOB_SECTORS sectors, so sectors
+// are still validated in the meantime. The reader is only locked while a
+// single sector is being read, so the emulation thread can keep reading
+// sectors too. Calls `done` with ErrDiscClosed if the disc is closed
+// before it's done, or with ErrDiscWorkerBusy (from the calling goroutine)
+// if the worker queue is full
+func (disc *Disc) HashAsync(done func(hash DiscHash, err error)) {
+	hasher := newDiscHasher(disc)
+	var job func()
+	job = func() {
+		for {
+			finished, err := hasher.step(DISC_HASH_JOB_SECTORS)
+			if err != nil {
+				done(DiscHash{}, err)
+				return
+			}
+			if finished {
+				done(hasher.sum(), nil)
+				return
+			}
+			if disc.Worker.TryScheduleBackground(job) {
+				return
+			}
+			if disc.Worker.Stopped() {
+				done(DiscHash{}, ErrDiscClosed)
+				return
+			}
+			// the queue is full, keep hashing in this job
+		}
+	}
+
+	if !disc.Worker.TryScheduleBackground(job) {
+		if disc.Worker.Stopped() {
+			done(DiscHash{}, ErrDiscClosed)
+		} else {
+			done(DiscHash{}, ErrDiscWorkerBusy)
+		}
+	}
+}
+
+// Calculates the SHA-1 hash of the whole disc image (all track files in
+// order). Returns ErrDiscClosed if the disc is closed before it's done
+func (disc *Disc) Hash() (DiscHash, error) {
+	hasher := newDiscHasher(disc)
+	for {
+		finished, err := hasher.step(DISC_HASH_JOB_SECTORS)
+		if err != nil {
+			return DiscHash{}, err
+		}
+		if finished {
+			return hasher.sum(), nil
+		}
+	}
+}
+
+// Hashes a disc a few sectors at a time
+type discHasher struct {
+	disc  *Disc
+	h     hash.Hash
+	buf   []byte
+	track int           // Track being hashed
+	pos   int64         // Offset of the next sector in the track file
+	prev  io.ReadSeeker // Last file that was hashed completely
+}
+
+func newDiscHasher(disc *Disc) *discHasher {
+	return &discHasher{
+		disc: disc,
+		h:    sha1.New(),
+		buf:  make([]byte, SECTOR_SIZE),
+	}
+}
+
+// Hashes up to `sectors` sectors. Returns true when the whole disc (all
+// track files in order) was hashed
+func (hasher *discHasher) step(sectors int) (bool, error) {
+	disc := hasher.disc
+	for ; hasher.track < len(disc.Tracks); hasher.track++ {
+		reader := disc.Tracks[hasher.track].Reader
+		if reader == hasher.prev {
+			continue
+		}
+
+		for ; ; hasher.pos += int64(SECTOR_SIZE) {
+			if sectors == 0 {
+				return false, nil
+			}
+			sectors--
+
+			if disc.isClosed() {
+				return false, ErrDiscClosed
+			}
+			n, err := disc.readAt(reader, hasher.buf, hasher.pos)
+			hasher.h.Write(hasher.buf[:n])
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return false, err
+			}
+		}
+		hasher.prev = reader
+		hasher.pos = 0
+	}
+	return true, nil
+}
+
+// Returns the hash of the sectors that were hashed
+func (hasher *discHasher) sum() DiscHash {
+	var hash DiscHash
+	copy(hash[:], hasher.h.Sum(nil))
+	return hash
+}
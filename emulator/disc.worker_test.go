@@ -0,0 +1,117 @@
+package emulator
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDiscWorkerStop(t *testing.T) {
+	worker := NewDiscWorker()
+	done := make(chan struct{})
+	if !worker.TrySchedule(func() { close(done) }) {
+		t.Fatal("expected the job to be scheduled")
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected the job to run")
+	}
+
+	worker.Stop()
+	worker.Stop()
+	if !worker.Stopped() {
+		t.Fatal("expected the worker to be stopped")
+	}
+	if worker.TrySchedule(func() { t.Error("expected the job not to run") }) {
+		t.Error("expected scheduling on a stopped worker to fail")
+	}
+	worker.Validate(&XaSector{})
+	if skipped := worker.SkippedSectors; skipped != 1 {
+		t.Errorf("expected 1 skipped sector, got %d", skipped)
+	}
+}
+
+// Hashing runs on the worker as low priority jobs, validation jobs that
+// are queued meanwhile run first
+func TestDiscHashAsync(t *testing.T) {
+	image := newTestIsoImage(nil)
+	disc, err := NewDisc(bytes.NewReader(image))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disc.Close()
+
+	// hold the worker until everything is queued
+	release := make(chan struct{})
+	disc.Worker.TrySchedule(func() { <-release })
+
+	// both run on the worker goroutine
+	var order []string
+	result := make(chan DiscHash, 1)
+	disc.HashAsync(func(hash DiscHash, err error) {
+		if err != nil {
+			t.Error(err)
+		}
+		order = append(order, "hash")
+		result <- hash
+	})
+	if !disc.Worker.TrySchedule(func() { order = append(order, "validation") }) {
+		t.Fatal("expected the job to be scheduled")
+	}
+	close(release)
+
+	select {
+	case hash := <-result:
+		if expected := DiscHash(sha1.Sum(image)); hash != expected {
+			t.Errorf("expected %s, got %s", expected, hash)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the hash to finish")
+	}
+	if len(order) != 2 || order[0] != "validation" {
+		t.Errorf("expected the validation to run before the hash, got %v", order)
+	}
+}
+
+// Closing the disc stops a hash that didn't finish yet
+func TestDiscHashAsyncClosed(t *testing.T) {
+	disc, err := NewDisc(bytes.NewReader(newTestIsoImage(nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	disc.Worker.TrySchedule(func() { <-release })
+
+	result := make(chan error, 1)
+	disc.HashAsync(func(hash DiscHash, err error) { result <- err })
+	disc.Close()
+	close(release)
+
+	select {
+	case err := <-result:
+		if !errors.Is(err, ErrDiscClosed) {
+			t.Errorf("expected ErrDiscClosed, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the hash to be stopped")
+	}
+
+	disc.HashAsync(func(hash DiscHash, err error) { result <- err })
+	if err := <-result; !errors.Is(err, ErrDiscClosed) {
+		t.Errorf("expected ErrDiscClosed after Close, got %v", err)
+	}
+}
+
+func TestDiscHashClosed(t *testing.T) {
+	disc, err := NewDisc(bytes.NewReader(newTestIsoImage(nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	disc.Close()
+	if _, err := disc.Hash(); !errors.Is(err, ErrDiscClosed) {
+		t.Errorf("expected ErrDiscClosed, got %v", err)
+	}
+}
@@ -49,6 +49,8 @@ type DMA struct {
 	// untouched on reads
 	IrqDummy uint8
 	Channels [7]*Channel // The 7 channel instances
+	// Words transferred through each port, for the debug overlay
+	Words [7]uint32
 }
 
 // Return a new reset DMA instance
@@ -70,6 +72,66 @@ func (dma *DMA) SetControl(val uint32) {
 	dma.Control = val
 }
 
+// Returns true if the master enable bit of `port` is set in the control
+// register
+func (dma *DMA) PortEnabled(port Port) bool {
+	return (dma.Control>>(uint32(port)*4+3))&1 != 0
+}
+
+// Returns the priority of `port`, 0 is the highest
+func (dma *DMA) Priority(port Port) uint32 {
+	return (dma.Control >> (uint32(port) * 4)) & 7
+}
+
+// Returns the channel that should transfer next at `cycles`. Channels with
+// the same priority are ordered by port number, the highest wins. Returns
+// false if no channel is ready
+func (dma *DMA) NextChannel(cycles uint64) (Port, bool) {
+	var best Port
+	found := false
+
+	for i, channel := range dma.Channels {
+		port := Port(i)
+		if !channel.Active() || !dma.PortEnabled(port) || channel.Finishing {
+			continue
+		}
+		if channel.Started && channel.NextChunk > cycles {
+			// in a CPU window
+			continue
+		}
+		if !found || dma.Priority(port) <= dma.Priority(best) {
+			best = port
+			found = true
+		}
+	}
+	return best, found
+}
+
+// Returns the time of the next transfer completion or chunk of a chopped
+// transfer, or false if no transfer is in progress
+func (dma *DMA) NextEvent() (uint64, bool) {
+	var next uint64
+	found := false
+
+	for i, channel := range dma.Channels {
+		var at uint64
+		switch {
+		case channel.Finishing:
+			at = channel.DoneAt
+		case channel.Started && channel.Active() && dma.PortEnabled(Port(i)):
+			at = channel.NextChunk
+		default:
+			continue
+		}
+
+		if !found || at < next {
+			next = at
+			found = true
+		}
+	}
+	return next, found
+}
+
 // Return the status of the DMA interrupt
 func (dma *DMA) Irq() bool {
 	channelIrq := dma.ChannelIrqFlags & dma.ChannelIrqEn
@@ -112,7 +174,7 @@ func (dma *DMA) SetInterrupt(val uint32, irqState *IrqState) {
 	dma.IrqEn = (val>>23)&1 != 0
 
 	// writing 1 to a flag resets it
-	ack := uint8((val >> 24) & 0x3f)
+	ack := uint8((val >> 24) & 0x7f)
 	dma.ChannelIrqFlags &= ^ack
 
 	if !prevIrq && dma.Irq() {
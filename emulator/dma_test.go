@@ -0,0 +1,70 @@
+package emulator
+
+import "testing"
+
+func TestDmaNextChannel(t *testing.T) {
+	dma := NewDMA()
+	for _, port := range []Port{PORT_GPU, PORT_CDROM, PORT_OTC} {
+		dma.Channels[port].SetControl(0x11000000) // enabled and triggered
+	}
+
+	if _, ok := dma.NextChannel(0); ok {
+		t.Error("a channel without its master enable bit was selected")
+	}
+
+	// GPU and OTC share the highest priority, CD-ROM is lower
+	dma.SetControl(0x09000000 | 0xc000 | 0x0900)
+	if port, _ := dma.NextChannel(0); port != PORT_OTC {
+		t.Errorf("expected port %d, got %d", PORT_OTC, port)
+	}
+
+	dma.Channels[PORT_OTC].Done()
+	if port, _ := dma.NextChannel(0); port != PORT_GPU {
+		t.Errorf("expected port %d, got %d", PORT_GPU, port)
+	}
+}
+
+// Walks an ordering table of GP0 NOP packets, like the ones games clear with
+// the OTC channel every frame
+func BenchmarkDmaLinkedList(b *testing.B) {
+	inter := newBenchInterconnect()
+	const entries = 4096
+
+	for i := uint32(0); i < entries; i++ {
+		addr := i * 8
+		next := addr + 8
+		if i == entries-1 {
+			next = 0xffffff
+		}
+		inter.Ram.Store(addr, ACCESS_WORD, 1<<24|next)
+		inter.Ram.Store(addr+4, ACCESS_WORD, 0)
+	}
+	inter.Dma.Channels[PORT_GPU].Base = 0
+	inter.Dma.Channels[PORT_GPU].Direction = DIRECTION_FROM_RAM
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if words := inter.DoDmaLinkedList(PORT_GPU); words != entries*2 {
+			b.Fatalf("expected %d words, got %d", entries*2, words)
+		}
+	}
+}
+
+func TestIrqDmaEdge(t *testing.T) {
+	state := NewIrqState()
+	dma := NewDMA()
+
+	// master enable and channel 2 interrupt enable
+	dma.SetInterrupt(1<<23|1<<(16+PORT_GPU), state)
+	dma.Done(PORT_GPU, state)
+	if !state.Latched(INTERRUPT_DMA) {
+		t.Fatal("expected a DMA interrupt")
+	}
+
+	// the DMA IRQ signal is still high, acknowledging doesn't latch it again
+	state.Acknowledge(0)
+	dma.Done(PORT_GPU, state)
+	if state.Latched(INTERRUPT_DMA) {
+		t.Error("the interrupt was latched without a rising edge")
+	}
+}
@@ -0,0 +1,31 @@
+// Package emulator is a PlayStation emulator core. It has no dependency on
+// a window or audio library, the frontend draws the frames and plays the
+// audio (see the renderer package for an Ebitengine renderer).
+//
+// Programs that embed the emulator should stick to this API, which is kept
+// stable:
+//
+//   - New and Config create a console from a BIOS (LoadBIOS) and a disc
+//     (NewDisc, NewDiscFromCue)
+//   - Console runs the emulator on its own goroutine: Run, Stop, Pause,
+//     Resume, Reset, SwapDisc, Status, Screenshot
+//   - Console.Events reports when the game is loaded and the play time
+//   - Renderer receives the finished frames (Frame) through
+//     Console.PresentFrame
+//   - AudioSink plays the audio output
+//   - InputSource and Console.SetInput drive the controllers
+//
+// Everything else is exported for the frontend and the debugging tools
+// (the CPU, the peripherals, the caches...) and can change between
+// versions. It must only be touched on the emulation goroutine, see
+// Console.Send.
+//
+// The parts of the hardware that can be used without the rest of the
+// console are sub-packages: bus (the access sizes, the interrupt
+// controller and the emulation time), spu (the sound processor), gte (the
+// geometry coprocessor) and input (the controllers). Their types are
+// aliased here (SPU, GTE, Gamepad, IrqState...), so they keep their names
+// in this package. The CPU, the GPU and the CD-ROM drive stay in this
+// package: they share the Interconnect, the DMA and the savestates, and
+// splitting them would need interfaces for every access between them.
+package emulator
@@ -0,0 +1,71 @@
+package emulator
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/zeozeozeo/gopsx/emulator/bus"
+)
+
+// Returned by LoadBIOS and LoadBIOSFromData if the image is not BIOS_SIZE
+// bytes long. Use errors.Is to check for it, the returned error contains
+// the actual size
+var ErrInvalidBIOSSize = errors.New("invalid BIOS size")
+
+// Returned by BIOS.ApplyPatches if a patch doesn't exist for the BIOS
+// image. Use errors.Is to check for it
+var ErrUnsupportedBiosPatch = errors.New("unsupported BIOS patch")
+
+// Returned by Expansion.LoadCartridge if the ROM image doesn't fit in the
+// expansion region. Use errors.Is to check for it
+var ErrInvalidCartridgeSize = errors.New("invalid cartridge size")
+
+// Returned by TimeHandler.SetOverclock if the multiplier is out of range.
+// Use errors.Is to check for it
+var ErrInvalidOverclock = bus.ErrInvalidOverclock
+
+// Returned by LoadMemoryCardImage and MemoryCardImage.Import if the data is
+// not a memory card image or a save file. Use errors.Is to check for it
+var ErrInvalidMemoryCard = errors.New("invalid memory card image")
+
+// Returned by MemoryCardImage.Import if there aren't enough free blocks for
+// the save. Use errors.Is to check for it
+var ErrMemoryCardFull = errors.New("not enough free memory card blocks")
+
+// Returned by the MemoryCardImage functions that take a block if it isn't
+// the first block of a save. Use errors.Is to check for it
+var ErrNoSave = errors.New("no save at this memory card block")
+
+// Returned when a disc image is not a raw (2352 bytes per sector) image or
+// a cue sheet contains unsupported tracks. Use errors.Is to check for it
+var ErrUnsupportedImageFormat = errors.New("unsupported image format")
+
+// Returned by Disc.ReadFile if the file doesn't exist on the disc. Use
+// errors.Is to check for it
+var ErrFileNotFound = errors.New("file not found on the disc")
+
+// Returned by Disc.Hash if the disc is closed while it's being hashed. Use
+// errors.Is to check for it
+var ErrDiscClosed = errors.New("disc closed")
+
+// Returned by Disc.HashAsync if the disc worker queue is full. Use
+// errors.Is to check for it
+var ErrDiscWorkerBusy = errors.New("disc worker queue is full")
+
+// Returned by NewDisc and NewDiscFromCue if the disc region couldn't be
+// identified from the license string
+type ErrUnknownRegion struct {
+	License string // License string found on the disc (only A-z characters)
+}
+
+func (err *ErrUnknownRegion) Error() string {
+	return fmt.Sprintf("unknown disc region (license string \"%s\")", err.License)
+}
+
+// Returned by ParseExe if the data is not a PS-X EXE or doesn't fit in RAM.
+// Use errors.Is to check for it
+var ErrInvalidExe = errors.New("invalid PS-X EXE")
+
+// Returned by New if the configuration doesn't have a BIOS. Use errors.Is
+// to check for it
+var ErrNoBIOS = errors.New("no BIOS")
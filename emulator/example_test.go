@@ -0,0 +1,53 @@
+package emulator_test
+
+import (
+	"fmt"
+	"image"
+	"os"
+
+	"github.com/zeozeozeo/gopsx/emulator"
+)
+
+// Draws the frames in software, see emulator.RasterizeTriangles
+type softwareRenderer struct {
+	img *image.RGBA
+}
+
+func (renderer *softwareRenderer) DrawFrame(frame *emulator.Frame) {
+	emulator.RasterizeTriangles(renderer.img, frame.Vertices, frame.Offset)
+}
+
+// Boots a BIOS without a disc and draws the frames into an image
+func ExampleNew() {
+	file, err := os.Open("SCPH1001.BIN")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer file.Close()
+	bios, err := emulator.LoadBIOS(file)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	console, err := emulator.New(emulator.Config{
+		BIOS:        bios,
+		Controllers: [2]emulator.GamepadType{emulator.GAMEPAD_TYPE_DIGITAL},
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	go console.Run()
+	defer console.Stop()
+
+	// usually called by the render loop of the program
+	renderer := &softwareRenderer{img: image.NewRGBA(image.Rect(0, 0, 1024, 512))}
+	console.PresentFrame(renderer)
+
+	// input goes to the controllers at the start of the next frame
+	var buttons emulator.ButtonsState
+	buttons.Set(emulator.BUTTON_START, emulator.BUTTON_STATE_PRESSED)
+	console.SetInput(emulator.TARGET_PADMEMCARD1, 0, buttons, emulator.CenteredAxes())
+}
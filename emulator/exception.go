@@ -11,4 +11,6 @@ const (
 	EXCEPTION_BREAK               Exception = 0x9 // Breakpoint (caused by BREAK opcode)
 	EXCEPTION_COPROCESSOR_ERROR   Exception = 0xb // Unsupported coprocessor operation
 	EXCEPTION_ILLEGAL_INSTRUCTION Exception = 0xa // CPU encountered an unknown instruction
+	EXCEPTION_INSTRUCTION_BUS     Exception = 0x6 // Bus error on instruction fetch
+	EXCEPTION_DATA_BUS            Exception = 0x7 // Bus error on data load or store
 )
@@ -0,0 +1,87 @@
+package emulator
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Size of the header of PS-X EXE files, the text follows it
+const EXE_HEADER_SIZE = 0x800
+
+// Initial stack pointer of executables that don't set one, like the BIOS
+const EXE_DEFAULT_STACK uint32 = 0x801ffff0
+
+// A PS-X EXE executable, the format of the programs on the discs and of
+// most homebrew and test programs
+type Exe struct {
+	PC        uint32 // Entry point
+	GP        uint32 // Initial global pointer (r28)
+	TextAddr  uint32 // Where Text is loaded
+	BssAddr   uint32 // Area that is cleared before the program starts
+	BssSize   uint32
+	StackAddr uint32 // Base of the stack, 0 for EXE_DEFAULT_STACK
+	StackSize uint32 // Added to StackAddr to get the initial stack pointer
+	Text      []byte // Code and data
+}
+
+// Parses a PS-X EXE file. The text can be shorter than the size in the
+// header, the rest is zeroed
+func ParseExe(data []byte) (*Exe, error) {
+	if len(data) < EXE_HEADER_SIZE || string(data[:8]) != "PS-X EXE" {
+		return nil, fmt.Errorf("%w (no PS-X EXE header)", ErrInvalidExe)
+	}
+	word := func(offset int) uint32 {
+		return binary.LittleEndian.Uint32(data[offset:])
+	}
+
+	exe := &Exe{
+		PC:        word(0x10),
+		GP:        word(0x14),
+		TextAddr:  word(0x18),
+		BssAddr:   word(0x28),
+		BssSize:   word(0x2c),
+		StackAddr: word(0x30),
+		StackSize: word(0x34),
+	}
+	textSize := word(0x1c)
+	if textSize > RAM_ALLOC_SIZE || (exe.TextAddr&0x1fffff)+textSize > RAM_ALLOC_SIZE {
+		return nil, fmt.Errorf("%w (text of 0x%x bytes at 0x%08x)", ErrInvalidExe, textSize, exe.TextAddr)
+	}
+	if exe.BssSize > RAM_ALLOC_SIZE || (exe.BssAddr&0x1fffff)+exe.BssSize > RAM_ALLOC_SIZE {
+		return nil, fmt.Errorf("%w (BSS of 0x%x bytes at 0x%08x)", ErrInvalidExe, exe.BssSize, exe.BssAddr)
+	}
+	exe.Text = make([]byte, textSize)
+	copy(exe.Text, data[EXE_HEADER_SIZE:])
+	return exe, nil
+}
+
+// Copies the executable to RAM and jumps to it, with the registers set up
+// like the BIOS does. This skips the BIOS entirely, see BiosHle.Standalone
+// to run it without one
+func (cpu *CPU) LoadExe(exe *Exe) {
+	ram := cpu.Inter.Ram
+	for i, b := range exe.Text {
+		ram.Store8(exe.TextAddr+uint32(i), b)
+	}
+	for i := uint32(0); i < exe.BssSize; i++ {
+		ram.Store8(exe.BssAddr+i, 0)
+	}
+
+	sp := EXE_DEFAULT_STACK
+	if exe.StackAddr != 0 {
+		sp = exe.StackAddr + exe.StackSize
+	}
+	cpu.SetReg(28, exe.GP)
+	cpu.SetReg(29, sp)
+	cpu.SetReg(30, sp)
+	copy(cpu.Regs[:], cpu.OutRegs[:])
+
+	cpu.Load.Reset()
+	cpu.PC = exe.PC
+	cpu.NextPC = exe.PC + 4
+	cpu.BranchOccured = false
+	cpu.BranchTaken = false
+	if cpu.Jit != nil {
+		cpu.Jit.Flush()
+	}
+}
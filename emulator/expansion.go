@@ -0,0 +1,96 @@
+package emulator
+
+import (
+	"fmt"
+	"io"
+)
+
+// Expansion region 2 registers
+const (
+	EXP2_DUART_STATUS_A = 0x21 // DUART channel A status (SRA)
+	EXP2_DUART_TX_A     = 0x23 // DUART channel A transmit buffer (THRA), used as a debug TTY
+	EXP2_POST           = 0x41 // POST (power-on self-test) 7-segment display
+)
+
+// DUART status: the transmitter is ready and empty
+const EXP2_DUART_TX_READY = 1<<2 | 1<<3
+
+// Parallel port cartridge (expansion region 1) and the debug registers of
+// expansion region 2. The BIOS checks for the "Licensed by Sony Computer
+// Entertainment Inc." string at 0x1f000084 and calls into the cartridge
+// ROM if it's there, which is how cheat cartridges and debugging monitors
+// (Action Replay, Caetla...) boot
+type Expansion struct {
+	Rom  []byte // Cartridge ROM mapped at 0x1f000000, nil if no cartridge is inserted
+	Post uint8  // Last value written to the POST display
+	// If not nil, receives the characters written to the DUART by debugging
+	// monitors and development BIOSes
+	Tty func(c byte)
+}
+
+// Returns a new expansion port without a cartridge
+func NewExpansion() *Expansion {
+	return &Expansion{}
+}
+
+// Inserts a cartridge with the ROM image read from `r`. The image can't be
+// larger than the expansion region (512KB)
+func (exp *Expansion) LoadCartridge(r io.Reader) error {
+	rom, err := io.ReadAll(io.LimitReader(r, int64(EXPANSION_1_RANGE.Length)+1))
+	if err != nil {
+		return err
+	}
+	if len(rom) > int(EXPANSION_1_RANGE.Length) {
+		return fmt.Errorf(
+			"%w (expected at most %d bytes)",
+			ErrInvalidCartridgeSize, EXPANSION_1_RANGE.Length,
+		)
+	}
+	exp.Rom = rom
+	return nil
+}
+
+// Loads a value from the cartridge ROM. The unmapped part of the region
+// reads as all ones, like an empty expansion port
+func (exp *Expansion) Load1(offset uint32, size AccessSize) uint32 {
+	var val uint32
+	for i := uint32(0); i < uint32(size); i++ {
+		b := byte(0xff)
+		if int(offset+i) < len(exp.Rom) {
+			b = exp.Rom[offset+i]
+		}
+		val |= uint32(b) << (i * 8)
+	}
+	return val
+}
+
+// Handles a write to the cartridge. Flash programming is not emulated
+func (exp *Expansion) Store1(offset uint32, val uint32) {
+	Log.Warnf(LOG_MODULE_INTER, "ignoring write to expansion 1 0x%x <- 0x%x", offset, val)
+}
+
+// Loads a value from an expansion region 2 register
+func (exp *Expansion) Load2(offset uint32) uint32 {
+	switch offset {
+	case EXP2_DUART_STATUS_A:
+		// characters are sent right away
+		return EXP2_DUART_TX_READY
+	case EXP2_POST:
+		return uint32(exp.Post)
+	}
+	return 0xff
+}
+
+// Stores a value into an expansion region 2 register
+func (exp *Expansion) Store2(offset uint32, val uint32) {
+	switch offset {
+	case EXP2_DUART_TX_A:
+		if exp.Tty != nil {
+			exp.Tty(byte(val))
+		}
+	case EXP2_POST:
+		exp.Post = uint8(val)
+	default:
+		Log.Warnf(LOG_MODULE_INTER, "unhandled write to expansion 2 register 0x%x", offset)
+	}
+}
@@ -0,0 +1,119 @@
+package emulator
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Names of the per-game settings. They're named like the command line
+// flags of gopsx and the values are parsed by the frontend
+var GAME_SETTING_NAMES = []string{
+	"port1",       // Device plugged into port 1 (digital, dualshock, guncon...)
+	"port2",       // Device plugged into port 2
+	"multitap",    // Multitap adapter in port 1 (true or false)
+	"overclock",   // CPU clock multiplier (1 to 4)
+	"cpu",         // CPU emulation mode (interpreter, cached or jit)
+	"pgxp",        // Sub-pixel vertex precision (true or false)
+	"perspective", // Perspective correct colors (true or false)
+	"widescreen",  // 16:9 field of view (true or false)
+	"dithering",   // Dithering of the captures (true or false)
+	"deinterlace", // 480i display (weave or bob)
+	"region",      // Region override (japan, north-america or europe)
+}
+
+// Compatibility settings of the known games, see ParseGameDatabase
+//
+//go:embed gamedb.txt
+var defaultGameDatabase string
+
+// Settings of a game
+type GameSettings struct {
+	ID       string            // Game ID, see Disc.GameID
+	Name     string            // Title of the game, only informative
+	Settings map[string]string // Value of the settings, by name (see GAME_SETTING_NAMES)
+}
+
+// Per-game settings, keyed by game ID
+type GameDatabase struct {
+	Games map[string]*GameSettings
+}
+
+// Returns an empty database
+func NewGameDatabase() *GameDatabase {
+	return &GameDatabase{Games: make(map[string]*GameSettings)}
+}
+
+// Returns a database with the settings of the known games, embedded in
+// the emulator
+func DefaultGameDatabase() *GameDatabase {
+	db := NewGameDatabase()
+	if err := db.Load(strings.NewReader(defaultGameDatabase)); err != nil {
+		panic(err)
+	}
+	return db
+}
+
+// Loads the games of a database file. A line like "[SLUS-00594] Metal Gear
+// Solid" starts a game, followed by "name = value" settings. Lines starting
+// with '#' are comments. The settings of the games that are already in the
+// database are replaced one by one, so a user file can override the
+// default database
+func (db *GameDatabase) Load(r io.Reader) error {
+	var game *GameSettings
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(text, "[") {
+			end := strings.IndexByte(text, ']')
+			if end < 0 {
+				return fmt.Errorf("gamedb: line %d: missing ]", line)
+			}
+			id := strings.ToUpper(strings.TrimSpace(text[1:end]))
+			game = db.Games[id]
+			if game == nil {
+				game = &GameSettings{ID: id, Settings: make(map[string]string)}
+				db.Games[id] = game
+			}
+			if name := strings.TrimSpace(text[end+1:]); name != "" {
+				game.Name = name
+			}
+			continue
+		}
+
+		if game == nil {
+			return fmt.Errorf("gamedb: line %d: setting outside of a game", line)
+		}
+		name, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return fmt.Errorf("gamedb: line %d: expected name = value", line)
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !isGameSetting(name) {
+			return fmt.Errorf("gamedb: line %d: unknown setting \"%s\"", line, name)
+		}
+		game.Settings[name] = strings.TrimSpace(value)
+	}
+	return scanner.Err()
+}
+
+// Returns the settings of the game, or nil if it isn't in the database
+func (db *GameDatabase) Lookup(id string) *GameSettings {
+	return db.Games[strings.ToUpper(id)]
+}
+
+func isGameSetting(name string) bool {
+	for _, setting := range GAME_SETTING_NAMES {
+		if setting == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package emulator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGameDatabase(t *testing.T) {
+	db := DefaultGameDatabase()
+	game := db.Lookup("scus-94423")
+	if game == nil || game.Settings["port1"] != "dualshock" {
+		t.Fatalf("unexpected settings %+v", game)
+	}
+
+	// user files override the settings one by one
+	err := db.Load(strings.NewReader("# comment\n[SCUS-94423]\noverclock = 2\n\n[SLUS-00594] Metal Gear Solid\nRegion=europe\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game.Name != "Ape Escape" || game.Settings["port1"] != "dualshock" || game.Settings["overclock"] != "2" {
+		t.Errorf("unexpected merged settings %+v", game)
+	}
+	if game := db.Lookup("SLUS-00594"); game == nil || game.Settings["region"] != "europe" {
+		t.Errorf("unexpected settings %+v", game)
+	}
+	if db.Lookup("SLUS-99999") != nil {
+		t.Error("expected an unknown game")
+	}
+
+	for _, bad := range []string{"port1 = dualshock\n", "[SLUS-00594]\nfoo = 1\n", "[SLUS-00594]\npgxp\n", "[SLUS-00594\n"} {
+		if err := NewGameDatabase().Load(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
@@ -1,7 +1,5 @@
 package emulator
 
-import "fmt"
-
 type SerialTarget int
 
 const (
@@ -45,6 +43,41 @@ func NewPadMemCard() *PadMemCard {
 	}
 }
 
+// Returns the device plugged into the port specified by `target`
+func (card *PadMemCard) Port(target SerialTarget) *Gamepad {
+	if target == TARGET_PADMEMCARD2 {
+		return card.Pad2
+	}
+	return card.Pad1
+}
+
+// Returns the controller in `slot` of the port specified by `target`. If
+// there's no multitap adapter in the port, slot 0 is the device itself and
+// the other slots are nil
+func (card *PadMemCard) Gamepad(target SerialTarget, slot int) *Gamepad {
+	port := card.Port(target)
+	if tap, ok := port.Profile.(*MultitapProfile); ok {
+		return tap.Gamepad(slot)
+	}
+	if slot == 0 {
+		return port
+	}
+	return nil
+}
+
+// Sets the button states of the digital pads in port 1 and port 2, as in
+// DigitalPadProfile.State. Ports without a digital pad get one plugged in
+func (card *PadMemCard) SetDigitalPads(pad1, pad2 uint16) {
+	for i, pad := range []*Gamepad{card.Pad1, card.Pad2} {
+		profile, ok := pad.Profile.(*DigitalPadProfile)
+		if !ok {
+			profile = NewDigitalPad()
+			pad.Profile = profile
+		}
+		profile.State = []uint16{pad1, pad2}[i]
+	}
+}
+
 // Returns value of the status register
 func (card *PadMemCard) Status() uint32 {
 	var r uint32
@@ -111,7 +144,7 @@ func (card *PadMemCard) SetControl(val uint16, irqState *IrqState) {
 			panicFmt("gamepad: unsupported interrupt 0x%x", val)
 		}
 		if !prevSelect && card.Select {
-			card.Pad1.Select()
+			card.Port(card.Target).Select()
 		}
 	}
 }
@@ -120,7 +153,7 @@ func (card *PadMemCard) Acknowledge(irqState *IrqState) {
 	card.Interrupt = false
 
 	if card.Dsr && card.DsrIt {
-		fmt.Println("gamepad: acknowledge when DSR is active")
+		Log.Warnf(LOG_MODULE_PAD, "acknowledge when DSR is active")
 		card.Interrupt = true
 		irqState.SetHigh(INTERRUPT_PADMEMCARD)
 	}
@@ -143,7 +176,7 @@ func (card *PadMemCard) SendCommand(cmd uint8, th *TimeHandler) {
 		panic("gamepad: SendCommand while TxEn is false")
 	}
 	if card.Bus.IsBusy() {
-		fmt.Printf("gamepad: command 0x%x while bus is busy!\n", cmd)
+		Log.Warnf(LOG_MODULE_PAD, "command 0x%x while bus is busy", cmd)
 	}
 
 	// no response by default
@@ -151,12 +184,7 @@ func (card *PadMemCard) SendCommand(cmd uint8, th *TimeHandler) {
 	var dsr bool = false
 
 	if card.Select {
-		switch card.Target {
-		case TARGET_PADMEMCARD1:
-			response, dsr = card.Pad1.SendCommand(cmd)
-		case TARGET_PADMEMCARD2:
-			response, dsr = card.Pad2.SendCommand(cmd)
-		}
+		response, dsr = card.Port(card.Target).SendCommand(cmd)
 	}
 
 	// TODO: handle `Mode`
@@ -215,7 +243,7 @@ func (card *PadMemCard) HandleTransfer(th *TimeHandler, irqState *IrqState, delt
 	} else {
 		// end of transfer
 		if card.RxNotEmpty {
-			fmt.Println("gamepad: RX while FIFO is not empty")
+			Log.Warnf(LOG_MODULE_PAD, "RX while FIFO is not empty")
 		}
 
 		card.Response = resp
@@ -242,7 +270,7 @@ func (card *PadMemCard) HandleTransfer(th *TimeHandler, irqState *IrqState, delt
 
 func (card *PadMemCard) Store(
 	offset uint32,
-	val interface{},
+	val uint32,
 	size AccessSize,
 	th *TimeHandler,
 	irqState *IrqState,
@@ -254,20 +282,20 @@ func (card *PadMemCard) Store(
 		if size != ACCESS_BYTE {
 			panicFmt("gamepad: unhandled store size %d (expected %d)", size, ACCESS_BYTE)
 		}
-		card.SendCommand(accessSizeToU8(size, val), th)
+		card.SendCommand(uint8(val), th)
 	case 8:
-		card.SetMode(accessSizeToU8(size, val))
+		card.SetMode(uint8(val))
 	case 10: // control
 		if size == ACCESS_BYTE {
 			panic("gamepad: byte gamepad control access")
 		}
-		card.SetControl(accessSizeToU16(size, val), irqState)
+		card.SetControl(uint16(val), irqState)
 	case 14:
-		card.BaudDiv = accessSizeToU16(size, val)
+		card.BaudDiv = uint16(val)
 	default:
 		panicFmt(
 			"gamepad: unhandled write to gamepad register %d <- 0x%x",
-			offset, accessSizeToU16(size, val),
+			offset, uint16(val),
 		)
 	}
 }
@@ -277,20 +305,20 @@ func (card *PadMemCard) Load(
 	irqState *IrqState,
 	offset uint32,
 	size AccessSize,
-) interface{} {
+) uint32 {
 	card.Sync(th, irqState)
 
 	switch offset {
 	case 0:
 		card.RxNotEmpty = false
 		card.Response = 0xff
-		return card.Response
+		return uint32(card.Response)
 	case 4:
-		return accessSizeU32(size, card.Status())
+		return card.Status()
 	case 10:
-		return accessSizeU16(size, card.Control())
+		return uint32(card.Control())
 	case 14:
-		return accessSizeU32(size, uint32(card.BaudDiv))
+		return uint32(card.BaudDiv)
 	default:
 		panicFmt("gamepad: unhandled read from register %d", offset)
 	}
@@ -1,7 +1,7 @@
 package emulator
 
 import (
-	"fmt"
+	"image"
 	"image/color"
 )
 
@@ -63,6 +63,14 @@ const (
 	VMODE_PAL  VMode = 1 // PAL: 576i50Hz
 )
 
+// Returns "NTSC" or "PAL"
+func (vmode VMode) String() string {
+	if vmode == VMODE_PAL {
+		return "PAL"
+	}
+	return "NTSC"
+}
+
 type HardwareType uint8
 
 const (
@@ -98,6 +106,30 @@ const (
 	GP0_MODE_IMAGE_LOAD GP0Mode = iota // Loading an image into VRAM
 )
 
+// State of a GP0(0xC0) VRAM to CPU transfer
+type VRamTransfer struct {
+	Active     bool  // True until every pixel was read through GPUREAD
+	Position   Vec2U // Top-left corner of the rectangle in VRAM
+	Resolution Vec2U // Size of the rectangle
+	Index      uint32
+}
+
+// Returns the next pixel of the rectangle and moves on. Returns 0 after
+// the end of the rectangle
+func (transfer *VRamTransfer) nextPixel(vram *VRam) uint16 {
+	if !transfer.Active {
+		return 0
+	}
+	width := uint32(transfer.Resolution.X)
+	x := transfer.Position.X + uint16(transfer.Index%width)
+	y := transfer.Position.Y + uint16(transfer.Index/width)
+	transfer.Index++
+	if transfer.Index >= width*uint32(transfer.Resolution.Y) {
+		transfer.Active = false
+	}
+	return vram.Get(x, y)
+}
+
 // Graphics Processing Unit state
 type GPU struct {
 	DrawData  *DrawData // Stores the vertex buffers, etc.
@@ -150,6 +182,8 @@ type GPU struct {
 	GP0Handler            GP0CommandHandler // Method implementing the current GP0 command
 	GP0Mode               GP0Mode           // Current mode of the GP0 register
 	LoadBuffer            *ImageBuffer      // GP0 ImageLoad buffer
+	VRamRead              VRamTransfer      // GP0 ImageStore transfer
+	VRam                  *VRam             // Copy of VRAM written by image loads and fills
 	ClockFrac             uint16            // Fractional GPU cycle remainder from CPU clock
 	DisplayLine           uint16            // Currently displayed video output line
 	DisplayLineTick       uint16            // Current GPU clock tick for the current line
@@ -157,6 +191,21 @@ type GPU struct {
 	Hardware              HardwareType      // PAL or NTSC
 	ClockPhase            uint16            // Clock CPU/GPU time conversion in CPU periods
 	ReadWord              uint32            // Next GPUREAD word
+	Frames                uint64            // Amount of frames output since the GPU was created
+	DrawCalls             uint32            // Polygons, rectangles and lines drawn, for the debug overlay
+	Logger                *GpuLogger        // If not nil, GP0 and GP1 commands are recorded
+	// If not nil, finished frames are pushed to it. Otherwise they are
+	// discarded after the FrameEnd callback
+	FrameQueue *FrameQueue
+	// Precise vertex coordinates from the GTE, nil if PGXP is disabled
+	Pgxp *VertexCache
+	// Never dither, even if the game enables it. An enhancement that gives
+	// smooth gradients
+	NoDither bool
+	// If not nil, called with the picture of every frame at the end of the
+	// VBlank. The frame is drawn in software, so this is slow
+	Capture      FrameCapture
+	captureImage *image.RGBA // Last captured picture
 }
 
 func NewGPU(hardware HardwareType) *GPU {
@@ -173,6 +222,7 @@ func NewGPU(hardware HardwareType) *GPU {
 		DmaDirection:      DD_DMA_OFF,
 		GP0Mode:           GP0_MODE_COMMAND,
 		LoadBuffer:        NewImageBuffer(),
+		VRam:              NewVRam(),
 		DisplayHorizStart: 0x200,
 		DisplayHorizEnd:   0xc00,
 		DisplayLineStart:  0x10,
@@ -182,6 +232,20 @@ func NewGPU(hardware HardwareType) *GPU {
 	return gpu
 }
 
+// Puts the GPU back to its power-on state. The hooks, the frame counter and
+// the hardware type are kept
+func (gpu *GPU) Reset() {
+	fresh := NewGPU(gpu.Hardware)
+	fresh.FrameEnd = gpu.FrameEnd
+	fresh.FrameQueue = gpu.FrameQueue
+	fresh.Pgxp = gpu.Pgxp
+	fresh.NoDither = gpu.NoDither
+	fresh.Capture = gpu.Capture
+	fresh.Logger = gpu.Logger
+	fresh.Frames = gpu.Frames
+	*gpu = *fresh
+}
+
 // Handle writes to the GP0 command register
 func (gpu *GPU) GP0(val uint32) {
 	if gpu.GP0WordsRemaining == 0 {
@@ -189,49 +253,8 @@ func (gpu *GPU) GP0(val uint32) {
 		// opcode := (val >> 24) & 0xff
 		opcode := val >> 24
 
-		var length uint32
-		var handler GP0CommandHandler
-
-		switch opcode {
-		case 0x00:
-			length, handler = 1, gpu.GP0Nop
-		case 0x01:
-			length, handler = 1, gpu.GP0ClearCache
-		case 0x02:
-			length, handler = 3, gpu.GP0FillRect
-		case 0x20:
-			length, handler = 4, gpu.GP0TriangleMonoOpaque
-		case 0x28:
-			length, handler = 5, gpu.GP0QuadMonoOpaque
-		case 0x2c, 0x2f:
-			length, handler = 9, gpu.GP0QuadTextureBlendOpaque
-		case 0x2d:
-			length, handler = 9, gpu.GP0QuadTextureRawOpaque
-		case 0x30:
-			length, handler = 6, gpu.GP0TriangleShadedOpaque
-		case 0x38:
-			length, handler = 8, gpu.GP0QuadShadedOpaque
-		case 0x64:
-			length, handler = 4, gpu.GP0RectTextureBlendOpaque
-		case 0x65:
-			length, handler = 4, gpu.GP0RectTextureRawOpaque
-		case 0xa0:
-			length, handler = 3, gpu.GP0ImageLoad
-		case 0xc0:
-			length, handler = 3, gpu.GP0ImageStore
-		case 0xe1:
-			length, handler = 1, gpu.GP0DrawMode
-		case 0xe2:
-			length, handler = 1, gpu.GP0TextureWindow
-		case 0xe3:
-			length, handler = 1, gpu.GP0DrawingAreaTopLeft
-		case 0xe4:
-			length, handler = 1, gpu.GP0DrawingAreaBottomRight
-		case 0xe5:
-			length, handler = 1, gpu.GP0DrawingOffset
-		case 0xe6:
-			length, handler = 1, gpu.GP0MaskBitSetting
-		default:
+		length, handler := gpu.gp0Command(opcode)
+		if handler == nil {
 			panicFmt("gpu: unhandled GP0 command 0x%x", val)
 		}
 
@@ -248,82 +271,188 @@ func (gpu *GPU) GP0(val uint32) {
 		gpu.GP0Command.PushWord(val)
 
 		if gpu.GP0WordsRemaining == 0 {
+			if gpu.Logger != nil {
+				gpu.Logger.Log(0, gpu.GP0Command.Buffer[:gpu.GP0Command.Len])
+			}
 			// we have all the parameters, now we can run the method
+			if opcode := gpu.GP0Command.Get(0) >> 24; opcode >= 0x20 && opcode < 0x80 {
+				gpu.DrawCalls++
+			}
 			gpu.GP0Handler()
 		}
 	case GP0_MODE_IMAGE_LOAD:
+		if gpu.Logger != nil {
+			gpu.Logger.LogData()
+		}
 		gpu.GP0HandleImageLoad(val)
 	}
 }
 
+// Returns the amount of words and the handler of a GP0 command, or a nil
+// handler if the command isn't implemented
+func (gpu *GPU) gp0Command(opcode uint32) (uint32, GP0CommandHandler) {
+	switch opcode {
+	case 0x00:
+		return 1, gpu.GP0Nop
+	case 0x01:
+		return 1, gpu.GP0ClearCache
+	case 0x02:
+		return 3, gpu.GP0FillRect
+	case 0x20:
+		return 4, gpu.GP0TriangleMonoOpaque
+	case 0x28:
+		return 5, gpu.GP0QuadMonoOpaque
+	case 0x2c, 0x2f:
+		return 9, gpu.GP0QuadTextureBlendOpaque
+	case 0x2d:
+		return 9, gpu.GP0QuadTextureRawOpaque
+	case 0x30:
+		return 6, gpu.GP0TriangleShadedOpaque
+	case 0x38:
+		return 8, gpu.GP0QuadShadedOpaque
+	case 0x64:
+		return 4, gpu.GP0RectTextureBlendOpaque
+	case 0x65:
+		return 4, gpu.GP0RectTextureRawOpaque
+	case 0xa0:
+		return 3, gpu.GP0ImageLoad
+	case 0xc0:
+		return 3, gpu.GP0ImageStore
+	case 0xe1:
+		return 1, gpu.GP0DrawMode
+	case 0xe2:
+		return 1, gpu.GP0TextureWindow
+	case 0xe3:
+		return 1, gpu.GP0DrawingAreaTopLeft
+	case 0xe4:
+		return 1, gpu.GP0DrawingAreaBottomRight
+	case 0xe5:
+		return 1, gpu.GP0DrawingOffset
+	case 0xe6:
+		return 1, gpu.GP0MaskBitSetting
+	}
+	return 0, nil
+}
+
+// Returns the attributes of the primitive drawn by the current GP0 command.
+// Bit 1 of the opcode makes it semi-transparent, bit 2 makes polygons and
+// rectangles textured and bit 0 disables the texture blending
+func (gpu *GPU) primitiveAttributes(primitive PrimitiveType) PrimitiveAttributes {
+	opcode := gpu.GP0Command.Get(0) >> 24
+	attrs := PrimitiveAttributes{Type: primitive, TexPage: gpu.TexPage()}
+	if primitive == PRIMITIVE_FILL {
+		// fills only stop at the edges of VRAM
+		attrs.DrawingArea = image.Rect(0, 0, VRAM_WIDTH_PIXELS, VRAM_HEIGHT_PIXELS)
+		return attrs
+	}
+	attrs.DrawingArea = gpu.DrawingArea()
+	attrs.SetMask = gpu.ForceSetMaskBit
+	attrs.CheckMask = gpu.PreserveMaskedPixels
+
+	attrs.SemiTransparent = opcode&2 != 0
+	if primitive != PRIMITIVE_LINE && opcode&4 != 0 && !gpu.TextureDisable {
+		attrs.Textured = true
+		attrs.RawTexture = opcode&1 != 0
+	}
+
+	// rectangles are never dithered, bit 4 makes polygons and lines shaded
+	if gpu.Dithering && !gpu.NoDither && primitive != PRIMITIVE_RECTANGLE {
+		shaded := opcode&0x10 != 0
+		attrs.Dither = shaded || (attrs.Textured && !attrs.RawTexture)
+	}
+	return attrs
+}
+
+// Returns a vertex of the polygon drawn by the current command, see
+// PolygonVertex
+func (gpu *GPU) primitiveVertex(xy uint32, clr color.RGBA, attrs PrimitiveAttributes) Vertex {
+	vertex := gpu.PolygonVertex(xy, clr)
+	vertex.PrimitiveAttributes = attrs
+	return vertex
+}
+
+// Returns a vertex of the textured polygon drawn by the current command.
+// `uv` is the texture coordinate parameter of the vertex
+func (gpu *GPU) texturedVertex(xy, uv uint32, clr color.RGBA, attrs PrimitiveAttributes) Vertex {
+	vertex := gpu.primitiveVertex(xy, clr, attrs)
+	vertex.UV = Vec2U{X: uint16(uv & 0xff), Y: uint16((uv >> 8) & 0xff)}
+	return vertex
+}
+
+// Returns the 4 corners of a rectangle (top-left, top-right, bottom-left,
+// bottom-right). Textured rectangles map their texture from `uv` to `uv`
+// plus the size, mirrored by the draw mode flips
+func (gpu *GPU) rectangleVertices(topLeft, size Vec2, uv uint32, clr color.RGBA, attrs PrimitiveAttributes) [4]Vertex {
+	right, bottom := topLeft.X+size.X, topLeft.Y+size.Y
+	vertices := [4]Vertex{
+		NewVertex(topLeft, clr),
+		NewVertex(NewVec2(right, topLeft.Y), clr),
+		NewVertex(NewVec2(topLeft.X, bottom), clr),
+		NewVertex(NewVec2(right, bottom), clr),
+	}
+
+	u, v := uint16(uv&0xff), uint16((uv>>8)&0xff)
+	du, dv := uint16(size.X), uint16(size.Y)
+	if gpu.RectangleTextureXFlip {
+		du = -du
+	}
+	if gpu.RectangleTextureYFlip {
+		dv = -dv
+	}
+	uvs := [4]Vec2U{{u, v}, {u + du, v}, {u, v + dv}, {u + du, v + dv}}
+
+	for i := range vertices {
+		vertices[i].PrimitiveAttributes = attrs
+		if attrs.Textured {
+			vertices[i].UV = uvs[i]
+		}
+	}
+	return vertices
+}
+
 // GP0(0x60): Opaque monochrome rectangle
 func (gpu *GPU) GP0RectOpaque() {
 	clr := ColorFromGP0(gpu.GP0Command.Get(0))
 	topLeft := Vec2FromGP0(gpu.GP0Command.Get(1))
 	size := Vec2FromGP0(gpu.GP0Command.Get(2))
 
-	gpu.DrawData.PushQuad(
-		NewVertex(NewVec2(topLeft.X+size.X, topLeft.Y), clr),
-		NewVertex(NewVec2(topLeft.X, topLeft.Y+size.Y), clr),
-		NewVertex(NewVec2(topLeft.X+size.X, topLeft.Y+size.Y), clr),
-	)
+	vertices := gpu.rectangleVertices(topLeft, size, 0, clr, gpu.primitiveAttributes(PRIMITIVE_RECTANGLE))
+	gpu.DrawData.PushQuad(vertices[:]...)
 }
 
 // GP0(0x64): Opaque rectangle with texture blending
 func (gpu *GPU) GP0RectTextureBlendOpaque() {
 	clr := ColorFromGP0(gpu.GP0Command.Get(0))
 	topLeft := Vec2FromGP0(gpu.GP0Command.Get(1))
-	// ...
+	uv := gpu.GP0Command.Get(2)
 	size := Vec2FromGP0(gpu.GP0Command.Get(3))
 
-	gpu.DrawData.PushQuad(
-		NewVertex(NewVec2(topLeft.X+size.X, topLeft.Y), clr),
-		NewVertex(NewVec2(topLeft.X, topLeft.Y+size.Y), clr),
-		NewVertex(NewVec2(topLeft.X+size.X, topLeft.Y+size.Y), clr),
-	)
+	attrs := gpu.primitiveAttributes(PRIMITIVE_RECTANGLE)
+	attrs.Clut = uint16(uv >> 16)
+	vertices := gpu.rectangleVertices(topLeft, size, uv, clr, attrs)
+	gpu.DrawData.PushQuad(vertices[:]...)
 }
 
 // GP0(0x02): Fill Rectangle
 func (gpu *GPU) GP0FillRect() {
-	// TODO: this should be affected by the mask
 	clr := ColorFromGP0(gpu.GP0Command.Get(0))
 	topLeft := Vec2FromGP0(gpu.GP0Command.Get(1))
 	size := Vec2FromGP0(gpu.GP0Command.Get(2))
 
-	gpu.DrawData.PushQuad(
-		NewVertex(topLeft, clr),
-		NewVertex(NewVec2(topLeft.X+size.X, topLeft.Y), clr),
-		NewVertex(NewVec2(topLeft.X, topLeft.Y+size.Y), clr),
-		NewVertex(NewVec2(topLeft.X+size.X, topLeft.Y+size.Y), clr),
-	)
+	// not affected by the mask settings
+	gpu.VRam.Fill(topLeft, size, clr)
+	vertices := gpu.rectangleVertices(topLeft, size, 0, clr, gpu.primitiveAttributes(PRIMITIVE_FILL))
+	gpu.DrawData.PushQuad(vertices[:]...)
 }
 
 // GP0(0x2D): Raw Textured Opaque Quadrilateral
 func (gpu *GPU) GP0QuadTextureRawOpaque() {
-	// FIXME: we don't support textures at this point, so the color is just red
-	clr := color.RGBA{255, 0, 0, 255}
-
-	gpu.DrawData.PushQuad(
-		NewVertex(Vec2FromGP0(gpu.GP0Command.Get(1)), clr),
-		NewVertex(Vec2FromGP0(gpu.GP0Command.Get(3)), clr),
-		NewVertex(Vec2FromGP0(gpu.GP0Command.Get(5)), clr),
-		NewVertex(Vec2FromGP0(gpu.GP0Command.Get(7)), clr),
-	)
+	gpu.GP0QuadTextureBlendOpaque()
 }
 
 // GP0(0x65): Opaque rectangle with raw texture
 func (gpu *GPU) GP0RectTextureRawOpaque() {
-	// TODO: this should be affected by the mask
-	clr := ColorFromGP0(gpu.GP0Command.Get(0))
-	topLeft := Vec2FromGP0(gpu.GP0Command.Get(1))
-	size := Vec2FromGP0(gpu.GP0Command.Get(3))
-
-	gpu.DrawData.PushQuad(
-		NewVertex(topLeft, clr),
-		NewVertex(NewVec2(topLeft.X+size.X, topLeft.Y), clr),
-		NewVertex(NewVec2(topLeft.X, topLeft.Y+size.Y), clr),
-		NewVertex(NewVec2(topLeft.X+size.X, topLeft.Y+size.Y), clr),
-	)
+	gpu.GP0RectTextureBlendOpaque()
 }
 
 // GP0(0xA0): Image Load
@@ -366,74 +495,109 @@ func (gpu *GPU) GP0HandleImageLoad(word uint32) {
 	if gpu.GP0WordsRemaining == 0 {
 		// load done, switch back to command mode
 		gpu.GP0Mode = GP0_MODE_COMMAND
-		// TODO: load image here
-		// fmt.Println("gpu: unhandled image load")
+		gpu.VRam.StoreImage(gpu.LoadBuffer, gpu.ForceSetMaskBit, gpu.PreserveMaskedPixels)
 		gpu.LoadBuffer.Clear()
 	}
 }
 
-// GP0(0xC0): Image Store
+// GP0(0xC0): Image Store. The pixels are then read through GPUREAD, two
+// per word. Only image loads and fills are in VRAM, see VRam
 func (gpu *GPU) GP0ImageStore() {
-	// parameter 2 contains the image resolution
+	pos := gpu.GP0Command.Get(1)
 	res := gpu.GP0Command.Get(2)
-	width := res & 0xffff
-	height := res >> 16
 
-	fmt.Printf("gpu: unhandled image store: %dx%d\n", width, height)
+	// a size of 0 is the largest size, the sizes wrap around
+	gpu.VRamRead = VRamTransfer{
+		Active:   true,
+		Position: Vec2U{X: uint16(pos) & 0x3ff, Y: uint16(pos>>16) & 0x1ff},
+		Resolution: Vec2U{
+			X: (uint16(res)-1)&0x3ff + 1,
+			Y: (uint16(res>>16)-1)&0x1ff + 1,
+		},
+	}
 }
 
 // GP0(0x28): Monochrome Opaque Quadliteral
 func (gpu *GPU) GP0QuadMonoOpaque() {
 	clr := ColorFromGP0(gpu.GP0Command.Get(0))
+	attrs := gpu.primitiveAttributes(PRIMITIVE_POLYGON)
 	gpu.DrawData.PushQuad(
-		NewVertex(Vec2FromGP0(gpu.GP0Command.Get(1)), clr),
-		NewVertex(Vec2FromGP0(gpu.GP0Command.Get(2)), clr),
-		NewVertex(Vec2FromGP0(gpu.GP0Command.Get(3)), clr),
-		NewVertex(Vec2FromGP0(gpu.GP0Command.Get(4)), clr),
+		gpu.primitiveVertex(gpu.GP0Command.Get(1), clr, attrs),
+		gpu.primitiveVertex(gpu.GP0Command.Get(2), clr, attrs),
+		gpu.primitiveVertex(gpu.GP0Command.Get(3), clr, attrs),
+		gpu.primitiveVertex(gpu.GP0Command.Get(4), clr, attrs),
 	)
 }
 
 // GP0(0x38): Shaded Opaque Quadliteral
 func (gpu *GPU) GP0QuadShadedOpaque() {
+	attrs := gpu.primitiveAttributes(PRIMITIVE_POLYGON)
 	gpu.DrawData.PushQuad(
-		NewVertex(Vec2FromGP0(gpu.GP0Command.Get(1)), ColorFromGP0(gpu.GP0Command.Get(0))),
-		NewVertex(Vec2FromGP0(gpu.GP0Command.Get(3)), ColorFromGP0(gpu.GP0Command.Get(2))),
-		NewVertex(Vec2FromGP0(gpu.GP0Command.Get(5)), ColorFromGP0(gpu.GP0Command.Get(4))),
-		NewVertex(Vec2FromGP0(gpu.GP0Command.Get(7)), ColorFromGP0(gpu.GP0Command.Get(6))),
+		gpu.primitiveVertex(gpu.GP0Command.Get(1), ColorFromGP0(gpu.GP0Command.Get(0)), attrs),
+		gpu.primitiveVertex(gpu.GP0Command.Get(3), ColorFromGP0(gpu.GP0Command.Get(2)), attrs),
+		gpu.primitiveVertex(gpu.GP0Command.Get(5), ColorFromGP0(gpu.GP0Command.Get(4)), attrs),
+		gpu.primitiveVertex(gpu.GP0Command.Get(7), ColorFromGP0(gpu.GP0Command.Get(6)), attrs),
 	)
 }
 
 // GP0(0x30): Shaded Opaque Triangle
 func (gpu *GPU) GP0TriangleShadedOpaque() {
+	attrs := gpu.primitiveAttributes(PRIMITIVE_POLYGON)
 	gpu.DrawData.PushVertices(
-		NewVertex(Vec2FromGP0(gpu.GP0Command.Get(1)), ColorFromGP0(gpu.GP0Command.Get(0))),
-		NewVertex(Vec2FromGP0(gpu.GP0Command.Get(3)), ColorFromGP0(gpu.GP0Command.Get(2))),
-		NewVertex(Vec2FromGP0(gpu.GP0Command.Get(5)), ColorFromGP0(gpu.GP0Command.Get(4))),
+		gpu.primitiveVertex(gpu.GP0Command.Get(1), ColorFromGP0(gpu.GP0Command.Get(0)), attrs),
+		gpu.primitiveVertex(gpu.GP0Command.Get(3), ColorFromGP0(gpu.GP0Command.Get(2)), attrs),
+		gpu.primitiveVertex(gpu.GP0Command.Get(5), ColorFromGP0(gpu.GP0Command.Get(4)), attrs),
 	)
 }
 
 // GP0(0x20): Monochrome Opaque Triangle
 func (gpu *GPU) GP0TriangleMonoOpaque() {
 	clr := ColorFromGP0(gpu.GP0Command.Get(0))
+	attrs := gpu.primitiveAttributes(PRIMITIVE_POLYGON)
 	gpu.DrawData.PushVertices(
-		NewVertex(Vec2FromGP0(gpu.GP0Command.Get(1)), clr),
-		NewVertex(Vec2FromGP0(gpu.GP0Command.Get(2)), clr),
-		NewVertex(Vec2FromGP0(gpu.GP0Command.Get(3)), clr),
+		gpu.primitiveVertex(gpu.GP0Command.Get(1), clr, attrs),
+		gpu.primitiveVertex(gpu.GP0Command.Get(2), clr, attrs),
+		gpu.primitiveVertex(gpu.GP0Command.Get(3), clr, attrs),
 	)
 }
 
-// GP0(0x2C): Textured Opaque Quadliteral
+// GP0(0x2C): Textured Opaque Quadliteral. The palette is in the upper half
+// of the first texture coordinate and the texture page in the second one,
+// which also replaces the draw mode texture page
 func (gpu *GPU) GP0QuadTextureBlendOpaque() {
-	// FIXME: we don't support textures at this point, so the color is just red
-	clr := color.RGBA{255, 0, 0, 255}
+	clr := ColorFromGP0(gpu.GP0Command.Get(0))
+	gpu.setTexPage(uint16(gpu.GP0Command.Get(4) >> 16))
+
+	attrs := gpu.primitiveAttributes(PRIMITIVE_POLYGON)
+	attrs.Clut = uint16(gpu.GP0Command.Get(2) >> 16)
 	gpu.DrawData.PushQuad(
-		NewVertex(Vec2FromGP0(gpu.GP0Command.Get(1)), clr),
-		NewVertex(Vec2FromGP0(gpu.GP0Command.Get(3)), clr),
-		NewVertex(Vec2FromGP0(gpu.GP0Command.Get(5)), clr),
-		NewVertex(Vec2FromGP0(gpu.GP0Command.Get(7)), clr),
+		gpu.texturedVertex(gpu.GP0Command.Get(1), gpu.GP0Command.Get(2), clr, attrs),
+		gpu.texturedVertex(gpu.GP0Command.Get(3), gpu.GP0Command.Get(4), clr, attrs),
+		gpu.texturedVertex(gpu.GP0Command.Get(5), gpu.GP0Command.Get(6), clr, attrs),
+		gpu.texturedVertex(gpu.GP0Command.Get(7), gpu.GP0Command.Get(8), clr, attrs),
 	)
 }
 
+// Returns the draw mode texture page in the texture page attribute layout,
+// see PrimitiveAttributes.TexPage
+func (gpu *GPU) TexPage() uint16 {
+	page := uint16(gpu.PageBaseX) | uint16(gpu.PageBaseY)<<4 |
+		uint16(gpu.SemiTransparency)<<5 | uint16(gpu.TextureDepth)<<7
+	if gpu.TextureDisable {
+		page |= 1 << 11
+	}
+	return page
+}
+
+// Sets the draw mode texture page from the texture page attribute of a
+// textured polygon
+func (gpu *GPU) setTexPage(page uint16) {
+	gpu.PageBaseX = uint8(page & 0xf)
+	gpu.PageBaseY = uint8((page >> 4) & 1)
+	gpu.SemiTransparency = uint8((page >> 5) & 3)
+	gpu.TextureDepth = PrimitiveAttributes{TexPage: page}.TextureDepth()
+}
+
 // GP0(0xE1) command
 func (gpu *GPU) GP0DrawMode() {
 	val := gpu.GP0Command.Get(0)
@@ -484,6 +648,18 @@ func (gpu *GPU) GP0DrawingAreaBottomRight() {
 	gpu.DrawingAreaRight = uint16(val & 0x3ff)
 }
 
+// Returns the part of VRAM that polygons, rectangles and lines can draw
+// to. The bottom-right corner is inclusive in the GPU registers and
+// exclusive in the rectangle, which is empty if it's above or left of the
+// top-left corner
+func (gpu *GPU) DrawingArea() image.Rectangle {
+	// not image.Rect, which would swap the corners of an inverted area
+	return image.Rectangle{
+		Min: image.Pt(int(gpu.DrawingAreaLeft), int(gpu.DrawingAreaTop)),
+		Max: image.Pt(int(gpu.DrawingAreaRight)+1, int(gpu.DrawingAreaBottom)+1),
+	}
+}
+
 // GP0(0xE5): Set Drawing Offset
 func (gpu *GPU) GP0DrawingOffset() {
 	val := gpu.GP0Command.Get(0)
@@ -515,6 +691,9 @@ func (gpu *GPU) GP0MaskBitSetting() {
 // Handle writes to the GP1 command register
 func (gpu *GPU) GP1(val uint32, th *TimeHandler, irqState *IrqState, timers *Timers) {
 	opcode := (val >> 24) & 0xff
+	if gpu.Logger != nil {
+		gpu.Logger.Log(1, []uint32{val})
+	}
 
 	switch opcode {
 	case 0x00:
@@ -537,20 +716,35 @@ func (gpu *GPU) GP1(val uint32, th *TimeHandler, irqState *IrqState, timers *Tim
 	case 0x08:
 		gpu.GP1DisplayMode(val, th, irqState)
 		timers.VideoTimingsChanged(th, irqState, gpu)
-	case 0x10:
+	case 0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17,
+		0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f:
+		// 0x11-0x1f are mirrors of 0x10
 		gpu.GP1GetInfo(val)
 	default:
 		panicFmt("gpu: unhandled GP1 command 0x%x", val)
 	}
 }
 
-// GP1(0x10): get info
+// GP1(0x10): get info. The requested register is put in GPUREAD, the
+// other values leave GPUREAD unchanged
 func (gpu *GPU) GP1GetInfo(val uint32) {
 	switch val & 0xf {
+	case 2: // texture window, GP0(0xE2) parameter
+		gpu.ReadWord = uint32(gpu.TextureWindowXMask) |
+			uint32(gpu.TextureWindowYMask)<<5 |
+			uint32(gpu.TextureWindowXOffset)<<10 |
+			uint32(gpu.TextureWindowYOffset)<<15
+	case 3: // drawing area top left, GP0(0xE3) parameter
+		gpu.ReadWord = uint32(gpu.DrawingAreaLeft) | uint32(gpu.DrawingAreaTop)<<10
+	case 4: // drawing area bottom right, GP0(0xE4) parameter
+		gpu.ReadWord = uint32(gpu.DrawingAreaRight) | uint32(gpu.DrawingAreaBottom)<<10
+	case 5: // drawing offset, GP0(0xE5) parameter
+		gpu.ReadWord = uint32(uint16(gpu.DrawingXOffset)&0x7ff) |
+			uint32(uint16(gpu.DrawingYOffset)&0x7ff)<<11
 	case 7: // GPU version
 		gpu.ReadWord = 2
-	default:
-		panicFmt("gpu: unsupported GP1 info command 0x%x (%d)", val, val&0xf)
+	case 8: // unknown, always 0
+		gpu.ReadWord = 0
 	}
 }
 
@@ -689,6 +883,7 @@ func (gpu *GPU) GP1ResetCommandBuffer() {
 	gpu.GP0Command.Clear()
 	gpu.GP0WordsRemaining = 0
 	gpu.GP0Mode = GP0_MODE_COMMAND
+	gpu.VRamRead.Active = false
 	// FIXME: this should also clear the command FIFO, when we implement it
 }
 
@@ -716,20 +911,27 @@ func (gpu *GPU) Status() uint32 {
 	r |= oneIfTrue(gpu.DisplayDisabled) << 23
 	r |= oneIfTrue(gpu.GP0Interrupt) << 24
 
-	// for now, we pretend that the GPU is always ready:
-	// ready to receive command
-	r |= 1 << 26
-	// ready to send VRAM to CPU
-	r |= 1 << 27
-	// ready to receive DMA block
-	r |= 1 << 28
+	// commands run as soon as their last word is received, so the GPU is
+	// busy while a command or an image load is being received
+	r |= oneIfTrue(gpu.GP0WordsRemaining == 0) << 26
+	// ready to send VRAM to CPU while an image store has pixels left
+	r |= oneIfTrue(gpu.VRamRead.Active) << 27
+	// ready to receive a DMA block if the FIFO has room and the GPU isn't
+	// sending VRAM
+	fifoFree := int(gpu.GP0Command.Len) < GP0_FIFO_DEPTH
+	r |= oneIfTrue(fifoFree && !gpu.VRamRead.Active) << 28
 
 	r |= uint32(gpu.DmaDirection) << 29
 
 	// bit 31 is 1 if the currently displayed VRAM line is odd, 0 if it's even or if
-	// we're in vertical blanking
+	// we're in vertical blanking. 480 line interlaced output shows one field
+	// per frame, so it only changes between frames
 	if !gpu.InVBlank() {
-		r |= uint32(gpu.DisplayedVRamLine()&1) << 31
+		line := gpu.DisplayVRamYStart + gpu.DisplayLine
+		if gpu.Interlaced480() {
+			line = gpu.DisplayedVRamLine()
+		}
+		r |= uint32(line&1) << 31
 	}
 
 	// not sure about that, i'm guessing that it's the signal checked by the DMA
@@ -739,8 +941,8 @@ func (gpu *GPU) Status() uint32 {
 	switch gpu.DmaDirection {
 	case DD_DMA_OFF: // always 0
 		dmaRequest = 0
-	case DD_DMA_FIFO: // should be 0 if FIFO is full, 1 otherwise
-		dmaRequest = 1
+	case DD_DMA_FIFO: // 0 if the FIFO is full, 1 otherwise
+		dmaRequest = oneIfTrue(fifoFree)
 	case DD_CPU_TO_GP0: // should be the same as status bit 28
 		dmaRequest = (r >> 28) & 1
 	case DD_VRAM_TO_CPU: // should be the same as status bit 27
@@ -753,6 +955,11 @@ func (gpu *GPU) Status() uint32 {
 
 // Return value of the `read` register
 func (gpu *GPU) Read() uint32 {
+	if gpu.VRamRead.Active {
+		lo := gpu.VRamRead.nextPixel(gpu.VRam)
+		hi := gpu.VRamRead.nextPixel(gpu.VRam)
+		gpu.ReadWord = uint32(lo) | uint32(hi)<<16
+	}
 	return gpu.ReadWord
 }
 
@@ -761,19 +968,27 @@ func (gpu *GPU) SetFrameEnd(end func()) {
 	gpu.FrameEnd = end
 }
 
+// Returns the GPU clock frequency of the console in Hz. PAL consoles have a
+// slightly slower GPU clock
+func (gpu *GPU) ClockHz() float32 {
+	if gpu.Hardware == HARDWARE_PAL {
+		return 53_200_000
+	}
+	return 53_690_000
+}
+
 // Convert GPU clock ratio to CPU clock ratio
 func (gpu *GPU) GPUToCPUClockRatio() FracCycles {
 	// convert delta into GPU clock periods
-	var gpuClock float32
 	cpuClock := float32(CPU_FREQ_HZ)
-	switch gpu.Hardware {
-	case HARDWARE_NTSC:
-		gpuClock = 53_690_000
-	case HARDWARE_PAL:
-		gpuClock = 53_200_000
-	}
+	return FracCyclesFromF32(gpu.ClockHz() / cpuClock)
+}
 
-	return FracCyclesFromF32(gpuClock / cpuClock)
+// Returns the amount of frames output per second in the current video mode,
+// about 59.83 for NTSC and 49.76 for PAL
+func (gpu *GPU) RefreshRate() float64 {
+	ticksPerLine, linesPerFrame := gpu.GetVModeTimings()
+	return float64(gpu.ClockHz()) / (float64(ticksPerLine) * float64(linesPerFrame))
 }
 
 // Returns the number of GPU clock cycles per line, and the number of lines
@@ -800,6 +1015,59 @@ func (gpu *GPU) InVBlank() bool {
 	return gpu.DisplayLine < gpu.DisplayLineStart || gpu.DisplayLine >= gpu.DisplayLineEnd
 }
 
+// Returns true if the GPU is in the horizontal blanking period
+func (gpu *GPU) InHBlank() bool {
+	return gpu.DisplayLineTick < gpu.DisplayHorizStart || gpu.DisplayLineTick >= gpu.DisplayHorizEnd
+}
+
+// Returns the amount of CPU cycles until the next start or end of the
+// horizontal blanking. The GPU must be synchronized
+func (gpu *GPU) CyclesToHBlankEdge() uint64 {
+	ticksPerLine, _ := gpu.GetVModeTimingsU64()
+	tick := uint64(gpu.DisplayLineTick)
+	start := uint64(gpu.DisplayHorizStart)
+	end := uint64(gpu.DisplayHorizEnd)
+
+	var ticks uint64
+	switch {
+	case tick < start:
+		ticks = start - tick
+	case tick < end:
+		ticks = end - tick
+	default:
+		ticks = ticksPerLine - tick + start
+	}
+	return gpu.TicksToCycles(ticks)
+}
+
+// Returns the amount of CPU cycles until the next start or end of the
+// vertical blanking. The GPU must be synchronized
+func (gpu *GPU) CyclesToVBlankEdge() uint64 {
+	ticksPerLine, linesPerFrame := gpu.GetVModeTimingsU64()
+	line := uint64(gpu.DisplayLine)
+	start := uint64(gpu.DisplayLineStart)
+	end := uint64(gpu.DisplayLineEnd)
+
+	var lines uint64
+	switch {
+	case line < start:
+		lines = start - line
+	case line < end:
+		lines = end - line
+	default:
+		lines = linesPerFrame - line + start
+	}
+	return gpu.TicksToCycles(lines*ticksPerLine - uint64(gpu.DisplayLineTick))
+}
+
+// Converts GPU clock ticks from now to CPU cycles, rounded up so the
+// GPU is never synchronized too early
+func (gpu *GPU) TicksToCycles(ticks uint64) uint64 {
+	delta := ticks<<FRAC_CYCLES_FRAC_BITS - uint64(gpu.ClockPhase)
+	ratio := gpu.GPUToCPUClockRatio().GetFixed()
+	return (delta + ratio - 1) / ratio
+}
+
 // Synchronizes the GPU state
 func (gpu *GPU) Sync(th *TimeHandler, irqState *IrqState) {
 	delta := th.Sync(PERIPHERAL_GPU)
@@ -816,8 +1084,8 @@ func (gpu *GPU) Sync(th *TimeHandler, irqState *IrqState) {
 
 	gpu.DisplayLineTick = uint16(lineTick % ticksPerLine)
 
-	if line > linesPerFrame {
-		// new frame
+	if line >= linesPerFrame {
+		// new frame, the last line of a frame is linesPerFrame-1
 		if gpu.Interlaced {
 			// update field
 			nframes := line / linesPerFrame
@@ -840,13 +1108,30 @@ func (gpu *GPU) Sync(th *TimeHandler, irqState *IrqState) {
 	}
 
 	if gpu.VBlankInterrupt && !vblankInterrupt {
-		// end of vertical blanking, do the FrameEnd callback
+		// end of vertical blanking, present the frame
+		gpu.Frames++
+		if gpu.Logger != nil {
+			gpu.Logger.EndFrame()
+		}
+		if gpu.Pgxp != nil {
+			gpu.Pgxp.Clear()
+		}
+		if gpu.Capture != nil {
+			gpu.captureFrame()
+		}
 
-		// FIXME: the FrameEnd() call here causes the screen to flicker
-		// HACK: as a workaround, I check if the draw data has any vertices.
-		//       I have no idea why this happens :(
-		if gpu.FrameEnd != nil && len(gpu.DrawData.VtxBuffer) > 0 {
-			gpu.FrameEnd()
+		// games running at less than 60 FPS don't draw anything on some
+		// frames. VRAM still holds the last image on real hardware, so the
+		// previous frame stays on screen instead of an empty one
+		if len(gpu.DrawData.VtxBuffer) > 0 {
+			if gpu.FrameEnd != nil {
+				gpu.FrameEnd()
+			}
+			if gpu.FrameQueue != nil {
+				gpu.FrameQueue.Push(gpu)
+			} else {
+				gpu.DrawData.VtxBuffer = gpu.DrawData.VtxBuffer[:0]
+			}
 		}
 	}
 
@@ -893,6 +1178,18 @@ func (gpu *GPU) PredictNextSync(th *TimeHandler) {
 	th.SetNextSyncDelta(PERIPHERAL_GPU, delta)
 }
 
+// Returns true if the GPU outputs 480 interlaced lines, every field only
+// shows half of the lines of the display area
+func (gpu *GPU) Interlaced480() bool {
+	return gpu.Interlaced && gpu.VRes == VRES_480_LINES
+}
+
+// Returns 0 if the current field shows the even VRAM lines and 1 if it
+// shows the odd lines
+func (gpu *GPU) FieldParity() uint16 {
+	return (gpu.DisplayVRamYStart + uint16(gpu.Field)) & 1
+}
+
 // Returns the index of the currently displayed VRAM line
 func (gpu *GPU) DisplayedVRamLine() uint16 {
 	var offset uint16
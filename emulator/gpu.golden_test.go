@@ -0,0 +1,174 @@
+package emulator
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Rewrites the golden images with the current output instead of comparing,
+// after a change that is meant to render differently:
+//
+//	go test ./emulator -run TestGpuGolden -update-golden
+var updateGolden = flag.Bool("update-golden", false, "rewrite the golden images of TestGpuGolden")
+
+// Directory of the GP0 streams (name.gp0) and their golden images (name.png)
+const GPU_GOLDEN_DIR = "testdata/gpu"
+
+// Reads a GP0 stream: hex words separated by spaces or lines, with #
+// comments. This is the command words and the image data words in the
+// order they were sent to GP0
+func readGP0Stream(path string) ([]uint32, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var words []uint32
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		for _, field := range strings.Fields(text) {
+			word, err := strconv.ParseUint(strings.TrimPrefix(field, "0x"), 16, 32)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid word \"%s\"", path, line, field)
+			}
+			words = append(words, uint32(word))
+		}
+	}
+	return words, scanner.Err()
+}
+
+// Sends `words` to GP0 of a new GPU and returns VRAM with the polygons drawn
+// by the software rasterizer, like the captured frames
+func renderGP0Stream(words []uint32) *image.RGBA {
+	gpu := NewGPU(HARDWARE_NTSC)
+	for _, word := range words {
+		gpu.GP0(word)
+	}
+	vram := gpu.VRam.Image()
+	offset := NewVec2(gpu.DrawingXOffset, gpu.DrawingYOffset)
+	RasterizeMasked(vram, gpu.VRam.MaskPlane(), gpu.DrawData.VtxBuffer, offset)
+	return vram
+}
+
+func readPNG(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return png.Decode(file)
+}
+
+func writePNG(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Returns the amount of pixels that differ between `got` and `want` and
+// the first one, or -1,-1 if they're the same
+func diffImages(got *image.RGBA, want image.Image) (int, image.Point) {
+	first := image.Pt(-1, -1)
+	count := 0
+	bounds := got.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r0, g0, b0, a0 := got.At(x, y).RGBA()
+			r1, g1, b1, a1 := want.At(x, y).RGBA()
+			if r0 != r1 || g0 != g1 || b0 != b1 || a0 != a1 {
+				if count == 0 {
+					first = image.Pt(x, y)
+				}
+				count++
+			}
+		}
+	}
+	return count, first
+}
+
+// Replays every GP0 stream of GPU_GOLDEN_DIR and compares VRAM to its
+// golden image. A mismatch writes the output next to the golden image as
+// name.failed.png
+func TestGpuGolden(t *testing.T) {
+	streams, err := filepath.Glob(filepath.Join(GPU_GOLDEN_DIR, "*.gp0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streams) == 0 {
+		t.Fatalf("no GP0 streams in %s", GPU_GOLDEN_DIR)
+	}
+
+	for _, stream := range streams {
+		name := strings.TrimSuffix(filepath.Base(stream), ".gp0")
+		t.Run(name, func(t *testing.T) {
+			words, err := readGP0Stream(stream)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := renderGP0Stream(words)
+
+			golden := strings.TrimSuffix(stream, ".gp0") + ".png"
+			failed := strings.TrimSuffix(stream, ".gp0") + ".failed.png"
+			if *updateGolden {
+				if err := writePNG(golden, got); err != nil {
+					t.Fatal(err)
+				}
+				os.Remove(failed)
+				return
+			}
+
+			want, err := readPNG(golden)
+			if err != nil {
+				t.Fatalf("%s (run with -update-golden to create it)", err)
+			}
+			if want.Bounds() != got.Bounds() {
+				t.Fatalf("expected a %v image, got %v", want.Bounds(), got.Bounds())
+			}
+			if count, first := diffImages(got, want); count > 0 {
+				if err := writePNG(failed, got); err != nil {
+					t.Log(err)
+				}
+				t.Errorf("%d pixels differ from %s, the first at %v (output in %s)",
+					count, golden, first, failed)
+			}
+		})
+	}
+}
+
+func TestReadGP0Stream(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stream.gp0")
+	data := "# fill\n02ff0000 0x00100010\n\n00200020 # size\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	words, err := readGP0Stream(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprintf("%08x", words) != "[02ff0000 00100010 00200020]" {
+		t.Errorf("unexpected words %08x", words)
+	}
+
+	if err := os.WriteFile(path, []byte("02ff0000\nnope\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readGP0Stream(path); err == nil || !strings.Contains(err.Error(), ":2:") {
+		t.Errorf("expected an error on line 2, got %v", err)
+	}
+}
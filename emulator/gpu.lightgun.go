@@ -0,0 +1,24 @@
+package emulator
+
+// Returns the position that a lightgun pointing at the VRAM position `x`,
+// `y` reports: the time since the HSYNC in GUNCON_CLOCK_HZ ticks and the
+// scanline. The position depends on the display range, like on a real TV.
+// Returns false if the position isn't in the displayed area
+func (gpu *GPU) LightgunPosition(x, y int) (uint16, uint16, bool) {
+	area := gpu.DisplayArea()
+	if area.Empty() || x < area.Min.X || y < area.Min.Y || x >= area.Max.X || y >= area.Max.Y {
+		return 0, 0, false
+	}
+
+	// GPU clock ticks since the HSYNC, one pixel lasts a dot clock
+	ticks := float32(gpu.DisplayHorizStart) + float32(x-area.Min.X)*float32(gpu.HRes.DotclockDivider())
+	gunX := ticks * GUNCON_CLOCK_HZ / gpu.ClockHz()
+
+	line := y - area.Min.Y
+	if gpu.Interlaced480() {
+		// both fields show the same lines
+		line /= 2
+	}
+	gunY := int(gpu.DisplayLineStart) + line
+	return uint16(gunX), uint16(gunY), true
+}
@@ -0,0 +1,45 @@
+package emulator
+
+import "testing"
+
+func TestGpuLightgun(t *testing.T) {
+	gpu := NewGPU(HARDWARE_NTSC)
+	gun := NewGuncon()
+	gun.SetButtonState(GUNCON_TRIGGER, BUTTON_STATE_PRESSED)
+	gun.SetButtonState(BUTTON_TRIANGLE, BUTTON_STATE_PRESSED)
+
+	area := gpu.DisplayArea()
+	gun.Aim(gpu, area.Min.X, area.Min.Y+10)
+	x, y, _ := gpu.LightgunPosition(area.Min.X, area.Min.Y+10)
+
+	pad := &Gamepad{Profile: gun}
+	pad.Select()
+	expected := []uint8{
+		0xff, 0x63, 0x5a, 0xff, 0xdf,
+		uint8(x), uint8(x >> 8), uint8(y), uint8(y >> 8),
+	}
+	commands := []uint8{0x01, 0x42, 0, 0, 0, 0, 0, 0, 0}
+	for i, cmd := range commands {
+		resp, dsr := pad.SendCommand(cmd)
+		if resp != expected[i] {
+			t.Errorf("byte %d: expected 0x%02x, got 0x%02x", i, expected[i], resp)
+		}
+		if dsr != (i < len(commands)-1) {
+			t.Errorf("byte %d: unexpected DSR %v", i, dsr)
+		}
+	}
+	if y != gpu.DisplayLineStart+10 {
+		t.Errorf("expected line %d, got %d", gpu.DisplayLineStart+10, y)
+	}
+
+	// the position moves right with the X coordinate
+	x2, _, _ := gpu.LightgunPosition(area.Min.X+100, area.Min.Y)
+	if x2 <= x {
+		t.Errorf("expected the X position to grow, got %d then %d", x, x2)
+	}
+
+	gun.Aim(gpu, area.Max.X, area.Min.Y)
+	if gun.X != GUNCON_OFFSCREEN_X || gun.Y != GUNCON_OFFSCREEN_Y {
+		t.Errorf("expected the offscreen position, got %d,%d", gun.X, gun.Y)
+	}
+}
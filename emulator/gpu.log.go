@@ -0,0 +1,209 @@
+package emulator
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// How a GP0 command parameter is decoded in the log
+type GpuParam uint8
+
+const (
+	GPU_PARAM_RAW      GpuParam = iota // Printed as hex
+	GPU_PARAM_COLOR    GpuParam = iota // 24 bit RGB color
+	GPU_PARAM_VERTEX   GpuParam = iota // Signed X,Y position
+	GPU_PARAM_SIZE     GpuParam = iota // Width and height
+	GPU_PARAM_TEXCOORD GpuParam = iota // U,V texture coordinates, the high 16 bits are a palette or page
+)
+
+// Name and parameter layout of a GPU command
+type GpuCommandInfo struct {
+	Name   string
+	Params []GpuParam // Includes the command word
+}
+
+var (
+	gpuMonoTriangle = []GpuParam{GPU_PARAM_COLOR, GPU_PARAM_VERTEX, GPU_PARAM_VERTEX, GPU_PARAM_VERTEX}
+	gpuMonoQuad     = []GpuParam{
+		GPU_PARAM_COLOR, GPU_PARAM_VERTEX, GPU_PARAM_VERTEX, GPU_PARAM_VERTEX, GPU_PARAM_VERTEX,
+	}
+	gpuShadedTriangle = []GpuParam{
+		GPU_PARAM_COLOR, GPU_PARAM_VERTEX, GPU_PARAM_COLOR, GPU_PARAM_VERTEX,
+		GPU_PARAM_COLOR, GPU_PARAM_VERTEX,
+	}
+	gpuShadedQuad = []GpuParam{
+		GPU_PARAM_COLOR, GPU_PARAM_VERTEX, GPU_PARAM_COLOR, GPU_PARAM_VERTEX,
+		GPU_PARAM_COLOR, GPU_PARAM_VERTEX, GPU_PARAM_COLOR, GPU_PARAM_VERTEX,
+	}
+	gpuTexturedQuad = []GpuParam{
+		GPU_PARAM_COLOR, GPU_PARAM_VERTEX, GPU_PARAM_TEXCOORD, GPU_PARAM_VERTEX, GPU_PARAM_TEXCOORD,
+		GPU_PARAM_VERTEX, GPU_PARAM_TEXCOORD, GPU_PARAM_VERTEX, GPU_PARAM_TEXCOORD,
+	}
+	gpuTexturedRect = []GpuParam{GPU_PARAM_COLOR, GPU_PARAM_VERTEX, GPU_PARAM_TEXCOORD, GPU_PARAM_SIZE}
+	gpuImageCopy    = []GpuParam{GPU_PARAM_RAW, GPU_PARAM_VERTEX, GPU_PARAM_SIZE}
+)
+
+// GP0 commands that the GPU implements
+var GP0_COMMANDS = map[uint8]GpuCommandInfo{
+	0x00: {"Nop", nil},
+	0x01: {"Clear Cache", nil},
+	0x02: {"Fill Rectangle", []GpuParam{GPU_PARAM_COLOR, GPU_PARAM_VERTEX, GPU_PARAM_SIZE}},
+	0x20: {"Monochrome Opaque Triangle", gpuMonoTriangle},
+	0x28: {"Monochrome Opaque Quadrilateral", gpuMonoQuad},
+	0x2c: {"Textured Blended Opaque Quadrilateral", gpuTexturedQuad},
+	0x2d: {"Textured Raw Opaque Quadrilateral", gpuTexturedQuad},
+	0x2f: {"Textured Raw Semi-Transparent Quadrilateral", gpuTexturedQuad},
+	0x30: {"Shaded Opaque Triangle", gpuShadedTriangle},
+	0x38: {"Shaded Opaque Quadrilateral", gpuShadedQuad},
+	0x64: {"Textured Blended Opaque Rectangle", gpuTexturedRect},
+	0x65: {"Textured Raw Opaque Rectangle", gpuTexturedRect},
+	0xa0: {"Image Load", gpuImageCopy},
+	0xc0: {"Image Store", gpuImageCopy},
+	0xe1: {"Draw Mode", nil},
+	0xe2: {"Texture Window", nil},
+	0xe3: {"Drawing Area Top Left", nil},
+	0xe4: {"Drawing Area Bottom Right", nil},
+	0xe5: {"Drawing Offset", nil},
+	0xe6: {"Mask Bit Setting", nil},
+}
+
+// GP1 commands that the GPU implements
+var GP1_COMMANDS = map[uint8]string{
+	0x00: "Reset",
+	0x01: "Reset Command Buffer",
+	0x02: "Acknowledge Interrupt",
+	0x03: "Display Enable",
+	0x04: "DMA Direction",
+	0x05: "Display VRAM Start",
+	0x06: "Horizontal Display Range",
+	0x07: "Vertical Display Range",
+	0x08: "Display Mode",
+	0x10: "Get GPU Info",
+}
+
+// A GP0 or GP1 command with all of its parameters
+type GpuCommand struct {
+	Port      int      // 0 for GP0, 1 for GP1
+	Words     []uint32 // The command word and the parameters
+	DataWords uint32   // Amount of image data words sent after an image load
+}
+
+// Returns the name of the command
+func (cmd *GpuCommand) Name() string {
+	opcode := uint8(cmd.Words[0] >> 24)
+	if cmd.Port == 1 {
+		if name, ok := GP1_COMMANDS[opcode]; ok {
+			return name
+		}
+	} else if info, ok := GP0_COMMANDS[opcode]; ok {
+		return info.Name
+	}
+	return "Unknown"
+}
+
+// Returns the command with its name and decoded parameters
+func (cmd *GpuCommand) String() string {
+	opcode := uint8(cmd.Words[0] >> 24)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "GP%d(0x%02x) %s", cmd.Port, opcode, cmd.Name())
+
+	var params []GpuParam
+	if info, ok := GP0_COMMANDS[opcode]; ok && cmd.Port == 0 {
+		params = info.Params
+	}
+
+	for i, word := range cmd.Words {
+		param := GPU_PARAM_RAW
+		if i < len(params) {
+			param = params[i]
+		}
+		if i == 0 && param == GPU_PARAM_RAW {
+			// only the low 24 bits are parameters
+			fmt.Fprintf(&sb, " 0x%06x", word&0xffffff)
+			continue
+		}
+
+		switch param {
+		case GPU_PARAM_COLOR:
+			fmt.Fprintf(&sb, " rgb(%d,%d,%d)", uint8(word), uint8(word>>8), uint8(word>>16))
+		case GPU_PARAM_VERTEX:
+			fmt.Fprintf(&sb, " xy(%d,%d)", int16(word), int16(word>>16))
+		case GPU_PARAM_SIZE:
+			fmt.Fprintf(&sb, " size(%d,%d)", uint16(word), uint16(word>>16))
+		case GPU_PARAM_TEXCOORD:
+			fmt.Fprintf(&sb, " uv(%d,%d):0x%04x", uint8(word), uint8(word>>8), uint16(word>>16))
+		default:
+			fmt.Fprintf(&sb, " 0x%08x", word)
+		}
+	}
+
+	if cmd.DataWords > 0 {
+		fmt.Fprintf(&sb, " [%d data words]", cmd.DataWords)
+	}
+	return sb.String()
+}
+
+// Records every GP0 and GP1 command of a frame
+type GpuLogger struct {
+	Frame    uint64       // Number of the frame being recorded
+	Commands []GpuCommand // Commands of the frame being recorded
+	// Commands of the last finished frame
+	LastFrame    uint64
+	LastCommands []GpuCommand
+	mu           sync.Mutex
+}
+
+// Returns a new GPU command logger
+func NewGpuLogger() *GpuLogger {
+	return &GpuLogger{}
+}
+
+// Records a command. `words` is copied
+func (logger *GpuLogger) Log(port int, words []uint32) {
+	logger.Commands = append(logger.Commands, GpuCommand{
+		Port:  port,
+		Words: append([]uint32(nil), words...),
+	})
+}
+
+// Counts an image data word for the last command
+func (logger *GpuLogger) LogData() {
+	if len(logger.Commands) > 0 {
+		logger.Commands[len(logger.Commands)-1].DataWords++
+	}
+}
+
+// Finishes the current frame and starts recording the next one
+func (logger *GpuLogger) EndFrame() {
+	logger.mu.Lock()
+	logger.LastFrame = logger.Frame
+	logger.LastCommands = logger.Commands
+	logger.mu.Unlock()
+
+	logger.Frame++
+	logger.Commands = nil
+}
+
+// Returns the commands of the last finished frame and its number. Can be
+// called from another goroutine
+func (logger *GpuLogger) Last() ([]GpuCommand, uint64) {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	return logger.LastCommands, logger.LastFrame
+}
+
+// Writes the commands of the last finished frame to `w`, one per line
+func (logger *GpuLogger) Dump(w io.Writer) error {
+	commands, frame := logger.Last()
+	if _, err := fmt.Fprintf(w, "frame %d: %d commands\n", frame, len(commands)); err != nil {
+		return err
+	}
+	for i := range commands {
+		if _, err := fmt.Fprintln(w, commands[i].String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package emulator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGpuCommandString(t *testing.T) {
+	for _, c := range []struct {
+		cmd      GpuCommand
+		expected string
+	}{
+		{
+			GpuCommand{Port: 0, Words: []uint32{0x20ff8040, 0x0010fff0, 0x00f00020, 0x00400100}},
+			"GP0(0x20) Monochrome Opaque Triangle rgb(64,128,255) xy(-16,16) xy(32,240) xy(256,64)",
+		},
+		{
+			GpuCommand{Port: 0, Words: []uint32{0x64808080, 0x00200010, 0x78000402, 0x00100008}},
+			"GP0(0x64) Textured Blended Opaque Rectangle rgb(128,128,128) xy(16,32) uv(2,4):0x7800 size(8,16)",
+		},
+		{
+			GpuCommand{Port: 0, Words: []uint32{0xa0000000, 0x00000000, 0x00010002}, DataWords: 1},
+			"GP0(0xa0) Image Load 0x000000 xy(0,0) size(2,1) [1 data words]",
+		},
+		{GpuCommand{Port: 0, Words: []uint32{0xe1000205}}, "GP0(0xe1) Draw Mode 0x000205"},
+		{GpuCommand{Port: 1, Words: []uint32{0x03000001}}, "GP1(0x03) Display Enable 0x000001"},
+		{GpuCommand{Port: 0, Words: []uint32{0x1f000000}}, "GP0(0x1f) Unknown 0x000000"},
+	} {
+		if got := c.cmd.String(); got != c.expected {
+			t.Errorf("expected %q, got %q", c.expected, got)
+		}
+	}
+}
+
+// The logger records whole commands with their image data and hands them
+// over at the end of the frame
+func TestGpuLogger(t *testing.T) {
+	gpu := NewGPU(HARDWARE_NTSC)
+	gpu.Logger = NewGpuLogger()
+	th, irqState, timers := NewTimeHandler(), NewIrqState(), NewTimers()
+
+	gpu.GP0(0xe1000205)
+	for _, word := range []uint32{0xa0000000, 0, 1<<16 | 4, 0x7fff7fff, 0x7fff7fff} {
+		gpu.GP0(word)
+	}
+	gpu.GP0(0x20ff8040)
+	gpu.GP0(0x00100010) // the triangle isn't finished
+	gpu.GP1(0x03000000, th, irqState, timers)
+
+	commands := gpu.Logger.Commands
+	if len(commands) != 3 {
+		t.Fatalf("expected 3 commands, got %d", len(commands))
+	}
+	if commands[1].Name() != "Image Load" || len(commands[1].Words) != 3 || commands[1].DataWords != 2 {
+		t.Errorf("expected an image load with 2 data words, got %s", commands[1].String())
+	}
+	if commands[2].Port != 1 {
+		t.Errorf("expected a GP1 command, got %s", commands[2].String())
+	}
+
+	gpu.Logger.EndFrame()
+	if last, frame := gpu.Logger.Last(); len(last) != 3 || frame != 0 {
+		t.Fatalf("expected the 3 commands of frame 0, got %d of frame %d", len(last), frame)
+	}
+	gpu.GP0(0x00100010)
+	gpu.GP0(0x00400100) // finishes the triangle in the next frame
+	if len(gpu.Logger.Commands) != 1 || gpu.Logger.Frame != 1 {
+		t.Fatalf("expected the triangle in frame 1, got %d commands", len(gpu.Logger.Commands))
+	}
+
+	var sb strings.Builder
+	if err := gpu.Logger.Dump(&sb); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(sb.String()), "\n")
+	if len(lines) != 4 || lines[0] != "frame 0: 3 commands" || !strings.HasPrefix(lines[3], "GP1(0x03)") {
+		t.Errorf("unexpected dump:\n%s", sb.String())
+	}
+}
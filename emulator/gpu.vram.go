@@ -0,0 +1,197 @@
+package emulator
+
+import (
+	"image"
+	"image/color"
+)
+
+// Copy of the GPU VRAM. Image loads and fills are written to it, primitives
+// are only drawn by the renderer so they don't show up here. Used to look
+// at textures and palettes
+type VRam struct {
+	Pixels [VRAM_SIZE_PIXELS]uint16 // 15 bit pixels, bit 15 is the mask bit
+}
+
+// Bit 15 of a VRAM pixel, used like a stencil by GP0(0xE6)
+const VRAM_MASK_BIT = 0x8000
+
+// Returns a new VRAM instance filled with zeros
+func NewVRam() *VRam {
+	return &VRam{}
+}
+
+// Returns the halfword at `x`,`y`. Coordinates wrap around
+func (vram *VRam) Get(x, y uint16) uint16 {
+	x &= VRAM_WIDTH_PIXELS - 1
+	y &= VRAM_HEIGHT_PIXELS - 1
+	return vram.Pixels[uint32(y)*VRAM_WIDTH_PIXELS+uint32(x)]
+}
+
+// Sets the halfword at `x`,`y`. Coordinates wrap around
+func (vram *VRam) Set(x, y, val uint16) {
+	x &= VRAM_WIDTH_PIXELS - 1
+	y &= VRAM_HEIGHT_PIXELS - 1
+	vram.Pixels[uint32(y)*VRAM_WIDTH_PIXELS+uint32(x)] = val
+}
+
+// Writes a pixel with the GP0(0xE6) mask settings. If `checkMask` is true,
+// pixels with the mask bit set are left alone. If `setMask` is true, the
+// mask bit of the new pixel is forced to 1. Returns false if the pixel was
+// masked
+func (vram *VRam) Draw(x, y, val uint16, setMask, checkMask bool) bool {
+	if checkMask && vram.Get(x, y)&VRAM_MASK_BIT != 0 {
+		return false
+	}
+	if setMask {
+		val |= VRAM_MASK_BIT
+	}
+	vram.Set(x, y, val)
+	return true
+}
+
+// Copies a finished GP0(0xA0) image load into VRAM with the mask settings,
+// see Draw
+func (vram *VRam) StoreImage(buf *ImageBuffer, setMask, checkMask bool) {
+	i := 0
+	for y := uint16(0); y < buf.Resolution.Y; y++ {
+		for x := uint16(0); x < buf.Resolution.X; x++ {
+			vram.Draw(buf.Position.X+x, buf.Position.Y+y, buf.Buffer[i], setMask, checkMask)
+			i++
+		}
+	}
+}
+
+// Returns the mask bits of every pixel, indexed like Pixels. See
+// RasterizeMasked
+func (vram *VRam) MaskPlane() []bool {
+	mask := make([]bool, VRAM_SIZE_PIXELS)
+	for i, val := range vram.Pixels {
+		mask[i] = val&VRAM_MASK_BIT != 0
+	}
+	return mask
+}
+
+// Fills a rectangle with `clr` like GP0(0x02). The X coordinate and the
+// width are in 16 pixel steps. Fills ignore the mask settings and clear the
+// mask bit
+func (vram *VRam) Fill(topLeft, size Vec2, clr color.RGBA) {
+	x0 := uint16(topLeft.X) & 0x3f0
+	y0 := uint16(topLeft.Y) & 0x1ff
+	width := (uint16(size.X) + 0xf) & 0x7f0
+	height := uint16(size.Y) & 0x1ff
+	val := Color24To15(clr)
+
+	for y := uint16(0); y < height; y++ {
+		for x := uint16(0); x < width; x++ {
+			vram.Set(x0+x, y0+y, val)
+		}
+	}
+}
+
+// Offsets added to the 8 bit color components before they're truncated to
+// 5 bits, indexed by the low 2 bits of the pixel Y and X coordinates
+var DITHER_MATRIX = [4][4]int{
+	{-4, +0, -3, +1},
+	{+2, -2, +3, -1},
+	{-3, +1, -4, +0},
+	{+3, -1, +2, -2},
+}
+
+// Converts a 24 bit color to 15 bits with the dither pattern of the pixel
+// at `x`,`y`, the mask bit is 0
+func Color24To15Dithered(clr color.RGBA, x, y int) uint16 {
+	offset := DITHER_MATRIX[y&3][x&3]
+	dither := func(c uint8) uint16 {
+		v := int(c) + offset
+		if v < 0 {
+			v = 0
+		} else if v > 0xff {
+			v = 0xff
+		}
+		return uint16(v >> 3)
+	}
+	return dither(clr.R) | dither(clr.G)<<5 | dither(clr.B)<<10
+}
+
+// Converts a 24 bit color to 15 bits, the mask bit is 0
+func Color24To15(clr color.RGBA) uint16 {
+	return uint16(clr.R>>3) | uint16(clr.G>>3)<<5 | uint16(clr.B>>3)<<10
+}
+
+// Converts a 15 bit VRAM pixel to a 24 bit color
+func Color15ToRGBA(val uint16) color.RGBA {
+	r := uint8(val & 0x1f)
+	g := uint8((val >> 5) & 0x1f)
+	b := uint8((val >> 10) & 0x1f)
+	return color.RGBA{r<<3 | r>>2, g<<3 | g>>2, b<<3 | b>>2, 255}
+}
+
+// Returns the whole VRAM as an image, every halfword is a 15 bit pixel
+func (vram *VRam) Image() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, VRAM_WIDTH_PIXELS, VRAM_HEIGHT_PIXELS))
+	for i, val := range vram.Pixels {
+		clr := Color15ToRGBA(val)
+		img.Pix[i*4+0] = clr.R
+		img.Pix[i*4+1] = clr.G
+		img.Pix[i*4+2] = clr.B
+		img.Pix[i*4+3] = clr.A
+	}
+	return img
+}
+
+// Returns the 16 (4 bit textures) or 256 (8 bit textures) colors of the
+// palette at `clutX`,`clutY`
+func (vram *VRam) Clut(clutX, clutY uint16, depth TextureDepth) []color.RGBA {
+	entries := uint16(16)
+	if depth == TEXTURE_DEPTH_8BIT {
+		entries = 256
+	}
+
+	clut := make([]color.RGBA, entries)
+	for i := range clut {
+		clut[i] = Color15ToRGBA(vram.Get(clutX+uint16(i), clutY))
+	}
+	return clut
+}
+
+// Returns the palette as an image with 16 colors per line
+func (vram *VRam) ClutImage(clutX, clutY uint16, depth TextureDepth) *image.RGBA {
+	clut := vram.Clut(clutX, clutY, depth)
+	img := image.NewRGBA(image.Rect(0, 0, 16, len(clut)/16))
+	for i, clr := range clut {
+		img.SetRGBA(i%16, i/16, clr)
+	}
+	return img
+}
+
+// Returns the 256x256 texture page at `pageX`,`pageY` (in 64x256 halfword
+// steps, as in GP0(0xE1)). 4 and 8 bit pages are decoded with the palette
+// at `clutX`,`clutY`
+func (vram *VRam) TexturePage(pageX, pageY uint8, depth TextureDepth, clutX, clutY uint16) *image.RGBA {
+	baseX := uint16(pageX) * 64
+	baseY := uint16(pageY) * 256
+
+	var clut []color.RGBA
+	if depth != TEXTURE_DEPTH_15BIT {
+		clut = vram.Clut(clutX, clutY, depth)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	for v := uint16(0); v < 256; v++ {
+		for u := uint16(0); u < 256; u++ {
+			var clr color.RGBA
+			switch depth {
+			case TEXTURE_DEPTH_4BIT:
+				texel := vram.Get(baseX+u/4, baseY+v)
+				clr = clut[(texel>>((u%4)*4))&0xf]
+			case TEXTURE_DEPTH_8BIT:
+				texel := vram.Get(baseX+u/2, baseY+v)
+				clr = clut[(texel>>((u%2)*8))&0xff]
+			default:
+				clr = Color15ToRGBA(vram.Get(baseX+u, baseY+v))
+			}
+			img.SetRGBA(int(u), int(v), clr)
+		}
+	}
+	return img
+}
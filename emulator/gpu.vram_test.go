@@ -0,0 +1,76 @@
+package emulator
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestVRamColors(t *testing.T) {
+	for _, c := range []struct {
+		val uint16
+		clr color.RGBA
+	}{
+		{0x0000, color.RGBA{0, 0, 0, 255}},
+		{0x001f, color.RGBA{255, 0, 0, 255}},
+		{0x03e0, color.RGBA{0, 255, 0, 255}},
+		{0xfc00, color.RGBA{0, 0, 255, 255}}, // the mask bit isn't shown
+		{0x4210, color.RGBA{132, 132, 132, 255}},
+	} {
+		if clr := Color15ToRGBA(c.val); clr != c.clr {
+			t.Errorf("0x%04x: expected %v, got %v", c.val, c.clr, clr)
+		}
+		if val := Color24To15(c.clr); val != c.val&^VRAM_MASK_BIT {
+			t.Errorf("%v: expected 0x%04x, got 0x%04x", c.clr, c.val&^VRAM_MASK_BIT, val)
+		}
+	}
+
+	vram := NewVRam()
+	vram.Set(VRAM_WIDTH_PIXELS-1, VRAM_HEIGHT_PIXELS-1, 0x001f)
+	img := vram.Image()
+	if img.Bounds().Dx() != VRAM_WIDTH_PIXELS || img.Bounds().Dy() != VRAM_HEIGHT_PIXELS {
+		t.Fatalf("expected the whole VRAM, got %v", img.Bounds())
+	}
+	if clr := img.RGBAAt(VRAM_WIDTH_PIXELS-1, VRAM_HEIGHT_PIXELS-1); clr.R != 255 {
+		t.Errorf("expected the last pixel to be red, got %v", clr)
+	}
+}
+
+// 4 and 8 bit texture pages are decoded through the palette, 15 bit pages
+// are shown as they are
+func TestVRamTexturePage(t *testing.T) {
+	vram := NewVRam()
+	red, green := uint16(0x001f), uint16(0x03e0)
+
+	// palettes at 0,480: 16 colors, entry 1 is red and entry 0x21 is green
+	vram.Set(1, 480, red)
+	vram.Set(0x21, 480, green)
+	if clut := vram.ClutImage(0, 480, TEXTURE_DEPTH_4BIT); clut.Bounds().Dy() != 1 || clut.RGBAAt(1, 0).R != 255 {
+		t.Errorf("expected a line of 16 colors with a red entry 1, got %v", clut.Bounds())
+	}
+	if clut := vram.ClutImage(0, 480, TEXTURE_DEPTH_8BIT); clut.Bounds().Dy() != 16 || clut.RGBAAt(1, 2).G != 255 {
+		t.Errorf("expected 16 lines of 16 colors with a green entry 0x21, got %v", clut.Bounds())
+	}
+
+	// page 1,0 starts at 64,0, the first texel of the second halfword
+	vram.Set(64+1, 0, 0x0001)
+	vram.Set(64+1, 1, 0x0021)
+	vram.Set(64+2, 2, 0x001f)
+
+	page := vram.TexturePage(1, 0, TEXTURE_DEPTH_4BIT, 0, 480)
+	if clr := page.RGBAAt(4, 0); clr.R != 255 {
+		t.Errorf("4 bit: expected texel 4,0 to be red, got %v", clr)
+	}
+	if clr := page.RGBAAt(5, 0); clr.R != 0 {
+		t.Errorf("4 bit: expected texel 5,0 to use entry 0, got %v", clr)
+	}
+
+	page = vram.TexturePage(1, 0, TEXTURE_DEPTH_8BIT, 0, 480)
+	if clr := page.RGBAAt(2, 1); clr.G != 255 {
+		t.Errorf("8 bit: expected texel 2,1 to be green, got %v", clr)
+	}
+
+	page = vram.TexturePage(1, 0, TEXTURE_DEPTH_15BIT, 0, 0)
+	if clr := page.RGBAAt(2, 2); clr.R != 255 {
+		t.Errorf("15 bit: expected texel 2,2 to be red, got %v", clr)
+	}
+}
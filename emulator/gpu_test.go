@@ -0,0 +1,348 @@
+package emulator
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/zeozeozeo/gopsx/emulator/gte"
+)
+
+// Sends monochrome triangles, the vertices are dropped every frame
+func BenchmarkGpuGP0Triangle(b *testing.B) {
+	gpu := NewGPU(HARDWARE_NTSC)
+	gpu.GP0(0xe3000000) // drawing area top left
+	gpu.GP0(0xe407fc00 | 1023)
+
+	for i := 0; i < b.N; i++ {
+		gpu.GP0(0x20ff8040)
+		gpu.GP0(0x00100010)
+		gpu.GP0(0x00f00020)
+		gpu.GP0(0x00400100)
+
+		if i%4096 == 0 {
+			gpu.DrawData.VtxBuffer = gpu.DrawData.VtxBuffer[:0]
+		}
+	}
+}
+
+// Decodes draw mode and drawing offset commands, which don't draw anything
+func BenchmarkGpuGP0Environment(b *testing.B) {
+	gpu := NewGPU(HARDWARE_NTSC)
+
+	for i := 0; i < b.N; i++ {
+		gpu.GP0(0xe1000200 | uint32(i)&0x7f)
+		gpu.GP0(0xe5000000 | uint32(i)&0x3fffff)
+	}
+}
+
+// Every frame of a 480i game is shown in the other field
+func TestGpuInterlacedFields(t *testing.T) {
+	inter := newBenchInterconnect()
+	th := NewTimeHandler()
+	gpu := inter.Gpu
+	gpu.FrameQueue = NewFrameQueue()
+	gpu.GP1DisplayMode(0x24, th, inter.IrqState) // 480 lines, interlaced
+
+	var parities []uint16
+	for i := 0; i < 3000000 && len(parities) < 4; i += 1000 {
+		gpu.DrawData.PushVertices(Vertex{})
+		th.Tick(1000)
+		gpu.Sync(th, inter.IrqState)
+
+		if frame := gpu.FrameQueue.Pop(); frame != nil {
+			if !frame.Interlaced {
+				t.Fatal("expected an interlaced frame")
+			}
+			parities = append(parities, frame.FieldParity)
+			gpu.FrameQueue.Release(frame)
+		}
+	}
+
+	if len(parities) < 4 {
+		t.Fatalf("expected 4 frames, got %d", len(parities))
+	}
+	for i := 1; i < len(parities); i++ {
+		if parities[i] == parities[i-1] {
+			t.Fatalf("expected the fields to alternate, got %v", parities)
+		}
+	}
+}
+
+func TestGpuPalTimings(t *testing.T) {
+	inter := newBenchInterconnect()
+	th := NewTimeHandler()
+	gpu := NewGPU(HARDWARE_PAL)
+	gpu.GP1DisplayMode(0x08, th, inter.IrqState) // PAL, 240 lines
+
+	if rate := gpu.RefreshRate(); rate < 49.7 || rate > 49.8 {
+		t.Fatalf("expected a 49.76Hz refresh rate, got %f", rate)
+	}
+
+	var maxLine uint16
+	for i := uint32(0); i < CPU_FREQ_HZ; i += 1000 {
+		th.Tick(1000)
+		gpu.Sync(th, inter.IrqState)
+		if gpu.DisplayLine > maxLine {
+			maxLine = gpu.DisplayLine
+		}
+	}
+
+	if maxLine != 313 {
+		t.Errorf("expected 314 lines per frame, the last line was %d", maxLine)
+	}
+	if gpu.Frames < 49 || gpu.Frames > 50 {
+		t.Errorf("expected 50 frames in a second, got %d", gpu.Frames)
+	}
+}
+
+// Textured primitives carry their texture coordinates, palette and page
+func TestGpuPrimitiveAttributes(t *testing.T) {
+	gpu := NewGPU(HARDWARE_NTSC)
+
+	// semi-transparent raw textured quad, 8 bit page at (128, 256) in mode 1
+	page := uint32(2 | 1<<4 | 1<<5 | 1<<7)
+	clut := uint32(3 | 10<<6)
+	for _, word := range []uint32{
+		0x2f808080,
+		0x00000000, clut<<16 | 0x0000,
+		0x00000010, page<<16 | 0x0010,
+		0x00100000, 0x1000,
+		0x00100010, 0x1010,
+	} {
+		gpu.GP0(word)
+	}
+
+	vertices := gpu.DrawData.VtxBuffer
+	if len(vertices) != 6 {
+		t.Fatalf("expected 6 vertices, got %d", len(vertices))
+	}
+	vtx := vertices[5] // bottom right corner
+	if !vtx.Textured || !vtx.RawTexture || !vtx.SemiTransparent || vtx.Type != PRIMITIVE_POLYGON {
+		t.Errorf("unexpected attributes %+v", vtx.PrimitiveAttributes)
+	}
+	if vtx.UV != (Vec2U{0x10, 0x10}) {
+		t.Errorf("expected UV (16, 16), got %v", vtx.UV)
+	}
+	if pos := vtx.TexPagePosition(); pos != (Vec2U{128, 256}) || vtx.TextureDepth() != TEXTURE_DEPTH_8BIT || vtx.SemiTransparency() != 1 {
+		t.Errorf("unexpected texture page 0x%x", vtx.TexPage)
+	}
+	if pos := vtx.ClutPosition(); pos != (Vec2U{48, 10}) {
+		t.Errorf("expected the palette at (48, 10), got %v", pos)
+	}
+	if gpu.PageBaseX != 2 || gpu.TextureDepth != TEXTURE_DEPTH_8BIT {
+		t.Error("expected the polygon to set the draw mode texture page")
+	}
+
+	// X flipped textured rectangle, the texture page comes from the draw mode
+	gpu.DrawData.VtxBuffer = nil
+	gpu.GP0(0xe1001000)
+	gpu.GP0(0x64808080)
+	gpu.GP0(0x00200020)
+	gpu.GP0(clut<<16 | 0x0840)
+	gpu.GP0(0x00080010)
+	vertices = gpu.DrawData.VtxBuffer
+	if len(vertices) != 6 || vertices[0].Type != PRIMITIVE_RECTANGLE || vertices[0].SemiTransparent {
+		t.Fatalf("unexpected rectangle %+v", vertices)
+	}
+	if vertices[0].UV != (Vec2U{0x40, 0x08}) || vertices[1].UV != (Vec2U{0x30, 0x08}) {
+		t.Errorf("expected a mirrored texture, got %v and %v", vertices[0].UV, vertices[1].UV)
+	}
+	if vertices[0].TexPage != 0 || vertices[0].Clut != uint16(clut) {
+		t.Errorf("unexpected texture page 0x%x and palette 0x%x", vertices[0].TexPage, vertices[0].Clut)
+	}
+
+	// untextured primitives have no texture
+	gpu.GP0(0x20ff0000)
+	gpu.GP0(0)
+	gpu.GP0(0x10)
+	gpu.GP0(0x100000)
+	if vtx := gpu.DrawData.VtxBuffer[6]; vtx.Textured || vtx.Type != PRIMITIVE_POLYGON {
+		t.Errorf("unexpected attributes %+v", vtx.PrimitiveAttributes)
+	}
+}
+
+// Image loads and primitives leave the pixels with the mask bit alone when
+// GP0(0xE6) asks for it
+func TestGpuMaskBit(t *testing.T) {
+	gpu := NewGPU(HARDWARE_NTSC)
+	load := func(x, y uint32, pixels ...uint32) {
+		gpu.GP0(0xa0000000)
+		gpu.GP0(y<<16 | x)
+		gpu.GP0(1<<16 | uint32(len(pixels)))
+		for i := 0; i < len(pixels); i += 2 {
+			word := pixels[i]
+			if i+1 < len(pixels) {
+				word |= pixels[i+1] << 16
+			}
+			gpu.GP0(word)
+		}
+	}
+
+	gpu.GP0(0xe6000001) // set the mask bit
+	load(0, 0, 0x001f, 0x03e0)
+	if val := gpu.VRam.Get(0, 0); val != VRAM_MASK_BIT|0x001f {
+		t.Errorf("expected the mask bit to be set, got 0x%04x", val)
+	}
+
+	gpu.GP0(0xe6000002) // check the mask bit
+	load(1, 0, 0x7c00, 0x7c00)
+	if val := gpu.VRam.Get(1, 0); val != VRAM_MASK_BIT|0x03e0 {
+		t.Errorf("expected the masked pixel to be kept, got 0x%04x", val)
+	}
+	if val := gpu.VRam.Get(2, 0); val != 0x7c00 {
+		t.Errorf("expected the unmasked pixel to be written, got 0x%04x", val)
+	}
+
+	// fills ignore the mask
+	gpu.GP0(0x02000000)
+	gpu.GP0(0)
+	gpu.GP0(1<<16 | 16)
+	if val := gpu.VRam.Get(0, 0); val != 0 {
+		t.Errorf("expected the fill to clear the pixel, got 0x%04x", val)
+	}
+
+	// a red triangle with the mask bit set, then a green one that checks it
+	gpu.DrawData.VtxBuffer = nil
+	gpu.GP0(0xe3000000)
+	gpu.GP0(0xe4000000 | 63<<10 | 63)
+	for _, cmd := range [][]uint32{
+		{0xe6000001, 0x200000ff, 0x00000000, 0x00000020, 0x00200000},
+		{0xe6000002, 0x2000ff00, 0x00000000, 0x00000040, 0x00400000},
+	} {
+		for _, word := range cmd {
+			gpu.GP0(word)
+		}
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	RasterizeMasked(img, make([]bool, 64*64), gpu.DrawData.VtxBuffer, NewVec2(0, 0))
+	if clr := img.RGBAAt(4, 4); clr.R != 255 || clr.G != 0 {
+		t.Errorf("expected the masked red pixel to stay, got %v", clr)
+	}
+	if clr := img.RGBAAt(40, 4); clr.G != 255 {
+		t.Errorf("expected a green pixel outside the mask, got %v", clr)
+	}
+}
+
+// GP1(0x10) puts the drawing environment in GPUREAD
+func TestGpuGetInfo(t *testing.T) {
+	inter := newBenchInterconnect()
+	th := NewTimeHandler()
+	gpu := inter.Gpu
+
+	for _, word := range []uint32{0xe2012345, 0xe3004010, 0xe4077e7f, 0xe53ff801} {
+		gpu.GP0(word)
+	}
+	for _, test := range []struct{ info, expected uint32 }{
+		{0x02, 0x012345},
+		{0x03, 0x004010},
+		{0x04, 0x077e7f},
+		{0x05, 0x3ff801},
+		{0x06, 0x3ff801}, // nothing, GPUREAD keeps the last value
+		{0x07, 2},
+		{0xf3, 0x004010}, // only the low 4 bits matter
+	} {
+		gpu.GP1(0x10000000|test.info, th, inter.IrqState, inter.Timers)
+		if val := gpu.Read(); val != test.expected {
+			t.Errorf("info 0x%x: expected 0x%x, got 0x%x", test.info, test.expected, val)
+		}
+	}
+
+	// GP1(0x11-0x1f) are mirrors
+	gpu.GP1(0x1f000007, th, inter.IrqState, inter.Timers)
+	if val := gpu.Read(); val != 2 {
+		t.Errorf("expected the GPU version from a mirror, got 0x%x", val)
+	}
+}
+
+// The ready bits of GPUSTAT follow the commands and the VRAM transfers
+func TestGpuStatusReadyBits(t *testing.T) {
+	gpu := NewGPU(HARDWARE_NTSC)
+	const ready = 1<<26 | 1<<28
+	expect := func(what string, bits uint32) {
+		t.Helper()
+		if status := gpu.Status() & (7 << 26); status != bits {
+			t.Errorf("%s: expected bits 0x%x, got 0x%x", what, bits, status)
+		}
+	}
+
+	expect("idle", ready)
+	gpu.GP0(0x20ff0000)
+	expect("command being received", 1<<28)
+	gpu.GP0(0)
+	gpu.GP0(0x10)
+	gpu.GP0(0x100000)
+	expect("command done", ready)
+
+	// load 2x1 pixels and read them back
+	gpu.GP0(0xa0000000)
+	gpu.GP0(0x00050004)
+	gpu.GP0(0x00010002)
+	expect("image load", 1<<28)
+	gpu.GP0(0x43211234)
+	expect("image loaded", ready)
+
+	gpu.GP0(0xc0000000)
+	gpu.GP0(0x00050004)
+	gpu.GP0(0x00010002)
+	expect("image store", 1<<26|1<<27)
+	if val := gpu.Read(); val != 0x43211234 {
+		t.Errorf("expected the loaded pixels, got 0x%x", val)
+	}
+	expect("image stored", ready)
+	if val := gpu.Read(); val != 0x43211234 {
+		t.Errorf("expected GPUREAD to keep its value, got 0x%x", val)
+	}
+}
+
+// GPUSTAT bit 31 changes every line, or every field in 480i
+func TestGpuStatusOddLine(t *testing.T) {
+	gpu := NewGPU(HARDWARE_NTSC)
+	oddLines := func() (odd [2]uint32) {
+		for i := range odd {
+			gpu.DisplayLine = gpu.DisplayLineStart + 0x20 + uint16(i)
+			odd[i] = gpu.Status() >> 31
+		}
+		return odd
+	}
+
+	if odd := oddLines(); odd[0] == odd[1] {
+		t.Errorf("expected the bit to toggle every line, got %v", odd)
+	}
+	gpu.VRes, gpu.Interlaced = VRES_480_LINES, true
+	if odd := oddLines(); odd[0] != odd[1] {
+		t.Errorf("expected the bit to stay during a 480i field, got %v", odd)
+	}
+	gpu.DisplayLine = 0 // vertical blanking
+	if gpu.Status()>>31 != 0 {
+		t.Error("expected bit 31 to be clear in the vertical blanking")
+	}
+}
+
+// With PGXP, the GPU finds the precise coordinates of the vertices
+// projected by the GTE
+func TestGpuPgxp(t *testing.T) {
+	inter := newBenchInterconnect()
+	inter.SetPgxp(true)
+	g := inter.Gte
+	for i := 0; i < 3; i++ {
+		g.Matrices[gte.MATRIX_ROTATION][i][i] = 0x1000
+	}
+	g.H = 1000
+	g.V[0] = [3]int16{101, 50, 300}
+	g.DoRTP(gte.CommandConfigFromCommand(1<<19), 0)
+
+	xy := g.XyFifo[2]
+	vertex := inter.Gpu.PolygonVertex(gte.VertexCacheKey(xy[0], xy[1]), color.RGBA{})
+	if !vertex.HasPrecise {
+		t.Fatal("expected the GPU to find the precise vertex")
+	}
+	if vertex.Precise.X <= float32(xy[0]) || vertex.Precise.X >= float32(xy[0]+1) {
+		t.Errorf("expected a sub-pixel X coordinate after %d, got %f", xy[0], vertex.Precise.X)
+	}
+
+	// a vertex that wasn't projected by the GTE
+	if vertex := inter.Gpu.PolygonVertex(0x00100010, color.RGBA{}); vertex.HasPrecise {
+		t.Error("expected no precise coordinates for a 2D vertex")
+	}
+}
@@ -1,4 +1,4 @@
-package emulator
+package gte
 
 // Unsigned Newtown-Raphson lookup table
 var UNR_TABLE = []uint8{
@@ -38,7 +38,7 @@ var UNR_TABLE = []uint8{
 }
 
 // Newton–Raphson division
-func GTEDivide(numerator, divisor uint16) uint32 {
+func Divide(numerator, divisor uint16) uint32 {
 	shift := countLeadingZeroesU16(divisor)
 	n := uint64(numerator) << shift
 	d := divisor << shift
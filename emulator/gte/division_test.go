@@ -0,0 +1,28 @@
+package gte
+
+import "testing"
+
+func TestDivision(t *testing.T) {
+	assert := func(res, want uint32) {
+		if res != want {
+			t.Errorf("got 0x%x, expected 0x%x", res, want)
+		}
+	}
+
+	assert(Divide(0, 1), 0)
+	assert(Divide(0, 1234), 0)
+	assert(Divide(1, 1), 0x10000)
+	assert(Divide(2, 2), 0x10000)
+	assert(Divide(0xffff, 0xffff), 0xffff)
+	assert(Divide(0xffff, 0xfffe), 0x10000)
+	assert(Divide(1, 2), 0x8000)
+	assert(Divide(1, 3), 0x5555)
+	assert(Divide(5, 6), 0xd555)
+	assert(Divide(1, 4), 0x4000)
+	assert(Divide(10, 40), 0x4000)
+	assert(Divide(0xf00, 0xbeef), 0x141d)
+	assert(Divide(9876, 8765), 0x12072)
+	assert(Divide(200, 10000), 0x51f)
+	assert(Divide(0xffff, 0x8000), 0x1fffe)
+	assert(Divide(0xe5d7, 0x72ec), 0x1ffff)
+}
@@ -0,0 +1,7 @@
+// Package gte emulates the Geometry Transformation Engine, the coprocessor
+// of the PlayStation CPU that does the 3D math: the registers, the
+// commands, their timings and the division. It also keeps the precise
+// vertex positions for PGXP (see VertexCache). It doesn't depend on the
+// rest of the emulator, the CPU runs the coprocessor instructions and the
+// GPU looks up the precise vertices.
+package gte
@@ -1,6 +1,9 @@
-package emulator
+package gte
 
-import "testing"
+import (
+	"fmt"
+	"testing"
+)
 
 type gteRegister struct {
 	Offset uint8  // Register offset
@@ -47,7 +50,7 @@ func TestGteLZCR(t *testing.T) {
 		}
 	}
 
-	gte := NewGTE()
+	gte := New()
 	for _, d := range expected {
 		lzcs := d[0]
 		lzcr := d[1]
@@ -59,7 +62,7 @@ func TestGteLZCR(t *testing.T) {
 }
 
 func (conf *gteConfig) makeGte() *GTE {
-	gte := NewGTE()
+	gte := New()
 
 	// set GTE control registers
 	for _, reg := range conf.Controls {
@@ -701,3 +704,83 @@ var gteTests = []gteTest{
 		},
 	},
 }
+
+func TestGteStall(t *testing.T) {
+	gte := New()
+	gte.StartCommand(0x4a280030, 100) // RTPT
+
+	if stall := gte.StallCycles(110); stall != 13 {
+		t.Errorf("expected a 13 cycle stall, got %d", stall)
+	}
+	if stall := gte.StallCycles(123); stall != 0 {
+		t.Errorf("expected no stall after the command, got %d", stall)
+	}
+}
+
+// Runs the first table test of every GTE command in a loop
+func BenchmarkGteCommands(b *testing.B) {
+	seen := make(map[uint32]bool)
+	for _, test := range gteTests {
+		opcode := test.Command & 0x3f
+		if seen[opcode] {
+			continue
+		}
+		seen[opcode] = true
+
+		test := test
+		b.Run(fmt.Sprintf("0x%02x", opcode), func(b *testing.B) {
+			gte := test.Initial.makeGte()
+			for i := 0; i < b.N; i++ {
+				gte.Command(test.Command)
+			}
+		})
+	}
+}
+
+func TestGteWidescreen(t *testing.T) {
+	project := func(widescreen bool) [2]int16 {
+		gte := New()
+		gte.Widescreen = widescreen
+		for i := 0; i < 3; i++ {
+			gte.Matrices[MATRIX_ROTATION][i][i] = 0x1000
+		}
+		gte.H = 1000
+		gte.V[0] = [3]int16{200, 100, 1000}
+
+		gte.DoRTP(CommandConfigFromCommand(1<<19), 0)
+		return gte.XyFifo[2]
+	}
+
+	if xy := project(false); xy != [2]int16{200, 100} {
+		t.Fatalf("expected the vertex at (200, 100), got %v", xy)
+	}
+	// only X is squeezed
+	if xy := project(true); xy != [2]int16{150, 100} {
+		t.Fatalf("expected the vertex at (150, 100), got %v", xy)
+	}
+}
+
+func TestGtePgxp(t *testing.T) {
+	gte := New()
+	gte.Pgxp = NewVertexCache()
+	for i := 0; i < 3; i++ {
+		gte.Matrices[MATRIX_ROTATION][i][i] = 0x1000
+	}
+	gte.H = 1000
+	gte.V[0] = [3]int16{101, 50, 300}
+	gte.DoRTP(CommandConfigFromCommand(1<<19), 0)
+
+	xy := gte.XyFifo[2]
+	precise, ok := gte.Pgxp.Lookup(VertexCacheKey(xy[0], xy[1]))
+	if !ok {
+		t.Fatal("expected the projected vertex to be cached")
+	}
+	if precise.X <= float32(xy[0]) || precise.X >= float32(xy[0]+1) {
+		t.Errorf("expected a sub-pixel X coordinate after %d, got %f", xy[0], precise.X)
+	}
+
+	// a vertex that wasn't projected by the GTE
+	if _, ok := gte.Pgxp.Lookup(0x00100010); ok {
+		t.Error("expected no precise coordinates for a 2D vertex")
+	}
+}
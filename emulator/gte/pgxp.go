@@ -0,0 +1,79 @@
+package gte
+
+// Maximum amount of vertices in a VertexCache, it's cleared when it's full
+const VERTEX_CACHE_SIZE = 8192
+
+// Remembers the sub-pixel screen coordinates of the vertices projected by
+// the GTE (like PGXP). The GTE only outputs integer coordinates, which
+// makes the polygons jitter when they move. The games copy these to the
+// GPU commands unchanged, so the GPU can find the precise coordinates of a
+// polygon vertex by looking up its integer coordinates
+type VertexCache struct {
+	vertices map[uint32]PreciseVertex
+}
+
+// Precise position of a vertex projected by the GTE
+type PreciseVertex struct {
+	X, Y  float32 // Sub-pixel screen coordinates
+	Depth float32 // Distance from the camera (SZ), 0 if unknown
+}
+
+// Returns a new empty vertex cache
+func NewVertexCache() *VertexCache {
+	return &VertexCache{
+		vertices: make(map[uint32]PreciseVertex),
+	}
+}
+
+// PGXP vertices are cached positions of the host, they're not saved
+func (cache *VertexCache) GobEncode() ([]byte, error) {
+	return nil, nil
+}
+
+func (cache *VertexCache) GobDecode(data []byte) error {
+	return nil
+}
+
+// Packs integer screen coordinates like the SXY registers and the GP0
+// vertex parameters
+func VertexCacheKey(x, y int16) uint32 {
+	return uint32(uint16(x)) | uint32(uint16(y))<<16
+}
+
+// Stores the precise coordinates of the vertex at integer coordinates
+// `x`, `y`
+func (cache *VertexCache) Add(x, y int16, precise PreciseVertex) {
+	if len(cache.vertices) >= VERTEX_CACHE_SIZE {
+		cache.Clear()
+	}
+	cache.vertices[VertexCacheKey(x, y)] = precise
+}
+
+// Returns the precise coordinates of the last vertex projected to the
+// packed coordinates `xy` (a GP0 vertex parameter), if there is one
+func (cache *VertexCache) Lookup(xy uint32) (PreciseVertex, bool) {
+	precise, ok := cache.vertices[xy]
+	return precise, ok
+}
+
+// Removes all vertices, called at the end of every frame
+func (cache *VertexCache) Clear() {
+	for key := range cache.vertices {
+		delete(cache.vertices, key)
+	}
+}
+
+// Records the precise coordinates of a projected vertex. `x` and `y` are
+// the 16.16 fixed point screen coordinates and `z` is the saturated depth
+func (gte *GTE) cachePreciseVertex(sx, sy int16, x, y int64, z uint16) {
+	if gte.Pgxp == nil {
+		return
+	}
+
+	precise := PreciseVertex{X: float32(x) / 0x10000, Y: float32(y) / 0x10000, Depth: float32(z)}
+	if precise.X < -0x400 || precise.X > 0x3ff || precise.Y < -0x400 || precise.Y > 0x3ff {
+		// saturated, the integer coordinates are more useful
+		return
+	}
+	gte.Pgxp.Add(sx, sy, precise)
+}
@@ -0,0 +1,48 @@
+package gte
+
+// CPU cycles taken by each GTE command, indexed by the opcode (bits [5:0] of
+// the command). Unused opcodes take as long as a NOP
+var GTE_COMMAND_CYCLES = [64]uint64{
+	0x01: 15, // RTPS
+	0x06: 8,  // NCLIP
+	0x0c: 6,  // OP
+	0x10: 8,  // DPCS
+	0x11: 8,  // INTPL
+	0x12: 8,  // MVMVA
+	0x13: 19, // NCDS
+	0x14: 13, // CDP
+	0x16: 44, // NCDT
+	0x1b: 17, // NCCS
+	0x1c: 11, // CC
+	0x1e: 14, // NCS
+	0x20: 30, // NCT
+	0x28: 5,  // SQR
+	0x29: 8,  // DCPL
+	0x2a: 17, // DPCT
+	0x2d: 5,  // AVSZ3
+	0x2e: 6,  // AVSZ4
+	0x30: 23, // RTPT
+	0x3d: 5,  // GPF
+	0x3e: 5,  // GPL
+	0x3f: 39, // NCCT
+}
+
+// Returns the amount of CPU cycles taken by the GTE command `cmd`
+func CommandCycles(cmd uint32) uint64 {
+	return GTE_COMMAND_CYCLES[cmd&0x3f]
+}
+
+// Marks the GTE busy with `cmd`, which was started at CPU cycle `now`. The
+// CPU keeps running while the GTE is busy
+func (gte *GTE) StartCommand(cmd uint32, now uint64) {
+	gte.BusyUntil = now + CommandCycles(cmd)
+}
+
+// Returns the amount of CPU cycles the CPU has to stall for if it accesses
+// the GTE at CPU cycle `now`
+func (gte *GTE) StallCycles(now uint64) uint64 {
+	if now >= gte.BusyUntil {
+		return 0
+	}
+	return gte.BusyUntil - now
+}
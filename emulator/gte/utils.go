@@ -1,6 +1,9 @@
-package emulator
+package gte
 
-import "math"
+import (
+	"fmt"
+	"math"
+)
 
 // Represents a matrix index in the GTE's matrices
 type Matrix int
@@ -145,3 +148,57 @@ func (gte *GTE) I64ToOTZ(average int64) uint16 {
 	}
 	return uint16(val)
 }
+
+// Called with the warnings of the GTE (writes to read-only registers). The
+// emulator package sends them to its log
+var Warnf = func(format string, args ...interface{}) {}
+
+func panicFmt(format string, a ...interface{}) {
+	panic(fmt.Sprintf(format, a...))
+}
+
+func oneIfTrue(val bool) uint32 {
+	if val {
+		return 1
+	}
+	return 0
+}
+
+func countLeadingZeroesU16(val uint16) uint16 {
+	var r uint16
+	for ((val & 0x8000) == 0) && r < 16 {
+		val <<= 1
+		r++
+	}
+	return r
+}
+
+func countLeadingZeroesU32(x uint32) uint32 {
+	var n uint32 = 32
+	var y uint32
+	y = x >> 16
+	if y != 0 {
+		n = n - 16
+		x = y
+	}
+	y = x >> 8
+	if y != 0 {
+		n = n - 8
+		x = y
+	}
+	y = x >> 4
+	if y != 0 {
+		n = n - 4
+		x = y
+	}
+	y = x >> 2
+	if y != 0 {
+		n = n - 2
+		x = y
+	}
+	y = x >> 1
+	if y != 0 {
+		return n - 2
+	}
+	return n - x
+}
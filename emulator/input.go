@@ -0,0 +1,134 @@
+package emulator
+
+import "github.com/zeozeozeo/gopsx/emulator/input"
+
+// The controllers are in their own package, see input.Gamepad
+type (
+	Button            = input.Button
+	ButtonState       = input.ButtonState
+	Axis              = input.Axis
+	GamepadType       = input.GamepadType
+	Gamepad           = input.Gamepad
+	Profile           = input.Profile
+	AnalogProfile     = input.AnalogProfile
+	DummyPadProfile   = input.DummyPadProfile
+	DigitalPadProfile = input.DigitalPadProfile
+	DualShockProfile  = input.DualShockProfile
+	RumbleHandler     = input.RumbleHandler
+	GunconProfile     = input.GunconProfile
+	LightgunTarget    = input.LightgunTarget
+	MouseProfile      = input.MouseProfile
+	NegconProfile     = input.NegconProfile
+	MultitapProfile   = input.MultitapProfile
+)
+
+const (
+	BUTTON_STATE_PRESSED  = input.BUTTON_STATE_PRESSED
+	BUTTON_STATE_RELEASED = input.BUTTON_STATE_RELEASED
+)
+
+const (
+	BUTTON_SELECT   = input.BUTTON_SELECT
+	BUTTON_START    = input.BUTTON_START
+	BUTTON_DUP      = input.BUTTON_DUP
+	BUTTON_DRIGHT   = input.BUTTON_DRIGHT
+	BUTTON_DDOWN    = input.BUTTON_DDOWN
+	BUTTON_DLEFT    = input.BUTTON_DLEFT
+	BUTTON_L2       = input.BUTTON_L2
+	BUTTON_R2       = input.BUTTON_R2
+	BUTTON_L1       = input.BUTTON_L1
+	BUTTON_R1       = input.BUTTON_R1
+	BUTTON_TRIANGLE = input.BUTTON_TRIANGLE
+	BUTTON_CIRCLE   = input.BUTTON_CIRCLE
+	BUTTON_CROSS    = input.BUTTON_CROSS
+	BUTTON_SQUARE   = input.BUTTON_SQUARE
+)
+
+const (
+	AXIS_TWIST   = input.AXIS_TWIST
+	AXIS_I       = input.AXIS_I
+	AXIS_II      = input.AXIS_II
+	AXIS_L       = input.AXIS_L
+	AXIS_LEFT_X  = input.AXIS_LEFT_X
+	AXIS_LEFT_Y  = input.AXIS_LEFT_Y
+	AXIS_RIGHT_X = input.AXIS_RIGHT_X
+	AXIS_RIGHT_Y = input.AXIS_RIGHT_Y
+	AXIS_COUNT   = input.AXIS_COUNT
+)
+
+const (
+	GAMEPAD_TYPE_DISCONNECTED = input.GAMEPAD_TYPE_DISCONNECTED
+	GAMEPAD_TYPE_DIGITAL      = input.GAMEPAD_TYPE_DIGITAL
+	GAMEPAD_TYPE_MULTITAP     = input.GAMEPAD_TYPE_MULTITAP
+	GAMEPAD_TYPE_GUNCON       = input.GAMEPAD_TYPE_GUNCON
+	GAMEPAD_TYPE_MOUSE        = input.GAMEPAD_TYPE_MOUSE
+	GAMEPAD_TYPE_NEGCON       = input.GAMEPAD_TYPE_NEGCON
+	GAMEPAD_TYPE_DUALSHOCK    = input.GAMEPAD_TYPE_DUALSHOCK
+)
+
+const (
+	DIGITAL_PAD_RELEASED     = input.DIGITAL_PAD_RELEASED
+	DUALSHOCK_STICK_CENTER   = input.DUALSHOCK_STICK_CENTER
+	DUALSHOCK_MOTOR_BYTES    = input.DUALSHOCK_MOTOR_BYTES
+	DUALSHOCK_MOTOR_SMALL    = input.DUALSHOCK_MOTOR_SMALL
+	DUALSHOCK_MOTOR_LARGE    = input.DUALSHOCK_MOTOR_LARGE
+	DUALSHOCK_MOTOR_DISABLED = input.DUALSHOCK_MOTOR_DISABLED
+	GUNCON_CLOCK_HZ          = input.GUNCON_CLOCK_HZ
+	GUNCON_OFFSCREEN_X       = input.GUNCON_OFFSCREEN_X
+	GUNCON_OFFSCREEN_Y       = input.GUNCON_OFFSCREEN_Y
+	GUNCON_TRIGGER           = input.GUNCON_TRIGGER
+	GUNCON_A                 = input.GUNCON_A
+	GUNCON_B                 = input.GUNCON_B
+	MOUSE_LEFT               = input.MOUSE_LEFT
+	MOUSE_RIGHT              = input.MOUSE_RIGHT
+	NEGCON_TWIST_CENTER      = input.NEGCON_TWIST_CENTER
+	MULTITAP_SLOTS           = input.MULTITAP_SLOTS
+	MULTITAP_SLOT_REPLY_SIZE = input.MULTITAP_SLOT_REPLY_SIZE
+	MULTITAP_CARD_FIRST      = input.MULTITAP_CARD_FIRST
+	MULTITAP_CARD_LAST       = input.MULTITAP_CARD_LAST
+)
+
+// All gamepad buttons
+var GamepadButtons = input.GamepadButtons
+
+// Returns a new Gamepad instance
+func NewGamepad(profileType GamepadType) *Gamepad {
+	return input.NewGamepad(profileType)
+}
+
+// Returns a new instance of DummyPadProfile
+func NewDummyPad() *DummyPadProfile {
+	return input.NewDummyPad()
+}
+
+// SCPH-1080: Digital Joypad
+func NewDigitalPad() *DigitalPadProfile {
+	return input.NewDigitalPad()
+}
+
+// Returns a new DualShock in digital mode with centered sticks and the
+// motors disabled
+func NewDualShock() *DualShockProfile {
+	return input.NewDualShock()
+}
+
+// Returns a new Guncon that doesn't point at the screen
+func NewGuncon() *GunconProfile {
+	return input.NewGuncon()
+}
+
+// Returns a new mouse with no buttons pressed
+func NewMouse() *MouseProfile {
+	return input.NewMouse()
+}
+
+// Returns a new centered neGcon with no buttons pressed
+func NewNegcon() *NegconProfile {
+	return input.NewNegcon()
+}
+
+// Returns a new multitap adapter with a digital pad in slot A and
+// empty B-D slots
+func NewMultitap() *MultitapProfile {
+	return input.NewMultitap()
+}
@@ -0,0 +1,6 @@
+// Package input emulates the controllers that plug into the PlayStation
+// controller ports: the digital pad, the DualShock, the Guncon, the mouse,
+// the neGcon and the multitap adapter. A Gamepad answers the bytes of the
+// serial protocol, the emulator package connects it to the ports. The
+// Guncon only needs a LightgunTarget (the GPU) to know where it points.
+package input
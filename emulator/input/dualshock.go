@@ -0,0 +1,220 @@
+package input
+
+// Value of a centered analog stick axis
+const DUALSHOCK_STICK_CENTER = 0x80
+
+// Amount of motor mapping bytes set by the 0x4d config command
+const DUALSHOCK_MOTOR_BYTES = 6
+
+// Values of the motor mapping bytes
+const (
+	DUALSHOCK_MOTOR_SMALL    = 0x00 // The byte turns the small motor on and off
+	DUALSHOCK_MOTOR_LARGE    = 0x01 // The byte is the speed of the large motor
+	DUALSHOCK_MOTOR_DISABLED = 0xff // The byte isn't used
+)
+
+// Receives the state of the vibration motors of a DualShock: the small
+// motor is either on or off, the large motor has a speed from 0 to 255
+type RumbleHandler func(small bool, large uint8)
+
+// SCPH-1200: DualShock analog controller (implements Profile and
+// AnalogProfile). It starts in digital mode, where it behaves like a digital
+// pad, until the Analog button is pressed or the game switches it to analog
+// mode with the config commands. Games also use the config commands to
+// enable the vibration motors
+type DualShockProfile struct {
+	State  uint16            // Buttons, active low like DigitalPadProfile.State
+	Axes   [AXIS_COUNT]uint8 // Analog values from 0 to 255, see Axis
+	Analog bool              // True in analog mode (red LED)
+	Locked bool              // If true, the Analog button doesn't switch modes
+	Config bool              // True if the pad is in config mode
+	// Which motor each byte after the poll command drives, see
+	// DUALSHOCK_MOTOR_SMALL
+	MotorMapping [DUALSHOCK_MOTOR_BYTES]uint8
+	SmallMotor   bool  // True if the small motor is on
+	LargeMotor   uint8 // Speed of the large motor
+	// If not nil, called when the state of the motors changes. It's called
+	// on the emulation goroutine
+	OnRumble RumbleHandler
+	Command  uint8                        // Command of the current transfer
+	Params   [DUALSHOCK_MOTOR_BYTES]uint8 // Parameters of the current transfer
+}
+
+// Returns a new DualShock in digital mode with centered sticks and the
+// motors disabled
+func NewDualShock() *DualShockProfile {
+	profile := &DualShockProfile{State: DIGITAL_PAD_RELEASED}
+	for _, axis := range []Axis{AXIS_LEFT_X, AXIS_LEFT_Y, AXIS_RIGHT_X, AXIS_RIGHT_Y} {
+		profile.Axes[axis] = DUALSHOCK_STICK_CENTER
+	}
+	for i := range profile.MotorMapping {
+		profile.MotorMapping[i] = DUALSHOCK_MOTOR_DISABLED
+	}
+	return profile
+}
+
+// Returns the ID byte of the current mode
+func (profile *DualShockProfile) id() uint8 {
+	switch {
+	case profile.Config:
+		return 0xf3
+	case profile.Analog:
+		return 0x73
+	default:
+		return 0x41
+	}
+}
+
+// Returns the amount of bytes after the 0x5a byte
+func (profile *DualShockProfile) replySize() uint8 {
+	if profile.Config || profile.Analog {
+		return 6
+	}
+	return 2
+}
+
+func (profile *DualShockProfile) HandleCommand(seq, cmd uint8) (uint8, bool) {
+	switch seq {
+	case 0: // 0xff: does the command target a controller?
+		return 0xff, cmd == 0x01
+	case 1: // the ID byte tells the mode
+		profile.Command = cmd
+		profile.Params = [DUALSHOCK_MOTOR_BYTES]uint8{}
+		valid := cmd == 0x42 || cmd == 0x43
+		if profile.Config {
+			valid = cmd >= 0x40 && cmd <= 0x4f
+		}
+		return profile.id(), valid
+	case 2:
+		return 0x5a, true
+	}
+
+	index := seq - 3
+	size := profile.replySize()
+	if index >= size {
+		return 0xff, false
+	}
+	profile.Params[index] = cmd
+
+	var resp uint8
+	if profile.Command == 0x42 || (profile.Command == 0x43 && !profile.Config) {
+		resp = profile.pollReply(index)
+	} else {
+		resp = profile.configReply(index, cmd)
+	}
+
+	last := index == size-1
+	if last {
+		profile.finishCommand()
+	}
+	return resp, !last
+}
+
+// Returns byte `index` of the button and stick state
+func (profile *DualShockProfile) pollReply(index uint8) uint8 {
+	switch index {
+	case 0:
+		return uint8(profile.State)
+	case 1:
+		return uint8(profile.State >> 8)
+	case 2:
+		return profile.Axes[AXIS_RIGHT_X]
+	case 3:
+		return profile.Axes[AXIS_RIGHT_Y]
+	case 4:
+		return profile.Axes[AXIS_LEFT_X]
+	default:
+		return profile.Axes[AXIS_LEFT_Y]
+	}
+}
+
+// Returns byte `index` of the reply to a config command. `param` is the
+// byte sent by the console at the same time
+func (profile *DualShockProfile) configReply(index, param uint8) uint8 {
+	var reply [DUALSHOCK_MOTOR_BYTES]uint8
+	switch profile.Command {
+	case 0x45: // get the controller type and the mode
+		reply = [DUALSHOCK_MOTOR_BYTES]uint8{0x01, 0x02, uint8(oneIfTrue(profile.Analog)), 0x02, 0x01, 0x00}
+	case 0x46: // actuator info
+		if profile.Params[0] == 0 {
+			reply = [DUALSHOCK_MOTOR_BYTES]uint8{0x00, 0x00, 0x01, 0x02, 0x00, 0x0a}
+		} else {
+			reply = [DUALSHOCK_MOTOR_BYTES]uint8{0x00, 0x00, 0x01, 0x01, 0x01, 0x14}
+		}
+	case 0x47:
+		reply = [DUALSHOCK_MOTOR_BYTES]uint8{0x00, 0x00, 0x02, 0x00, 0x01, 0x00}
+	case 0x4c: // mode info
+		if profile.Params[0] == 0 {
+			reply[3] = 0x04
+		} else {
+			reply[3] = 0x07
+		}
+	case 0x4d: // set the motor mapping, the old mapping is returned
+		old := profile.MotorMapping[index]
+		profile.MotorMapping[index] = param
+		return old
+	}
+	return reply[index]
+}
+
+// Applies the parameters of the finished transfer
+func (profile *DualShockProfile) finishCommand() {
+	params := profile.Params
+	switch {
+	case profile.Command == 0x42:
+		profile.updateMotors(params)
+	case profile.Command == 0x43:
+		// enter (1) or exit (0) config mode
+		profile.Config = params[0] == 1
+	case profile.Command == 0x44 && profile.Config:
+		profile.Analog = params[0] == 1
+		profile.Locked = params[1] == 3
+	}
+}
+
+// Sets the motors from the bytes sent with the poll command
+func (profile *DualShockProfile) updateMotors(params [DUALSHOCK_MOTOR_BYTES]uint8) {
+	small, large := false, uint8(0)
+	for i, mapping := range profile.MotorMapping {
+		switch mapping {
+		case DUALSHOCK_MOTOR_SMALL:
+			small = params[i] == 0x01
+		case DUALSHOCK_MOTOR_LARGE:
+			large = params[i]
+		}
+	}
+
+	if small == profile.SmallMotor && large == profile.LargeMotor {
+		return
+	}
+	profile.SmallMotor = small
+	profile.LargeMotor = large
+	if profile.OnRumble != nil {
+		profile.OnRumble(small, large)
+	}
+}
+
+func (profile *DualShockProfile) SetButtonState(button Button, state ButtonState) {
+	mask := uint16(1) << uint(button)
+	switch state {
+	case BUTTON_STATE_PRESSED:
+		profile.State &^= mask
+	case BUTTON_STATE_RELEASED:
+		profile.State |= mask
+	}
+}
+
+// Sets an analog value. Only the stick axes are used
+func (profile *DualShockProfile) SetAxis(axis Axis, value uint8) {
+	if axis >= 0 && axis < AXIS_COUNT {
+		profile.Axes[axis] = value
+	}
+}
+
+// Switches between digital and analog mode like the Analog button. Does
+// nothing if the game locked the mode
+func (profile *DualShockProfile) PressAnalog() {
+	if !profile.Locked {
+		profile.Analog = !profile.Analog
+	}
+}
@@ -0,0 +1,70 @@
+package input
+
+import "testing"
+
+// Sends a full transfer to `pad` and returns the reply
+func transferPad(pad *Gamepad, commands ...uint8) []uint8 {
+	pad.Select()
+	var reply []uint8
+	for _, cmd := range commands {
+		resp, dsr := pad.SendCommand(cmd)
+		reply = append(reply, resp)
+		if !dsr {
+			break
+		}
+	}
+	return reply
+}
+
+func TestDualShockRumble(t *testing.T) {
+	dualShock := NewDualShock()
+	var small bool
+	var large uint8
+	calls := 0
+	dualShock.OnRumble = func(s bool, l uint8) {
+		small, large = s, l
+		calls++
+	}
+	pad := &Gamepad{Profile: dualShock}
+
+	// digital mode until the game enables the analog mode
+	if reply := transferPad(pad, 0x01, 0x42, 0, 0, 0); len(reply) != 5 || reply[1] != 0x41 {
+		t.Fatalf("expected a digital pad reply, got % x", reply)
+	}
+
+	// enter config mode, switch to analog, map the motors and exit
+	transferPad(pad, 0x01, 0x43, 0, 0x01, 0)
+	if !dualShock.Config {
+		t.Fatalf("expected the pad to be in config mode")
+	}
+	transferPad(pad, 0x01, 0x44, 0, 0x01, 0x03, 0, 0, 0, 0)
+	old := transferPad(pad, 0x01, 0x4d, 0, 0x00, 0x01, 0xff, 0xff, 0xff, 0xff)
+	if old[3] != DUALSHOCK_MOTOR_DISABLED {
+		t.Errorf("expected the old mapping to be disabled, got % x", old)
+	}
+	transferPad(pad, 0x01, 0x43, 0, 0x00, 0, 0, 0, 0, 0)
+	if dualShock.Config || !dualShock.Analog || !dualShock.Locked {
+		t.Fatalf("expected a locked analog pad, got %+v", dualShock)
+	}
+
+	dualShock.PressAnalog()
+	if !dualShock.Analog {
+		t.Errorf("expected the Analog button to be ignored while locked")
+	}
+
+	dualShock.SetAxis(AXIS_LEFT_X, 0x10)
+	reply := transferPad(pad, 0x01, 0x42, 0, 0x01, 0xc0, 0, 0, 0, 0)
+	if len(reply) != 9 || reply[1] != 0x73 || reply[7] != 0x10 {
+		t.Errorf("unexpected analog reply % x", reply)
+	}
+	if !small || large != 0xc0 || calls != 1 {
+		t.Errorf("expected the motors to start, got %v %d (%d calls)", small, large, calls)
+	}
+
+	// the handler is only called on changes
+	transferPad(pad, 0x01, 0x42, 0, 0x01, 0xc0, 0, 0, 0, 0)
+	transferPad(pad, 0x01, 0x42, 0, 0x00, 0x00, 0, 0, 0, 0)
+	if small || large != 0 || calls != 2 {
+		t.Errorf("expected the motors to stop, got %v %d (%d calls)", small, large, calls)
+	}
+}
@@ -0,0 +1,95 @@
+package input
+
+// The Guncon measures the horizontal position with an 8MHz clock started by
+// the HSYNC
+const GUNCON_CLOCK_HZ = 8_000_000
+
+// Position reported when the gun doesn't point at the screen
+const (
+	GUNCON_OFFSCREEN_X = 0x01
+	GUNCON_OFFSCREEN_Y = 0x0a
+)
+
+// Guncon buttons, they use the bits of the digital pad buttons
+const (
+	GUNCON_TRIGGER = BUTTON_CIRCLE
+	GUNCON_A       = BUTTON_START
+	GUNCON_B       = BUTTON_CROSS
+)
+
+// SCPH-1170: Namco Guncon lightgun (implements Profile). The position is
+// sent by the frontend in VRAM coordinates with Aim, see
+// GPU.LightgunPosition
+type GunconProfile struct {
+	State uint16 // Trigger, A and B, active low like DigitalPadProfile.State
+	X     uint16 // Horizontal position in GUNCON_CLOCK_HZ ticks since the HSYNC
+	Y     uint16 // Scanline since the VSYNC
+}
+
+// Returns a new Guncon that doesn't point at the screen
+func NewGuncon() *GunconProfile {
+	return &GunconProfile{
+		State: DIGITAL_PAD_RELEASED,
+		X:     GUNCON_OFFSCREEN_X,
+		Y:     GUNCON_OFFSCREEN_Y,
+	}
+}
+
+func (profile *GunconProfile) HandleCommand(seq, cmd uint8) (uint8, bool) {
+	switch seq {
+	case 0: // 0xff: does the command target a controller?
+		return 0xff, cmd == 0x01
+	case 1: // 0x63: are we a Guncon?
+		return 0x63, cmd == 0x42
+	case 2: // 0x5a: ID byte
+		return 0x5a, true
+	case 3: // A
+		return uint8(profile.State), true
+	case 4: // trigger and B
+		return uint8(profile.State >> 8), true
+	case 5:
+		return uint8(profile.X), true
+	case 6:
+		return uint8(profile.X >> 8), true
+	case 7:
+		return uint8(profile.Y), true
+	case 8:
+		return uint8(profile.Y >> 8), false
+	default:
+		return 0xff, false
+	}
+}
+
+// Only GUNCON_TRIGGER, GUNCON_A and GUNCON_B are used, the other buttons
+// are ignored
+func (profile *GunconProfile) SetButtonState(button Button, state ButtonState) {
+	if button != GUNCON_TRIGGER && button != GUNCON_A && button != GUNCON_B {
+		return
+	}
+
+	mask := uint16(1) << uint(button)
+	switch state {
+	case BUTTON_STATE_PRESSED:
+		profile.State &^= mask
+	case BUTTON_STATE_RELEASED:
+		profile.State |= mask
+	}
+}
+
+// Anything that can tell where a lightgun aiming at a VRAM position points
+// on the screen, usually the GPU (see GPU.LightgunPosition in the emulator
+// package)
+type LightgunTarget interface {
+	LightgunPosition(x, y int) (uint16, uint16, bool)
+}
+
+// Points the gun at the VRAM position `x`, `y` of `target`. Positions
+// outside of the displayed area point the gun away from the screen
+func (profile *GunconProfile) Aim(target LightgunTarget, x, y int) {
+	gunX, gunY, ok := target.LightgunPosition(x, y)
+	if !ok {
+		gunX, gunY = GUNCON_OFFSCREEN_X, GUNCON_OFFSCREEN_Y
+	}
+	profile.X = gunX
+	profile.Y = gunY
+}
@@ -0,0 +1,39 @@
+package input
+
+import "testing"
+
+// Screen of 320x240 pixels that reports the VRAM position as it is
+type gunconTestScreen struct{}
+
+func (gunconTestScreen) LightgunPosition(x, y int) (uint16, uint16, bool) {
+	if x < 0 || y < 0 || x >= 320 || y >= 240 {
+		return 0, 0, false
+	}
+	return uint16(x), uint16(y), true
+}
+
+func TestGunconProtocol(t *testing.T) {
+	gun := NewGuncon()
+	gun.SetButtonState(GUNCON_TRIGGER, BUTTON_STATE_PRESSED)
+	gun.SetButtonState(BUTTON_TRIANGLE, BUTTON_STATE_PRESSED)
+	gun.Aim(gunconTestScreen{}, 0x123, 0x45)
+
+	pad := &Gamepad{Profile: gun}
+	pad.Select()
+	expected := []uint8{0xff, 0x63, 0x5a, 0xff, 0xdf, 0x23, 0x01, 0x45, 0x00}
+	commands := []uint8{0x01, 0x42, 0, 0, 0, 0, 0, 0, 0}
+	for i, cmd := range commands {
+		resp, dsr := pad.SendCommand(cmd)
+		if resp != expected[i] {
+			t.Errorf("byte %d: expected 0x%02x, got 0x%02x", i, expected[i], resp)
+		}
+		if dsr != (i < len(commands)-1) {
+			t.Errorf("byte %d: unexpected DSR %v", i, dsr)
+		}
+	}
+
+	gun.Aim(gunconTestScreen{}, 320, 0)
+	if gun.X != GUNCON_OFFSCREEN_X || gun.Y != GUNCON_OFFSCREEN_Y {
+		t.Errorf("expected the offscreen position, got %d,%d", gun.X, gun.Y)
+	}
+}
@@ -0,0 +1,75 @@
+package input
+
+// Mouse buttons, they use the bits of the digital pad buttons
+const (
+	MOUSE_LEFT  = BUTTON_R1
+	MOUSE_RIGHT = BUTTON_L1
+)
+
+// SCPH-1090: PlayStation Mouse (implements Profile). The movement is sent
+// by the frontend with Move and accumulated until the console reads it
+type MouseProfile struct {
+	State uint16 // Left and right buttons, active low like DigitalPadProfile.State
+	DX    int    // Horizontal movement since the last read, positive is right
+	DY    int    // Vertical movement since the last read, positive is down
+}
+
+// Returns a new mouse with no buttons pressed
+func NewMouse() *MouseProfile {
+	return &MouseProfile{State: DIGITAL_PAD_RELEASED}
+}
+
+func (profile *MouseProfile) HandleCommand(seq, cmd uint8) (uint8, bool) {
+	switch seq {
+	case 0: // 0xff: does the command target a controller?
+		return 0xff, cmd == 0x01
+	case 1: // 0x12: are we a mouse?
+		return 0x12, cmd == 0x42
+	case 2: // 0x5a: ID byte
+		return 0x5a, true
+	case 3: // unused
+		return uint8(profile.State), true
+	case 4: // left and right buttons
+		return uint8(profile.State >> 8), true
+	case 5:
+		return uint8(profile.takeDelta(&profile.DX)), true
+	case 6:
+		return uint8(profile.takeDelta(&profile.DY)), false
+	default:
+		return 0xff, false
+	}
+}
+
+// Returns as much of the movement in `delta` as fits in a signed byte and
+// removes it, the rest is sent by the next reads
+func (profile *MouseProfile) takeDelta(delta *int) int8 {
+	sent := *delta
+	if sent > 127 {
+		sent = 127
+	} else if sent < -128 {
+		sent = -128
+	}
+	*delta -= sent
+	return int8(sent)
+}
+
+// Only MOUSE_LEFT and MOUSE_RIGHT are used, the other buttons are ignored
+func (profile *MouseProfile) SetButtonState(button Button, state ButtonState) {
+	if button != MOUSE_LEFT && button != MOUSE_RIGHT {
+		return
+	}
+
+	mask := uint16(1) << uint(button)
+	switch state {
+	case BUTTON_STATE_PRESSED:
+		profile.State &^= mask
+	case BUTTON_STATE_RELEASED:
+		profile.State |= mask
+	}
+}
+
+// Adds a movement of `dx`, `dy` to the movement that wasn't read yet
+func (profile *MouseProfile) Move(dx, dy int) {
+	profile.DX += dx
+	profile.DY += dy
+}
@@ -0,0 +1,34 @@
+package input
+
+import "testing"
+
+func TestMouseProtocol(t *testing.T) {
+	mouse := NewMouse()
+	mouse.SetButtonState(MOUSE_LEFT, BUTTON_STATE_PRESSED)
+	mouse.Move(200, -5)
+
+	pad := &Gamepad{Profile: mouse}
+	read := func() []uint8 {
+		pad.Select()
+		var reply []uint8
+		for _, cmd := range []uint8{0x01, 0x42, 0, 0, 0, 0, 0} {
+			resp, _ := pad.SendCommand(cmd)
+			reply = append(reply, resp)
+		}
+		return reply
+	}
+
+	// the movement is clamped to a signed byte, the rest comes next
+	expected := [][]uint8{
+		{0xff, 0x12, 0x5a, 0xff, 0xf7, 127, 0xfb},
+		{0xff, 0x12, 0x5a, 0xff, 0xf7, 73, 0},
+	}
+	for i, exp := range expected {
+		reply := read()
+		for j := range exp {
+			if reply[j] != exp[j] {
+				t.Errorf("read %d byte %d: expected 0x%02x, got 0x%02x", i, j, exp[j], reply[j])
+			}
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package input
+
+// Amount of controller slots on a multitap adapter
+const MULTITAP_SLOTS = 4
+
+// Amount of bytes returned for each slot during a multitap transfer
+const MULTITAP_SLOT_REPLY_SIZE = 8
+
+// Address bytes of the memory cards in slots A-D
+const (
+	MULTITAP_CARD_FIRST = 0x81
+	MULTITAP_CARD_LAST  = MULTITAP_CARD_FIRST + MULTITAP_SLOTS - 1
+)
+
+// SCPH-1070: Multitap adapter (implements Profile). Up to 4 controllers and
+// 4 memory cards can be plugged into a single port. Slots are addressed with
+// the first byte of the transfer, 0x01 to 0x04 for the controllers and 0x81
+// to 0x84 for the memory cards. When the multitap mode is enabled, a
+// transfer to controller slot A returns the data of all 4 slots at once
+type MultitapProfile struct {
+	Slots [MULTITAP_SLOTS]*Gamepad // Controllers plugged into slots A-D
+	// Memory cards plugged into slots A-D. Memory cards aren't emulated on
+	// the serial bus yet, the slots are empty unless a profile that answers
+	// 0x81 is plugged in
+	Cards     [MULTITAP_SLOTS]*Gamepad
+	Slot      uint8 // Slot addressed by the current transfer
+	Card      bool  // True if the current transfer goes to a memory card
+	MultiMode bool  // Set by the TAP byte, applies to the next transfer
+	InMulti   bool  // True if the current transfer returns all slots
+	// Responses of all slots for the current multitap transfer
+	Buffer [MULTITAP_SLOTS * MULTITAP_SLOT_REPLY_SIZE]byte
+}
+
+// Returns a new multitap adapter with a digital pad in slot A and
+// empty B-D slots
+func NewMultitap() *MultitapProfile {
+	tap := &MultitapProfile{}
+	tap.Slots[0] = NewGamepad(GAMEPAD_TYPE_DIGITAL)
+	for i := 1; i < len(tap.Slots); i++ {
+		tap.Slots[i] = NewGamepad(GAMEPAD_TYPE_DISCONNECTED)
+	}
+	for i := range tap.Cards {
+		tap.Cards[i] = NewGamepad(GAMEPAD_TYPE_DISCONNECTED)
+	}
+	return tap
+}
+
+func (tap *MultitapProfile) HandleCommand(seq, cmd uint8) (uint8, bool) {
+	if seq == 0 {
+		switch {
+		case cmd >= 0x01 && cmd <= MULTITAP_SLOTS:
+			// 0x01: slot A, 0x02: slot B, 0x03: slot C, 0x04: slot D
+			tap.Slot, tap.Card = cmd-1, false
+		case cmd >= MULTITAP_CARD_FIRST && cmd <= MULTITAP_CARD_LAST:
+			// the memory card in the slot expects to be addressed as 0x81
+			tap.Slot, tap.Card, tap.InMulti = cmd-MULTITAP_CARD_FIRST, true, false
+			return tap.Cards[tap.Slot].Profile.HandleCommand(0, MULTITAP_CARD_FIRST)
+		default:
+			return 0xff, false
+		}
+
+		tap.InMulti = tap.MultiMode && tap.Slot == 0
+		if tap.InMulti {
+			return 0xff, true
+		}
+
+		// the controller in the slot still expects to be addressed as 0x01
+		return tap.Slots[tap.Slot].Profile.HandleCommand(0, 0x01)
+	}
+
+	if tap.Card {
+		return tap.Cards[tap.Slot].Profile.HandleCommand(seq, cmd)
+	}
+	if !tap.InMulti {
+		// forward the transfer to a single slot
+		resp, dsr := tap.Slots[tap.Slot].Profile.HandleCommand(seq, cmd)
+		if seq == 2 && tap.Slot == 0 {
+			tap.MultiMode = cmd == 0x01
+		}
+		return resp, dsr
+	}
+
+	switch seq {
+	case 1: // 0x80: multitap ID
+		if cmd != 0x42 {
+			return 0xff, false
+		}
+		tap.Poll()
+		return 0x80, true
+	case 2: // 0x5a: ID byte, the TAP byte is received at the same time
+		tap.MultiMode = cmd == 0x01
+		return 0x5a, true
+	default: // slot A-D responses
+		index := int(seq) - 3
+		if index >= len(tap.Buffer) {
+			return 0xff, false
+		}
+		return tap.Buffer[index], index < len(tap.Buffer)-1
+	}
+}
+
+// Reads the state of all controllers into the transfer buffer
+func (tap *MultitapProfile) Poll() {
+	// 0x01 (address), 0x42 (read), then 6 bytes to receive the data
+	request := [MULTITAP_SLOT_REPLY_SIZE]byte{0x01, 0x42}
+
+	for idx, slot := range tap.Slots {
+		reply := tap.Buffer[idx*MULTITAP_SLOT_REPLY_SIZE : (idx+1)*MULTITAP_SLOT_REPLY_SIZE]
+		for i := range reply {
+			reply[i] = 0xff
+		}
+
+		// the address byte doesn't return anything useful, check if
+		// there's something in the slot
+		if _, dsr := slot.Profile.HandleCommand(0, request[0]); !dsr {
+			continue
+		}
+
+		for seq := 1; seq <= len(reply); seq++ {
+			var cmd uint8
+			if seq < len(request) {
+				cmd = request[seq]
+			}
+			resp, dsr := slot.Profile.HandleCommand(uint8(seq), cmd)
+			reply[seq-1] = resp
+			if !dsr {
+				break
+			}
+		}
+	}
+}
+
+// Forwards the button event to the controller in slot A
+func (tap *MultitapProfile) SetButtonState(button Button, state ButtonState) {
+	tap.Slots[0].SetButtonState(button, state)
+}
+
+// Returns the controller plugged into `slot` (0-3)
+func (tap *MultitapProfile) Gamepad(slot int) *Gamepad {
+	return tap.Slots[slot]
+}
@@ -0,0 +1,111 @@
+package input
+
+import "testing"
+
+// Sends a whole transfer to `pad` and returns the responses until the
+// device stops asserting DSR
+func multitapTransfer(pad *Gamepad, cmds ...uint8) []uint8 {
+	pad.Select()
+	var resps []uint8
+	for _, cmd := range cmds {
+		resp, dsr := pad.SendCommand(cmd)
+		resps = append(resps, resp)
+		if !dsr {
+			break
+		}
+	}
+	return resps
+}
+
+func expectMultitapTransfer(t *testing.T, desc string, got, expected []uint8) {
+	t.Helper()
+	if len(got) != len(expected) {
+		t.Errorf("%s: expected %x, got %x", desc, expected, got)
+		return
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Errorf("%s: expected %x, got %x", desc, expected, got)
+			return
+		}
+	}
+}
+
+// Memory card that answers its address byte and records the commands
+type multitapTestCard struct {
+	cmds []uint8
+}
+
+func (card *multitapTestCard) HandleCommand(seq, cmd uint8) (uint8, bool) {
+	card.cmds = append(card.cmds, cmd)
+	if seq == 0 {
+		return 0xff, cmd == MULTITAP_CARD_FIRST
+	}
+	return 0x5a, seq < 2
+}
+
+func (card *multitapTestCard) SetButtonState(button Button, state ButtonState) {}
+
+func TestMultitapSlots(t *testing.T) {
+	port := NewGamepad(GAMEPAD_TYPE_MULTITAP)
+	tap := port.Profile.(*MultitapProfile)
+	tap.Slots[0].Profile.(*DigitalPadProfile).State = 0xfffe
+	tap.Slots[2].Profile = &DigitalPadProfile{State: 0x1234}
+
+	expectMultitapTransfer(t, "slot A", multitapTransfer(port, 0x01, 0x42, 0, 0, 0),
+		[]uint8{0xff, 0x41, 0x5a, 0xfe, 0xff})
+	expectMultitapTransfer(t, "slot C", multitapTransfer(port, 0x03, 0x42, 0, 0, 0),
+		[]uint8{0xff, 0x41, 0x5a, 0x34, 0x12})
+	expectMultitapTransfer(t, "empty slot B", multitapTransfer(port, 0x02, 0x42), []uint8{0xff})
+	expectMultitapTransfer(t, "no slot E", multitapTransfer(port, 0x05, 0x42), []uint8{0xff})
+}
+
+// The TAP byte of a transfer to slot A enables the multitap mode, then the
+// next transfer to slot A returns the 0x80 ID and all 4 slots
+func TestMultitapMultiMode(t *testing.T) {
+	port := NewGamepad(GAMEPAD_TYPE_MULTITAP)
+	tap := port.Profile.(*MultitapProfile)
+	tap.Slots[3].Profile = &DigitalPadProfile{State: 0xabcd}
+
+	multitapTransfer(port, 0x01, 0x42, 0x01, 0, 0)
+	if !tap.MultiMode {
+		t.Fatal("expected the TAP byte to enable the multitap mode")
+	}
+
+	cmds := make([]uint8, 3+MULTITAP_SLOTS*MULTITAP_SLOT_REPLY_SIZE)
+	cmds[0], cmds[1] = 0x01, 0x42
+	resps := multitapTransfer(port, cmds...)
+	if len(resps) != len(cmds) {
+		t.Fatalf("expected %d bytes, got %d: %x", len(cmds), len(resps), resps)
+	}
+	expectMultitapTransfer(t, "header", resps[:3], []uint8{0xff, 0x80, 0x5a})
+
+	pad := []uint8{0x41, 0x5a, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	empty := []uint8{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	slotD := []uint8{0x41, 0x5a, 0xcd, 0xab, 0xff, 0xff, 0xff, 0xff}
+	for slot, expected := range [][]uint8{pad, empty, empty, slotD} {
+		start := 3 + slot*MULTITAP_SLOT_REPLY_SIZE
+		expectMultitapTransfer(t, "slot "+string(rune('A'+slot)),
+			resps[start:start+MULTITAP_SLOT_REPLY_SIZE], expected)
+	}
+
+	// the TAP byte was 0, the next transfer only returns slot A
+	expectMultitapTransfer(t, "after the multitap mode", multitapTransfer(port, 0x01, 0x42, 0, 0, 0),
+		[]uint8{0xff, 0x41, 0x5a, 0xff, 0xff})
+}
+
+// Memory card transfers go to the card in the addressed slot
+func TestMultitapMemoryCards(t *testing.T) {
+	port := NewGamepad(GAMEPAD_TYPE_MULTITAP)
+	tap := port.Profile.(*MultitapProfile)
+	card := &multitapTestCard{}
+	tap.Cards[1].Profile = card
+
+	expectMultitapTransfer(t, "card in slot B", multitapTransfer(port, 0x82, 0x52, 0), []uint8{0xff, 0x5a, 0x5a})
+	expectMultitapTransfer(t, "card commands", card.cmds, []uint8{MULTITAP_CARD_FIRST, 0x52, 0})
+	expectMultitapTransfer(t, "no card in slot A", multitapTransfer(port, 0x81, 0x52), []uint8{0xff})
+
+	// the controllers are still reachable
+	expectMultitapTransfer(t, "slot A", multitapTransfer(port, 0x01, 0x42, 0, 0, 0),
+		[]uint8{0xff, 0x41, 0x5a, 0xff, 0xff})
+}
@@ -0,0 +1,86 @@
+package input
+
+// Value of a centered twist axis
+const NEGCON_TWIST_CENTER = 0x80
+
+// SCPH-1150: Namco neGcon (implements Profile and AnalogProfile). The two
+// halves of the controller twist around the middle, and the I, II and L
+// buttons are analog. Most analog steering wheels use the same protocol.
+// The digital Cross, Square and L1 buttons press I, II and L all the way
+type NegconProfile struct {
+	State uint16 // Start, D-pad, R, B and A, active low like DigitalPadProfile.State
+	// Analog values from 0 to 255, see Axis. The twist is centered at
+	// NEGCON_TWIST_CENTER, 0 is twisted left
+	Axes [AXIS_COUNT]uint8
+}
+
+// Returns a new centered neGcon with no buttons pressed
+func NewNegcon() *NegconProfile {
+	profile := &NegconProfile{State: DIGITAL_PAD_RELEASED}
+	profile.Axes[AXIS_TWIST] = NEGCON_TWIST_CENTER
+	return profile
+}
+
+func (profile *NegconProfile) HandleCommand(seq, cmd uint8) (uint8, bool) {
+	switch seq {
+	case 0: // 0xff: does the command target a controller?
+		return 0xff, cmd == 0x01
+	case 1: // 0x23: are we a neGcon?
+		return 0x23, cmd == 0x42
+	case 2: // 0x5a: ID byte
+		return 0x5a, true
+	case 3: // start and D-pad
+		return uint8(profile.State), true
+	case 4: // R, B and A
+		return uint8(profile.State >> 8), true
+	case 5:
+		return profile.Axes[AXIS_TWIST], true
+	case 6:
+		return profile.Axes[AXIS_I], true
+	case 7:
+		return profile.Axes[AXIS_II], true
+	case 8:
+		return profile.Axes[AXIS_L], false
+	default:
+		return 0xff, false
+	}
+}
+
+func (profile *NegconProfile) SetButtonState(button Button, state ButtonState) {
+	// analog buttons pressed with a digital button
+	var axis Axis
+	switch button {
+	case BUTTON_CROSS:
+		axis = AXIS_I
+	case BUTTON_SQUARE:
+		axis = AXIS_II
+	case BUTTON_L1:
+		axis = AXIS_L
+	case BUTTON_START, BUTTON_DUP, BUTTON_DRIGHT, BUTTON_DDOWN, BUTTON_DLEFT,
+		BUTTON_R1, BUTTON_TRIANGLE, BUTTON_CIRCLE:
+		mask := uint16(1) << uint(button)
+		switch state {
+		case BUTTON_STATE_PRESSED:
+			profile.State &^= mask
+		case BUTTON_STATE_RELEASED:
+			profile.State |= mask
+		}
+		return
+	default:
+		return
+	}
+
+	if state == BUTTON_STATE_PRESSED {
+		profile.Axes[axis] = 0xff
+	} else {
+		profile.Axes[axis] = 0
+	}
+}
+
+// Sets an analog value. Only AXIS_TWIST, AXIS_I, AXIS_II and AXIS_L are
+// used
+func (profile *NegconProfile) SetAxis(axis Axis, value uint8) {
+	if axis >= 0 && axis < AXIS_COUNT {
+		profile.Axes[axis] = value
+	}
+}
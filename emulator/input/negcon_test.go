@@ -0,0 +1,27 @@
+package input
+
+import "testing"
+
+func TestNegconProtocol(t *testing.T) {
+	negcon := NewNegcon()
+	negcon.SetAxis(AXIS_TWIST, 0x20)
+	negcon.SetAxis(AXIS_II, 0x40)
+	negcon.SetButtonState(BUTTON_CROSS, BUTTON_STATE_PRESSED)
+	negcon.SetButtonState(BUTTON_START, BUTTON_STATE_PRESSED)
+	// not a neGcon button
+	negcon.SetButtonState(BUTTON_SELECT, BUTTON_STATE_PRESSED)
+
+	pad := &Gamepad{Profile: negcon}
+	pad.Select()
+	expected := []uint8{0xff, 0x23, 0x5a, 0xf7, 0xff, 0x20, 0xff, 0x40, 0x00}
+	commands := []uint8{0x01, 0x42, 0, 0, 0, 0, 0, 0, 0}
+	for i, cmd := range commands {
+		resp, dsr := pad.SendCommand(cmd)
+		if resp != expected[i] {
+			t.Errorf("byte %d: expected 0x%02x, got 0x%02x", i, expected[i], resp)
+		}
+		if dsr != (i < len(commands)-1) {
+			t.Errorf("byte %d: unexpected DSR %v", i, dsr)
+		}
+	}
+}
@@ -1,4 +1,4 @@
-package emulator
+package input
 
 type ButtonState int
 
@@ -44,11 +44,31 @@ var GamepadButtons = []Button{
 	BUTTON_SQUARE,
 }
 
+// Analog input of a controller, see AnalogProfile
+type Axis int
+
+const (
+	AXIS_TWIST   Axis = iota // neGcon twist
+	AXIS_I       Axis = iota // neGcon analog I button
+	AXIS_II      Axis = iota // neGcon analog II button
+	AXIS_L       Axis = iota // neGcon analog L button
+	AXIS_LEFT_X  Axis = iota // DualShock left stick, 0 is left
+	AXIS_LEFT_Y  Axis = iota // DualShock left stick, 0 is up
+	AXIS_RIGHT_X Axis = iota // DualShock right stick, 0 is left
+	AXIS_RIGHT_Y Axis = iota // DualShock right stick, 0 is up
+	AXIS_COUNT   Axis = iota // Amount of axes
+)
+
 type GamepadType int
 
 const (
 	GAMEPAD_TYPE_DISCONNECTED GamepadType = iota // Gamepad is not connected
 	GAMEPAD_TYPE_DIGITAL      GamepadType = iota // SCPH-1080: Digital Joypad
+	GAMEPAD_TYPE_MULTITAP     GamepadType = iota // SCPH-1070: Multitap adapter
+	GAMEPAD_TYPE_GUNCON       GamepadType = iota // SCPH-1170: Namco Guncon
+	GAMEPAD_TYPE_MOUSE        GamepadType = iota // SCPH-1090: PlayStation Mouse
+	GAMEPAD_TYPE_NEGCON       GamepadType = iota // SCPH-1150: Namco neGcon
+	GAMEPAD_TYPE_DUALSHOCK    GamepadType = iota // SCPH-1200: DualShock analog controller
 )
 
 // Gamepad
@@ -89,6 +109,16 @@ func NewGamepad(profileType GamepadType) *Gamepad {
 		gp.Profile = NewDummyPad()
 	case GAMEPAD_TYPE_DIGITAL:
 		gp.Profile = NewDigitalPad()
+	case GAMEPAD_TYPE_MULTITAP:
+		gp.Profile = NewMultitap()
+	case GAMEPAD_TYPE_GUNCON:
+		gp.Profile = NewGuncon()
+	case GAMEPAD_TYPE_MOUSE:
+		gp.Profile = NewMouse()
+	case GAMEPAD_TYPE_NEGCON:
+		gp.Profile = NewNegcon()
+	case GAMEPAD_TYPE_DUALSHOCK:
+		gp.Profile = NewDualShock()
 	}
 	return gp
 }
@@ -99,6 +129,14 @@ type Profile interface {
 	SetButtonState(button Button, state ButtonState) // Handles button events
 }
 
+// Profile of a controller with analog inputs
+type AnalogProfile interface {
+	Profile
+	// Sets an analog value from 0 to 255. Axes that the controller doesn't
+	// have are ignored
+	SetAxis(axis Axis, value uint8)
+}
+
 // Empty gamepad slot that implements Profile
 type DummyPadProfile struct{}
 
@@ -115,6 +153,9 @@ func NewDummyPad() *DummyPadProfile {
 	return &DummyPadProfile{}
 }
 
+// Digital pad state with no buttons pressed (buttons are active low)
+const DIGITAL_PAD_RELEASED uint16 = 0xffff
+
 // SCPH-1080: Digital Joypad (implements Profile)
 type DigitalPadProfile struct {
 	State uint16 // Only 1 bit per button, 2 bytes
@@ -153,6 +194,6 @@ func (profile *DigitalPadProfile) SetButtonState(button Button, state ButtonStat
 // SCPH-1080: Digital Joypad
 func NewDigitalPad() *DigitalPadProfile {
 	return &DigitalPadProfile{
-		State: 0xffff,
+		State: DIGITAL_PAD_RELEASED,
 	}
 }
@@ -0,0 +1,8 @@
+package input
+
+func oneIfTrue(val bool) uint32 {
+	if val {
+		return 1
+	}
+	return 0
+}
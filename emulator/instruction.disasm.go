@@ -0,0 +1,118 @@
+package emulator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Returns the instruction with its operands, e.g. "ADDIU sp, sp, -0x18".
+// `pc` is the address of the instruction, used for the branch and jump
+// targets
+func (op Instruction) Disassemble(pc uint32) string {
+	return op.DisassembleSymbols(pc, nil)
+}
+
+// Like Disassemble, but the branch and jump targets are followed by their
+// symbol, e.g. "JAL 0x80010000 <main>"
+func (op Instruction) DisassembleSymbols(pc uint32, symbols *Symbols) string {
+	if op == 0 {
+		return "NOP"
+	}
+
+	reg := GetRegisterName
+	s, t, d := reg(op.S()), reg(op.T()), reg(op.D())
+	imm := signedHex(int32(op.ImmSE()))
+	branch := formatTarget(pc+4+op.ImmSE()<<2, symbols)
+
+	switch op.Function() {
+	case 0b000000:
+		name := op.String()
+		switch op.Subfunction() {
+		case 0b000000, 0b000010, 0b000011: // SLL, SRL, SRA
+			return fmt.Sprintf("%s %s, %s, %d", name, d, t, op.Shift())
+		case 0b000100, 0b000110, 0b000111: // SLLV, SRLV, SRAV
+			return fmt.Sprintf("%s %s, %s, %s", name, d, t, s)
+		case 0b001000, 0b010001, 0b010011: // JR, MTHI, MTLO
+			return fmt.Sprintf("%s %s", name, s)
+		case 0b001001: // JALR
+			return fmt.Sprintf("%s %s, %s", name, d, s)
+		case 0b001100:
+			return fmt.Sprintf("SYSCALL 0x%x", (uint32(op)>>6)&0xfffff)
+		case 0b001101:
+			return fmt.Sprintf("BREAK 0x%x", (uint32(op)>>6)&0xfffff)
+		case 0b010000, 0b010010: // MFHI, MFLO
+			return fmt.Sprintf("%s %s", name, d)
+		case 0b011000, 0b011001, 0b011010, 0b011011: // MULT, MULTU, DIV, DIVU
+			return fmt.Sprintf("%s %s, %s", name, s, t)
+		}
+		if name == "ILLEGAL" {
+			return fmt.Sprintf("ILLEGAL 0x%08x", uint32(op))
+		}
+		return fmt.Sprintf("%s %s, %s, %s", name, d, s, t)
+	case 0b000001:
+		name := "BLTZ"
+		if op.T()&1 != 0 {
+			name = "BGEZ"
+		}
+		if op.T()&0x1e == 0x10 {
+			name += "AL"
+		}
+		return fmt.Sprintf("%s %s, %s", name, s, branch)
+	case 0b000010, 0b000011: // J, JAL
+		target := (pc+4)&0xf0000000 | op.ImmJump()<<2
+		return fmt.Sprintf("%s %s", op.String(), formatTarget(target, symbols))
+	case 0b000100, 0b000101: // BEQ, BNE
+		return fmt.Sprintf("%s %s, %s, %s", op.String(), s, t, branch)
+	case 0b000110, 0b000111: // BLEZ, BGTZ
+		return fmt.Sprintf("%s %s, %s", op.String(), s, branch)
+	case 0b001000, 0b001001, 0b001010, 0b001011: // ADDI, ADDIU, SLTI, SLTIU
+		return fmt.Sprintf("%s %s, %s, %s", op.String(), t, s, imm)
+	case 0b001100, 0b001101, 0b001110: // ANDI, ORI, XORI
+		return fmt.Sprintf("%s %s, %s, 0x%x", op.String(), t, s, op.Imm())
+	case 0b001111: // LUI
+		return fmt.Sprintf("LUI %s, 0x%x", t, op.Imm())
+	case 0b010000, 0b010001, 0b010010, 0b010011:
+		cop := op.Function() & 3
+		switch op.CopOpcode() {
+		case 0b00000:
+			return fmt.Sprintf("MFC%d %s, %d", cop, t, op.D())
+		case 0b00010:
+			return fmt.Sprintf("CFC%d %s, %d", cop, t, op.D())
+		case 0b00100:
+			return fmt.Sprintf("MTC%d %s, %d", cop, t, op.D())
+		case 0b00110:
+			return fmt.Sprintf("CTC%d %s, %d", cop, t, op.D())
+		}
+		if cop == 0 && op.Subfunction() == 0b010000 {
+			return "RFE"
+		}
+		return fmt.Sprintf("COP%d 0x%x", cop, uint32(op)&0x1ffffff)
+	}
+
+	name := op.String()
+	if name == "ILLEGAL" {
+		return fmt.Sprintf("ILLEGAL 0x%08x", uint32(op))
+	}
+	if strings.HasPrefix(name, "LWC") || strings.HasPrefix(name, "SWC") {
+		// the coprocessor register is stored in T
+		return fmt.Sprintf("%s %d, %s(%s)", name, op.T(), imm, s)
+	}
+	// loads and stores
+	return fmt.Sprintf("%s %s, %s(%s)", name, t, imm, s)
+}
+
+// Formats a signed value in hexadecimal, e.g. -0x18
+func signedHex(v int32) string {
+	if v < 0 {
+		return fmt.Sprintf("-0x%x", -int64(v))
+	}
+	return fmt.Sprintf("0x%x", v)
+}
+
+// Returns a branch or jump target, followed by its symbol if there's one
+func formatTarget(addr uint32, symbols *Symbols) string {
+	if name := symbols.Format(addr); name != "" {
+		return fmt.Sprintf("0x%08x <%s>", addr, name)
+	}
+	return fmt.Sprintf("0x%08x", addr)
+}
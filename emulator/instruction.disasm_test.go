@@ -0,0 +1,33 @@
+package emulator
+
+import "testing"
+
+func TestInstructionDisassemble(t *testing.T) {
+	tests := []struct {
+		op   Instruction
+		pc   uint32
+		want string
+	}{
+		{0x00000000, 0, "NOP"},
+		{0x3c080013, 0, "LUI t0, 0x13"},
+		{0x3508243f, 0, "ORI t0, t0, 0x243f"},
+		{0x27bdffe8, 0, "ADDIU sp, sp, -0x18"},
+		{0xafbf0014, 0, "SW ra, 0x14(sp)"},
+		{0x00084080, 0, "SLL t0, t0, 2"},
+		{0x01094821, 0, "ADDU t1, t0, t1"},
+		{0x03e00008, 0, "JR ra"},
+		{0x0ff00054, 0xbfc00000, "JAL 0xbfc00150"},
+		{0x1509fffe, 0xbfc00010, "BNE t0, t1, 0xbfc0000c"},
+		{0x04110003, 0x80000000, "BGEZAL r0, 0x80000010"},
+		{0x40806000, 0, "MTC0 r0, 12"},
+		{0x42000010, 0, "RFE"},
+		{0x0000000c, 0, "SYSCALL 0x0"},
+		{0xc8410000, 0, "LWC2 1, 0x0(v0)"},
+		{0xfc000000, 0, "ILLEGAL 0xfc000000"},
+	}
+	for _, test := range tests {
+		if got := test.op.Disassemble(test.pc); got != test.want {
+			t.Errorf("0x%08x: expected \"%s\", got \"%s\"", uint32(test.op), test.want, got)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package emulator
+
+// What the interconnect does when the CPU accesses an address that isn't
+// mapped (or a locked part of the RAM window)
+type UnmappedAccess uint8
+
+const (
+	// Trigger a bus error exception, like the hardware
+	UNMAPPED_BUS_ERROR UnmappedAccess = iota
+	// Log the access and carry on, loads return 0 and stores are lost
+	UNMAPPED_IGNORE UnmappedAccess = iota
+	// Panic, useful to find out what the emulator is missing
+	UNMAPPED_PANIC UnmappedAccess = iota
+)
+
+// Handles an access to an unmapped address. `access` describes the access
+// for the log. Returns the value of a load
+func (inter *Interconnect) unmappedAccess(addr uint32, access string) uint32 {
+	switch inter.Unmapped {
+	case UNMAPPED_IGNORE:
+		Log.Warnf(LOG_MODULE_INTER, "ignoring %s at unmapped address 0x%x", access, addr)
+	case UNMAPPED_PANIC:
+		panicFmt("inter: unhandled %s at address 0x%x", access, addr)
+	default:
+		inter.BusError = true
+	}
+	return 0
+}
@@ -0,0 +1,76 @@
+package emulator
+
+const (
+	FASTMEM_PAGE_BITS = 16 // 64KB pages
+	FASTMEM_PAGE_SIZE = 1 << FASTMEM_PAGE_BITS
+	FASTMEM_PAGES     = 1 << (32 - FASTMEM_PAGE_BITS)
+)
+
+// Host memory backing a 64KB page of the guest address space
+type FastmemPage struct {
+	Data     []byte // Nil if the page has to go through the slow path
+	Writable bool   // False for the BIOS
+	Ram      bool   // Writes have to be reported to Ram.CodePages
+	Base     uint32 // RAM offset of the first byte of the page
+	// Load delays of the region, points into Interconnect.Timings
+	Timing *AccessTiming
+}
+
+// Maps RAM, the scratchpad and the BIOS into the fastmem page table. Must be
+// called again if one of them is replaced or if the RAM window changes
+func (inter *Interconnect) MapFastmem() {
+	inter.Fastmem = [FASTMEM_PAGES]FastmemPage{}
+
+	// KUSEG, KSEG0 and KSEG1
+	for _, region := range []uint32{0x00000000, 0x80000000, 0xa0000000} {
+		// 2MB of RAM mirrored over the RAM_SIZE window, the rest of the 8MB
+		// goes through the slow path
+		for offset := uint32(0); offset < inter.RamWindow(); offset += FASTMEM_PAGE_SIZE {
+			base := offset & (RAM_ALLOC_SIZE - 1)
+			inter.Fastmem[(region|offset)>>FASTMEM_PAGE_BITS] = FastmemPage{
+				Data:     inter.Ram.Data[base : base+FASTMEM_PAGE_SIZE],
+				Writable: true,
+				Ram:      true,
+				Base:     base,
+				Timing:   &inter.Timings.Ram,
+			}
+		}
+
+		for offset := uint32(0); offset < BIOS_RANGE.Length; offset += FASTMEM_PAGE_SIZE {
+			addr := region | (BIOS_RANGE.Start + offset)
+			inter.Fastmem[addr>>FASTMEM_PAGE_BITS] = FastmemPage{
+				Data:   inter.Bios.Data[offset : offset+FASTMEM_PAGE_SIZE],
+				Timing: &inter.Timings.Bios,
+			}
+		}
+	}
+
+	// the scratchpad can't be accessed through KSEG1. The rest of its page
+	// contains MMIO registers, which are past the end of the slice
+	for _, region := range []uint32{0x00000000, 0x80000000} {
+		addr := region | SCRATCHPAD_RANGE.Start
+		inter.Fastmem[addr>>FASTMEM_PAGE_BITS] = FastmemPage{
+			Data:     inter.ScratchPad.Data[:],
+			Writable: true,
+			Timing:   &inter.Timings.ScratchPad,
+		}
+	}
+}
+
+// Returns the fastmem page for `addr` and the offset in it. Returns nil if
+// the address has to go through the slow path
+func (inter *Interconnect) fastmemPage(addr uint32, size uint32) (*FastmemPage, uint32) {
+	page := &inter.Fastmem[addr>>FASTMEM_PAGE_BITS]
+	offset := addr & (FASTMEM_PAGE_SIZE - 1) &^ (size - 1)
+	if offset >= uint32(len(page.Data)) {
+		return nil, 0
+	}
+	return page, offset
+}
+
+// Reports a write to RAM so compiled code can be invalidated
+func (inter *Interconnect) fastmemWrite(page *FastmemPage, offset uint32) {
+	if page.Ram && inter.Ram.CodePages != nil {
+		inter.Ram.CodePages.Write(page.Base + offset)
+	}
+}
@@ -17,8 +17,28 @@ type Interconnect struct {
 	Gte        *GTE         // Geometry Transformation Engine (coprocessor 2)
 	PadMemCard *PadMemCard  // Gamepad and memory card
 	MemControl [9]uint32    // Memory control registers
-	RamSize    uint32       // RAM_SIZE register
+	RamSize    uint32       // RAM_SIZE register, see RamAccess
 	ScratchPad *ScratchPad
+	Cheats     *CheatEngine // Cheats, applied at the start of every VBlank
+	Sio1       *Sio1        // Second serial port
+	Spu        *SPU         // Sound Processing Unit
+	Expansion  *Expansion   // Parallel port cartridge and expansion registers
+	// RetroAchievements triggers, tested after the cheats. Nil if unused
+	Achievements *AchievementEngine
+	// Load delays of every region, computed from MemControl
+	Timings MemoryTimings
+	// Maps 64KB guest pages to RAM, the scratchpad and the BIOS, so most
+	// accesses don't have to go through the slow path
+	Fastmem [FASTMEM_PAGES]FastmemPage
+	// Set when an access hits an unmapped or locked address. The CPU clears
+	// it and triggers a bus error exception
+	BusError bool
+	// What happens on accesses to unmapped addresses, bus errors by default
+	Unmapped UnmappedAccess
+	// Measures the time spent in the peripherals, nil if profiling is off
+	Profiler *Profiler
+	// Counts the accesses to every page of RAM, nil if it's off
+	HeatMap *HeatMap
 }
 
 // Mask array used to strip the region bits of a CPU address. The mask
@@ -49,205 +69,308 @@ func NewInterconnect(bios *BIOS, ram *RAM, gpu *GPU, disc *Disc) *Interconnect {
 		Gte:        NewGTE(),
 		PadMemCard: NewPadMemCard(),
 		ScratchPad: NewScratchPad(),
-	}
+		Cheats:     NewCheatEngine(),
+		Sio1:       NewSio1(),
+		Spu:        NewSPU(),
+		Expansion:  NewExpansion(),
+		RamSize:    RAMSIZE_DEFAULT,
+	}
+	inter.CdRom.Mixer.Spu = inter.Spu
+	inter.UpdateTimings()
+	inter.MapFastmem()
 	return inter
 }
 
+// Puts RAM, the scratchpad and the peripherals back to their power-on
+// state. The BIOS, the disc, the controllers, the cheats, the serial link,
+// the cartridge, the GPU hooks, the audio output and the enhancements
+// (widescreen, PGXP) are kept
+func (inter *Interconnect) Reset() {
+	inter.Ram.Reset()
+	inter.ScratchPad = NewScratchPad()
+	inter.Dma = NewDMA()
+	inter.Gpu.Reset()
+	inter.IrqState = NewIrqState()
+	inter.Timers = NewTimers()
+	disc := inter.CdRom.Disc
+	if inter.CdRom.NextDisc != nil {
+		// a disc swap was in progress
+		disc = inter.CdRom.NextDisc
+	}
+	audioOutput, host := inter.CdRom.Mixer.Output, inter.CdRom.Mixer.Host()
+	inter.CdRom = NewCdRom(disc)
+	inter.CdRom.Mixer.SetOutput(audioOutput)
+	inter.CdRom.Mixer.SetHost(host)
+	widescreen := inter.Gte.Widescreen
+	inter.Gte = NewGTE()
+	inter.Gte.Widescreen = widescreen
+	inter.Gte.Pgxp = inter.Gpu.Pgxp
+	reverb := inter.Spu.Reverb
+	inter.Spu = NewSPU()
+	inter.Spu.Reverb = reverb
+	inter.CdRom.Mixer.Spu = inter.Spu
+
+	pad1, pad2 := inter.PadMemCard.Pad1, inter.PadMemCard.Pad2
+	inter.PadMemCard = NewPadMemCard()
+	inter.PadMemCard.Pad1, inter.PadMemCard.Pad2 = pad1, pad2
+
+	link := inter.Sio1.Link
+	inter.Sio1 = NewSio1()
+	inter.Sio1.Link = link
+
+	inter.CacheCtrl = 0
+	inter.MemControl = [9]uint32{}
+	inter.RamSize = RAMSIZE_DEFAULT
+	inter.BusError = false
+	inter.UpdateTimings()
+	inter.MapFastmem()
+}
+
+// Enables or disables PGXP, the GTE then remembers the precise coordinates
+// of the vertices it projects and the GPU adds them to the polygons
+func (inter *Interconnect) SetPgxp(enabled bool) {
+	var cache *VertexCache
+	if enabled {
+		cache = NewVertexCache()
+	}
+	inter.Gpu.Pgxp = cache
+	inter.Gte.Pgxp = cache
+}
+
 // Load value at `addr`
-func (inter *Interconnect) Load(addr uint32, size AccessSize, th *TimeHandler) interface{} {
+func (inter *Interconnect) Load(addr uint32, size AccessSize, th *TimeHandler) uint32 {
 	absAddr := MaskRegion(addr)
-
-	// average RAM load delay
-	th.Tick(5)
+	th.Tick(inter.LoadTiming(absAddr).Cycles(size))
 
 	if ok, offset := RAM_RANGE.ContainsAndOffset(absAddr); ok {
+		switch inter.RamAccess(offset) {
+		case RAM_ACCESS_HIGHZ:
+			return RAM_HIGHZ_VALUE
+		case RAM_ACCESS_LOCKED:
+			return inter.unmappedAccess(addr, "load")
+		}
 		return inter.Ram.Load(offset, size)
 	}
 	if ok, offset := BIOS_RANGE.ContainsAndOffset(absAddr); ok {
 		return inter.Bios.Load(offset, size)
 	}
 	if ok, offset := IRQ_CONTROL_RANGE.ContainsAndOffset(absAddr); ok {
-		switch offset {
-		case 0: // interrupt status
-			return accessSizeU32(size, uint32(inter.IrqState.Status))
-		case 4: // interrupt mask
-			return accessSizeU32(size, uint32(inter.IrqState.Mask))
-		default:
-			panicFmt("inter: unhandled IRQ read at 0x%x", addr)
-		}
-		return 0
+		return inter.IrqState.Load(offset, size)
 	}
 	if ok, offset := DMA_RANGE.ContainsAndOffset(absAddr); ok {
-		return accessSizeU32(size, inter.DmaReg(offset))
+		return inter.DmaReg(offset)
 	}
 	if ok, offset := GPU_RANGE.ContainsAndOffset(absAddr); ok {
 		return inter.Gpu.Load(offset, th, inter.IrqState)
 	}
 	if ok, offset := TIMERS_RANGE.ContainsAndOffset(absAddr); ok {
-		return inter.Timers.Load(size, th, offset, inter.IrqState)
+		return inter.Timers.Load(size, th, offset, inter.IrqState, inter.Gpu)
 	}
-	if SPU_RANGE.Contains(absAddr) {
-		// ignore this for now (TODO)
-		// fmt.Printf("inter: unhandled read from SPU register 0x%x\n", absAddr)
-		return accessSizeU32(size, 0)
+	if ok, offset := SPU_RANGE.ContainsAndOffset(absAddr); ok {
+		return inter.Spu.Load(offset, size, th, inter.IrqState)
 	}
-	if EXPANSION_1_RANGE.Contains(absAddr) {
-		fmt.Printf("inter: ignoring read from expansion 1 0x%x\n", absAddr)
-		return accessSizeU32(size, 0)
+	if ok, offset := EXPANSION_1_RANGE.ContainsAndOffset(absAddr); ok {
+		return inter.Expansion.Load1(offset, size)
+	}
+	if ok, offset := EXPANSION_2_RANGE.ContainsAndOffset(absAddr); ok {
+		return inter.Expansion.Load2(offset)
 	}
 	if ok, offset := CDROM_RANGE.ContainsAndOffset(absAddr); ok {
-		return accessSizeU32(size, inter.CdRom.Load(offset, size, th, inter.IrqState))
+		return inter.CdRom.Load(offset, size, th, inter.IrqState)
 	}
 	if ok, offset := PADMEMCARD_RANGE.ContainsAndOffset(absAddr); ok {
 		return inter.PadMemCard.Load(th, inter.IrqState, offset, size)
 	}
+	if ok, offset := SIO1_RANGE.ContainsAndOffset(absAddr); ok {
+		return inter.Sio1.Load(offset, size, inter.IrqState)
+	}
 	if ok, offset := MEMCONTROL_RANGE.ContainsAndOffset(absAddr); ok {
 		index := offset >> 2
-		return accessSizeU32(size, inter.MemControl[index])
+		return inter.MemControl[index]
 	}
 	if RAMSIZE_RANGE.Contains(absAddr) {
-		return accessSizeU32(size, inter.RamSize)
+		return inter.RamSize
 	}
 	if ok, offset := SCRATCHPAD_RANGE.ContainsAndOffset(absAddr); ok {
-		if addr > 0xa0000000 {
-			panic("inter: scratchpad read through uncached memory")
+		if addr >= 0xa0000000 {
+			// the scratchpad isn't reachable through KSEG1
+			return inter.unmappedAccess(addr, "load")
 		}
 		return inter.ScratchPad.Load(offset, size)
 	}
 	if ok, offset := MDEC_RANGE.ContainsAndOffset(absAddr); ok {
-		fmt.Printf("inter: ignoring read from MDEC register %d\n", offset)
-		return accessSizeU32(size, 0)
+		Log.Warnf(LOG_MODULE_INTER, "ignoring read from MDEC register %d", offset)
+		return 0
 	}
 
-	panicFmt("inter: unhandled load at address 0x%x", addr)
-	return accessSizeU32(size, 0)
+	return inter.unmappedAccess(addr, "load")
 }
 
 // Write value into `addr`
-func (inter *Interconnect) Store(addr uint32, size AccessSize, val interface{}, th *TimeHandler) {
+func (inter *Interconnect) Store(addr uint32, size AccessSize, val uint32, th *TimeHandler) {
 	absAddr := MaskRegion(addr)
 
 	if ok, offset := RAM_RANGE.ContainsAndOffset(absAddr); ok {
-		inter.Ram.Store(offset, size, val)
+		switch inter.RamAccess(offset) {
+		case RAM_ACCESS_MAPPED:
+			inter.Ram.Store(offset, size, val)
+		case RAM_ACCESS_LOCKED:
+			inter.unmappedAccess(addr, "store")
+		}
 		return
 	}
 	if ok, offset := MEMCONTROL_RANGE.ContainsAndOffset(absAddr); ok {
-		valU32 := accessSizeToU32(size, val)
 		switch offset {
 		case 0: // expansion 1 base address
-			if valU32 != 0x1f000000 {
+			if val != 0x1f000000 {
 				panicFmt("inter: bad expansion 1 base address 0x%x", addr)
 			}
 		case 4: // expansion 2 base address
-			if valU32 != 0x1f802000 {
+			if val != 0x1f802000 {
 				panicFmt("inter: bad expansion 2 base address 0x%x", addr)
 			}
 		}
 
 		index := offset >> 2
-		inter.MemControl[index] = valU32
+		inter.MemControl[index] = val
+		inter.UpdateTimings()
 
 		return
 	}
 	if ok, offset := IRQ_CONTROL_RANGE.ContainsAndOffset(absAddr); ok {
-		valU32 := accessSizeToU32(size, val)
-		switch offset {
-		case 0:
-			inter.IrqState.Acknowledge(uint16(valU32))
-		case 4:
-			inter.IrqState.SetMask(uint16(valU32))
-		default:
-			panicFmt("inter: unhandled IRQ store at address 0x%x", addr)
-		}
+		inter.IrqState.Store(offset, size, val)
 		return
 	}
 	if ok, offset := DMA_RANGE.ContainsAndOffset(absAddr); ok {
-		inter.SetDmaReg(offset, accessSizeToU32(size, val))
+		inter.SetDmaReg(offset, val, th)
 		return
 	}
 	if ok, offset := GPU_RANGE.ContainsAndOffset(absAddr); ok {
-		// fmt.Printf("inter: GPU write 0x%x <- 0x%x\n", offset, val)
-		valU32 := accessSizeToU32(size, val)
-		inter.Gpu.Store(offset, valU32, th, inter.IrqState, inter.Timers)
+		// Log.Debugf(LOG_MODULE_GPU, "GPU write 0x%x <- 0x%x", offset, val)
+		inter.Gpu.Store(offset, val, th, inter.IrqState, inter.Timers)
 		return
 	}
 	if ok, offset := TIMERS_RANGE.ContainsAndOffset(absAddr); ok {
 		inter.Timers.Store(size, val, th, offset, inter.Gpu, inter.IrqState)
 		return
 	}
-	if SPU_RANGE.Contains(absAddr) {
-		// ignore this for now (TODO)
-		// fmt.Printf("inter: unhandled write to SPU register at 0x%x\n", addr)
+	if ok, offset := SPU_RANGE.ContainsAndOffset(absAddr); ok {
+		inter.Spu.Store(offset, size, val, th, inter.IrqState)
 		return
 	}
 	if CACHE_CONTROL_RANGE.Contains(absAddr) {
-		valU32 := accessSizeToU32(size, val)
-		inter.CacheCtrl = CacheControl(valU32)
+		cc := CacheControl(val)
+		if cc.DataCacheMode() && !inter.CacheCtrl.DataCacheMode() {
+			// the scratchpad stays mapped
+			Log.Warnf(LOG_MODULE_INTER, "data cache mode is not supported (cache control 0x%x)", val)
+		}
+		inter.CacheCtrl = cc
 		return
 	}
 	if RAMSIZE_RANGE.Contains(absAddr) {
-		valU32 := accessSizeToU32(size, val)
-		inter.RamSize = valU32
+		inter.SetRamSize(val)
+		return
+	}
+	if ok, offset := EXPANSION_1_RANGE.ContainsAndOffset(absAddr); ok {
+		inter.Expansion.Store1(offset, val)
 		return
 	}
 	if ok, offset := EXPANSION_2_RANGE.ContainsAndOffset(absAddr); ok {
-		fmt.Printf("inter: unhandled write to EXPANSION 2 register %d\n", offset)
+		inter.Expansion.Store2(offset, val)
 		return
 	}
 	if ok, offset := CDROM_RANGE.ContainsAndOffset(absAddr); ok {
-		inter.CdRom.Store(offset, size, accessSizeToU8(size, val), th, inter.IrqState)
+		inter.CdRom.Store(offset, size, uint8(val), th, inter.IrqState)
 		return
 	}
 	if ok, offset := PADMEMCARD_RANGE.ContainsAndOffset(absAddr); ok {
 		inter.PadMemCard.Store(offset, val, size, th, inter.IrqState)
 		return
 	}
+	if ok, offset := SIO1_RANGE.ContainsAndOffset(absAddr); ok {
+		inter.Sio1.Store(offset, val, size, inter.IrqState)
+		return
+	}
 	if ok, offset := SCRATCHPAD_RANGE.ContainsAndOffset(absAddr); ok {
-		if addr > 0xa0000000 {
-			panic("inter: scratchpad write through uncached memory")
+		if addr >= 0xa0000000 {
+			// the scratchpad isn't reachable through KSEG1
+			inter.unmappedAccess(addr, "store")
+			return
 		}
 		inter.ScratchPad.Store(offset, size, val)
 		return
 	}
 	if ok, offset := MDEC_RANGE.ContainsAndOffset(absAddr); ok {
-		fmt.Printf("inter: ignoring write to MDEC register %d\n", offset)
+		Log.Warnf(LOG_MODULE_INTER, "ignoring write to MDEC register %d", offset)
 		return
 	}
 
-	panicFmt(
-		"inter: unhandled write into address 0x%x (abs: 0x%x) <- 0x%x (%d bytes)",
-		addr, absAddr, accessSizeToU32(size, val), size,
-	)
+	inter.unmappedAccess(addr, fmt.Sprintf("store of 0x%x (%d bytes)", val, size))
 }
 
-// Shortcut for inter.Load(addr, ACCESS_WORD).(uint32)
+// Loads a 32 bit value at `addr`. Uses the fastmem page table if possible
 func (inter *Interconnect) Load32(addr uint32, th *TimeHandler) uint32 {
-	return inter.Load(addr, ACCESS_WORD, th).(uint32)
+	if page, offset := inter.fastmemPage(addr, 4); page != nil {
+		th.Tick(page.Timing.Word)
+		data := page.Data[offset : offset+4]
+		return uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16 | uint32(data[3])<<24
+	}
+	return inter.Load(addr, ACCESS_WORD, th)
 }
 
-// Shortcut for inter.Load(addr, ACCESS_HALFWORD).(uint16)
+// Loads a 16 bit value at `addr`. Uses the fastmem page table if possible
 func (inter *Interconnect) Load16(addr uint32, th *TimeHandler) uint16 {
-	return inter.Load(addr, ACCESS_HALFWORD, th).(uint16)
+	if page, offset := inter.fastmemPage(addr, 2); page != nil {
+		th.Tick(page.Timing.Halfword)
+		data := page.Data[offset : offset+2]
+		return uint16(data[0]) | uint16(data[1])<<8
+	}
+	return uint16(inter.Load(addr, ACCESS_HALFWORD, th))
 }
 
-// Shortcut for inter.Load(addr, ACCESS_BYTE).(byte)
+// Loads the byte at `addr`. Uses the fastmem page table if possible
 func (inter *Interconnect) Load8(addr uint32, th *TimeHandler) byte {
-	return inter.Load(addr, ACCESS_BYTE, th).(byte)
+	if page, offset := inter.fastmemPage(addr, 1); page != nil {
+		th.Tick(page.Timing.Byte)
+		return page.Data[offset]
+	}
+	return uint8(inter.Load(addr, ACCESS_BYTE, th))
 }
 
-// Shortcut for inter.Store(addr, ACCESS_WORD, val)
+// Stores a 32 bit value into `addr`. Uses the fastmem page table if possible
 func (inter *Interconnect) Store32(addr, val uint32, th *TimeHandler) {
+	if page, offset := inter.fastmemPage(addr, 4); page != nil && page.Writable {
+		inter.fastmemWrite(page, offset)
+		data := page.Data[offset : offset+4]
+		data[0] = byte(val)
+		data[1] = byte(val >> 8)
+		data[2] = byte(val >> 16)
+		data[3] = byte(val >> 24)
+		return
+	}
 	inter.Store(addr, ACCESS_WORD, val, th)
 }
 
-// Shortcut for inter.Store(addr, ACCESS_HALFWORD, val)
+// Stores a 16 bit value into `addr`. Uses the fastmem page table if possible
 func (inter *Interconnect) Store16(addr uint32, val uint16, th *TimeHandler) {
-	inter.Store(addr, ACCESS_HALFWORD, val, th)
+	if page, offset := inter.fastmemPage(addr, 2); page != nil && page.Writable {
+		inter.fastmemWrite(page, offset)
+		data := page.Data[offset : offset+2]
+		data[0] = byte(val)
+		data[1] = byte(val >> 8)
+		return
+	}
+	inter.Store(addr, ACCESS_HALFWORD, uint32(val), th)
 }
 
-// Shortcut for inter.Store(addr, ACCESS_BYTE, val)
+// Stores the byte `val` into `addr`. Uses the fastmem page table if possible
 func (inter *Interconnect) Store8(addr uint32, val byte, th *TimeHandler) {
-	inter.Store(addr, ACCESS_BYTE, val, th)
+	if page, offset := inter.fastmemPage(addr, 1); page != nil && page.Writable {
+		inter.fastmemWrite(page, offset)
+		page.Data[offset] = val
+		return
+	}
+	inter.Store(addr, ACCESS_BYTE, uint32(val), th)
 }
 
 func MaskRegion(addr uint32) uint32 {
@@ -294,7 +417,7 @@ func (inter *Interconnect) DmaReg(offset uint32) uint32 {
 	return res >> (align * 8)
 }
 
-func (inter *Interconnect) SetDmaReg(offset, val uint32) {
+func (inter *Interconnect) SetDmaReg(offset, val uint32, th *TimeHandler) {
 	// byte and halfword writes are threated like word writes with the *entire*
 	// Word value shifted by the alignment
 	align := offset & 3
@@ -304,12 +427,10 @@ func (inter *Interconnect) SetDmaReg(offset, val uint32) {
 	major := (offset & 0x70) >> 4
 	minor := offset & 0xf
 	var isActive bool
-	var port Port
 
 	switch {
 	case major <= 6: // per-channel registers
-		port = PortFromIndex(major)
-		channel := inter.Dma.Channels[port]
+		channel := inter.Dma.Channels[PortFromIndex(major)]
 
 		switch minor {
 		case 0:
@@ -327,39 +448,111 @@ func (inter *Interconnect) SetDmaReg(offset, val uint32) {
 		switch minor {
 		case 0:
 			inter.Dma.SetControl(val)
+			// a channel waiting for its master enable bit may start
+			isActive = true
 		case 4:
 			inter.Dma.SetInterrupt(val, inter.IrqState)
 		default:
 			panicFmt("inter: unhandled DMA write 0x%x <- 0x%x", offset, val)
 		}
-		isActive = false
 	default:
 		panicFmt("inter: unhandled DMA write 0x%x <- 0x%x", offset, val)
 	}
 
 	if isActive {
-		inter.DoDma(port)
+		inter.RunDma(th)
 	}
 }
 
-// Execute a DMA transfer for a port
-func (inter *Interconnect) DoDma(port Port) {
-	// DMA transfer has been started, for now just process
-	// everything in one pass (no chopping or priority handling)
+// Runs the DMA transfers that are ready, by priority. Chopped transfers run
+// one chunk at a time and let the CPU run for a while in between, the next
+// chunk is scheduled on the time handler. Other transfers run in one pass.
+// A transfer completes (and raises its interrupt) once the time it takes to
+// send its words has passed
+func (inter *Interconnect) RunDma(th *TimeHandler) {
+	for i, channel := range inter.Dma.Channels {
+		if channel.Finishing && channel.DoneAt <= th.Cycles {
+			inter.Dma.Done(Port(i), inter.IrqState)
+		}
+	}
+
+	for {
+		port, ok := inter.Dma.NextChannel(th.Cycles)
+		if !ok {
+			break
+		}
+		inter.DoDma(port, th)
+	}
+
+	if next, ok := inter.Dma.NextEvent(); ok {
+		th.SetNextSyncDelta(PERIPHERAL_DMA, next-th.Cycles)
+	} else {
+		th.RemoveNextSync(PERIPHERAL_DMA)
+	}
+}
 
+// Execute a DMA transfer for a port. Chopped transfers only transfer one
+// chunk
+func (inter *Interconnect) DoDma(port Port, th *TimeHandler) {
 	channel := inter.Dma.Channels[port]
-	switch channel.Sync {
-	case SYNC_LINKED_LIST:
-		inter.DoDmaLinkedList(port)
+	Log.Debugf(LOG_MODULE_DMA, "transfer on port %d, sync mode %d", port, channel.Sync)
+	var words uint32
+	switch {
+	case channel.Sync == SYNC_LINKED_LIST:
+		words = inter.DoDmaLinkedList(port)
+		inter.Dma.Words[port] += words
+	case channel.Chopped():
+		if !channel.Started {
+			channel.Start()
+		}
+		words = inter.DoDmaWords(port, channel.ChopWords())
+		inter.Dma.Words[port] += words
+		if channel.Remaining > 0 {
+			// let the CPU run until the next chunk
+			cycles := inter.DmaCycles(port, words)
+			inter.Profiler.AddCycles(PROFILE_DMA, cycles)
+			channel.NextChunk = th.Cycles + cycles + channel.ChopCycles()
+			return
+		}
 	default:
-		inter.DoDmaBlock(port)
+		words = inter.DoDmaBlock(port)
+		inter.Dma.Words[port] += words
 	}
 
-	inter.Dma.Done(port, inter.IrqState)
+	cycles := inter.DmaCycles(port, words)
+	inter.Profiler.AddCycles(PROFILE_DMA, cycles)
+	channel.Finish(th.Cycles + cycles)
+}
+
+// Returns the time it takes to transfer `words` words through `port`. The
+// CD-ROM and SPU buses are slower than RAM and use their memory delays
+func (inter *Interconnect) DmaCycles(port Port, words uint32) uint64 {
+	var perWord uint64 = 1
+	switch port {
+	case PORT_CDROM:
+		perWord = inter.Timings.CdRom.Word
+	case PORT_SPU:
+		perWord = inter.Timings.Spu.Word
+	}
+	return uint64(words) * perWord
 }
 
-// Emulates DMA transfer for Manual and Request synchronization modes
-func (inter *Interconnect) DoDmaBlock(port Port) {
+// Emulates DMA transfer for Manual and Request synchronization modes.
+// Returns the amount of words transferred
+func (inter *Interconnect) DoDmaBlock(port Port) uint32 {
+	channel := inter.Dma.Channels[port]
+	if channel.Sync == SYNC_LINKED_LIST {
+		// shouldn't happen since we shouldn't reach this if we're in linked list mode
+		panic("inter: couldn't figure out DMA block transfer size (linked mode)")
+	}
+
+	channel.Start()
+	return inter.DoDmaWords(port, channel.Remaining)
+}
+
+// Transfers up to `count` words of a started block transfer. Returns the
+// amount of words transferred
+func (inter *Interconnect) DoDmaWords(port Port, count uint32) uint32 {
 	channel := inter.Dma.Channels[port]
 
 	var addrStep uint32 = 4
@@ -372,16 +565,14 @@ func (inter *Interconnect) DoDmaBlock(port Port) {
 		isReverse = true // -=
 	}
 
-	addr := channel.Base
-
-	// transfer size in words
-	valid, remsz := channel.TransferSize()
-	if !valid {
-		// shouldn't happen since we shouldn't reach this if we're in linked list mode
-		panic("inter: couldn't figure out DMA block transfer size (linked mode)")
+	addr := channel.Addr
+	remsz := channel.Remaining
+	if count > remsz {
+		count = remsz
 	}
+	end := remsz - count
 
-	for remsz > 0 {
+	for remsz > end {
 		// if the address is bogus, Mednafen masks it like this,
 		// maybe the RAM address wraps and the two LSBs are ignored,
 		// seems reasonable enough
@@ -390,9 +581,12 @@ func (inter *Interconnect) DoDmaBlock(port Port) {
 		switch channel.Direction {
 		case DIRECTION_FROM_RAM:
 			srcWord := inter.Ram.Load32(curAddr)
+			inter.HeatMap.dma(curAddr)
 			switch port {
 			case PORT_GPU:
 				inter.Gpu.GP0(srcWord)
+			case PORT_SPU:
+				inter.Spu.DmaWrite(srcWord)
 			default:
 				panicFmt("inter: unhandled DMA destination port %d", port)
 			}
@@ -409,16 +603,17 @@ func (inter *Interconnect) DoDmaBlock(port Port) {
 					srcWord = (addr - 4) & 0x1fffff
 				}
 			case PORT_GPU:
-				// FIXME
-				// fmt.Println("dma: unhandled GPU read")
-				srcWord = 0
+				srcWord = inter.Gpu.Read()
 			case PORT_CDROM:
 				srcWord = inter.CdRom.DmaReadWord()
+			case PORT_SPU:
+				srcWord = inter.Spu.DmaRead()
 			default:
 				panicFmt("inter: unhandled DMA source port %d", port)
 			}
 
 			inter.Ram.Store32(curAddr, srcWord)
+			inter.HeatMap.dma(curAddr)
 		}
 
 		if isReverse {
@@ -428,10 +623,18 @@ func (inter *Interconnect) DoDmaBlock(port Port) {
 		}
 		remsz--
 	}
+	if port == PORT_SPU {
+		inter.Spu.MaybeRaiseIrq(inter.IrqState)
+	}
+
+	channel.Addr = addr
+	channel.Remaining = remsz
+	return count
 }
 
-// Emulate DMA transfer for linked list synchronization mode
-func (inter *Interconnect) DoDmaLinkedList(port Port) {
+// Emulate DMA transfer for linked list synchronization mode. Returns the
+// amount of words transferred, including the headers
+func (inter *Interconnect) DoDmaLinkedList(port Port) uint32 {
 	channel := inter.Dma.Channels[port]
 	addr := channel.Base & 0x1ffffc
 
@@ -445,16 +648,20 @@ func (inter *Interconnect) DoDmaLinkedList(port Port) {
 		panicFmt("inter: attempted DMA linked list on port %d (expected %d)", port, PORT_GPU)
 	}
 
+	var words uint32
 	for {
 		// in linked list mode, each entry starts with a "header" word.
 		// The high byte contains the number of words in the "packet"
 		// (not counting the header word)
 		header := inter.Ram.Load32(addr)
+		inter.HeatMap.dma(addr)
 		remsz := header >> 24
+		words += remsz + 1
 
 		for remsz > 0 {
 			addr = (addr + 4) & 0x1ffffc
 			command := inter.Ram.Load32(addr)
+			inter.HeatMap.dma(addr)
 
 			// send command to the GPU
 			inter.Gpu.GP0(command)
@@ -472,35 +679,73 @@ func (inter *Interconnect) DoDmaLinkedList(port Port) {
 
 		addr = header & 0x1ffffc
 	}
+	return words
 }
 
 // Synchronizes all peripherals
 func (inter *Interconnect) Sync(th *TimeHandler) {
+	prof := inter.Profiler
 	if th.NeedsSync(PERIPHERAL_GPU) {
+		start := prof.Start()
+		inVBlank := inter.Gpu.VBlankInterrupt
 		inter.Gpu.Sync(th, inter.IrqState)
+
+		if !inVBlank && inter.Gpu.VBlankInterrupt {
+			inter.Cheats.Apply(inter.Ram)
+			inter.Achievements.Frame(inter.Ram, inter.ScratchPad)
+		}
+		prof.Stop(PROFILE_GPU, start)
 	}
+
+	start := prof.Start()
 	if th.NeedsSync(PERIPHERAL_PADMEMCARD) {
 		inter.PadMemCard.Sync(th, inter.IrqState)
 	}
-	inter.Timers.Sync(th, inter.IrqState)
+	inter.Timers.Sync(th, inter.IrqState, inter.Gpu)
+	prof.Stop(PROFILE_OTHER, start)
+
 	if th.NeedsSync(PERIPHERAL_CDROM) {
+		start := prof.Start()
 		inter.CdRom.Sync(th, inter.IrqState)
+		// the reverb of the CD audio can access the IRQ address
+		inter.Spu.MaybeRaiseIrq(inter.IrqState)
+		prof.Stop(PROFILE_CDROM, start)
+	}
+	if th.NeedsSync(PERIPHERAL_SPU) {
+		start := prof.Start()
+		inter.Spu.Sync(th, inter.IrqState)
+		prof.Stop(PROFILE_OTHER, start)
+	}
+	if th.NeedsSync(PERIPHERAL_DMA) {
+		start := prof.Start()
+		inter.RunDma(th)
+		prof.Stop(PROFILE_DMA, start)
 	}
+
+	start = prof.Start()
+	inter.Sio1.Poll(inter.IrqState)
+	prof.Stop(PROFILE_OTHER, start)
 }
 
 // Load instruction at `pc`
 func (inter *Interconnect) LoadInstruction(pc uint32) uint32 {
 	absAddr := MaskRegion(pc)
 
-	// TODO: currently only loads instructions from RAM and the BIOS
-
 	if ok, offset := RAM_RANGE.ContainsAndOffset(absAddr); ok {
+		switch inter.RamAccess(offset) {
+		case RAM_ACCESS_HIGHZ:
+			return RAM_HIGHZ_VALUE
+		case RAM_ACCESS_LOCKED:
+			return inter.unmappedAccess(pc, "instruction fetch")
+		}
 		return inter.Ram.Load32(offset)
 	}
 	if ok, offset := BIOS_RANGE.ContainsAndOffset(absAddr); ok {
 		return inter.Bios.Load32(offset)
 	}
+	if ok, offset := EXPANSION_1_RANGE.ContainsAndOffset(absAddr); ok {
+		return inter.Expansion.Load1(offset, ACCESS_WORD)
+	}
 
-	panicFmt("inter: unhandled instruction load at address 0x%x", pc)
-	return 0
+	return inter.unmappedAccess(pc, "instruction fetch")
 }
@@ -0,0 +1,57 @@
+package emulator
+
+// Value of the RAM_SIZE register after a reset, the BIOS writes the same
+// value: 8MB window with the 2MB of RAM mirrored four times
+const RAMSIZE_DEFAULT = 0xb88
+
+// What's found at an offset of the 8MB RAM window, depends on the RAM_SIZE
+// register
+type RamAccess int
+
+const (
+	RAM_ACCESS_MAPPED RamAccess = iota // RAM, mirrored every 2MB
+	RAM_ACCESS_HIGHZ  RamAccess = iota // Nothing drives the bus, writes are lost
+	RAM_ACCESS_LOCKED RamAccess = iota // Accesses trigger a bus error
+)
+
+// Size of the memory and high-Z parts of the 8MB window for every value of
+// bits [11:9] of RAM_SIZE, the rest of the window is locked
+var ramSizeWindows = [8]struct{ Memory, HighZ uint32 }{
+	{1 << 20, 0},       // 1MB memory, 7MB locked
+	{4 << 20, 0},       // 4MB memory, 4MB locked
+	{1 << 20, 1 << 20}, // 1MB memory, 1MB high-Z, 6MB locked
+	{4 << 20, 4 << 20}, // 4MB memory, 4MB high-Z
+	{2 << 20, 0},       // 2MB memory, 6MB locked
+	{8 << 20, 0},       // 8MB memory
+	{2 << 20, 2 << 20}, // 2MB memory, 2MB high-Z, 4MB locked
+	{8 << 20, 0},       // 8MB memory
+}
+
+// Value read from the high-Z part of the RAM window
+const RAM_HIGHZ_VALUE = 0xffffffff
+
+// Returns the size of the part of the RAM window that maps RAM
+func (inter *Interconnect) RamWindow() uint32 {
+	return ramSizeWindows[(inter.RamSize>>9)&7].Memory
+}
+
+// Returns what an access at `offset` in the 8MB RAM window reaches
+func (inter *Interconnect) RamAccess(offset uint32) RamAccess {
+	window := ramSizeWindows[(inter.RamSize>>9)&7]
+	switch {
+	case offset < window.Memory:
+		return RAM_ACCESS_MAPPED
+	case offset < window.Memory+window.HighZ:
+		return RAM_ACCESS_HIGHZ
+	}
+	return RAM_ACCESS_LOCKED
+}
+
+// Sets the RAM_SIZE register. The fastmem mapping follows the new window
+func (inter *Interconnect) SetRamSize(val uint32) {
+	remap := (val^inter.RamSize)&(7<<9) != 0
+	inter.RamSize = val
+	if remap {
+		inter.MapFastmem()
+	}
+}
@@ -0,0 +1,163 @@
+package emulator
+
+// Memory control registers (index into Interconnect.MemControl)
+const (
+	MEMCONTROL_EXP1_BASE   = 0 // Expansion 1 base address
+	MEMCONTROL_EXP2_BASE   = 1 // Expansion 2 base address
+	MEMCONTROL_EXP1_DELAY  = 2 // Expansion 1 delay/size
+	MEMCONTROL_EXP3_DELAY  = 3 // Expansion 3 delay/size
+	MEMCONTROL_BIOS_DELAY  = 4 // BIOS ROM delay/size
+	MEMCONTROL_SPU_DELAY   = 5 // SPU delay/size
+	MEMCONTROL_CDROM_DELAY = 6 // CD-ROM delay/size
+	MEMCONTROL_EXP2_DELAY  = 7 // Expansion 2 delay/size
+	MEMCONTROL_COM_DELAY   = 8 // Common delays shared by all regions
+)
+
+const (
+	RAM_LOAD_CYCLES        = 5 // Average RAM load delay
+	RAM_FETCH_CYCLES       = 4 // Average uncached instruction fetch delay from RAM
+	SCRATCHPAD_LOAD_CYCLES = 0 // The scratchpad is on the CPU die
+	IO_LOAD_CYCLES         = 5 // Peripheral registers without a delay register
+)
+
+// Load delays of a memory region in CPU cycles, per access size
+type AccessTiming struct {
+	Byte     uint64
+	Halfword uint64
+	Word     uint64
+}
+
+// Returns a timing where every access size takes `cycles`
+func NewFixedTiming(cycles uint64) AccessTiming {
+	return AccessTiming{cycles, cycles, cycles}
+}
+
+// Returns the delay of an access of `size`
+func (timing *AccessTiming) Cycles(size AccessSize) uint64 {
+	switch size {
+	case ACCESS_BYTE:
+		return timing.Byte
+	case ACCESS_HALFWORD:
+		return timing.Halfword
+	default:
+		return timing.Word
+	}
+}
+
+// Load delays of every memory region. The BIOS, expansion, SPU and CD-ROM
+// delays depend on the memory control registers
+type MemoryTimings struct {
+	Ram        AccessTiming
+	ScratchPad AccessTiming
+	Io         AccessTiming
+	Bios       AccessTiming
+	Exp1       AccessTiming
+	Exp2       AccessTiming
+	Spu        AccessTiming
+	CdRom      AccessTiming
+}
+
+// Computes the load delays of a region from its delay/size register
+// (`delay`) and the common delay register (`com`)
+func NewDelayTiming(delay, com uint32) AccessTiming {
+	readDelay := int64((delay >> 4) & 0xf)
+	com0 := int64(com & 0xf)
+	com2 := int64((com >> 8) & 0xf)
+	com3 := int64((com >> 12) & 0xf)
+
+	// the first access and the following sequential accesses (used when
+	// the access is wider than the data bus)
+	var first, seq, min int64
+	if delay&(1<<8) != 0 {
+		// recovery period
+		first += com0 - 1
+		seq += com0 - 1
+	}
+	if delay&(1<<10) != 0 {
+		// floating release
+		first += com2
+		seq += com2
+	}
+	if delay&(1<<11) != 0 {
+		// pre-strobe
+		min = com3
+	}
+	if first < 6 {
+		first++
+	}
+
+	first += readDelay + 2
+	seq += readDelay + 2
+	if first < min+6 {
+		first = min + 6
+	}
+	if seq < min+2 {
+		seq = min + 2
+	}
+
+	// 8 bit bus: halfwords take 2 accesses and words take 4
+	halfword := first + seq
+	word := first + 3*seq
+	if delay&(1<<12) != 0 {
+		// 16 bit bus
+		halfword = first
+		word = first + seq
+	}
+
+	return AccessTiming{
+		Byte:     uint64(maxInt64(first-1, 0)),
+		Halfword: uint64(maxInt64(halfword-1, 0)),
+		Word:     uint64(maxInt64(word-1, 0)),
+	}
+}
+
+// Recomputes the load delays from the memory control registers. Called when
+// they're written
+func (inter *Interconnect) UpdateTimings() {
+	com := inter.MemControl[MEMCONTROL_COM_DELAY]
+	timings := &inter.Timings
+
+	timings.Ram = NewFixedTiming(RAM_LOAD_CYCLES)
+	timings.ScratchPad = NewFixedTiming(SCRATCHPAD_LOAD_CYCLES)
+	timings.Io = NewFixedTiming(IO_LOAD_CYCLES)
+	timings.Bios = NewDelayTiming(inter.MemControl[MEMCONTROL_BIOS_DELAY], com)
+	timings.Exp1 = NewDelayTiming(inter.MemControl[MEMCONTROL_EXP1_DELAY], com)
+	timings.Exp2 = NewDelayTiming(inter.MemControl[MEMCONTROL_EXP2_DELAY], com)
+	timings.Spu = NewDelayTiming(inter.MemControl[MEMCONTROL_SPU_DELAY], com)
+	timings.CdRom = NewDelayTiming(inter.MemControl[MEMCONTROL_CDROM_DELAY], com)
+}
+
+// Returns the load delays of the region containing `absAddr` (an address
+// with the region bits masked out)
+func (inter *Interconnect) LoadTiming(absAddr uint32) *AccessTiming {
+	timings := &inter.Timings
+	switch {
+	case RAM_RANGE.Contains(absAddr):
+		return &timings.Ram
+	case BIOS_RANGE.Contains(absAddr):
+		return &timings.Bios
+	case SCRATCHPAD_RANGE.Contains(absAddr):
+		return &timings.ScratchPad
+	case EXPANSION_1_RANGE.Contains(absAddr):
+		return &timings.Exp1
+	case EXPANSION_2_RANGE.Contains(absAddr):
+		return &timings.Exp2
+	case SPU_RANGE.Contains(absAddr):
+		return &timings.Spu
+	case CDROM_RANGE.Contains(absAddr):
+		return &timings.CdRom
+	}
+	return &timings.Io
+}
+
+// Returns the delay of an uncached instruction fetch at `pc`
+func (inter *Interconnect) FetchCycles(pc uint32) uint64 {
+	absAddr := MaskRegion(pc)
+	if BIOS_RANGE.Contains(absAddr) {
+		return inter.Timings.Bios.Word
+	}
+	if EXPANSION_1_RANGE.Contains(absAddr) {
+		return inter.Timings.Exp1.Word
+	}
+	return RAM_FETCH_CYCLES
+}
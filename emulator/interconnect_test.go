@@ -0,0 +1,174 @@
+package emulator
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func newBenchInterconnect() *Interconnect {
+	bios, _ := LoadBIOSFromData(make([]byte, BIOS_SIZE))
+	return NewInterconnect(bios, NewRAM(), NewGPU(HARDWARE_NTSC), nil)
+}
+
+func BenchmarkInterconnectLoad32(b *testing.B) {
+	inter := newBenchInterconnect()
+	th := NewTimeHandler()
+
+	for i := 0; i < b.N; i++ {
+		inter.Load32(0x80000000|uint32(i<<2)&0x1ffffc, th)
+	}
+}
+
+func BenchmarkInterconnectLoad8(b *testing.B) {
+	inter := newBenchInterconnect()
+	th := NewTimeHandler()
+
+	for i := 0; i < b.N; i++ {
+		inter.Load8(0x80000000|uint32(i)&0x1fffff, th)
+	}
+}
+
+func BenchmarkInterconnectStore32(b *testing.B) {
+	inter := newBenchInterconnect()
+	th := NewTimeHandler()
+
+	for i := 0; i < b.N; i++ {
+		inter.Store32(0x80000000|uint32(i<<2)&0x1ffffc, uint32(i), th)
+	}
+}
+
+func BenchmarkInterconnectBiosLoad32(b *testing.B) {
+	inter := newBenchInterconnect()
+	th := NewTimeHandler()
+
+	for i := 0; i < b.N; i++ {
+		inter.Load32(0xbfc00000|uint32(i<<2)&0x7fffc, th)
+	}
+}
+
+func TestInterconnectBiosTiming(t *testing.T) {
+	inter := newBenchInterconnect()
+	th := NewTimeHandler()
+
+	// values written by the BIOS at boot
+	inter.Store32(0x1f801020, 0x00031125, th)
+	inter.Store32(0x1f801010, 0x0013243f, th)
+
+	expected := AccessTiming{Byte: 6, Halfword: 12, Word: 24}
+	if inter.Timings.Bios != expected {
+		t.Errorf("expected BIOS timing %+v, got %+v", expected, inter.Timings.Bios)
+	}
+
+	inter.Load32(0xbfc00000, th)
+	if th.Cycles != expected.Word {
+		t.Errorf("expected a BIOS load to take %d cycles, took %d", expected.Word, th.Cycles)
+	}
+}
+
+func TestInterconnectDmaCompletion(t *testing.T) {
+	inter := newBenchInterconnect()
+	th := NewTimeHandler()
+
+	inter.Store32(0x1f8010f0, 0x08000000, th) // enable OTC
+	inter.Store32(0x1f8010f4, 0x00c00000, th) // enable the OTC interrupt
+	inter.Store32(0x1f8010e0, 0x100, th)
+	inter.Store32(0x1f8010e4, 16, th)
+	inter.Store32(0x1f8010e8, 0x11000002, th) // start, decrement
+
+	channel := inter.Dma.Channels[PORT_OTC]
+	if !channel.Active() || inter.Dma.Irq() {
+		t.Fatal("OTC transfer completed before its words were sent")
+	}
+
+	th.Tick(16)
+	inter.Sync(th)
+	if channel.Active() || !inter.Dma.Irq() {
+		t.Fatal("OTC transfer didn't complete after 16 cycles")
+	}
+
+	// acknowledge the OTC flag
+	inter.Store32(0x1f8010f4, 0x40c00000, th)
+	if inter.Dma.Irq() {
+		t.Error("OTC interrupt flag wasn't acknowledged")
+	}
+}
+
+func TestInterconnectCartridge(t *testing.T) {
+	inter := newBenchInterconnect()
+	th := NewTimeHandler()
+
+	if val := inter.Load32(0x1f000084, th); val != 0xffffffff {
+		t.Errorf("expected an empty expansion port to read 0xffffffff, got 0x%x", val)
+	}
+
+	rom := make([]byte, 0x100)
+	copy(rom[0x84:], "Licensed by Sony Computer Entertainment Inc.")
+	if err := inter.Expansion.LoadCartridge(bytes.NewReader(rom)); err != nil {
+		t.Fatal(err)
+	}
+	if val := inter.Load32(0x1f000084, th); val != 0x6563694c { // "Lice"
+		t.Errorf("unexpected cartridge word 0x%x", val)
+	}
+	if val := inter.LoadInstruction(0xbf000084); val != 0x6563694c {
+		t.Errorf("unexpected cartridge instruction 0x%x", val)
+	}
+
+	err := inter.Expansion.LoadCartridge(bytes.NewReader(make([]byte, 1024*1024)))
+	if !errors.Is(err, ErrInvalidCartridgeSize) {
+		t.Errorf("expected ErrInvalidCartridgeSize, got %v", err)
+	}
+}
+
+func TestInterconnectRamSize(t *testing.T) {
+	inter := newBenchInterconnect()
+	th := NewTimeHandler()
+
+	// the default 8MB window mirrors RAM four times
+	inter.Store32(0x80000100, 0x12345678, th)
+	if val := inter.Load32(0x80600100, th); val != 0x12345678 {
+		t.Errorf("expected the 8MB window to mirror RAM, got 0x%x", val)
+	}
+
+	// 2MB memory, 2MB high-Z, 4MB locked
+	inter.Store32(0x1f801060, 6<<9, th)
+	if val := inter.Load32(0x80000100, th); val != 0x12345678 {
+		t.Errorf("expected RAM in the first 2MB, got 0x%x", val)
+	}
+	inter.Store32(0x80200100, 0, th)
+	if val := inter.Load32(0x80200100, th); val != RAM_HIGHZ_VALUE || inter.BusError {
+		t.Errorf("expected a high-Z read without a bus error, got 0x%x", val)
+	}
+	if val := inter.Load32(0x80000100, th); val != 0x12345678 {
+		t.Errorf("write to the high-Z part reached RAM: 0x%x", val)
+	}
+	inter.Load32(0x80400100, th)
+	if !inter.BusError {
+		t.Error("expected a bus error in the locked part")
+	}
+}
+
+func TestInterconnectUnmapped(t *testing.T) {
+	inter := newBenchInterconnect()
+	th := NewTimeHandler()
+
+	inter.Load32(0x1f900000, th)
+	if !inter.BusError {
+		t.Error("expected a bus error on an unmapped load")
+	}
+
+	inter.BusError = false
+	inter.Unmapped = UNMAPPED_IGNORE
+	inter.Store32(0x1f900000, 0, th)
+	if val := inter.Load32(0x1f900000, th); val != 0 || inter.BusError {
+		t.Errorf("expected ignored accesses to read 0 without a bus error, got 0x%x", val)
+	}
+
+	inter.Unmapped = UNMAPPED_PANIC
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic")
+		}
+	}()
+	inter.Load32(0x1f900000, th)
+}
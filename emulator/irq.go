@@ -1,42 +1,35 @@
 package emulator
 
-// State of the interrupt register
-type IrqState struct {
-	Status uint16 // Interrupt status
-	Mask   uint16 // Interrupt mask
-}
+import "github.com/zeozeozeo/gopsx/emulator/bus"
+
+// The interrupt controller is in the bus package so the peripherals can be
+// used without the rest of the emulator, see bus.IrqState
+type (
+	IrqState  = bus.IrqState
+	Interrupt = bus.Interrupt
+	IrqLine   = bus.IrqLine
+)
 
-// Represents an interrupt state
-type Interrupt uint16
+const (
+	INTERRUPT_VBLANK     = bus.INTERRUPT_VBLANK
+	INTERRUPT_GPU        = bus.INTERRUPT_GPU
+	INTERRUPT_CDROM      = bus.INTERRUPT_CDROM
+	INTERRUPT_DMA        = bus.INTERRUPT_DMA
+	INTERRUPT_TIMER0     = bus.INTERRUPT_TIMER0
+	INTERRUPT_TIMER1     = bus.INTERRUPT_TIMER1
+	INTERRUPT_TIMER2     = bus.INTERRUPT_TIMER2
+	INTERRUPT_PADMEMCARD = bus.INTERRUPT_PADMEMCARD
+	INTERRUPT_SIO        = bus.INTERRUPT_SIO
+	INTERRUPT_SPU        = bus.INTERRUPT_SPU
+	INTERRUPT_LIGHTPEN   = bus.INTERRUPT_LIGHTPEN
+)
 
 const (
-	INTERRUPT_VBLANK     Interrupt = 0 // GPU is in vertical blanking
-	INTERRUPT_CDROM      Interrupt = 2 // CD-ROM controller
-	INTERRUPT_DMA        Interrupt = 3 // DMA transfer complete
-	INTERRUPT_TIMER0     Interrupt = 4 // Timer 0 interrupt
-	INTERRUPT_TIMER1     Interrupt = 5 // Timer 0 interrupt
-	INTERRUPT_TIMER2     Interrupt = 6 // Timer 0 interrupt
-	INTERRUPT_PADMEMCARD Interrupt = 7 // Gamepad and memory card controllers
+	IRQ_COUNT = bus.IRQ_COUNT
+	IRQ_MASK  = bus.IRQ_MASK
 )
 
 // Returns a new interrupt instance
 func NewIrqState() *IrqState {
-	return &IrqState{}
-}
-
-// Returns true if any interrupt is active
-func (state *IrqState) Active() bool {
-	return (state.Status & state.Mask) != 0
-}
-
-func (state *IrqState) Acknowledge(ack uint16) {
-	state.Status &= ack
-}
-
-func (state *IrqState) SetMask(mask uint16) {
-	state.Mask = mask
-}
-
-func (state *IrqState) SetHigh(interrupt Interrupt) {
-	state.Status |= 1 << interrupt
+	return bus.NewIrqState()
 }
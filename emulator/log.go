@@ -0,0 +1,217 @@
+package emulator
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Severity of a log message. A module only prints the messages at or below
+// its level
+type LogLevel uint8
+
+const (
+	LOG_LEVEL_OFF   LogLevel = iota // Nothing is printed
+	LOG_LEVEL_ERROR LogLevel = iota // The emulation is probably broken
+	LOG_LEVEL_WARN  LogLevel = iota // Unhandled or unusual hardware use
+	LOG_LEVEL_INFO  LogLevel = iota // Connections, discs, breakpoints...
+	LOG_LEVEL_DEBUG LogLevel = iota // Internal state, very verbose
+)
+
+// Emulator subsystem that a log message comes from
+type LogModule uint8
+
+const (
+	LOG_MODULE_CPU   LogModule = iota // CPU, GTE and debugger
+	LOG_MODULE_GPU   LogModule = iota // GPU
+	LOG_MODULE_CDROM LogModule = iota // CD-ROM controller and disc images
+	LOG_MODULE_DMA   LogModule = iota // DMA
+	LOG_MODULE_PAD   LogModule = iota // Controllers and memory cards
+	LOG_MODULE_INTER LogModule = iota // Memory bus and the other peripherals
+	LOG_MODULE_NET   LogModule = iota // Netplay and serial link
+	LOG_MODULE_COUNT LogModule = iota // Amount of modules
+)
+
+const (
+	LOG_DEFAULT_LEVEL = LOG_LEVEL_INFO // Level of every module at startup
+	LOG_HISTORY_SIZE  = 16             // Messages kept for Logger.Recent
+)
+
+// Names of the modules and levels, used as the message prefix and by
+// Logger.Configure
+var (
+	LOG_MODULE_NAMES = [LOG_MODULE_COUNT]string{"cpu", "gpu", "cdrom", "dma", "pad", "inter", "net"}
+	LOG_LEVEL_NAMES  = [...]string{"off", "error", "warn", "info", "debug"}
+)
+
+// A message printed by the logger
+type LogMessage struct {
+	Module LogModule
+	Level  LogLevel
+	Text   string // Formatted message, without the module prefix
+}
+
+// Returns the message as it's printed, e.g. "cdrom: read while already
+// reading"
+func (msg LogMessage) String() string {
+	return LOG_MODULE_NAMES[msg.Module] + ": " + msg.Text
+}
+
+// Leveled logger with a level per module. It can be used from any
+// goroutine
+type Logger struct {
+	mu     sync.Mutex
+	levels [LOG_MODULE_COUNT]LogLevel
+	output io.Writer
+	recent []LogMessage // Last LOG_HISTORY_SIZE messages, oldest first
+}
+
+// Logger used by the emulator. Set with GOPSX_LOG, see Logger.Configure
+var Log = NewLogger()
+
+// Returns a logger that prints the messages at LOG_DEFAULT_LEVEL to stdout.
+// The levels are then taken from the GOPSX_LOG environment variable
+func NewLogger() *Logger {
+	logger := &Logger{output: os.Stdout}
+	logger.SetLevel(LOG_DEFAULT_LEVEL)
+	if spec := os.Getenv("GOPSX_LOG"); spec != "" {
+		if err := logger.Configure(spec); err != nil {
+			fmt.Printf("log: GOPSX_LOG: %s\n", err)
+		}
+	}
+	return logger
+}
+
+// Sets the level of every module
+func (logger *Logger) SetLevel(level LogLevel) {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	for i := range logger.levels {
+		logger.levels[i] = level
+	}
+}
+
+// Sets the level of `module`
+func (logger *Logger) SetModuleLevel(module LogModule, level LogLevel) {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	logger.levels[module] = level
+}
+
+// Returns the level of `module`
+func (logger *Logger) Level(module LogModule) LogLevel {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	return logger.levels[module]
+}
+
+// Returns true if a message of `level` from `module` would be printed
+func (logger *Logger) Enabled(module LogModule, level LogLevel) bool {
+	return level != LOG_LEVEL_OFF && level <= logger.Level(module)
+}
+
+// Sets where the messages are written, e.g. a file. `output` can be nil to
+// only keep them for Recent
+func (logger *Logger) SetOutput(output io.Writer) {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	logger.output = output
+}
+
+// Sets the levels from a comma separated list like "warn,cdrom=debug". A
+// level without a module applies to every module
+func (logger *Logger) Configure(spec string) error {
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, levelName, hasModule := strings.Cut(entry, "=")
+		if !hasModule {
+			levelName = name
+		}
+		level, ok := parseLogLevel(levelName)
+		if !ok {
+			return fmt.Errorf("unknown log level \"%s\"", levelName)
+		}
+		if !hasModule {
+			logger.SetLevel(level)
+			continue
+		}
+
+		module, ok := parseLogModule(name)
+		if !ok {
+			return fmt.Errorf("unknown log module \"%s\"", name)
+		}
+		logger.SetModuleLevel(module, level)
+	}
+	return nil
+}
+
+func parseLogLevel(name string) (LogLevel, bool) {
+	for i, levelName := range LOG_LEVEL_NAMES {
+		if name == levelName {
+			return LogLevel(i), true
+		}
+	}
+	return 0, false
+}
+
+func parseLogModule(name string) (LogModule, bool) {
+	for i, moduleName := range LOG_MODULE_NAMES {
+		if name == moduleName {
+			return LogModule(i), true
+		}
+	}
+	return 0, false
+}
+
+// Prints a message of `level` from `module` if the module level allows it
+func (logger *Logger) Printf(module LogModule, level LogLevel, format string, args ...interface{}) {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	if level == LOG_LEVEL_OFF || level > logger.levels[module] {
+		return
+	}
+
+	msg := LogMessage{Module: module, Level: level, Text: fmt.Sprintf(format, args...)}
+	if len(logger.recent) == LOG_HISTORY_SIZE {
+		copy(logger.recent, logger.recent[1:])
+		logger.recent = logger.recent[:LOG_HISTORY_SIZE-1]
+	}
+	logger.recent = append(logger.recent, msg)
+
+	if logger.output != nil {
+		fmt.Fprintln(logger.output, msg.String())
+	}
+}
+
+// Returns a copy of the last printed messages, oldest first
+func (logger *Logger) Recent() []LogMessage {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	return append([]LogMessage(nil), logger.recent...)
+}
+
+// Prints an error message from `module`
+func (logger *Logger) Errorf(module LogModule, format string, args ...interface{}) {
+	logger.Printf(module, LOG_LEVEL_ERROR, format, args...)
+}
+
+// Prints a warning from `module`
+func (logger *Logger) Warnf(module LogModule, format string, args ...interface{}) {
+	logger.Printf(module, LOG_LEVEL_WARN, format, args...)
+}
+
+// Prints an informational message from `module`
+func (logger *Logger) Infof(module LogModule, format string, args ...interface{}) {
+	logger.Printf(module, LOG_LEVEL_INFO, format, args...)
+}
+
+// Prints a debug message from `module`
+func (logger *Logger) Debugf(module LogModule, format string, args ...interface{}) {
+	logger.Printf(module, LOG_LEVEL_DEBUG, format, args...)
+}
@@ -0,0 +1,42 @@
+package emulator
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestLoggerLevels(t *testing.T) {
+	logger := NewLogger()
+	var out bytes.Buffer
+	logger.SetOutput(&out)
+
+	if err := logger.Configure("warn, cdrom=debug"); err != nil {
+		t.Fatal(err)
+	}
+	logger.Infof(LOG_MODULE_GPU, "hidden")
+	logger.Warnf(LOG_MODULE_GPU, "unhandled image store")
+	logger.Debugf(LOG_MODULE_CDROM, "push")
+
+	expected := "gpu: unhandled image store\ncdrom: push\n"
+	if out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+	if recent := logger.Recent(); len(recent) != 2 || recent[1].Module != LOG_MODULE_CDROM {
+		t.Errorf("unexpected recent messages %v", recent)
+	}
+
+	for i := 0; i < LOG_HISTORY_SIZE+4; i++ {
+		logger.Errorf(LOG_MODULE_CPU, "%d", i)
+	}
+	recent := logger.Recent()
+	if len(recent) != LOG_HISTORY_SIZE || recent[LOG_HISTORY_SIZE-1].Text != fmt.Sprint(LOG_HISTORY_SIZE+3) {
+		t.Errorf("expected the last %d messages, got %v", LOG_HISTORY_SIZE, recent)
+	}
+
+	for _, spec := range []string{"loud", "spu=debug"} {
+		if err := logger.Configure(spec); err == nil {
+			t.Errorf("expected an error for %q", spec)
+		}
+	}
+}
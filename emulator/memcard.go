@@ -0,0 +1,305 @@
+package emulator
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"strings"
+)
+
+const (
+	MEMCARD_SIZE       = 128 * 1024 // Size of a memory card image (.mcd)
+	MEMCARD_BLOCK_SIZE = 8 * 1024   // A save takes one or more blocks
+	MEMCARD_FRAME_SIZE = 128        // Blocks are made of 64 frames
+	MEMCARD_BLOCKS     = 15         // Blocks available for saves, block 0 is the directory
+	MEMCARD_ICON_SIZE  = 16         // Width and height of the save icons
+)
+
+// States of a directory entry (first byte of the directory frame)
+const (
+	MEMCARD_BLOCK_FIRST         = 0x51 // First block of a save
+	MEMCARD_BLOCK_MIDDLE        = 0x52 // Middle block of a save
+	MEMCARD_BLOCK_LAST          = 0x53 // Last block of a save
+	MEMCARD_BLOCK_FREE          = 0xa0 // Never used
+	MEMCARD_BLOCK_DELETED_FIRST = 0xa1 // First block of a deleted save
+	MEMCARD_BLOCK_DELETED_MID   = 0xa2 // Middle block of a deleted save
+	MEMCARD_BLOCK_DELETED_LAST  = 0xa3 // Last block of a deleted save
+)
+
+// Marks the last block of a save in the directory
+const MEMCARD_NO_NEXT_BLOCK = 0xffff
+
+// A memory card image, as stored in .mcd files. The first block holds the
+// directory, one 128 byte frame per block
+type MemoryCardImage struct {
+	Data [MEMCARD_SIZE]byte
+}
+
+// A save on a memory card
+type MemoryCardSave struct {
+	Block  int    // First block (0 to MEMCARD_BLOCKS-1)
+	Blocks []int  // All blocks of the save, in order
+	Name   string // File name, e.g. BASLUS-00067DRACULA
+	Size   uint32 // Size in bytes
+	Title  string // Title shown in the BIOS memory card manager
+	// Animation frames of the icon, MEMCARD_ICON_SIZE pixels wide and high
+	Icon []*image.RGBA
+}
+
+// Returns a new formatted memory card image
+func NewMemoryCardImage() *MemoryCardImage {
+	mc := &MemoryCardImage{}
+	copy(mc.Data[:], "MC")
+	mc.updateChecksum(mc.frame(0, 0))
+
+	for block := 0; block < MEMCARD_BLOCKS; block++ {
+		entry := mc.entry(block)
+		entry[0] = MEMCARD_BLOCK_FREE
+		binary.LittleEndian.PutUint16(entry[8:], MEMCARD_NO_NEXT_BLOCK)
+		mc.updateChecksum(entry)
+	}
+
+	// the broken sector list is empty
+	for i := 0; i < 20; i++ {
+		frame := mc.frame(0, 16+i)
+		binary.LittleEndian.PutUint32(frame, 0xffffffff)
+		mc.updateChecksum(frame)
+	}
+	return mc
+}
+
+// Reads a MEMCARD_SIZE bytes memory card image
+func LoadMemoryCardImage(r io.Reader) (*MemoryCardImage, error) {
+	mc := &MemoryCardImage{}
+	if _, err := io.ReadFull(r, mc.Data[:]); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMemoryCard, err)
+	}
+	if string(mc.Data[:2]) != "MC" {
+		return nil, fmt.Errorf("%w: no \"MC\" header", ErrInvalidMemoryCard)
+	}
+	return mc, nil
+}
+
+// Writes the memory card image to `w`
+func (mc *MemoryCardImage) Save(w io.Writer) error {
+	_, err := w.Write(mc.Data[:])
+	return err
+}
+
+// Returns frame `index` of `block` (0 is the directory block)
+func (mc *MemoryCardImage) frame(block, index int) []byte {
+	offset := block*MEMCARD_BLOCK_SIZE + index*MEMCARD_FRAME_SIZE
+	return mc.Data[offset : offset+MEMCARD_FRAME_SIZE]
+}
+
+// Returns the directory frame of save block `block`
+func (mc *MemoryCardImage) entry(block int) []byte {
+	return mc.frame(0, block+1)
+}
+
+// Returns the data of save block `block`
+func (mc *MemoryCardImage) block(block int) []byte {
+	offset := (block + 1) * MEMCARD_BLOCK_SIZE
+	return mc.Data[offset : offset+MEMCARD_BLOCK_SIZE]
+}
+
+// Sets the last byte of a frame to the XOR of the other bytes
+func (mc *MemoryCardImage) updateChecksum(frame []byte) {
+	var checksum byte
+	for _, b := range frame[:MEMCARD_FRAME_SIZE-1] {
+		checksum ^= b
+	}
+	frame[MEMCARD_FRAME_SIZE-1] = checksum
+}
+
+// Returns the amount of blocks that aren't used by a save
+func (mc *MemoryCardImage) FreeBlocks() int {
+	free := 0
+	for block := 0; block < MEMCARD_BLOCKS; block++ {
+		if mc.entry(block)[0]&0xf0 == 0xa0 {
+			free++
+		}
+	}
+	return free
+}
+
+// Returns all saves on the memory card
+func (mc *MemoryCardImage) Saves() []MemoryCardSave {
+	var saves []MemoryCardSave
+	for block := 0; block < MEMCARD_BLOCKS; block++ {
+		if save, err := mc.SaveAt(block); err == nil {
+			saves = append(saves, save)
+		}
+	}
+	return saves
+}
+
+// Returns the save that starts at `block`. Returns ErrNoSave if `block`
+// isn't the first block of a save
+func (mc *MemoryCardImage) SaveAt(block int) (MemoryCardSave, error) {
+	if block < 0 || block >= MEMCARD_BLOCKS || mc.entry(block)[0] != MEMCARD_BLOCK_FIRST {
+		return MemoryCardSave{}, fmt.Errorf("%w: block %d", ErrNoSave, block)
+	}
+
+	entry := mc.entry(block)
+	save := MemoryCardSave{
+		Block: block,
+		Size:  binary.LittleEndian.Uint32(entry[4:]),
+		Name:  cString(entry[0x0a:0x1e]),
+	}
+
+	// follow the chain of blocks, a broken chain ends the save
+	for next := block; next >= 0 && next < MEMCARD_BLOCKS && len(save.Blocks) < MEMCARD_BLOCKS; {
+		save.Blocks = append(save.Blocks, next)
+		next = int(binary.LittleEndian.Uint16(mc.entry(next)[8:]))
+	}
+
+	// the title frame starts with "SC"
+	data := mc.block(block)
+	if string(data[:2]) == "SC" {
+		save.Title = DecodeShiftJIS(data[0x04:0x44])
+		save.Icon = mc.icon(data)
+	}
+	return save, nil
+}
+
+// Decodes the icon frames from the title frame at the start of `data`
+func (mc *MemoryCardImage) icon(data []byte) []*image.RGBA {
+	frames := 0
+	switch data[2] {
+	case 0x11:
+		frames = 1
+	case 0x12:
+		frames = 2
+	case 0x13:
+		frames = 3
+	}
+
+	// 16 colors of the 15 bit palette
+	var palette [16]uint16
+	for i := range palette {
+		palette[i] = binary.LittleEndian.Uint16(data[0x60+i*2:])
+	}
+
+	icon := make([]*image.RGBA, frames)
+	for i := range icon {
+		img := image.NewRGBA(image.Rect(0, 0, MEMCARD_ICON_SIZE, MEMCARD_ICON_SIZE))
+		pixels := data[(i+1)*MEMCARD_FRAME_SIZE:]
+		for p := 0; p < MEMCARD_ICON_SIZE*MEMCARD_ICON_SIZE; p++ {
+			// 4 bits per pixel, low nibble first
+			index := (pixels[p/2] >> (uint(p&1) * 4)) & 0xf
+			clr := palette[index]
+			if clr == 0 {
+				// transparent
+				continue
+			}
+			img.SetRGBA(p%MEMCARD_ICON_SIZE, p/MEMCARD_ICON_SIZE, Color15ToRGBA(clr))
+		}
+		icon[i] = img
+	}
+	return icon
+}
+
+// Deletes the save that starts at `block`. Like the BIOS, the blocks are
+// only marked as deleted
+func (mc *MemoryCardImage) Delete(block int) error {
+	save, err := mc.SaveAt(block)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range save.Blocks {
+		entry := mc.entry(b)
+		// 0x51-0x53 become 0xa1-0xa3
+		entry[0] = entry[0]&0x0f | 0xa0
+		mc.updateChecksum(entry)
+	}
+	return nil
+}
+
+// Writes the save that starts at `block` to `w` as a single save file
+// (.mcs): the 128 byte directory frame followed by the data blocks
+func (mc *MemoryCardImage) Export(block int, w io.Writer) error {
+	save, err := mc.SaveAt(block)
+	if err != nil {
+		return err
+	}
+
+	// the exported directory frame doesn't point to another block
+	entry := make([]byte, MEMCARD_FRAME_SIZE)
+	copy(entry, mc.entry(block))
+	binary.LittleEndian.PutUint16(entry[8:], MEMCARD_NO_NEXT_BLOCK)
+	mc.updateChecksum(entry)
+
+	if _, err := w.Write(entry); err != nil {
+		return err
+	}
+	for _, b := range save.Blocks {
+		if _, err := w.Write(mc.block(b)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reads a save file written by Export and writes it to free blocks.
+// Returns the first block of the imported save. Returns ErrMemoryCardFull
+// if there aren't enough free blocks
+func (mc *MemoryCardImage) Import(r io.Reader) (int, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	blocks := (len(data) - MEMCARD_FRAME_SIZE) / MEMCARD_BLOCK_SIZE
+	if len(data) < MEMCARD_FRAME_SIZE+MEMCARD_BLOCK_SIZE ||
+		(len(data)-MEMCARD_FRAME_SIZE)%MEMCARD_BLOCK_SIZE != 0 || data[0] != MEMCARD_BLOCK_FIRST {
+		return 0, fmt.Errorf("%w: not a save file", ErrInvalidMemoryCard)
+	}
+
+	var free []int
+	for block := 0; block < MEMCARD_BLOCKS && len(free) < blocks; block++ {
+		if mc.entry(block)[0]&0xf0 == 0xa0 {
+			free = append(free, block)
+		}
+	}
+	if len(free) < blocks {
+		return 0, fmt.Errorf("%w: %d blocks needed, %d free", ErrMemoryCardFull, blocks, mc.FreeBlocks())
+	}
+
+	for i, block := range free {
+		entry := mc.entry(block)
+		for j := range entry {
+			entry[j] = 0
+		}
+
+		switch {
+		case i == 0:
+			// the first entry keeps the size and the name
+			copy(entry, data[:MEMCARD_FRAME_SIZE])
+		case i == blocks-1:
+			entry[0] = MEMCARD_BLOCK_LAST
+		default:
+			entry[0] = MEMCARD_BLOCK_MIDDLE
+		}
+
+		next := MEMCARD_NO_NEXT_BLOCK
+		if i < blocks-1 {
+			next = free[i+1]
+		}
+		binary.LittleEndian.PutUint16(entry[8:], uint16(next))
+		mc.updateChecksum(entry)
+
+		offset := MEMCARD_FRAME_SIZE + i*MEMCARD_BLOCK_SIZE
+		copy(mc.block(block), data[offset:offset+MEMCARD_BLOCK_SIZE])
+	}
+	return free[0], nil
+}
+
+// Returns the string in `b` up to the first null byte
+func cString(b []byte) string {
+	if i := strings.IndexByte(string(b), 0); i >= 0 {
+		return string(b[:i])
+	}
+	return string(b)
+}
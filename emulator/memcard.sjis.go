@@ -0,0 +1,66 @@
+package emulator
+
+import "strings"
+
+// Symbols from 0x8140 to 0x819e, used by save titles for punctuation. The
+// titles are usually written with full width characters. Mapped like code
+// page 932
+var sjisSymbols = []rune(
+	"　、。，．・：；？！゛゜´｀¨＾￣＿ヽヾゝゞ〃仝々〆〇ー―‐／＼～∥｜…‥‘’“”（）〔〕［］｛｝〈〉《》「」『』【】" +
+		"＋－±×�÷＝≠＜＞≦≧∞∴♂♀°′″℃￥＄￠￡％＃＆＊＠§☆★○●◎◇")
+
+// Decodes the Shift-JIS string in `b` up to the first null byte. Only the
+// characters used by memory card save titles are supported (ASCII, half
+// width katakana, symbols, full width letters and digits, hiragana and
+// katakana), the others are decoded as U+FFFD
+func DecodeShiftJIS(b []byte) string {
+	var sb strings.Builder
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case c == 0:
+			return sb.String()
+		case c < 0x80:
+			sb.WriteByte(c)
+			continue
+		case c >= 0xa1 && c <= 0xdf:
+			// half width katakana
+			sb.WriteRune(0xff61 + rune(c-0xa1))
+			continue
+		case (c < 0x81 || c > 0x9f) && (c < 0xe0 || c > 0xef) || i+1 >= len(b):
+			sb.WriteRune('�')
+			continue
+		}
+
+		// two byte character
+		code := uint16(c)<<8 | uint16(b[i+1])
+		i++
+		sb.WriteRune(decodeShiftJISChar(code))
+	}
+	return sb.String()
+}
+
+// Returns the character of a two byte Shift-JIS code
+func decodeShiftJISChar(code uint16) rune {
+	switch {
+	case code >= 0x8140 && code < 0x8140+uint16(len(sjisSymbols)):
+		return sjisSymbols[code-0x8140]
+	case code >= 0x824f && code <= 0x8258:
+		// full width digits
+		return 0xff10 + rune(code-0x824f)
+	case code >= 0x8260 && code <= 0x8279:
+		// full width uppercase letters
+		return 0xff21 + rune(code-0x8260)
+	case code >= 0x8281 && code <= 0x829a:
+		// full width lowercase letters
+		return 0xff41 + rune(code-0x8281)
+	case code >= 0x829f && code <= 0x82f1:
+		return 0x3041 + rune(code-0x829f) // hiragana
+	case code >= 0x8340 && code <= 0x837e:
+		return 0x30a1 + rune(code-0x8340) // katakana
+	case code >= 0x8380 && code <= 0x8396:
+		// katakana after the 0x7f gap
+		return 0x30e0 + rune(code-0x8380)
+	}
+	return '�'
+}
@@ -0,0 +1,114 @@
+package emulator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// Returns a save file with a title frame, a one frame icon and `blocks`
+// data blocks
+func newTestSaveFile(name string, blocks int) []byte {
+	data := make([]byte, MEMCARD_FRAME_SIZE+blocks*MEMCARD_BLOCK_SIZE)
+	data[0] = MEMCARD_BLOCK_FIRST
+	binary.LittleEndian.PutUint32(data[4:], uint32(blocks*MEMCARD_BLOCK_SIZE))
+	copy(data[0x0a:], name)
+
+	title := data[MEMCARD_FRAME_SIZE:]
+	copy(title, "SC")
+	title[2] = 0x11
+	title[3] = byte(blocks)
+	// "ＡＢ" in Shift-JIS
+	copy(title[4:], []byte{0x82, 0x60, 0x82, 0x61})
+	binary.LittleEndian.PutUint16(title[0x62:], 0x001f) // palette entry 1 is red
+	title[MEMCARD_FRAME_SIZE] = 0x01                    // first pixel uses entry 1
+	return data
+}
+
+func TestMemoryCardImportExport(t *testing.T) {
+	mc := NewMemoryCardImage()
+	if free := mc.FreeBlocks(); free != MEMCARD_BLOCKS {
+		t.Fatalf("expected %d free blocks on a new card, got %d", MEMCARD_BLOCKS, free)
+	}
+
+	file := newTestSaveFile("BASLUS-00000TEST", 2)
+	block, err := mc.Import(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saves := mc.Saves()
+	if len(saves) != 1 {
+		t.Fatalf("expected 1 save, got %d", len(saves))
+	}
+	save := saves[0]
+	if save.Block != block || len(save.Blocks) != 2 || save.Name != "BASLUS-00000TEST" {
+		t.Errorf("unexpected save %+v", save)
+	}
+	if save.Title != "ＡＢ" {
+		t.Errorf("expected the title ＡＢ, got %q", save.Title)
+	}
+	if len(save.Icon) != 1 || save.Icon[0].RGBAAt(0, 0).R == 0 || save.Icon[0].RGBAAt(1, 0).A != 0 {
+		t.Errorf("unexpected icon")
+	}
+
+	var exported bytes.Buffer
+	if err := mc.Export(block, &exported); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(exported.Bytes()[MEMCARD_FRAME_SIZE:], file[MEMCARD_FRAME_SIZE:]) {
+		t.Errorf("exported blocks don't match the imported save")
+	}
+
+	// the image survives a round trip through a file
+	var image bytes.Buffer
+	if err := mc.Save(&image); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadMemoryCardImage(&image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Saves()) != 1 {
+		t.Errorf("expected the loaded image to have 1 save")
+	}
+
+	if err := mc.Delete(block); err != nil {
+		t.Fatal(err)
+	}
+	if len(mc.Saves()) != 0 || mc.FreeBlocks() != MEMCARD_BLOCKS {
+		t.Errorf("expected the save to be deleted")
+	}
+	if err := mc.Delete(block); !errors.Is(err, ErrNoSave) {
+		t.Errorf("expected ErrNoSave, got %v", err)
+	}
+}
+
+func TestMemoryCardFull(t *testing.T) {
+	mc := NewMemoryCardImage()
+	if _, err := mc.Import(bytes.NewReader(newTestSaveFile("BIG", MEMCARD_BLOCKS))); err != nil {
+		t.Fatal(err)
+	}
+	_, err := mc.Import(bytes.NewReader(newTestSaveFile("SMALL", 1)))
+	if !errors.Is(err, ErrMemoryCardFull) {
+		t.Errorf("expected ErrMemoryCardFull, got %v", err)
+	}
+}
+
+func TestDecodeShiftJIS(t *testing.T) {
+	tests := []struct {
+		data     []byte
+		expected string
+	}{
+		{[]byte("SAVE\x00junk"), "SAVE"},
+		{[]byte{0x82, 0x50, 0x81, 0x40, 0x82, 0xa0, 0x83, 0x41}, "１　あア"},
+		{[]byte{0xb1, 0xb2}, "ｱｲ"},
+		{[]byte{0x82}, "�"},
+	}
+	for _, test := range tests {
+		if got := DecodeShiftJIS(test.data); got != test.expected {
+			t.Errorf("DecodeShiftJIS(% x) = %q, expected %q", test.data, got, test.expected)
+		}
+	}
+}
@@ -1,14 +1,144 @@
 package emulator
 
+// CD audio sample rate in Hz
+const CD_SAMPLE_RATE = 44100
+
+// Receives interleaved 16-bit stereo samples (left, right, left, ...) at
+// CD_SAMPLE_RATE. The slice is reused after the call returns
+type AudioOutput func(samples []int16)
+
 // CD-DA audio mixer
 type Mixer struct {
 	CdLeftToSpuLeft   uint8
 	CdLeftToSpuRight  uint8
 	CdRightToSpuLeft  uint8
 	CdRightToSpuRight uint8
+	Pending           [4]uint8    // ATV0-ATV3 register values, used after they're applied
+	Muted             bool        // Set by the Mute and Demute commands
+	AdpcmMuted        bool        // Whether XA-ADPCM samples are muted
+	Output            AudioOutput // Audio output, can be nil
+	Spu               *SPU        // The CD audio goes through its reverb, can be nil
+	buffer            []int16
+	host              *HostMixer // Volumes of the host, applied before Output, can be nil
 }
 
 func NewMixer() *Mixer {
 	// TODO: what are the reset values?
 	return &Mixer{}
 }
+
+// Sets the audio output
+func (mixer *Mixer) SetOutput(output AudioOutput) {
+	mixer.Output = output
+}
+
+// Sets the volume controls of the host, `host` can be nil. It's unexported
+// so the savestates leave it out
+func (mixer *Mixer) SetHost(host *HostMixer) {
+	mixer.host = host
+}
+
+// Returns the volume controls of the host, nil if there are none
+func (mixer *Mixer) Host() *HostMixer {
+	return mixer.host
+}
+
+// Handles a write to the ADPCTL register
+func (mixer *Mixer) Apply(val uint8) {
+	mixer.AdpcmMuted = val&1 != 0
+
+	if val&0x20 != 0 {
+		// apply the new volumes
+		mixer.CdLeftToSpuLeft = mixer.Pending[0]
+		mixer.CdLeftToSpuRight = mixer.Pending[1]
+		mixer.CdRightToSpuRight = mixer.Pending[2]
+		mixer.CdRightToSpuLeft = mixer.Pending[3]
+	}
+}
+
+// Mixes a raw CD-DA sector (16-bit little endian stereo samples) and sends
+// it to the audio output
+func (mixer *Mixer) MixCdda(data []byte) {
+	if !mixer.Used() {
+		return
+	}
+
+	samples := mixer.samples(len(data) / 2)
+	for i := range samples {
+		samples[i] = int16(uint16(data[i*2]) | uint16(data[i*2+1])<<8)
+	}
+	mixer.Mix(samples, AUDIO_CHANNEL_CDDA)
+}
+
+// Mixes decoded XA-ADPCM samples (interleaved 44.1kHz stereo) and sends
+// them to the audio output
+func (mixer *Mixer) MixXa(samples []int16) {
+	if !mixer.Used() {
+		return
+	}
+	if mixer.AdpcmMuted {
+		for i := range samples {
+			samples[i] = 0
+		}
+	}
+	mixer.Mix(samples, AUDIO_CHANNEL_XA)
+}
+
+// Returns true if the mixed audio goes anywhere. The SPU gets it even
+// without an audio output, the capture buffers don't depend on the host
+func (mixer *Mixer) Used() bool {
+	return mixer.Output != nil || mixer.Spu != nil
+}
+
+// Applies the volumes to interleaved stereo `samples` of `channel` and
+// sends them to the SPU and the audio output
+func (mixer *Mixer) Mix(samples []int16, channel AudioChannel) {
+	if !mixer.Used() {
+		return
+	}
+
+	for i := 0; i+1 < len(samples); i += 2 {
+		if mixer.Muted {
+			samples[i], samples[i+1] = 0, 0
+			continue
+		}
+
+		left, right := int32(samples[i]), int32(samples[i+1])
+
+		// 0x80 is 100%
+		outLeft := (left*int32(mixer.CdLeftToSpuLeft) + right*int32(mixer.CdRightToSpuLeft)) >> 7
+		outRight := (left*int32(mixer.CdLeftToSpuRight) + right*int32(mixer.CdRightToSpuRight)) >> 7
+
+		samples[i] = clampInt16(outLeft)
+		samples[i+1] = clampInt16(outRight)
+	}
+
+	if mixer.Spu != nil {
+		mixer.Spu.MixCdAudio(samples)
+	}
+	if mixer.Output != nil {
+		if mixer.host != nil {
+			mixer.host.Apply(channel, samples)
+		}
+		mixer.Output(samples)
+	}
+}
+
+// Returns the reusable sample buffer with a length of `n`
+func (mixer *Mixer) samples(n int) []int16 {
+	if cap(mixer.buffer) < n {
+		mixer.buffer = make([]int16, n)
+	}
+	return mixer.buffer[:n]
+}
+
+// Clamps `v` to the int16 range
+func clampInt16(v int32) int16 {
+	if v > 0x7fff {
+		return 0x7fff
+	}
+	if v < -0x8000 {
+		return -0x8000
+	}
+	return int16(v)
+}
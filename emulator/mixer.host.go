@@ -0,0 +1,135 @@
+package emulator
+
+import "sync"
+
+const (
+	HOST_VOLUME_DEFAULT = 100 // Volume of the channels in percent, as emulated
+	HOST_VOLUME_MAX     = 200 // Louder than the emulated volume, to boost quiet audio
+)
+
+// Audio channel of the host mixer
+type AudioChannel int
+
+const (
+	AUDIO_CHANNEL_SPU   AudioChannel = iota // SPU voices
+	AUDIO_CHANNEL_CDDA  AudioChannel = iota // CD-DA tracks
+	AUDIO_CHANNEL_XA    AudioChannel = iota // XA-ADPCM sectors
+	AUDIO_CHANNEL_COUNT                     // Amount of channels
+)
+
+var audioChannelNames = [AUDIO_CHANNEL_COUNT]string{"SPU", "CD-DA", "XA"}
+
+// Returns the name of the channel
+func (channel AudioChannel) String() string {
+	if channel >= 0 && channel < AUDIO_CHANNEL_COUNT {
+		return audioChannelNames[channel]
+	}
+	return "unknown"
+}
+
+// Volume controls of the host, applied to the audio output after the
+// emulated volumes. They don't change what the console hears (the SPU
+// capture buffers and reverb), only what's played, and aren't saved in the
+// savestates. The frontend changes them while the emulator runs, so they're
+// safe to use from any goroutine
+type HostMixer struct {
+	mu        sync.Mutex
+	volumes   [AUDIO_CHANNEL_COUNT]int
+	muted     [AUDIO_CHANNEL_COUNT]bool
+	soloVoice int // SPU voice played alone, -1 if none
+}
+
+// Returns a host mixer that plays every channel at the emulated volume
+func NewHostMixer() *HostMixer {
+	host := &HostMixer{soloVoice: -1}
+	for i := range host.volumes {
+		host.volumes[i] = HOST_VOLUME_DEFAULT
+	}
+	return host
+}
+
+// Returns the volume of `channel` in percent
+func (host *HostMixer) Volume(channel AudioChannel) int {
+	host.mu.Lock()
+	defer host.mu.Unlock()
+	return host.volumes[channel]
+}
+
+// Sets the volume of `channel` in percent, clamped from 0 to
+// HOST_VOLUME_MAX
+func (host *HostMixer) SetVolume(channel AudioChannel, percent int) {
+	if percent < 0 {
+		percent = 0
+	} else if percent > HOST_VOLUME_MAX {
+		percent = HOST_VOLUME_MAX
+	}
+
+	host.mu.Lock()
+	defer host.mu.Unlock()
+	host.volumes[channel] = percent
+}
+
+// Returns true if `channel` is muted
+func (host *HostMixer) Muted(channel AudioChannel) bool {
+	host.mu.Lock()
+	defer host.mu.Unlock()
+	return host.muted[channel]
+}
+
+// Mutes or unmutes `channel`, its volume is kept
+func (host *HostMixer) SetMuted(channel AudioChannel, muted bool) {
+	host.mu.Lock()
+	defer host.mu.Unlock()
+	host.muted[channel] = muted
+}
+
+// Returns the SPU voice that is played alone, or -1 if all of them are
+func (host *HostMixer) SoloVoice() int {
+	host.mu.Lock()
+	defer host.mu.Unlock()
+	return host.soloVoice
+}
+
+// Plays only the SPU voice `voice` and silences the other voices and the
+// CD audio, to pick out an instrument of the music. -1 (or any voice out
+// of range) plays everything again
+func (host *HostMixer) SetSoloVoice(voice int) {
+	if voice < 0 || voice >= SPU_VOICE_COUNT {
+		voice = -1
+	}
+
+	host.mu.Lock()
+	defer host.mu.Unlock()
+	host.soloVoice = voice
+}
+
+// Returns true if the SPU voice `voice` is played, the volume of the SPU
+// channel still applies
+func (host *HostMixer) VoiceAudible(voice int) bool {
+	host.mu.Lock()
+	defer host.mu.Unlock()
+	return host.soloVoice < 0 || host.soloVoice == voice
+}
+
+// Returns the volume `channel` is played at in percent, taking mute and
+// solo into account
+func (host *HostMixer) gain(channel AudioChannel) int32 {
+	host.mu.Lock()
+	defer host.mu.Unlock()
+
+	if host.muted[channel] || (host.soloVoice >= 0 && channel != AUDIO_CHANNEL_SPU) {
+		return 0
+	}
+	return int32(host.volumes[channel])
+}
+
+// Applies the volume of `channel` to interleaved stereo `samples`
+func (host *HostMixer) Apply(channel AudioChannel, samples []int16) {
+	gain := host.gain(channel)
+	if gain == HOST_VOLUME_DEFAULT {
+		return
+	}
+	for i := range samples {
+		samples[i] = clampInt16(int32(samples[i]) * gain / 100)
+	}
+}
@@ -0,0 +1,58 @@
+package emulator
+
+import "testing"
+
+// The host volumes change what's played, not what the SPU captures
+func TestHostMixer(t *testing.T) {
+	spu := NewSPU()
+	spu.Reverb = false
+	mixer := NewMixer()
+	mixer.Pending = [4]uint8{0x80, 0, 0x80, 0}
+	mixer.Apply(0x20)
+	mixer.Spu = spu
+	mixer.SetHost(NewHostMixer())
+
+	var played []int16
+	mixer.SetOutput(func(samples []int16) {
+		played = append(played[:0], samples...)
+	})
+	play := func(channel AudioChannel) {
+		mixer.Mix([]int16{1000, -1000}, channel)
+	}
+
+	mixer.Host().SetVolume(AUDIO_CHANNEL_CDDA, 50)
+	play(AUDIO_CHANNEL_CDDA)
+	if played[0] != 500 || played[1] != -500 {
+		t.Errorf("expected half the volume, got %v", played)
+	}
+	if spu.CdCapture[0] != 1000 || spu.CdCapture[1] != -1000 {
+		t.Errorf("expected the SPU to capture the emulated volume, got %v", spu.CdCapture)
+	}
+	play(AUDIO_CHANNEL_XA)
+	if played[0] != 1000 {
+		t.Errorf("expected XA at the emulated volume, got %v", played)
+	}
+
+	mixer.Host().SetMuted(AUDIO_CHANNEL_XA, true)
+	play(AUDIO_CHANNEL_XA)
+	if played[0] != 0 {
+		t.Errorf("expected XA to be muted, got %v", played)
+	}
+	mixer.Host().SetMuted(AUDIO_CHANNEL_XA, false)
+
+	// soloing a voice silences the CD audio
+	mixer.Host().SetSoloVoice(3)
+	play(AUDIO_CHANNEL_XA)
+	if played[0] != 0 || mixer.Host().VoiceAudible(2) || !mixer.Host().VoiceAudible(3) {
+		t.Errorf("expected only voice 3 to be audible, got %v", played)
+	}
+	mixer.Host().SetSoloVoice(SPU_VOICE_COUNT)
+	if mixer.Host().SoloVoice() != -1 || !mixer.Host().VoiceAudible(2) {
+		t.Errorf("expected the solo to be turned off")
+	}
+
+	mixer.Host().SetVolume(AUDIO_CHANNEL_CDDA, 1000)
+	if volume := mixer.Host().Volume(AUDIO_CHANNEL_CDDA); volume != HOST_VOLUME_MAX {
+		t.Errorf("expected the volume to be clamped to %d, got %d", HOST_VOLUME_MAX, volume)
+	}
+}
@@ -0,0 +1,147 @@
+package emulator
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	RESAMPLER_DEFAULT_LATENCY = 100 * time.Millisecond
+	// Maximum change of the resampling ratio by the dynamic rate control
+	RESAMPLER_MAX_ADJUST = 0.005
+	// The buffer holds this many times the latency before dropping samples
+	RESAMPLER_BUFFER_FACTOR = 4
+)
+
+// Converts the mixer output (CD_SAMPLE_RATE) to the sample rate of the host
+// and buffers it. Write is called by the mixer on the emulation goroutine
+// and Read by the audio player of the frontend. The emulation and the audio
+// device don't run at exactly the same speed, so the resampling ratio is
+// adjusted by up to RESAMPLER_MAX_ADJUST to keep about Latency of audio in
+// the buffer (dynamic rate control). Without it the buffer slowly runs dry
+// or fills up and the audio crackles
+type Resampler struct {
+	InRate  int           // Input sample rate, CD_SAMPLE_RATE
+	OutRate int           // Sample rate of the host
+	Latency time.Duration // Amount of audio kept in the buffer
+	// Amount of times Read ran out of samples and played silence
+	Underruns uint64
+	// Amount of input samples dropped because the buffer was full
+	Overruns uint64
+	mu       sync.Mutex
+	buffer   []int16 // Ring buffer of interleaved stereo samples
+	start    int     // Index of the first buffered stereo frame
+	count    int     // Amount of buffered stereo frames
+	pos      float64 // Position of the next output frame between prev and the next input frame
+	prev     [2]int16
+	primed   bool // False until the buffer holds Latency of audio
+}
+
+// Returns a new resampler to `outRate` that keeps `latency` of audio
+// buffered
+func NewResampler(outRate int, latency time.Duration) *Resampler {
+	resampler := &Resampler{
+		InRate:  CD_SAMPLE_RATE,
+		OutRate: outRate,
+		Latency: latency,
+	}
+	frames := resampler.targetFrames() * RESAMPLER_BUFFER_FACTOR
+	resampler.buffer = make([]int16, maxInt(frames, 1)*2)
+	return resampler
+}
+
+// Returns the amount of stereo frames that make up Latency
+func (resampler *Resampler) targetFrames() int {
+	return int(resampler.Latency.Seconds() * float64(resampler.OutRate))
+}
+
+// Returns the amount of buffered audio
+func (resampler *Resampler) Buffered() time.Duration {
+	resampler.mu.Lock()
+	defer resampler.mu.Unlock()
+	return time.Duration(resampler.count) * time.Second / time.Duration(resampler.OutRate)
+}
+
+// Resamples interleaved stereo samples at InRate and adds them to the
+// buffer. Can be used as an AudioOutput
+func (resampler *Resampler) Write(samples []int16) {
+	resampler.mu.Lock()
+	defer resampler.mu.Unlock()
+
+	// input frames per output frame. If the buffer is too full, the input
+	// is consumed a bit faster so fewer frames are output
+	step := float64(resampler.InRate) / float64(resampler.OutRate)
+	if target := resampler.targetFrames(); target > 0 {
+		adjust := float64(resampler.count-target) / float64(target) * RESAMPLER_MAX_ADJUST
+		if adjust > RESAMPLER_MAX_ADJUST {
+			adjust = RESAMPLER_MAX_ADJUST
+		} else if adjust < -RESAMPLER_MAX_ADJUST {
+			adjust = -RESAMPLER_MAX_ADJUST
+		}
+		step *= 1 + adjust
+	}
+
+	for i := 0; i+1 < len(samples); i += 2 {
+		next := [2]int16{samples[i], samples[i+1]}
+
+		// linear interpolation between the previous and the next frame
+		for resampler.pos < 1 {
+			prevLeft, prevRight := float64(resampler.prev[0]), float64(resampler.prev[1])
+			left := prevLeft + (float64(next[0])-prevLeft)*resampler.pos
+			right := prevRight + (float64(next[1])-prevRight)*resampler.pos
+			resampler.push(int16(left), int16(right))
+			resampler.pos += step
+		}
+
+		resampler.pos -= 1
+		resampler.prev = next
+	}
+}
+
+// Adds a stereo frame to the ring buffer, drops it if the buffer is full
+func (resampler *Resampler) push(left, right int16) {
+	frames := len(resampler.buffer) / 2
+	if resampler.count == frames {
+		resampler.Overruns++
+		return
+	}
+
+	index := (resampler.start + resampler.count) % frames
+	resampler.buffer[index*2] = left
+	resampler.buffer[index*2+1] = right
+	resampler.count++
+}
+
+// Fills `p` with 16 bit little endian stereo samples at OutRate, plays
+// silence if there isn't enough audio buffered. Never fails, so it can be
+// used as an endless stream by the audio player of the frontend
+func (resampler *Resampler) Read(p []byte) (int, error) {
+	resampler.mu.Lock()
+	defer resampler.mu.Unlock()
+
+	if !resampler.primed && resampler.count >= resampler.targetFrames() {
+		resampler.primed = true
+	}
+
+	frames := len(resampler.buffer) / 2
+	n := len(p) / 4
+	for i := 0; i < n; i++ {
+		var left, right int16
+		if resampler.primed && resampler.count > 0 {
+			left = resampler.buffer[resampler.start*2]
+			right = resampler.buffer[resampler.start*2+1]
+			resampler.start = (resampler.start + 1) % frames
+			resampler.count--
+		} else if resampler.primed {
+			// ran dry, wait until the buffer is filled again
+			resampler.Underruns++
+			resampler.primed = false
+		}
+
+		p[i*4] = byte(left)
+		p[i*4+1] = byte(uint16(left) >> 8)
+		p[i*4+2] = byte(right)
+		p[i*4+3] = byte(uint16(right) >> 8)
+	}
+	return n * 4, nil
+}
@@ -0,0 +1,41 @@
+package emulator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResampler(t *testing.T) {
+	resampler := NewResampler(48000, 100*time.Millisecond)
+	buf := make([]byte, 400)
+
+	// 100ms of a constant sample
+	samples := make([]int16, 4410*2)
+	for i := range samples {
+		samples[i] = 1000
+	}
+	resampler.Write(samples[:2000])
+
+	// nothing is played until the latency is reached
+	if n, _ := resampler.Read(buf); n != len(buf) || buf[0] != 0 {
+		t.Fatalf("expected silence before the buffer is filled, got %d bytes starting with %d", n, buf[0])
+	}
+
+	resampler.Write(samples[2000:])
+	if buffered := resampler.Buffered(); buffered < 99*time.Millisecond || buffered > 101*time.Millisecond {
+		t.Fatalf("expected 100ms of buffered audio, got %s", buffered)
+	}
+	resampler.Read(buf)
+	// the first frames fade in from silence
+	if sample := int16(uint16(buf[396]) | uint16(buf[397])<<8); sample != 1000 {
+		t.Errorf("expected the resampled sample to be 1000, got %d", sample)
+	}
+
+	// the buffer is too full, so the same input makes less output
+	resampler.Write(samples)
+	before := resampler.Buffered()
+	resampler.Write(samples)
+	if added := resampler.Buffered() - before; added >= 100*time.Millisecond {
+		t.Errorf("expected the rate control to output less than 100ms, got %s", added)
+	}
+}
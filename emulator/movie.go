@@ -0,0 +1,295 @@
+package emulator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+)
+
+// Movie files start with this string
+const MOVIE_MAGIC = "GOPSXMOV"
+
+// Version of the movie format written by Movie.Save. Version 2 can embed
+// the savestate the movie starts from, version 1 files can still be loaded
+const MOVIE_VERSION uint32 = 2
+
+// Frames read at once by LoadMovie, so a corrupted frame count can't make
+// it allocate more than the file holds
+const MOVIE_READ_CHUNK = 4096
+
+// A checkpoint is saved every MOVIE_CHECKPOINT_FRAMES frames for
+// Movie.Rewind, the oldest ones are dropped after MOVIE_MAX_CHECKPOINTS (but
+// not the one at the start of the movie)
+const (
+	MOVIE_CHECKPOINT_FRAMES = 300
+	MOVIE_MAX_CHECKPOINTS   = 16
+)
+
+// Returned by LoadMovie if the file is not a movie or has an unsupported
+// version
+var ErrInvalidMovie = errors.New("invalid movie file")
+
+// Returned by Movie.Rewind if no checkpoint was saved before the frame
+var ErrNoMovieCheckpoint = errors.New("no movie checkpoint")
+
+type MovieMode int
+
+const (
+	MOVIE_MODE_RECORD   MovieMode = iota // Live input is appended to the movie
+	MOVIE_MODE_PLAYBACK MovieMode = iota // Recorded input replaces the live input
+	MOVIE_MODE_FINISHED MovieMode = iota // Playback reached the end, live input is used
+)
+
+// Controller input for one frame, as in DigitalPadProfile.State
+type MovieFrame struct {
+	Pad1 uint16 // Port 1
+	Pad2 uint16 // Port 2
+}
+
+// Per-frame controller input recording. Movies start at power-on or from
+// an embedded savestate, so they replay exactly as long as the core runs
+// in the deterministic mode (see Console.SetDeterministic) and the same
+// BIOS and disc are used. Inputs are only applied at frame boundaries
+type Movie struct {
+	Mode         MovieMode
+	BiosChecksum uint32       // CRC32 of the BIOS the movie was recorded with
+	Rerecords    uint32       // Amount of times the movie was rewound while recording
+	Frames       []MovieFrame // Input for every recorded frame
+	Frame        uint64       // Next frame to run
+	// Savestate (see WriteSaveState) the movie starts from, nil if it
+	// starts at power-on. See Start
+	State []byte
+	// If not nil, called before the input of a frame is applied. While
+	// recording, it can change the input that gets recorded
+	OnFrame     func(frame uint64, input *MovieFrame)
+	OnEnd       func() // If not nil, called when playback reaches the end
+	checkpoints []movieCheckpoint
+	mu          sync.Mutex
+}
+
+// State of the console at the start of a frame, see Movie.Checkpoint
+type movieCheckpoint struct {
+	frame uint64
+	state *Snapshot
+}
+
+// Returns a new empty movie for recording with `bios`
+func NewMovie(bios *BIOS) *Movie {
+	return &Movie{
+		Mode:         MOVIE_MODE_RECORD,
+		BiosChecksum: crc32.ChecksumIEEE(bios.Data[:]),
+	}
+}
+
+type movieHeader struct {
+	Magic        [8]byte
+	Version      uint32
+	BiosChecksum uint32
+	Rerecords    uint32
+	FrameCount   uint32
+}
+
+// Reads a movie saved with Movie.Save. The movie is ready for playback
+func LoadMovie(r io.Reader) (*Movie, error) {
+	var header movieHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+	if string(header.Magic[:]) != MOVIE_MAGIC {
+		return nil, ErrInvalidMovie
+	}
+	if header.Version == 0 || header.Version > MOVIE_VERSION {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidMovie, header.Version)
+	}
+
+	movie := &Movie{
+		Mode:         MOVIE_MODE_PLAYBACK,
+		BiosChecksum: header.BiosChecksum,
+		Rerecords:    header.Rerecords,
+	}
+	if header.Version >= 2 {
+		state, err := readMovieState(r)
+		if err != nil {
+			return nil, err
+		}
+		movie.State = state
+	}
+	for remaining := header.FrameCount; remaining > 0; {
+		chunk := make([]MovieFrame, minU32(remaining, MOVIE_READ_CHUNK))
+		if err := binary.Read(r, binary.LittleEndian, chunk); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil, fmt.Errorf(
+					"%w: %d of %d frames", ErrInvalidMovie, len(movie.Frames), header.FrameCount,
+				)
+			}
+			return nil, err
+		}
+		movie.Frames = append(movie.Frames, chunk...)
+		remaining -= uint32(len(chunk))
+	}
+	if len(movie.Frames) == 0 {
+		movie.Mode = MOVIE_MODE_FINISHED
+	}
+	return movie, nil
+}
+
+// Writes the movie to `w`
+func (movie *Movie) Save(w io.Writer) error {
+	movie.mu.Lock()
+	defer movie.mu.Unlock()
+
+	header := movieHeader{
+		Version:      MOVIE_VERSION,
+		BiosChecksum: movie.BiosChecksum,
+		Rerecords:    movie.Rerecords,
+		FrameCount:   uint32(len(movie.Frames)),
+	}
+	copy(header.Magic[:], MOVIE_MAGIC)
+
+	if err := binary.Write(w, binary.LittleEndian, &header); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(movie.State))); err != nil {
+		return err
+	}
+	if _, err := w.Write(movie.State); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, movie.Frames)
+}
+
+// Reads the savestate chunk of a version 2 movie, a size followed by the
+// state. Returns nil if the movie starts at power-on
+func readMovieState(r io.Reader) ([]byte, error) {
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	// read it in pieces, a corrupted size can't allocate more than the file
+	state, err := io.ReadAll(io.LimitReader(r, int64(size)))
+	if err != nil {
+		return nil, err
+	}
+	if len(state) != int(size) {
+		return nil, fmt.Errorf("%w: %d of %d savestate bytes", ErrInvalidMovie, len(state), size)
+	}
+	return state, nil
+}
+
+// Brings the console running `cpu` to the start of the movie by loading
+// its savestate. Does nothing if the movie starts at power-on, the console
+// must have just been powered on then. Must not run while the CPU is
+// running on another goroutine
+func (movie *Movie) Start(cpu *CPU) error {
+	movie.mu.Lock()
+	defer movie.mu.Unlock()
+
+	if movie.State == nil {
+		return nil
+	}
+	_, err := ReadSaveState(bytes.NewReader(movie.State), cpu)
+	return err
+}
+
+// Returns true if the movie was recorded with `bios`
+func (movie *Movie) MatchesBios(bios *BIOS) bool {
+	return crc32.ChecksumIEEE(bios.Data[:]) == movie.BiosChecksum
+}
+
+// Applies the input for the next frame to the digital pads in port 1 and
+// port 2. While recording, `live` is appended to the movie. During playback
+// it's ignored until the movie ends. Should be called once per frame,
+// before the frame runs
+func (movie *Movie) RunFrame(inter *Interconnect, live MovieFrame) {
+	movie.mu.Lock()
+	input := live
+	switch movie.Mode {
+	case MOVIE_MODE_RECORD:
+		if movie.OnFrame != nil {
+			movie.OnFrame(movie.Frame, &input)
+		}
+		movie.Frames = append(movie.Frames, input)
+	case MOVIE_MODE_PLAYBACK:
+		input = movie.Frames[movie.Frame]
+		if movie.OnFrame != nil {
+			movie.OnFrame(movie.Frame, &input)
+		}
+	}
+	movie.Frame++
+
+	ended := movie.Mode == MOVIE_MODE_PLAYBACK && movie.Frame >= uint64(len(movie.Frames))
+	if ended {
+		movie.Mode = MOVIE_MODE_FINISHED
+	}
+	movie.mu.Unlock()
+
+	inter.PadMemCard.SetDigitalPads(input.Pad1, input.Pad2)
+	if ended && movie.OnEnd != nil {
+		movie.OnEnd()
+	}
+}
+
+// Saves the state of the console running `cpu` if the next frame starts a
+// checkpoint (every MOVIE_CHECKPOINT_FRAMES frames, from the first one).
+// Should be called once per frame, before RunFrame
+func (movie *Movie) Checkpoint(cpu *CPU) error {
+	movie.mu.Lock()
+	defer movie.mu.Unlock()
+
+	if movie.Frame%MOVIE_CHECKPOINT_FRAMES != 0 {
+		return nil
+	}
+	if n := len(movie.checkpoints); n > 0 && movie.checkpoints[n-1].frame >= movie.Frame {
+		return nil
+	}
+	state := &Snapshot{}
+	if err := state.Save(cpu); err != nil {
+		return err
+	}
+	movie.checkpoints = append(movie.checkpoints, movieCheckpoint{movie.Frame, state})
+	if len(movie.checkpoints) > MOVIE_MAX_CHECKPOINTS {
+		// keep the start of the movie
+		movie.checkpoints = append(movie.checkpoints[:1], movie.checkpoints[2:]...)
+	}
+	return nil
+}
+
+// Loads the last checkpoint at or before `frame` into the console running
+// `cpu`, drops the input after it and continues recording from there.
+// Returns the frame of the checkpoint, the next one to run. The input of
+// that frame still has to be applied with RunFrame, see
+// Console.RewindMovie. Returns ErrNoMovieCheckpoint if there's no
+// checkpoint at or before `frame`
+func (movie *Movie) Rewind(cpu *CPU, frame uint64) (uint64, error) {
+	movie.mu.Lock()
+	defer movie.mu.Unlock()
+
+	if frame > uint64(len(movie.Frames)) {
+		frame = uint64(len(movie.Frames))
+	}
+	i := len(movie.checkpoints) - 1
+	for i >= 0 && movie.checkpoints[i].frame > frame {
+		i--
+	}
+	if i < 0 {
+		return 0, ErrNoMovieCheckpoint
+	}
+	checkpoint := movie.checkpoints[i]
+	if err := checkpoint.state.Restore(cpu); err != nil {
+		return 0, err
+	}
+
+	movie.checkpoints = movie.checkpoints[:i+1]
+	movie.Frames = movie.Frames[:checkpoint.frame]
+	movie.Frame = checkpoint.frame
+	movie.Mode = MOVIE_MODE_RECORD
+	movie.Rerecords++
+	return checkpoint.frame, nil
+}
@@ -0,0 +1,194 @@
+package emulator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// Returns the states of the digital pads in port 1 and port 2
+func testMoviePads(inter *Interconnect) MovieFrame {
+	return MovieFrame{
+		Pad1: inter.PadMemCard.Pad1.Profile.(*DigitalPadProfile).State,
+		Pad2: inter.PadMemCard.Pad2.Profile.(*DigitalPadProfile).State,
+	}
+}
+
+// A recorded movie is saved, loaded and played back with the same input,
+// then the live input is used again
+func TestMovieRoundTrip(t *testing.T) {
+	bios, _ := LoadBIOSFromData(make([]byte, BIOS_SIZE))
+	inter := newBenchInterconnect()
+	recorded := []MovieFrame{{0xfffe, 0xffff}, {0xfffd, 0xfff7}, {0xffff, 0xbfff}}
+
+	movie := NewMovie(bios)
+	for _, input := range recorded {
+		movie.RunFrame(inter, input)
+		if got := testMoviePads(inter); got != input {
+			t.Fatalf("recording: expected the pads to be %x, got %x", input, got)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := movie.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadMovie(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Mode != MOVIE_MODE_PLAYBACK || !loaded.MatchesBios(bios) {
+		t.Fatalf("expected a movie for playback with the same BIOS, got mode %d", loaded.Mode)
+	}
+
+	ended := 0
+	loaded.OnEnd = func() { ended++ }
+	live := MovieFrame{DIGITAL_PAD_RELEASED, DIGITAL_PAD_RELEASED}
+	for i, input := range recorded {
+		loaded.RunFrame(inter, live)
+		if got := testMoviePads(inter); got != input {
+			t.Errorf("frame %d: expected %x, got %x", i, input, got)
+		}
+	}
+	if loaded.Mode != MOVIE_MODE_FINISHED || ended != 1 {
+		t.Fatalf("expected playback to end once, got mode %d and %d ends", loaded.Mode, ended)
+	}
+	loaded.RunFrame(inter, live)
+	if got := testMoviePads(inter); got != live {
+		t.Errorf("expected the live input after the end, got %x", got)
+	}
+}
+
+// Rewinding loads the last checkpoint before the frame and records again
+// from there
+func TestMovieRewind(t *testing.T) {
+	bios, _ := LoadBIOSFromData(make([]byte, BIOS_SIZE))
+	cpu := NewCPU(newBenchInterconnect())
+	inter := cpu.Inter
+	start := inter.Ram.Data[0]
+
+	movie := NewMovie(bios)
+	if _, err := movie.Rewind(cpu, 0); !errors.Is(err, ErrNoMovieCheckpoint) {
+		t.Fatalf("expected ErrNoMovieCheckpoint without checkpoints, got %v", err)
+	}
+
+	// checkpoints at 0, 300 and 600, RAM holds the last frame that ran
+	for i := 0; i < MOVIE_CHECKPOINT_FRAMES*2+100; i++ {
+		if err := movie.Checkpoint(cpu); err != nil {
+			t.Fatal(err)
+		}
+		movie.RunFrame(inter, MovieFrame{uint16(i), uint16(i)})
+		inter.Ram.Data[0] = byte(i)
+	}
+
+	frame, err := movie.Rewind(cpu, MOVIE_CHECKPOINT_FRAMES+150)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame != MOVIE_CHECKPOINT_FRAMES || len(movie.Frames) != MOVIE_CHECKPOINT_FRAMES ||
+		movie.Frame != MOVIE_CHECKPOINT_FRAMES || movie.Rerecords != 1 {
+		t.Fatalf("expected to go back to frame %d with 1 rerecord, got frame %d, %d frames and %d rerecords",
+			MOVIE_CHECKPOINT_FRAMES, frame, len(movie.Frames), movie.Rerecords)
+	}
+	if got := inter.Ram.Data[0]; got != byte((MOVIE_CHECKPOINT_FRAMES-1)&0xff) {
+		t.Errorf("expected the state of frame %d, RAM holds 0x%02x", MOVIE_CHECKPOINT_FRAMES, got)
+	}
+
+	// recording continues from the checkpoint
+	movie.Checkpoint(cpu)
+	movie.RunFrame(inter, MovieFrame{7, 7})
+	if got := movie.Frames[MOVIE_CHECKPOINT_FRAMES]; got != (MovieFrame{7, 7}) {
+		t.Errorf("expected frame %d to be rerecorded, got %x", MOVIE_CHECKPOINT_FRAMES, got)
+	}
+
+	// rewinding a movie being played back switches to recording
+	movie.Mode = MOVIE_MODE_PLAYBACK
+	if frame, err := movie.Rewind(cpu, 10); err != nil || frame != 0 {
+		t.Fatalf("expected to go back to the start, got frame %d: %v", frame, err)
+	}
+	if movie.Mode != MOVIE_MODE_RECORD || len(movie.Frames) != 0 || inter.Ram.Data[0] != start {
+		t.Errorf("expected to record from the start, got mode %d and %d frames", movie.Mode, len(movie.Frames))
+	}
+}
+
+// A movie that starts from a savestate stores it and loads it on Start
+func TestMovieState(t *testing.T) {
+	bios, _ := LoadBIOSFromData(make([]byte, BIOS_SIZE))
+	cpu := NewCPU(newBenchInterconnect())
+	cpu.Inter.Ram.Data[0x100] = 0x42
+
+	var state bytes.Buffer
+	if err := WriteSaveState(&state, cpu); err != nil {
+		t.Fatal(err)
+	}
+	movie := NewMovie(bios)
+	movie.State = state.Bytes()
+	movie.RunFrame(cpu.Inter, MovieFrame{1, 2})
+
+	var buf bytes.Buffer
+	if err := movie.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadMovie(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(loaded.State, state.Bytes()) || len(loaded.Frames) != 1 {
+		t.Fatalf("expected the savestate and 1 frame, got %d bytes and %d frames", len(loaded.State), len(loaded.Frames))
+	}
+
+	other := NewCPU(newBenchInterconnect())
+	if err := loaded.Start(other); err != nil {
+		t.Fatal(err)
+	}
+	if other.Inter.Ram.Data[0x100] != 0x42 {
+		t.Error("expected Start to load the savestate")
+	}
+
+	// movies without a state don't change the console
+	if err := NewMovie(bios).Start(other); err != nil || other.Inter.Ram.Data[0x100] != 0x42 {
+		t.Errorf("expected a power-on movie to keep the state, got %v", err)
+	}
+}
+
+// Version 1 movies have no savestate chunk
+func TestMovieVersion1(t *testing.T) {
+	header := movieHeader{Version: 1, Rerecords: 3, FrameCount: 2}
+	copy(header.Magic[:], MOVIE_MAGIC)
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, &header)
+	binary.Write(&buf, binary.LittleEndian, []MovieFrame{{1, 2}, {3, 4}})
+	movie, err := LoadMovie(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movie.State != nil || len(movie.Frames) != 2 || movie.Frames[1] != (MovieFrame{3, 4}) || movie.Rerecords != 3 {
+		t.Errorf("unexpected movie %+v", movie)
+	}
+}
+
+// A frame count larger than the file is an error, not a huge allocation
+func TestMovieTruncated(t *testing.T) {
+	header := movieHeader{Version: MOVIE_VERSION, FrameCount: 0xffffffff}
+	copy(header.Magic[:], MOVIE_MAGIC)
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, &header)
+	binary.Write(&buf, binary.LittleEndian, uint32(0)) // no savestate
+	binary.Write(&buf, binary.LittleEndian, []MovieFrame{{1, 2}})
+	if _, err := LoadMovie(&buf); !errors.Is(err, ErrInvalidMovie) {
+		t.Errorf("expected ErrInvalidMovie, got %v", err)
+	}
+
+	// same for the savestate size
+	buf.Reset()
+	header.FrameCount = 0
+	binary.Write(&buf, binary.LittleEndian, &header)
+	binary.Write(&buf, binary.LittleEndian, uint32(0xffffffff))
+	buf.Write([]byte("state"))
+	if _, err := LoadMovie(&buf); !errors.Is(err, ErrInvalidMovie) {
+		t.Errorf("expected ErrInvalidMovie for the savestate, got %v", err)
+	}
+}
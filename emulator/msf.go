@@ -30,18 +30,20 @@ func (msf *Msf) Slice() []uint8 {
 
 func MsfFromBcd(m, s, f uint8) *Msf {
 	msf := &Msf{m, s, f}
+	if !msf.IsValid() {
+		panicFmt("msf: invalid MSF: %s", msf)
+	}
+	return msf
+}
 
-	// check if the MSF is valid
+// Returns true if the values are BCD and the seconds and frames are in range
+func (msf *Msf) IsValid() bool {
 	for _, v := range msf.Slice() {
 		if v > 0x99 || (v&0xf) > 0x9 {
-			panicFmt("msf: invalid MSF: %s", msf)
+			return false
 		}
 	}
-	if s >= 0x60 || f >= 0x75 {
-		panicFmt("msf: invalid MSF: %s", msf)
-	}
-
-	return msf
+	return msf.S < 0x60 && msf.F < 0x75
 }
 
 // Converts an MSF into a sector index
@@ -60,14 +62,35 @@ func (msf *Msf) Next() (*Msf, error) {
 		return &Msf{m, s, incBcd(f)}, nil
 	}
 	if s < 0x59 {
-		return &Msf{m, incBcd(s), f}, nil
+		return &Msf{m, incBcd(s), 0}, nil
 	}
 	if m < 0x99 {
-		return &Msf{incBcd(m), s, f}, nil
+		return &Msf{incBcd(m), 0, 0}, nil
 	}
 	return nil, errMsfOverflow
 }
 
+// Converts a sector index into an MSF
+func MsfFromIndex(index uint32) (*Msf, error) {
+	m := index / (60 * 75)
+	if m > 99 {
+		return nil, errMsfOverflow
+	}
+	s := (index / 75) % 60
+	f := index % 75
+	return &Msf{toBcd(uint8(m)), toBcd(uint8(s)), toBcd(uint8(f))}, nil
+}
+
+// Converts a binary value (0-99) into BCD
+func toBcd(v uint8) uint8 {
+	return ((v / 10) << 4) | (v % 10)
+}
+
+// Converts a BCD value into binary
+func fromBcd(v uint8) uint8 {
+	return (v>>4)*10 + (v & 0xf)
+}
+
 func incBcd(v uint8) uint8 {
 	if v&0xf < 9 {
 		return v + 1
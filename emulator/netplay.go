@@ -0,0 +1,292 @@
+package emulator
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Message types sent between netplay peers. Every message is 13 bytes long:
+// the type, the frame number and the value
+const (
+	NETPLAY_HELLO    uint8 = iota // Sent by the host, value is the input delay
+	NETPLAY_INPUT    uint8 = iota // Value is the digital pad state for the frame
+	NETPLAY_CHECKSUM uint8 = iota // Value is the state checksum after the frame
+)
+
+const (
+	NETPLAY_MESSAGE_SIZE      = 13
+	NETPLAY_DEFAULT_DELAY     = 2  // Frames between reading and applying the input
+	NETPLAY_CHECKSUM_INTERVAL = 60 // Frames between state checksum exchanges
+	NETPLAY_QUEUE_SIZE        = 256
+	NETPLAY_DEFAULT_TIMEOUT   = 10 * time.Second // How long to wait for the remote input
+)
+
+// Returned by Netplay.RunFrame when the other emulator disconnected
+var ErrNetplayDisconnected = errors.New("netplay peer disconnected")
+
+// Returned by Netplay.RunFrame when the remote input didn't arrive in time
+var ErrNetplayTimeout = errors.New("netplay peer timed out")
+
+type netplayMessage struct {
+	Type  uint8
+	Frame uint64
+	Value uint32
+}
+
+// Lockstep netplay session between two emulators over TCP (there is no UDP
+// transport, a lost packet would stall the lockstep). Every frame both
+// sides send their controller input and wait for the other side's input, so
+// both cores see exactly the same input on the same frame. Inputs are
+// applied `Delay` frames after they were read to hide the network latency.
+// The core has to be deterministic for the two sides to stay in sync, state
+// checksums are exchanged to detect desyncs
+type Netplay struct {
+	Player   int    // 0 for the host (port 1), 1 for the client (port 2)
+	Delay    int    // Input delay in frames, chosen by the host
+	Frame    uint64 // Next frame to run
+	Desynced bool   // True if the checksums didn't match at some point
+	// How long AdvanceFrame waits for the remote input, 0 waits forever
+	Timeout time.Duration
+	// If not nil, called from RunFrame when the checksums don't match
+	OnDesync func(frame uint64)
+
+	conn      net.Conn
+	inputs    chan netplayMessage // Remote inputs in frame order
+	mu        sync.Mutex
+	local     []uint16          // Local inputs waiting to be applied
+	checksums map[uint64]uint32 // Checksums waiting for the other side
+	remote    map[uint64]uint32
+}
+
+func newNetplay(conn net.Conn, player, delay int) *Netplay {
+	np := &Netplay{
+		Player:    player,
+		Delay:     delay,
+		Timeout:   NETPLAY_DEFAULT_TIMEOUT,
+		conn:      conn,
+		inputs:    make(chan netplayMessage, NETPLAY_QUEUE_SIZE),
+		checksums: map[uint64]uint32{},
+		remote:    map[uint64]uint32{},
+	}
+
+	// nobody has input for the first `delay` frames
+	for i := 0; i < delay; i++ {
+		np.local = append(np.local, DIGITAL_PAD_RELEASED)
+	}
+	return np
+}
+
+// Listens on `addr` and waits for the other emulator to connect. The host
+// controls port 1
+func ListenNetplay(addr string, delay int) (*Netplay, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer listener.Close()
+
+	Log.Infof(LOG_MODULE_NET, "netplay: waiting for a connection on %s", listener.Addr())
+	conn, err := listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	Log.Infof(LOG_MODULE_NET, "netplay: %s connected", conn.RemoteAddr())
+	return NewNetplayHost(conn, delay)
+}
+
+// Starts a session as the host on an open connection, the other side has
+// to call NewNetplayClient. The connection is closed if it fails
+func NewNetplayHost(conn net.Conn, delay int) (*Netplay, error) {
+	np := newNetplay(conn, 0, delay)
+	if err := np.send(NETPLAY_HELLO, 0, uint32(delay)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go np.reader()
+	return np, nil
+}
+
+// Connects to a host listening on `addr`. The client controls port 2 and
+// uses the input delay of the host
+func DialNetplay(addr string) (*Netplay, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewNetplayClient(conn)
+}
+
+// Joins a session as the client on an open connection, waiting for the
+// hello message of the host. The connection is closed if it fails
+func NewNetplayClient(conn net.Conn) (*Netplay, error) {
+	msg, err := readNetplayMessage(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if msg.Type != NETPLAY_HELLO {
+		conn.Close()
+		return nil, fmt.Errorf("netplay: expected a hello message, got type %d", msg.Type)
+	}
+	Log.Infof(LOG_MODULE_NET, "netplay: connected to %s, input delay: %d frames", conn.RemoteAddr(), msg.Value)
+
+	np := newNetplay(conn, 1, int(msg.Value))
+	go np.reader()
+	return np, nil
+}
+
+func readNetplayMessage(r io.Reader) (netplayMessage, error) {
+	var buf [NETPLAY_MESSAGE_SIZE]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return netplayMessage{}, err
+	}
+	return netplayMessage{
+		Type:  buf[0],
+		Frame: binary.LittleEndian.Uint64(buf[1:]),
+		Value: binary.LittleEndian.Uint32(buf[9:]),
+	}, nil
+}
+
+func (np *Netplay) send(msgType uint8, frame uint64, value uint32) error {
+	var buf [NETPLAY_MESSAGE_SIZE]byte
+	buf[0] = msgType
+	binary.LittleEndian.PutUint64(buf[1:], frame)
+	binary.LittleEndian.PutUint32(buf[9:], value)
+	_, err := np.conn.Write(buf[:])
+	return err
+}
+
+// Reads messages until the connection is closed
+func (np *Netplay) reader() {
+	defer close(np.inputs)
+	for {
+		msg, err := readNetplayMessage(np.conn)
+		if err != nil {
+			Log.Infof(LOG_MODULE_NET, "netplay: peer disconnected")
+			return
+		}
+
+		switch msg.Type {
+		case NETPLAY_INPUT:
+			np.inputs <- msg
+		case NETPLAY_CHECKSUM:
+			np.mu.Lock()
+			np.remote[msg.Frame] = msg.Value
+			np.mu.Unlock()
+		}
+	}
+}
+
+// Exchanges the local input with the other emulator and returns the inputs
+// of port 1 and port 2 for the current frame. Blocks until the remote input
+// for the frame arrives, for up to Timeout
+func (np *Netplay) AdvanceFrame(local uint16) (uint16, uint16, error) {
+	if err := np.send(NETPLAY_INPUT, np.Frame+uint64(np.Delay), uint32(local)); err != nil {
+		return 0, 0, ErrNetplayDisconnected
+	}
+	np.local = append(np.local, local)
+	localNow := np.local[0]
+	np.local = np.local[1:]
+
+	remoteNow := DIGITAL_PAD_RELEASED
+	if np.Frame >= uint64(np.Delay) {
+		var timeout <-chan time.Time
+		if np.Timeout > 0 {
+			timer := time.NewTimer(np.Timeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+
+		var msg netplayMessage
+		var ok bool
+		select {
+		case msg, ok = <-np.inputs:
+			if !ok {
+				return 0, 0, ErrNetplayDisconnected
+			}
+		case <-timeout:
+			return 0, 0, fmt.Errorf("%w: no input for frame %d after %s", ErrNetplayTimeout, np.Frame, np.Timeout)
+		}
+		if msg.Frame != np.Frame {
+			return 0, 0, fmt.Errorf("netplay: expected input for frame %d, got %d", np.Frame, msg.Frame)
+		}
+		remoteNow = uint16(msg.Value)
+	}
+	np.Frame++
+
+	if np.Player == 0 {
+		return localNow, remoteNow, nil
+	}
+	return remoteNow, localNow, nil
+}
+
+// Sends the local state checksum for `frame` and compares all checksums
+// that both sides have sent so far
+func (np *Netplay) CheckState(frame uint64, checksum uint32) error {
+	if err := np.send(NETPLAY_CHECKSUM, frame, checksum); err != nil {
+		return ErrNetplayDisconnected
+	}
+
+	np.mu.Lock()
+	np.checksums[frame] = checksum
+	var desyncs []uint64
+	for f, local := range np.checksums {
+		remote, ok := np.remote[f]
+		if !ok {
+			continue
+		}
+		if local != remote {
+			desyncs = append(desyncs, f)
+		}
+		delete(np.checksums, f)
+		delete(np.remote, f)
+	}
+	np.mu.Unlock()
+
+	for _, f := range desyncs {
+		np.Desynced = true
+		if np.OnDesync != nil {
+			np.OnDesync(f)
+		}
+	}
+	return nil
+}
+
+// Exchanges the inputs for the next frame and applies them to the digital
+// pads in port 1 and port 2. `local` is the state of the local controller,
+// as in DigitalPadProfile.State. Should be called once per frame, before
+// the frame runs
+func (np *Netplay) RunFrame(inter *Interconnect, local uint16) error {
+	frame := np.Frame
+	if frame > 0 && frame%NETPLAY_CHECKSUM_INTERVAL == 0 {
+		if err := np.CheckState(frame, StateChecksum(inter)); err != nil {
+			return err
+		}
+	}
+
+	pad1, pad2, err := np.AdvanceFrame(local)
+	if err != nil {
+		return err
+	}
+
+	inter.PadMemCard.SetDigitalPads(pad1, pad2)
+	return nil
+}
+
+// Returns a checksum of the RAM and the scratchpad, used to check if two
+// emulators are still in sync
+func StateChecksum(inter *Interconnect) uint32 {
+	sum := crc32.ChecksumIEEE(inter.Ram.Data[:])
+	return crc32.Update(sum, crc32.IEEETable, inter.ScratchPad.Data[:])
+}
+
+// Closes the connection
+func (np *Netplay) Close() error {
+	return np.conn.Close()
+}
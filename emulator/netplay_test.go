@@ -0,0 +1,138 @@
+package emulator
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// Returns a host and a client connected over net.Pipe
+func newTestNetplay(t *testing.T, delay int) (*Netplay, *Netplay) {
+	t.Helper()
+	hostConn, clientConn := net.Pipe()
+
+	// the hello message waits for the client to read it
+	hostDone := make(chan *Netplay)
+	go func() {
+		host, err := NewNetplayHost(hostConn, delay)
+		if err != nil {
+			t.Error(err)
+		}
+		hostDone <- host
+	}()
+	client, err := NewNetplayClient(clientConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := <-hostDone
+	if host == nil {
+		t.FailNow()
+	}
+	if client.Delay != delay || client.Player != 1 {
+		t.Fatalf("expected the client to be player 1 with delay %d, got player %d with delay %d",
+			delay, client.Player, client.Delay)
+	}
+	t.Cleanup(func() {
+		host.Close()
+		client.Close()
+	})
+	return host, client
+}
+
+// Both sides see the same inputs on the same frame, `delay` frames after
+// they were read
+func TestNetplayLockstep(t *testing.T) {
+	const delay, frames = 2, 10
+	host, client := newTestNetplay(t, delay)
+
+	type pads struct{ pad1, pad2 uint16 }
+	run := func(np *Netplay, base uint16) <-chan []pads {
+		result := make(chan []pads, 1)
+		go func() {
+			var seen []pads
+			for i := uint16(0); i < frames; i++ {
+				pad1, pad2, err := np.AdvanceFrame(base + i)
+				if err != nil {
+					t.Error(err)
+					break
+				}
+				seen = append(seen, pads{pad1, pad2})
+			}
+			result <- seen
+		}()
+		return result
+	}
+	hostResult, clientResult := run(host, 0x100), run(client, 0x200)
+	hostSeen, clientSeen := <-hostResult, <-clientResult
+	if t.Failed() {
+		return
+	}
+
+	for frame := 0; frame < frames; frame++ {
+		expected := pads{DIGITAL_PAD_RELEASED, DIGITAL_PAD_RELEASED}
+		if frame >= delay {
+			expected = pads{uint16(0x100 + frame - delay), uint16(0x200 + frame - delay)}
+		}
+		if hostSeen[frame] != expected || clientSeen[frame] != expected {
+			t.Errorf("frame %d: expected %x, host got %x and client got %x",
+				frame, expected, hostSeen[frame], clientSeen[frame])
+		}
+	}
+}
+
+// Sends the client checksum for `frame`, waits for the host to receive it
+// and checks the host checksum against it
+func exchangeTestChecksums(t *testing.T, host, client *Netplay, frame uint64, hostSum, clientSum uint32) {
+	t.Helper()
+	if err := client.CheckState(frame, clientSum); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		host.mu.Lock()
+		_, ok := host.remote[frame]
+		host.mu.Unlock()
+		if ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the checksum for frame %d didn't arrive", frame)
+		}
+	}
+	if err := host.CheckState(frame, hostSum); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNetplayDesync(t *testing.T) {
+	host, client := newTestNetplay(t, 0)
+	var desyncs []uint64
+	host.OnDesync = func(frame uint64) {
+		desyncs = append(desyncs, frame)
+	}
+
+	exchangeTestChecksums(t, host, client, 60, 0x1234, 0x1234)
+	if host.Desynced {
+		t.Fatal("expected matching checksums to stay in sync")
+	}
+	exchangeTestChecksums(t, host, client, 120, 0x1234, 0x5678)
+	if !host.Desynced || len(desyncs) != 1 || desyncs[0] != 120 {
+		t.Errorf("expected a desync at frame 120, got %v", desyncs)
+	}
+}
+
+func TestNetplayTimeout(t *testing.T) {
+	host, client := newTestNetplay(t, 0)
+	client.Timeout = 20 * time.Millisecond
+
+	// the host never sends its input
+	if _, _, err := client.AdvanceFrame(0); !errors.Is(err, ErrNetplayTimeout) {
+		t.Errorf("expected ErrNetplayTimeout, got %v", err)
+	}
+
+	host.Close()
+	client.Timeout = time.Second
+	if _, _, err := client.AdvanceFrame(0); !errors.Is(err, ErrNetplayDisconnected) {
+		t.Errorf("expected ErrNetplayDisconnected, got %v", err)
+	}
+}
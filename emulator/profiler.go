@@ -0,0 +1,203 @@
+package emulator
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Part of the emulator that host time and guest cycles are attributed to
+type ProfileSection int
+
+const (
+	PROFILE_CPU      ProfileSection = iota // Instructions, everything that isn't measured separately
+	PROFILE_GPU      ProfileSection = iota // GPU sync, including the end of the frames
+	PROFILE_CDROM    ProfileSection = iota // CD-ROM sync, sector reads and audio mixing
+	PROFILE_DMA      ProfileSection = iota // DMA transfers
+	PROFILE_OTHER    ProfileSection = iota // Timers, controllers and serial port syncs
+	PROFILE_IDLE     ProfileSection = iota // Throttling and message handling on the emulation goroutine
+	PROFILE_RENDERER ProfileSection = iota // Host renderer, measured by the frontend on its own goroutine
+	PROFILE_SECTIONS ProfileSection = iota // Amount of sections
+)
+
+var profileSectionNames = [PROFILE_SECTIONS]string{
+	"cpu", "gpu", "cdrom", "dma", "other", "idle", "renderer",
+}
+
+// Returns the name of the section
+func (section ProfileSection) String() string {
+	if section < PROFILE_SECTIONS {
+		return profileSectionNames[section]
+	}
+	return fmt.Sprintf("section%d", int(section))
+}
+
+// Host time and guest cycles spent in every section during a frame. Only
+// the CPU (every cycle of the frame) and the DMA (bus cycles of the
+// transfers) use guest cycles
+type FrameProfile struct {
+	Frames uint64 // Amount of frames added up in the profile
+	Time   [PROFILE_SECTIONS]time.Duration
+	Cycles [PROFILE_SECTIONS]uint64
+	Total  time.Duration // Host time between the start and the end of the frames
+}
+
+// Returns the average profile of one frame
+func (profile *FrameProfile) Average() FrameProfile {
+	avg := *profile
+	if profile.Frames <= 1 {
+		return avg
+	}
+
+	n := profile.Frames
+	avg.Frames = 1
+	avg.Total /= time.Duration(n)
+	for i := range avg.Time {
+		avg.Time[i] /= time.Duration(n)
+		avg.Cycles[i] /= n
+	}
+	return avg
+}
+
+// Writes a table of the average time and cycles per frame of every section
+func (profile *FrameProfile) Dump(w io.Writer) error {
+	avg := profile.Average()
+	if _, err := fmt.Fprintf(w, "%d frames, %s per frame\n", profile.Frames, avg.Total); err != nil {
+		return err
+	}
+	for i, duration := range avg.Time {
+		percent := 0.0
+		if avg.Total > 0 {
+			percent = float64(duration) / float64(avg.Total) * 100
+		}
+		_, err := fmt.Fprintf(
+			w, "%-8s %10s %5.1f%% %9d cycles\n",
+			ProfileSection(i), duration, percent, avg.Cycles[i],
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Measures where the emulation time goes, frame by frame. The methods can
+// be called on a nil profiler, they do nothing, so the emulator only pays
+// for the measurements when profiling is on
+type Profiler struct {
+	mu         sync.Mutex
+	current    FrameProfile // Frame being measured
+	last       FrameProfile // Last finished frame
+	total      FrameProfile // Every frame since the profiler was created
+	frameStart time.Time
+	cycleStart uint64
+	started    bool // False until the end of the first frame
+}
+
+// Returns a new profiler. The measurements start at the end of the next
+// frame
+func NewProfiler() *Profiler {
+	return &Profiler{}
+}
+
+// Returns the current time, to be passed to Stop
+func (prof *Profiler) Start() time.Time {
+	if prof == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// Attributes the time since `start` to `section`
+func (prof *Profiler) Stop(section ProfileSection, start time.Time) {
+	if prof == nil {
+		return
+	}
+	prof.Add(section, time.Since(start))
+}
+
+// Attributes `duration` to `section`. Safe to call from the frontend
+func (prof *Profiler) Add(section ProfileSection, duration time.Duration) {
+	if prof == nil {
+		return
+	}
+	prof.mu.Lock()
+	prof.current.Time[section] += duration
+	prof.mu.Unlock()
+}
+
+// Attributes `cycles` guest cycles to `section`
+func (prof *Profiler) AddCycles(section ProfileSection, cycles uint64) {
+	if prof == nil {
+		return
+	}
+	prof.mu.Lock()
+	prof.current.Cycles[section] += cycles
+	prof.mu.Unlock()
+}
+
+// Finishes the current frame. `cycles` is the CPU cycle counter, the CPU
+// gets the host time that wasn't attributed to the other sections
+func (prof *Profiler) EndFrame(cycles uint64) {
+	if prof == nil {
+		return
+	}
+	prof.mu.Lock()
+	defer prof.mu.Unlock()
+
+	now := time.Now()
+	if !prof.started {
+		// the profiler was created in the middle of a frame
+		prof.started = true
+		prof.current = FrameProfile{}
+		prof.frameStart = now
+		prof.cycleStart = cycles
+		return
+	}
+
+	frame := &prof.current
+	frame.Frames = 1
+	frame.Total = now.Sub(prof.frameStart)
+	if cycles > prof.cycleStart {
+		// the counter starts over on a reset
+		frame.Cycles[PROFILE_CPU] += cycles - prof.cycleStart
+	}
+
+	cpu := frame.Total
+	for i, duration := range frame.Time {
+		if ProfileSection(i) != PROFILE_RENDERER {
+			cpu -= duration
+		}
+	}
+	if cpu > 0 {
+		frame.Time[PROFILE_CPU] += cpu
+	}
+
+	prof.total.Frames++
+	prof.total.Total += frame.Total
+	for i := range frame.Time {
+		prof.total.Time[i] += frame.Time[i]
+		prof.total.Cycles[i] += frame.Cycles[i]
+	}
+
+	prof.last = *frame
+	prof.current = FrameProfile{}
+	prof.frameStart = now
+	prof.cycleStart = cycles
+}
+
+// Returns the profile of the last finished frame
+func (prof *Profiler) Last() FrameProfile {
+	prof.mu.Lock()
+	defer prof.mu.Unlock()
+	return prof.last
+}
+
+// Returns the sum of every frame since the profiler was created, see
+// FrameProfile.Average
+func (prof *Profiler) Total() FrameProfile {
+	prof.mu.Lock()
+	defer prof.mu.Unlock()
+	return prof.total
+}
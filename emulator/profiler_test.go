@@ -0,0 +1,57 @@
+package emulator
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProfiler(t *testing.T) {
+	// a nil profiler does nothing
+	var off *Profiler
+	off.Stop(PROFILE_GPU, off.Start())
+	off.AddCycles(PROFILE_DMA, 10)
+	off.EndFrame(100)
+
+	prof := NewProfiler()
+	prof.Add(PROFILE_GPU, time.Hour) // before the first frame, dropped
+	prof.EndFrame(1000)
+
+	for frame := uint64(1); frame <= 2; frame++ {
+		prof.Add(PROFILE_GPU, 2*time.Millisecond)
+		prof.Add(PROFILE_RENDERER, time.Millisecond)
+		prof.AddCycles(PROFILE_DMA, 50)
+		time.Sleep(5 * time.Millisecond)
+		prof.EndFrame(1000 + frame*500)
+	}
+
+	last := prof.Last()
+	if last.Frames != 1 || last.Time[PROFILE_GPU] != 2*time.Millisecond {
+		t.Errorf("unexpected last frame %+v", last)
+	}
+	if last.Cycles[PROFILE_CPU] != 500 || last.Cycles[PROFILE_DMA] != 50 {
+		t.Errorf("expected 500 CPU and 50 DMA cycles, got %v", last.Cycles)
+	}
+	// the renderer runs on another goroutine, it isn't taken from the CPU
+	if cpu := last.Total - last.Time[PROFILE_GPU]; last.Time[PROFILE_CPU] != cpu {
+		t.Errorf("expected %s of CPU time, got %s", cpu, last.Time[PROFILE_CPU])
+	}
+
+	total := prof.Total()
+	if total.Frames != 2 || total.Cycles[PROFILE_CPU] != 1000 {
+		t.Errorf("unexpected total %+v", total)
+	}
+	avg := total.Average()
+	if avg.Frames != 1 || avg.Cycles[PROFILE_CPU] != 500 || avg.Time[PROFILE_GPU] != 2*time.Millisecond {
+		t.Errorf("unexpected average %+v", avg)
+	}
+
+	var out bytes.Buffer
+	if err := total.Dump(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "2 frames") || !strings.Contains(out.String(), "renderer") {
+		t.Errorf("unexpected dump %q", out.String())
+	}
+}
@@ -5,68 +5,99 @@ const (
 )
 
 type RAM struct {
-	Data [RAM_ALLOC_SIZE]byte // RAM buffer
+	Data      [RAM_ALLOC_SIZE]byte // RAM buffer
+	CodePages *CodePages           // Notified about writes, nil if no code is compiled
 }
 
 // Creates a new RAM instance (allocates `RAM_ALLOC_SIZE` bytes and fills
 // them with garbage values)
 func NewRAM() *RAM {
 	ram := &RAM{}
+	ram.Reset()
+	return ram
+}
+
+// Fills the RAM with garbage like at power-on
+func (ram *RAM) Reset() {
 	for i := 0; i < len(ram.Data); i++ {
 		ram.Data[i] = 0xcd
 	}
-	return ram
 }
 
 // Loads a value at `offset`
-func (ram *RAM) Load(offset uint32, size AccessSize) interface{} {
-	var v uint32 = 0
-	sizeI := uint32(size)
-	offset &= 0x1fffff
-
-	for i := uint32(0); i < sizeI; i++ {
-		v |= uint32(ram.Data[offset+i]) << (i * 8)
+func (ram *RAM) Load(offset uint32, size AccessSize) uint32 {
+	switch size {
+	case ACCESS_BYTE:
+		return uint32(ram.Load8(offset))
+	case ACCESS_HALFWORD:
+		return uint32(ram.Load16(offset))
+	default:
+		return ram.Load32(offset)
 	}
-	return accessSizeU32(size, v)
 }
 
 // Stores `val` into `offset`
-func (ram *RAM) Store(offset uint32, size AccessSize, val interface{}) {
-	valU32 := accessSizeToU32(size, val)
-	sizeI := uint32(size)
-	offset &= 0x1fffff
-
-	for i := uint32(0); i < sizeI; i++ {
-		ram.Data[offset+i] = byte(valU32 >> (i * 8))
+func (ram *RAM) Store(offset uint32, size AccessSize, val uint32) {
+	switch size {
+	case ACCESS_BYTE:
+		ram.Store8(offset, uint8(val))
+	case ACCESS_HALFWORD:
+		ram.Store16(offset, uint16(val))
+	default:
+		ram.Store32(offset, val)
 	}
 }
 
 // Load a 32 bit little endian word at `offset`
 func (ram *RAM) Load32(offset uint32) uint32 {
-	return ram.Load(offset, ACCESS_WORD).(uint32)
+	offset &= 0x1ffffc
+	return uint32(ram.Data[offset]) |
+		uint32(ram.Data[offset+1])<<8 |
+		uint32(ram.Data[offset+2])<<16 |
+		uint32(ram.Data[offset+3])<<24
 }
 
 // Load a 16 bit little endian value at `offset`
 func (ram *RAM) Load16(offset uint32) uint16 {
-	return ram.Load(offset, ACCESS_HALFWORD).(uint16)
+	offset &= 0x1ffffe
+	return uint16(ram.Data[offset]) | uint16(ram.Data[offset+1])<<8
 }
 
 // Fetches the byte at `offset`
 func (ram *RAM) Load8(offset uint32) byte {
-	return ram.Load(offset, ACCESS_BYTE).(byte)
+	return ram.Data[offset&0x1fffff]
 }
 
 // Store a 32 bit little endian word `val` into `offset`
 func (ram *RAM) Store32(offset, val uint32) {
-	ram.Store(offset, ACCESS_WORD, val)
+	offset &= 0x1ffffc
+	if ram.CodePages != nil {
+		ram.CodePages.Write(offset)
+	}
+
+	ram.Data[offset] = byte(val)
+	ram.Data[offset+1] = byte(val >> 8)
+	ram.Data[offset+2] = byte(val >> 16)
+	ram.Data[offset+3] = byte(val >> 24)
 }
 
 // Stores a 16 bit little endian value into `offset`
 func (ram *RAM) Store16(offset uint32, val uint16) {
-	ram.Store(offset, ACCESS_HALFWORD, val)
+	offset &= 0x1ffffe
+	if ram.CodePages != nil {
+		ram.CodePages.Write(offset)
+	}
+
+	ram.Data[offset] = byte(val)
+	ram.Data[offset+1] = byte(val >> 8)
 }
 
 // Sets the byte at `offset`
 func (ram *RAM) Store8(offset uint32, val byte) {
-	ram.Store(offset, ACCESS_BYTE, val)
+	offset &= 0x1fffff
+	if ram.CodePages != nil {
+		ram.CodePages.Write(offset)
+	}
+
+	ram.Data[offset] = val
 }
@@ -0,0 +1,100 @@
+package emulator
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Size of the pages of a HeatMap
+const (
+	HEATMAP_PAGE_BITS = 12 // 4KB pages
+	HEATMAP_PAGES     = RAM_ALLOC_SIZE >> HEATMAP_PAGE_BITS
+	// Pages in a row of HeatMap.Image, 32 pages (128KB) per row
+	HEATMAP_IMAGE_WIDTH = 32
+)
+
+// Counts the accesses to every 4KB page of RAM, to spot the busy buffers,
+// the DMA destinations and the unused areas. See Interconnect.HeatMap
+type HeatMap struct {
+	Reads  [HEATMAP_PAGES]uint32 // CPU reads
+	Writes [HEATMAP_PAGES]uint32 // CPU writes
+	Dma    [HEATMAP_PAGES]uint32 // Words transferred by the DMA, both ways
+}
+
+// Returns an empty heat map
+func NewHeatMap() *HeatMap {
+	return &HeatMap{}
+}
+
+// Returns the page of `addr` if it's a RAM address
+func heatMapPage(addr uint32) (uint32, bool) {
+	ok, offset := RAM_RANGE.ContainsAndOffset(MaskRegion(addr))
+	return (offset & (RAM_ALLOC_SIZE - 1)) >> HEATMAP_PAGE_BITS, ok
+}
+
+// Counts a CPU read at `addr`. Does nothing on a nil heat map
+func (heat *HeatMap) read(addr uint32) {
+	if heat == nil {
+		return
+	}
+	if page, ok := heatMapPage(addr); ok {
+		heat.Reads[page]++
+	}
+}
+
+// Counts a CPU write at `addr`. Does nothing on a nil heat map
+func (heat *HeatMap) write(addr uint32) {
+	if heat == nil {
+		return
+	}
+	if page, ok := heatMapPage(addr); ok {
+		heat.Writes[page]++
+	}
+}
+
+// Counts a DMA transfer at the RAM offset `offset`. Does nothing on a nil
+// heat map
+func (heat *HeatMap) dma(offset uint32) {
+	if heat != nil {
+		heat.Dma[(offset&(RAM_ALLOC_SIZE-1))>>HEATMAP_PAGE_BITS]++
+	}
+}
+
+// Clears the counters
+func (heat *HeatMap) Reset() {
+	*heat = HeatMap{}
+}
+
+// Returns the heat map as a picture with a pixel per page, from the start
+// of RAM at the top left, HEATMAP_IMAGE_WIDTH pages per row. Writes are
+// red, reads green and DMA transfers blue, on a logarithmic scale so the
+// pages that are barely used still show up
+func (heat *HeatMap) Image() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, HEATMAP_IMAGE_WIDTH, HEATMAP_PAGES/HEATMAP_IMAGE_WIDTH))
+	var max uint32
+	for page := 0; page < HEATMAP_PAGES; page++ {
+		for _, count := range []uint32{heat.Reads[page], heat.Writes[page], heat.Dma[page]} {
+			if count > max {
+				max = count
+			}
+		}
+	}
+
+	scale := func(count uint32) uint8 {
+		if count == 0 {
+			return 0
+		}
+		// anything that was touched is at least dimly lit
+		return uint8(64 + 191*math.Log1p(float64(count))/math.Log1p(float64(max)))
+	}
+	for page := 0; page < HEATMAP_PAGES; page++ {
+		img.SetRGBA(page%HEATMAP_IMAGE_WIDTH, page/HEATMAP_IMAGE_WIDTH, color.RGBA{
+			R: scale(heat.Writes[page]),
+			G: scale(heat.Reads[page]),
+			B: scale(heat.Dma[page]),
+			A: 0xff,
+		})
+	}
+	return img
+}
@@ -0,0 +1,48 @@
+package emulator
+
+import "testing"
+
+func TestHeatMap(t *testing.T) {
+	heat := NewHeatMap()
+	heat.read(0x80001000)  // KSEG0, page 1
+	heat.read(0x00001ffc)  // KUSEG, page 1
+	heat.write(0xa0003004) // KSEG1, page 3
+	heat.write(0x80203004) // mirror of page 3
+	heat.read(0x1f801810)  // GPU, not RAM
+	heat.dma(0x1ffffc)     // last page
+
+	if heat.Reads[1] != 2 {
+		t.Errorf("expected 2 reads in page 1, got %d", heat.Reads[1])
+	}
+	if heat.Writes[3] != 2 {
+		t.Errorf("expected 2 writes in page 3, got %d", heat.Writes[3])
+	}
+	if heat.Dma[HEATMAP_PAGES-1] != 1 {
+		t.Errorf("expected a DMA transfer in the last page, got %d", heat.Dma[HEATMAP_PAGES-1])
+	}
+
+	img := heat.Image()
+	if c := img.RGBAAt(1, 0); c.R != 0 || c.G == 0 || c.B != 0 {
+		t.Errorf("page 1 should be green, got %v", c)
+	}
+	if c := img.RGBAAt(3, 0); c.R == 0 || c.G != 0 {
+		t.Errorf("page 3 should be red, got %v", c)
+	}
+	if c := img.RGBAAt(HEATMAP_IMAGE_WIDTH-1, HEATMAP_PAGES/HEATMAP_IMAGE_WIDTH-1); c.B == 0 {
+		t.Errorf("the last page should be blue, got %v", c)
+	}
+	if c := img.RGBAAt(0, 0); c.R != 0 || c.G != 0 || c.B != 0 {
+		t.Errorf("page 0 is unused, got %v", c)
+	}
+
+	heat.Reset()
+	if heat.Reads[1] != 0 || heat.Writes[3] != 0 {
+		t.Error("Reset didn't clear the counters")
+	}
+
+	// a nil heat map is off
+	var off *HeatMap
+	off.read(0x80001000)
+	off.write(0x80001000)
+	off.dma(0x1000)
+}
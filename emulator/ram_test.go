@@ -0,0 +1,27 @@
+package emulator
+
+import "testing"
+
+func BenchmarkRamLoad32(b *testing.B) {
+	ram := NewRAM()
+
+	for i := 0; i < b.N; i++ {
+		ram.Load(uint32(i<<2)&0x1ffffc, ACCESS_WORD)
+	}
+}
+
+func BenchmarkRamStore32(b *testing.B) {
+	ram := NewRAM()
+
+	for i := 0; i < b.N; i++ {
+		ram.Store(uint32(i<<2)&0x1ffffc, ACCESS_WORD, uint32(i))
+	}
+}
+
+func BenchmarkRamStore8(b *testing.B) {
+	ram := NewRAM()
+
+	for i := 0; i < b.N; i++ {
+		ram.Store(uint32(i)&0x1fffff, ACCESS_BYTE, uint32(i))
+	}
+}
@@ -5,11 +5,11 @@ var (
 	BIOS_RANGE = NewRange(0x1fc00000, BIOS_SIZE)
 	// Memory latency and expansion mapping (also known as SYSCONTROL)
 	MEMCONTROL_RANGE = NewRange(0x1f801000, 36)
-	// Register that has something to do with RAM configuration, configured by the BIOS
+	// RAM configuration, selects the size of the RAM window (see RamAccess)
 	RAMSIZE_RANGE = NewRange(0x1f801060, 4)
 	// Cache control register, full address since it's in KSEG2
 	CACHE_CONTROL_RANGE = NewRange(0xfffe0130, 4)
-	// Main RAM: 2MB mirrored four times over the first 8MB
+	// Main RAM window: 2MB mirrored over the first 8MB, see RamAccess
 	RAM_RANGE = NewRange(0x00000000, 8*1024*1024)
 	// SPU (Sound Processing Unit)
 	SPU_RANGE = NewRange(0x1f801c00, 640)
@@ -28,7 +28,9 @@ var (
 	// The CD-ROM controller
 	CDROM_RANGE = NewRange(0x1f801800, 0x4)
 	// Controller and memory card range
-	PADMEMCARD_RANGE = NewRange(0x1f801040, 32)
+	PADMEMCARD_RANGE = NewRange(0x1f801040, 16)
+	// Second serial port
+	SIO1_RANGE = NewRange(0x1f801050, 16)
 	// 1kb fast ScratchPad RAM
 	SCRATCHPAD_RANGE = NewRange(0x1f800000, 1024)
 	// MDEC registers range
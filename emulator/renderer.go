@@ -1,6 +1,9 @@
 package emulator
 
-import "image/color"
+import (
+	"image"
+	"image/color"
+)
 
 // A 2 dimensional vector (int16)
 type Vec2 struct {
@@ -16,10 +19,107 @@ type Vec2U struct {
 	X, Y uint16
 }
 
+// A 2 dimensional vector (float32)
+type Vec2F struct {
+	X, Y float32
+}
+
+// How 480 line interlaced frames are shown
+type DeinterlaceMode uint8
+
+const (
+	// Show both fields at once. The host renderer draws every line of the
+	// frame, so this looks like a progressive 480 line image
+	DEINTERLACE_WEAVE DeinterlaceMode = iota
+	// Only show the lines of the current field and double them, like a TV.
+	// The doubled lines start at the first line of the field, so the even
+	// and odd lines stay in place
+	DEINTERLACE_BOB DeinterlaceMode = iota
+)
+
+func (mode DeinterlaceMode) String() string {
+	switch mode {
+	case DEINTERLACE_WEAVE:
+		return "weave"
+	case DEINTERLACE_BOB:
+		return "bob"
+	}
+	return "unknown"
+}
+
+// Kind of GP0 command that drew a vertex
+type PrimitiveType uint8
+
+const (
+	PRIMITIVE_POLYGON   PrimitiveType = iota // Triangle or quadrilateral
+	PRIMITIVE_RECTANGLE PrimitiveType = iota // Sprite or rectangle, not affected by the texture page flips
+	PRIMITIVE_LINE      PrimitiveType = iota // Line or polyline, never textured
+	PRIMITIVE_FILL      PrimitiveType = iota // VRAM fill, ignores the drawing area and the mask
+)
+
+// State shared by the vertices of a primitive
+type PrimitiveAttributes struct {
+	Type            PrimitiveType
+	Textured        bool // The texture is sampled at the UV coordinates
+	RawTexture      bool // The texture isn't blended with the vertex color
+	SemiTransparent bool // Blended with the VRAM using the texture page mode
+	// Texture page attribute, in the GP0(0xE1) layout: X base in bits [3:0],
+	// Y base in bit 4, semi-transparency mode in bits [6:5], color depth in
+	// bits [8:7]. Also valid for untextured semi-transparent primitives
+	TexPage uint16
+	Clut    uint16 // Palette attribute: X/16 in bits [5:0], Y in bits [14:6]
+	// Part of VRAM the primitive can draw to, see GPU.DrawingArea. Not
+	// offset by the drawing offset. The zero rectangle doesn't clip
+	DrawingArea image.Rectangle
+	SetMask     bool // Force the mask bit of the drawn pixels, see GP0(0xE6)
+	CheckMask   bool // Don't draw over pixels that have the mask bit set
+	// Dither the colors when they're truncated to 15 bits. Only shaded and
+	// texture blended primitives are dithered, see GPU.Dithering
+	Dither bool
+}
+
+// Returns true if the primitive is restricted to its drawing area
+func (attrs PrimitiveAttributes) Clipped() bool {
+	return attrs.DrawingArea != image.Rectangle{}
+}
+
+// Returns the semi-transparency mode of the texture page (0: B/2+F/2,
+// 1: B+F, 2: B-F, 3: B+F/4)
+func (attrs PrimitiveAttributes) SemiTransparency() uint8 {
+	return uint8(attrs.TexPage>>5) & 3
+}
+
+// Returns the color depth of the texture page
+func (attrs PrimitiveAttributes) TextureDepth() TextureDepth {
+	depth := TextureDepth(attrs.TexPage>>7) & 3
+	if depth > TEXTURE_DEPTH_15BIT {
+		// reserved, works like 15 bit
+		return TEXTURE_DEPTH_15BIT
+	}
+	return depth
+}
+
+// Returns the top-left corner of the texture page in VRAM
+func (attrs PrimitiveAttributes) TexPagePosition() Vec2U {
+	return Vec2U{X: (attrs.TexPage & 0xf) * 64, Y: (attrs.TexPage >> 4 & 1) * 256}
+}
+
+// Returns the position of the palette in VRAM
+func (attrs PrimitiveAttributes) ClutPosition() Vec2U {
+	return Vec2U{X: (attrs.Clut & 0x3f) * 16, Y: attrs.Clut >> 6 & 0x1ff}
+}
+
 // A single vertex with a position and color
 type Vertex struct {
 	Position Vec2
 	Color    color.RGBA
+	// Sub-pixel position computed by the GTE, only valid if HasPrecise is
+	// true. See VertexCache
+	Precise    Vec2F
+	HasPrecise bool
+	Depth      float32 // Depth computed by the GTE, 0 if unknown
+	UV         Vec2U   // Texture coordinates in the texture page, only valid if Textured is true
+	PrimitiveAttributes
 }
 
 // Stores the draw data
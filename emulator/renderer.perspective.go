@@ -0,0 +1,89 @@
+package emulator
+
+import "image/color"
+
+const (
+	// Triangles are split until their longest edge is at most this long
+	// (in pixels)
+	PERSPECTIVE_MAX_EDGE = 32
+	// Maximum amount of times a triangle is split, every split makes 4
+	// triangles
+	PERSPECTIVE_MAX_SPLITS = 3
+)
+
+// The PlayStation interpolates the vertex attributes linearly in screen
+// space (affine mapping), which warps the shading and the textures of
+// large polygons that aren't parallel to the screen. Returns the triangle
+// `tri` split into smaller triangles whose new vertices get perspective
+// correct attributes, so the affine interpolation of the host renderer
+// stays close to a perspective correct one. The triangles are appended to
+// `dst`. Only triangles with a known depth (see VertexCache) are split
+func SubdividePerspective(dst []Vertex, tri [3]Vertex) []Vertex {
+	for _, vtx := range tri {
+		if !vtx.HasPrecise || vtx.Depth <= 0 {
+			return append(dst, tri[:]...)
+		}
+	}
+	return subdividePerspective(dst, tri, PERSPECTIVE_MAX_SPLITS)
+}
+
+func subdividePerspective(dst []Vertex, tri [3]Vertex, splits int) []Vertex {
+	if splits == 0 || longestEdge(tri) <= PERSPECTIVE_MAX_EDGE {
+		return append(dst, tri[:]...)
+	}
+
+	a, b, c := tri[0], tri[1], tri[2]
+	ab := perspectiveMidpoint(a, b)
+	bc := perspectiveMidpoint(b, c)
+	ca := perspectiveMidpoint(c, a)
+
+	dst = subdividePerspective(dst, [3]Vertex{a, ab, ca}, splits-1)
+	dst = subdividePerspective(dst, [3]Vertex{ab, b, bc}, splits-1)
+	dst = subdividePerspective(dst, [3]Vertex{ca, bc, c}, splits-1)
+	return subdividePerspective(dst, [3]Vertex{ab, bc, ca}, splits-1)
+}
+
+// Returns the largest horizontal or vertical distance between two vertices
+// of `tri`
+func longestEdge(tri [3]Vertex) float32 {
+	var longest float32
+	for i := 0; i < 3; i++ {
+		p, q := tri[i].Precise, tri[(i+1)%3].Precise
+		longest = maxF32(longest, absF32(p.X-q.X))
+		longest = maxF32(longest, absF32(p.Y-q.Y))
+	}
+	return longest
+}
+
+// Returns the vertex in the middle of `p` and `q` on the screen. 1/depth
+// is linear in screen space, the attributes are interpolated with it
+func perspectiveMidpoint(p, q Vertex) Vertex {
+	invP, invQ := 1/p.Depth, 1/q.Depth
+	depth := 2 / (invP + invQ)
+	// weights of p and q in the perspective correct interpolation
+	wp, wq := invP/2*depth, invQ/2*depth
+
+	lerp := func(a, b uint8) uint8 {
+		return uint8(float32(a)*wp + float32(b)*wq + 0.5)
+	}
+
+	lerpUV := func(a, b uint16) uint16 {
+		return uint16(float32(a)*wp + float32(b)*wq + 0.5)
+	}
+
+	precise := Vec2F{X: (p.Precise.X + q.Precise.X) / 2, Y: (p.Precise.Y + q.Precise.Y) / 2}
+	return Vertex{
+		Position: NewVec2(int16(precise.X), int16(precise.Y)),
+		Color: color.RGBA{
+			R: lerp(p.Color.R, q.Color.R),
+			G: lerp(p.Color.G, q.Color.G),
+			B: lerp(p.Color.B, q.Color.B),
+			A: lerp(p.Color.A, q.Color.A),
+		},
+		Precise:             precise,
+		HasPrecise:          true,
+		Depth:               depth,
+		UV:                  Vec2U{X: lerpUV(p.UV.X, q.UV.X), Y: lerpUV(p.UV.Y, q.UV.Y)},
+		PrimitiveAttributes: p.PrimitiveAttributes,
+	}
+}
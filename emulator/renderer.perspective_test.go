@@ -0,0 +1,49 @@
+package emulator
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestSubdividePerspective(t *testing.T) {
+	vertex := func(x, y, depth float32, c uint8) Vertex {
+		return Vertex{
+			Position:   NewVec2(int16(x), int16(y)),
+			Color:      color.RGBA{c, c, c, 255},
+			Precise:    Vec2F{x, y},
+			HasPrecise: true,
+			Depth:      depth,
+		}
+	}
+
+	// a floor going away from the camera, white close and black far away
+	near := vertex(0, 200, 100, 255)
+	far := vertex(0, 0, 1000, 0)
+	mid := perspectiveMidpoint(near, far)
+	if mid.Color.R <= 128 {
+		t.Errorf("expected the close vertex to weigh more, got color %d", mid.Color.R)
+	}
+	if mid.Precise.Y != 100 || mid.Depth <= 100 || mid.Depth >= 550 {
+		t.Errorf("unexpected midpoint at y %f with depth %f", mid.Precise.Y, mid.Depth)
+	}
+
+	// the split triangles keep the attributes of the primitive
+	near.DrawingArea = image.Rect(0, 0, 320, 240)
+	near.UV, far.UV = Vec2U{0, 64}, Vec2U{0, 0}
+	if mid := perspectiveMidpoint(near, far); mid.DrawingArea != near.DrawingArea || mid.UV.Y <= 32 {
+		t.Errorf("expected the drawing area and perspective correct UVs, got %v and %v", mid.DrawingArea, mid.UV)
+	}
+
+	tri := [3]Vertex{near, far, vertex(200, 200, 100, 255)}
+	split := SubdividePerspective(nil, tri)
+	if len(split) != 3*4*4*4 {
+		t.Errorf("expected 64 triangles, got %d", len(split)/3)
+	}
+
+	// triangles without depth are kept
+	tri[2].HasPrecise = false
+	if split := SubdividePerspective(nil, tri); len(split) != 3 {
+		t.Errorf("expected the triangle without depth to be kept, got %d vertices", len(split))
+	}
+}
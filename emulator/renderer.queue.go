@@ -0,0 +1,101 @@
+package emulator
+
+import "image"
+
+// Draw data of a finished frame
+type Frame struct {
+	Vertices []Vertex
+	Offset   Vec2   // Drawing offset at the end of the frame
+	Number   uint64 // Value of GPU.Frames when the frame was finished
+	// True if the frame is shown as a 480 line interlaced field
+	Interlaced bool
+	// Parity of the VRAM lines shown by the field (0 for even lines, 1 for
+	// odd lines), only valid if Interlaced is true
+	FieldParity uint16
+	// Area of VRAM shown on the TV, see GPU.DisplayArea. Empty while the
+	// display range isn't set up
+	Display image.Rectangle
+}
+
+// Amount of vertex buffers kept for reuse: one being drawn by the GPU, one
+// waiting in the queue and one being presented
+const FRAME_QUEUE_BUFFERS = 3
+
+// Hands finished frames from the emulation goroutine to the renderer. The
+// GPU draws into DrawData (the back buffer), finished frames are swapped
+// out and never written again, so the renderer can read them without
+// locking. If the renderer is slower than the emulator, older frames are
+// dropped. The vertex buffers of presented and dropped frames go back to a
+// pool that the GPU draws the next frames into
+type FrameQueue struct {
+	ready chan *Frame   // Newest finished frame that wasn't presented yet
+	free  chan []Vertex // Vertex buffers that can be reused by the GPU
+}
+
+// Returns a new empty frame queue
+func NewFrameQueue() *FrameQueue {
+	return &FrameQueue{
+		ready: make(chan *Frame, 1),
+		free:  make(chan []Vertex, FRAME_QUEUE_BUFFERS),
+	}
+}
+
+// Moves the vertices of the finished frame out of the GPU draw data and
+// queues them. Called from the emulation goroutine
+func (queue *FrameQueue) Push(gpu *GPU) {
+	frame := &Frame{
+		Vertices: gpu.DrawData.VtxBuffer,
+		Offset:   NewVec2(gpu.DrawingXOffset, gpu.DrawingYOffset),
+		Number:   gpu.Frames,
+		// the field was already switched at the start of the frame, this is
+		// the field that shows the finished frame
+		Interlaced:  gpu.Interlaced480(),
+		FieldParity: gpu.FieldParity(),
+		Display:     gpu.DisplayArea(),
+	}
+
+	select {
+	case dropped := <-queue.ready:
+		// the renderer didn't take the last frame, drop it
+		queue.recycle(dropped.Vertices)
+	default:
+	}
+	// this is the only goroutine that sends frames, so there's room now
+	queue.ready <- frame
+
+	select {
+	case back := <-queue.free:
+		gpu.DrawData.VtxBuffer = back[:0]
+	default:
+		gpu.DrawData.VtxBuffer = nil
+	}
+}
+
+// Returns the newest finished frame, or nil if there's no new frame since
+// the last call. The frame should be given back with Release
+func (queue *FrameQueue) Pop() *Frame {
+	select {
+	case frame := <-queue.ready:
+		return frame
+	default:
+		return nil
+	}
+}
+
+// Gives the vertex buffer of a presented frame back to the GPU. The frame
+// can't be used after that
+func (queue *FrameQueue) Release(frame *Frame) {
+	queue.recycle(frame.Vertices)
+	frame.Vertices = nil
+}
+
+// Puts a vertex buffer back into the pool, unless the pool is full
+func (queue *FrameQueue) recycle(vertices []Vertex) {
+	if vertices == nil {
+		return
+	}
+	select {
+	case queue.free <- vertices:
+	default:
+	}
+}
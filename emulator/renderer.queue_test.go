@@ -0,0 +1,117 @@
+package emulator
+
+import (
+	"sync"
+	"testing"
+)
+
+func pushTestFrame(queue *FrameQueue, gpu *GPU, number int) {
+	gpu.Frames = uint64(number)
+	for i := 0; i < 3*(number%8+1); i++ {
+		gpu.DrawData.PushVertices(Vertex{Position: NewVec2(int16(number), int16(i))})
+	}
+	queue.Push(gpu)
+}
+
+func TestFrameQueueDropsOldFrames(t *testing.T) {
+	queue := NewFrameQueue()
+	gpu := NewGPU(HARDWARE_NTSC)
+
+	pushTestFrame(queue, gpu, 1)
+	pushTestFrame(queue, gpu, 2)
+	frame := queue.Pop()
+	if frame == nil || frame.Number != 2 {
+		t.Fatalf("expected frame 2, got %+v", frame)
+	}
+	if queue.Pop() != nil {
+		t.Error("expected an empty queue")
+	}
+
+	// the buffer of the dropped frame is drawn into next
+	if cap(gpu.DrawData.VtxBuffer) == 0 || len(gpu.DrawData.VtxBuffer) != 0 {
+		t.Errorf("expected a recycled empty buffer, got %d/%d", len(gpu.DrawData.VtxBuffer), cap(gpu.DrawData.VtxBuffer))
+	}
+	queue.Release(frame)
+	if frame.Vertices != nil {
+		t.Error("expected the released frame to lose its vertices")
+	}
+}
+
+// Frames are never written after they're queued, run with -race
+func TestFrameQueueConcurrent(t *testing.T) {
+	const frames = 2000
+	queue := NewFrameQueue()
+	gpu := NewGPU(HARDWARE_NTSC)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= frames; i++ {
+			pushTestFrame(queue, gpu, i)
+		}
+	}()
+
+	var last uint64
+	for last < frames {
+		frame := queue.Pop()
+		if frame == nil {
+			continue
+		}
+		if frame.Number <= last {
+			t.Fatalf("frame %d presented after frame %d", frame.Number, last)
+		}
+		if len(frame.Vertices) != 3*(int(frame.Number)%8+1) {
+			t.Fatalf("frame %d has %d vertices", frame.Number, len(frame.Vertices))
+		}
+		for _, vtx := range frame.Vertices {
+			if uint64(vtx.Position.X) != frame.Number {
+				t.Fatalf("frame %d has a vertex of frame %d", frame.Number, vtx.Position.X)
+			}
+		}
+		last = frame.Number
+		queue.Release(frame)
+	}
+	wg.Wait()
+}
+
+// Released buffers are drawn into again instead of allocating new ones
+func TestFrameQueueReusesBuffers(t *testing.T) {
+	queue := NewFrameQueue()
+	gpu := NewGPU(HARDWARE_NTSC)
+
+	pushTestFrame(queue, gpu, 1)
+	if gpu.DrawData.VtxBuffer != nil {
+		t.Fatal("expected the GPU to start a new buffer while nothing was released")
+	}
+	frame := queue.Pop()
+	if frame == nil || frame.Number != 1 || len(frame.Vertices) != 6 {
+		t.Fatalf("expected frame 1 with 6 vertices, got %+v", frame)
+	}
+	first := &frame.Vertices[0]
+	queue.Release(frame)
+
+	pushTestFrame(queue, gpu, 2)
+	if len(gpu.DrawData.VtxBuffer) != 0 || cap(gpu.DrawData.VtxBuffer) == 0 ||
+		&gpu.DrawData.VtxBuffer[:1][0] != first {
+		t.Fatal("expected the GPU to draw into the released buffer")
+	}
+
+	// the buffer of the queued frame isn't touched by the next frame
+	frame = queue.Pop()
+	pushTestFrame(queue, gpu, 3)
+	for _, vtx := range frame.Vertices {
+		if vtx.Position.X != 2 {
+			t.Fatalf("frame 2 was overwritten by frame %d", vtx.Position.X)
+		}
+	}
+
+	// releasing more buffers than the pool holds drops the extra ones
+	for i := 0; i < FRAME_QUEUE_BUFFERS+1; i++ {
+		queue.Release(&Frame{Vertices: make([]Vertex, 0, 1)})
+	}
+	queue.Release(frame)
+	if len(queue.free) != FRAME_QUEUE_BUFFERS {
+		t.Errorf("expected %d pooled buffers, got %d", FRAME_QUEUE_BUFFERS, len(queue.free))
+	}
+}
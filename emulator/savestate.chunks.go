@@ -0,0 +1,236 @@
+package emulator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Savestate chunks that aren't a part of the machine state
+const (
+	SAVESTATE_CHUNK_HEADER = "HEAD" // SaveStateHeader, always the first chunk
+	SAVESTATE_CHUNK_END    = "END " // Marks the end of the file
+)
+
+// Version of the header chunk
+const SAVESTATE_HEADER_VERSION uint32 = 1
+
+// Largest chunk that is loaded, bigger ones are corrupted
+const SAVESTATE_MAX_CHUNK_SIZE = 64 * 1024 * 1024
+
+// A part of the machine state saved in its own chunk, so every subsystem
+// can change its format without breaking the others. A chunk is its ID,
+// its version, the size of its data and the data: the gob encoded fields
+type saveStateChunk struct {
+	ID      string // 4 characters
+	Version uint32 // Version written by this emulator
+	// Fields of the machine state saved in the chunk, in order
+	Fields func(state *machineState) []interface{}
+}
+
+// Chunks of the machine state. When a field is added or removed, gob fills
+// the missing fields with zero and skips the unknown ones, so the version
+// of the chunk only has to change (with a migration) when the meaning of
+// the saved data changes
+var saveStateChunks = []saveStateChunk{
+	{"CPU ", 1, func(s *machineState) []interface{} { return []interface{}{&s.Cpu, &s.Cop0} }},
+	{"GTE ", 1, func(s *machineState) []interface{} { return []interface{}{&s.Gte} }},
+	{"TIME", 1, func(s *machineState) []interface{} { return []interface{}{&s.Time} }},
+	{"RAM ", 1, func(s *machineState) []interface{} { return []interface{}{&s.Ram, &s.ScratchPad} }},
+	{"DMA ", 1, func(s *machineState) []interface{} { return []interface{}{&s.Dma} }},
+	{"GPU ", 1, func(s *machineState) []interface{} { return []interface{}{&s.Gpu} }},
+	{"IRQ ", 1, func(s *machineState) []interface{} { return []interface{}{&s.IrqState} }},
+	{"TMRS", 1, func(s *machineState) []interface{} { return []interface{}{&s.Timers} }},
+	{"CDRM", 1, func(s *machineState) []interface{} { return []interface{}{&s.CdRom} }},
+	{"PADS", 1, func(s *machineState) []interface{} { return []interface{}{&s.PadMemCard, &s.Pads} }},
+	{"SIO1", 1, func(s *machineState) []interface{} { return []interface{}{&s.Sio1} }},
+	{"SPU ", 1, func(s *machineState) []interface{} { return []interface{}{&s.Spu} }},
+	{"BUS ", 1, func(s *machineState) []interface{} {
+		return []interface{}{&s.CacheCtrl, &s.MemControl, &s.RamSize, &s.ExpansionPost, &s.BusError}
+	}},
+}
+
+// Upgrades the data of a chunk to the next version
+type saveStateMigration func(data []byte) ([]byte, error)
+
+// Migrations of the chunks by ID: the migration at index i upgrades the
+// version i+1 to the version i+2
+var saveStateMigrations = map[string][]saveStateMigration{}
+
+// Returns the chunk with the ID `id`, or nil if it's unknown
+func findSaveStateChunk(id string) *saveStateChunk {
+	for i := range saveStateChunks {
+		if saveStateChunks[i].ID == id {
+			return &saveStateChunks[i]
+		}
+	}
+	return nil
+}
+
+// Fixed size start of a chunk
+type saveStateChunkHeader struct {
+	ID      [4]byte
+	Version uint32
+	Size    uint32
+}
+
+// Writes a chunk holding the gob encoded `values`
+func writeSaveStateChunk(w io.Writer, id string, version uint32, values ...interface{}) error {
+	var data bytes.Buffer
+	enc := gob.NewEncoder(&data)
+	for _, value := range values {
+		if err := enc.Encode(value); err != nil {
+			return fmt.Errorf("savestate: chunk %s: %w", id, err)
+		}
+	}
+
+	header := saveStateChunkHeader{Version: version, Size: uint32(data.Len())}
+	copy(header.ID[:], id)
+	if err := binary.Write(w, binary.LittleEndian, &header); err != nil {
+		return err
+	}
+	_, err := w.Write(data.Bytes())
+	return err
+}
+
+// Reads the next chunk. Returns its ID, its version and its data
+func readSaveStateChunk(r io.Reader) (string, uint32, []byte, error) {
+	var header saveStateChunkHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return "", 0, nil, fmt.Errorf("%w: %s", ErrInvalidSaveState, err)
+	}
+	id := string(header.ID[:])
+	if header.Size > SAVESTATE_MAX_CHUNK_SIZE {
+		return "", 0, nil, fmt.Errorf("%w: chunk %q is too big (%d bytes)", ErrInvalidSaveState, id, header.Size)
+	}
+	data := make([]byte, header.Size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return "", 0, nil, fmt.Errorf("%w: chunk %q: %s", ErrInvalidSaveState, id, err)
+	}
+	return id, header.Version, data, nil
+}
+
+// Decodes the gob encoded `values` of a chunk
+func decodeSaveStateChunk(id string, data []byte, values ...interface{}) error {
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	for _, value := range values {
+		if err := dec.Decode(value); err != nil {
+			return fmt.Errorf("%w: chunk %q: %s", ErrInvalidSaveState, id, err)
+		}
+	}
+	return nil
+}
+
+// Upgrades the data of a chunk from `version` to the version of `chunk`
+func migrateSaveStateChunk(chunk *saveStateChunk, version uint32, data []byte) ([]byte, error) {
+	if version == 0 || version > chunk.Version {
+		return nil, fmt.Errorf(
+			"%w: chunk %q has version %d, this version of gopsx loads up to %d",
+			ErrInvalidSaveState, chunk.ID, version, chunk.Version,
+		)
+	}
+	migrations := saveStateMigrations[chunk.ID]
+	for ; version < chunk.Version; version++ {
+		if int(version) > len(migrations) {
+			return nil, fmt.Errorf("%w: chunk %q: no migration from version %d", ErrInvalidSaveState, chunk.ID, version)
+		}
+		var err error
+		if data, err = migrations[version-1](data); err != nil {
+			return nil, fmt.Errorf("%w: chunk %q: %s", ErrInvalidSaveState, chunk.ID, err)
+		}
+	}
+	return data, nil
+}
+
+// Writes the header and the machine state as chunks
+func writeSaveStateChunks(w io.Writer, header *SaveStateHeader, state *machineState) error {
+	if err := writeSaveStateChunk(w, SAVESTATE_CHUNK_HEADER, SAVESTATE_HEADER_VERSION, header); err != nil {
+		return err
+	}
+	for _, chunk := range saveStateChunks {
+		if err := writeSaveStateChunk(w, chunk.ID, chunk.Version, chunk.Fields(state)...); err != nil {
+			return err
+		}
+	}
+	return writeSaveStateChunk(w, SAVESTATE_CHUNK_END, 1)
+}
+
+// Reads the header chunk
+func readSaveStateHeaderChunk(r io.Reader) (*SaveStateHeader, error) {
+	id, version, data, err := readSaveStateChunk(r)
+	if err != nil {
+		return nil, err
+	}
+	if id != SAVESTATE_CHUNK_HEADER {
+		return nil, fmt.Errorf("%w: the first chunk is %q", ErrInvalidSaveState, id)
+	}
+	if version != SAVESTATE_HEADER_VERSION {
+		return nil, fmt.Errorf("%w: unsupported header version %d", ErrInvalidSaveState, version)
+	}
+	header := &SaveStateHeader{}
+	if err := decodeSaveStateChunk(id, data, header); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// Reads the chunks of the machine state, up to the end chunk. Unknown
+// chunks (from a newer version of gopsx) are skipped, every known chunk
+// must be there
+func readSaveStateChunks(r io.Reader, state *machineState) error {
+	loaded := map[string]bool{}
+	for {
+		id, version, data, err := readSaveStateChunk(r)
+		if err != nil {
+			return err
+		}
+		if id == SAVESTATE_CHUNK_END {
+			break
+		}
+		chunk := findSaveStateChunk(id)
+		if chunk == nil {
+			Log.Warnf(LOG_MODULE_INTER, "savestate: skipping unknown chunk %q", id)
+			continue
+		}
+		if loaded[id] {
+			return fmt.Errorf("%w: chunk %q is there twice", ErrInvalidSaveState, id)
+		}
+		if data, err = migrateSaveStateChunk(chunk, version, data); err != nil {
+			return err
+		}
+		if err := decodeSaveStateChunk(id, data, chunk.Fields(state)...); err != nil {
+			return err
+		}
+		loaded[id] = true
+	}
+
+	for _, chunk := range saveStateChunks {
+		if !loaded[chunk.ID] {
+			return fmt.Errorf("%w: missing chunk %q", ErrInvalidSaveState, chunk.ID)
+		}
+	}
+	return nil
+}
+
+// Reads a version 1 savestate: the header and the machine state in a
+// single gob stream. The fields that were added since are left at zero
+func readSaveStateV1(r io.Reader, state *machineState) (*SaveStateHeader, error) {
+	dec := gob.NewDecoder(r)
+	header := &SaveStateHeader{}
+	if err := dec.Decode(header); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSaveState, err)
+	}
+	if state == nil {
+		return header, nil
+	}
+	if err := dec.Decode(state); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSaveState, err)
+	}
+	return header, nil
+}
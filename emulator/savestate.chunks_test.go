@@ -0,0 +1,172 @@
+package emulator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"testing"
+)
+
+// Returns a savestate of the saveStateTest program after a few steps
+func testSaveState(t testing.TB) []byte {
+	cpu := saveStateTest.makeCpu(CPU_MODE_INTERPRETER)
+	for i := 0; i < 100; i++ {
+		cpu.Step()
+	}
+	var buf bytes.Buffer
+	if err := WriteSaveState(&buf, cpu); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Splits a version 2 savestate into its chunks, after the prefix
+func splitSaveStateChunks(t *testing.T, state []byte) [][]byte {
+	var chunks [][]byte
+	for pos := 12; pos < len(state); {
+		size := int(binary.LittleEndian.Uint32(state[pos+8:]))
+		chunks = append(chunks, state[pos:pos+12+size])
+		pos += 12 + size
+	}
+	return chunks
+}
+
+func joinSaveStateChunks(chunks [][]byte) []byte {
+	state := []byte(SAVESTATE_MAGIC + "\x02\x00\x00\x00")
+	for _, chunk := range chunks {
+		state = append(state, chunk...)
+	}
+	return state
+}
+
+func TestSaveStateChunks(t *testing.T) {
+	state := testSaveState(t)
+	chunks := splitSaveStateChunks(t, state)
+	if len(chunks) != len(saveStateChunks)+2 {
+		t.Fatalf("expected %d chunks, got %d", len(saveStateChunks)+2, len(chunks))
+	}
+	if string(chunks[0][:4]) != SAVESTATE_CHUNK_HEADER || string(chunks[len(chunks)-1][:4]) != SAVESTATE_CHUNK_END {
+		t.Fatal("the header and the end chunks are missing")
+	}
+	load := func(chunks [][]byte) error {
+		cpu := saveStateTest.makeCpu(CPU_MODE_INTERPRETER)
+		_, err := ReadSaveState(bytes.NewReader(joinSaveStateChunks(chunks)), cpu)
+		return err
+	}
+	if err := load(chunks); err != nil {
+		t.Fatal(err)
+	}
+
+	// chunks of a newer version of the emulator are skipped
+	unknown := make([]byte, 16)
+	copy(unknown, "NEW1\x01\x00\x00\x00\x04\x00\x00\x00data")
+	withUnknown := append([][]byte{chunks[0], unknown}, chunks[1:]...)
+	if err := load(withUnknown); err != nil {
+		t.Errorf("unknown chunk: %v", err)
+	}
+
+	// a missing chunk or a chunk that is too new can't be loaded
+	withoutCpu := append([][]byte{chunks[0]}, chunks[2:]...)
+	if err := load(withoutCpu); !errors.Is(err, ErrInvalidSaveState) {
+		t.Errorf("missing chunk: expected ErrInvalidSaveState, got %v", err)
+	}
+	newer := append([]byte(nil), chunks[1]...)
+	binary.LittleEndian.PutUint32(newer[4:], 99)
+	withNewer := append([][]byte{chunks[0], newer}, chunks[2:]...)
+	if err := load(withNewer); !errors.Is(err, ErrInvalidSaveState) {
+		t.Errorf("newer chunk: expected ErrInvalidSaveState, got %v", err)
+	}
+}
+
+func TestSaveStateMigration(t *testing.T) {
+	state := testSaveState(t)
+
+	// pretend the bus chunk changed: version 2 stores the POST value + 1
+	chunk := findSaveStateChunk("BUS ")
+	chunk.Version = 2
+	saveStateMigrations["BUS "] = []saveStateMigration{func(data []byte) ([]byte, error) {
+		var cacheCtrl CacheControl
+		var memControl [9]uint32
+		var ramSize uint32
+		var post uint8
+		var busError bool
+		values := []interface{}{&cacheCtrl, &memControl, &ramSize, &post, &busError}
+		if err := decodeSaveStateChunk("BUS ", data, values...); err != nil {
+			return nil, err
+		}
+		post++
+		var buf bytes.Buffer
+		enc := gob.NewEncoder(&buf)
+		for _, value := range values {
+			if err := enc.Encode(value); err != nil {
+				return nil, err
+			}
+		}
+		return buf.Bytes(), nil
+	}}
+	defer func() {
+		chunk.Version = 1
+		delete(saveStateMigrations, "BUS ")
+	}()
+
+	cpu := saveStateTest.makeCpu(CPU_MODE_INTERPRETER)
+	if _, err := ReadSaveState(bytes.NewReader(state), cpu); err != nil {
+		t.Fatal(err)
+	}
+	if cpu.Inter.Expansion.Post != 1 {
+		t.Errorf("expected the migrated POST value 1, got %d", cpu.Inter.Expansion.Post)
+	}
+}
+
+func TestSaveStateV1(t *testing.T) {
+	cpu := saveStateTest.makeCpu(CPU_MODE_INTERPRETER)
+	for i := 0; i < 100; i++ {
+		cpu.Step()
+	}
+	machine, err := newMachineState(cpu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	buf.WriteString(SAVESTATE_MAGIC + "\x01\x00\x00\x00")
+	enc := gob.NewEncoder(&buf)
+	if err := enc.Encode(&SaveStateHeader{GameID: "SLUS-00594", Frame: 12}); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Encode(machine); err != nil {
+		t.Fatal(err)
+	}
+	state := buf.Bytes()
+
+	header, err := ReadSaveStateHeader(bytes.NewReader(state))
+	if err != nil || header.GameID != "SLUS-00594" || header.Frame != 12 {
+		t.Fatalf("unexpected header %+v (%v)", header, err)
+	}
+	loaded := saveStateTest.makeCpu(CPU_MODE_INTERPRETER)
+	if _, err := ReadSaveState(bytes.NewReader(state), loaded); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.PC != cpu.PC || loaded.Regs != cpu.Regs {
+		t.Errorf("the version 1 state wasn't loaded: PC 0x%08x/0x%08x", loaded.PC, cpu.PC)
+	}
+}
+
+// Corrupted savestates must be rejected with an error, not crash the
+// emulator
+func FuzzReadSaveState(f *testing.F) {
+	state := testSaveState(f)
+	f.Add(state)
+	f.Add(state[:len(state)/2])
+	f.Add(state[:40])
+	flipped := append([]byte(nil), state...)
+	flipped[len(flipped)/3] ^= 0xff
+	f.Add(flipped)
+	f.Add([]byte(SAVESTATE_MAGIC + "\x02\x00\x00\x00HEAD\x01\x00\x00\x00\xff\xff\xff\xff"))
+
+	cpu := saveStateTest.makeCpu(CPU_MODE_INTERPRETER)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ReadSaveState(bytes.NewReader(data), cpu)
+		ReadSaveStateHeader(bytes.NewReader(data))
+	})
+}
@@ -0,0 +1,664 @@
+package emulator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"strings"
+	"time"
+)
+
+// Savestate files start with this string
+const SAVESTATE_MAGIC = "GOPSXSTA"
+
+// Version of the savestate format written by WriteSaveState. Version 2
+// saves every subsystem in its own versioned chunk (see saveStateChunks),
+// version 1 files (a single gob stream) can still be loaded
+const SAVESTATE_VERSION uint32 = 2
+
+// Size of the screenshot stored in savestates
+const (
+	SAVESTATE_THUMBNAIL_WIDTH  = 160
+	SAVESTATE_THUMBNAIL_HEIGHT = 120
+)
+
+// Returned when loading a file that is not a savestate, has an unsupported
+// version or doesn't fit the emulated hardware. Use errors.Is to check for
+// it
+var ErrInvalidSaveState = errors.New("invalid savestate")
+
+// Returned by Console.SaveState and Console.LoadState if the console isn't
+// running anymore. Use errors.Is to check for it
+var ErrConsoleStopped = errors.New("console stopped")
+
+// Information stored at the start of a savestate, it can be read without
+// loading the whole state with ReadSaveStateHeader
+type SaveStateHeader struct {
+	GameID    string    // Game ID of the inserted disc, empty without a disc
+	Time      time.Time // When the state was saved
+	Frame     uint64    // Amount of frames output by the GPU, see GPU.Frames
+	Thumbnail []byte    // PNG screenshot, SAVESTATE_THUMBNAIL_WIDTH wide
+}
+
+// Returns the decoded screenshot of the savestate
+func (header *SaveStateHeader) Image() (image.Image, error) {
+	return png.Decode(bytes.NewReader(header.Thumbnail))
+}
+
+type saveStatePrefix struct {
+	Magic   [8]byte
+	Version uint32
+}
+
+// CPU registers, the pointers to the other components are not saved
+type cpuRegisterState struct {
+	PC               uint32
+	NextPC           uint32
+	CurrentPC        uint32
+	Regs             [32]uint32
+	OutRegs          [32]uint32
+	Load             LoadDelay
+	BranchOccured    bool
+	BranchTaken      bool
+	DelaySlot        bool
+	DelaySlotTaken   bool
+	DataBreak        bool
+	Hi               uint32
+	Lo               uint32
+	MultDivBusyUntil uint64
+	ICache           [0x100]*ICacheLine
+}
+
+// Controller in a port or in a multitap slot
+type padState struct {
+	Type    string // Go type of the profile, only loaded into the same type
+	Seq     uint8
+	Active  bool
+	Profile []byte // Gob encoded profile, see encodeProfile
+}
+
+// Multitap profile without the controllers, they're saved separately
+type multitapState struct {
+	Slot      uint8
+	Card      bool
+	MultiMode bool
+	InMulti   bool
+	Buffer    [MULTITAP_SLOTS * MULTITAP_SLOT_REPLY_SIZE]byte
+}
+
+// Everything that is saved in a savestate after the header. Host objects
+// (the disc, the frame queue, callbacks, the BIOS...) are left out and
+// kept from the running console when the state is loaded
+type machineState struct {
+	Cpu           cpuRegisterState
+	Cop0          Cop0
+	Gte           GTE
+	Time          TimeHandler
+	Ram           []byte
+	ScratchPad    []byte
+	Dma           DMA
+	Gpu           GPU
+	CacheCtrl     CacheControl
+	IrqState      IrqState
+	Timers        Timers
+	CdRom         CdRom
+	PadMemCard    PadMemCard
+	Pads          []padState // Port 1, port 2, then the multitap slots
+	MemControl    [9]uint32
+	RamSize       uint32
+	Sio1          Sio1
+	Spu           SPU
+	ExpansionPost uint8
+	BusError      bool
+}
+
+// The frame queue belongs to the renderer, it's not saved
+func (queue *FrameQueue) GobEncode() ([]byte, error) {
+	return nil, nil
+}
+
+func (queue *FrameQueue) GobDecode(data []byte) error {
+	return nil
+}
+
+// VRAM is saved as raw little endian pixels, gob is slow with large
+// integer arrays
+func (vram *VRam) GobEncode() ([]byte, error) {
+	data := make([]byte, len(vram.Pixels)*2)
+	for i, pixel := range vram.Pixels {
+		binary.LittleEndian.PutUint16(data[i*2:], pixel)
+	}
+	return data, nil
+}
+
+func (vram *VRam) GobDecode(data []byte) error {
+	if len(data) != len(vram.Pixels)*2 {
+		return fmt.Errorf("%w: %d bytes of VRAM", ErrInvalidSaveState, len(data))
+	}
+	for i := range vram.Pixels {
+		vram.Pixels[i] = binary.LittleEndian.Uint16(data[i*2:])
+	}
+	return nil
+}
+
+// Only the pixels of the image load received so far are saved
+func (buf *ImageBuffer) GobEncode() ([]byte, error) {
+	data := make([]byte, 12+buf.Index*2)
+	binary.LittleEndian.PutUint16(data[0:], buf.Position.X)
+	binary.LittleEndian.PutUint16(data[2:], buf.Position.Y)
+	binary.LittleEndian.PutUint16(data[4:], buf.Resolution.X)
+	binary.LittleEndian.PutUint16(data[6:], buf.Resolution.Y)
+	binary.LittleEndian.PutUint32(data[8:], buf.Index)
+	for i, pixel := range buf.Buffer[:buf.Index] {
+		binary.LittleEndian.PutUint16(data[12+i*2:], pixel)
+	}
+	return data, nil
+}
+
+func (buf *ImageBuffer) GobDecode(data []byte) error {
+	if len(data) < 12 {
+		return fmt.Errorf("%w: truncated image buffer", ErrInvalidSaveState)
+	}
+	index := binary.LittleEndian.Uint32(data[8:])
+	if index > uint32(len(buf.Buffer)) || uint32(len(data)) != 12+index*2 {
+		return fmt.Errorf("%w: image buffer of %d pixels", ErrInvalidSaveState, index)
+	}
+	buf.Reset(
+		binary.LittleEndian.Uint16(data[0:]), binary.LittleEndian.Uint16(data[2:]),
+		binary.LittleEndian.Uint16(data[4:]), binary.LittleEndian.Uint16(data[6:]),
+	)
+	buf.Index = index
+	for i := range buf.Buffer[:index] {
+		buf.Buffer[i] = binary.LittleEndian.Uint16(data[12+i*2:])
+	}
+	return nil
+}
+
+// Returns the controllers in the ports and in the multitap slots, in the
+// order they're saved
+func statePads(card *PadMemCard) []*Gamepad {
+	var pads []*Gamepad
+	for _, pad := range []*Gamepad{card.Pad1, card.Pad2} {
+		pads = append(pads, pad)
+		if tap, ok := pad.Profile.(*MultitapProfile); ok {
+			pads = append(pads, tap.Slots[:]...)
+		}
+	}
+	return pads
+}
+
+// Returns the name of the controller type saved in savestates. The
+// controllers moved to the input package, the names stay "*emulator.X" so
+// that older savestates still load
+func profileTypeName(profile Profile) string {
+	return strings.Replace(fmt.Sprintf("%T", profile), "*input.", "*emulator.", 1)
+}
+
+// Encodes the state of a controller profile. Callbacks like
+// DualShockProfile.OnRumble are not saved
+func encodeProfile(profile Profile) ([]byte, error) {
+	var value interface{} = profile
+	switch p := profile.(type) {
+	case *DummyPadProfile:
+		return nil, nil
+	case *MultitapProfile:
+		value = multitapState{p.Slot, p.Card, p.MultiMode, p.InMulti, p.Buffer}
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Loads a state written by encodeProfile into `profile`, which must have
+// the same type
+func decodeProfile(profile Profile, data []byte) error {
+	decode := func(v interface{}) error {
+		return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+	}
+
+	switch p := profile.(type) {
+	case *DigitalPadProfile:
+		var state DigitalPadProfile
+		if err := decode(&state); err != nil {
+			return err
+		}
+		*p = state
+	case *DualShockProfile:
+		var state DualShockProfile
+		if err := decode(&state); err != nil {
+			return err
+		}
+		state.OnRumble = p.OnRumble
+		*p = state
+	case *GunconProfile:
+		var state GunconProfile
+		if err := decode(&state); err != nil {
+			return err
+		}
+		*p = state
+	case *MouseProfile:
+		var state MouseProfile
+		if err := decode(&state); err != nil {
+			return err
+		}
+		*p = state
+	case *NegconProfile:
+		var state NegconProfile
+		if err := decode(&state); err != nil {
+			return err
+		}
+		*p = state
+	case *MultitapProfile:
+		var state multitapState
+		if err := decode(&state); err != nil {
+			return err
+		}
+		p.Slot, p.Card, p.MultiMode, p.InMulti = state.Slot, state.Card, state.MultiMode, state.InMulti
+		p.Buffer = state.Buffer
+	}
+	return nil
+}
+
+// Returns a small PNG picture of the last frame
+func (gpu *GPU) thumbnail() ([]byte, error) {
+	src := gpu.captureImage
+	if src == nil {
+		vram := gpu.VRam.Image()
+		offset := NewVec2(gpu.DrawingXOffset, gpu.DrawingYOffset)
+		RasterizeMasked(vram, gpu.VRam.MaskPlane(), gpu.DrawData.VtxBuffer, offset)
+
+		area := gpu.DisplayArea().Intersect(vram.Bounds())
+		if area.Empty() {
+			area = vram.Bounds()
+		}
+		src = vram.SubImage(area).(*image.RGBA)
+	}
+
+	// nearest neighbour scaling
+	bounds := src.Bounds()
+	thumb := image.NewRGBA(image.Rect(0, 0, SAVESTATE_THUMBNAIL_WIDTH, SAVESTATE_THUMBNAIL_HEIGHT))
+	for y := 0; y < SAVESTATE_THUMBNAIL_HEIGHT; y++ {
+		sy := bounds.Min.Y + y*bounds.Dy()/SAVESTATE_THUMBNAIL_HEIGHT
+		for x := 0; x < SAVESTATE_THUMBNAIL_WIDTH; x++ {
+			sx := bounds.Min.X + x*bounds.Dx()/SAVESTATE_THUMBNAIL_WIDTH
+			thumb.SetRGBA(x, y, src.RGBAAt(sx, sy))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, thumb); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Writes the state of the console running `cpu` to `w`. Must not run
+// while the CPU is running on another goroutine, see Console.SaveState
+func WriteSaveState(w io.Writer, cpu *CPU) error {
+	inter := cpu.Inter
+	thumbnail, err := inter.Gpu.thumbnail()
+	if err != nil {
+		return err
+	}
+	header := SaveStateHeader{
+		Time:      time.Now(),
+		Frame:     inter.Gpu.Frames,
+		Thumbnail: thumbnail,
+	}
+	if inter.CdRom.Disc != nil {
+		header.GameID = inter.CdRom.Disc.GameID()
+	}
+	state, err := newMachineState(cpu)
+	if err != nil {
+		return err
+	}
+
+	prefix := saveStatePrefix{Version: SAVESTATE_VERSION}
+	copy(prefix.Magic[:], SAVESTATE_MAGIC)
+	if err := binary.Write(w, binary.LittleEndian, &prefix); err != nil {
+		return err
+	}
+	return writeSaveStateChunks(w, &header, state)
+}
+
+// Returns the state of the console running `cpu`, without the host objects
+func newMachineState(cpu *CPU) (*machineState, error) {
+	inter := cpu.Inter
+	state := &machineState{
+		Cpu: cpuRegisterState{
+			PC:               cpu.PC,
+			NextPC:           cpu.NextPC,
+			CurrentPC:        cpu.CurrentPC,
+			Regs:             cpu.Regs,
+			OutRegs:          cpu.OutRegs,
+			Load:             cpu.Load,
+			BranchOccured:    cpu.BranchOccured,
+			BranchTaken:      cpu.BranchTaken,
+			DelaySlot:        cpu.DelaySlot,
+			DelaySlotTaken:   cpu.DelaySlotTaken,
+			DataBreak:        cpu.DataBreak,
+			Hi:               cpu.Hi,
+			Lo:               cpu.Lo,
+			MultDivBusyUntil: cpu.MultDivBusyUntil,
+			ICache:           cpu.ICache,
+		},
+		Cop0:          *cpu.Cop0,
+		Gte:           *inter.Gte,
+		Time:          *cpu.Th,
+		Ram:           inter.Ram.Data[:],
+		ScratchPad:    inter.ScratchPad.Data[:],
+		Dma:           *inter.Dma,
+		Gpu:           *inter.Gpu,
+		CacheCtrl:     inter.CacheCtrl,
+		IrqState:      *inter.IrqState,
+		Timers:        *inter.Timers,
+		CdRom:         *inter.CdRom,
+		PadMemCard:    *inter.PadMemCard,
+		MemControl:    inter.MemControl,
+		RamSize:       inter.RamSize,
+		Sio1:          *inter.Sio1,
+		Spu:           *inter.Spu,
+		ExpansionPost: inter.Expansion.Post,
+		BusError:      inter.BusError,
+	}
+
+	// leave out the host objects
+	state.Gte.Pgxp = nil
+	state.Gpu.Logger = nil
+	state.CdRom.Disc = nil
+	state.CdRom.NextDisc = nil
+	mixer := *inter.CdRom.Mixer
+	mixer.Output = nil
+	mixer.Spu = nil
+	state.CdRom.Mixer = &mixer
+	state.PadMemCard.Pad1 = nil
+	state.PadMemCard.Pad2 = nil
+	state.Sio1.Link = nil
+
+	for _, pad := range statePads(inter.PadMemCard) {
+		profile, err := encodeProfile(pad.Profile)
+		if err != nil {
+			return nil, err
+		}
+		state.Pads = append(state.Pads, padState{
+			Type:    profileTypeName(pad.Profile),
+			Seq:     pad.Seq,
+			Active:  pad.Active,
+			Profile: profile,
+		})
+	}
+	return state, nil
+}
+
+// Checks the magic string and returns the version of the savestate
+func readSaveStatePrefix(r io.Reader) (uint32, error) {
+	var prefix saveStatePrefix
+	if err := binary.Read(r, binary.LittleEndian, &prefix); err != nil {
+		return 0, err
+	}
+	if string(prefix.Magic[:]) != SAVESTATE_MAGIC {
+		return 0, ErrInvalidSaveState
+	}
+	if prefix.Version == 0 || prefix.Version > SAVESTATE_VERSION {
+		return 0, fmt.Errorf("%w: unsupported version %d", ErrInvalidSaveState, prefix.Version)
+	}
+	return prefix.Version, nil
+}
+
+// Reads the header of a savestate written by WriteSaveState, without the
+// machine state
+func ReadSaveStateHeader(r io.Reader) (*SaveStateHeader, error) {
+	version, err := readSaveStatePrefix(r)
+	if err != nil {
+		return nil, err
+	}
+	if version == 1 {
+		return readSaveStateV1(r, nil)
+	}
+	return readSaveStateHeaderChunk(r)
+}
+
+// Loads a savestate written by WriteSaveState into the console running
+// `cpu`. Host settings (the disc, the renderer, callbacks, PGXP, the
+// overclock...) are kept. Nothing is changed if the state can't be read.
+// Must not run while the CPU is running on another goroutine, see
+// Console.LoadState
+func ReadSaveState(r io.Reader, cpu *CPU) (*SaveStateHeader, error) {
+	version, err := readSaveStatePrefix(r)
+	if err != nil {
+		return nil, err
+	}
+	// always decode into zero values: gob leaves the fields that were
+	// saved as zero untouched
+	state := &machineState{}
+	var header *SaveStateHeader
+	if version == 1 {
+		header, err = readSaveStateV1(r, state)
+	} else if header, err = readSaveStateHeaderChunk(r); err == nil {
+		err = readSaveStateChunks(r, state)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := state.validate(); err != nil {
+		return nil, err
+	}
+
+	inter := cpu.Inter
+	if disc := inter.CdRom.Disc; disc != nil && disc.GameID() != header.GameID {
+		Log.Warnf(LOG_MODULE_CDROM, "savestate: saved with \"%s\", the disc is \"%s\"", header.GameID, disc.GameID())
+	}
+	state.apply(cpu)
+	// the triggers start over with the new memory. Not in apply, the
+	// run-ahead snapshots must keep the hit counts
+	inter.Achievements.Reset()
+	return header, nil
+}
+
+// Copies a saved RAM image. Only the pages that changed are written, so the
+// compiled blocks of the other pages stay valid
+func (ram *RAM) restore(data []byte) {
+	for offset := 0; offset < len(ram.Data); offset += CODE_PAGE_SIZE {
+		page := ram.Data[offset : offset+CODE_PAGE_SIZE]
+		saved := data[offset : offset+CODE_PAGE_SIZE]
+		if bytes.Equal(page, saved) {
+			continue
+		}
+		copy(page, saved)
+		if ram.CodePages != nil {
+			ram.CodePages.Write(uint32(offset))
+		}
+	}
+}
+
+// Returns an error if the state doesn't fit the emulated hardware
+func (state *machineState) validate() error {
+	switch {
+	case len(state.Ram) != RAM_ALLOC_SIZE:
+		return fmt.Errorf("%w: %d bytes of RAM", ErrInvalidSaveState, len(state.Ram))
+	case len(state.ScratchPad) != SCRATCH_PAD_SIZE:
+		return fmt.Errorf("%w: %d bytes of scratchpad", ErrInvalidSaveState, len(state.ScratchPad))
+	case state.Gpu.VRam == nil || state.Gpu.DrawData == nil || state.Gpu.LoadBuffer == nil:
+		return fmt.Errorf("%w: missing GPU state", ErrInvalidSaveState)
+	case state.CdRom.Mixer == nil:
+		return fmt.Errorf("%w: missing CD-ROM state", ErrInvalidSaveState)
+	}
+	return nil
+}
+
+// Replaces the state of the running components. The components are
+// updated in place because they're shared between the CPU and the
+// interconnect
+func (state *machineState) apply(cpu *CPU) {
+	inter := cpu.Inter
+
+	cpu.PC = state.Cpu.PC
+	cpu.NextPC = state.Cpu.NextPC
+	cpu.CurrentPC = state.Cpu.CurrentPC
+	cpu.Regs = state.Cpu.Regs
+	cpu.OutRegs = state.Cpu.OutRegs
+	cpu.Load = state.Cpu.Load
+	cpu.BranchOccured = state.Cpu.BranchOccured
+	cpu.Debugger.CallStack.Reset() // the calls of the savestate aren't known
+	cpu.BranchTaken = state.Cpu.BranchTaken
+	cpu.DelaySlot = state.Cpu.DelaySlot
+	cpu.DelaySlotTaken = state.Cpu.DelaySlotTaken
+	cpu.DataBreak = state.Cpu.DataBreak
+	cpu.Hi = state.Cpu.Hi
+	cpu.Lo = state.Cpu.Lo
+	cpu.MultDivBusyUntil = state.Cpu.MultDivBusyUntil
+	cpu.ICache = state.Cpu.ICache
+	*cpu.Cop0 = state.Cop0
+
+	state.Gte.Widescreen = inter.Gte.Widescreen
+	state.Gte.Pgxp = inter.Gte.Pgxp
+	*inter.Gte = state.Gte
+
+	state.Time.Overclock = cpu.Th.Overclock
+	state.Time.OverclockRem %= state.Time.Overclock
+	if state.Time.SpuSheet == nil {
+		// saved before the SPU had a time sheet
+		state.Time.SpuSheet = &TimeSheet{LastSync: state.Time.Cycles, NextSync: state.Time.Cycles}
+	}
+	*cpu.Th = state.Time
+
+	inter.Ram.restore(state.Ram)
+	copy(inter.ScratchPad.Data[:], state.ScratchPad)
+	*inter.Dma = state.Dma
+
+	gpu := inter.Gpu
+	state.Gpu.FrameEnd = gpu.FrameEnd
+	state.Gpu.FrameQueue = gpu.FrameQueue
+	state.Gpu.Pgxp = gpu.Pgxp
+	state.Gpu.NoDither = gpu.NoDither
+	state.Gpu.Capture = gpu.Capture
+	state.Gpu.Logger = gpu.Logger
+	*gpu = state.Gpu
+	if gpu.GP0WordsRemaining > 0 && gpu.GP0Mode == GP0_MODE_COMMAND {
+		// the handler of the unfinished command isn't saved
+		_, gpu.GP0Handler = gpu.gp0Command(gpu.GP0Command.Buffer[0] >> 24)
+	}
+
+	inter.CacheCtrl = state.CacheCtrl
+	*inter.IrqState = state.IrqState
+	*inter.Timers = state.Timers
+
+	cdrom := inter.CdRom
+	state.CdRom.Disc = cdrom.Disc
+	state.CdRom.NextDisc = cdrom.NextDisc
+	state.CdRom.Mixer.Output = cdrom.Mixer.Output
+	state.CdRom.Mixer.Spu = cdrom.Mixer.Spu
+	state.CdRom.Mixer.SetHost(cdrom.Mixer.Host())
+	state.CdRom.Timings = cdrom.Timings // a setting of the host
+	state.CdRom.Deterministic = cdrom.Deterministic
+	*cdrom = state.CdRom
+
+	card := inter.PadMemCard
+	state.PadMemCard.Pad1 = card.Pad1
+	state.PadMemCard.Pad2 = card.Pad2
+	*card = state.PadMemCard
+	for i, pad := range statePads(card) {
+		if i >= len(state.Pads) {
+			break
+		}
+		saved := state.Pads[i]
+		if saved.Type != profileTypeName(pad.Profile) {
+			Log.Warnf(LOG_MODULE_PAD, "savestate: controller %d is a %T, the state has a %s", i, pad.Profile, saved.Type)
+			continue
+		}
+		if err := decodeProfile(pad.Profile, saved.Profile); err != nil {
+			Log.Warnf(LOG_MODULE_PAD, "savestate: controller %d: %s", i, err)
+			continue
+		}
+		pad.Seq = saved.Seq
+		pad.Active = saved.Active
+	}
+
+	inter.MemControl = state.MemControl
+	inter.RamSize = state.RamSize
+	state.Sio1.Link = inter.Sio1.Link
+	*inter.Sio1 = state.Sio1
+	state.Spu.Reverb = inter.Spu.Reverb // a setting of the host
+	*inter.Spu = state.Spu
+	inter.Expansion.Post = state.ExpansionPost
+	inter.BusError = state.BusError
+
+	inter.UpdateTimings()
+	inter.MapFastmem()
+}
+
+// Saves the state of the console to `w`, see WriteSaveState. The state is
+// taken between two instructions on the emulation goroutine
+func (console *Console) SaveState(w io.Writer) error {
+	var buf bytes.Buffer
+	var err error
+	if !console.Call(func() { err = WriteSaveState(&buf, console.Cpu) }) {
+		return ErrConsoleStopped
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// Loads a savestate written by SaveState, see ReadSaveState. Returns the
+// header of the state
+func (console *Console) LoadState(r io.Reader) (*SaveStateHeader, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var header *SaveStateHeader
+	ok := console.Call(func() {
+		header, err = ReadSaveState(bytes.NewReader(data), console.Cpu)
+		if err == nil {
+			// don't run OnFrame again for the loaded frame
+			console.Frame = console.Cpu.Inter.Gpu.Frames
+			console.resetThrottle()
+		}
+	})
+	if !ok {
+		return nil, ErrConsoleStopped
+	}
+	return header, err
+}
+
+// Savestate kept in memory, without the header and the thumbnail. It's
+// much faster to take than WriteSaveState, see Console.SetRunAhead
+type Snapshot struct {
+	data bytes.Buffer
+}
+
+// Saves the state of the console running `cpu` into the snapshot,
+// replacing the previous one
+func (snap *Snapshot) Save(cpu *CPU) error {
+	state, err := newMachineState(cpu)
+	if err != nil {
+		return err
+	}
+	snap.data.Reset()
+	return gob.NewEncoder(&snap.data).Encode(state)
+}
+
+// Loads the snapshot into the console running `cpu`, like ReadSaveState
+func (snap *Snapshot) Restore(cpu *CPU) error {
+	state := &machineState{}
+	if err := gob.NewDecoder(bytes.NewReader(snap.data.Bytes())).Decode(state); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSaveState, err)
+	}
+	if err := state.validate(); err != nil {
+		return err
+	}
+	state.apply(cpu)
+	return nil
+}
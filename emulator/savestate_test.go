@@ -0,0 +1,144 @@
+package emulator
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"testing"
+)
+
+// A loop that keeps counting in $1 and storing the counter to RAM
+var saveStateTest = cpuTest{
+	Initial: cpuState{Regs: []cpuRegister{{2, 0x80001000}}},
+	Program: []uint32{
+		asmI(0x09, 1, 1, 1),       // ADDIU $1, $1, 1
+		asmI(0x2b, 1, 2, 0),       // SW $1, 0($2)
+		asmI(0x23, 3, 2, 0),       // LW $3, 0($2)
+		asmJ(0x02, CPU_TEST_BASE), // J CPU_TEST_BASE
+		asmR(0x21, 4, 3, 1),       // ADDU $4, $3, $1 (delay slot)
+	},
+}
+
+func TestSaveStateRoundTrip(t *testing.T) {
+	for _, mode := range []CpuMode{CPU_MODE_INTERPRETER, CPU_MODE_JIT, CPU_MODE_CACHED} {
+		cpu := saveStateTest.makeCpu(mode)
+		for i := 0; i < 5000; i++ {
+			cpu.Step()
+		}
+		// leave a GP0 command unfinished, its handler isn't saved
+		gpu := cpu.Inter.Gpu
+		gpu.GP0(0x28ff0000)
+		gpu.GP0(0x00100010)
+		vertices := len(gpu.DrawData.VtxBuffer)
+
+		var buf bytes.Buffer
+		if err := WriteSaveState(&buf, cpu); err != nil {
+			t.Fatal(err)
+		}
+		state := buf.Bytes()
+
+		run := func() (uint32, [32]uint32, uint64, uint32) {
+			for i := 0; i < 5000; i++ {
+				cpu.Step()
+			}
+			return cpu.PC, cpu.Regs, cpu.Th.Cycles, cpu.Inter.Load32(0x80001000, cpu.Th)
+		}
+		pc, regs, cycles, mem := run()
+
+		header, err := ReadSaveState(bytes.NewReader(state), cpu)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Frame != gpu.Frames || header.GameID != "" {
+			t.Errorf("unexpected header %+v", header)
+		}
+		gotPC, gotRegs, gotCycles, gotMem := run()
+		if gotPC != pc || gotRegs != regs || gotCycles != cycles || gotMem != mem {
+			t.Errorf("mode %d: the loaded state diverged: PC 0x%08x/0x%08x, $1 %d/%d, cycles %d/%d, RAM %d/%d",
+				mode, gotPC, pc, gotRegs[1], regs[1], gotCycles, cycles, gotMem, mem)
+		}
+
+		gpu.GP0(0x00100020)
+		gpu.GP0(0x00200010)
+		gpu.GP0(0x00200020)
+		if len(gpu.DrawData.VtxBuffer) <= vertices {
+			t.Errorf("mode %d: the unfinished quad wasn't drawn", mode)
+		}
+	}
+}
+
+func TestSaveStateHeader(t *testing.T) {
+	cpu := saveStateTest.makeCpu(CPU_MODE_INTERPRETER)
+	cpu.Inter.Gpu.Frames = 1234
+
+	var buf bytes.Buffer
+	if err := WriteSaveState(&buf, cpu); err != nil {
+		t.Fatal(err)
+	}
+	header, err := ReadSaveStateHeader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Frame != 1234 || header.Time.IsZero() {
+		t.Errorf("unexpected header %+v", header)
+	}
+	img, err := header.Image()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Size(); size.X != SAVESTATE_THUMBNAIL_WIDTH || size.Y != SAVESTATE_THUMBNAIL_HEIGHT {
+		t.Errorf("unexpected thumbnail size %v", size)
+	}
+
+	garbage := bytes.NewReader([]byte("GOPSXMOV\x01\x00\x00\x00garbage"))
+	if _, err := ReadSaveState(garbage, cpu); !errors.Is(err, ErrInvalidSaveState) {
+		t.Errorf("expected ErrInvalidSaveState, got %v", err)
+	}
+}
+
+func TestSaveStateProfileNames(t *testing.T) {
+	// savestates from before the input package must still match
+	for profile, expected := range map[Profile]string{
+		NewDigitalPad(): "*emulator.DigitalPadProfile",
+		NewDualShock():  "*emulator.DualShockProfile",
+		NewMultitap():   "*emulator.MultitapProfile",
+	} {
+		if name := profileTypeName(profile); name != expected {
+			t.Errorf("expected %s, got %s", expected, name)
+		}
+	}
+}
+
+func TestRunAhead(t *testing.T) {
+	newConsole := func(mode CpuMode) *Console {
+		cpu := saveStateTest.makeCpu(mode)
+		// start the video timing, nothing touches the GPU
+		cpu.Inter.Gpu.Sync(cpu.Th, cpu.Inter.IrqState)
+		return NewConsole(cpu)
+	}
+	for _, mode := range []CpuMode{CPU_MODE_INTERPRETER, CPU_MODE_JIT, CPU_MODE_CACHED} {
+		ahead := newConsole(mode)
+		ahead.runAhead = 2
+		shown := 0
+		ahead.Cpu.Inter.Gpu.Capture = func(*image.RGBA) { shown++ }
+		normal := newConsole(mode)
+
+		for i := 0; i < 2; i++ {
+			ahead.runFramesAhead()
+			normal.runFrame(true)
+		}
+		// the frames that were run ahead are thrown away
+		a, n := ahead.Cpu, normal.Cpu
+		if a.PC != n.PC || a.Regs != n.Regs || a.Th.Cycles != n.Th.Cycles || a.Inter.Gpu.Frames != n.Inter.Gpu.Frames {
+			t.Errorf("mode %d: run-ahead diverged: PC 0x%08x/0x%08x, $1 %d/%d, cycles %d/%d",
+				mode, a.PC, n.PC, a.Regs[1], n.Regs[1], a.Th.Cycles, n.Th.Cycles)
+		}
+		// only the last frame ahead is shown every frame
+		if shown != 2 {
+			t.Errorf("mode %d: expected 2 shown frames, got %d", mode, shown)
+		}
+		if ahead.runAhead != 2 {
+			t.Errorf("mode %d: run-ahead was turned off", mode)
+		}
+	}
+}
@@ -18,52 +18,62 @@ func NewScratchPad() *ScratchPad {
 }
 
 // Loads a value at `offset`
-func (sp *ScratchPad) Load(offset uint32, size AccessSize) interface{} {
-	var v uint32 = 0
-	sizeI := uint32(size)
-
-	for i := uint32(0); i < sizeI; i++ {
-		v |= uint32(sp.Data[offset+i]) << (i * 8)
+func (sp *ScratchPad) Load(offset uint32, size AccessSize) uint32 {
+	switch size {
+	case ACCESS_BYTE:
+		return uint32(sp.Load8(offset))
+	case ACCESS_HALFWORD:
+		return uint32(sp.Load16(offset))
+	default:
+		return sp.Load32(offset)
 	}
-	return accessSizeU32(size, v)
 }
 
 // Stores `val` into `offset`
-func (sp *ScratchPad) Store(offset uint32, size AccessSize, val interface{}) {
-	valU32 := accessSizeToU32(size, val)
-	sizeI := uint32(size)
-
-	for i := uint32(0); i < sizeI; i++ {
-		sp.Data[offset+i] = byte(valU32 >> (i * 8))
+func (sp *ScratchPad) Store(offset uint32, size AccessSize, val uint32) {
+	switch size {
+	case ACCESS_BYTE:
+		sp.Store8(offset, uint8(val))
+	case ACCESS_HALFWORD:
+		sp.Store16(offset, uint16(val))
+	default:
+		sp.Store32(offset, val)
 	}
 }
 
 // Load a 32 bit little endian word at `offset`
 func (sp *ScratchPad) Load32(offset uint32) uint32 {
-	return sp.Load(offset, ACCESS_WORD).(uint32)
+	return uint32(sp.Data[offset]) |
+		uint32(sp.Data[offset+1])<<8 |
+		uint32(sp.Data[offset+2])<<16 |
+		uint32(sp.Data[offset+3])<<24
 }
 
 // Load a 16 bit little endian value at `offset`
 func (sp *ScratchPad) Load16(offset uint32) uint16 {
-	return sp.Load(offset, ACCESS_HALFWORD).(uint16)
+	return uint16(sp.Data[offset]) | uint16(sp.Data[offset+1])<<8
 }
 
 // Fetches the byte at `offset`
 func (sp *ScratchPad) Load8(offset uint32) byte {
-	return sp.Load(offset, ACCESS_BYTE).(byte)
+	return sp.Data[offset]
 }
 
 // Store a 32 bit little endian word `val` into `offset`
 func (sp *ScratchPad) Store32(offset, val uint32) {
-	sp.Store(offset, ACCESS_WORD, val)
+	sp.Data[offset] = byte(val)
+	sp.Data[offset+1] = byte(val >> 8)
+	sp.Data[offset+2] = byte(val >> 16)
+	sp.Data[offset+3] = byte(val >> 24)
 }
 
 // Stores a 16 bit little endian value into `offset`
 func (sp *ScratchPad) Store16(offset uint32, val uint16) {
-	sp.Store(offset, ACCESS_HALFWORD, val)
+	sp.Data[offset] = byte(val)
+	sp.Data[offset+1] = byte(val >> 8)
 }
 
 // Sets the byte at `offset`
 func (sp *ScratchPad) Store8(offset uint32, val byte) {
-	sp.Store(offset, ACCESS_BYTE, val)
+	sp.Data[offset] = val
 }
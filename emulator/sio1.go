@@ -0,0 +1,183 @@
+package emulator
+
+// Size of the SIO1 receive FIFO
+const SIO1_RX_FIFO_SIZE = 8
+
+// Other end of the second serial port
+type SerialLink interface {
+	Send(b byte)            // Sends a byte
+	SetLines(dtr, rts bool) // Sets the DTR and RTS output levels
+	Poll() (byte, bool)     // Returns the next received byte, if any
+	Lines() (dsr, cts bool) // Returns the DSR and CTS input levels
+}
+
+// Second serial port (SIO1), used by link cables and serial debug monitors
+type Sio1 struct {
+	Link      SerialLink // Can be nil if nothing is plugged in
+	Mode      uint16
+	Control   uint16
+	Misc      uint16
+	Baud      uint16
+	RxFifo    []byte
+	Interrupt bool // Interrupt is pending until acknowledged in the control register
+}
+
+// Returns a new SIO1 instance without a link
+func NewSio1() *Sio1 {
+	return &Sio1{}
+}
+
+// Returns true if the transmitter is enabled
+func (sio *Sio1) TxEnabled() bool {
+	return sio.Control&(1<<0) != 0
+}
+
+// Returns the DTR output level
+func (sio *Sio1) Dtr() bool {
+	return sio.Control&(1<<1) != 0
+}
+
+// Returns the RTS output level
+func (sio *Sio1) Rts() bool {
+	return sio.Control&(1<<5) != 0
+}
+
+// Returns the amount of received bytes that trigger an interrupt
+func (sio *Sio1) RxIrqThreshold() int {
+	return 1 << ((sio.Control >> 8) & 3)
+}
+
+// Returns the input lines of the link, or both off if nothing is plugged in
+func (sio *Sio1) lines() (bool, bool) {
+	if sio.Link == nil {
+		return false, false
+	}
+	return sio.Link.Lines()
+}
+
+// Returns the value of the SIO_STAT register
+func (sio *Sio1) Status() uint32 {
+	dsr, cts := sio.lines()
+
+	var stat uint32
+	stat |= 1 << 0 // TX ready, bytes are sent right away
+	stat |= oneIfTrue(len(sio.RxFifo) > 0) << 1
+	stat |= 1 << 2 // TX finished
+	stat |= oneIfTrue(dsr) << 7
+	stat |= oneIfTrue(cts) << 8
+	stat |= oneIfTrue(sio.Interrupt) << 9
+	return stat
+}
+
+// Triggers an interrupt if one isn't pending already
+func (sio *Sio1) raiseIrq(irqState *IrqState) {
+	if !sio.Interrupt {
+		sio.Interrupt = true
+		irqState.SetHigh(INTERRUPT_SIO)
+	}
+}
+
+// Moves received bytes into the RX FIFO and updates the interrupt
+func (sio *Sio1) Poll(irqState *IrqState) {
+	if sio.Link == nil {
+		return
+	}
+
+	for len(sio.RxFifo) < SIO1_RX_FIFO_SIZE {
+		b, ok := sio.Link.Poll()
+		if !ok {
+			break
+		}
+		sio.RxFifo = append(sio.RxFifo, b)
+	}
+
+	if sio.Control&(1<<11) != 0 && len(sio.RxFifo) >= sio.RxIrqThreshold() {
+		sio.raiseIrq(irqState)
+	}
+	if dsr, _ := sio.Link.Lines(); dsr && sio.Control&(1<<12) != 0 {
+		sio.raiseIrq(irqState)
+	}
+}
+
+// Handles a load from the SIO1 registers. A 32 bit load from SIO_MODE also
+// returns SIO_CTRL in the upper halfword
+func (sio *Sio1) Load(offset uint32, size AccessSize, irqState *IrqState) uint32 {
+	sio.Poll(irqState)
+
+	switch offset {
+	case 0: // RX data
+		if len(sio.RxFifo) == 0 {
+			return 0
+		}
+		b := sio.RxFifo[0]
+		sio.RxFifo = sio.RxFifo[1:]
+		return uint32(b)
+	case 4:
+		return sio.Status()
+	case 8:
+		if size == ACCESS_WORD {
+			return uint32(sio.Mode) | uint32(sio.Control)<<16
+		}
+		return uint32(sio.Mode)
+	case 10:
+		return uint32(sio.Control)
+	case 12:
+		return uint32(sio.Misc)
+	case 14:
+		return uint32(sio.Baud)
+	default:
+		Log.Warnf(LOG_MODULE_NET, "sio1: unhandled read from register %d", offset)
+	}
+	return 0
+}
+
+// Handles a store to the SIO1 registers. A 32 bit store to SIO_MODE also
+// sets SIO_CTRL with the upper halfword
+func (sio *Sio1) Store(offset uint32, val uint32, size AccessSize, irqState *IrqState) {
+	switch offset {
+	case 0: // TX data
+		if sio.TxEnabled() && sio.Link != nil {
+			sio.Link.Send(uint8(val))
+		}
+		if sio.Control&(1<<10) != 0 {
+			sio.raiseIrq(irqState)
+		}
+	case 4:
+		Log.Warnf(LOG_MODULE_NET, "sio1: ignoring write to SIO_STAT <- 0x%x", val)
+	case 8:
+		sio.Mode = uint16(val)
+		if size == ACCESS_WORD {
+			sio.SetControl(uint16(val >> 16))
+		}
+	case 10:
+		sio.SetControl(uint16(val))
+	case 12:
+		sio.Misc = uint16(val)
+	case 14:
+		sio.Baud = uint16(val)
+	default:
+		Log.Warnf(LOG_MODULE_NET, "sio1: ignoring write to register %d <- 0x%x", offset, val)
+	}
+}
+
+// Sets the SIO_CTRL register
+func (sio *Sio1) SetControl(val uint16) {
+	if val&(1<<6) != 0 {
+		// reset
+		sio.Mode = 0
+		sio.Control = 0
+		sio.Baud = 0
+		sio.RxFifo = sio.RxFifo[:0]
+		sio.Interrupt = false
+	} else {
+		if val&(1<<4) != 0 {
+			// acknowledge
+			sio.Interrupt = false
+		}
+		sio.Control = val &^ (1<<4 | 1<<6)
+	}
+
+	if sio.Link != nil {
+		sio.Link.SetLines(sio.Dtr(), sio.Rts())
+	}
+}
@@ -0,0 +1,263 @@
+package emulator
+
+import (
+	"io"
+	"net"
+	"sync"
+)
+
+// Message types sent over a TCP serial link. Every message is 2 bytes long:
+// the type and the value
+const (
+	SERIAL_TCP_DATA  uint8 = iota // Value is a data byte
+	SERIAL_TCP_LINES uint8 = iota // Bit 0 is DTR, bit 1 is RTS
+)
+
+// Maximum amount of bytes waiting to be received or sent. Bytes are kept
+// while no peer is connected, bytes sent while the queue is full are
+// dropped and counted
+const SERIAL_TCP_QUEUE_SIZE = 1024
+
+// Serial link to another emulator over TCP. The remote DTR and RTS outputs
+// are connected to the local DSR and CTS inputs, like a link cable
+type TcpSerialLink struct {
+	rx       chan byte
+	mu       sync.Mutex
+	conn     net.Conn
+	listener net.Listener
+	dsr      bool
+	cts      bool
+	lines    uint8 // Last sent output lines
+	// Messages waiting for the writer, in order. Line changes are merged
+	// into the last message if it's a line change too, so they're never
+	// dropped
+	tx      [][2]byte
+	txBytes int           // Data bytes in tx
+	wake    chan struct{} // Signals the writer that tx or the connection changed
+	dropped uint64        // Bytes dropped because the queue was full
+	done    chan struct{} // Closed by Close
+	once    sync.Once
+}
+
+func newTcpSerialLink() *TcpSerialLink {
+	return &TcpSerialLink{
+		rx:   make(chan byte, SERIAL_TCP_QUEUE_SIZE),
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+}
+
+// Listens on `addr` and accepts one connection at a time in the background
+func ListenSerialTcp(addr string) (*TcpSerialLink, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	link := newTcpSerialLink()
+	link.listener = listener
+	go link.writer()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return // listener was closed
+			}
+			Log.Infof(LOG_MODULE_NET, "sio1: %s connected", conn.RemoteAddr())
+			link.serve(conn)
+		}
+	}()
+	return link, nil
+}
+
+// Connects to a link listening on `addr`
+func DialSerialTcp(addr string) (*TcpSerialLink, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewConnSerialLink(conn), nil
+}
+
+// Returns a link over an open connection, which is closed with the link
+func NewConnSerialLink(conn net.Conn) *TcpSerialLink {
+	link := newTcpSerialLink()
+	go link.writer()
+	go link.serve(conn)
+	return link
+}
+
+// Reads messages from `conn` until it's closed
+func (link *TcpSerialLink) serve(conn net.Conn) {
+	link.mu.Lock()
+	select {
+	case <-link.done:
+		// closed before the connection was set up
+		link.mu.Unlock()
+		conn.Close()
+		return
+	default:
+	}
+	link.conn = conn
+	// tell the other side about our current output lines
+	link.queueLines()
+	link.mu.Unlock()
+	link.signal()
+
+	var msg [2]byte
+	for {
+		if _, err := io.ReadFull(conn, msg[:]); err != nil {
+			break
+		}
+
+		switch msg[0] {
+		case SERIAL_TCP_DATA:
+			select {
+			case link.rx <- msg[1]:
+			case <-link.done:
+			}
+		case SERIAL_TCP_LINES:
+			link.mu.Lock()
+			link.dsr = msg[1]&1 != 0
+			link.cts = msg[1]&2 != 0
+			link.mu.Unlock()
+		}
+	}
+
+	Log.Infof(LOG_MODULE_NET, "sio1: %s disconnected", conn.RemoteAddr())
+	link.mu.Lock()
+	link.conn = nil
+	link.dsr, link.cts = false, false
+	link.mu.Unlock()
+	conn.Close()
+}
+
+// Wakes up the writer
+func (link *TcpSerialLink) signal() {
+	select {
+	case link.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Queues the current output lines. The caller holds link.mu
+func (link *TcpSerialLink) queueLines() {
+	if n := len(link.tx); n > 0 && link.tx[n-1][0] == SERIAL_TCP_LINES {
+		link.tx[n-1][1] = link.lines
+		return
+	}
+	link.tx = append(link.tx, [2]byte{SERIAL_TCP_LINES, link.lines})
+}
+
+// Sends queued messages to the current connection until the link is
+// closed. Messages stay queued while no peer is connected
+func (link *TcpSerialLink) writer() {
+	for {
+		select {
+		case <-link.wake:
+		case <-link.done:
+			return
+		}
+
+		link.mu.Lock()
+		conn, msgs := link.conn, link.tx
+		if conn == nil {
+			link.mu.Unlock()
+			continue
+		}
+		dataBytes := link.txBytes
+		link.tx, link.txBytes = nil, 0
+		link.mu.Unlock()
+
+		buf := make([]byte, 0, len(msgs)*2)
+		for _, msg := range msgs {
+			buf = append(buf, msg[:]...)
+		}
+		if _, err := conn.Write(buf); err != nil {
+			// the peer is gone, the bytes aren't resent to the next one
+			link.mu.Lock()
+			link.dropped += uint64(dataBytes)
+			link.mu.Unlock()
+			Log.Warnf(LOG_MODULE_NET, "sio1: dropped %d bytes: %s", dataBytes, err)
+		}
+	}
+}
+
+// Queues a byte. Bytes sent while the queue is full are dropped and logged,
+// see Dropped
+func (link *TcpSerialLink) Send(b byte) {
+	link.mu.Lock()
+	if link.txBytes >= SERIAL_TCP_QUEUE_SIZE {
+		link.dropped++
+		dropped := link.dropped
+		link.mu.Unlock()
+		if dropped%SERIAL_TCP_QUEUE_SIZE == 1 {
+			Log.Warnf(LOG_MODULE_NET, "sio1: send queue full, dropped %d bytes", dropped)
+		}
+		return
+	}
+	link.tx = append(link.tx, [2]byte{SERIAL_TCP_DATA, b})
+	link.txBytes++
+	link.mu.Unlock()
+	link.signal()
+}
+
+// Returns the amount of bytes dropped because the send queue was full or
+// the connection failed
+func (link *TcpSerialLink) Dropped() uint64 {
+	link.mu.Lock()
+	defer link.mu.Unlock()
+	return link.dropped
+}
+
+// Sends the output lines if they changed
+func (link *TcpSerialLink) SetLines(dtr, rts bool) {
+	lines := uint8(oneIfTrue(dtr)) | uint8(oneIfTrue(rts))<<1
+
+	link.mu.Lock()
+	changed := lines != link.lines
+	link.lines = lines
+	if changed {
+		link.queueLines()
+	}
+	link.mu.Unlock()
+
+	if changed {
+		link.signal()
+	}
+}
+
+// Returns the next received byte without blocking
+func (link *TcpSerialLink) Poll() (byte, bool) {
+	select {
+	case b := <-link.rx:
+		return b, true
+	default:
+		return 0, false
+	}
+}
+
+// Returns the remote DTR and RTS output levels
+func (link *TcpSerialLink) Lines() (dsr, cts bool) {
+	link.mu.Lock()
+	defer link.mu.Unlock()
+	return link.dsr, link.cts
+}
+
+// Closes the connection and the listener and stops the writer
+func (link *TcpSerialLink) Close() error {
+	link.once.Do(func() {
+		close(link.done)
+	})
+
+	link.mu.Lock()
+	defer link.mu.Unlock()
+
+	if link.listener != nil {
+		link.listener.Close()
+	}
+	if link.conn != nil {
+		return link.conn.Close()
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package emulator
+
+import (
+	"io"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// Registers of SIO1 on the bus
+const (
+	sio1Data    = 0x1f801050
+	sio1Stat    = 0x1f801054
+	sio1Mode    = 0x1f801058
+	sio1Control = 0x1f80105a
+)
+
+func TestSio1Registers(t *testing.T) {
+	inter := newBenchInterconnect()
+	th := NewTimeHandler()
+
+	// a word access to SIO_MODE covers SIO_CTRL too
+	inter.Store32(sio1Mode, 0x0021_004e, th)
+	if inter.Sio1.Mode != 0x004e || inter.Sio1.Control != 0x0021 {
+		t.Fatalf("expected mode 0x4e and control 0x21, got 0x%x and 0x%x", inter.Sio1.Mode, inter.Sio1.Control)
+	}
+	if got := inter.Load32(sio1Mode, th); got != 0x0021_004e {
+		t.Errorf("expected 0x0021004e, got 0x%x", got)
+	}
+	if got := inter.Load16(sio1Control, th); got != 0x0021 {
+		t.Errorf("expected control 0x21, got 0x%x", got)
+	}
+
+	// SIO_STAT is read-only and odd offsets aren't registers, these are
+	// ignored instead of stopping the emulator
+	inter.Store32(sio1Stat, 0xffffffff, th)
+	inter.Store8(sio1Mode+1, 0xff, th)
+	if got := inter.Load8(sio1Mode+1, th); got != 0 {
+		t.Errorf("expected 0 from an odd offset, got 0x%x", got)
+	}
+	if inter.Sio1.Mode != 0x004e {
+		t.Errorf("expected the mode to be kept, got 0x%x", inter.Sio1.Mode)
+	}
+	if got := inter.Load32(sio1Stat, th); got != 0x5 {
+		t.Errorf("expected the status to be TX ready and finished, got 0x%x", got)
+	}
+}
+
+// Waits up to a second for `cond` to be true
+func waitSio1(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSio1TcpLink(t *testing.T) {
+	connA, connB := net.Pipe()
+	linkA, linkB := NewConnSerialLink(connA), NewConnSerialLink(connB)
+	defer linkA.Close()
+	defer linkB.Close()
+
+	interA, interB := newBenchInterconnect(), newBenchInterconnect()
+	interA.Sio1.Link, interB.Sio1.Link = linkA, linkB
+	th := NewTimeHandler()
+
+	// B interrupts on every received byte, A enables the transmitter and
+	// raises DTR and RTS, which are the DSR and CTS inputs of B
+	interB.Store16(sio1Control, 1<<11, th)
+	interA.Store16(sio1Control, 1<<0|1<<1|1<<5, th)
+	waitSio1(t, "DSR and CTS", func() bool {
+		return interB.Load32(sio1Stat, th)&(1<<7|1<<8) == 1<<7|1<<8
+	})
+	if interB.IrqState.Latched(INTERRUPT_SIO) {
+		t.Fatal("expected no interrupt before a byte is received")
+	}
+
+	interA.Store8(sio1Data, 0x42, th)
+	waitSio1(t, "the byte", func() bool {
+		return interB.Load32(sio1Stat, th)&(1<<1) != 0
+	})
+	if stat := interB.Load32(sio1Stat, th); stat&(1<<9) == 0 || !interB.IrqState.Latched(INTERRUPT_SIO) {
+		t.Fatalf("expected an SIO interrupt, status 0x%x", stat)
+	}
+	if got := interB.Load8(sio1Data, th); got != 0x42 {
+		t.Errorf("expected 0x42, got 0x%x", got)
+	}
+	if stat := interB.Load32(sio1Stat, th); stat&(1<<1) != 0 {
+		t.Errorf("expected an empty RX FIFO, status 0x%x", stat)
+	}
+
+	// acknowledge the interrupt
+	interB.Store16(sio1Control, 1<<11|1<<4, th)
+	if stat := interB.Load32(sio1Stat, th); stat&(1<<9) != 0 {
+		t.Errorf("expected the interrupt to be acknowledged, status 0x%x", stat)
+	}
+
+	// without the transmitter enabled nothing is sent
+	interA.Store16(sio1Control, 0, th)
+	interA.Store8(sio1Data, 0x43, th)
+	waitSio1(t, "DSR to drop", func() bool {
+		return interB.Load32(sio1Stat, th)&(1<<7) == 0
+	})
+	if stat := interB.Load32(sio1Stat, th); stat&(1<<1) != 0 {
+		t.Errorf("expected nothing to be received, status 0x%x", stat)
+	}
+}
+
+// Bytes sent before a peer connects are kept, bytes that don't fit in the
+// queue are counted
+func TestSio1TcpLinkQueue(t *testing.T) {
+	link, err := ListenSerialTcp("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer link.Close()
+
+	link.SetLines(true, false)
+	for i := 0; i < SERIAL_TCP_QUEUE_SIZE+5; i++ {
+		link.Send(byte(i))
+	}
+	link.SetLines(true, true)
+	if dropped := link.Dropped(); dropped != 5 {
+		t.Errorf("expected 5 dropped bytes, got %d", dropped)
+	}
+
+	conn, err := net.Dial("tcp", link.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	// the line changes are sent in order with the bytes
+	msgs := make([]byte, 2*(SERIAL_TCP_QUEUE_SIZE+2))
+	if _, err := io.ReadFull(conn, msgs); err != nil {
+		t.Fatal(err)
+	}
+	if msgs[0] != SERIAL_TCP_LINES || msgs[1] != 1 {
+		t.Errorf("expected DTR first, got %x", msgs[:2])
+	}
+	for i := 0; i < SERIAL_TCP_QUEUE_SIZE; i++ {
+		if msg := msgs[2+i*2 : 4+i*2]; msg[0] != SERIAL_TCP_DATA || msg[1] != byte(i) {
+			t.Fatalf("byte %d: expected %x, got %x", i, byte(i), msg)
+		}
+	}
+	if last := msgs[len(msgs)-2:]; last[0] != SERIAL_TCP_LINES || last[1] != 3 {
+		t.Errorf("expected DTR and RTS last, got %x", last)
+	}
+}
+
+// Closing a link stops its goroutines
+func TestSio1TcpLinkClose(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		connA, connB := net.Pipe()
+		linkA, linkB := NewConnSerialLink(connA), NewConnSerialLink(connB)
+		linkA.Send(1)
+		linkA.Close()
+		linkB.Close()
+	}
+
+	for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > before; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d goroutines after closing the links, got %d", before, runtime.NumGoroutine())
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package emulator
+
+import "github.com/zeozeozeo/gopsx/emulator/spu"
+
+// The SPU is in its own package, see spu.SPU
+type (
+	SPU             = spu.SPU
+	SoundRam        = spu.SoundRam
+	SpuTransferMode = spu.TransferMode
+)
+
+const (
+	SPU_RAM_SIZE    = spu.SPU_RAM_SIZE
+	SPU_VOICE_COUNT = spu.SPU_VOICE_COUNT
+)
+
+// Returns a new SPU instance with cleared sound RAM
+func NewSPU() *SPU {
+	return spu.New()
+}
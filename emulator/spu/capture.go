@@ -0,0 +1,129 @@
+package spu
+
+import "github.com/zeozeozeo/gopsx/emulator/bus"
+
+const (
+	SPU_SAMPLE_CYCLES   = 768   // CPU cycles per 44.1kHz sample
+	SPU_SYNC_SAMPLES    = 0x100 // Longest time between two synchronizations, in samples
+	SPU_CAPTURE_SAMPLES = 0x200 // Halfwords in each capture buffer
+	// CD audio samples kept for the capture buffers, two sectors. The CD-ROM
+	// controller sends a whole sector at once, the SPU takes one sample at a
+	// time
+	SPU_CD_CAPTURE_SIZE = 2 * 588 * 2
+)
+
+// Sound RAM addresses of the capture buffers
+const (
+	SPU_CAPTURE_CD_LEFT  = 0x000 // CD audio, left channel
+	SPU_CAPTURE_CD_RIGHT = 0x400 // CD audio, right channel
+	SPU_CAPTURE_VOICE1   = 0x800 // Voice 1 after its envelope
+	SPU_CAPTURE_VOICE3   = 0xc00 // Voice 3 after its envelope
+	SPU_CAPTURE_END      = 0x1000
+)
+
+// Runs the SPU up to the current time, writing a sample to the capture
+// buffers every SPU_SAMPLE_CYCLES cycles
+func (spu *SPU) Sync(th *bus.TimeHandler, irqState *bus.IrqState) {
+	delta := th.Sync(bus.PERIPHERAL_SPU)
+
+	if spu.Control&SPU_CONTROL_ENABLE != 0 {
+		spu.Cycles += delta
+		for spu.Cycles >= SPU_SAMPLE_CYCLES {
+			spu.Cycles -= SPU_SAMPLE_CYCLES
+			spu.Capture()
+		}
+	}
+
+	spu.MaybeRaiseIrq(irqState)
+	spu.PredictNextSync(th)
+}
+
+// Schedules the next synchronization. It's at the sample that triggers the
+// IRQ if it's in the capture buffers, the SPU also syncs every
+// SPU_SYNC_SAMPLES samples so it never has to catch up for too long
+func (spu *SPU) PredictNextSync(th *bus.TimeHandler) {
+	if spu.Control&SPU_CONTROL_ENABLE == 0 {
+		th.RemoveNextSync(bus.PERIPHERAL_SPU)
+		return
+	}
+
+	samples := uint64(SPU_SYNC_SAMPLES)
+	if irqSamples, ok := spu.samplesToCaptureIrq(); ok && irqSamples < samples {
+		samples = irqSamples
+	}
+	th.SetNextSyncDelta(bus.PERIPHERAL_SPU, samples*SPU_SAMPLE_CYCLES-spu.Cycles)
+}
+
+// Returns the amount of samples until a capture buffer write triggers the
+// IRQ. Returns false if the IRQ is disabled, already set, or its address is
+// outside of the capture buffers
+func (spu *SPU) samplesToCaptureIrq() (uint64, bool) {
+	irqAddr := spu.IrqAddr()
+	if spu.Control&SPU_CONTROL_IRQ_ENABLE == 0 || spu.IrqFlag || irqAddr >= SPU_CAPTURE_END {
+		return 0, false
+	}
+
+	// the IRQ covers 4 halfwords, the first one is at `first`
+	first := (irqAddr % (SPU_CAPTURE_SAMPLES * 2)) / 2
+	if spu.CaptureIndex-first < 4 {
+		return 1, true
+	}
+	return uint64((first-spu.CaptureIndex)&(SPU_CAPTURE_SAMPLES-1)) + 1, true
+}
+
+// Writes the next sample to the capture buffers. The voices aren't
+// emulated, their buffers are filled with silence
+func (spu *SPU) Capture() {
+	var left, right int16
+	if len(spu.CdCapture) >= 2 {
+		left, right = spu.CdCapture[0], spu.CdCapture[1]
+		spu.CdCapture = spu.CdCapture[2:]
+	}
+
+	offset := spu.CaptureIndex * 2
+	spu.writeCapture(SPU_CAPTURE_CD_LEFT+offset, left)
+	spu.writeCapture(SPU_CAPTURE_CD_RIGHT+offset, right)
+	spu.writeCapture(SPU_CAPTURE_VOICE1+offset, 0)
+	spu.writeCapture(SPU_CAPTURE_VOICE3+offset, 0)
+	spu.CaptureIndex = (spu.CaptureIndex + 1) & (SPU_CAPTURE_SAMPLES - 1)
+}
+
+func (spu *SPU) writeCapture(addr uint32, val int16) {
+	spu.CheckIrq(addr)
+	spu.Ram[addr] = byte(val)
+	spu.Ram[addr+1] = byte(uint16(val) >> 8)
+}
+
+// Queues interleaved stereo CD audio `samples` for the capture buffers.
+// The oldest samples are dropped if the SPU doesn't keep up
+func (spu *SPU) QueueCdCapture(samples []int16) {
+	spu.CdCapture = append(spu.CdCapture, samples...)
+	if extra := len(spu.CdCapture) - SPU_CD_CAPTURE_SIZE; extra > 0 {
+		spu.CdCapture = append(spu.CdCapture[:0], spu.CdCapture[extra&^1:]...)
+	}
+}
+
+// Returns the IRQ address in bytes
+func (spu *SPU) IrqAddr() uint32 {
+	return uint32(spu.Regs[SPU_IRQ_ADDR>>1]) * 8
+}
+
+// Sets the IRQ flag if the IRQ is enabled and `addr` is in the 8 bytes at
+// the IRQ address. The interrupt is raised by MaybeRaiseIrq
+func (spu *SPU) CheckIrq(addr uint32) {
+	if spu.Control&SPU_CONTROL_IRQ_ENABLE == 0 || spu.IrqFlag {
+		return
+	}
+	if addr&^7 == spu.IrqAddr() {
+		spu.IrqFlag = true
+		spu.IrqPending = true
+	}
+}
+
+// Raises the SPU interrupt if the IRQ flag was set since the last call
+func (spu *SPU) MaybeRaiseIrq(irqState *bus.IrqState) {
+	if spu.IrqPending {
+		spu.IrqPending = false
+		irqState.SetHigh(bus.INTERRUPT_SPU)
+	}
+}
@@ -0,0 +1,6 @@
+// Package spu emulates the Sound Processing Unit of the PlayStation: the
+// sound RAM and its transfers, the IRQ, the capture buffers and the reverb
+// of the CD audio. The voices aren't emulated yet. It only depends on the
+// bus package, the emulator package connects it to the memory bus, the DMA
+// and the CD-ROM audio.
+package spu
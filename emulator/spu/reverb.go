@@ -0,0 +1,184 @@
+package spu
+
+// Reverb register offsets. The d* registers are addresses and the m*
+// registers offsets in the work area (in 8 byte units), the v* registers
+// are signed volumes (0x8000 is -1.0, 0x7fff is almost 1.0)
+const (
+	SPU_REVERB_OUT_LEFT  = 0x184 // vLOUT
+	SPU_REVERB_OUT_RIGHT = 0x186 // vROUT
+	SPU_REVERB_BASE      = 0x1a2 // mBASE, start of the work area
+	SPU_REVERB_APF1      = 0x1c0 // dAPF1
+	SPU_REVERB_APF2      = 0x1c2 // dAPF2
+	SPU_REVERB_IIR       = 0x1c4 // vIIR
+	SPU_REVERB_COMB1     = 0x1c6 // vCOMB1
+	SPU_REVERB_COMB2     = 0x1c8 // vCOMB2
+	SPU_REVERB_COMB3     = 0x1ca // vCOMB3
+	SPU_REVERB_COMB4     = 0x1cc // vCOMB4
+	SPU_REVERB_WALL      = 0x1ce // vWALL
+	SPU_REVERB_APF1_VOL  = 0x1d0 // vAPF1
+	SPU_REVERB_APF2_VOL  = 0x1d2 // vAPF2
+	SPU_REVERB_L_SAME    = 0x1d4 // mLSAME
+	SPU_REVERB_R_SAME    = 0x1d6 // mRSAME
+	SPU_REVERB_L_COMB1   = 0x1d8 // mLCOMB1
+	SPU_REVERB_R_COMB1   = 0x1da // mRCOMB1
+	SPU_REVERB_L_COMB2   = 0x1dc // mLCOMB2
+	SPU_REVERB_R_COMB2   = 0x1de // mRCOMB2
+	SPU_REVERB_L_SAME_D  = 0x1e0 // dLSAME
+	SPU_REVERB_R_SAME_D  = 0x1e2 // dRSAME
+	SPU_REVERB_L_DIFF    = 0x1e4 // mLDIFF
+	SPU_REVERB_R_DIFF    = 0x1e6 // mRDIFF
+	SPU_REVERB_L_COMB3   = 0x1e8 // mLCOMB3
+	SPU_REVERB_R_COMB3   = 0x1ea // mRCOMB3
+	SPU_REVERB_L_COMB4   = 0x1ec // mLCOMB4
+	SPU_REVERB_R_COMB4   = 0x1ee // mRCOMB4
+	SPU_REVERB_L_DIFF_D  = 0x1f0 // dLDIFF
+	SPU_REVERB_R_DIFF_D  = 0x1f2 // dRDIFF
+	SPU_REVERB_L_APF1    = 0x1f4 // mLAPF1
+	SPU_REVERB_R_APF1    = 0x1f6 // mRAPF1
+	SPU_REVERB_L_APF2    = 0x1f8 // mLAPF2
+	SPU_REVERB_R_APF2    = 0x1fa // mRAPF2
+	SPU_REVERB_IN_LEFT   = 0x1fc // vLIN
+	SPU_REVERB_IN_RIGHT  = 0x1fe // vRIN
+)
+
+// SPUCNT bits of the reverb
+const (
+	SPU_CONTROL_CD_REVERB     = 1 << 2 // CD audio is sent to the reverb
+	SPU_CONTROL_REVERB_ENABLE = 1 << 7 // The reverb writes to its work area
+)
+
+// Queues interleaved stereo CD audio `samples` (after the CD volumes) for
+// the capture buffers, then runs the reverb over them and adds its output.
+// The reverb runs at half the sample rate, every output is played twice
+func (spu *SPU) MixCdAudio(samples []int16) {
+	spu.QueueCdCapture(samples)
+	if !spu.Reverb {
+		return
+	}
+
+	for i := 0; i+1 < len(samples); i += 2 {
+		if !spu.ReverbOdd {
+			var left, right int16
+			if spu.Control&SPU_CONTROL_CD_REVERB != 0 {
+				left, right = samples[i], samples[i+1]
+			}
+			spu.ReverbOutLeft, spu.ReverbOutRight = spu.reverbStep(left, right)
+		}
+		spu.ReverbOdd = !spu.ReverbOdd
+
+		samples[i] = clampInt16(int32(samples[i]) + int32(spu.ReverbOutLeft))
+		samples[i+1] = clampInt16(int32(samples[i+1]) + int32(spu.ReverbOutRight))
+	}
+}
+
+// Runs one step of the reverb with the input `inLeft` and `inRight` and
+// returns its output. The work area is only written to if the reverb is
+// enabled in SPUCNT, the output is read from it either way
+func (spu *SPU) reverbStep(inLeft, inRight int16) (int16, int16) {
+	vol := func(reg uint32) int32 {
+		return int32(int16(spu.Regs[reg>>1]))
+	}
+	addr := func(reg uint32) int32 {
+		return int32(spu.Regs[reg>>1]) * 8
+	}
+	load := func(reg uint32, delta int32) int32 {
+		return int32(spu.reverbLoad(addr(reg) + delta))
+	}
+	write := spu.Control&SPU_CONTROL_REVERB_ENABLE != 0
+	store := func(reg uint32, val int32) {
+		if write {
+			spu.reverbStore(addr(reg), clampInt16(val))
+		}
+	}
+
+	lin := mulVolume(int32(inLeft), vol(SPU_REVERB_IN_LEFT))
+	rin := mulVolume(int32(inRight), vol(SPU_REVERB_IN_RIGHT))
+	iir, wall := vol(SPU_REVERB_IIR), vol(SPU_REVERB_WALL)
+
+	// same side reflection
+	lsame := load(SPU_REVERB_L_SAME, -2)
+	rsame := load(SPU_REVERB_R_SAME, -2)
+	store(SPU_REVERB_L_SAME, mulVolume(lin+mulVolume(load(SPU_REVERB_L_SAME_D, 0), wall)-lsame, iir)+lsame)
+	store(SPU_REVERB_R_SAME, mulVolume(rin+mulVolume(load(SPU_REVERB_R_SAME_D, 0), wall)-rsame, iir)+rsame)
+
+	// different side reflection
+	ldiff := load(SPU_REVERB_L_DIFF, -2)
+	rdiff := load(SPU_REVERB_R_DIFF, -2)
+	store(SPU_REVERB_L_DIFF, mulVolume(lin+mulVolume(load(SPU_REVERB_R_DIFF_D, 0), wall)-ldiff, iir)+ldiff)
+	store(SPU_REVERB_R_DIFF, mulVolume(rin+mulVolume(load(SPU_REVERB_L_DIFF_D, 0), wall)-rdiff, iir)+rdiff)
+
+	// early echo
+	lout := mulVolume(vol(SPU_REVERB_COMB1), load(SPU_REVERB_L_COMB1, 0)) +
+		mulVolume(vol(SPU_REVERB_COMB2), load(SPU_REVERB_L_COMB2, 0)) +
+		mulVolume(vol(SPU_REVERB_COMB3), load(SPU_REVERB_L_COMB3, 0)) +
+		mulVolume(vol(SPU_REVERB_COMB4), load(SPU_REVERB_L_COMB4, 0))
+	rout := mulVolume(vol(SPU_REVERB_COMB1), load(SPU_REVERB_R_COMB1, 0)) +
+		mulVolume(vol(SPU_REVERB_COMB2), load(SPU_REVERB_R_COMB2, 0)) +
+		mulVolume(vol(SPU_REVERB_COMB3), load(SPU_REVERB_R_COMB3, 0)) +
+		mulVolume(vol(SPU_REVERB_COMB4), load(SPU_REVERB_R_COMB4, 0))
+
+	// late reverb, two all pass filters
+	allPass := func(out int32, mreg, dreg, vreg uint32) int32 {
+		delayed := load(mreg, -addr(dreg))
+		out = int32(clampInt16(out - mulVolume(vol(vreg), delayed)))
+		store(mreg, out)
+		return mulVolume(out, vol(vreg)) + delayed
+	}
+	lout = allPass(lout, SPU_REVERB_L_APF1, SPU_REVERB_APF1, SPU_REVERB_APF1_VOL)
+	rout = allPass(rout, SPU_REVERB_R_APF1, SPU_REVERB_APF1, SPU_REVERB_APF1_VOL)
+	lout = allPass(lout, SPU_REVERB_L_APF2, SPU_REVERB_APF2, SPU_REVERB_APF2_VOL)
+	rout = allPass(rout, SPU_REVERB_R_APF2, SPU_REVERB_APF2, SPU_REVERB_APF2_VOL)
+
+	// move through the work area
+	base := uint32(spu.Regs[SPU_REVERB_BASE>>1]) * 8
+	spu.ReverbAddr = (spu.ReverbAddr + 2) & (SPU_RAM_SIZE - 2)
+	if spu.ReverbAddr < base {
+		spu.ReverbAddr = base
+	}
+
+	left := mulVolume(int32(clampInt16(lout)), vol(SPU_REVERB_OUT_LEFT))
+	right := mulVolume(int32(clampInt16(rout)), vol(SPU_REVERB_OUT_RIGHT))
+	return clampInt16(left), clampInt16(right)
+}
+
+// Returns the sound RAM address `offset` bytes after the current reverb
+// address. The addresses wrap around in the work area, from mBASE to the
+// end of sound RAM
+func (spu *SPU) reverbAddr(offset int32) uint32 {
+	base := int32(spu.Regs[SPU_REVERB_BASE>>1]) * 8
+	size := SPU_RAM_SIZE - base
+	rel := (int32(spu.ReverbAddr) - base + offset) % size
+	if rel < 0 {
+		rel += size
+	}
+	return uint32(base+rel) &^ 1
+}
+
+func (spu *SPU) reverbLoad(offset int32) int16 {
+	addr := spu.reverbAddr(offset)
+	spu.CheckIrq(addr)
+	return int16(uint16(spu.Ram[addr]) | uint16(spu.Ram[addr+1])<<8)
+}
+
+func (spu *SPU) reverbStore(offset int32, val int16) {
+	addr := spu.reverbAddr(offset)
+	spu.CheckIrq(addr)
+	spu.Ram[addr] = byte(val)
+	spu.Ram[addr+1] = byte(uint16(val) >> 8)
+}
+
+// Multiplies `v` by the signed volume `vol` (0x8000 is 1.0)
+func mulVolume(v, vol int32) int32 {
+	return (v * vol) >> 15
+}
+
+// Clamps `v` to the int16 range
+func clampInt16(v int32) int16 {
+	if v > 0x7fff {
+		return 0x7fff
+	}
+	if v < -0x8000 {
+		return -0x8000
+	}
+	return int16(v)
+}
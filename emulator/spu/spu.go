@@ -0,0 +1,212 @@
+package spu
+
+import (
+	"fmt"
+
+	"github.com/zeozeozeo/gopsx/emulator/bus"
+)
+
+const (
+	SPU_RAM_SIZE    = 512 * 1024 // 512KB of sound RAM
+	SPU_FIFO_SIZE   = 32         // Halfwords in the manual transfer FIFO
+	SPU_VOICE_COUNT = 24         // Amount of voices
+)
+
+// SPU register offsets
+const (
+	SPU_IRQ_ADDR         = 0x1a4 // Sound RAM IRQ address (in 8 byte units)
+	SPU_TRANSFER_ADDR    = 0x1a6 // Sound RAM transfer address (in 8 byte units)
+	SPU_TRANSFER_FIFO    = 0x1a8 // Manual transfer FIFO
+	SPU_CONTROL          = 0x1aa // SPUCNT
+	SPU_TRANSFER_CONTROL = 0x1ac // Sound RAM transfer type, usually 4
+	SPU_STATUS           = 0x1ae // SPUSTAT
+)
+
+// SPUCNT bits
+const (
+	SPU_CONTROL_IRQ_ENABLE = 1 << 6  // IRQ on sound RAM accesses at the IRQ address, cleared to acknowledge
+	SPU_CONTROL_ENABLE     = 1 << 15 // The SPU runs, the capture buffers are written
+)
+
+// Sound RAM transfer mode, bits [5:4] of SPUCNT
+type TransferMode uint16
+
+const (
+	SPU_TRANSFER_STOP         TransferMode = iota // No transfer
+	SPU_TRANSFER_MANUAL_WRITE TransferMode = iota // The FIFO is written to sound RAM
+	SPU_TRANSFER_DMA_WRITE    TransferMode = iota // DMA from RAM to sound RAM
+	SPU_TRANSFER_DMA_READ     TransferMode = iota // DMA from sound RAM to RAM
+)
+
+// 512KB of sound RAM, a named type so savestates can copy it in one go
+type SoundRam [SPU_RAM_SIZE]byte
+
+// Sound Processing Unit. Only the sound RAM, the transfers, the IRQ, the
+// capture buffers and the reverb of the CD audio are emulated for now, the
+// other registers read back what was written
+type SPU struct {
+	Ram            SoundRam
+	Regs           [0x140]uint16 // Register values
+	Control        uint16        // SPUCNT
+	TransferAddr   uint32        // Current sound RAM transfer address in bytes
+	Fifo           []uint16      // Manual transfer FIFO
+	ReverbAddr     uint32        // Current reverb address in the work area, in bytes
+	ReverbOdd      bool          // The reverb runs every other sample, see MixCdAudio
+	ReverbOutLeft  int16         // Last reverb output
+	ReverbOutRight int16
+	Cycles         uint64  // CPU cycles since the last sample
+	CaptureIndex   uint32  // Next halfword written to the capture buffers
+	CdCapture      []int16 // CD audio waiting to be written to the capture buffers
+	IrqFlag        bool    // The IRQ address was accessed, SPUSTAT bit 6
+	IrqPending     bool    // IrqFlag was set but the interrupt wasn't raised yet
+	Reverb         bool    // Host setting, the reverb is skipped to save time if false
+}
+
+// Gob encodes byte arrays one element at a time, the sound RAM is saved as
+// a byte slice instead
+func (ram *SoundRam) GobEncode() ([]byte, error) {
+	return ram[:], nil
+}
+
+func (ram *SoundRam) GobDecode(data []byte) error {
+	if len(data) != len(ram) {
+		return fmt.Errorf("spu: %d bytes of sound RAM", len(data))
+	}
+	copy(ram[:], data)
+	return nil
+}
+
+// Returns a new SPU with cleared sound RAM
+func New() *SPU {
+	return &SPU{Reverb: true}
+}
+
+// Returns the current transfer mode
+func (spu *SPU) TransferMode() TransferMode {
+	return TransferMode((spu.Control >> 4) & 3)
+}
+
+// Returns the value of the SPUSTAT register. Transfers finish right away,
+// so the busy flag is never set
+func (spu *SPU) Status() uint16 {
+	status := spu.Control & 0x3f
+	if spu.IrqFlag {
+		status |= 1 << 6
+	}
+	// the second half of the capture buffers is being written
+	if spu.CaptureIndex >= SPU_CAPTURE_SAMPLES/2 {
+		status |= 1 << 11
+	}
+
+	// DMA request flags
+	switch spu.TransferMode() {
+	case SPU_TRANSFER_DMA_WRITE:
+		status |= 1<<7 | 1<<8
+	case SPU_TRANSFER_DMA_READ:
+		status |= 1<<7 | 1<<9
+	}
+	return status
+}
+
+// Loads a register at `offset`. The SPU bus is 16 bits wide, word loads
+// read two registers
+func (spu *SPU) Load(offset uint32, size bus.AccessSize, th *bus.TimeHandler, irqState *bus.IrqState) uint32 {
+	spu.Sync(th, irqState)
+
+	if size == bus.ACCESS_WORD {
+		return uint32(spu.Load16(offset)) | uint32(spu.Load16(offset+2))<<16
+	}
+	return uint32(spu.Load16(offset &^ 1))
+}
+
+// Stores `val` into the register at `offset`. Word stores write two
+// registers
+func (spu *SPU) Store(offset uint32, size bus.AccessSize, val uint32, th *bus.TimeHandler, irqState *bus.IrqState) {
+	spu.Sync(th, irqState)
+
+	if size == bus.ACCESS_WORD {
+		spu.Store16(offset, uint16(val))
+		spu.Store16(offset+2, uint16(val>>16))
+	} else {
+		spu.Store16(offset&^1, uint16(val))
+	}
+
+	// a manual transfer can hit the IRQ address, and the IRQ or the
+	// capture could have been turned on
+	spu.MaybeRaiseIrq(irqState)
+	spu.PredictNextSync(th)
+}
+
+// Loads the 16 bit register at `offset`
+func (spu *SPU) Load16(offset uint32) uint16 {
+	switch offset {
+	case SPU_CONTROL:
+		return spu.Control
+	case SPU_STATUS:
+		return spu.Status()
+	}
+	return spu.Regs[offset>>1]
+}
+
+// Stores `val` into the 16 bit register at `offset`
+func (spu *SPU) Store16(offset uint32, val uint16) {
+	spu.Regs[offset>>1] = val
+
+	switch offset {
+	case SPU_TRANSFER_ADDR:
+		spu.TransferAddr = uint32(val) * 8
+	case SPU_REVERB_BASE:
+		spu.ReverbAddr = uint32(val) * 8
+	case SPU_TRANSFER_FIFO:
+		if len(spu.Fifo) < SPU_FIFO_SIZE {
+			spu.Fifo = append(spu.Fifo, val)
+		}
+	case SPU_CONTROL:
+		spu.Control = val
+		if val&SPU_CONTROL_IRQ_ENABLE == 0 {
+			// acknowledge the IRQ
+			spu.IrqFlag = false
+			spu.IrqPending = false
+		}
+		if spu.TransferMode() == SPU_TRANSFER_MANUAL_WRITE {
+			spu.FlushFifo()
+		}
+	}
+}
+
+// Writes the manual transfer FIFO to sound RAM
+func (spu *SPU) FlushFifo() {
+	for _, val := range spu.Fifo {
+		spu.WriteRam(val)
+	}
+	spu.Fifo = spu.Fifo[:0]
+}
+
+// Writes a halfword at the transfer address and increments it
+func (spu *SPU) WriteRam(val uint16) {
+	spu.CheckIrq(spu.TransferAddr)
+	spu.Ram[spu.TransferAddr] = byte(val)
+	spu.Ram[spu.TransferAddr+1] = byte(val >> 8)
+	spu.TransferAddr = (spu.TransferAddr + 2) & (SPU_RAM_SIZE - 1)
+}
+
+// Reads the halfword at the transfer address and increments it
+func (spu *SPU) ReadRam() uint16 {
+	spu.CheckIrq(spu.TransferAddr)
+	val := uint16(spu.Ram[spu.TransferAddr]) | uint16(spu.Ram[spu.TransferAddr+1])<<8
+	spu.TransferAddr = (spu.TransferAddr + 2) & (SPU_RAM_SIZE - 1)
+	return val
+}
+
+// Writes a word received from the DMA into sound RAM
+func (spu *SPU) DmaWrite(word uint32) {
+	spu.WriteRam(uint16(word))
+	spu.WriteRam(uint16(word >> 16))
+}
+
+// Returns the next word of sound RAM for the DMA
+func (spu *SPU) DmaRead() uint32 {
+	lo := spu.ReadRam()
+	hi := spu.ReadRam()
+	return uint32(lo) | uint32(hi)<<16
+}
@@ -0,0 +1,64 @@
+package spu
+
+import "testing"
+
+// Reverb registers of the Room preset of the libspu, from dAPF1 to vRIN
+var spuReverbRoom = [32]uint16{
+	0x007d, 0x005b, 0x6d80, 0x54b8, 0xbed0, 0x0000, 0x0000, 0xba80,
+	0x5800, 0x5300, 0x04d6, 0x0333, 0x03f0, 0x0227, 0x0374, 0x01ef,
+	0x0334, 0x01b5, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000,
+	0x0000, 0x0000, 0x01b4, 0x0136, 0x00b8, 0x005c, 0x8000, 0x8000,
+}
+
+// Returns the output of the reverb for an impulse of CD audio followed by
+// `frames` frames of silence
+func runSpuReverb(spu *SPU, frames int) []int16 {
+	samples := make([]int16, frames*2)
+	samples[0], samples[1] = 0x4000, 0x4000
+	spu.MixCdAudio(samples)
+	return samples
+}
+
+func TestSpuReverb(t *testing.T) {
+	spu := New()
+	for i, val := range spuReverbRoom {
+		spu.Store16(SPU_REVERB_APF1+uint32(i)*2, val)
+	}
+	spu.Store16(SPU_REVERB_BASE, (SPU_RAM_SIZE-0x26c0)/8)
+	spu.Store16(SPU_REVERB_OUT_LEFT, 0x4000)
+	spu.Store16(SPU_REVERB_OUT_RIGHT, 0x4000)
+	spu.Store16(SPU_CONTROL, 0x8000|SPU_CONTROL_REVERB_ENABLE|SPU_CONTROL_CD_REVERB)
+
+	// the impulse echoes after it's gone
+	echo := 0
+	for _, sample := range runSpuReverb(spu, 4410)[2:] {
+		if sample != 0 {
+			echo++
+		}
+	}
+	if echo < 1000 {
+		t.Errorf("expected an echo, got %d non-zero samples", echo)
+	}
+	for addr := 0; addr < SPU_RAM_SIZE-0x26c0; addr++ {
+		if spu.Ram[addr] != 0 {
+			t.Fatalf("the reverb wrote outside of its work area at 0x%x", addr)
+		}
+	}
+
+	// the work area isn't written to without the enable bit, and nothing
+	// happens at all with the reverb turned off on the host
+	spu.Ram = SoundRam{}
+	spu.Store16(SPU_CONTROL, 0x8000|SPU_CONTROL_CD_REVERB)
+	for _, sample := range runSpuReverb(spu, 4410)[2:] {
+		if sample != 0 {
+			t.Fatalf("expected silence without the reverb enable bit, got %d", sample)
+		}
+	}
+	spu.Store16(SPU_CONTROL, 0x8000|SPU_CONTROL_REVERB_ENABLE|SPU_CONTROL_CD_REVERB)
+	spu.Reverb = false
+	for _, sample := range runSpuReverb(spu, 4410)[2:] {
+		if sample != 0 {
+			t.Fatalf("expected silence with the reverb off, got %d", sample)
+		}
+	}
+}
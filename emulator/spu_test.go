@@ -0,0 +1,105 @@
+package emulator
+
+import (
+	"testing"
+
+	"github.com/zeozeozeo/gopsx/emulator/spu"
+)
+
+func TestSpuTransfers(t *testing.T) {
+	inter := newBenchInterconnect()
+	th := NewTimeHandler()
+
+	// manual write of 2 halfwords at 0x1000
+	inter.Store16(0x1f801da6, 0x1000/8, th)
+	inter.Store16(0x1f801da8, 0x1234, th)
+	inter.Store16(0x1f801da8, 0x5678, th)
+	inter.Store16(0x1f801daa, 0x0010, th)
+	if got := inter.Spu.Ram[0x1000]; got != 0x34 {
+		t.Fatalf("manual write: expected 0x34, got 0x%x", got)
+	}
+
+	// DMA read of the same word into RAM
+	inter.Store16(0x1f801daa, 0x0030, th)
+	inter.Store16(0x1f801da6, 0x1000/8, th)
+	inter.Store32(0x1f8010f0, 0x00080000, th) // enable the SPU channel
+	inter.Store32(0x1f8010c0, 0x2000, th)
+	inter.Store32(0x1f8010c4, 0x00010001, th)
+	inter.Store32(0x1f8010c8, 0x01000200, th) // request sync, to RAM
+
+	if got := inter.Ram.Load32(0x2000); got != 0x56781234 {
+		t.Errorf("DMA read: expected 0x56781234, got 0x%x", got)
+	}
+}
+
+// A manual transfer through the IRQ address raises the SPU interrupt once,
+// until it's acknowledged in SPUCNT
+func TestSpuTransferIrq(t *testing.T) {
+	inter := newBenchInterconnect()
+	th := NewTimeHandler()
+
+	inter.Store16(0x1f801da4, 0x2000/8, th)
+	inter.Store16(0x1f801daa, spu.SPU_CONTROL_IRQ_ENABLE, th)
+	inter.Store16(0x1f801da6, 0x1ff8/8, th)
+	for i := 0; i < 8; i++ {
+		inter.Store16(0x1f801da8, 0, th)
+	}
+	inter.Store16(0x1f801daa, spu.SPU_CONTROL_IRQ_ENABLE|0x0010, th)
+	if !inter.IrqState.Latched(INTERRUPT_SPU) || inter.Load16(0x1f801dae, th)&(1<<6) == 0 {
+		t.Fatal("expected an SPU interrupt")
+	}
+	if count := inter.IrqState.Counts[INTERRUPT_SPU]; count != 1 {
+		t.Errorf("expected one SPU interrupt, got %d", count)
+	}
+
+	inter.Store16(0x1f801daa, 0, th)
+	if inter.Load16(0x1f801dae, th)&(1<<6) != 0 {
+		t.Errorf("expected the IRQ flag to be acknowledged")
+	}
+}
+
+// The CD audio is written to the capture buffers one sample at a time and
+// triggers the IRQ when it reaches the IRQ address
+func TestSpuCaptureIrq(t *testing.T) {
+	inter := newBenchInterconnect()
+	th := NewTimeHandler()
+	sound := inter.Spu
+
+	samples := make([]int16, spu.SPU_CAPTURE_SAMPLES*2)
+	for i := range samples {
+		samples[i] = int16(i/2 + 1)
+	}
+	sound.QueueCdCapture(samples)
+
+	// the IRQ address is in the second half of the right CD buffer
+	inter.Store16(0x1f801da4, (spu.SPU_CAPTURE_CD_RIGHT+0x200)/8, th)
+	inter.Store16(0x1f801daa, spu.SPU_CONTROL_ENABLE|spu.SPU_CONTROL_IRQ_ENABLE, th)
+	if status := inter.Load16(0x1f801dae, th); status&(1<<11) != 0 {
+		t.Errorf("expected the first half to be written, got SPUSTAT 0x%04x", status)
+	}
+
+	for !inter.IrqState.Latched(INTERRUPT_SPU) {
+		if th.Cycles > spu.SPU_CAPTURE_SAMPLES*spu.SPU_SAMPLE_CYCLES {
+			t.Fatal("no SPU interrupt")
+		}
+		th.Tick(1)
+		if th.ShouldSync() {
+			inter.Sync(th)
+			th.UpdatePendingSync()
+		}
+	}
+
+	// the interrupt is raised on time, right after the 0x101st sample
+	if expected := uint64(0x101 * spu.SPU_SAMPLE_CYCLES); th.Cycles != expected {
+		t.Errorf("expected the interrupt at %d cycles, got %d", expected, th.Cycles)
+	}
+	if status := inter.Load16(0x1f801dae, th); status&(1<<11) == 0 {
+		t.Errorf("expected the second half to be written, got SPUSTAT 0x%04x", status)
+	}
+	for i := uint32(0); i <= 0x100; i++ {
+		left := int16(uint16(sound.Ram[spu.SPU_CAPTURE_CD_LEFT+i*2]) | uint16(sound.Ram[spu.SPU_CAPTURE_CD_LEFT+i*2+1])<<8)
+		if left != int16(i+1) {
+			t.Fatalf("expected capture sample %d to be %d, got %d", i, i+1, left)
+		}
+	}
+}
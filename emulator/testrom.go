@@ -0,0 +1,123 @@
+package emulator
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Emulated time a test ROM can run for by default, 60 seconds
+const TESTROM_DEFAULT_CYCLES = 60 * uint64(CPU_FREQ_HZ)
+
+// Exception handler of the test ROMs, since there's no BIOS to install one.
+// It returns from the exception, after the instruction for system calls, so
+// interrupts must stay disabled unless the ROM installs its own handler
+const TESTROM_EXCEPTION_HANDLER uint32 = 0x80001000
+
+// Jumps from the exception vector to the handler, the code can't go past
+// 0x800000a0 where the function tables start
+var testRomExceptionVector = []uint32{
+	0x3c1a8000, // lui k0, 0x8000
+	0x375a1000, // ori k0, k0, 0x1000
+	0x03400008, // jr k0
+	0x00000000, // nop
+}
+
+var testRomExceptionHandler = []uint32{
+	0x401a7000, // mfc0 k0, epc
+	0x401b6800, // mfc0 k1, cause
+	0x00000000, // nop (load delay)
+	0x337b007c, // andi k1, k1, 0x7c
+	0x3b7b0020, // xori k1, k1, 0x20 (syscall)
+	0x17600002, // bnez k1, +2
+	0x00000000, // nop
+	0x275a0004, // addiu k0, k0, 4
+	0x03400008, // jr k0
+	0x42000010, // rfe
+}
+
+// A line of test output reports a failure if it has one of these words,
+// or a passed test if it has one of the others
+var (
+	testRomFailLine = regexp.MustCompile(`(?i)\b(fail|failed|failure|error|errors)\b`)
+	testRomPassLine = regexp.MustCompile(`(?i)\b(pass|passed|ok)\b`)
+)
+
+// Result of a test ROM, see RunTestRom
+type TestRomResult struct {
+	Output   string // Everything the ROM printed
+	Passed   int    // Lines of the output that report a passed test
+	Failures []string
+	Exited   bool   // True if the ROM called exit before the time limit
+	ExitCode uint32 // Argument of exit
+	Cycles   uint64 // CPU cycles the ROM ran for
+}
+
+// Returns true if the ROM didn't report a failure and either reported a
+// passed test or exited with code 0
+func (result *TestRomResult) Ok() bool {
+	if len(result.Failures) > 0 || (result.Exited && result.ExitCode != 0) {
+		return false
+	}
+	return result.Passed > 0 || result.Exited
+}
+
+// Counts the passed and failed tests in the output
+func (result *TestRomResult) parseOutput() {
+	for _, line := range strings.Split(result.Output, "\n") {
+		switch {
+		case testRomFailLine.MatchString(line):
+			result.Failures = append(result.Failures, strings.TrimSpace(line))
+		case testRomPassLine.MatchString(line):
+			result.Passed++
+		}
+	}
+}
+
+// Runs a test ROM (a PS-X EXE like the CPU, GTE and timer tests) without a
+// BIOS or a disc and collects what it prints to the TTY: with the BIOS
+// functions (see BiosHle.Standalone) or the expansion port DUART. The ROM
+// runs until it calls exit or for `maxCycles` CPU cycles, 0 for
+// TESTROM_DEFAULT_CYCLES
+func RunTestRom(data []byte, maxCycles uint64) (*TestRomResult, error) {
+	exe, err := ParseExe(data)
+	if err != nil {
+		return nil, err
+	}
+	if maxCycles == 0 {
+		maxCycles = TESTROM_DEFAULT_CYCLES
+	}
+
+	bios, _ := LoadBIOSFromData(make([]byte, BIOS_SIZE))
+	inter := NewInterconnect(bios, NewRAM(), NewGPU(HARDWARE_NTSC), nil)
+	cpu := NewCPU(inter)
+	hle := NewBiosHle()
+	hle.Standalone = true
+	cpu.Hle = hle
+
+	var output strings.Builder
+	cpu.Tty = func(c byte) {
+		output.WriteByte(c)
+	}
+	inter.Expansion.Tty = cpu.Tty
+
+	for i, word := range testRomExceptionVector {
+		inter.Ram.Store32(0x80+uint32(i)*4, word)
+	}
+	for i, word := range testRomExceptionHandler {
+		inter.Ram.Store32(TESTROM_EXCEPTION_HANDLER+uint32(i)*4, word)
+	}
+	cpu.LoadExe(exe)
+
+	for !hle.Exited && cpu.Th.Cycles < maxCycles {
+		cpu.Step()
+	}
+
+	result := &TestRomResult{
+		Output:   output.String(),
+		Exited:   hle.Exited,
+		ExitCode: hle.ExitCode,
+		Cycles:   cpu.Th.Cycles,
+	}
+	result.parseOutput()
+	return result, nil
+}
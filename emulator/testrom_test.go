@@ -0,0 +1,174 @@
+package emulator
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Address of the text of the test executables, the strings are at 0x100
+const TESTROM_TEXT_ADDR = 0x80010000
+
+// Returns a PS-X EXE that runs `program` with `strings` after it, at
+// TESTROM_TEXT_ADDR+0x100
+func newTestExe(program []uint32, strings string) []byte {
+	text := make([]byte, 0x100+len(strings)+1)
+	for i, word := range program {
+		binary.LittleEndian.PutUint32(text[i*4:], word)
+	}
+	copy(text[0x100:], strings)
+
+	data := make([]byte, EXE_HEADER_SIZE, EXE_HEADER_SIZE+len(text))
+	copy(data, "PS-X EXE")
+	binary.LittleEndian.PutUint32(data[0x10:], TESTROM_TEXT_ADDR)
+	binary.LittleEndian.PutUint32(data[0x18:], TESTROM_TEXT_ADDR)
+	binary.LittleEndian.PutUint32(data[0x1c:], uint32(len(text)))
+	return append(data, text...)
+}
+
+// Returns the instructions that call the BIOS function `table`(`function`)
+func asmBiosCall(table, function uint32) []uint32 {
+	return []uint32{
+		asmI(0x09, 10, 0, uint16(table)),   // addiu t2, zero, table
+		asmR(0x09, 31, 10, 0),              // jalr t2
+		asmI(0x09, 9, 0, uint16(function)), // addiu t1, zero, function
+	}
+}
+
+// Returns the instructions that load the address of the string at `offset`
+// in the strings of newTestExe to `reg`
+func asmString(reg uint32, offset uint16) []uint32 {
+	return []uint32{
+		asmI(0x0f, reg, 0, TESTROM_TEXT_ADDR>>16), // lui reg, 0x8001
+		asmI(0x0d, reg, reg, 0x100+offset),        // ori reg, reg, offset
+	}
+}
+
+func concatPrograms(parts ...[]uint32) []uint32 {
+	var program []uint32
+	for _, part := range parts {
+		program = append(program, part...)
+	}
+	// loop forever if exit returns
+	return append(program, asmJ(0x02, TESTROM_TEXT_ADDR+uint32(len(program))*4), 0)
+}
+
+func TestRunTestRom(t *testing.T) {
+	const strs = "%s %d %05x %d%%\n\x00pass\x00all tests ok\n"
+	program := concatPrograms(
+		[]uint32{0x0000000c}, // syscall, the default handler returns
+		asmString(4, 0),
+		asmString(5, 17),
+		[]uint32{
+			asmI(0x09, 6, 0, 0xfffd),   // addiu a2, zero, -3
+			asmI(0x09, 7, 0, 0xab),     // addiu a3, zero, 0xab
+			asmI(0x09, 29, 29, 0xffe8), // addiu sp, sp, -24
+			asmI(0x09, 8, 0, 7),        // addiu t0, zero, 7
+			asmI(0x2b, 8, 29, 16),      // sw t0, 16(sp)
+		},
+		asmBiosCall(BIOS_TABLE_A, 0x3f), // printf
+		asmString(4, 22),
+		asmBiosCall(BIOS_TABLE_B, 0x3f), // puts
+		[]uint32{asmI(0x09, 4, 0, 0)},   // addiu a0, zero, 0
+		asmBiosCall(BIOS_TABLE_A, 0x06), // exit
+	)
+
+	result, err := RunTestRom(newTestExe(program, strs), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Output != "pass -3 000ab 7%\nall tests ok\n" {
+		t.Errorf("unexpected output %q", result.Output)
+	}
+	if !result.Exited || result.ExitCode != 0 || result.Passed != 2 || !result.Ok() {
+		t.Errorf("expected a passed ROM, got %+v", result)
+	}
+	if result.Cycles >= TESTROM_DEFAULT_CYCLES/1000 {
+		t.Errorf("expected the ROM to stop at exit, ran for %d cycles", result.Cycles)
+	}
+}
+
+func TestRunTestRomFailure(t *testing.T) {
+	program := concatPrograms(
+		asmString(4, 0),
+		asmBiosCall(BIOS_TABLE_A, 0x3e), // puts
+		asmBiosCall(BIOS_TABLE_C, 0x12), // not emulated, returns 0
+		[]uint32{asmI(0x09, 4, 2, 1)},   // addiu a0, v0, 1
+		asmBiosCall(BIOS_TABLE_B, 0x38), // exit
+	)
+	result, err := RunTestRom(newTestExe(program, "add: ok\nsub: FAILED (got 3)\n"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Ok() || result.ExitCode != 1 || result.Passed != 1 {
+		t.Errorf("expected a failed ROM, got %+v", result)
+	}
+	if len(result.Failures) != 1 || result.Failures[0] != "sub: FAILED (got 3)" {
+		t.Errorf("unexpected failures %q", result.Failures)
+	}
+
+	// a ROM that never prints anything times out
+	result, err = RunTestRom(newTestExe(concatPrograms(), ""), 100_000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Ok() || result.Exited || result.Cycles < 100_000 {
+		t.Errorf("expected the ROM to time out, got %+v", result)
+	}
+}
+
+func TestParseExe(t *testing.T) {
+	data := newTestExe([]uint32{0x0000000c}, "")
+	exe, err := ParseExe(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exe.PC != TESTROM_TEXT_ADDR || exe.TextAddr != TESTROM_TEXT_ADDR || len(exe.Text) != 0x101 {
+		t.Errorf("unexpected executable %+v", exe)
+	}
+
+	if _, err := ParseExe(data[:0x100]); !errors.Is(err, ErrInvalidExe) {
+		t.Errorf("expected ErrInvalidExe for a short file, got %v", err)
+	}
+	binary.LittleEndian.PutUint32(data[0x1c:], RAM_ALLOC_SIZE)
+	if _, err := ParseExe(data); !errors.Is(err, ErrInvalidExe) {
+		t.Errorf("expected ErrInvalidExe for text past the end of RAM, got %v", err)
+	}
+}
+
+// Runs the test ROMs (*.exe) in the directory set in GOPSX_TEST_ROMS, like
+// psxtest_cpu.exe or the GTE and timer tests
+func TestTestRoms(t *testing.T) {
+	dir := os.Getenv("GOPSX_TEST_ROMS")
+	if dir == "" {
+		t.Skip("GOPSX_TEST_ROMS is not set")
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.exe"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatalf("no test ROMs in %s", dir)
+	}
+
+	for _, path := range paths {
+		t.Run(strings.TrimSuffix(filepath.Base(path), ".exe"), func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := RunTestRom(data, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Logf("%d passed, %d failed:\n%s", result.Passed, len(result.Failures), result.Output)
+			if !result.Ok() {
+				t.Errorf("exited: %v (code %d), failures:\n%s",
+					result.Exited, result.ExitCode, strings.Join(result.Failures, "\n"))
+			}
+		})
+	}
+}
@@ -1,5 +1,7 @@
 package emulator
 
+import "math"
+
 // Represents a timer clock source
 type Clock uint8
 
@@ -55,23 +57,28 @@ func (cs ClockSource) Clock(instance Peripheral) Clock {
 	panic("timer: invalid peripheral for Clock()")
 }
 
-// Represents timer synchronization modes when `FreeRun` is false
+// Represents timer synchronization modes when `FreeRun` is false. Timer 0
+// synchronizes with the HBlank, timer 1 with the VBlank
 type TSync uint16
 
 const (
-	// Timer 1, timer 2: pause during HBlank/VBlank.
-	// Timer 3: stop counter.
+	// Timer 0, timer 1: pause during HBlank/VBlank.
+	// Timer 2: stop counter.
 	TSYNC_PAUSE TSync = 0
-	// Timer 1, timer 2: reset counter at HBlank/VBlank.
-	// Timer 3: free run.
+	// Timer 0, timer 1: reset counter at HBlank/VBlank.
+	// Timer 2: free run.
 	TSYNC_RESET TSync = 1
-	// Timer 1, timer 2: wait for HBlank/VBlank and then free run.
-	// Timer 3: stop counter.
+	// Timer 0, timer 1: reset counter at HBlank/VBlank and pause outside
+	// of it.
+	// Timer 2: free run.
 	TSYNC_RESET_AND_PAUSE TSync = 2
+	// Timer 0, timer 1: wait for HBlank/VBlank and then free run.
+	// Timer 2: stop counter.
+	TSYNC_WAIT TSync = 3
 )
 
 func TSyncFromField(field uint16) TSync {
-	if field > uint16(TSYNC_RESET_AND_PAUSE) {
+	if field > uint16(TSYNC_WAIT) {
 		panic("timer: invalid field value for TSyncFromField")
 	}
 	return TSync(field)
@@ -95,6 +102,9 @@ type Timer struct {
 	Period          FracCycles  // Period of a counter tick, the GPU can be used as a source
 	Phase           FracCycles  // Current position in the counter tick
 	Interrupt       bool        // True if an interrupt is active
+	IrqFired        bool        // True if an interrupt was raised since the mode was set
+	Blank           bool        // True if the signal the timer synchronizes with is blanking
+	Waiting         bool        // True while waiting for the first blank in `TSYNC_WAIT` mode
 }
 
 // Returns a new Timer instance
@@ -127,16 +137,88 @@ func (timer *Timer) Reset(gpu *GPU, th *TimeHandler) {
 		timer.Phase = gpu.HSyncPhase()
 	}
 
-	timer.PredictNextSync(th)
+	if timer.Gated() {
+		timer.Blank = timer.blankSignal(gpu)
+	}
+	timer.PredictNextSync(th, gpu)
+}
+
+// Returns true if the timer is synchronized with the HBlank or the VBlank
+// and has to watch its start and end
+func (timer *Timer) Gated() bool {
+	if timer.FreeRun || timer.Instance == PERIPHERAL_TIMER2 {
+		return false
+	}
+	return timer.TSync != TSYNC_WAIT || timer.Waiting
+}
+
+// Returns true if the counter is running
+func (timer *Timer) Counting() bool {
+	if timer.FreeRun {
+		return true
+	}
+
+	if timer.Instance == PERIPHERAL_TIMER2 {
+		return timer.TSync == TSYNC_RESET || timer.TSync == TSYNC_RESET_AND_PAUSE
+	}
+
+	switch timer.TSync {
+	case TSYNC_PAUSE:
+		return !timer.Blank
+	case TSYNC_RESET:
+		return true
+	case TSYNC_RESET_AND_PAUSE:
+		return timer.Blank
+	default:
+		return !timer.Waiting
+	}
 }
 
-// Synchronizes this timer
-func (timer *Timer) Sync(th *TimeHandler, irqState *IrqState) {
+// Returns the blanking state of the signal the timer synchronizes with. The
+// GPU must be synchronized
+func (timer *Timer) blankSignal(gpu *GPU) bool {
+	if timer.Instance == PERIPHERAL_TIMER0 {
+		return gpu.InHBlank()
+	}
+	return gpu.InVBlank()
+}
+
+// Updates the blanking state, the counter is reset or released when the
+// blanking starts
+func (timer *Timer) setBlank(blank bool) {
+	if blank && !timer.Blank {
+		switch timer.TSync {
+		case TSYNC_RESET, TSYNC_RESET_AND_PAUSE:
+			timer.Counter = 0
+		case TSYNC_WAIT:
+			timer.Waiting = false
+		}
+	}
+	timer.Blank = blank
+}
+
+// Synchronizes this timer. Timers in a synchronization mode are
+// synchronized at every start and end of the blanking
+func (timer *Timer) Sync(th *TimeHandler, irqState *IrqState, gpu *GPU) {
 	delta := th.Sync(timer.Instance)
 	if delta == 0 {
 		return
 	}
 
+	if timer.Counting() {
+		timer.count(delta, irqState)
+	}
+
+	if timer.Gated() {
+		gpu.Sync(th, irqState)
+		timer.setBlank(timer.blankSignal(gpu))
+	}
+
+	timer.PredictNextSync(th, gpu)
+}
+
+// Advances the counter by `delta` CPU cycles and raises the interrupts
+func (timer *Timer) count(delta uint64, irqState *IrqState) {
 	deltaFrac := FracCyclesFromCycles(delta)
 	ticks := deltaFrac.Add(timer.Phase)
 
@@ -172,7 +254,12 @@ func (timer *Timer) Sync(th *TimeHandler, irqState *IrqState) {
 
 	timer.Counter = uint16(count)
 
-	if (timer.WrapIrq && overflow) || (timer.TargetIrq && targetPassed) {
+	// in one-shot mode only the first interrupt is raised
+	canIrq := timer.RepeatIrq || !timer.IrqFired
+
+	if canIrq && ((timer.WrapIrq && overflow) || (timer.TargetIrq && targetPassed)) {
+		timer.IrqFired = true
+
 		var interrupt Interrupt
 		switch timer.Instance {
 		case PERIPHERAL_TIMER0:
@@ -186,8 +273,12 @@ func (timer *Timer) Sync(th *TimeHandler, irqState *IrqState) {
 		}
 
 		if timer.NegateIrq {
-			// TODO
-			panic("timer: negate IRQ is not implemented")
+			// toggle mode: the IRQ signal is inverted and an interrupt is
+			// only raised when it goes active
+			timer.Interrupt = !timer.Interrupt
+			if timer.Interrupt {
+				irqState.SetHigh(interrupt)
+			}
 		} else {
 			// start pulse
 			irqState.SetHigh(interrupt)
@@ -197,15 +288,13 @@ func (timer *Timer) Sync(th *TimeHandler, irqState *IrqState) {
 		// pulse is over
 		timer.Interrupt = false
 	}
-
-	timer.PredictNextSync(th)
 }
 
 // Returns the value of the mode register
 func (timer *Timer) Mode() uint16 {
 	var r uint16
 
-	r |= uint16(oneIfTrue(timer.FreeRun))
+	r |= uint16(oneIfTrue(!timer.FreeRun))
 	r |= uint16(timer.TSync) << 1
 	r |= uint16(oneIfTrue(timer.TargetWrap)) << 3
 	r |= uint16(oneIfTrue(timer.TargetIrq)) << 4
@@ -238,48 +327,59 @@ func (timer *Timer) SetMode(val uint16) {
 	// writing resets the counter and the interrupt flag
 	timer.Counter = 0
 	timer.Interrupt = false
-
-	if timer.WrapIrq {
-		panicFmt("timer (%d): WrapIrq is not implemented", timer.Instance)
-	}
-	if (timer.WrapIrq || timer.TargetIrq) && !timer.RepeatIrq {
-		panicFmt("timer (%d): unsupported pulse timer interrupt", timer.Instance)
-	}
-	if !timer.FreeRun {
-		panicFmt("timer (%d): sync mode is not supported", timer.Instance)
-	}
+	timer.IrqFired = false
+	timer.Waiting = !timer.FreeRun && timer.TSync == TSYNC_WAIT
 }
 
+// Returns true if the timer depends on the GPU timings
 func (timer *Timer) NeedsGPU() bool {
-	if !timer.FreeRun {
-		panic("timer: sync mode not supported")
-	}
-	return timer.ClockSource.Clock(timer.Instance).NeedsGPU()
+	return timer.Gated() || timer.ClockSource.Clock(timer.Instance).NeedsGPU()
 }
 
-func (timer *Timer) PredictNextSync(th *TimeHandler) {
-	// TODO: add support for WrapIrq
-	if !timer.TargetIrq {
-		// we don't have an IRQ
-		th.RemoveNextSync(timer.Instance)
-		return
+// Schedules the next synchronization at the next interrupt or, for timers in
+// a synchronization mode, at the next start or end of the blanking
+func (timer *Timer) PredictNextSync(th *TimeHandler, gpu *GPU) {
+	var delta uint64 = math.MaxUint64
+	canIrq := timer.RepeatIrq || !timer.IrqFired
+
+	if timer.Counting() && canIrq {
+		if timer.TargetIrq {
+			var countdown uint16
+			if timer.Counter <= timer.Target {
+				countdown = timer.Target - timer.Counter
+			} else {
+				countdown = 0xffff - timer.Counter + timer.Target
+			}
+			delta = timer.countdownCycles(countdown)
+		}
+		if timer.WrapIrq {
+			delta = minU64(delta, timer.countdownCycles(0xffff-timer.Counter))
+		}
 	}
 
-	var countdown uint16
-	if timer.Counter <= timer.Target {
-		countdown = timer.Target - timer.Counter
-	} else {
-		countdown = 0xffff - timer.Counter + timer.Target
+	if timer.Gated() {
+		if timer.Instance == PERIPHERAL_TIMER0 {
+			delta = minU64(delta, gpu.CyclesToHBlankEdge())
+		} else {
+			delta = minU64(delta, gpu.CyclesToVBlankEdge())
+		}
+	}
+
+	if delta == math.MaxUint64 {
+		// nothing to wait for
+		th.RemoveNextSync(timer.Instance)
+		return
 	}
+	th.SetNextSyncDelta(timer.Instance, delta)
+}
 
-	// convert timer counter to CPU cycles. the interrupt is generated
-	// on the next cycle, so we add 1 to it
+// Converts `countdown` counter ticks to CPU cycles
+func (timer *Timer) countdownCycles(countdown uint16) uint64 {
+	// the interrupt is generated on the next cycle, so we add 1 to it
 	delta := timer.Period.GetFixed() * (uint64(countdown) + 1)
 	delta -= timer.Phase.GetFixed()
 	// round to the next CPU cycle
-	delta = FracCyclesFromFixed(delta).Ceil()
-
-	th.SetNextSyncDelta(timer.Instance, delta)
+	return FracCyclesFromFixed(delta).Ceil()
 }
 
 type Timers struct {
@@ -300,14 +400,14 @@ func NewTimers() *Timers {
 	return timers
 }
 
-func (timers *Timers) Load(size AccessSize, th *TimeHandler, offset uint32, irqState *IrqState) interface{} {
+func (timers *Timers) Load(size AccessSize, th *TimeHandler, offset uint32, irqState *IrqState, gpu *GPU) uint32 {
 	if size != ACCESS_WORD && size != ACCESS_HALFWORD {
 		panicFmt("timer: unsupported load size %d", size)
 	}
 
 	instance := offset >> 4
 	timer := timers.Timers[instance]
-	timer.Sync(th, irqState)
+	timer.Sync(th, irqState, gpu)
 
 	var val uint16
 	switch offset & 0xf {
@@ -321,12 +421,12 @@ func (timers *Timers) Load(size AccessSize, th *TimeHandler, offset uint32, irqS
 		panicFmt("timer: unhandled register %d", offset&0xf)
 	}
 
-	return accessSizeU32(size, uint32(val))
+	return uint32(val)
 }
 
 func (timers *Timers) Store(
 	size AccessSize,
-	val interface{},
+	val uint32,
 	th *TimeHandler,
 	offset uint32,
 	gpu *GPU,
@@ -336,10 +436,10 @@ func (timers *Timers) Store(
 		panicFmt("timer: unsupported store size %d", size)
 	}
 
-	valU16 := accessSizeToU16(size, val)
+	valU16 := uint16(val)
 	instance := offset >> 4
 	timer := timers.Timers[instance]
-	timer.Sync(th, irqState)
+	timer.Sync(th, irqState, gpu)
 
 	switch offset & 0xf {
 	case 0:
@@ -361,20 +461,20 @@ func (timers *Timers) Store(
 func (timers *Timers) VideoTimingsChanged(th *TimeHandler, irqState *IrqState, gpu *GPU) {
 	for _, timer := range timers.Timers {
 		if timer.NeedsGPU() {
-			timer.Sync(th, irqState)
+			timer.Sync(th, irqState, gpu)
 			timer.Reset(gpu, th)
 		}
 	}
 }
 
-func (timers *Timers) Sync(th *TimeHandler, irqState *IrqState) {
+func (timers *Timers) Sync(th *TimeHandler, irqState *IrqState, gpu *GPU) {
 	if th.NeedsSync(PERIPHERAL_TIMER0) {
-		timers.Timers[0].Sync(th, irqState)
+		timers.Timers[0].Sync(th, irqState, gpu)
 	}
 	if th.NeedsSync(PERIPHERAL_TIMER1) {
-		timers.Timers[1].Sync(th, irqState)
+		timers.Timers[1].Sync(th, irqState, gpu)
 	}
 	if th.NeedsSync(PERIPHERAL_TIMER2) {
-		timers.Timers[2].Sync(th, irqState)
+		timers.Timers[2].Sync(th, irqState, gpu)
 	}
 }
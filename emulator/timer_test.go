@@ -0,0 +1,88 @@
+package emulator
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTimerResetAtVBlank(t *testing.T) {
+	inter := newBenchInterconnect()
+	th := NewTimeHandler()
+	inter.Gpu.Sync(th, inter.IrqState)
+
+	// timer 1 counts HSyncs and is reset at the start of the VBlank
+	inter.Timers.Store(ACCESS_WORD, 1|1<<1|1<<8, th, 0x14, inter.Gpu, inter.IrqState)
+
+	var max uint16
+	for i := 0; i < 3000000; i += 100 {
+		th.Tick(100)
+		count := uint16(inter.Timers.Load(ACCESS_WORD, th, 0x10, inter.IrqState, inter.Gpu))
+		if count > max {
+			max = count
+		}
+	}
+
+	// the counter never goes past the lines of a frame
+	if max < 200 || max > 314 {
+		t.Errorf("expected the counter to be reset every frame, max count was %d", max)
+	}
+}
+
+func TestTimerToggleIrq(t *testing.T) {
+	inter := newBenchInterconnect()
+	th := NewTimeHandler()
+	irqState := inter.IrqState
+	irqState.SetMask(1 << INTERRUPT_TIMER2)
+
+	// timer 2 wraps at the target, repeat and toggle mode
+	inter.Timers.Store(ACCESS_WORD, 100, th, 0x28, inter.Gpu, irqState)
+	inter.Timers.Store(ACCESS_WORD, 1<<3|1<<4|1<<6|1<<7, th, 0x24, inter.Gpu, irqState)
+
+	mode := func() uint32 {
+		return inter.Timers.Load(ACCESS_WORD, th, 0x24, irqState, inter.Gpu)
+	}
+	if mode()&(1<<10) == 0 {
+		t.Fatal("the IRQ signal should be inactive after a mode write")
+	}
+
+	th.Tick(101)
+	if mode()&(1<<10) != 0 || !irqState.Active() {
+		t.Fatal("expected the first target to raise an interrupt")
+	}
+	irqState.Acknowledge(0)
+
+	th.Tick(101)
+	if mode()&(1<<10) == 0 || irqState.Active() {
+		t.Fatal("expected the second target to toggle the signal back without an interrupt")
+	}
+
+	th.Tick(101)
+	if mode()&(1<<10) != 0 || !irqState.Active() {
+		t.Fatal("expected the third target to raise an interrupt")
+	}
+}
+
+// Overclocking the CPU doesn't make the timers faster
+func TestTimerOverclock(t *testing.T) {
+	inter := newBenchInterconnect()
+	th := NewTimeHandler()
+	if err := th.SetOverclock(OVERCLOCK_MAX + 1); !errors.Is(err, ErrInvalidOverclock) {
+		t.Fatalf("expected ErrInvalidOverclock, got %v", err)
+	}
+	if err := th.SetOverclock(4); err != nil {
+		t.Fatal(err)
+	}
+
+	// timer 0 counts the system clock
+	inter.Timers.Store(ACCESS_WORD, 0, th, 0x04, inter.Gpu, inter.IrqState)
+	for i := 0; i < 1000; i++ {
+		th.Tick(3)
+	}
+
+	if th.CpuCycles != 3000 || th.Cycles != 750 {
+		t.Fatalf("expected 3000 CPU cycles in 750 cycles, got %d in %d", th.CpuCycles, th.Cycles)
+	}
+	if count := inter.Timers.Load(ACCESS_WORD, th, 0x00, inter.IrqState, inter.Gpu); count != 750 {
+		t.Errorf("expected the timer to count 750 cycles, got %d", count)
+	}
+}
@@ -0,0 +1,24 @@
+package emulator
+
+// Receives a character printed by the BIOS putchar function
+type TtyOutput func(c byte)
+
+// Sends the character to cpu.Tty if the CPU is about to call A(0x3C) or
+// B(0x3D) putchar. The call still goes through the BIOS (or the HLE)
+func (cpu *CPU) CapturePutchar() {
+	table := cpu.PC & 0x1fffffff
+	if table != BIOS_TABLE_A && table != BIOS_TABLE_B {
+		return
+	}
+
+	// the function number is usually set in the delay slot of the jump
+	function := cpu.Reg(9) // t1
+	if (table == BIOS_TABLE_A && function == 0x3c) ||
+		(table == BIOS_TABLE_B && function == 0x3d) {
+		c := cpu.Reg(4) // a0
+		if cpu.Load.Pending(4) {
+			c = cpu.Load.Val // the character is still being loaded
+		}
+		cpu.Tty(byte(c))
+	}
+}
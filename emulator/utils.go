@@ -3,6 +3,8 @@ package emulator
 import (
 	"errors"
 	"fmt"
+
+	"github.com/zeozeozeo/gopsx/emulator/bus"
 )
 
 var errOverflow = errors.New("integer overflow")
@@ -54,127 +56,74 @@ func sub32Overflow(a, b int32) (int32, error) {
 	return c, errOverflow
 }
 
-type AccessSize uint32
-
-// Types of accesses supported by the PlayStation archeticture
+// Size of a memory access, see bus.AccessSize
+type AccessSize = bus.AccessSize
 
-var (
-	ACCESS_BYTE     AccessSize = 1 // 8 bit
-	ACCESS_HALFWORD AccessSize = 2 // 16 bit
-	ACCESS_WORD     AccessSize = 4 // 32 bit
+const (
+	ACCESS_BYTE     = bus.ACCESS_BYTE
+	ACCESS_HALFWORD = bus.ACCESS_HALFWORD
+	ACCESS_WORD     = bus.ACCESS_WORD
 )
 
-func accessSizeU32(size AccessSize, val uint32) interface{} {
-	switch size {
-	case ACCESS_BYTE:
-		return byte(val)
-	case ACCESS_HALFWORD:
-		return uint16(val)
-	default: // handles ACCESS_WORD and invalid cases
-		return val
-	}
-}
-
-func accessSizeU16(size AccessSize, val uint16) interface{} {
-	switch size {
-	case ACCESS_BYTE:
-		return byte(val)
-	case ACCESS_HALFWORD:
-		return val
-	default: // handles ACCESS_WORD and invalid cases
-		return uint32(val)
+func oneIfTrue(val bool) uint32 {
+	if val {
+		return 1
 	}
+	return 0
 }
 
-func accessSizeToU32(size AccessSize, val interface{}) uint32 {
-	switch size {
-	case ACCESS_BYTE:
-		return uint32(val.(byte))
-	case ACCESS_HALFWORD:
-		return uint32(val.(uint16))
-	default: // handles ACCESS_WORD and invalid cases
-		return val.(uint32)
+func absInt64(v int64) int64 {
+	if v < 0 {
+		return -v
 	}
+	return v
 }
 
-func accessSizeToU16(size AccessSize, val interface{}) uint16 {
-	switch size {
-	case ACCESS_BYTE:
-		return uint16(val.(byte))
-	case ACCESS_HALFWORD:
-		return val.(uint16)
-	default: // handles ACCESS_WORD and invalid cases
-		return uint16(val.(uint32))
+func maxInt64(x, y int64) int64 {
+	if x > y {
+		return x
 	}
+	return y
 }
 
-func accessSizeToU8(size AccessSize, val interface{}) uint8 {
-	switch size {
-	case ACCESS_BYTE:
-		return val.(byte)
-	case ACCESS_HALFWORD:
-		return uint8(val.(uint16))
-	default: // handles ACCESS_WORD and invalid cases
-		return uint8(val.(uint32))
+func minInt(x, y int) int {
+	if x < y {
+		return x
 	}
+	return y
 }
 
-func oneIfTrue(val bool) uint32 {
-	if val {
-		return 1
+func maxInt(x, y int) int {
+	if x > y {
+		return x
 	}
-	return 0
+	return y
 }
 
-func countLeadingZeroesU16(val uint16) uint16 {
-	var r uint16
-	for ((val & 0x8000) == 0) && r < 16 {
-		val <<= 1
-		r++
+func minU32(x, y uint32) uint32 {
+	if x < y {
+		return x
 	}
-	return r
+	return y
 }
 
-func absInt64(v int64) int64 {
-	if v < 0 {
-		return -v
+func minU64(x, y uint64) uint64 {
+	if x < y {
+		return x
 	}
-	return v
+	return y
 }
 
-func maxInt64(x, y int64) int64 {
+func maxF32(x, y float32) float32 {
 	if x > y {
 		return x
 	}
 	return y
 }
 
-func countLeadingZeroesU32(x uint32) uint32 {
-	var n uint32 = 32
-	var y uint32
-	y = x >> 16
-	if y != 0 {
-		n = n - 16
-		x = y
-	}
-	y = x >> 8
-	if y != 0 {
-		n = n - 8
-		x = y
-	}
-	y = x >> 4
-	if y != 0 {
-		n = n - 4
-		x = y
-	}
-	y = x >> 2
-	if y != 0 {
-		n = n - 2
-		x = y
-	}
-	y = x >> 1
-	if y != 0 {
-		return n - 2
+func absF32(v float32) float32 {
+	if v < 0 {
+		return -v
 	}
-	return n - x
+	return v
 }
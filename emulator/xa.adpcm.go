@@ -0,0 +1,192 @@
+package emulator
+
+// XA-ADPCM filter coefficients (positive and negative)
+var (
+	XA_ADPCM_POS = [4]int32{0, 60, 115, 98}
+	XA_ADPCM_NEG = [4]int32{0, 0, -52, -55}
+)
+
+const (
+	XA_SOUND_GROUPS     = 18  // Sound groups in a sector
+	XA_SOUND_GROUP_SIZE = 128 // Size of a sound group in bytes
+	XA_SAMPLES_PER_UNIT = 28  // Samples in a sound unit
+)
+
+// Submode bits of a mode 2 sector
+const (
+	XA_SUBMODE_AUDIO    uint8 = 0x04 // Sector contains XA-ADPCM audio
+	XA_SUBMODE_FORM2    uint8 = 0x20 // Form 2 sector
+	XA_SUBMODE_REALTIME uint8 = 0x40 // Real-time sector
+)
+
+// Returns the file number of a mode 2 sector
+func (sector *XaSector) File() uint8 {
+	return sector.Data[16]
+}
+
+// Returns the channel number of a mode 2 sector
+func (sector *XaSector) Channel() uint8 {
+	return sector.Data[17]
+}
+
+// Returns the submode of a mode 2 sector
+func (sector *XaSector) Submode() uint8 {
+	return sector.Data[18]
+}
+
+// Returns the coding information of a mode 2 sector
+func (sector *XaSector) CodingInfo() uint8 {
+	return sector.Data[19]
+}
+
+// Returns true if the sector contains XA-ADPCM audio
+func (sector *XaSector) IsAudio() bool {
+	return sector.Mode == SECTOR_M2_FORM2 && sector.Submode()&XA_SUBMODE_AUDIO != 0
+}
+
+// XA-ADPCM decoder, outputs 44.1kHz stereo samples
+type XaAdpcmDecoder struct {
+	Old       [2]int32     // Previous sample of the left and right channel
+	Older     [2]int32     // Sample before the previous one
+	Resampler *XaResampler // 37.8/18.9kHz -> 44.1kHz
+	decoded   []int16
+	output    []int16
+}
+
+// Returns a new XA-ADPCM decoder
+func NewXaAdpcmDecoder() *XaAdpcmDecoder {
+	return &XaAdpcmDecoder{
+		Resampler: &XaResampler{},
+	}
+}
+
+// Resets the filter history
+func (dec *XaAdpcmDecoder) Reset() {
+	dec.Old = [2]int32{}
+	dec.Older = [2]int32{}
+	dec.Resampler.Reset()
+}
+
+// Decodes an XA-ADPCM sector into interleaved 44.1kHz stereo samples. The
+// returned slice is reused by the next call
+func (dec *XaAdpcmDecoder) DecodeSector(sector *XaSector) []int16 {
+	coding := sector.CodingInfo()
+	stereo := coding&3 == 1
+	halfRate := (coding>>2)&3 == 1
+	eightBit := (coding>>4)&3 == 1
+
+	dec.decoded = dec.decoded[:0]
+	data := sector.Data[24:]
+
+	for group := 0; group < XA_SOUND_GROUPS; group++ {
+		g := data[group*XA_SOUND_GROUP_SIZE : (group+1)*XA_SOUND_GROUP_SIZE]
+		if eightBit {
+			dec.decodeGroup(g, 4, stereo, true)
+		} else {
+			dec.decodeGroup(g, 8, stereo, false)
+		}
+	}
+
+	rate := uint32(37800)
+	if halfRate {
+		rate = 18900
+	}
+
+	dec.output = dec.Resampler.Resample(dec.decoded, rate, dec.output[:0])
+	return dec.output
+}
+
+// Decodes `units` sound units of a sound group and appends the samples (as
+// interleaved stereo) to dec.decoded
+func (dec *XaAdpcmDecoder) decodeGroup(g []byte, units int, stereo, eightBit bool) {
+	var samples [8][XA_SAMPLES_PER_UNIT]int16
+
+	for unit := 0; unit < units; unit++ {
+		header := g[4+unit]
+		shift := header & 0xf
+		if shift > 12 {
+			shift = 9
+		}
+		filter := (header >> 4) & 3
+
+		// in stereo mode, even units are the left channel
+		channel := 0
+		if stereo {
+			channel = unit & 1
+		}
+
+		for i := 0; i < XA_SAMPLES_PER_UNIT; i++ {
+			var raw int32
+			if eightBit {
+				raw = int32(int16(uint16(g[16+i*4+unit])<<8)) >> shift
+			} else {
+				b := g[16+i*4+unit/2] >> ((unit & 1) * 4)
+				raw = int32(int16(uint16(b&0xf)<<12)) >> shift
+			}
+
+			s := raw + ((dec.Old[channel]*XA_ADPCM_POS[filter] +
+				dec.Older[channel]*XA_ADPCM_NEG[filter] + 32) >> 6)
+			sample := clampInt16(s)
+
+			dec.Older[channel] = dec.Old[channel]
+			dec.Old[channel] = int32(sample)
+			samples[unit][i] = sample
+		}
+	}
+
+	if stereo {
+		for unit := 0; unit < units; unit += 2 {
+			for i := 0; i < XA_SAMPLES_PER_UNIT; i++ {
+				dec.decoded = append(dec.decoded, samples[unit][i], samples[unit+1][i])
+			}
+		}
+		return
+	}
+
+	for unit := 0; unit < units; unit++ {
+		for i := 0; i < XA_SAMPLES_PER_UNIT; i++ {
+			dec.decoded = append(dec.decoded, samples[unit][i], samples[unit][i])
+		}
+	}
+}
+
+// Linear interpolation resampler for interleaved stereo samples
+type XaResampler struct {
+	Phase uint32   // 16.16 position relative to the first frame of the next input
+	Prev  [2]int16 // Last frame of the previous input
+}
+
+// Resets the resampler state
+func (r *XaResampler) Reset() {
+	r.Phase = 0
+	r.Prev = [2]int16{}
+}
+
+// Resamples `in` from `rate` to CD_SAMPLE_RATE and appends the result to `out`
+func (r *XaResampler) Resample(in []int16, rate uint32, out []int16) []int16 {
+	frames := uint32(len(in) / 2)
+	if frames == 0 {
+		return out
+	}
+	step := (rate << 16) / CD_SAMPLE_RATE
+
+	for r.Phase < frames<<16 {
+		i := int(r.Phase >> 16)
+		frac := int32(r.Phase & 0xffff)
+
+		for ch := 0; ch < 2; ch++ {
+			// interpolate between frame i-1 and frame i
+			a := int32(r.Prev[ch])
+			if i > 0 {
+				a = int32(in[(i-1)*2+ch])
+			}
+			b := int32(in[i*2+ch])
+			out = append(out, int16(a+(((b-a)*frac)>>16)))
+		}
+		r.Phase += step
+	}
+
+	r.Phase -= frames << 16
+	r.Prev = [2]int16{in[len(in)-2], in[len(in)-1]}
+	return out
+}
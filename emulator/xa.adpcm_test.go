@@ -0,0 +1,144 @@
+package emulator
+
+import "testing"
+
+// Returns a form 2 audio sector with the coding information `coding`. The
+// first sound group has the unit headers `headers` and every sample of
+// unit 0 and 1 is `data[0]` and `data[1]`, the other groups are silent
+func newTestXaSector(coding uint8, headers []uint8, data [2]uint8) *XaSector {
+	sector := NewXaSector()
+	sector.Mode = SECTOR_M2_FORM2
+	sector.Data[18] = XA_SUBMODE_AUDIO | XA_SUBMODE_FORM2 | XA_SUBMODE_REALTIME
+	sector.Data[19] = coding
+
+	g := sector.Data[24:]
+	copy(g[4:], headers)
+	for i := 0; i < XA_SAMPLES_PER_UNIT; i++ {
+		g[16+i*4], g[16+i*4+1] = data[0], data[1]
+	}
+	return sector
+}
+
+var xaAdpcmTests = []struct {
+	Desc    string
+	Coding  uint8
+	Headers []uint8
+	Data    [2]uint8
+	Frames  int              // Decoded frames
+	Decoded map[int][2]int16 // Expected frames before resampling
+	Output  int              // Frames at 44.1kHz
+}{
+	{
+		// unit 0: 7 with no filter, unit 1: 1>>12 with filter 1, unit 2:
+		// the shift of 13 is out of range and becomes 9, unit 3: filter 2
+		// overflows and clamps
+		Desc: "mono 37.8kHz", Coding: 0x00,
+		Headers: []uint8{0x00, 0x1c, 0x0d, 0x20}, Data: [2]uint8{0x17, 0x78},
+		Frames: 4032, Output: 4705,
+		Decoded: map[int][2]int16{
+			0: {28672, 28672}, 27: {28672, 28672}, 28: {26881, 26881}, 29: {25202, 25202},
+			56: {-64, -64}, 84: {28609, 28609}, 85: {32767, 32767}, 112: {0, 0},
+		},
+	},
+	{
+		// the left and the right channel keep their own filter history
+		Desc: "stereo 37.8kHz", Coding: 0x01,
+		Headers: []uint8{0x00, 0x0c, 0x1c, 0x1c}, Data: [2]uint8{0xf7, 0x01},
+		Frames: 2016, Output: 2353,
+		Decoded: map[int][2]int16{
+			0: {28672, -1}, 27: {28672, -1}, 28: {26881, -1}, 29: {25202, -1}, 56: {0, 0},
+		},
+	},
+	{
+		Desc: "mono 18.9kHz", Coding: 0x04,
+		Headers: []uint8{0x00, 0x1c, 0x0d, 0x20}, Data: [2]uint8{0x17, 0x78},
+		Frames: 4032, Output: 9409,
+		Decoded: map[int][2]int16{0: {28672, 28672}, 28: {26881, 26881}, 85: {32767, 32767}},
+	},
+	{
+		Desc: "stereo 18.9kHz", Coding: 0x05,
+		Headers: []uint8{0x00, 0x0c, 0x1c, 0x1c}, Data: [2]uint8{0xf7, 0x01},
+		Frames: 2016, Output: 4705,
+		Decoded: map[int][2]int16{0: {28672, -1}, 28: {26881, -1}},
+	},
+	{
+		Desc: "8 bit mono 37.8kHz", Coding: 0x10,
+		Headers: []uint8{0x08, 0x1c}, Data: [2]uint8{0x80, 0x01},
+		Frames: 2016, Output: 2353,
+		Decoded: map[int][2]int16{0: {-128, -128}, 28: {-120, -120}, 29: {-112, -112}, 56: {0, 0}},
+	},
+}
+
+func TestXaAdpcmDecode(t *testing.T) {
+	for _, test := range xaAdpcmTests {
+		dec := NewXaAdpcmDecoder()
+		output := dec.DecodeSector(newTestXaSector(test.Coding, test.Headers, test.Data))
+
+		if len(dec.decoded) != test.Frames*2 {
+			t.Errorf("%s: expected %d decoded frames, got %d", test.Desc, test.Frames, len(dec.decoded)/2)
+			continue
+		}
+		for frame, expected := range test.Decoded {
+			if got := [2]int16{dec.decoded[frame*2], dec.decoded[frame*2+1]}; got != expected {
+				t.Errorf("%s: frame %d: expected %d, got %d", test.Desc, frame, expected, got)
+			}
+		}
+		if len(output) != test.Output*2 {
+			t.Errorf("%s: expected %d output frames, got %d", test.Desc, test.Output, len(output)/2)
+		}
+	}
+}
+
+// The output starts from the previous frame (silence after a reset) and
+// interpolates towards the input
+func TestXaResampler(t *testing.T) {
+	in := []int16{28672, -1, 28672, -1, 28672, -1}
+	for _, c := range []struct {
+		rate     uint32
+		expected []int16
+	}{
+		{37800, []int16{0, 0, 24575, -1, 28672, -1, 28672, -1}},
+		{18900, []int16{0, 0, 12287, -1, 24575, -1, 28672, -1}},
+	} {
+		resampler := &XaResampler{}
+		out := resampler.Resample(in, c.rate, nil)
+		for i, expected := range c.expected {
+			if out[i] != expected {
+				t.Errorf("%dHz: expected %d, got %d", c.rate, c.expected, out[:len(c.expected)])
+				break
+			}
+		}
+	}
+}
+
+// Resampling a stream in pieces gives the same output as resampling it at
+// once
+func TestXaResamplerContinuity(t *testing.T) {
+	in := make([]int16, 2*1000)
+	for i := range in {
+		in[i] = int16(i * 13)
+	}
+	for _, rate := range []uint32{37800, 18900} {
+		whole := (&XaResampler{}).Resample(in, rate, nil)
+
+		resampler := &XaResampler{}
+		var pieces []int16
+		for start := 0; start < len(in); start += 2 * 37 {
+			end := start + 2*37
+			if end > len(in) {
+				end = len(in)
+			}
+			pieces = resampler.Resample(in[start:end], rate, pieces)
+		}
+
+		if len(pieces) != len(whole) {
+			t.Fatalf("%dHz: expected %d samples, got %d", rate, len(whole), len(pieces))
+		}
+		for i := range whole {
+			if pieces[i] != whole[i] {
+				t.Errorf("%dHz: sample %d: expected %d, got %d", rate, i, whole[i], pieces[i])
+				break
+			}
+		}
+	}
+}
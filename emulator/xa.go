@@ -68,6 +68,15 @@ func (sector *XaSector) Msf() *Msf {
 
 // Validate the sector (returns nil if successful)
 func (sector *XaSector) ValidateMode1Or2(msf *Msf) error {
+	if err := sector.ParseHeader(msf); err != nil {
+		return err
+	}
+	return sector.ValidateChecksum()
+}
+
+// Validates the sync pattern and MSF and sets `sector.Mode`. The checksum
+// is not validated, see ValidateChecksum
+func (sector *XaSector) ParseHeader(msf *Msf) error {
 	// validate sync pattern
 	for idx, v := range sector.Data[:12] {
 		if v != XA_SECTOR_SYNC_PATTERN[idx] {
@@ -85,7 +94,7 @@ func (sector *XaSector) ValidateMode1Or2(msf *Msf) error {
 
 	switch mode {
 	case 2:
-		return sector.ValidateMode2()
+		return sector.ParseMode2()
 	default:
 		return fmt.Errorf("xa: unhandled mode %d at %s", mode, msf)
 	}
@@ -93,6 +102,14 @@ func (sector *XaSector) ValidateMode1Or2(msf *Msf) error {
 
 // Validate mode 2
 func (sector *XaSector) ValidateMode2() error {
+	if err := sector.ParseMode2(); err != nil {
+		return err
+	}
+	return sector.ValidateChecksum()
+}
+
+// Sets `sector.Mode` from the mode 2 subheader
+func (sector *XaSector) ParseMode2() error {
 	// byte 16: File number
 	// byte 17: Channel number
 	// byte 18: Submode
@@ -116,10 +133,21 @@ func (sector *XaSector) ValidateMode2() error {
 
 	if submode&0x20 != 0 {
 		sector.Mode = SECTOR_M2_FORM2
+	} else {
+		sector.Mode = SECTOR_M2_FORM1
+	}
+	return nil
+}
+
+// Validates the checksum of a sector after its header was parsed
+func (sector *XaSector) ValidateChecksum() error {
+	switch sector.Mode {
+	case SECTOR_M2_FORM1:
+		return sector.ValidateMode2Form1()
+	case SECTOR_M2_FORM2:
 		return sector.ValidateMode2Form2()
 	}
-	sector.Mode = SECTOR_M2_FORM1
-	return sector.ValidateMode2Form1()
+	return fmt.Errorf("invalid sector mode %d", sector.Mode)
 }
 
 // Validate CRC
@@ -1,89 +1,607 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"math"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"runtime/debug"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/audio"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/zeozeozeo/gopsx/emulator"
+	"github.com/zeozeozeo/gopsx/renderer"
 )
 
 var (
-	width, height = 1024, 512
+	width, height = 1024, 768 // Size of the screen, follows the window, see Layout
 	gpu           *emulator.GPU
 	currentFrame  = ebiten.NewImage(1024, 512)
-	wg            sync.WaitGroup
+	frameQueue    = emulator.NewFrameQueue() // Finished frames waiting to be drawn
 	prevFrameTime = time.Now()
+	prevFrameNum  uint64
 	showFps       *bool
 	showCycles    *bool
-	cpu           *emulator.CPU
+	console       *emulator.Console // Runs the emulator, the frontend only talks to it
+	gpuLogger     *emulator.GpuLogger
 	didPanic      bool
 	panicString   string
 	doRecover     *bool
 	frameDt       float64
 	disc          *emulator.Disc
+	useMultitap   *bool
+	discs         []*emulator.Disc  // All discs passed with -disc
+	discFiles     []string          // Paths of the discs in `discs`
+	currentDisc   int               // Index of the inserted disc in `discs`
+	cheats        []*emulator.Cheat // Cheats loaded with -cheats
+	cpuMode       = emulator.CPU_MODE_INTERPRETER
+	deinterlace   = emulator.DEINTERLACE_WEAVE
+	unmapped      = emulator.UNMAPPED_BUS_ERROR
+	cdTimings     = emulator.DefaultCdRomTimings()
+	logOverlay    *bool
+	profiler      *emulator.Profiler // Set with -profile, nil otherwise
+	heatMap       *bool
+	discordApp    *string
+	pgxp          *bool
+	perspective   *bool
+	dithering     *bool
+	ffmpegPath    *string
+	recording     *recorder            // Video being recorded with F10, nil if not recording
+	audioOutput   emulator.AudioOutput // Plays the CD audio, nil if muted
+	audioPlayer   *audio.Player
+	hostMixer     = emulator.NewHostMixer() // Volumes of the audio channels, changed in the audio panel
+	audioChannel  emulator.AudioChannel     // Channel selected in the audio panel
+	reverb        *bool
+	fastBoot      *bool
+	showTty       *bool
+	biosDebug     *bool
+	cartPath      *string
+	serialLink    emulator.SerialLink // SIO1 link, nil if nothing is plugged in
+	netplay       *emulator.Netplay   // Netplay session, nil when playing locally
+	netplayOn     bool                // Set at startup, pausing and resetting are disabled
+	movie         *emulator.Movie     // Input movie being recorded or played back
+	moviePath     string              // Where the recorded movie is saved
+	stateDir      *string             // Directory of the savestates
+	autoSave      *bool               // Save the state to the auto-save slot on exit
+	resumeState   *bool               // Load the auto-save at startup
+	crashTrace    *int                // Instructions kept for the crash dumps
+	symbolsPath   *string             // Symbol file of the running program, set with -symbols
+	breakpoints   breakpointList      // Breakpoints set with -break
+	startState    *string             // Savestate loaded at startup, set with -state
+	runAhead      *int                // Frames the console runs ahead, set with -runahead
+	fullscreen    *bool               // Start in fullscreen
+	// Devices plugged into port 1 and port 2, set with -port1 and -port2
+	portDevices = [2]emulator.GamepadType{emulator.GAMEPAD_TYPE_DIGITAL, emulator.GAMEPAD_TYPE_DISCONNECTED}
+	// Input of every controller slot of both ports, sent to the console at
+	// the end of every update
+	padInputs = newPadInputs()
+	// Cursor position at the last update, the mouse sends the movement
+	prevCursorX, prevCursorY int
+	// Local controller when the input is only applied at frame boundaries
+	// (netplay and movies)
+	latchedPad = emulator.NewGamepad(emulator.GAMEPAD_TYPE_DIGITAL)
 )
 
-// Gamepad button can be binded to multiple keys
-var keyboardGamepadBindings = map[emulator.Button][]ebiten.Key{
-	emulator.BUTTON_START:    {ebiten.KeyBackspace},
-	emulator.BUTTON_SELECT:   {ebiten.KeyShiftRight},
-	emulator.BUTTON_DUP:      {ebiten.KeyUp},
-	emulator.BUTTON_DRIGHT:   {ebiten.KeyRight},
-	emulator.BUTTON_DDOWN:    {ebiten.KeyDown},
-	emulator.BUTTON_DLEFT:    {ebiten.KeyLeft},
-	emulator.BUTTON_L2:       {ebiten.KeyKPDivide},
-	emulator.BUTTON_R2:       {ebiten.KeyKPMultiply},
-	emulator.BUTTON_L1:       {ebiten.KeyKP7},
-	emulator.BUTTON_R1:       {ebiten.KeyKP9},
-	emulator.BUTTON_TRIANGLE: {ebiten.KeyKP8},
-	emulator.BUTTON_CIRCLE:   {ebiten.KeyKP6},
-	emulator.BUTTON_CROSS:    {ebiten.KeyKP2},
-	emulator.BUTTON_SQUARE:   {ebiten.KeyKP4},
+// List of disc paths, the -disc flag can be used multiple times
+type discPaths []string
+
+func (paths *discPaths) String() string {
+	return strings.Join(*paths, ",")
+}
+
+func (paths *discPaths) Set(path string) error {
+	*paths = append(*paths, path)
+	return nil
+}
+
+// Addresses or symbol names, the -break flag can be used multiple times
+type breakpointList []string
+
+func (list *breakpointList) String() string {
+	return strings.Join(*list, ",")
+}
+
+func (list *breakpointList) Set(breakpoint string) error {
+	*list = append(*list, breakpoint)
+	return nil
+}
+
+// Keys that must all be held to press a button, e.g. {ShiftLeft, KeyUp}
+type keyBinding []ebiten.Key
+
+// Returns true if all keys of the binding are held
+func (binding keyBinding) pressed() bool {
+	for _, key := range binding {
+		if !ebiten.IsKeyPressed(key) {
+			return false
+		}
+	}
+	return len(binding) > 0
+}
+
+// Returns true if every key of `keys` is part of the binding
+func (binding keyBinding) contains(keys keyBinding) bool {
+	for _, key := range keys {
+		found := false
+		for _, other := range binding {
+			if other == key {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Gamepad button can be binded to multiple keys or key combinations, the
+// button is held while any of them is held
+var keyboardGamepadBindings = map[emulator.Button][]keyBinding{
+	emulator.BUTTON_START:    {{ebiten.KeyBackspace}, {ebiten.KeyEnter}},
+	emulator.BUTTON_SELECT:   {{ebiten.KeyShiftRight}},
+	emulator.BUTTON_DUP:      {{ebiten.KeyUp}},
+	emulator.BUTTON_DRIGHT:   {{ebiten.KeyRight}},
+	emulator.BUTTON_DDOWN:    {{ebiten.KeyDown}},
+	emulator.BUTTON_DLEFT:    {{ebiten.KeyLeft}},
+	emulator.BUTTON_L2:       {{ebiten.KeyKPDivide}, {ebiten.KeyShiftLeft, ebiten.KeyQ}},
+	emulator.BUTTON_R2:       {{ebiten.KeyKPMultiply}, {ebiten.KeyShiftLeft, ebiten.KeyE}},
+	emulator.BUTTON_L1:       {{ebiten.KeyKP7}, {ebiten.KeyQ}},
+	emulator.BUTTON_R1:       {{ebiten.KeyKP9}, {ebiten.KeyE}},
+	emulator.BUTTON_TRIANGLE: {{ebiten.KeyKP8}, {ebiten.KeyI}},
+	emulator.BUTTON_CIRCLE:   {{ebiten.KeyKP6}, {ebiten.KeyL}},
+	emulator.BUTTON_CROSS:    {{ebiten.KeyKP2}, {ebiten.KeyK}},
+	emulator.BUTTON_SQUARE:   {{ebiten.KeyKP4}, {ebiten.KeyJ}},
 }
 
+// Buttons held on the keyboard at the last update
+var keyboardButtons emulator.ButtonsState
+
 type ebitenGame struct {
-	renderer   *emulator.EbitenRenderer
+	renderer   *renderer.EbitenRenderer
 	gamepadIDs map[ebiten.GamepadID]struct{}
 	axes       map[ebiten.GamepadID][]float64
+	// When the vibration of the host gamepads was last refreshed
+	rumbleTime time.Time
+	vram       vramViewer
+	showGpuLog bool // Show the GPU commands of the last frame, toggled with F6
+	// Debug overlay panels that are shown, toggled with overlayKeys
+	overlay [overlayPanelCount]bool
+	// RAM heat map of the last frame, see overlayHeatMap
+	heatImage *ebiten.Image
+}
+
+// Debug overlay panels
+type overlayPanel int
+
+const (
+	overlayGpu overlayPanel = iota
+	overlayCdRom
+	overlayDma
+	overlayIrq
+	overlayProfile
+	overlayHeatMap
+	overlayAudio
+	overlayPanelCount
+)
+
+// Keys that toggle the debug overlay panels
+var overlayKeys = [overlayPanelCount]ebiten.Key{ebiten.Key1, ebiten.Key2, ebiten.Key3, ebiten.Key4, ebiten.Key5, ebiten.Key6, ebiten.Key7}
+
+var dmaPortNames = [7]string{"MDEC in", "MDEC out", "GPU", "CD-ROM", "SPU", "PIO", "OTC"}
+
+// VRAM debug view, toggled with F2
+type vramViewer struct {
+	open bool
+	// 15 bit shows the whole VRAM, 4 and 8 bit show the selected page
+	depth        emulator.TextureDepth
+	pageX, pageY uint8  // Selected texture page
+	clutX, clutY uint16 // Selected palette
+	vramImage    *ebiten.Image
+	pageImage    *ebiten.Image
+	clutImage    *ebiten.Image
 }
 
 func (g *ebitenGame) Update() error {
-	if cpu == nil {
+	if console == nil {
 		return nil
 	}
-	pad := cpu.Inter.PadMemCard.Pad1
 	g.handleConnectedGamepads()
-	g.handleGamepadInput(pad)
-	handleKeyboard(pad)
+	g.handleGamepadInput()
+	handleKeyboard()
+
+	g.vram.update()
+	if !g.vram.open {
+		handleMouseDevices()
+	}
+	if gpuLogger != nil {
+		g.handleGpuLogKeys()
+	}
+	for i, key := range overlayKeys {
+		if inpututil.IsKeyJustPressed(key) {
+			g.overlay[i] = !g.overlay[i]
+		}
+	}
+	if profiler != nil && inpututil.IsKeyJustPressed(ebiten.KeyF1) {
+		dumpProfile()
+	}
+	if g.overlay[overlayAudio] {
+		handleAudioKeys()
+	}
+
+	if !netplayOn {
+		handleEmulationKeys()
+		handleStateKeys()
+	}
+
+	handleCaptureKeys()
+	handleDisplayKeys()
+	sendInput()
+
+	// switch to the next disc
+	if inpututil.IsKeyJustPressed(ebiten.KeyF5) && len(discs) > 1 {
+		currentDisc = (currentDisc + 1) % len(discs)
+		console.SwapDisc(discs[currentDisc])
+		fmt.Printf("main: swapping to disc %d\n", currentDisc+1)
+	}
 
 	return nil
 }
 
-func handleKeyboard(pad *emulator.Gamepad) {
-	for _, button := range emulator.GamepadButtons {
-		keys := keyboardGamepadBindings[button]
-		for _, key := range keys {
-			if ebiten.IsKeyPressed(key) {
-				pad.SetButtonState(button, emulator.BUTTON_STATE_PRESSED)
-			} else if inpututil.IsKeyJustReleased(key) {
-				pad.SetButtonState(button, emulator.BUTTON_STATE_RELEASED)
+// Sends the keyboard to slot 0 of port 1. Only the buttons that changed
+// since the last update are pressed or released, so the keyboard doesn't
+// release the buttons held on a gamepad
+func handleKeyboard() {
+	type match struct {
+		button  emulator.Button
+		binding keyBinding
+	}
+	var matches []match
+	for button, bindings := range keyboardGamepadBindings {
+		for _, binding := range bindings {
+			if binding.pressed() {
+				matches = append(matches, match{button, binding})
 			}
-			break
 		}
 	}
 
-	if ebiten.IsKeyPressed(ebiten.KeyEscape) {
+	// a combination hides the bindings made of some of its keys, so
+	// Shift+Q doesn't also press the button bound to Q
+	var held emulator.ButtonsState
+	for _, m := range matches {
+		hidden := false
+		for _, other := range matches {
+			if len(other.binding) > len(m.binding) && other.binding.contains(m.binding) {
+				hidden = true
+				break
+			}
+		}
+		if !hidden {
+			held.Set(m.button, emulator.BUTTON_STATE_PRESSED)
+		}
+	}
+
+	for _, button := range emulator.GamepadButtons {
+		switch {
+		case held.Pressed(button) && !keyboardButtons.Pressed(button):
+			padInputs[0][0].buttons.Set(button, emulator.BUTTON_STATE_PRESSED)
+		case !held.Pressed(button) && keyboardButtons.Pressed(button):
+			padInputs[0][0].buttons.Set(button, emulator.BUTTON_STATE_RELEASED)
+		}
+	}
+	keyboardButtons = held
+
+	// the Analog button of the DualShock
+	if inpututil.IsKeyJustPressed(ebiten.KeyF11) {
+		console.PressAnalog(emulator.TARGET_PADMEMCARD1, 0)
+	}
+
+	// a web page can't be closed
+	if !browser && ebiten.IsKeyPressed(ebiten.KeyEscape) {
+		autoSaveState()
+		saveMovie()
+		if recording != nil {
+			recording.stop()
+		}
 		os.Exit(0)
 	}
 }
 
+// Input of a controller slot, see Console.SetInput
+type padInput struct {
+	buttons emulator.ButtonsState
+	axes    [emulator.AXIS_COUNT]uint8
+}
+
+// Returns the input of every slot with no buttons pressed
+func newPadInputs() [2][emulator.MULTITAP_SLOTS]padInput {
+	var inputs [2][emulator.MULTITAP_SLOTS]padInput
+	for port := range inputs {
+		for slot := range inputs[port] {
+			inputs[port][slot].axes = emulator.CenteredAxes()
+		}
+	}
+	return inputs
+}
+
+// Sends the input of the slots that have a controller to the console, it's
+// applied at the start of the next frame
+func sendInput() {
+	for port, device := range portDevices {
+		slots := 1
+		if port == 0 && *useMultitap {
+			slots = emulator.MULTITAP_SLOTS
+		} else if device == emulator.GAMEPAD_TYPE_DISCONNECTED {
+			continue
+		}
+
+		for slot := 0; slot < slots; slot++ {
+			input := padInputs[port][slot]
+			console.SetInput(emulator.SerialTarget(port), slot, input.buttons, input.axes)
+		}
+	}
+}
+
+// Sends the host mouse to the Guncons and the PlayStation mice. The Guncons
+// aim at the cursor, the left button is the trigger and the right and
+// middle buttons are A and B. The mice move with the cursor and use the
+// left and right buttons
+func handleMouseDevices() {
+	x, y := ebiten.CursorPosition()
+	dx, dy := x-prevCursorX, y-prevCursorY
+	prevCursorX, prevCursorY = x, y
+
+	vramX, vramY := screenToVram(x, y)
+
+	for port, device := range portDevices {
+		target := emulator.SerialTarget(port)
+
+		var buttons map[ebiten.MouseButton]emulator.Button
+		switch device {
+		case emulator.GAMEPAD_TYPE_GUNCON:
+			console.AimLightgun(target, 0, vramX, vramY)
+			buttons = map[ebiten.MouseButton]emulator.Button{
+				ebiten.MouseButtonLeft:   emulator.GUNCON_TRIGGER,
+				ebiten.MouseButtonRight:  emulator.GUNCON_A,
+				ebiten.MouseButtonMiddle: emulator.GUNCON_B,
+			}
+		case emulator.GAMEPAD_TYPE_MOUSE:
+			if dx != 0 || dy != 0 {
+				console.MoveMouse(target, 0, dx, dy)
+			}
+			buttons = map[ebiten.MouseButton]emulator.Button{
+				ebiten.MouseButtonLeft:  emulator.MOUSE_LEFT,
+				ebiten.MouseButtonRight: emulator.MOUSE_RIGHT,
+			}
+		}
+
+		for mouseButton, button := range buttons {
+			if inpututil.IsMouseButtonJustPressed(mouseButton) {
+				padInputs[port][0].buttons.Set(button, emulator.BUTTON_STATE_PRESSED)
+			} else if inpututil.IsMouseButtonJustReleased(mouseButton) {
+				padInputs[port][0].buttons.Set(button, emulator.BUTTON_STATE_RELEASED)
+			}
+		}
+	}
+}
+
+// P pauses and resumes, O advances one frame, R rewinds the recorded movie,
+// F7 cycles the slow motion speeds, F8 resets and F9 power cycles the
+// console
+func handleEmulationKeys() {
+	if inpututil.IsKeyJustPressed(ebiten.KeyP) {
+		if console.Status().Paused {
+			console.Resume()
+		} else {
+			console.Pause()
+		}
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyO) {
+		console.FrameAdvance()
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyR) {
+		rewindMovie()
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyF7) {
+		speed := nextSpeed(console.Status().Speed)
+		console.SetSpeed(speed)
+		if speed == emulator.SPEED_UNLIMITED {
+			fmt.Println("main: speed: unlimited")
+		} else {
+			fmt.Printf("main: speed: %d%%\n", int(speed*100))
+		}
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyF8) {
+		fmt.Println("main: reset")
+		console.Reset(false)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyF9) {
+		fmt.Println("main: power cycle")
+		console.Reset(true)
+	}
+}
+
+// Sample rate of the audio played on the host, the CD audio is resampled to
+// it
+const hostSampleRate = 48000
+
+// Starts playing the CD audio with `latency` of buffering
+func startAudio(latency time.Duration) {
+	resampler := emulator.NewResampler(hostSampleRate, latency)
+	player, err := audio.NewContext(hostSampleRate).NewPlayer(resampler)
+	if err != nil {
+		fmt.Printf("main: couldn't start the audio: %s\n", err)
+		return
+	}
+	// the resampler already keeps `latency` of audio
+	player.SetBufferSize(latency / 2)
+	player.Play()
+	audioPlayer = player
+	audioOutput = resampler.Write
+}
+
+// F12 saves a screenshot, F10 starts and stops recording a video
+func handleCaptureKeys() {
+	if inpututil.IsKeyJustPressed(ebiten.KeyF12) {
+		// the screenshot is taken at the end of the next frame
+		go saveScreenshot(fmt.Sprintf("screenshot_%d.png", time.Now().Unix()))
+	}
+	if !inpututil.IsKeyJustPressed(ebiten.KeyF10) {
+		return
+	}
+
+	if recording != nil {
+		if err := recording.stop(); err != nil {
+			fmt.Printf("main: couldn't record the video: %s\n", err)
+		} else {
+			fmt.Printf("main: saved the video to \"%s\"\n", recording.path)
+		}
+		recording = nil
+		return
+	}
+
+	rec, err := startRecording(time.Now().Unix())
+	if err != nil {
+		fmt.Printf("main: couldn't start recording: %s\n", err)
+		return
+	}
+	recording = rec
+	fmt.Printf("main: recording to \"%s\", press F10 to stop\n", rec.path)
+}
+
+// Saves the next frame to a PNG file
+func saveScreenshot(path string) {
+	img := console.Screenshot()
+	if img == nil {
+		return
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		fmt.Printf("main: couldn't save the screenshot: %s\n", err)
+		return
+	}
+	defer file.Close()
+
+	if err := png.Encode(file, img); err != nil {
+		fmt.Printf("main: couldn't save the screenshot: %s\n", err)
+		return
+	}
+	fmt.Printf("main: saved a screenshot to \"%s\"\n", path)
+}
+
+// Size of the recorded video, the frames are scaled to it
+const recordWidth, recordHeight = 640, 480
+
+// Video recorded with F10. The frames and the audio are piped to ffmpeg,
+// or written to raw .rgba and .pcm files if ffmpeg isn't installed
+type recorder struct {
+	path   string
+	dumper *emulator.FrameDumper
+	files  []io.Closer // Closed when the recording stops
+	ffmpeg *exec.Cmd   // nil when writing raw files
+}
+
+func startRecording(id int64) (*recorder, error) {
+	rec := &recorder{}
+	var video, audio io.Writer
+
+	if _, err := exec.LookPath(*ffmpegPath); err == nil {
+		rec.path = fmt.Sprintf("video_%d.mkv", id)
+		audioRead, audioWrite, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+		rate := console.Status().RefreshRate
+		rec.ffmpeg = exec.Command(
+			*ffmpegPath, "-loglevel", "error", "-y",
+			"-f", "rawvideo", "-pixel_format", "rgba",
+			"-video_size", fmt.Sprintf("%dx%d", recordWidth, recordHeight),
+			"-framerate", fmt.Sprintf("%f", rate), "-i", "pipe:0",
+			"-f", "s16le", "-ar", fmt.Sprint(emulator.CD_SAMPLE_RATE), "-ac", "2", "-i", "pipe:3",
+			rec.path,
+		)
+		// the audio is read from file descriptor 3
+		rec.ffmpeg.ExtraFiles = []*os.File{audioRead}
+		rec.ffmpeg.Stderr = os.Stderr
+		stdin, err := rec.ffmpeg.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := rec.ffmpeg.Start(); err != nil {
+			return nil, err
+		}
+		audioRead.Close()
+		video, audio = stdin, audioWrite
+		rec.files = []io.Closer{stdin, audioWrite}
+	} else {
+		rec.path = fmt.Sprintf("video_%d.rgba", id)
+		videoFile, err := os.Create(rec.path)
+		if err != nil {
+			return nil, err
+		}
+		audioFile, err := os.Create(fmt.Sprintf("video_%d.pcm", id))
+		if err != nil {
+			videoFile.Close()
+			return nil, err
+		}
+		video, audio = videoFile, audioFile
+		rec.files = []io.Closer{videoFile, audioFile}
+	}
+
+	rec.dumper = emulator.NewFrameDumper(video, audio, recordWidth, recordHeight)
+	console.SetCapture(rec.dumper.WriteFrame)
+	console.SetAudioOutput(func(samples []int16) {
+		if audioOutput != nil {
+			audioOutput(samples)
+		}
+		rec.dumper.WriteAudio(samples)
+	})
+	return rec, nil
+}
+
+// Stops capturing and finishes the video file
+func (rec *recorder) stop() error {
+	console.SetCapture(nil)
+	console.SetAudioOutput(audioOutput)
+	// wait until the emulation goroutine doesn't write to the files anymore
+	console.Call(func() {})
+	for _, file := range rec.files {
+		file.Close()
+	}
+	if rec.ffmpeg != nil {
+		if err := rec.ffmpeg.Wait(); err != nil {
+			return err
+		}
+	}
+	return rec.dumper.Err
+}
+
+// Returns the slow motion speed after `speed`
+func nextSpeed(speed float64) float64 {
+	switch speed {
+	case emulator.SPEED_UNLIMITED:
+		return emulator.SPEED_SLOW_50
+	case emulator.SPEED_SLOW_50:
+		return emulator.SPEED_SLOW_25
+	default:
+		return emulator.SPEED_UNLIMITED
+	}
+}
+
 func (g *ebitenGame) handleConnectedGamepads() {
 	if g.gamepadIDs == nil {
 		g.gamepadIDs = map[ebiten.GamepadID]struct{}{}
@@ -103,10 +621,36 @@ func (g *ebitenGame) handleConnectedGamepads() {
 	}
 }
 
-func (g *ebitenGame) handleGamepadInput(pad *emulator.Gamepad) {
+// Returns the slot of port 1 that the host gamepad `id` controls, or -1 if
+// there's none. When a multitap is plugged in, each gamepad gets its own
+// slot
+func (g *ebitenGame) slotForGamepad(id ebiten.GamepadID) int {
+	if !*useMultitap {
+		return 0
+	}
+
+	// slot index is the amount of connected gamepads with a lower id
+	slot := 0
+	for other := range g.gamepadIDs {
+		if other < id {
+			slot++
+		}
+	}
+	if slot >= emulator.MULTITAP_SLOTS {
+		return -1
+	}
+	return slot
+}
+
+func (g *ebitenGame) handleGamepadInput() {
 	g.axes = map[ebiten.GamepadID][]float64{}
 
 	for id := range g.gamepadIDs {
+		slot := g.slotForGamepad(id)
+		if slot < 0 {
+			continue
+		}
+
 		maxAxis := ebiten.GamepadAxisCount(id)
 		for a := 0; a < maxAxis; a++ {
 			v := ebiten.GamepadAxisValue(id, a)
@@ -119,14 +663,116 @@ func (g *ebitenGame) handleGamepadInput(pad *emulator.Gamepad) {
 			// log button events
 			if inpututil.IsGamepadButtonJustPressed(id, b) {
 				fmt.Printf("main: button pressed: id: %d, button: %d\n", id, b)
-				pad.SetButtonState(buttonFromId(int(b)), emulator.BUTTON_STATE_PRESSED)
+				padInputs[0][slot].buttons.Set(buttonFromId(int(b)), emulator.BUTTON_STATE_PRESSED)
 			}
 			if inpututil.IsGamepadButtonJustReleased(id, b) {
 				fmt.Printf("main: button released: id: %d, button: %d\n", id, b)
-				pad.SetButtonState(buttonFromId(int(b)), emulator.BUTTON_STATE_RELEASED)
+				padInputs[0][slot].buttons.Set(buttonFromId(int(b)), emulator.BUTTON_STATE_RELEASED)
 			}
 		}
+
+		switch portDevices[0] {
+		case emulator.GAMEPAD_TYPE_NEGCON, emulator.GAMEPAD_TYPE_DUALSHOCK:
+			g.handleAnalogAxes(id, slot)
+		}
+	}
+	g.handleRumble()
+}
+
+// Sends the analog values of gamepad `id` to the controller in `slot` of
+// port 1. The sticks are the DualShock sticks. The left stick also twists
+// the neGcon, the right trigger is I, the left trigger is II and the left
+// shoulder is L. Values are only sent when they change, so the digital
+// buttons can still press I, II and L
+func (g *ebitenGame) handleAnalogAxes(id ebiten.GamepadID, slot int) {
+	var axes [emulator.AXIS_COUNT]uint8
+	if ebiten.IsStandardGamepadLayoutAvailable(id) {
+		sticks := map[emulator.Axis]ebiten.StandardGamepadAxis{
+			emulator.AXIS_LEFT_X:  ebiten.StandardGamepadAxisLeftStickHorizontal,
+			emulator.AXIS_LEFT_Y:  ebiten.StandardGamepadAxisLeftStickVertical,
+			emulator.AXIS_RIGHT_X: ebiten.StandardGamepadAxisRightStickHorizontal,
+			emulator.AXIS_RIGHT_Y: ebiten.StandardGamepadAxisRightStickVertical,
+		}
+		for axis, stick := range sticks {
+			axes[axis] = axisToByte(ebiten.StandardGamepadAxisValue(id, stick))
+		}
+		axes[emulator.AXIS_TWIST] = axes[emulator.AXIS_LEFT_X]
+		axes[emulator.AXIS_I] = buttonValueToByte(
+			ebiten.StandardGamepadButtonValue(id, ebiten.StandardGamepadButtonFrontBottomRight),
+		)
+		axes[emulator.AXIS_II] = buttonValueToByte(
+			ebiten.StandardGamepadButtonValue(id, ebiten.StandardGamepadButtonFrontBottomLeft),
+		)
+		axes[emulator.AXIS_L] = buttonValueToByte(
+			ebiten.StandardGamepadButtonValue(id, ebiten.StandardGamepadButtonFrontTopLeft),
+		)
+	} else if len(g.axes[id]) >= 2 {
+		// without a standard layout, only assume that the first axes are
+		// the left stick
+		axes[emulator.AXIS_LEFT_X] = axisToByte(g.axes[id][0])
+		axes[emulator.AXIS_LEFT_Y] = axisToByte(g.axes[id][1])
+		axes[emulator.AXIS_RIGHT_X] = emulator.DUALSHOCK_STICK_CENTER
+		axes[emulator.AXIS_RIGHT_Y] = emulator.DUALSHOCK_STICK_CENTER
+		axes[emulator.AXIS_TWIST] = axes[emulator.AXIS_LEFT_X]
+	} else {
+		return
+	}
+
+	padInputs[0][slot].axes = axes
+}
+
+// State of the DualShock motors, set on the emulation goroutine
+var rumble struct {
+	mu    sync.Mutex
+	small bool
+	large uint8
+}
+
+// Called on the emulation goroutine when the DualShock motors change
+func setRumble(small bool, large uint8) {
+	rumble.mu.Lock()
+	rumble.small = small
+	rumble.large = large
+	rumble.mu.Unlock()
+}
+
+// Forwards the DualShock motors to the host gamepads that control slot 0.
+// The vibration is refreshed regularly while a motor is on, so it stops
+// by itself when the game turns the motors off
+func (g *ebitenGame) handleRumble() {
+	rumble.mu.Lock()
+	small, large := rumble.small, rumble.large
+	rumble.mu.Unlock()
+	if (!small && large == 0) || time.Since(g.rumbleTime) < rumbleRefresh {
+		return
+	}
+	g.rumbleTime = time.Now()
+
+	op := &ebiten.VibrateGamepadOptions{
+		Duration:        rumbleRefresh * 3 / 2,
+		StrongMagnitude: float64(large) / 255,
+	}
+	if small {
+		op.WeakMagnitude = 1
 	}
+	for id := range g.gamepadIDs {
+		if g.slotForGamepad(id) == 0 {
+			ebiten.VibrateGamepad(id, op)
+		}
+	}
+}
+
+// How often the vibration of the host gamepads is refreshed
+const rumbleRefresh = 100 * time.Millisecond
+
+// Converts a stick axis from -1 to 1 to a value from 0 to 255
+func axisToByte(v float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, (v+1)*127.5)))
+}
+
+// Converts an analog button from 0 to 1 to a value from 0 to 255
+func buttonValueToByte(v float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, v*255)))
 }
 
 func buttonFromId(id int) emulator.Button {
@@ -164,29 +810,51 @@ func buttonFromId(id int) emulator.Button {
 }
 
 func (g *ebitenGame) Draw(screen *ebiten.Image) {
-	op := &ebiten.DrawImageOptions{}
-	op.Filter = ebiten.FilterLinear
+	g.presentFrame()
 
-	// scale rendered frame to fit window
-	fx := currentFrame.Bounds().Dx()
-	fy := currentFrame.Bounds().Dy()
-	scaleX := float64(width) / float64(fx)
-	scaleY := float64(height) / float64(fy)
-	op.GeoM.Scale(scaleX, scaleY)
+	if g.vram.open && console != nil {
+		g.vram.draw(screen)
+		return
+	}
 
-	wg.Wait()
-	screen.DrawImage(currentFrame, op)
+	drawFrame(screen)
 
 	if *showFps {
-		ebitenutil.DebugPrintAt(screen, fmt.Sprintf("%f fps", 1/frameDt), 8, 8)
+		fps := fmt.Sprintf("%f fps", 1/frameDt)
+		if console != nil {
+			// PAL games run at 50 FPS
+			fps += fmt.Sprintf(" (%.2f Hz)", console.Status().RefreshRate)
+		}
+		ebitenutil.DebugPrintAt(screen, fps, 8, 8)
 	}
-	if *showCycles {
+	if *showCycles && console != nil {
+		status := console.Status()
 		ebitenutil.DebugPrintAt(
 			screen,
-			fmt.Sprintf("%d cycles\npc: 0x%x", cpu.Th.Cycles, cpu.PC),
+			fmt.Sprintf("%d cycles\npc: 0x%x", status.Cycles, status.PC),
 			8, 24,
 		)
 	}
+	if console != nil {
+		status := console.Status()
+		if status.Paused {
+			ebitenutil.DebugPrintAt(screen, "paused (P: resume, O: next frame)", width-210, 8)
+		} else if status.Speed != emulator.SPEED_UNLIMITED {
+			ebitenutil.DebugPrintAt(screen, fmt.Sprintf("speed: %d%%", int(status.Speed*100)), width-80, 8)
+		}
+	}
+
+	if g.showGpuLog && gpuLogger != nil {
+		drawGpuLog(screen)
+	}
+	if *logOverlay {
+		drawLogOverlay(screen)
+	}
+	if console != nil {
+		g.drawOverlay(screen)
+	}
+	drawStateMessage(screen)
+	drawAchievementMessages(screen)
 
 	// draw error message if there was a panic
 	if didPanic {
@@ -194,116 +862,1220 @@ func (g *ebitenGame) Draw(screen *ebiten.Image) {
 	}
 }
 
-func (g *ebitenGame) Layout(insideWidth, insideHeight int) (int, int) {
-	return width, height
-}
-
-func (g *ebitenGame) drawFrame() {
-	wg.Add(1)
-	defer wg.Done()
-
-	// calculate delta time
-	frameDt = time.Since(prevFrameTime).Seconds()
-
-	// create renderer if it's nil
-	if g.renderer == nil {
-		g.renderer = gpu.NewEbitenRenderer()
+// F4 dumps the GPU commands of the last frame to a file, F6 shows them
+func (g *ebitenGame) handleGpuLogKeys() {
+	if inpututil.IsKeyJustPressed(ebiten.KeyF6) {
+		g.showGpuLog = !g.showGpuLog
+	}
+	if !inpututil.IsKeyJustPressed(ebiten.KeyF4) {
+		return
 	}
 
-	// clear previous frame and draw the new one
-	// FIXME: for some reason, the image is flickering after the GPU timings were implemented
-	currentFrame.Clear()
-	g.renderer.Draw(currentFrame)
+	_, frame := gpuLogger.Last()
+	path := fmt.Sprintf("gpu_frame_%d.txt", frame)
+	file, err := os.Create(path)
+	if err != nil {
+		fmt.Printf("main: couldn't dump GPU commands: %s\n", err)
+		return
+	}
+	defer file.Close()
 
-	prevFrameTime = time.Now()
+	if err := gpuLogger.Dump(file); err != nil {
+		fmt.Printf("main: couldn't dump GPU commands: %s\n", err)
+		return
+	}
+	fmt.Printf("main: dumped the GPU commands of frame %d to \"%s\"\n", frame, path)
 }
 
-func startEbitenWindow(g *ebitenGame) {
-	ebiten.SetWindowSize(width, height)
-	ebiten.SetWindowTitle("gopsx")
-	ebiten.SetTPS(ebiten.SyncWithFPS)
+// Draws the first GPU commands of the last frame
+func drawGpuLog(screen *ebiten.Image) {
+	const maxLines = 30
+	commands, frame := gpuLogger.Last()
 
-	if err := ebiten.RunGame(g); err != nil {
-		panic(err)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "frame %d: %d GPU commands (F4: dump to file)\n", frame, len(commands))
+	for i := range commands {
+		if i == maxLines {
+			fmt.Fprintf(&sb, "... %d more\n", len(commands)-maxLines)
+			break
+		}
+		sb.WriteString(commands[i].String())
+		sb.WriteByte('\n')
 	}
+	ebitenutil.DebugPrintAt(screen, sb.String(), 8, 48)
 }
 
-func main() {
-	// parse arguments
-	biosPath := flag.String("bios", "SCPH1001.BIN", "path to the BIOS file")
-	showFps = flag.Bool("fps", true, "show FPS value")
-	showCycles = flag.Bool("cycles", true, "show amount of CPU cycles")
-	doRecover = flag.Bool("recover", true, "recover from emulator panics")
-	discPath := flag.String("disc", "", "disc .BIN path")
-	nogui := flag.Bool(
-		"nogui", false,
-		"whether to run without the GUI (useful for debugging)",
-	)
-	flag.Parse()
+// Draws the enabled debug overlay panels with the stats of the last frame
+func (g *ebitenGame) drawOverlay(screen *ebiten.Image) {
+	stats := console.FrameStats()
+	var sb strings.Builder
 
-	if *discPath != "" {
-		// try to load disc
-		file, err := os.Open(*discPath)
-		if err != nil {
-			panic(err)
+	if g.overlay[overlayGpu] {
+		scan := "p"
+		if stats.Interlaced {
+			scan = "i"
 		}
-		defer file.Close()
-		disc, err = emulator.NewDisc(file)
-		if err != nil {
-			panic(err)
+		depth := 15
+		if stats.DisplayDepth == emulator.DISPLAY_DEPTH_24BITS {
+			depth = 24
 		}
-		fmt.Printf("main: disc region: %s\n", disc.RegionString())
+		fmt.Fprintf(
+			&sb, "GPU: %dx%d%s %s %d bit\ndraw calls: %d\n\n",
+			stats.Width, stats.Height, scan, stats.VMode, depth, stats.DrawCalls,
+		)
 	}
-
-	g := &ebitenGame{}
-	if !*nogui {
-		go startEmulator(g, *biosPath, *nogui)
-		startEbitenWindow(g)
-	} else {
-		// run on main thread
-		startEmulator(g, *biosPath, *nogui)
+	if g.overlay[overlayCdRom] {
+		command := emulator.CDROM_COMMAND_NAMES[stats.CdCommand]
+		if stats.CdCommandOn {
+			command += " (running)"
+		}
+		fmt.Fprintf(
+			&sb, "CD-ROM: %s %02d:%02d:%02d\ncommand: 0x%02x %s\n\n",
+			stats.CdState, stats.CdPosition.M, stats.CdPosition.S, stats.CdPosition.F,
+			stats.CdCommand, command,
+		)
+	}
+	if g.overlay[overlayDma] {
+		sb.WriteString("DMA words:\n")
+		for port, words := range stats.DmaWords {
+			fmt.Fprintf(&sb, "  %s: %d\n", dmaPortNames[port], words)
+		}
+		sb.WriteByte('\n')
+	}
+	if g.overlay[overlayIrq] {
+		sb.WriteString("IRQs:\n")
+		for irq, count := range stats.Irqs {
+			fmt.Fprintf(&sb, "  %s: %d\n", emulator.Interrupt(irq), count)
+		}
+		sb.WriteByte('\n')
+	}
+	if g.overlay[overlayProfile] && profiler != nil {
+		frame := profiler.Last()
+		fmt.Fprintf(&sb, "profile: %s\n", frame.Total.Round(time.Microsecond))
+		for i, duration := range frame.Time {
+			fmt.Fprintf(
+				&sb, "  %s: %s\n",
+				emulator.ProfileSection(i), duration.Round(time.Microsecond),
+			)
+		}
 	}
-}
-
-func startEmulator(g *ebitenGame, biosPath string, nogui bool) {
-	// start emulator
-	bios := loadBios(biosPath)
-	ram := emulator.NewRAM()
 
-	hardware := emulator.HARDWARE_NTSC
-	if disc != nil {
-		hardware = emulator.GetHardwareFromRegion(disc.Region)
+	if g.overlay[overlayAudio] {
+		sb.WriteString("audio:\n")
+		for channel := emulator.AudioChannel(0); channel < emulator.AUDIO_CHANNEL_COUNT; channel++ {
+			cursor := " "
+			if channel == audioChannel {
+				cursor = ">"
+			}
+			fmt.Fprintf(&sb, "%s %s: %d%%", cursor, channel, hostMixer.Volume(channel))
+			if hostMixer.Muted(channel) {
+				sb.WriteString(" (muted)")
+			}
+			sb.WriteByte('\n')
+		}
+		if voice := hostMixer.SoloVoice(); voice >= 0 {
+			fmt.Fprintf(&sb, "solo: voice %d\n", voice)
+		}
+		sb.WriteByte('\n')
 	}
-	gpu = emulator.NewGPU(hardware)
 
-	if !nogui {
-		gpu.SetFrameEnd(g.drawFrame)
+	if sb.Len() > 0 {
+		ebitenutil.DebugPrintAt(screen, sb.String(), width-220, 24)
+	}
+	if g.overlay[overlayHeatMap] && stats.HeatMap != nil {
+		g.drawHeatMap(screen, stats.HeatMap)
 	}
+}
 
-	inter := emulator.NewInterconnect(bios, ram, gpu, disc)
-	cpu = emulator.NewCPU(inter)
+// Draws the RAM heat map in the bottom right corner, a 4KB page per cell
+// and 128KB per row: red for CPU writes, green for CPU reads and blue for
+// DMA transfers
+func (g *ebitenGame) drawHeatMap(screen *ebiten.Image, heat *emulator.HeatMap) {
+	const cell = 6
+	replaceImage(&g.heatImage, heat.Image())
+	size := g.heatImage.Bounds().Size()
+	x, y := width-size.X*cell-8, height-size.Y*cell-8
+
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(cell, cell)
+	op.GeoM.Translate(float64(x), float64(y))
+	screen.DrawImage(g.heatImage, op)
+	ebitenutil.DebugPrintAt(screen, "RAM: write read DMA", x, y-16)
+}
+
+// With the audio panel open, Tab selects the next channel, [ and ] lower
+// and raise its volume, M mutes it and V plays the next SPU voice alone
+func handleAudioKeys() {
+	const step = 10
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyTab):
+		audioChannel = (audioChannel + 1) % emulator.AUDIO_CHANNEL_COUNT
+	case inpututil.IsKeyJustPressed(ebiten.KeyBracketLeft):
+		hostMixer.SetVolume(audioChannel, hostMixer.Volume(audioChannel)-step)
+	case inpututil.IsKeyJustPressed(ebiten.KeyBracketRight):
+		hostMixer.SetVolume(audioChannel, hostMixer.Volume(audioChannel)+step)
+	case inpututil.IsKeyJustPressed(ebiten.KeyM):
+		hostMixer.SetMuted(audioChannel, !hostMixer.Muted(audioChannel))
+	case inpututil.IsKeyJustPressed(ebiten.KeyV):
+		// past the last voice the solo is turned off
+		hostMixer.SetSoloVoice(hostMixer.SoloVoice() + 1)
+	}
+}
+
+// Prints the average frame profile and the slowest guest functions since
+// the start, F1 with -profile
+func dumpProfile() {
+	total := profiler.Total()
+	fmt.Printf("main: profile of the last %d frames:\n", total.Frames)
+	total.Dump(os.Stdout)
+
+	console.Call(func() {
+		debugger := console.Cpu.Debugger
+		fmt.Println("main: slowest functions:")
+		debugger.Functions.Dump(os.Stdout, debugger.Symbols, 20)
+	})
+}
+
+// Draws the last emulator log messages at the bottom of the screen
+func drawLogOverlay(screen *ebiten.Image) {
+	const lineHeight = 16
+	messages := emulator.Log.Recent()
+
+	var sb strings.Builder
+	for _, msg := range messages {
+		sb.WriteString(msg.String())
+		sb.WriteByte('\n')
+	}
+	ebitenutil.DebugPrintAt(screen, sb.String(), 8, height-8-len(messages)*lineHeight)
+}
+
+// Handles the VRAM viewer keys and mouse clicks
+func (v *vramViewer) update() {
+	if inpututil.IsKeyJustPressed(ebiten.KeyF2) {
+		v.open = !v.open
+	}
+	if !v.open {
+		return
+	}
+
+	// cycle between 15, 4 and 8 bit views
+	if inpututil.IsKeyJustPressed(ebiten.KeyF3) {
+		switch v.depth {
+		case emulator.TEXTURE_DEPTH_15BIT:
+			v.depth = emulator.TEXTURE_DEPTH_4BIT
+		case emulator.TEXTURE_DEPTH_4BIT:
+			v.depth = emulator.TEXTURE_DEPTH_8BIT
+		default:
+			v.depth = emulator.TEXTURE_DEPTH_15BIT
+		}
+	}
+
+	// pages and palettes are picked on the full VRAM view, which is
+	// displayed 1:1
+	x, y := ebiten.CursorPosition()
+	if v.depth != emulator.TEXTURE_DEPTH_15BIT ||
+		x < 0 || y < 0 || x >= emulator.VRAM_WIDTH_PIXELS || y >= emulator.VRAM_HEIGHT_PIXELS {
+		return
+	}
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		v.pageX = uint8(x / 64)
+		v.pageY = uint8(y / 256)
+	}
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonRight) {
+		// palettes are 16 halfword aligned
+		v.clutX = uint16(x) &^ 15
+		v.clutY = uint16(y)
+	}
+}
+
+// Draws the VRAM, or the selected texture page and palette
+func (v *vramViewer) draw(screen *ebiten.Image) {
+	var mode string
+	var vramImage, pageImage, clutImage *image.RGBA
+
+	// VRAM is read on the emulation goroutine
+	alive := console.Call(func() {
+		vram := gpu.VRam
+		if v.depth == emulator.TEXTURE_DEPTH_15BIT {
+			vramImage = vram.Image()
+		} else {
+			pageImage = vram.TexturePage(v.pageX, v.pageY, v.depth, v.clutX, v.clutY)
+			clutImage = vram.ClutImage(v.clutX, v.clutY, v.depth)
+		}
+	})
+	if !alive {
+		return
+	}
+
+	if v.depth == emulator.TEXTURE_DEPTH_15BIT {
+		mode = "15 bit VRAM"
+		replaceImage(&v.vramImage, vramImage)
+		screen.DrawImage(v.vramImage, nil)
+	} else {
+		mode = "4 bit page"
+		if v.depth == emulator.TEXTURE_DEPTH_8BIT {
+			mode = "8 bit page"
+		}
+
+		replaceImage(&v.pageImage, pageImage)
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Scale(2, 2)
+		screen.DrawImage(v.pageImage, op)
+
+		// palette inspector, one 16x16 square per color
+		replaceImage(&v.clutImage, clutImage)
+		op = &ebiten.DrawImageOptions{}
+		op.GeoM.Scale(16, 16)
+		op.GeoM.Translate(256*2+16, 64)
+		screen.DrawImage(v.clutImage, op)
+	}
+
+	ebitenutil.DebugPrintAt(screen, fmt.Sprintf(
+		"%s (F2: close, F3: switch view)\npage: %d,%d (left click)\npalette: %d,%d (right click)",
+		mode, v.pageX, v.pageY, v.clutX, v.clutY,
+	), 256*2+16, 8)
+}
+
+// Uploads `src` to `dst`, creating a new image if the size changed
+func replaceImage(dst **ebiten.Image, src *image.RGBA) {
+	size := src.Bounds().Size()
+	if *dst == nil || (*dst).Bounds().Size() != size {
+		if *dst != nil {
+			(*dst).Dispose()
+		}
+		*dst = ebiten.NewImage(size.X, size.Y)
+	}
+	(*dst).ReplacePixels(src.Pix)
+}
+
+// The screen has the size of the window, the frame is scaled in Draw
+func (g *ebitenGame) Layout(outsideWidth, outsideHeight int) (int, int) {
+	width, height = outsideWidth, outsideHeight
+	return width, height
+}
+
+// Draws the newest finished frame into currentFrame. If the emulator didn't
+// finish a frame since the last call, the previous one stays on screen
+func (g *ebitenGame) presentFrame() {
+	frame := frameQueue.Pop()
+	if frame == nil {
+		return
+	}
+	defer frameQueue.Release(frame)
+
+	// calculate delta time, several frames can finish between two draws
+	if frame.Number > prevFrameNum {
+		frameDt = time.Since(prevFrameTime).Seconds() / float64(frame.Number-prevFrameNum)
+	}
+	prevFrameTime = time.Now()
+	prevFrameNum = frame.Number
+	displayArea = frame.Display
+
+	// create renderer if it's nil
+	if g.renderer == nil {
+		g.renderer = renderer.NewEbitenRenderer()
+		g.renderer.Deinterlace = deinterlace
+		g.renderer.SubPixel = *pgxp
+		g.renderer.PerspectiveCorrect = *perspective
+	}
+
+	// clear previous frame and draw the new one
+	start := profiler.Start()
+	currentFrame.Clear()
+	g.renderer.Draw(currentFrame, frame)
+	profiler.Stop(emulator.PROFILE_RENDERER, start)
+}
+
+func startEbitenWindow(g *ebitenGame) {
+	ebiten.SetWindowSize(width, height)
+	ebiten.SetWindowResizingMode(ebiten.WindowResizingModeEnabled)
+	ebiten.SetWindowTitle("gopsx")
+	ebiten.SetFullscreen(*fullscreen)
+	ebiten.SetTPS(ebiten.SyncWithFPS)
+
+	if err := ebiten.RunGame(g); err != nil {
+		panic(err)
+	}
+}
+
+func main() {
+	runCommand(os.Args[1:])
+}
+
+// gopsx [run] [flags] [disc.cue|disc.bin ...]
+func runEmulator(args []string) error {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	flags.Usage = func() { usage(flags) }
+	biosPath := flags.String(
+		"bios", "SCPH1001.BIN",
+		"path to the BIOS file, or to a directory of BIOS files to pick the one matching the disc region",
+	)
+	showFps = flags.Bool("fps", true, "show FPS value")
+	showCycles = flags.Bool("cycles", true, "show amount of CPU cycles")
+	doRecover = flags.Bool("recover", true, "recover from emulator panics and write a crash dump")
+	crashTrace = flags.Int(
+		"crash-trace", emulator.TRACE_DEFAULT_SIZE,
+		"amount of executed instructions kept for the crash dumps, 0 turns tracing off",
+	)
+	symbolsPath = flags.String(
+		"symbols", "",
+		"symbol file of the running program (SN Systems .sym, .map or ELF), the functions are named in the crash dumps",
+	)
+	flags.Var(
+		&breakpoints, "break",
+		"stop with a crash dump when the instruction at this address or symbol runs, can be used multiple times",
+	)
+	var paths discPaths
+	flags.Var(
+		&paths, "disc",
+		"disc .bin or .cue path, can be used multiple times for multi-disc games (F5 switches discs)",
+	)
+	nogui := flags.Bool(
+		"nogui", false,
+		"whether to run without the GUI (useful for debugging)",
+	)
+	validation := flags.String(
+		"validate", "async",
+		"sector checksum validation: off, async (on a background worker) or sync",
+	)
+	hashDisc := flags.Bool(
+		"hashdisc", false,
+		"calculate the SHA-1 hash of the disc image in the background",
+	)
+	cheatsPath := flags.String(
+		"cheats", "",
+		"path to a cheat file (GameShark or ADDRESS=VALUE codes, \"[name]\" starts a cheat)",
+	)
+	cpuFlag := flags.String(
+		"cpu", "interpreter",
+		"CPU emulation mode: interpreter, cached (runs pre-decoded blocks) or jit (also skips most of the register copying for hot blocks)",
+	)
+	overclock := flags.Uint64(
+		"overclock", emulator.OVERCLOCK_MIN,
+		"CPU clock multiplier (1 to 4), reduces slowdown in games that drop frames",
+	)
+	widescreen := flags.Bool(
+		"widescreen", false,
+		"render 3D games with a 16:9 field of view and stretch the display to 16:9 (2D graphics are stretched too)",
+	)
+	pgxp = flags.Bool(
+		"pgxp", false,
+		"draw the 3D polygons with the sub-pixel vertex positions computed by the GTE, removes the polygon jitter",
+	)
+	dithering = flags.Bool(
+		"dithering", true,
+		"dither the shaded polygons of the screenshots and videos like the console, false gives smooth gradients",
+	)
+	perspective = flags.Bool(
+		"perspective", false,
+		"interpolate the colors of 3D polygons with perspective correction instead of affine mapping (enables -pgxp)",
+	)
+	audioLatency := flags.Duration(
+		"audio-latency", emulator.RESAMPLER_DEFAULT_LATENCY,
+		"amount of audio buffered before it's played, raise it if the audio crackles",
+	)
+	mute := flags.Bool(
+		"mute", false,
+		"don't play the CD audio",
+	)
+	reverb = flags.Bool(
+		"reverb", true,
+		"run the SPU reverb over the CD audio, turn it off to save time",
+	)
+	ffmpegPath = flags.String(
+		"ffmpeg", "ffmpeg",
+		"ffmpeg executable used to encode the videos recorded with F10",
+	)
+	deinterlaceFlag := flags.String(
+		"deinterlace", "weave",
+		"how 480i games are shown: weave (both fields, full resolution) or bob (only the current field, with the lines doubled)",
+	)
+	fastBoot = flags.Bool(
+		"fastboot", false,
+		"skip the BIOS intro when a disc is inserted and emulate common BIOS functions (putchar, memcpy, memset)",
+	)
+	showTty = flags.Bool(
+		"tty", false,
+		"print the text written with the BIOS putchar function (BIOS messages and printf debugging)",
+	)
+	biosDebug = flags.Bool(
+		"bios-debug", false,
+		"patch the BIOS to enable the kernel debug messages (known BIOS images only), use it with -tty",
+	)
+	cartPath = flags.String(
+		"cart", "",
+		"path to a parallel port cartridge ROM (Action Replay, Caetla...) to insert",
+	)
+	sio1Listen := flags.String(
+		"sio1-listen", "",
+		"listen for a serial (link cable) connection from another emulator on this TCP address, e.g. :7000",
+	)
+	sio1Connect := flags.String(
+		"sio1-connect", "",
+		"connect the serial port (link cable) to another emulator listening on this TCP address",
+	)
+	netplayHost := flags.String(
+		"netplay-host", "",
+		"host a netplay session on this TCP address (e.g. :7001) and wait for the other player, the host uses port 1",
+	)
+	netplayConnect := flags.String(
+		"netplay-connect", "",
+		"join a netplay session hosted on this TCP address, the client uses port 2",
+	)
+	netplayDelay := flags.Int(
+		"netplay-delay", emulator.NETPLAY_DEFAULT_DELAY,
+		"netplay input delay in frames, set by the host",
+	)
+	movieRecord := flags.String(
+		"movie-record", "",
+		"record the controller input of every frame to this movie file, starting from power-on or from -state (R rewinds to the last checkpoint)",
+	)
+	moviePlay := flags.String(
+		"movie-play", "",
+		"play back a movie recorded with -movie-record",
+	)
+	gpuLog := flags.Bool(
+		"gpulog", false,
+		"record the GPU commands of every frame, F6 shows the last frame and F4 dumps it to a file",
+	)
+	useMultitap = flags.Bool(
+		"multitap", false,
+		"plug a multitap adapter into port 1 (up to 4 controllers)",
+	)
+	port1 := flags.String(
+		"port1", "digital",
+		"device plugged into port 1 (digital, dualshock, guncon, mouse, negcon or none)",
+	)
+	port2 := flags.String(
+		"port2", "none",
+		"device plugged into port 2 (digital, dualshock, guncon, mouse, negcon or none)",
+	)
+	cdTimingFlag := flags.String(
+		"cd-timing", "default",
+		"CD-ROM drive timings, to debug games that are sensitive to them: default, flat (fixed seeks, no spin-up or jitter) or changes like seek=500000,spinup=0,jitter=0 (in CPU cycles)",
+	)
+	unmappedFlag := flags.String(
+		"unmapped", "bus-error",
+		"what happens when a game accesses an unmapped address: bus-error (like the hardware), ignore (log and carry on) or panic",
+	)
+	logLevels := flags.String(
+		"log", "",
+		"log levels (off, error, warn, info or debug) for every module or per module, e.g. warn,cdrom=debug (modules: cpu, gpu, cdrom, dma, pad, inter, net). Also read from GOPSX_LOG",
+	)
+	logFile := flags.String(
+		"log-file", "",
+		"write the emulator log to this file instead of the console",
+	)
+	logOverlay = flags.Bool(
+		"log-overlay", false,
+		"show the last emulator log messages on screen",
+	)
+	profile := flags.Bool(
+		"profile", false,
+		"measure the time spent in the CPU, GPU, CD-ROM, DMA and renderer every frame and the guest cycles spent in every function (5 shows it, F1 prints the average and the slowest functions)",
+	)
+	discordApp = flags.String(
+		"discord", "",
+		"ID of a Discord application, shows the game and the play time in the Discord status of the user (Rich Presence)",
+	)
+	raUser = flags.String(
+		"ra-user", "",
+		"RetroAchievements user name, unlocks the achievements of the game (softcore mode)",
+	)
+	raPassword = flags.String(
+		"ra-password", "",
+		"RetroAchievements password, also read from GOPSX_RA_PASSWORD",
+	)
+	heatMap = flags.Bool(
+		"heatmap", false,
+		"count the RAM accesses per 4KB page (6 shows the heat map of the last frame)",
+	)
+	regionFlag := flags.String(
+		"region", "auto",
+		"disc region: auto (from the license string), japan, north-america or europe, picks the BIOS and the video mode",
+	)
+	gameDbPath := flags.String(
+		"gamedb", "",
+		"path to a per-game settings file, its settings override the built-in database (the flags override both)",
+	)
+	stateDir = flags.String(
+		"states", "states",
+		"directory of the savestates (-/=: select the slot, .: save, ,: load)",
+	)
+	autoSave = flags.Bool(
+		"autosave", true,
+		"save the state to the auto-save slot on exit",
+	)
+	resumeState = flags.Bool(
+		"resume", false,
+		"continue from the auto-save of the game",
+	)
+	startState = flags.String(
+		"state", "",
+		"savestate to load at startup, e.g. the crash.state of a crash dump",
+	)
+	aspect := flags.String(
+		"aspect", "",
+		"aspect ratio of the picture: 4:3 (16:9 with -widescreen), any W:H, pixel for square pixels or stretch to fill the window",
+	)
+	integerScale = flags.Bool(
+		"integer-scale", false,
+		"scale the picture by whole numbers only",
+	)
+	filter := flags.String(
+		"filter", "linear",
+		"filter used to scale the picture: linear or nearest",
+	)
+	shader := flags.String(
+		"shader", "none",
+		"post-processing shader: none, scanlines, crt (curvature, scanlines and aperture grille) or ntsc (composite color bleeding)",
+	)
+	fullscreen = flags.Bool(
+		"fullscreen", false,
+		"start in fullscreen, F toggles it",
+	)
+	runAhead = flags.Int(
+		"runahead", 0,
+		"frames to run ahead to reduce the input lag (0-2), turned off if the emulation is too slow",
+	)
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	// discs can also be passed without -disc, e.g. gopsx run game.cue
+	paths = append(paths, flags.Args()...)
+	pickFiles(biosPath, &paths)
+
+	if *profile {
+		profiler = emulator.NewProfiler()
+	}
+
+	if err := emulator.Log.Configure(*logLevels); err != nil {
+		fatalf("-log: %s", err)
+	}
+	if *logFile != "" {
+		file, err := os.Create(*logFile)
+		if err != nil {
+			fatalf("%s", err)
+		}
+		defer file.Close()
+		emulator.Log.SetOutput(file)
+	}
+
+	for _, path := range paths {
+		d := openDisc(path, *validation, *hashDisc)
+		defer d.Close()
+		discs = append(discs, d)
+		discFiles = append(discFiles, path)
+	}
+	if len(discs) > 0 {
+		disc = discs[0]
+	}
+
+	if disc != nil {
+		applyGameSettings(flags, disc, *gameDbPath)
+	}
+
+	for i, device := range []string{*port1, *port2} {
+		switch device {
+		case "digital":
+			portDevices[i] = emulator.GAMEPAD_TYPE_DIGITAL
+		case "dualshock":
+			portDevices[i] = emulator.GAMEPAD_TYPE_DUALSHOCK
+		case "guncon":
+			portDevices[i] = emulator.GAMEPAD_TYPE_GUNCON
+		case "mouse":
+			portDevices[i] = emulator.GAMEPAD_TYPE_MOUSE
+		case "negcon":
+			portDevices[i] = emulator.GAMEPAD_TYPE_NEGCON
+		case "none":
+			portDevices[i] = emulator.GAMEPAD_TYPE_DISCONNECTED
+		default:
+			fatalf("unknown device \"%s\" for port %d", device, i+1)
+		}
+	}
+
+	switch *cpuFlag {
+	case "interpreter":
+		cpuMode = emulator.CPU_MODE_INTERPRETER
+	case "cached":
+		cpuMode = emulator.CPU_MODE_CACHED
+	case "jit":
+		cpuMode = emulator.CPU_MODE_JIT
+	default:
+		fatalf("unknown CPU mode \"%s\"", *cpuFlag)
+	}
+
+	if !*nogui && !*mute {
+		startAudio(*audioLatency)
+	}
+
+	if *perspective {
+		// the depth of the vertices comes from PGXP
+		*pgxp = true
+	}
+
+	switch *deinterlaceFlag {
+	case "weave":
+		deinterlace = emulator.DEINTERLACE_WEAVE
+	case "bob":
+		deinterlace = emulator.DEINTERLACE_BOB
+	default:
+		fatalf("unknown deinterlacing mode \"%s\"", *deinterlaceFlag)
+	}
+
+	switch *regionFlag {
+	case "auto":
+	case "japan":
+		setDiscRegion(emulator.REGION_JAPAN)
+	case "north-america":
+		setDiscRegion(emulator.REGION_NORTH_AMERICA)
+	case "europe":
+		setDiscRegion(emulator.REGION_EUROPE)
+	default:
+		fatalf("unknown region \"%s\"", *regionFlag)
+	}
+
+	switch *unmappedFlag {
+	case "bus-error":
+		unmapped = emulator.UNMAPPED_BUS_ERROR
+	case "ignore":
+		unmapped = emulator.UNMAPPED_IGNORE
+	case "panic":
+		unmapped = emulator.UNMAPPED_PANIC
+	default:
+		fatalf("unknown unmapped access mode \"%s\"", *unmappedFlag)
+	}
+
+	timings, err := emulator.ParseCdRomTimings(*cdTimingFlag)
+	if err != nil {
+		fatalf("%s", err)
+	}
+	cdTimings = timings
+
+	switch {
+	case *sio1Listen != "":
+		link, err := emulator.ListenSerialTcp(*sio1Listen)
+		if err != nil {
+			panic(err)
+		}
+		defer link.Close()
+		serialLink = link
+	case *sio1Connect != "":
+		link, err := emulator.DialSerialTcp(*sio1Connect)
+		if err != nil {
+			panic(err)
+		}
+		defer link.Close()
+		serialLink = link
+	}
+
+	switch {
+	case *netplayHost != "":
+		np, err := emulator.ListenNetplay(*netplayHost, *netplayDelay)
+		if err != nil {
+			panic(err)
+		}
+		defer np.Close()
+		netplay = np
+		netplayOn = true
+	case *netplayConnect != "":
+		np, err := emulator.DialNetplay(*netplayConnect)
+		if err != nil {
+			panic(err)
+		}
+		defer np.Close()
+		netplay = np
+		netplayOn = true
+	}
+	if netplay != nil {
+		netplay.OnDesync = func(frame uint64) {
+			fmt.Printf("main: netplay desync detected at frame %d\n", frame)
+		}
+	}
+
+	if *movieRecord != "" && *moviePlay != "" {
+		fatalf("-movie-record and -movie-play can't be used together")
+	}
+	moviePath = *movieRecord
+	defer saveMovie()
+
+	if *cheatsPath != "" {
+		cheats = loadCheats(*cheatsPath)
+	}
+
+	switch {
+	case *aspect != "":
+		ratio, err := parseAspect(*aspect)
+		if err != nil {
+			fatalf("-aspect: %s", err)
+		}
+		aspectRatio = ratio
+	case *widescreen:
+		// the frame is stretched from 4:3 to 16:9
+		aspectRatio = 16.0 / 9
+	}
+	if aspectRatio > 0 {
+		width = int(float64(height) * aspectRatio)
+	}
+	if err := setFrameFilter(*filter); err != nil {
+		fatalf("-filter: %s", err)
+	}
+	if err := setPostShader(*shader); err != nil {
+		fatalf("-shader: %s", err)
+	}
+
+	g := &ebitenGame{vram: vramViewer{depth: emulator.TEXTURE_DEPTH_15BIT}}
+	if !*nogui {
+		go startEmulator(g, *biosPath, *moviePlay, *nogui, *gpuLog, *overclock, *widescreen)
+		startEbitenWindow(g)
+		autoSaveState()
+	} else {
+		// run on main thread
+		startEmulator(g, *biosPath, *moviePlay, *nogui, *gpuLog, *overclock, *widescreen)
+	}
+	return nil
+}
+
+func startEmulator(
+	g *ebitenGame, biosPath, moviePlay string, nogui, gpuLog bool, overclock uint64, widescreen bool,
+) {
+	// start emulator
+	bios := loadBios(biosPath)
+	startMovie(bios, moviePlay)
+	patches := emulator.BiosPatchOptions{DebugOutput: *biosDebug}
+	if *fastBoot {
+		if disc != nil {
+			patches.SkipIntro = true
+		} else {
+			fmt.Println("main: not skipping the BIOS intro since there's no disc")
+		}
+	}
+	if err := bios.ApplyPatches(patches); err != nil {
+		fmt.Printf("main: %s\n", err)
+	}
+	ram := emulator.NewRAM()
+
+	hardware := emulator.HARDWARE_NTSC
+	if disc != nil {
+		hardware = emulator.GetHardwareFromRegion(disc.Region)
+	}
+	gpu = emulator.NewGPU(hardware)
+	gpu.NoDither = !*dithering
+
+	if !nogui {
+		gpu.FrameQueue = frameQueue
+	}
+	if gpuLog {
+		gpuLogger = emulator.NewGpuLogger()
+		gpu.Logger = gpuLogger
+	}
+
+	inter := emulator.NewInterconnect(bios, ram, gpu, disc)
+	inter.PadMemCard.Pad1 = emulator.NewGamepad(portDevices[0])
+	inter.PadMemCard.Pad2 = emulator.NewGamepad(portDevices[1])
+	if dualShock, ok := inter.PadMemCard.Pad1.Profile.(*emulator.DualShockProfile); ok {
+		dualShock.OnRumble = setRumble
+	}
+	if *useMultitap {
+		inter.PadMemCard.Pad1 = emulator.NewGamepad(emulator.GAMEPAD_TYPE_MULTITAP)
+	}
+	inter.Sio1.Link = serialLink
+	inter.Unmapped = unmapped
+	inter.CdRom.Timings = cdTimings
+	inter.Spu.Reverb = *reverb
+	inter.Profiler = profiler
+	if *heatMap {
+		inter.HeatMap = emulator.NewHeatMap()
+	}
+	inter.SetPgxp(*pgxp)
+	inter.CdRom.Mixer.SetOutput(audioOutput)
+	inter.CdRom.Mixer.SetHost(hostMixer)
+	if *cartPath != "" {
+		loadCartridge(inter.Expansion, *cartPath)
+	}
+	for _, cheat := range cheats {
+		inter.Cheats.Add(cheat)
+	}
+	if *raUser != "" && disc != nil {
+		startAchievements(inter, disc)
+	}
+	cpu := emulator.NewCPU(inter)
+	cpu.SetMode(cpuMode)
+	if err := cpu.Th.SetOverclock(overclock); err != nil {
+		fatalf("%s", err)
+	}
+	cpu.Gte.Widescreen = widescreen
+	if *doRecover && *crashTrace > 0 {
+		cpu.Debugger.Trace = emulator.NewTrace(*crashTrace)
+		cpu.Debugger.CallStack = emulator.NewCallStack()
+	}
+	if profiler != nil {
+		// the call stack names the functions without symbols
+		cpu.Debugger.Functions = emulator.NewFunctionProfiler()
+		if cpu.Debugger.CallStack == nil {
+			cpu.Debugger.CallStack = emulator.NewCallStack()
+		}
+	}
+	if *symbolsPath != "" {
+		cpu.Debugger.Symbols = loadSymbols(*symbolsPath)
+	}
+	for _, breakpoint := range breakpoints {
+		if err := cpu.Debugger.AddBreakpointSymbol(breakpoint); err != nil {
+			fatalf("-break: %s", err)
+		}
+	}
+	if *fastBoot {
+		cpu.Hle = emulator.NewBiosHle()
+	}
+	if *showTty {
+		cpu.Tty = func(c byte) {
+			os.Stdout.Write([]byte{c})
+		}
+		inter.Expansion.Tty = cpu.Tty
+	}
 
 	defer func() {
 		if *doRecover {
 			if r := recover(); r != nil {
-				fmt.Printf("\nrecovered from panic: %s\n\n%s\n", r, debug.Stack())
+				stack := debug.Stack()
+				fmt.Printf("\nrecovered from panic: %s\n\n%s\n", r, stack)
+				writeCrashDump(cpu, r, stack)
 				didPanic = true
 				panicString = fmt.Sprintf("recovered from panic:\n%s", r)
 			}
 		}
 	}()
 
-	for {
-		cpu.RunNextInstruction()
+	c := emulator.NewConsole(cpu)
+	c.Events.Subscribe(updateWindowTitle)
+	if *discordApp != "" {
+		startDiscord(*discordApp, c.Events)
+	}
+	if latchInput() {
+		// apply the latched input at the start of every frame
+		c.Latched = latchedPad
+		c.OnFrame = runLatchedInput
+	}
+	if *runAhead > 0 {
+		c.SetRunAhead(*runAhead)
+	}
+	if movie != nil {
+		c.SetDeterministic(true)
+	}
+	switch {
+	case netplay != nil:
+		// netplay starts from power-on
+	case movie != nil:
+		startMovieState(cpu, *startState)
+	case *startState != "":
+		loadStateFile(cpu, *startState)
+	case *resumeState:
+		loadStateFile(cpu, statePath(-1))
+	}
+	console = c
+	console.Run()
+}
+
+// Writes a crash dump (report and savestate) to crash_TIME.zip
+func writeCrashDump(cpu *emulator.CPU, reason interface{}, stack []byte) {
+	path := fmt.Sprintf("crash_%d.zip", time.Now().Unix())
+	file, err := os.Create(path)
+	if err != nil {
+		fmt.Printf("main: couldn't write the crash dump: %s\n", err)
+		return
+	}
+	defer file.Close()
+
+	if err := emulator.WriteCrashDump(file, cpu, reason, stack); err != nil {
+		fmt.Printf("main: couldn't write the crash dump: %s\n", err)
+		return
+	}
+	fmt.Printf("main: wrote a crash dump to \"%s\", attach it to bug reports\n", path)
+}
+
+// Returns true if the input is only applied at frame boundaries, so the
+// emulation stays deterministic
+func latchInput() bool {
+	return netplay != nil || movie != nil
+}
+
+// Applies the latched input for the next frame
+func runLatchedInput(c *emulator.Console) {
+	inter := c.Cpu.Inter
+	state := latchedPad.Profile.(*emulator.DigitalPadProfile).State
+	switch {
+	case netplay != nil:
+		if err := netplay.RunFrame(inter, state); err != nil {
+			fmt.Printf("main: netplay stopped: %s\n", err)
+			netplay.Close()
+			netplay = nil
+		}
+	case movie != nil:
+		if err := movie.Checkpoint(c.Cpu); err != nil {
+			fmt.Printf("main: couldn't save a movie checkpoint: %s\n", err)
+		}
+		movie.RunFrame(inter, emulator.MovieFrame{
+			Pad1: state,
+			Pad2: emulator.DIGITAL_PAD_RELEASED,
+		})
+	}
+}
+
+// Loads the movie passed with -movie-play, or starts recording a new one if
+// -movie-record was used
+func startMovie(bios *emulator.BIOS, playPath string) {
+	if playPath == "" {
+		if moviePath != "" {
+			movie = emulator.NewMovie(bios)
+			fmt.Printf("main: recording movie to \"%s\"\n", moviePath)
+		}
+		return
+	}
+
+	file, err := openFile(playPath)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+
+	movie, err = emulator.LoadMovie(file)
+	if err != nil {
+		fatalf("couldn't load movie \"%s\": %s", playPath, err)
+	}
+	if !movie.MatchesBios(bios) {
+		fmt.Println("main: the movie was recorded with a different BIOS, it will probably desync")
+	}
+	movie.OnEnd = func() {
+		fmt.Printf("main: movie finished after %d frames\n", len(movie.Frames))
+	}
+	fmt.Printf("main: playing movie \"%s\" (%d frames, %d rerecords)\n", playPath, len(movie.Frames), movie.Rerecords)
+}
+
+// Loads the savestate the movie starts from. A recorded movie starts from
+// `statePath` if it's set, or from power-on
+func startMovieState(cpu *emulator.CPU, statePath string) {
+	if movie.Mode == emulator.MOVIE_MODE_RECORD && statePath != "" {
+		data, err := os.ReadFile(statePath)
+		if err != nil {
+			fatalf("couldn't load the state: %s", err)
+		}
+		movie.State = data
+	}
+	if err := movie.Start(cpu); err != nil {
+		fatalf("couldn't start the movie: %s", err)
+	}
+	if movie.State != nil {
+		fmt.Println("main: the movie starts from a savestate")
+	}
+}
+
+// Goes back to the last movie checkpoint before the current frame and
+// records again from there
+func rewindMovie() {
+	if movie == nil || moviePath == "" {
+		return
+	}
+	var current uint64
+	console.Call(func() { current = movie.Frame })
+	if current > 0 {
+		current--
+	}
+	frame, err := console.RewindMovie(movie, current)
+	if err != nil {
+		fmt.Printf("main: couldn't rewind the movie: %s\n", err)
+		return
+	}
+	fmt.Printf("main: rewound the movie to frame %d (%d rerecords)\n", frame, movie.Rerecords)
+}
+
+// Saves the recorded movie, if there is one
+func saveMovie() {
+	if movie == nil || moviePath == "" {
+		return
+	}
+
+	file, err := os.Create(moviePath)
+	if err != nil {
+		fmt.Printf("main: couldn't save movie: %s\n", err)
+		return
+	}
+	defer file.Close()
+
+	if err := movie.Save(file); err != nil {
+		fmt.Printf("main: couldn't save movie: %s\n", err)
+		return
+	}
+	fmt.Printf("main: saved %d frames to \"%s\"\n", len(movie.Frames), moviePath)
+}
+
+// Loads a disc and exits with a message if it's not a valid disc image
+func openDisc(path, validation string, hash bool) *emulator.Disc {
+	disc, err := loadDisc(path)
+	var regionErr *emulator.ErrUnknownRegion
+	switch {
+	case errors.As(err, &regionErr):
+		fatalf("not a PlayStation disc (license string: \"%s\")", regionErr.License)
+	case errors.Is(err, emulator.ErrUnsupportedImageFormat):
+		fmt.Printf("main: %s\n", err)
+		fatalf("only raw .bin images and .cue sheets are supported")
+	case err != nil:
+		panic(err)
+	}
+	fmt.Printf("main: disc region: %s\n", disc.RegionString())
+	if id := disc.GameID(); id != "" {
+		fmt.Printf("main: game ID: %s\n", id)
+	}
+
+	switch validation {
+	case "off":
+		disc.Validation = emulator.SECTOR_VALIDATION_OFF
+	case "async":
+		disc.Validation = emulator.SECTOR_VALIDATION_ASYNC
+	case "sync":
+		disc.Validation = emulator.SECTOR_VALIDATION_SYNC
+	default:
+		panic(fmt.Sprintf("invalid sector validation mode \"%s\"", validation))
+	}
+
+	if hash {
+		disc.HashAsync(func(hash emulator.DiscHash, err error) {
+			if err != nil {
+				fmt.Printf("main: couldn't hash %s: %s\n", path, err)
+				return
+			}
+			fmt.Printf("main: %s SHA-1: %s\n", path, hash)
+		})
+	}
+	return disc
+}
+
+// Applies the settings of the game from the database to the flags that
+// weren't set on the command line
+func applyGameSettings(flags *flag.FlagSet, disc *emulator.Disc, dbPath string) {
+	db := emulator.DefaultGameDatabase()
+	if dbPath != "" {
+		file, err := openFile(dbPath)
+		if err != nil {
+			panic(err)
+		}
+		defer file.Close()
+		if err := db.Load(file); err != nil {
+			fatalf("%s", err)
+		}
+	}
+
+	game := db.Lookup(disc.GameID())
+	if disc.GameID() == "" || game == nil {
+		return
+	}
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	names := make([]string, 0, len(game.Settings))
+	for name := range game.Settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if set[name] {
+			continue
+		}
+		value := game.Settings[name]
+		if err := flags.Set(name, value); err != nil {
+			fatalf("%s: invalid setting %s = %s: %s", game.ID, name, value, err)
+		}
+		fmt.Printf("main: %s: %s = %s\n", game.ID, name, value)
+	}
+}
+
+// Overrides the region of every disc
+func setDiscRegion(region emulator.Region) {
+	for _, d := range discs {
+		d.Region = region
+	}
+	if len(discs) > 0 {
+		fmt.Printf("main: disc region overridden to %s\n", region)
+	}
+}
+
+// Loads a cheat file
+func loadCheats(path string) []*emulator.Cheat {
+	file, err := openFile(path)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+
+	cheats, err := emulator.ParseCheats(file)
+	if err != nil {
+		panic(err)
+	}
+	for _, cheat := range cheats {
+		fmt.Printf("main: loaded cheat \"%s\" (%d codes)\n", cheat.Name, len(cheat.Codes))
+	}
+	return cheats
+}
+
+// Loads a .sym, .map or ELF symbol file
+func loadSymbols(path string) *emulator.Symbols {
+	file, err := openFile(path)
+	if err != nil {
+		fatalf("%s", err)
+	}
+	defer file.Close()
+
+	symbols, err := emulator.LoadSymbols(file)
+	if err != nil {
+		fatalf("%s: %s", path, err)
+	}
+	fmt.Printf("main: loaded %d symbols from \"%s\"\n", symbols.Len(), path)
+	return symbols
+}
+
+// Loads a disc from a .bin or .cue file
+func loadDisc(path string) (*emulator.Disc, error) {
+	file, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.EqualFold(filepath.Ext(path), ".cue") {
+		return emulator.NewDisc(file)
+	}
+	defer file.Close()
+
+	// files in the cue sheet are relative to it
+	dir := filepath.Dir(path)
+	return emulator.NewDiscFromCue(file, func(name string) (io.ReadSeeker, error) {
+		return openFile(filepath.Join(dir, name))
+	})
+}
+
+func loadCartridge(exp *emulator.Expansion, path string) {
+	fmt.Printf("main: loading cartridge \"%s\"\n", path)
+	file, err := openFile(path)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+
+	if err := exp.LoadCartridge(file); err != nil {
+		fatalf("%s", err)
 	}
 }
 
 func loadBios(path string) *emulator.BIOS {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return selectBios(path)
+	}
+
 	fmt.Printf("main: loading bios \"%s\"\n", path)
 	start := time.Now()
 
 	// read bios
-	file, err := os.Open(path)
+	file, err := openFile(path)
 	if err != nil {
 		panic(err)
 	}
@@ -311,10 +2083,47 @@ func loadBios(path string) *emulator.BIOS {
 
 	// load bios
 	bios, err := emulator.LoadBIOS(file)
+	if errors.Is(err, emulator.ErrInvalidBIOSSize) {
+		fmt.Printf("main: %s\n", err)
+		fatalf("\"%s\" is not a PlayStation BIOS image", path)
+	}
 	if err != nil {
 		panic(err)
 	}
 
 	fmt.Printf("main: loaded bios in %s\n", time.Since(start))
+	printBiosInfo(bios.Info())
 	return bios
 }
+
+// Loads every BIOS in `dir` and picks the one matching the disc region
+func selectBios(dir string) *emulator.BIOS {
+	fmt.Printf("main: loading bioses from \"%s\"\n", dir)
+	manager := emulator.NewBiosManager()
+	if err := manager.LoadFS(os.DirFS(dir)); err != nil {
+		panic(err)
+	}
+
+	region := emulator.REGION_NORTH_AMERICA
+	if disc != nil {
+		region = disc.Region
+	}
+	entry := manager.Select(region)
+	if entry == nil {
+		fatalf("no BIOS images found in \"%s\"", dir)
+	}
+
+	fmt.Printf("main: using bios \"%s\"\n", entry.Path)
+	printBiosInfo(entry.Info)
+	if !entry.Info.HasRegion || entry.Info.Region != region {
+		fmt.Printf("main: no BIOS for the %s region, the game may not boot\n", region)
+	}
+	return entry.Bios
+}
+
+func printBiosInfo(info emulator.BiosInfo) {
+	fmt.Printf("main: bios is %s\n", info.String())
+	if !info.Known {
+		fmt.Printf("main: bios checksum 0x%08x doesn't match any known dump\n", info.Checksum)
+	}
+}
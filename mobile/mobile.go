@@ -0,0 +1,307 @@
+// Package mobile exposes the emulator to Android and iOS apps, build it with
+// `gomobile bind ./mobile`. gomobile only supports a few types in the
+// bound API, so the frames and the audio are passed as byte slices, the
+// buttons and the controllers are ints and the console is driven through
+// Emulator instead of emulator.Console
+package mobile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/zeozeozeo/gopsx/emulator"
+)
+
+// Buttons, for Emulator.SetButton and TouchLayout.Add
+const (
+	ButtonSelect   = int(emulator.BUTTON_SELECT)
+	ButtonStart    = int(emulator.BUTTON_START)
+	ButtonUp       = int(emulator.BUTTON_DUP)
+	ButtonRight    = int(emulator.BUTTON_DRIGHT)
+	ButtonDown     = int(emulator.BUTTON_DDOWN)
+	ButtonLeft     = int(emulator.BUTTON_DLEFT)
+	ButtonL2       = int(emulator.BUTTON_L2)
+	ButtonR2       = int(emulator.BUTTON_R2)
+	ButtonL1       = int(emulator.BUTTON_L1)
+	ButtonR1       = int(emulator.BUTTON_R1)
+	ButtonTriangle = int(emulator.BUTTON_TRIANGLE)
+	ButtonCircle   = int(emulator.BUTTON_CIRCLE)
+	ButtonCross    = int(emulator.BUTTON_CROSS)
+	ButtonSquare   = int(emulator.BUTTON_SQUARE)
+)
+
+// Analog axes, for Emulator.SetAxis
+const (
+	AxisLeftX  = int(emulator.AXIS_LEFT_X)
+	AxisLeftY  = int(emulator.AXIS_LEFT_Y)
+	AxisRightX = int(emulator.AXIS_RIGHT_X)
+	AxisRightY = int(emulator.AXIS_RIGHT_Y)
+)
+
+// Controllers, for Config.Port1 and Config.Port2
+const (
+	ControllerNone      = int(emulator.GAMEPAD_TYPE_DISCONNECTED)
+	ControllerDigital   = int(emulator.GAMEPAD_TYPE_DIGITAL)
+	ControllerDualShock = int(emulator.GAMEPAD_TYPE_DUALSHOCK)
+)
+
+// Audio sample rate, the samples are interleaved 16 bit stereo
+const SampleRate = emulator.CD_SAMPLE_RATE
+
+// Receives the frames and the audio of the emulator, implemented by the
+// app. Both are called on the emulation goroutine, so they shouldn't block
+// for long
+type Output interface {
+	// Receives the picture of a frame, `width`*`height` RGBA pixels. The
+	// slice is reused after the call returns
+	DrawFrame(pixels []byte, width, height int)
+	// Receives interleaved 16 bit little endian stereo samples at
+	// SampleRate. The slice is reused after the call returns
+	PlayAudio(samples []byte)
+}
+
+// Settings of a new Emulator
+type Config struct {
+	BIOS []byte // Contents of the BIOS image, required
+	// Path of the disc image (.bin or .cue), empty to boot the BIOS menu
+	DiscPath string
+	Port1    int // Controller plugged into port 1, ControllerDigital by default
+	Port2    int // Controller plugged into port 2, ControllerNone by default
+}
+
+// Returns the default settings, the BIOS still has to be set
+func NewConfig() *Config {
+	return &Config{Port1: ControllerDigital, Port2: ControllerNone}
+}
+
+// A console and the state of its controllers
+type Emulator struct {
+	console *emulator.Console
+	disc    *emulator.Disc
+	output  Output
+	pixels  []byte // Reused frame buffer, see drawFrame
+	audio   []byte // Reused audio buffer
+
+	mu    sync.Mutex
+	input [2]portInput
+	touch *TouchLayout
+}
+
+// Buttons and axes of a controller, and the buttons held through the touch
+// layout
+type portInput struct {
+	buttons emulator.ButtonsState
+	touched emulator.ButtonsState
+	axes    [emulator.AXIS_COUNT]uint8
+}
+
+// Returns an emulator ready to Start
+func NewEmulator(config *Config, output Output) (*Emulator, error) {
+	bios, err := emulator.LoadBIOSFromData(config.BIOS)
+	if err != nil {
+		return nil, err
+	}
+	e := &Emulator{output: output, touch: NewTouchLayout()}
+	for i := range e.input {
+		e.input[i].axes = emulator.CenteredAxes()
+	}
+
+	if config.DiscPath != "" {
+		e.disc, err = loadDisc(config.DiscPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, port := range []int{config.Port1, config.Port2} {
+		if port != ControllerNone && port != ControllerDigital && port != ControllerDualShock {
+			return nil, fmt.Errorf("unsupported controller %d", port)
+		}
+	}
+
+	e.console, err = emulator.New(emulator.Config{
+		BIOS: bios,
+		Disc: e.disc,
+		Controllers: [2]emulator.GamepadType{
+			emulator.GamepadType(config.Port1), emulator.GamepadType(config.Port2),
+		},
+		Audio: audioSink{e},
+	})
+	if err != nil {
+		return nil, err
+	}
+	e.console.SetCapture(e.drawFrame)
+	return e, nil
+}
+
+// Loads a .bin image or a .cue sheet
+func loadDisc(path string) (*emulator.Disc, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(filepath.Ext(path), ".cue") {
+		return emulator.NewDisc(file)
+	}
+	defer file.Close()
+
+	// files in the cue sheet are relative to it
+	dir := filepath.Dir(path)
+	return emulator.NewDiscFromCue(file, func(name string) (io.ReadSeeker, error) {
+		return os.Open(filepath.Join(dir, name))
+	})
+}
+
+// Starts the emulation on its own goroutine
+func (e *Emulator) Start() {
+	go e.console.Run()
+}
+
+// Stops the emulation and closes the disc. The emulator can't be started
+// again
+func (e *Emulator) Stop() {
+	e.console.Stop()
+	<-e.console.Done()
+	if e.disc != nil {
+		e.disc.Close()
+	}
+}
+
+// Pauses the emulation, e.g. when the app goes to the background
+func (e *Emulator) Pause() {
+	e.console.Pause()
+}
+
+// Resumes the emulation after Pause
+func (e *Emulator) Resume() {
+	e.console.Resume()
+}
+
+// Restarts the console, see emulator.Console.Reset
+func (e *Emulator) Reset(hard bool) {
+	e.console.Reset(hard)
+}
+
+// Returns the amount of frames output by the GPU
+func (e *Emulator) Frames() int64 {
+	return int64(e.console.Status().Frames)
+}
+
+// Returns a savestate of the console, see emulator.WriteSaveState
+func (e *Emulator) SaveState() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := e.console.SaveState(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Loads a savestate returned by SaveState
+func (e *Emulator) LoadState(state []byte) error {
+	_, err := e.console.LoadState(bytes.NewReader(state))
+	return err
+}
+
+// Presses or releases a button of the controller in `port` (0 or 1)
+func (e *Emulator) SetButton(port, button int, pressed bool) {
+	state := emulator.BUTTON_STATE_RELEASED
+	if pressed {
+		state = emulator.BUTTON_STATE_PRESSED
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if port < 0 || port > 1 {
+		return
+	}
+	e.input[port].buttons.Set(emulator.Button(button), state)
+	e.sendInput(port)
+}
+
+// Sets an analog axis of the DualShock in `port` (0 or 1), from 0 to 255.
+// The sticks are centered at 128
+func (e *Emulator) SetAxis(port, axis, value int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if port < 0 || port > 1 || axis < 0 || axis >= int(emulator.AXIS_COUNT) {
+		return
+	}
+	e.input[port].axes[axis] = uint8(value)
+	e.sendInput(port)
+}
+
+// Returns the touch layout of the controller in port 1
+func (e *Emulator) Touch() *TouchLayout {
+	return e.touch
+}
+
+// A finger touched the screen or moved, `x` and `y` go from 0 to 1. The
+// buttons under the finger are pressed on the controller in port 1, see
+// TouchLayout
+func (e *Emulator) TouchMove(id int, x, y float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.touch.move(id, x, y)
+	e.updateTouch()
+}
+
+// A finger left the screen
+func (e *Emulator) TouchEnd(id int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.touch.end(id)
+	e.updateTouch()
+}
+
+func (e *Emulator) updateTouch() {
+	if held := e.touch.held(); held != e.input[0].touched {
+		e.input[0].touched = held
+		e.sendInput(0)
+	}
+}
+
+// Sends the input of `port` to the console, called with the lock held
+func (e *Emulator) sendInput(port int) {
+	input := e.input[port]
+	target := emulator.TARGET_PADMEMCARD1
+	if port == 1 {
+		target = emulator.TARGET_PADMEMCARD2
+	}
+	e.console.SetInput(target, 0, input.buttons|input.touched, input.axes)
+}
+
+// Sends a frame to the output, see emulator.FrameCapture
+func (e *Emulator) drawFrame(img *image.RGBA) {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	if img.Stride == width*4 {
+		e.output.DrawFrame(img.Pix[:width*height*4], width, height)
+		return
+	}
+	// the rows aren't contiguous
+	e.pixels = e.pixels[:0]
+	for y := 0; y < height; y++ {
+		row := img.Pix[y*img.Stride:]
+		e.pixels = append(e.pixels, row[:width*4]...)
+	}
+	e.output.DrawFrame(e.pixels, width, height)
+}
+
+// Sends the audio of the console to the output of the emulator. Kept out
+// of Emulator, gomobile can't bind []int16
+type audioSink struct {
+	e *Emulator
+}
+
+func (sink audioSink) PlaySamples(samples []int16) {
+	e := sink.e
+	e.audio = e.audio[:0]
+	for _, sample := range samples {
+		e.audio = binary.LittleEndian.AppendUint16(e.audio, uint16(sample))
+	}
+	e.output.PlayAudio(e.audio)
+}
@@ -0,0 +1,125 @@
+package mobile
+
+import (
+	"sync"
+
+	"github.com/zeozeozeo/gopsx/emulator"
+)
+
+// Maps the fingers on the screen to the buttons of a controller. The
+// buttons are rectangles in screen coordinates that go from 0 to 1, a
+// finger presses every button it's on, so overlapping buttons (like the
+// diagonals of the D-pad) are pressed together. Sliding a finger from a
+// button to another releases the first one
+type TouchLayout struct {
+	mu      sync.Mutex
+	buttons []touchButton
+	touches map[int]touchPoint // Fingers on the screen, by ID
+}
+
+// A button of the touch layout
+type touchButton struct {
+	button     emulator.Button
+	x, y, w, h float64
+}
+
+type touchPoint struct {
+	x, y float64
+}
+
+// Returns the default layout for a landscape screen: the D-pad on the left,
+// the face buttons on the right, the shoulder buttons in the top corners
+// and Select and Start at the bottom
+func NewTouchLayout() *TouchLayout {
+	layout := &TouchLayout{}
+	// D-pad, the corners press two directions
+	layout.Add(ButtonUp, 0.05, 0.45, 0.2, 0.13)
+	layout.Add(ButtonDown, 0.05, 0.72, 0.2, 0.13)
+	layout.Add(ButtonLeft, 0.05, 0.45, 0.07, 0.4)
+	layout.Add(ButtonRight, 0.18, 0.45, 0.07, 0.4)
+	// face buttons
+	layout.Add(ButtonTriangle, 0.82, 0.45, 0.06, 0.12)
+	layout.Add(ButtonSquare, 0.75, 0.59, 0.06, 0.12)
+	layout.Add(ButtonCircle, 0.89, 0.59, 0.06, 0.12)
+	layout.Add(ButtonCross, 0.82, 0.73, 0.06, 0.12)
+	// shoulder buttons
+	layout.Add(ButtonL2, 0, 0, 0.12, 0.1)
+	layout.Add(ButtonL1, 0, 0.12, 0.12, 0.1)
+	layout.Add(ButtonR2, 0.88, 0, 0.12, 0.1)
+	layout.Add(ButtonR1, 0.88, 0.12, 0.12, 0.1)
+	// Select and Start
+	layout.Add(ButtonSelect, 0.38, 0.9, 0.1, 0.08)
+	layout.Add(ButtonStart, 0.52, 0.9, 0.1, 0.08)
+	return layout
+}
+
+// Adds a button to the layout, the rectangle starts at (`x`, `y`) and is
+// `w` wide and `h` tall
+func (layout *TouchLayout) Add(button int, x, y, w, h float64) {
+	layout.mu.Lock()
+	defer layout.mu.Unlock()
+	layout.buttons = append(layout.buttons, touchButton{emulator.Button(button), x, y, w, h})
+}
+
+// Removes every button, to build a new layout with Add
+func (layout *TouchLayout) Clear() {
+	layout.mu.Lock()
+	defer layout.mu.Unlock()
+	layout.buttons = nil
+}
+
+// Returns the amount of buttons in the layout
+func (layout *TouchLayout) Len() int {
+	layout.mu.Lock()
+	defer layout.mu.Unlock()
+	return len(layout.buttons)
+}
+
+// A button of a TouchLayout, see TouchLayout.Get
+type TouchButton struct {
+	Button     int
+	X, Y, W, H float64
+}
+
+// Returns the button at `index` and its rectangle, to draw the layout
+func (layout *TouchLayout) Get(index int) *TouchButton {
+	layout.mu.Lock()
+	defer layout.mu.Unlock()
+	if index < 0 || index >= len(layout.buttons) {
+		return nil
+	}
+	b := layout.buttons[index]
+	return &TouchButton{Button: int(b.button), X: b.x, Y: b.y, W: b.w, H: b.h}
+}
+
+// Moves the finger `id` to (`x`, `y`), or puts it on the screen
+func (layout *TouchLayout) move(id int, x, y float64) {
+	layout.mu.Lock()
+	defer layout.mu.Unlock()
+	if layout.touches == nil {
+		layout.touches = map[int]touchPoint{}
+	}
+	layout.touches[id] = touchPoint{x, y}
+}
+
+// Lifts the finger `id`
+func (layout *TouchLayout) end(id int) {
+	layout.mu.Lock()
+	defer layout.mu.Unlock()
+	delete(layout.touches, id)
+}
+
+// Returns the buttons under the fingers
+func (layout *TouchLayout) held() emulator.ButtonsState {
+	layout.mu.Lock()
+	defer layout.mu.Unlock()
+	var held emulator.ButtonsState
+	for _, touch := range layout.touches {
+		for _, b := range layout.buttons {
+			if touch.x >= b.x && touch.x < b.x+b.w && touch.y >= b.y && touch.y < b.y+b.h {
+				held.Set(b.button, emulator.BUTTON_STATE_PRESSED)
+			}
+		}
+	}
+	return held
+}
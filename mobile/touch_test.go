@@ -0,0 +1,35 @@
+package mobile
+
+import (
+	"testing"
+
+	"github.com/zeozeozeo/gopsx/emulator"
+)
+
+func TestTouchLayout(t *testing.T) {
+	layout := &TouchLayout{}
+	layout.Add(ButtonUp, 0, 0, 0.3, 0.1)
+	layout.Add(ButtonLeft, 0, 0, 0.1, 0.3)
+	layout.Add(ButtonCross, 0.8, 0.8, 0.1, 0.1)
+
+	// the corner presses both directions
+	layout.move(0, 0.05, 0.05)
+	held := layout.held()
+	if !held.Pressed(emulator.BUTTON_DUP) || !held.Pressed(emulator.BUTTON_DLEFT) {
+		t.Errorf("expected Up and Left, got %016b", held)
+	}
+
+	// sliding releases Left, a second finger presses Cross
+	layout.move(0, 0.2, 0.05)
+	layout.move(1, 0.85, 0.85)
+	held = layout.held()
+	if !held.Pressed(emulator.BUTTON_DUP) || held.Pressed(emulator.BUTTON_DLEFT) || !held.Pressed(emulator.BUTTON_CROSS) {
+		t.Errorf("expected Up and Cross, got %016b", held)
+	}
+
+	layout.end(0)
+	layout.end(1)
+	if held := layout.held(); held != 0 {
+		t.Errorf("expected no buttons, got %016b", held)
+	}
+}
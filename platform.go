@@ -0,0 +1,27 @@
+//go:build !js
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// True when running in a web browser, see platform.js.go
+const browser = false
+
+// Opens a file passed on the command line (BIOS, disc, cheats...)
+func openFile(path string) (io.ReadSeekCloser, error) {
+	return os.Open(path)
+}
+
+// Prints an error and exits
+func fatalf(format string, args ...interface{}) {
+	fmt.Printf("main: "+format+"\n", args...)
+	os.Exit(1)
+}
+
+// The BIOS and the discs are passed on the command line, there's nothing to
+// pick
+func pickFiles(biosPath *string, paths *discPaths) {}
@@ -0,0 +1,152 @@
+//go:build js
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"syscall/js"
+
+	"github.com/zeozeozeo/gopsx/emulator"
+)
+
+// True when running in a web browser. There's no file system, the BIOS and
+// the discs are picked by the user and kept in memory
+const browser = true
+
+// Contents of the files picked by the user, by name
+var pickedFiles = map[string][]byte{}
+
+// A picked file
+type memFile struct {
+	*bytes.Reader
+}
+
+func (memFile) Close() error {
+	return nil
+}
+
+// Opens a file picked by the user. Only the name of `name` is used, so the
+// tracks of a cue sheet are found next to it
+func openFile(name string) (io.ReadSeekCloser, error) {
+	data, ok := pickedFiles[path.Base(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return memFile{bytes.NewReader(data)}, nil
+}
+
+// Prints an error, shows it in an alert box and exits
+func fatalf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	fmt.Printf("main: %s\n", msg)
+	js.Global().Call("alert", "gopsx: "+msg)
+	os.Exit(1)
+}
+
+// Shows file inputs for the BIOS and the discs and waits for the user to
+// press Start. The picked files are read into memory, `biosPath` and
+// `paths` are set to their names. A disc can be a .bin image, or a .cue
+// sheet picked together with its tracks
+func pickFiles(biosPath *string, paths *discPaths) {
+	doc := js.Global().Get("document")
+	form := doc.Call("createElement", "div")
+	form.Set("id", "gopsx-picker")
+	form.Set("innerHTML", `
+		<p><label>BIOS: <input type="file" id="gopsx-bios"></label></p>
+		<p><label>Disc (.bin, or .cue and its tracks): <input type="file" id="gopsx-discs" multiple></label></p>
+		<p><button id="gopsx-start">Start</button></p>`)
+	doc.Get("body").Call("appendChild", form)
+	defer form.Call("remove")
+
+	start := make(chan struct{})
+	button := doc.Call("getElementById", "gopsx-start")
+	onClick := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		button.Set("disabled", true)
+		close(start)
+		return nil
+	})
+	defer onClick.Release()
+	button.Call("addEventListener", "click", onClick, map[string]interface{}{"once": true})
+	<-start
+
+	bios := doc.Call("getElementById", "gopsx-bios").Get("files")
+	if bios.Length() == 0 {
+		fatalf("no BIOS picked")
+	}
+	name, err := readPickedFile(bios.Index(0))
+	if err != nil {
+		fatalf("couldn't read the BIOS: %s", err)
+	}
+	*biosPath = name
+
+	var images, cues []string
+	files := doc.Call("getElementById", "gopsx-discs").Get("files")
+	for i := 0; i < files.Length(); i++ {
+		name, err := readPickedFile(files.Index(i))
+		if err != nil {
+			fatalf("couldn't read the disc: %s", err)
+		}
+		if strings.EqualFold(path.Ext(name), ".cue") {
+			cues = append(cues, name)
+		} else {
+			images = append(images, name)
+		}
+	}
+	// the .bin files are the tracks of the cue sheets if there are any
+	if len(cues) > 0 {
+		*paths = append(*paths, cues...)
+	} else {
+		*paths = append(*paths, images...)
+	}
+}
+
+// Reads a File object from a file input into pickedFiles and returns its
+// name
+func readPickedFile(file js.Value) (string, error) {
+	buf, err := await(file.Call("arrayBuffer"))
+	if err != nil {
+		return "", err
+	}
+	data := make([]byte, buf.Get("byteLength").Int())
+	js.CopyBytesToGo(data, js.Global().Get("Uint8Array").New(buf))
+
+	name := file.Get("name").String()
+	pickedFiles[name] = data
+	fmt.Printf("main: picked \"%s\" (%d bytes)\n", name, len(data))
+	return name, nil
+}
+
+// Waits for a promise to settle
+func await(promise js.Value) (js.Value, error) {
+	var value js.Value
+	var err error
+	done := make(chan struct{})
+	onResolve := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		value = args[0]
+		close(done)
+		return nil
+	})
+	defer onResolve.Release()
+	onReject := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		err = errors.New(args[0].Call("toString").String())
+		close(done)
+		return nil
+	})
+	defer onReject.Release()
+
+	promise.Call("then", onResolve, onReject)
+	<-done
+	return value, err
+}
+
+// There's no Discord client to talk to in a web browser
+func startDiscord(appID string, events *emulator.EventBus) {
+	fmt.Println("main: Discord Rich Presence isn't available in the browser")
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"image"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Post-processing shaders, named after their file
+//
+//go:embed shaders/*.kage
+var shaderFiles embed.FS
+
+var (
+	frameFilter = ebiten.FilterLinear // Filter used to scale the frame
+	postShader  *ebiten.Shader        // Post-processing shader, nil for none
+	// The scaled frame, drawn to the screen with postShader
+	postImage *ebiten.Image
+)
+
+// Sets the filter used to scale the frame: "linear" or "nearest"
+func setFrameFilter(name string) error {
+	switch name {
+	case "linear":
+		frameFilter = ebiten.FilterLinear
+	case "nearest":
+		frameFilter = ebiten.FilterNearest
+	default:
+		return fmt.Errorf("unknown filter \"%s\"", name)
+	}
+	return nil
+}
+
+// Loads the post-processing shader `name` (scanlines, crt or ntsc), "none"
+// turns post-processing off
+func setPostShader(name string) error {
+	if name == "none" {
+		postShader = nil
+		return nil
+	}
+	src, err := shaderFiles.ReadFile("shaders/" + name + ".kage")
+	if err != nil {
+		return fmt.Errorf("unknown shader \"%s\"", name)
+	}
+	shader, err := ebiten.NewShader(src)
+	if err != nil {
+		return fmt.Errorf("shader %s: %w", name, err)
+	}
+	postShader = shader
+	return nil
+}
+
+// Draws `src`, a part of currentFrame, to the `dst` rectangle of the screen
+// through postShader. The frame is scaled first, the shader works on the
+// pixels of the screen
+func drawPostProcessed(screen *ebiten.Image, src, dst image.Rectangle) {
+	size := dst.Size()
+	if postImage == nil || postImage.Bounds().Size() != size {
+		if postImage != nil {
+			postImage.Dispose()
+		}
+		postImage = ebiten.NewImage(size.X, size.Y)
+	}
+
+	op := &ebiten.DrawImageOptions{}
+	op.Filter = frameFilter
+	op.GeoM.Scale(float64(size.X)/float64(src.Dx()), float64(size.Y)/float64(src.Dy()))
+	postImage.Clear()
+	postImage.DrawImage(currentFrame.SubImage(src).(*ebiten.Image), op)
+
+	shaderOp := &ebiten.DrawRectShaderOptions{}
+	shaderOp.GeoM.Translate(float64(dst.Min.X), float64(dst.Min.Y))
+	shaderOp.Images[0] = postImage
+	shaderOp.Uniforms = map[string]interface{}{
+		"SourceSize": []float32{float32(src.Dx()), float32(src.Dy())},
+	}
+	screen.DrawRectShader(size.X, size.Y, postShader, shaderOp)
+}
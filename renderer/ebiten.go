@@ -0,0 +1,174 @@
+// Package renderer draws the frames of the emulator with Ebitengine. It's
+// kept out of the emulator package, so programs that only need the
+// emulator core don't depend on Ebitengine.
+//
+// VRAM stays on the CPU side: the GP0 primitives are rasterized by the
+// emulator and the renderer only uploads the frames. A backend that keeps
+// VRAM in a storage buffer and runs the primitives in compute shaders
+// can't be built on Ebitengine, which only has fragment shaders (Kage) and
+// no storage buffers or direct Vulkan access. It would need its own
+// graphics library and window, outside of this package
+package renderer
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/zeozeozeo/gopsx/emulator"
+)
+
+var emptyImage = ebiten.NewImage(2, 2)
+
+func init() {
+	emptyImage.Fill(color.RGBA{255, 255, 255, 255})
+}
+
+// Draws the frames of the emulator, see emulator.FrameQueue
+type EbitenRenderer struct {
+	Deinterlace emulator.DeinterlaceMode
+	// Use the sub-pixel vertex positions computed with PGXP, see
+	// emulator.Interconnect.SetPgxp
+	SubPixel bool
+	// Split the 3D polygons so the colors are interpolated with
+	// perspective correction, see emulator.SubdividePerspective. Needs PGXP
+	PerspectiveCorrect bool
+	triangles          []emulator.Vertex // Split triangles, reused between frames
+	vertices           []ebiten.Vertex   // Reused between frames
+	indices            []uint16
+	areas              []drawingAreaRun // Triangles grouped by drawing area
+	// Full frame and the lines of the current field, used when bob
+	// deinterlacing
+	frameImage *ebiten.Image
+	fieldImage *ebiten.Image
+}
+
+// Consecutive triangles that are clipped to the same drawing area. They're
+// drawn to a sub-image of the destination, which acts as a scissor
+type drawingAreaRun struct {
+	area image.Rectangle // Zero if the triangles aren't clipped
+	end  int             // End of the triangles in indices
+}
+
+// Returns a new Ebitengine renderer
+func NewEbitenRenderer() *EbitenRenderer {
+	return &EbitenRenderer{}
+}
+
+// Draws a finished frame. Must be called from the Ebitengine goroutine
+func (renderer *EbitenRenderer) Draw(screen *ebiten.Image, frame *emulator.Frame) {
+	// generate Ebiten vertices from draw data
+	renderer.vertices = renderer.vertices[:0]
+	renderer.indices = renderer.indices[:0]
+	renderer.areas = renderer.areas[:0]
+
+	vertices := frame.Vertices
+	if renderer.PerspectiveCorrect {
+		renderer.triangles = renderer.triangles[:0]
+		for i := 0; i+2 < len(vertices); i += 3 {
+			tri := [3]emulator.Vertex{vertices[i], vertices[i+1], vertices[i+2]}
+			renderer.triangles = emulator.SubdividePerspective(renderer.triangles, tri)
+		}
+		vertices = renderer.triangles
+	}
+
+	for idx, vtx := range vertices {
+		if idx%3 == 0 {
+			renderer.addTriangleArea(vtx.DrawingArea, idx)
+		}
+
+		x, y := float32(vtx.Position.X), float32(vtx.Position.Y)
+		if renderer.SubPixel && vtx.HasPrecise {
+			x, y = vtx.Precise.X, vtx.Precise.Y
+		}
+
+		renderer.vertices = append(renderer.vertices, ebiten.Vertex{
+			DstX:   x + float32(frame.Offset.X),
+			DstY:   y + float32(frame.Offset.Y),
+			ColorR: float32(vtx.Color.R) / 255,
+			ColorG: float32(vtx.Color.G) / 255,
+			ColorB: float32(vtx.Color.B) / 255,
+			ColorA: 1, // should always be 1
+		})
+		renderer.indices = append(renderer.indices, uint16(idx))
+	}
+
+	if !frame.Interlaced || renderer.Deinterlace != emulator.DEINTERLACE_BOB {
+		renderer.drawVertices(screen)
+		return
+	}
+
+	size := screen.Bounds().Size()
+	renderer.allocFieldImages(size.X, size.Y)
+	renderer.frameImage.Clear()
+	renderer.drawVertices(renderer.frameImage)
+	renderer.drawField(screen, float64(frame.FieldParity))
+}
+
+// Starts a new run of triangles at `start` if `area` isn't the drawing
+// area of the previous triangle
+func (renderer *EbitenRenderer) addTriangleArea(area image.Rectangle, start int) {
+	if n := len(renderer.areas); n > 0 && renderer.areas[n-1].area == area {
+		return
+	}
+	if n := len(renderer.areas); n > 0 {
+		renderer.areas[n-1].end = start
+	}
+	renderer.areas = append(renderer.areas, drawingAreaRun{area: area})
+}
+
+func (renderer *EbitenRenderer) drawVertices(dst *ebiten.Image) {
+	if n := len(renderer.areas); n > 0 {
+		renderer.areas[n-1].end = len(renderer.indices)
+	}
+
+	op := &ebiten.DrawTrianglesOptions{}
+	start := 0
+	for _, run := range renderer.areas {
+		indices := renderer.indices[start:run.end]
+		start = run.end
+
+		target := dst
+		if run.area != (image.Rectangle{}) {
+			area := run.area.Intersect(dst.Bounds())
+			if area.Empty() {
+				continue
+			}
+			// sub-images keep the coordinates of the parent image
+			target = dst.SubImage(area).(*ebiten.Image)
+		}
+		target.DrawTriangles(renderer.vertices, indices, emptyImage, op)
+	}
+}
+
+// Creates the images used for bob deinterlacing if the screen size changed
+func (renderer *EbitenRenderer) allocFieldImages(width, height int) {
+	if renderer.frameImage != nil && renderer.frameImage.Bounds().Size() == image.Pt(width, height) {
+		return
+	}
+	if renderer.frameImage != nil {
+		renderer.frameImage.Dispose()
+		renderer.fieldImage.Dispose()
+	}
+	renderer.frameImage = ebiten.NewImage(width, height)
+	renderer.fieldImage = ebiten.NewImage(width, height/2)
+}
+
+// Picks every other line of frameImage, starting from line `parity`, and
+// draws them doubled to `screen`
+func (renderer *EbitenRenderer) drawField(screen *ebiten.Image, parity float64) {
+	// line N of the field is sampled from the middle of line 2N+parity
+	op := &ebiten.DrawImageOptions{}
+	op.Filter = ebiten.FilterNearest
+	op.GeoM.Translate(0, 0.5-parity)
+	op.GeoM.Scale(1, 0.5)
+	renderer.fieldImage.Clear()
+	renderer.fieldImage.DrawImage(renderer.frameImage, op)
+
+	// every field line covers its own line and the one below it
+	op = &ebiten.DrawImageOptions{}
+	op.Filter = ebiten.FilterNearest
+	op.GeoM.Scale(1, 2)
+	op.GeoM.Translate(0, parity)
+	screen.DrawImage(renderer.fieldImage, op)
+}
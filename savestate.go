@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/zeozeozeo/gopsx/emulator"
+)
+
+// Amount of numbered savestate slots
+const stateSlots = 10
+
+// How long the savestate messages stay on screen
+const stateMessageTime = 3 * time.Second
+
+// Format of the savestate times shown on screen
+const stateTimeFormat = "2006-01-02 15:04:05"
+
+var (
+	stateSlot       int           // Selected savestate slot
+	stateMessage    string        // Shown on screen until stateMessageEnd
+	stateThumb      *ebiten.Image // Thumbnail of the selected slot, can be nil
+	stateMessageEnd time.Time
+)
+
+// Returns the name the savestates of the inserted disc start with: the
+// game ID, the name of the disc image if it doesn't have one, or "bios"
+// without a disc
+func stateName() string {
+	if disc == nil {
+		return "bios"
+	}
+	if id := discs[currentDisc].GameID(); id != "" {
+		return id
+	}
+	name := filepath.Base(discFiles[currentDisc])
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// Returns the path of a savestate slot, or of the auto-save if `slot` is
+// negative
+func statePath(slot int) string {
+	if slot < 0 {
+		return filepath.Join(*stateDir, stateName()+".auto.state")
+	}
+	return filepath.Join(*stateDir, fmt.Sprintf("%s.%d.state", stateName(), slot))
+}
+
+// Minus and Equal select the slot, Period saves and Comma loads it
+func handleStateKeys() {
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyMinus):
+		stateSlot = (stateSlot + stateSlots - 1) % stateSlots
+		showSlot()
+	case inpututil.IsKeyJustPressed(ebiten.KeyEqual):
+		stateSlot = (stateSlot + 1) % stateSlots
+		showSlot()
+	case inpututil.IsKeyJustPressed(ebiten.KeyPeriod):
+		if err := saveState(statePath(stateSlot)); err != nil {
+			fmt.Printf("main: couldn't save the state: %s\n", err)
+			showStateMessage(fmt.Sprintf("slot %d: couldn't save", stateSlot), nil)
+			return
+		}
+		showSlot()
+	case inpututil.IsKeyJustPressed(ebiten.KeyComma):
+		header, err := loadState(statePath(stateSlot))
+		if err != nil {
+			fmt.Printf("main: couldn't load the state: %s\n", err)
+			showStateMessage(fmt.Sprintf("slot %d: couldn't load", stateSlot), nil)
+			return
+		}
+		showStateMessage(fmt.Sprintf("slot %d: loaded %s", stateSlot, header.Time.Format(stateTimeFormat)), nil)
+	}
+}
+
+// Shows the time and the thumbnail of the selected slot
+func showSlot() {
+	file, err := os.Open(statePath(stateSlot))
+	if err != nil {
+		showStateMessage(fmt.Sprintf("slot %d: empty", stateSlot), nil)
+		return
+	}
+	defer file.Close()
+
+	header, err := emulator.ReadSaveStateHeader(file)
+	if err != nil {
+		showStateMessage(fmt.Sprintf("slot %d: %s", stateSlot, err), nil)
+		return
+	}
+	var thumb *ebiten.Image
+	if img, err := header.Image(); err == nil {
+		thumb = ebiten.NewImageFromImage(img)
+	}
+	showStateMessage(fmt.Sprintf("slot %d: %s", stateSlot, header.Time.Format(stateTimeFormat)), thumb)
+}
+
+func showStateMessage(msg string, thumb *ebiten.Image) {
+	stateMessage = msg
+	stateThumb = thumb
+	stateMessageEnd = time.Now().Add(stateMessageTime)
+}
+
+// Draws the last savestate message and the thumbnail of the slot
+func drawStateMessage(screen *ebiten.Image) {
+	if time.Now().After(stateMessageEnd) {
+		return
+	}
+	y := height - 24
+	if stateThumb != nil {
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Translate(8, float64(y-emulator.SAVESTATE_THUMBNAIL_HEIGHT-8))
+		screen.DrawImage(stateThumb, op)
+	}
+	ebitenutil.DebugPrintAt(screen, stateMessage, 8, y)
+}
+
+// Saves the state of the console to `path`. The file is replaced only
+// once the whole state is written
+func saveState(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := console.SaveState(file); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	fmt.Printf("main: saved the state to \"%s\"\n", path)
+	return nil
+}
+
+// Loads a savestate into the running console
+func loadState(path string) (*emulator.SaveStateHeader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	header, err := console.LoadState(file)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("main: loaded the state from \"%s\"\n", path)
+	return header, nil
+}
+
+// Saves the state to the auto-save slot when the emulator exits
+func autoSaveState() {
+	if !*autoSave || console == nil || didPanic || netplayOn {
+		return
+	}
+	if err := saveState(statePath(-1)); err != nil {
+		fmt.Printf("main: couldn't auto-save: %s\n", err)
+	}
+}
+
+// Loads a savestate into `cpu` before the console starts, see -resume and
+// -state
+func loadStateFile(cpu *emulator.CPU, path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Printf("main: couldn't load the state: %s\n", err)
+		return
+	}
+	defer file.Close()
+
+	header, err := emulator.ReadSaveState(file, cpu)
+	if err != nil {
+		fmt.Printf("main: couldn't load the state: %s\n", err)
+		return
+	}
+	fmt.Printf("main: loaded the state of %s from \"%s\"\n", header.Time.Format(stateTimeFormat), path)
+}